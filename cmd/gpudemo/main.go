@@ -69,17 +69,24 @@ func run(out string, size int) error {
 		return err
 	}
 	defer dev.Close()
-	log.Printf("GPU driver: %s", dev.Driver())
-
-	ks, err := shader.Compile(src)
+	a := dev.Adapter()
+	log.Printf("GPU driver: %s (%s %s)", dev.Driver(), a.Vendor, a.Name)
+
+	// The software driver, which Open falls back to without a GPU, runs the
+	// kernels compiled for the CPU.
+	compile := shader.Compile
+	if dev.Driver() == gpu.DriverSoftware {
+		compile = shader.CompileCPU
+	}
+	ks, err := compile(src)
 	if err != nil {
 		return err
 	}
-	vmod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: ks["VMain"].MSL})
+	vmod, err := dev.NewShaderModuleFromKernel(ks["VMain"])
 	if err != nil {
 		return err
 	}
-	fmod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: ks["FMain"].MSL})
+	fmod, err := dev.NewShaderModuleFromKernel(ks["FMain"])
 	if err != nil {
 		return err
 	}
@@ -47,6 +47,11 @@ func (g *Geometry) Materials() []material.Material {
 	return g.mats
 }
 
+// Mesh returns the mesh the geometry was built from.
+func (g *Geometry) Mesh() mesh.Mesh {
+	return g.mesh
+}
+
 func (g *Geometry) AABB() primitive.AABB {
 	return g.mesh.AABB()
 }
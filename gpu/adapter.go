@@ -0,0 +1,120 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Features is a bitmask of optional capabilities a device may have. The
+// Device API works without any of them; a feature only unlocks what it names.
+type Features uint32
+
+const (
+	// FeatureTimestampQuery is QueryTimestamp query sets: without it
+	// NewQuerySet rejects them.
+	FeatureTimestampQuery Features = 1 << iota
+	// FeatureFloat32Renderable is RGBA32Float and R32Float color targets.
+	// GLES needs EXT_color_buffer_float for them.
+	FeatureFloat32Renderable
+	// FeatureAnisotropicFiltering is a SamplerDescriptor.MaxAnisotropy above
+	// 1 taking effect; without it the sampler filters isotropically.
+	FeatureAnisotropicFiltering
+)
+
+var featureNames = []string{"timestamp-query", "float32-renderable", "anisotropic-filtering"}
+
+// Has reports whether f includes every feature of g.
+func (f Features) Has(g Features) bool { return f&g == g }
+
+func (f Features) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := f &^ (1<<len(featureNames) - 1); rest != 0 {
+		names = append(names, fmt.Sprintf("Features(%#x)", uint32(rest)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Limits are the largest values a device accepts. They are what the adapter
+// reports, so they may exceed what the Device API itself allows: a texture's
+// SampleCount, for one, is still 1 or 4.
+type Limits struct {
+	// MaxBufferSize is the largest buffer a kernel binding addresses, in
+	// bytes.
+	MaxBufferSize int
+	// MaxComputeWorkgroupSize is the largest workgroup size per dimension,
+	// and MaxComputeInvocations the most threads of one workgroup.
+	MaxComputeWorkgroupSize [3]int
+	MaxComputeInvocations   int
+	// MaxTextureDimension2D is the largest width or height of a 2D texture.
+	MaxTextureDimension2D int
+	// MaxColorAttachments is the most color targets of a render pass,
+	// ColorTexture included.
+	MaxColorAttachments int
+	// MaxSamplerAnisotropy is the largest anisotropy a sampler filters with;
+	// 1 without FeatureAnisotropicFiltering.
+	MaxSamplerAnisotropy int
+	// MinUniformBufferOffsetAlignment and MinStorageBufferOffsetAlignment
+	// are what the Offset of a BindGroupEntry of a uniform or storage buffer
+	// must be a multiple of, in bytes.
+	MinUniformBufferOffsetAlignment int
+	MinStorageBufferOffsetAlignment int
+}
+
+// AdapterInfo describes the device a driver runs on.
+type AdapterInfo struct {
+	Driver Driver
+	Vendor string // as the driver reports it, e.g. "Mesa", "NVIDIA", "Apple"
+	Name   string // e.g. "llvmpipe (LLVM 15.0.7, 256 bits)", "Apple M1"
+	// Software is set when the device is the CPU: Mesa's llvmpipe and
+	// lavapipe, and DriverSoftware.
+	Software bool
+}
+
+// capabilities is what a backend reports about its adapter when it opens.
+type capabilities struct {
+	info     AdapterInfo
+	limits   Limits
+	features Features
+}
+
+// Adapters lists the adapters Open can select on this machine, the GPU
+// drivers first and DriverSoftware, which is always available, last. There
+// is one adapter per driver, the device that driver opens: GL's default
+// display and Vulkan's first physical device, so a machine with several
+// GPUs lists one of them per driver. Each driver is opened and closed to
+// query it, so this is not cheap.
+func Adapters() []AdapterInfo {
+	var out []AdapterInfo
+	for _, drv := range []Driver{DriverMetal, DriverGL, DriverVulkan, DriverD3D12} {
+		b, got, err := openBackend(config{driver: drv})
+		if err != nil {
+			continue
+		}
+		info := b.capabilities().info
+		info.Driver = got
+		out = append(out, info)
+		b.close()
+	}
+	return append(out, softwareCapabilities.info)
+}
+
+// Adapter describes the device d runs on.
+func (d *Device) Adapter() AdapterInfo { return d.caps.info }
+
+// Limits returns the limits of d's adapter.
+func (d *Device) Limits() Limits { return d.caps.limits }
+
+// Features returns the optional features d has.
+func (d *Device) Features() Features { return d.caps.features }
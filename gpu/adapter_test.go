@@ -0,0 +1,114 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu_test
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+func TestFeatures(t *testing.T) {
+	f := gpu.FeatureTimestampQuery | gpu.FeatureFloat32Renderable
+	if !f.Has(gpu.FeatureFloat32Renderable) || f.Has(gpu.FeatureFloat32Renderable|gpu.FeatureAnisotropicFiltering) {
+		t.Errorf("%v: Has is wrong", f)
+	}
+	if got, want := f.String(), "timestamp-query|float32-renderable"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := gpu.Features(0).String(); got != "none" {
+		t.Errorf("Features(0).String = %q, want none", got)
+	}
+}
+
+// TestAdapters checks the software adapter, then that the adapter list ends
+// with it and that the device Open returns describes an adapter of the list.
+// Adapters and Open probe GL, so off darwin that part runs only with
+// EGL_PLATFORM=surfaceless, like the GL tests.
+func TestAdapters(t *testing.T) {
+	sw := softwareDevice(t)
+	if a := sw.Adapter(); a.Driver != gpu.DriverSoftware || !a.Software {
+		t.Errorf("software Adapter() = %+v", a)
+	}
+	checkLimits(t, sw)
+	if runtime.GOOS != "darwin" && os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to list the GPU adapters")
+	}
+
+	as := gpu.Adapters()
+	if len(as) == 0 || as[len(as)-1].Driver != gpu.DriverSoftware || !as[len(as)-1].Software {
+		t.Fatalf("Adapters = %+v, want the software adapter last", as)
+	}
+	for _, a := range as {
+		t.Logf("%v: %s %s (software %v)", a.Driver, a.Vendor, a.Name, a.Software)
+	}
+
+	dev, err := gpu.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer dev.Close()
+	got := dev.Adapter()
+	if got.Driver != dev.Driver() {
+		t.Errorf("Adapter().Driver = %v, want %v", got.Driver, dev.Driver())
+	}
+	found := false
+	for _, a := range as {
+		found = found || a == got
+	}
+	if !found {
+		t.Errorf("Adapter() = %+v is not in Adapters", got)
+	}
+	checkLimits(t, dev)
+}
+
+// checkLimits logs dev's limits and features and checks them for sanity.
+func checkLimits(t *testing.T, dev *gpu.Device) {
+	t.Helper()
+	l := dev.Limits()
+	t.Logf("%v: %+v, features %v", dev.Driver(), l, dev.Features())
+	if l.MaxBufferSize <= 0 || l.MaxComputeInvocations <= 0 || l.MaxComputeWorkgroupSize[0] <= 0 ||
+		l.MaxTextureDimension2D <= 0 || l.MaxColorAttachments < 4 || l.MaxSamplerAnisotropy < 1 {
+		t.Errorf("%v Limits = %+v", dev.Driver(), l)
+	}
+}
+
+// TestRequiredFeatures opens the software driver, which filters isotropically,
+// with and without a feature it lacks.
+func TestRequiredFeatures(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware), gpu.WithRequiredFeatures(gpu.FeatureFloat32Renderable))
+	if err != nil {
+		t.Fatalf("Open with a feature the software driver has: %v", err)
+	}
+	if f := dev.Features(); !f.Has(gpu.FeatureFloat32Renderable) || f.Has(gpu.FeatureAnisotropicFiltering) {
+		t.Errorf("software Features = %v", f)
+	}
+	dev.Close()
+
+	_, err = gpu.Open(gpu.WithDriver(gpu.DriverSoftware), gpu.WithRequiredFeatures(gpu.FeatureAnisotropicFiltering))
+	if !errors.Is(err, gpu.ErrUnsupported) {
+		t.Errorf("Open requiring anisotropic filtering on the software driver = %v, want ErrUnsupported", err)
+	}
+
+	// DriverAuto settles on whichever driver has the feature, or fails. It
+	// probes GL, gated as in TestAdapters.
+	if runtime.GOOS != "darwin" && os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		return
+	}
+	dev, err = gpu.Open(gpu.WithRequiredFeatures(gpu.FeatureAnisotropicFiltering))
+	if err != nil {
+		if !errors.Is(err, gpu.ErrUnsupported) {
+			t.Errorf("Open requiring anisotropic filtering = %v, want ErrUnsupported", err)
+		}
+		return
+	}
+	defer dev.Close()
+	if !dev.Features().Has(gpu.FeatureAnisotropicFiltering) {
+		t.Errorf("%v device opened without the required anisotropic filtering", dev.Driver())
+	}
+}
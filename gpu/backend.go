@@ -4,26 +4,64 @@
 
 package gpu
 
+import (
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
 // backend is the private driver interface the public Device API dispatches to.
 // One implementation per driver (Metal now; GL/Vulkan/DX12 later) lets the
 // public surface stay backend-agnostic. openBackend is provided per platform.
 type backend interface {
 	newBuffer(size int, usage BufferUsage, data []byte) (backendBuffer, error)
 	newShaderModule(src ShaderSource) (backendShaderModule, error)
-	newComputePipeline(mod backendShaderModule, entry string) (backendComputePipeline, error)
-	newTexture(format TextureFormat, w, h int, renderTarget bool) (backendTexture, error)
+	newComputePipeline(mod backendShaderModule, entry string, workgroup [3]int) (backendComputePipeline, error)
+	// newTexture allocates a texture of a normalized descriptor.
+	newTexture(desc TextureDescriptor) (backendTexture, error)
 	newSampler(desc SamplerDescriptor) backendSampler
-	newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat) (backendRenderPipeline, error)
+	newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat, state renderState) (backendRenderPipeline, error)
+	newQuerySet(typ QueryType, count int) (backendQuerySet, error)
 	newCommandBuffer() backendCommandBuffer
 	newWindowSurface(display, window uintptr, w, h int) (backendWindowSurface, error)
 	windowVisualID() uint32 // native visual an on-screen window must use (0 if N/A)
+	// capabilities describes the adapter; it is queried once, at open.
+	capabilities() capabilities
+	// setErrorHandler installs, before any other call, the function the
+	// backend reports the errors of its work with (see Error and
+	// ErrDeviceLost). The backends embed errorHandler for it.
+	setErrorHandler(fn func(error))
 	waitIdle()
+	// onSubmittedWorkDone calls fn on a new goroutine once all work committed
+	// so far has completed. It must not block the caller.
+	onSubmittedWorkDone(fn func())
 	close() error
 }
 
+// errorHandler implements backend.setErrorHandler.
+type errorHandler struct{ fn func(error) }
+
+func (h *errorHandler) setErrorHandler(fn func(error)) { h.fn = fn }
+
+// report hands err, if any, to the device.
+func (h *errorHandler) report(err error) {
+	if err != nil && h.fn != nil {
+		h.fn(err)
+	}
+}
+
+// backendTexture is a texture. readLevel and writeLevel move the tightly
+// packed w x h image of mip level and layer (a 3D texture's depth slice) in
+// storage row order; see Texture.WriteLevel.
 type backendTexture interface {
 	readPixels() []byte
-	write(pixels []byte, bytesPerRow int)
+	readLevel(level, layer, w, h int) []byte
+	writeLevel(level, layer, w, h int, pixels []byte)
+	// generateMipmaps fills levels 1 and up of every layer from level 0,
+	// for a filterable format.
+	generateMipmaps()
+	release()
 }
 
 // backendWindowSurface is an on-screen swapchain bound to a native window.
@@ -37,51 +75,142 @@ type backendWindowSurface interface {
 
 type backendSampler interface{ isSampler() }
 
-type backendRenderPipeline interface{ isRenderPipeline() }
+type backendRenderPipeline interface{ release() }
 
 // renderColorTarget is one extra color attachment (1..N) of a render pass.
 type renderColorTarget struct {
-	tex   backendTexture
-	clear [4]float64
+	tex     backendTexture
+	resolve backendTexture // optional single-sampled resolve target
+	clear   [4]float64
+}
+
+// colorResolves returns the resolve targets of extra, nil for none.
+func colorResolves(extra []renderColorTarget) []backendTexture {
+	rs := make([]backendTexture, len(extra))
+	for i, t := range extra {
+		rs[i] = t.resolve
+	}
+	return rs
 }
 
 // renderPassInfo is the backend-facing description of a render pass.
 type renderPassInfo struct {
 	color      backendTexture
+	resolve    backendTexture // optional resolve target of color
 	load       LoadOp
 	clearColor [4]float64
 	extraColor []renderColorTarget // color attachments 1..N
 	depth      backendTexture      // optional depth attachment
 	clearDepth float64
+	timestamps *passTimestamps // optional begin/end timestamp writes
+	occlusion  backendQuerySet // optional QueryOcclusion set
+	samples    int             // the attachments' sample count
 }
 
 type backendBuffer interface {
 	bytes() []byte
+	// read and write copy len(p) bytes between p and the buffer at offset.
+	// They do not wait for GPU work; MapAsync orders them after it.
+	read(offset int, p []byte)
+	write(offset int, p []byte)
 	release()
 }
 
-type backendShaderModule interface{ isShaderModule() }
+type backendShaderModule interface{ release() }
 
-type backendComputePipeline interface{ maxThreads() int }
+type backendComputePipeline interface {
+	maxThreads() int
+	release()
+}
+
+// backendQuerySet is a query set of one QueryType. results converts
+// timestamps to nanoseconds and must only be called once the work writing
+// them has completed.
+type backendQuerySet interface {
+	results(first, count int) ([]uint64, error)
+	release()
+}
 
 // backendCommandBuffer records and submits one command buffer. The Metal
 // backend encodes eagerly (Metal is itself the explicit command-buffer model);
 // the future GL backend records and replays on its context thread.
+//
+// A pass with timestamps (beginCompute's ts, renderPassInfo.timestamps) writes
+// its begin query before its first command and its end query after its last.
 type backendCommandBuffer interface {
-	beginCompute()
-	setComputePipeline(backendComputePipeline)
-	setBuffer(b backendBuffer, offset, index int)
+	beginCompute(ts *passTimestamps)
+	// setComputePipeline and setRenderPipeline take, besides the pipeline,
+	// the layout of its kernels' own bindings (nil without reflection),
+	// whose minimum sizes the validation layer checks; backends ignore it.
+	setComputePipeline(p backendComputePipeline, kernel *BindGroupLayout)
+	// setBuffer and setRenderBuffer bind size bytes at offset of b as the
+	// kind binding at index.
+	setBuffer(b backendBuffer, offset, size, index int, kind BindingKind)
 	setComputeTexture(index int, t backendTexture)
 	setComputeSampler(index int, s backendSampler)
 	dispatch(x, y, z int)
+	// dispatchIndirect dispatches the workgroup counts at offset of b.
+	dispatchIndirect(b backendBuffer, offset int)
 	endCompute()
 
 	beginRender(info renderPassInfo)
-	setRenderPipeline(backendRenderPipeline)
-	setRenderBuffer(b backendBuffer, offset, index int)
-	setVertexBuffer(b backendBuffer, index int)
-	draw(prim Primitive, start, count int)
+	setRenderPipeline(p backendRenderPipeline, kernel *BindGroupLayout)
+	setRenderBuffer(b backendBuffer, offset, size, index int, kind BindingKind)
+	setVertexBuffer(b backendBuffer, offset, size, index int)
+	draw(prim Primitive, start, count, firstInstance, instanceCount int)
+	setIndexBuffer(b backendBuffer, offset int, format IndexFormat)
+	drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int)
+	// drawIndirect and drawIndexedIndirect draw with the arguments at offset
+	// of b (see DrawIndirectSize, DrawIndexedIndirectSize).
+	drawIndirect(prim Primitive, b backendBuffer, offset int)
+	drawIndexedIndirect(prim Primitive, b backendBuffer, offset int)
+	// beginOcclusionQuery and endOcclusionQuery bracket draws counted by
+	// query index of the pass's occlusion set.
+	beginOcclusionQuery(index int)
+	endOcclusionQuery()
 	endRender()
 
+	// Copies run between passes, in recording order with the passes around
+	// them. Texture regions are in texel (storage) rows; see copy.go.
+	copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int)
+	copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int)
+	copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int)
+	copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int)
+
+	// finish ends recording: the command buffer is submitted next.
+	finish()
 	commit()
 }
+
+// workgroups returns how many workgroups of wg threads cover a grid of n
+// threads; a zero size counts as one.
+func workgroups(n, wg int) int {
+	if wg < 1 {
+		wg = 1
+	}
+	return (n + wg - 1) / wg
+}
+
+// logLine matches the source line a shader compiler log message names:
+// Metal's program_source:12:5, Mesa's 0:12(5), and 0(12) or 0:12 elsewhere.
+var logLine = regexp.MustCompile(`(?:program_source:|\b0:|\b0\()(\d+)`)
+
+// goPositions prefixes each message of a shader compile log that names a
+// line of the generated source with the Go position lines gives that line.
+func goPositions(log string, lines []token.Position) string {
+	if len(lines) == 0 {
+		return log
+	}
+	msgs := strings.Split(log, "\n")
+	for i, msg := range msgs {
+		m := logLine.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= len(lines) && lines[n-1].IsValid() {
+			msgs[i] = lines[n-1].String() + ": " + msg
+		}
+	}
+	return strings.Join(msgs, "\n")
+}
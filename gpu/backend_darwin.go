@@ -8,6 +8,8 @@ package gpu
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"unsafe"
 
 	"poly.red/gpu/mtl"
@@ -21,19 +23,50 @@ func openBackend(c config) (backend, Driver, error) {
 		if err != nil || !dev.Available() {
 			return nil, DriverAuto, ErrUnsupported
 		}
-		return &metalBackend{dev: dev, queue: dev.MakeCommandQueue()}, DriverMetal, nil
+		m := &metalBackend{dev: dev, queue: dev.MakeCommandQueue()}
+		m.initCapabilities()
+		return m, DriverMetal, nil
 	default:
 		return nil, DriverAuto, ErrUnsupported
 	}
 }
 
 type metalBackend struct {
+	errorHandler
 	dev     mtl.Device
 	queue   mtl.CommandQueue
 	last    mtl.CommandBuffer // last committed buffer, for waitIdle
 	hasLast bool
+	caps    capabilities
+}
+
+// initCapabilities fills m.caps. Beyond the buffer length, the limits are the
+// ones every Metal GPU family the backend runs on has, from Apple's feature
+// set tables.
+func (m *metalBackend) initCapabilities() {
+	m.caps = capabilities{
+		info: AdapterInfo{Driver: DriverMetal, Vendor: "Apple", Name: m.dev.Name},
+		limits: Limits{
+			MaxBufferSize:           m.dev.MaxBufferLength(),
+			MaxComputeWorkgroupSize: [3]int{1024, 1024, 1024},
+			MaxComputeInvocations:   1024,
+			MaxTextureDimension2D:   16384,
+			MaxColorAttachments:     8,
+			MaxSamplerAnisotropy:    maxAnisotropy,
+			// Buffer offsets need 4 bytes on Apple GPUs, 256 on Intel and
+			// AMD Macs; the larger keeps offsets portable.
+			MinUniformBufferOffsetAlignment: 256,
+			MinStorageBufferOffsetAlignment: 256,
+		},
+		features: FeatureFloat32Renderable | FeatureAnisotropicFiltering,
+	}
+	if m.dev.SupportsStageBoundarySampling() {
+		m.caps.features |= FeatureTimestampQuery
+	}
 }
 
+func (m *metalBackend) capabilities() capabilities { return m.caps }
+
 func (m *metalBackend) newBuffer(size int, usage BufferUsage, data []byte) (backendBuffer, error) {
 	var buf mtl.Buffer
 	if len(data) > 0 {
@@ -50,12 +83,12 @@ func (m *metalBackend) newShaderModule(src ShaderSource) (backendShaderModule, e
 	}
 	lib, err := m.dev.MakeLibrary(src.MSL, mtl.CompileOptions{})
 	if err != nil {
-		return nil, err
+		return nil, errors.New(goPositions(err.Error(), src.Lines))
 	}
 	return &metalModule{lib: lib}, nil
 }
 
-func (m *metalBackend) newComputePipeline(mod backendShaderModule, entry string) (backendComputePipeline, error) {
+func (m *metalBackend) newComputePipeline(mod backendShaderModule, entry string, workgroup [3]int) (backendComputePipeline, error) {
 	mm, ok := mod.(*metalModule)
 	if !ok {
 		return nil, errors.New("gpu: shader module is not a metal module")
@@ -68,7 +101,7 @@ func (m *metalBackend) newComputePipeline(mod backendShaderModule, entry string)
 	if err != nil {
 		return nil, err
 	}
-	return &metalPipeline{cps: cps, max: cps.MaxTotalThreadsPerThreadgroup()}, nil
+	return &metalPipeline{cps: cps, max: cps.MaxTotalThreadsPerThreadgroup(), wg: workgroup}, nil
 }
 
 func (m *metalBackend) newCommandBuffer() backendCommandBuffer {
@@ -89,6 +122,21 @@ func (m *metalBackend) waitIdle() {
 	}
 }
 
+// onSubmittedWorkDone waits for the last committed command buffer on a
+// goroutine of its own; a queue runs its command buffers in commit order, so
+// that one completing means all of them have.
+func (m *metalBackend) onSubmittedWorkDone(fn func()) {
+	if !m.hasLast {
+		go fn()
+		return
+	}
+	last := m.last
+	go func() {
+		last.WaitUntilCompleted()
+		fn()
+	}()
+}
+
 func (m *metalBackend) close() error {
 	m.queue.Release()
 	return nil
@@ -102,40 +150,74 @@ type metalBuffer struct {
 func (b *metalBuffer) bytes() []byte {
 	return unsafe.Slice((*byte)(b.buf.Content()), b.size)
 }
+func (b *metalBuffer) read(offset int, p []byte) {
+	copy(p, unsafe.Slice((*byte)(b.buf.Content()), b.size)[offset:])
+}
+func (b *metalBuffer) write(offset int, p []byte) {
+	copy(unsafe.Slice((*byte)(b.buf.Content()), b.size)[offset:], p)
+}
 func (b *metalBuffer) release() { b.buf.Release() }
 
 type metalModule struct{ lib mtl.Library }
 
-func (*metalModule) isShaderModule() {}
+func (m *metalModule) release() { m.lib.Release() }
 
 type metalPipeline struct {
 	cps mtl.ComputePipelineState
 	max int
+	wg  [3]int // the kernel's workgroup size, if it declares one
 }
 
 func (p *metalPipeline) maxThreads() int { return p.max }
 
+func (p *metalPipeline) release() { p.cps.Release() }
+
 type metalCmd struct {
 	m    *metalBackend
 	cb   mtl.CommandBuffer
 	enc  mtl.ComputeCommandEncoder
 	renc mtl.RenderCommandEncoder
 	cur  *metalPipeline
+
+	// Metal takes the index buffer per draw rather than as encoder state, so
+	// setIndexBuffer only remembers it for drawIndexed.
+	ibuf     *metalBuffer
+	ibOff    int // byte offset of the first index in ibuf
+	ifmt     mtl.IndexType
+	ibStride int
 }
 
-func (c *metalCmd) beginCompute() { c.enc = c.cb.MakeComputeCommandEncoder() }
+func (c *metalCmd) beginCompute(ts *passTimestamps) {
+	if ts == nil {
+		c.enc = c.cb.MakeComputeCommandEncoder()
+		return
+	}
+	c.enc = c.cb.MakeComputeCommandEncoderWithDescriptor(mtl.ComputePassDescriptor{SampleBuffer: ts.sampleBuffer()})
+}
 
-func (c *metalCmd) setComputePipeline(p backendComputePipeline) {
+func (c *metalCmd) setComputePipeline(p backendComputePipeline, _ *BindGroupLayout) {
 	mp := p.(*metalPipeline)
 	c.cur = mp
 	c.enc.SetComputePipelineState(mp.cps)
 }
 
-func (c *metalCmd) setBuffer(b backendBuffer, offset, index int) {
+func (c *metalCmd) setBuffer(b backendBuffer, offset, size, index int, _ BindingKind) {
 	c.enc.SetBuffer(b.(*metalBuffer).buf, offset, index)
 }
 
 func (c *metalCmd) dispatch(x, y, z int) {
+	if wg := c.cur.wg; wg[0] > 0 {
+		// Shared memory and barriers need whole threadgroups of the declared
+		// size, so dispatch threadgroups rather than threads.
+		for i := range wg {
+			wg[i] = max(wg[i], 1)
+		}
+		c.enc.DispatchThreadgroups(
+			mtl.Size{Width: workgroups(x, wg[0]), Height: workgroups(max(y, 1), wg[1]), Depth: workgroups(max(z, 1), wg[2])},
+			mtl.Size{Width: wg[0], Height: wg[1], Depth: wg[2]},
+		)
+		return
+	}
 	total := x
 	if y > 1 {
 		total *= y
@@ -156,9 +238,100 @@ func (c *metalCmd) dispatch(x, y, z int) {
 	)
 }
 
+// dispatchIndirect dispatches threadgroups of the kernel's declared size, or
+// of one thread, as the GL and Vulkan local size is without a declaration.
+func (c *metalCmd) dispatchIndirect(b backendBuffer, offset int) {
+	tg := mtl.Size{Width: 1, Height: 1, Depth: 1}
+	if wg := c.cur.wg; wg[0] > 0 {
+		tg = mtl.Size{Width: wg[0], Height: max(wg[1], 1), Depth: max(wg[2], 1)}
+	}
+	c.enc.DispatchThreadgroupsWithIndirectBuffer(b.(*metalBuffer).buf, offset, tg)
+}
+
 func (c *metalCmd) endCompute() { c.enc.EndEncoding() }
 
+// metalQuerySet is a timestamp counter sample buffer. Samples are GPU ticks;
+// the CPU and GPU clocks sampled together at creation and again at results
+// map them to nanoseconds.
+type metalQuerySet struct {
+	m          *metalBackend
+	sb         mtl.CounterSampleBuffer
+	cpu0, gpu0 uint64
+}
+
+func (m *metalBackend) newQuerySet(typ QueryType, count int) (backendQuerySet, error) {
+	if typ == QueryOcclusion {
+		return &metalOcclusionSet{buf: m.dev.MakeBuffer(nil, uintptr(count*8), mtl.ResourceStorageModeShared), count: count}, nil
+	}
+	if !m.dev.SupportsStageBoundarySampling() {
+		return nil, errTimestampUnsupported
+	}
+	sb, err := m.dev.MakeTimestampSampleBuffer(count)
+	if err != nil {
+		return nil, fmt.Errorf("gpu: %w", err)
+	}
+	q := &metalQuerySet{m: m, sb: sb}
+	q.cpu0, q.gpu0 = m.dev.SampleTimestamps()
+	return q, nil
+}
+
+func (q *metalQuerySet) results(first, count int) ([]uint64, error) {
+	raw := q.sb.ResolveCounterRange(first, count)
+	cpu1, gpu1 := q.m.dev.SampleTimestamps()
+	rate := 1.0
+	if gpu1 > q.gpu0 {
+		rate = float64(cpu1-q.cpu0) / float64(gpu1-q.gpu0)
+	}
+	out := make([]uint64, count)
+	for i, v := range raw {
+		if v != 0 && v != mtl.CounterErrorValue {
+			out[i] = q.cpu0 + uint64(float64(int64(v-q.gpu0))*rate)
+		}
+	}
+	return out, nil
+}
+
+func (q *metalQuerySet) release() { q.sb.Release() }
+
+// metalOcclusionSet is a visibility result buffer of one 8-byte sample
+// count per query.
+type metalOcclusionSet struct {
+	buf   mtl.Buffer
+	count int
+}
+
+func (q *metalOcclusionSet) results(first, count int) ([]uint64, error) {
+	return slices.Clone(unsafe.Slice((*uint64)(q.buf.Content()), q.count)[first : first+count]), nil
+}
+
+func (q *metalOcclusionSet) release() { q.buf.Release() }
+
+// sampleBuffer is the Metal sample buffer attachment of ts.
+func (ts *passTimestamps) sampleBuffer() *mtl.SampleBufferAttachment {
+	return &mtl.SampleBufferAttachment{Buffer: ts.set.(*metalQuerySet).sb, Start: ts.begin, End: ts.end}
+}
+
+func (c *metalCmd) finish() {}
+
 func (c *metalCmd) commit() {
+	cb, m := c.cb, c.m
+	cb.AddCompletedHandler(func() {
+		err := cb.Error()
+		if err == nil {
+			return
+		}
+		filter := ErrorFilterInternal
+		if e, ok := err.(*mtl.CommandBufferError); ok {
+			switch e.Code {
+			case mtl.CommandBufferErrorDeviceRemoved, mtl.CommandBufferErrorAccessRevoked:
+				m.report(fmt.Errorf("gpu/metal: %w: %w", ErrDeviceLost, err))
+				return
+			case mtl.CommandBufferErrorOutOfMemory:
+				filter = ErrorFilterOutOfMemory
+			}
+		}
+		m.report(&Error{Filter: filter, Err: fmt.Errorf("gpu/metal: %w", err)})
+	})
 	c.cb.Commit()
 	c.m.last = c.cb
 	c.m.hasLast = true
@@ -174,11 +347,36 @@ func mtlFormat(f TextureFormat) mtl.PixelFormat {
 		return mtl.PixelFormatRGBA32Float
 	case Depth32Float:
 		return mtl.PixelFormatDepth32Float
+	case R8Unorm:
+		return mtl.PixelFormatR8UNorm
+	case RG16Float:
+		return mtl.PixelFormatRG16Float
+	case RGBA16Float:
+		return mtl.PixelFormatRGBA16Float
+	case R32Float:
+		return mtl.PixelFormatR32Float
+	case Depth24Stencil8:
+		// Apple GPUs have no 24-bit depth format.
+		return mtl.PixelFormatDepth32FloatStencil8
+	case BGRA8UnormSRGB:
+		return mtl.PixelFormatBGRA8UNormSRGB
 	default:
 		return mtl.PixelFormatRGBA8UNorm
 	}
 }
 
+func mtlTextureType(d TextureDimension) mtl.TextureType {
+	switch d {
+	case TextureDimension2DArray:
+		return mtl.TextureType2DArray
+	case TextureDimensionCube:
+		return mtl.TextureTypeCube
+	case TextureDimension3D:
+		return mtl.TextureType3D
+	}
+	return mtl.TextureType2D
+}
+
 func mtlPrim(p Primitive) mtl.PrimitiveType {
 	switch p {
 	case TriangleStrip:
@@ -192,34 +390,49 @@ func mtlPrim(p Primitive) mtl.PrimitiveType {
 	}
 }
 
-func (m *metalBackend) newTexture(format TextureFormat, w, h int, renderTarget bool) (backendTexture, error) {
+func (m *metalBackend) newTexture(desc TextureDescriptor) (backendTexture, error) {
 	usage := mtl.TextureUsageShaderRead
-	if renderTarget {
+	if desc.RenderTarget {
 		usage |= mtl.TextureUsageRenderTarget
 	}
 	// A depth texture cannot use Shared storage on macOS; it is a private
 	// render-target attachment that is never read back to the CPU.
 	storage := mtl.StorageModeShared
-	if format == Depth32Float {
+	if desc.Format.isDepth() {
 		storage = mtl.StorageModePrivate
 		usage = mtl.TextureUsageRenderTarget
 	}
-	tex := m.dev.MakeTexture(mtl.TextureDescriptor{
-		PixelFormat: mtlFormat(format),
-		Width:       w,
-		Height:      h,
-		StorageMode: storage,
-		Usage:       usage,
-	})
-	// Bytes per pixel for CPU readback: RGBA32Float is 16, RGBA8Unorm is 4.
-	bpp := 4
-	if format == RGBA32Float {
-		bpp = 16
+	td := mtl.TextureDescriptor{
+		TextureType:      mtlTextureType(desc.Dimension),
+		PixelFormat:      mtlFormat(desc.Format),
+		Width:            desc.Width,
+		Height:           desc.Height,
+		MipmapLevelCount: desc.MipLevelCount,
+		SampleCount:      desc.SampleCount,
+		StorageMode:      storage,
+		Usage:            usage,
+	}
+	// Multisampled textures are GPU-only: they leave through a resolve or a
+	// kernel's read, never the CPU.
+	if desc.SampleCount > 1 {
+		td.TextureType = mtl.TextureType2DMultisample
+		td.StorageMode = mtl.StorageModePrivate
+	}
+	// A cube's six faces are its slices; its array length stays 1.
+	switch desc.Dimension {
+	case TextureDimension2DArray:
+		td.ArrayLength = desc.DepthOrArrayLayers
+	case TextureDimension3D:
+		td.Depth = desc.DepthOrArrayLayers
 	}
-	return &metalTexture{tex: tex, w: w, h: h, bpp: bpp}, nil
+	tex := m.dev.MakeTexture(td)
+	return &metalTexture{
+		m: m, tex: tex, w: desc.Width, h: desc.Height, bpp: desc.Format.bytesPerPixel(),
+		volume: desc.Dimension == TextureDimension3D, stencil: desc.Format == Depth24Stencil8,
+	}, nil
 }
 
-func (m *metalBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat) (backendRenderPipeline, error) {
+func (m *metalBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat, state renderState) (backendRenderPipeline, error) {
 	vfn, err := vmod.(*metalModule).lib.MakeFunction(ventry)
 	if err != nil {
 		return nil, err
@@ -232,17 +445,27 @@ func (m *metalBackend) newRenderPipeline(vmod backendShaderModule, ventry string
 		VertexFunction:   vfn,
 		FragmentFunction: ffn,
 		ColorPixelFormat: mtlFormat(color),
+		SampleCount:      state.samples,
 	}
 	for _, f := range extraColor {
 		pdesc.ExtraColorPixelFormats = append(pdesc.ExtraColorPixelFormats, mtlFormat(f))
 	}
-	p := &metalRenderPipeline{}
+	for _, bs := range state.blend {
+		pdesc.Blend = append(pdesc.Blend, mtlBlend(bs))
+		pdesc.WriteMasks = append(pdesc.WriteMasks, mtlWriteMask(state.colorWrite))
+	}
+	p := &metalRenderPipeline{cull: mtlCull(state.cull), winding: mtl.WindingCounterClockwise}
+	if state.frontFace == FrontCW {
+		p.winding = mtl.WindingClockwise
+	}
 	if depth != FormatNone {
 		pdesc.DepthPixelFormat = mtlFormat(depth)
-		// Standard 3D depth test: keep the nearer fragment and write its depth.
+		if depth == Depth24Stencil8 {
+			pdesc.StencilPixelFormat = pdesc.DepthPixelFormat
+		}
 		p.depthState = m.dev.MakeDepthStencilState(mtl.DepthStencilDescriptor{
-			DepthCompareFunction: mtl.CompareFunctionLess,
-			DepthWriteEnabled:    true,
+			DepthCompareFunction: mtlCompare(state.depthCompare),
+			DepthWriteEnabled:    state.depthWrite,
 		})
 		p.hasDepth = true
 	}
@@ -255,11 +478,27 @@ func (m *metalBackend) newRenderPipeline(vmod backendShaderModule, ventry string
 }
 
 type metalTexture struct {
-	tex  mtl.Texture
-	w, h int
-	bpp  int // bytes per pixel (RGBA8Unorm=4, RGBA32Float=16), for readback sizing
+	m       *metalBackend
+	tex     mtl.Texture
+	w, h    int
+	bpp     int  // bytes per pixel (RGBA8Unorm=4, RGBA32Float=16), for readback sizing
+	volume  bool // a 3D texture, whose layers are depth slices
+	stencil bool // a depth-stencil texture, attached as both
 }
 
+// generateMipmaps blits the levels on a command buffer of its own and waits
+// for it, as WriteLevel's uploads are immediate too.
+func (t *metalTexture) generateMipmaps() {
+	cb := t.m.queue.MakeCommandBuffer()
+	bce := cb.MakeBlitCommandEncoder()
+	bce.GenerateMipmaps(t.tex)
+	bce.EndEncoding()
+	cb.Commit()
+	cb.WaitUntilCompleted()
+}
+
+func (t *metalTexture) release() { t.tex.Release() }
+
 func (t *metalTexture) readPixels() []byte {
 	bpp := t.bpp
 	if bpp == 0 {
@@ -270,8 +509,29 @@ func (t *metalTexture) readPixels() []byte {
 	return dst
 }
 
-func (t *metalTexture) write(pixels []byte, bytesPerRow int) {
-	t.tex.ReplaceRegion(mtl.RegionMake2D(0, 0, t.w, t.h), 0, pixels, uintptr(bytesPerRow))
+// levelRegion returns the region and slice of the w x h image of layer: a
+// slice of an array or cube, or a depth slice of a 3D texture's only slice.
+func (t *metalTexture) levelRegion(layer, w, h int) (mtl.Region, int) {
+	r := mtl.RegionMake2D(0, 0, w, h)
+	if t.volume {
+		r.Origin.Z = layer
+		return r, 0
+	}
+	return r, layer
+}
+
+func (t *metalTexture) readLevel(level, layer, w, h int) []byte {
+	row := w * t.bpp
+	dst := make([]byte, row*h)
+	r, slice := t.levelRegion(layer, w, h)
+	t.tex.GetBytesSlice(dst, row, row*h, r, level, slice)
+	return dst
+}
+
+func (t *metalTexture) writeLevel(level, layer, w, h int, pixels []byte) {
+	row := w * t.bpp
+	r, slice := t.levelRegion(layer, w, h)
+	t.tex.ReplaceRegionSlice(r, level, slice, pixels, row, row*h)
 }
 
 type metalSampler struct{ s mtl.SamplerState }
@@ -293,12 +553,24 @@ func mtlAddress(a AddressMode) mtl.SamplerAddressMode {
 }
 
 func (m *metalBackend) newSampler(desc SamplerDescriptor) backendSampler {
-	return &metalSampler{s: m.dev.MakeSamplerState(mtl.SamplerDescriptor{
-		MinFilter:    mtlFilter(desc.MinFilter),
-		MagFilter:    mtlFilter(desc.MagFilter),
-		SAddressMode: mtlAddress(desc.AddressU),
-		TAddressMode: mtlAddress(desc.AddressV),
-	})}
+	mip := mtl.SamplerMipFilterNearest
+	if desc.MipmapFilter == FilterLinear {
+		mip = mtl.SamplerMipFilterLinear
+	}
+	sd := mtl.SamplerDescriptor{
+		MinFilter:     mtlFilter(desc.MinFilter),
+		MagFilter:     mtlFilter(desc.MagFilter),
+		MipFilter:     mip,
+		SAddressMode:  mtlAddress(desc.AddressU),
+		TAddressMode:  mtlAddress(desc.AddressV),
+		LodMinClamp:   desc.LodMinClamp,
+		LodMaxClamp:   desc.LodMaxClamp,
+		MaxAnisotropy: desc.MaxAnisotropy,
+	}
+	if desc.Compare != CompareUndefined {
+		sd.CompareFunction = mtlCompare(desc.Compare)
+	}
+	return &metalSampler{s: m.dev.MakeSamplerState(sd)}
 }
 
 func (c *metalCmd) setComputeTexture(index int, t backendTexture) {
@@ -313,30 +585,126 @@ type metalRenderPipeline struct {
 	rps        mtl.RenderPipelineState
 	depthState mtl.DepthStencilState
 	hasDepth   bool
+	cull       mtl.CullMode
+	winding    mtl.Winding
 }
 
-func (*metalRenderPipeline) isRenderPipeline() {}
+func (p *metalRenderPipeline) release() {
+	p.rps.Release()
+	if p.hasDepth {
+		p.depthState.Release()
+	}
+}
+
+// mtlCompare maps a resolved (never CompareUndefined) depth or sampler test.
+func mtlCompare(f CompareFunction) mtl.CompareFunction {
+	switch f {
+	case CompareNever:
+		return mtl.CompareFunctionNever
+	case CompareEqual:
+		return mtl.CompareFunctionEqual
+	case CompareLessEqual:
+		return mtl.CompareFunctionLessEqual
+	case CompareGreater:
+		return mtl.CompareFunctionGreater
+	case CompareNotEqual:
+		return mtl.CompareFunctionNotEqual
+	case CompareGreaterEqual:
+		return mtl.CompareFunctionGreaterEqual
+	case CompareAlways:
+		return mtl.CompareFunctionAlways
+	}
+	return mtl.CompareFunctionLess
+}
+
+func mtlCull(c CullMode) mtl.CullMode {
+	switch c {
+	case CullFront:
+		return mtl.CullModeFront
+	case CullBack:
+		return mtl.CullModeBack
+	}
+	return mtl.CullModeNone
+}
+
+var mtlBlendFactors = [...]mtl.BlendFactor{
+	BlendZero:             mtl.BlendFactorZero,
+	BlendOne:              mtl.BlendFactorOne,
+	BlendSrc:              mtl.BlendFactorSourceColor,
+	BlendOneMinusSrc:      mtl.BlendFactorOneMinusSourceColor,
+	BlendSrcAlpha:         mtl.BlendFactorSourceAlpha,
+	BlendOneMinusSrcAlpha: mtl.BlendFactorOneMinusSourceAlpha,
+	BlendDst:              mtl.BlendFactorDestinationColor,
+	BlendOneMinusDst:      mtl.BlendFactorOneMinusDestinationColor,
+	BlendDstAlpha:         mtl.BlendFactorDestinationAlpha,
+	BlendOneMinusDstAlpha: mtl.BlendFactorOneMinusDestinationAlpha,
+}
+
+var mtlBlendOps = [...]mtl.BlendOperation{
+	BlendOpAdd:             mtl.BlendOperationAdd,
+	BlendOpSubtract:        mtl.BlendOperationSubtract,
+	BlendOpReverseSubtract: mtl.BlendOperationReverseSubtract,
+	BlendOpMin:             mtl.BlendOperationMin,
+	BlendOpMax:             mtl.BlendOperationMax,
+}
+
+// mtlWriteMask converts a ColorWriteMask; Metal numbers the channels the
+// other way round.
+func mtlWriteMask(m ColorWriteMask) mtl.ColorWriteMask {
+	var w mtl.ColorWriteMask
+	if m&ColorWriteRed != 0 {
+		w |= mtl.ColorWriteMaskRed
+	}
+	if m&ColorWriteGreen != 0 {
+		w |= mtl.ColorWriteMaskGreen
+	}
+	if m&ColorWriteBlue != 0 {
+		w |= mtl.ColorWriteMaskBlue
+	}
+	if m&ColorWriteAlpha != 0 {
+		w |= mtl.ColorWriteMaskAlpha
+	}
+	return w
+}
+
+func mtlBlend(bs *BlendState) mtl.ColorAttachmentBlend {
+	if bs == nil {
+		return mtl.ColorAttachmentBlend{}
+	}
+	return mtl.ColorAttachmentBlend{
+		Enabled:                true,
+		SourceRGBFactor:        mtlBlendFactors[bs.Color.SrcFactor],
+		DestinationRGBFactor:   mtlBlendFactors[bs.Color.DstFactor],
+		RGBOperation:           mtlBlendOps[bs.Color.Operation],
+		SourceAlphaFactor:      mtlBlendFactors[bs.Alpha.SrcFactor],
+		DestinationAlphaFactor: mtlBlendFactors[bs.Alpha.DstFactor],
+		AlphaOperation:         mtlBlendOps[bs.Alpha.Operation],
+	}
+}
 
 func (c *metalCmd) beginRender(info renderPassInfo) {
 	load := mtl.LoadActionLoad
 	if info.load == LoadClear {
 		load = mtl.LoadActionClear
 	}
-	desc := mtl.RenderPassDescriptor{
-		ColorAttachment0: mtl.ColorAttachment{
-			Texture:     info.color.(*metalTexture).tex,
+	// A resolving attachment also stores its samples, which a later pass
+	// or kernel may read.
+	attachment := func(tex, resolve backendTexture, cc [4]float64) mtl.ColorAttachment {
+		a := mtl.ColorAttachment{
+			Texture:     tex.(*metalTexture).tex,
 			LoadAction:  load,
 			StoreAction: mtl.StoreActionStore,
-			ClearColor:  mtl.ClearColor{Red: info.clearColor[0], Green: info.clearColor[1], Blue: info.clearColor[2], Alpha: info.clearColor[3]},
-		},
+			ClearColor:  mtl.ClearColor{Red: cc[0], Green: cc[1], Blue: cc[2], Alpha: cc[3]},
+		}
+		if resolve != nil {
+			a.StoreAction = mtl.StoreActionStoreAndMultisampleResolve
+			a.ResolveTexture = resolve.(*metalTexture).tex
+		}
+		return a
 	}
+	desc := mtl.RenderPassDescriptor{ColorAttachment0: attachment(info.color, info.resolve, info.clearColor)}
 	for _, t := range info.extraColor {
-		desc.ExtraColorAttachments = append(desc.ExtraColorAttachments, mtl.ColorAttachment{
-			Texture:     t.tex.(*metalTexture).tex,
-			LoadAction:  load,
-			StoreAction: mtl.StoreActionStore,
-			ClearColor:  mtl.ClearColor{Red: t.clear[0], Green: t.clear[1], Blue: t.clear[2], Alpha: t.clear[3]},
-		})
+		desc.ExtraColorAttachments = append(desc.ExtraColorAttachments, attachment(t.tex, t.resolve, t.clear))
 	}
 	if info.depth != nil {
 		desc.Depth = mtl.DepthAttachment{
@@ -344,29 +712,102 @@ func (c *metalCmd) beginRender(info renderPassInfo) {
 			LoadAction:  mtl.LoadActionClear,
 			StoreAction: mtl.StoreActionDontCare,
 			ClearDepth:  info.clearDepth,
+			Stencil:     info.depth.(*metalTexture).stencil,
 		}
 	}
+	if info.timestamps != nil {
+		desc.SampleBuffer = info.timestamps.sampleBuffer()
+	}
+	if info.occlusion != nil {
+		desc.VisibilityResultBuffer = info.occlusion.(*metalOcclusionSet).buf
+	}
 	c.renc = c.cb.MakeRenderCommandEncoder(desc)
 }
 
-func (c *metalCmd) setRenderPipeline(p backendRenderPipeline) {
+func (c *metalCmd) setRenderPipeline(p backendRenderPipeline, _ *BindGroupLayout) {
 	mp := p.(*metalRenderPipeline)
 	c.renc.SetRenderPipelineState(mp.rps)
 	if mp.hasDepth {
 		c.renc.SetDepthStencilState(mp.depthState)
 	}
+	c.renc.SetCullMode(mp.cull)
+	c.renc.SetFrontFacingWinding(mp.winding)
 }
 
-func (c *metalCmd) setRenderBuffer(b backendBuffer, offset, index int) {
+func (c *metalCmd) setRenderBuffer(b backendBuffer, offset, size, index int, _ BindingKind) {
 	c.renc.SetFragmentBuffer(b.(*metalBuffer).buf, offset, index)
 }
 
-func (c *metalCmd) setVertexBuffer(b backendBuffer, index int) {
-	c.renc.SetVertexBuffer(b.(*metalBuffer).buf, 0, index)
+func (c *metalCmd) setVertexBuffer(b backendBuffer, offset, size, index int) {
+	c.renc.SetVertexBuffer(b.(*metalBuffer).buf, offset, index)
+}
+
+func (c *metalCmd) draw(prim Primitive, start, count, firstInstance, instanceCount int) {
+	if firstInstance == 0 && instanceCount == 1 {
+		c.renc.DrawPrimitives(mtlPrim(prim), start, count)
+		return
+	}
+	c.renc.DrawPrimitivesInstanced(mtlPrim(prim), start, count, instanceCount, firstInstance)
+}
+
+func (c *metalCmd) setIndexBuffer(b backendBuffer, offset int, format IndexFormat) {
+	c.ibuf, c.ibOff = b.(*metalBuffer), offset
+	c.ifmt, c.ibStride = mtl.IndexTypeUInt16, 2
+	if format == IndexUint32 {
+		c.ifmt, c.ibStride = mtl.IndexTypeUInt32, 4
+	}
+}
+
+func (c *metalCmd) drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int) {
+	c.renc.DrawIndexedPrimitives(mtlPrim(prim), count, c.ifmt, c.ibuf.buf, c.ibOff+firstIndex*c.ibStride, instanceCount, baseVertex, firstInstance)
+}
+
+func (c *metalCmd) drawIndirect(prim Primitive, b backendBuffer, offset int) {
+	c.renc.DrawPrimitivesIndirect(mtlPrim(prim), b.(*metalBuffer).buf, offset)
 }
 
-func (c *metalCmd) draw(prim Primitive, start, count int) {
-	c.renc.DrawPrimitives(mtlPrim(prim), start, count)
+func (c *metalCmd) drawIndexedIndirect(prim Primitive, b backendBuffer, offset int) {
+	c.renc.DrawIndexedPrimitivesIndirect(mtlPrim(prim), c.ifmt, c.ibuf.buf, c.ibOff, b.(*metalBuffer).buf, offset)
+}
+
+func (c *metalCmd) beginOcclusionQuery(index int) {
+	c.renc.SetVisibilityResultMode(mtl.VisibilityResultModeCounting, index*8)
+}
+
+func (c *metalCmd) endOcclusionQuery() {
+	c.renc.SetVisibilityResultMode(mtl.VisibilityResultModeDisabled, 0)
 }
 
 func (c *metalCmd) endRender() { c.renc.EndEncoding() }
+
+// --- copies ---
+
+// Each copy gets its own blit encoder; Metal orders encoders within a command
+// buffer, so a copy sees the passes encoded before it.
+
+func (c *metalCmd) copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int) {
+	bce := c.cb.MakeBlitCommandEncoder()
+	bce.CopyFromBuffer(src.(*metalBuffer).buf, srcOffset, dst.(*metalBuffer).buf, dstOffset, size)
+	bce.EndEncoding()
+}
+
+func (c *metalCmd) copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int) {
+	bce := c.cb.MakeBlitCommandEncoder()
+	bce.CopyFromBufferToTexture(src.(*metalBuffer).buf, offset, bytesPerRow, bytesPerRow*h, mtl.Size{Width: w, Height: h, Depth: 1},
+		dst.(*metalTexture).tex, 0, 0, mtl.Origin{X: x, Y: y})
+	bce.EndEncoding()
+}
+
+func (c *metalCmd) copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int) {
+	bce := c.cb.MakeBlitCommandEncoder()
+	bce.CopyFromTextureToBuffer(src.(*metalTexture).tex, 0, 0, mtl.Origin{X: x, Y: y}, mtl.Size{Width: w, Height: h, Depth: 1},
+		dst.(*metalBuffer).buf, offset, bytesPerRow, bytesPerRow*h)
+	bce.EndEncoding()
+}
+
+func (c *metalCmd) copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int) {
+	bce := c.cb.MakeBlitCommandEncoder()
+	bce.CopyFromTexture(src.(*metalTexture).tex, 0, 0, mtl.Origin{X: sx, Y: sy}, mtl.Size{Width: w, Height: h, Depth: 1},
+		dst.(*metalTexture).tex, 0, 0, mtl.Origin{X: dx, Y: dy})
+	bce.EndEncoding()
+}
@@ -13,8 +13,16 @@
 package gpu
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"go/token"
+	"math"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/ebitengine/purego"
@@ -36,16 +44,32 @@ const (
 	eglGreenSize      = 0x3023
 	eglBlueSize       = 0x3022
 
-	glComputeShader                  = 0x91B9
-	glShaderStorageBuffer            = 0x90D2
-	glUniformBuffer                  = 0x8A11
-	glDynamicRead                    = 0x88E9
-	glCompileStatus                  = 0x8B81
-	glLinkStatus                     = 0x8B82
-	glInfoLogLength                  = 0x8B84
-	glMapReadBit                     = 0x0001
-	glAllBarrierBits                 = 0xFFFFFFFF
-	glMaxComputeWorkGroupInvocations = 0x90EB
+	glComputeShader                      = 0x91B9
+	glShaderStorageBuffer                = 0x90D2
+	glUniformBuffer                      = 0x8A11
+	glDynamicRead                        = 0x88E9
+	glCompileStatus                      = 0x8B81
+	glLinkStatus                         = 0x8B82
+	glInfoLogLength                      = 0x8B84
+	glMapReadBit                         = 0x0001
+	glMapWriteBit                        = 0x0002
+	glMapInvalidateRangeBit              = 0x0004
+	glAllBarrierBits                     = 0xFFFFFFFF
+	glMaxComputeWorkGroupInvocations     = 0x90EB
+	glMaxComputeWorkGroupSize            = 0x91BF
+	glMaxShaderStorageBlockSize          = 0x90DE
+	glMaxTextureSize                     = 0x0D33
+	glMaxColorAttachments                = 0x8CDF
+	glUniformBufferOffsetAlignment       = 0x8A34
+	glShaderStorageBufferOffsetAlignment = 0x90DF
+	glVendor                             = 0x1F00
+	glInvalidEnum                        = 0x0500
+	glInvalidValue                       = 0x0501
+	glInvalidOperation                   = 0x0502
+	glOutOfMemory                        = 0x0505
+	glInvalidFramebufferOperation        = 0x0506
+	glContextLost                        = 0x0507
+	glRenderer                           = 0x1F01
 
 	glFramebuffer       = 0x8D40
 	glColorAttachment0  = 0x8CE0
@@ -56,12 +80,54 @@ const (
 	glRGBA32F           = 0x8814
 	glFloat             = 0x1406
 	glTexture2D         = 0x0DE1
+	glTexture2DMS       = 0x9100 // GL_TEXTURE_2D_MULTISAMPLE
+	glSamples           = 0x80A9
+	glTexture2DArray    = 0x8C1A
+	glTexture3D         = 0x806F
+	glTextureCubeMap    = 0x8513
+	glCubeMapPositiveX  = 0x8515
+	glTexture0          = 0x84C0
 	glRGBA              = 0x1908
 	glRGBA8             = 0x8058
 	glUnsignedByte      = 0x1401
 	glNearest           = 0x2600
 	glTexMinFilter      = 0x2801
 	glTexMagFilter      = 0x2800
+	glTexWrapS          = 0x2802
+	glTexWrapT          = 0x2803
+	glTexWrapR          = 0x8072
+	glLinear            = 0x2601
+	glNearestMipNearest = 0x2700
+	glLinearMipNearest  = 0x2701
+	glNearestMipLinear  = 0x2702
+	glLinearMipLinear   = 0x2703
+	glClampToEdge       = 0x812F
+	glRepeat            = 0x2901
+
+	glRed             = 0x1903
+	glRG              = 0x8227
+	glR8              = 0x8229
+	glRG16F           = 0x822F
+	glRGBA16F         = 0x881A
+	glR32F            = 0x822E
+	glSRGB8Alpha8     = 0x8C43
+	glDepth24Stencil8 = 0x88F0
+	glDepthStencil    = 0x84F9
+	glUnsignedInt248  = 0x84FA
+	glHalfFloat       = 0x140B
+	glUnpackAlignment = 0x0CF5
+
+	glStencilAttachment      = 0x8D20
+	glDepthStencilAttachment = 0x821A
+
+	glTextureMinLod           = 0x813A
+	glTextureMaxLod           = 0x813B
+	glTextureCompareMode      = 0x884C
+	glTextureCompareFunc      = 0x884D
+	glCompareRefToTexture     = 0x884E
+	glTextureMaxAnisotropy    = 0x84FE // EXT_texture_filter_anisotropic
+	glMaxTextureMaxAnisotropy = 0x84FF
+
 	glPoints            = 0x0000
 	glLines             = 0x0001
 	glTriangles         = 0x0004
@@ -71,12 +137,48 @@ const (
 	glDepthTest         = 0x0B71
 	glLess              = 0x0201
 	glTrue              = 1
+	glBlend             = 0x0BE2
+	glCullFaceEnum      = 0x0B44
+	glFront             = 0x0404
+	glBack              = 0x0405
+	glCW                = 0x0900
+	glCCW               = 0x0901
+
+	glElementArrayBuffer     = 0x8893
+	glDrawIndirectBuffer     = 0x8F3F
+	glDispatchIndirectBuffer = 0x90EE
+	glUnsignedShort          = 0x1403
+	glUnsignedInt            = 0x1405
 
 	glReadFramebuffer = 0x8CA8
 	glDrawFramebuffer = 0x8CA9
 	glColorBufferBit  = 0x00004000
 
+	glCopyReadBuffer    = 0x8F36
+	glCopyWriteBuffer   = 0x8F37
+	glPixelPackBuffer   = 0x88EB
+	glPixelUnpackBuffer = 0x88EC
+	glPackRowLength     = 0x0D02
+	glUnpackRowLength   = 0x0CF2
+
+	glSyncGPUCommandsComplete = 0x9117
+	glTimeoutExpired          = 0x911B
+
+	glNumExtensions       = 0x821D
+	glExtensions          = 0x1F03
+	glTimestampEXT        = 0x8E28
+	glTimeElapsedEXT      = 0x88BF
+	glQueryCounterBitsEXT = 0x8864
+	glQueryResult         = 0x8866
+	glGPUDisjointEXT      = 0x8FBB
+	glAnySamplesPassed    = 0x8C2F
+
 	eglNativeVisualID = 0x302E
+
+	eglContextOpenGLDebug    = 0x31B0
+	glDebugOutput            = 0x92E0
+	glDebugOutputSynchronous = 0x8242
+	glDebugTypeError         = 0x824C
 )
 
 // glFns holds the resolved EGL/GLES entry points (purego function pointers).
@@ -84,35 +186,86 @@ type glFns struct {
 	eglGetDisplay, eglInitialize, eglBindAPI, eglChooseConfig    uintptr
 	eglCreateContext, eglMakeCurrent, eglDestroyContext, eglTerm uintptr
 	eglCreateWindowSurface, eglDestroySurface, eglSwapBuffers    uintptr
-	eglGetConfigAttrib, eglGetError                              uintptr
+	eglGetConfigAttrib, eglGetError, eglGetProcAddress           uintptr
 
 	createShader, shaderSource, compileShader, getShaderiv, getShaderInfoLog uintptr
 	createProgram, attachShader, linkProgram, getProgramiv, useProgram       uintptr
-	deleteShader, deleteProgram                                              uintptr
+	deleteShader, deleteProgram, getUniformLocation, uniform1i               uintptr
 	genBuffers, deleteBuffers, bindBuffer, bufferData, bindBufferBase        uintptr
+	bindBufferRange                                                          uintptr
 	dispatchCompute, memoryBarrier, mapBufferRange, unmapBuffer              uintptr
-	finish, getIntegerv                                                      uintptr
-
-	genTextures, bindTexture, texImage2D, texParameteri                      uintptr
+	dispatchComputeIndirect, drawArraysIndirect, drawElementsIndirect        uintptr
+	finish, flush, getIntegerv                                               uintptr
+	fenceSync, clientWaitSync, deleteSync                                    uintptr
+
+	genTextures, deleteTextures, bindTexture, texImage2D, texParameteri      uintptr
+	texStorage2D, texStorage3D, texSubImage3D, activeTexture                 uintptr
+	genSamplers, bindSampler, samplerParameteri, samplerParameterfv          uintptr
+	generateMipmap, getFloatv                                                uintptr
+	deleteFramebuffers, framebufferTextureLayer                              uintptr
 	genFramebuffers, bindFramebuffer, framebufferTexture2D, checkFramebuffer uintptr
 	genVertexArrays, bindVertexArray                                         uintptr
 	viewport, clearBufferfv, drawArrays, readPixels                          uintptr
-	blitFramebuffer, getError                                                uintptr
+	drawElements, drawElementsBaseVertex                                     uintptr
+	drawArraysInstanced, drawElementsInstanced                               uintptr
+	drawElementsInstancedBaseVertex                                          uintptr
+	blitFramebuffer, getError, readBuffer                                    uintptr
+	texStorage2DMultisample, getInternalformativ                             uintptr
+	copyBufferSubData, texSubImage2D, pixelStorei                            uintptr
+	getStringi, genQueries, deleteQueries, beginQuery, endQuery              uintptr
+	getString, getIntegeri, getInteger64v                                    uintptr
+	getQueryObjectuiv, colorMask                                             uintptr
 	enable, disable, depthFunc, depthMask, drawBuffers                       uintptr
+	blendFuncSeparate, blendEquationSeparate, cullFace, frontFace            uintptr
+	// Per-draw-buffer blending (GLES 3.2, OES/EXT_draw_buffers_indexed on 3.1);
+	// zero when absent.
+	enablei, disablei, blendFuncSeparatei, blendEquationSeparatei uintptr
+	// glCopyImageSubData (GLES 3.2, OES/EXT_copy_image on 3.1); zero when absent.
+	copyImageSubData uintptr
+	// EXT_disjoint_timer_query; zero when absent.
+	queryCounter, getQueryObjectui64v uintptr
 }
 
 type glBackend struct {
+	errorHandler
 	reqs       chan func()
 	fns        glFns
-	nativeDisp uintptr // X11 Display* for the EGL X11 platform (0 = default display)
+	fences     []glFence // OnSubmittedWorkDone callbacks in submission order; GL thread only
+	nativeDisp uintptr   // X11 Display* for the EGL X11 platform (0 = default display)
 	dpy        uintptr
 	ctx        uintptr
 	cfg        uintptr
 	visualID   uint32 // EGL_NATIVE_VISUAL_ID of cfg; the X11 window must use it
+
+	// timestampBits is the width of the GPU timestamp counter: 0 without
+	// EXT_disjoint_timer_query or when the driver only times GL_TIME_ELAPSED
+	// intervals (see glQuerySet).
+	timestampBits int32
+	timerQuery    bool // EXT_disjoint_timer_query is available
+	// maxAnisotropy is the largest sampler anisotropy, 0 without
+	// EXT_texture_filter_anisotropic.
+	maxAnisotropy float32
+	caps          capabilities
+
+	// debug requests KHR_debug output (WithValidation); debugMsgs are the
+	// error messages it delivered since the last glError. GL thread only.
+	debug     bool
+	debugMsgs []string
 }
 
 func (b *glBackend) windowVisualID() uint32 { return b.visualID }
 
+// glFence is a GL sync object and the callback to run once it signals.
+type glFence struct {
+	sync uintptr
+	fn   func()
+}
+
+// glFencePoll is how often loop polls outstanding fences while it is otherwise
+// idle. GL has no completion callback, and blocking in glClientWaitSync would
+// stall every other call marshaled onto the context thread.
+const glFencePoll = 200 * time.Microsecond
+
 func openBackend(c config) (backend, Driver, error) {
 	if c.driver == DriverVulkan {
 		return openVKBackend(c)
@@ -120,7 +273,7 @@ func openBackend(c config) (backend, Driver, error) {
 	if c.driver != DriverAuto && c.driver != DriverGL {
 		return nil, DriverAuto, ErrUnsupported
 	}
-	b := &glBackend{reqs: make(chan func()), nativeDisp: c.nativeDisplay}
+	b := &glBackend{reqs: make(chan func()), nativeDisp: c.nativeDisplay, debug: c.validation}
 	ready := make(chan error, 1)
 	go b.loop(ready)
 	if err := <-ready; err != nil {
@@ -135,16 +288,66 @@ func openBackend(c config) (backend, Driver, error) {
 // goroutine.
 func (b *glBackend) loop(ready chan error) {
 	runtime.LockOSThread()
+	// Return the thread to the pool instead of letting it exit locked: Mesa
+	// leaves thread state behind, after a failed init as after close, whose
+	// teardown at thread exit crashes the process.
+	defer runtime.UnlockOSThread()
 	if err := b.init(); err != nil {
 		ready <- err
 		return
 	}
 	ready <- nil
-	for fn := range b.reqs {
-		fn()
+	poll := time.NewTicker(glFencePoll)
+	defer poll.Stop()
+	for {
+		var tick <-chan time.Time
+		if len(b.fences) > 0 {
+			tick = poll.C
+		}
+		select {
+		case fn, ok := <-b.reqs:
+			if !ok {
+				return
+			}
+			fn()
+		case <-tick:
+		}
+		b.pollFences()
+	}
+}
+
+// pollFences runs, each on its own goroutine, the callbacks whose fences have
+// signaled. Fences signal in submission order, so it stops at the first one
+// still pending.
+func (b *glBackend) pollFences() {
+	f := &b.fns
+	for len(b.fences) > 0 {
+		fc := b.fences[0]
+		if r, _, _ := purego.SyscallN(f.clientWaitSync, fc.sync, 0, 0); r == glTimeoutExpired {
+			return
+		}
+		purego.SyscallN(f.deleteSync, fc.sync)
+		b.fences = b.fences[1:]
+		go fc.fn()
 	}
 }
 
+// onSubmittedWorkDone inserts a fence after everything committed so far and
+// flushes it, so the GPU reaches it without a later call forcing the flush.
+func (b *glBackend) onSubmittedWorkDone(fn func()) {
+	b.do(func() {
+		f := &b.fns
+		s, _, _ := purego.SyscallN(f.fenceSync, glSyncGPUCommandsComplete, 0)
+		if s == 0 {
+			purego.SyscallN(f.finish)
+			go fn()
+			return
+		}
+		purego.SyscallN(f.flush)
+		b.fences = append(b.fences, glFence{sync: s, fn: fn})
+	})
+}
+
 func (b *glBackend) do(fn func()) {
 	done := make(chan struct{})
 	b.reqs <- func() { defer close(done); fn() }
@@ -182,6 +385,7 @@ func (b *glBackend) init() error {
 	f.eglSwapBuffers = sym(egl, "eglSwapBuffers")
 	f.eglGetConfigAttrib = sym(egl, "eglGetConfigAttrib")
 	f.eglGetError = sym(egl, "eglGetError")
+	f.eglGetProcAddress = sym(egl, "eglGetProcAddress")
 	f.createShader = sym(gles, "glCreateShader")
 	f.shaderSource = sym(gles, "glShaderSource")
 	f.compileShader = sym(gles, "glCompileShader")
@@ -192,6 +396,8 @@ func (b *glBackend) init() error {
 	f.linkProgram = sym(gles, "glLinkProgram")
 	f.getProgramiv = sym(gles, "glGetProgramiv")
 	f.useProgram = sym(gles, "glUseProgram")
+	f.getUniformLocation = sym(gles, "glGetUniformLocation")
+	f.uniform1i = sym(gles, "glUniform1i")
 	f.deleteShader = sym(gles, "glDeleteShader")
 	f.deleteProgram = sym(gles, "glDeleteProgram")
 	f.genBuffers = sym(gles, "glGenBuffers")
@@ -199,16 +405,37 @@ func (b *glBackend) init() error {
 	f.bindBuffer = sym(gles, "glBindBuffer")
 	f.bufferData = sym(gles, "glBufferData")
 	f.bindBufferBase = sym(gles, "glBindBufferBase")
+	f.bindBufferRange = sym(gles, "glBindBufferRange")
 	f.dispatchCompute = sym(gles, "glDispatchCompute")
+	f.dispatchComputeIndirect = sym(gles, "glDispatchComputeIndirect")
+	f.drawArraysIndirect = sym(gles, "glDrawArraysIndirect")
+	f.drawElementsIndirect = sym(gles, "glDrawElementsIndirect")
 	f.memoryBarrier = sym(gles, "glMemoryBarrier")
 	f.mapBufferRange = sym(gles, "glMapBufferRange")
 	f.unmapBuffer = sym(gles, "glUnmapBuffer")
 	f.finish = sym(gles, "glFinish")
+	f.flush = sym(gles, "glFlush")
+	f.fenceSync = sym(gles, "glFenceSync")
+	f.clientWaitSync = sym(gles, "glClientWaitSync")
+	f.deleteSync = sym(gles, "glDeleteSync")
 	f.getIntegerv = sym(gles, "glGetIntegerv")
 	f.genTextures = sym(gles, "glGenTextures")
+	f.deleteTextures = sym(gles, "glDeleteTextures")
 	f.bindTexture = sym(gles, "glBindTexture")
 	f.texImage2D = sym(gles, "glTexImage2D")
 	f.texParameteri = sym(gles, "glTexParameteri")
+	f.texStorage2D = sym(gles, "glTexStorage2D")
+	f.texStorage3D = sym(gles, "glTexStorage3D")
+	f.texSubImage3D = sym(gles, "glTexSubImage3D")
+	f.activeTexture = sym(gles, "glActiveTexture")
+	f.genSamplers = sym(gles, "glGenSamplers")
+	f.bindSampler = sym(gles, "glBindSampler")
+	f.samplerParameteri = sym(gles, "glSamplerParameteri")
+	f.samplerParameterfv = sym(gles, "glSamplerParameterfv")
+	f.generateMipmap = sym(gles, "glGenerateMipmap")
+	f.getFloatv = sym(gles, "glGetFloatv")
+	f.deleteFramebuffers = sym(gles, "glDeleteFramebuffers")
+	f.framebufferTextureLayer = sym(gles, "glFramebufferTextureLayer")
 	f.genFramebuffers = sym(gles, "glGenFramebuffers")
 	f.bindFramebuffer = sym(gles, "glBindFramebuffer")
 	f.framebufferTexture2D = sym(gles, "glFramebufferTexture2D")
@@ -220,15 +447,68 @@ func (b *glBackend) init() error {
 	f.drawArrays = sym(gles, "glDrawArrays")
 	f.readPixels = sym(gles, "glReadPixels")
 	f.blitFramebuffer = sym(gles, "glBlitFramebuffer")
+	f.readBuffer = sym(gles, "glReadBuffer")
+	f.texStorage2DMultisample = sym(gles, "glTexStorage2DMultisample")
+	f.getInternalformativ = sym(gles, "glGetInternalformativ")
 	f.getError = sym(gles, "glGetError")
 	f.enable = sym(gles, "glEnable")
 	f.disable = sym(gles, "glDisable")
 	f.depthFunc = sym(gles, "glDepthFunc")
 	f.depthMask = sym(gles, "glDepthMask")
 	f.drawBuffers = sym(gles, "glDrawBuffers")
+	f.drawElements = sym(gles, "glDrawElements")
+	f.blendFuncSeparate = sym(gles, "glBlendFuncSeparate")
+	f.blendEquationSeparate = sym(gles, "glBlendEquationSeparate")
+	f.cullFace = sym(gles, "glCullFace")
+	f.frontFace = sym(gles, "glFrontFace")
+	f.drawArraysInstanced = sym(gles, "glDrawArraysInstanced")
+	f.drawElementsInstanced = sym(gles, "glDrawElementsInstanced")
+	f.copyBufferSubData = sym(gles, "glCopyBufferSubData")
+	f.texSubImage2D = sym(gles, "glTexSubImage2D")
+	f.pixelStorei = sym(gles, "glPixelStorei")
+	f.getStringi = sym(gles, "glGetStringi")
+	f.getString = sym(gles, "glGetString")
+	f.getIntegeri = sym(gles, "glGetIntegeri_v")
+	f.getInteger64v = sym(gles, "glGetInteger64v")
+	f.genQueries = sym(gles, "glGenQueries")
+	f.deleteQueries = sym(gles, "glDeleteQueries")
+	f.beginQuery = sym(gles, "glBeginQuery")
+	f.endQuery = sym(gles, "glEndQuery")
+	f.getQueryObjectuiv = sym(gles, "glGetQueryObjectuiv")
+	f.colorMask = sym(gles, "glColorMask")
 	if loadErr != nil {
 		return loadErr
 	}
+	// glDrawElementsBaseVertex is core in GLES 3.2 (OES/EXT on 3.1); it is only
+	// needed for a non-zero DrawIndexed baseVertex, so a driver without it still
+	// opens and reports a validation error for that draw's submission instead.
+	for _, name := range []string{"glDrawElementsBaseVertex", "glDrawElementsBaseVertexOES", "glDrawElementsBaseVertexEXT"} {
+		if p, err := glDlsym(gles, name); err == nil && p != 0 {
+			f.drawElementsBaseVertex = p
+			break
+		}
+	}
+	for _, fn := range []struct {
+		p    *uintptr
+		name string
+	}{
+		{&f.enablei, "glEnablei"}, {&f.disablei, "glDisablei"},
+		{&f.blendFuncSeparatei, "glBlendFuncSeparatei"}, {&f.blendEquationSeparatei, "glBlendEquationSeparatei"},
+		{&f.copyImageSubData, "glCopyImageSubData"},
+	} {
+		for _, suffix := range []string{"", "OES", "EXT"} {
+			if p, err := glDlsym(gles, fn.name+suffix); err == nil && p != 0 {
+				*fn.p = p
+				break
+			}
+		}
+	}
+	for _, name := range []string{"glDrawElementsInstancedBaseVertex", "glDrawElementsInstancedBaseVertexOES", "glDrawElementsInstancedBaseVertexEXT"} {
+		if p, err := glDlsym(gles, name); err == nil && p != 0 {
+			f.drawElementsInstancedBaseVertex = p
+			break
+		}
+	}
 
 	// With a native X11 Display* this binds EGL to the X11 platform so an X11
 	// window is a valid native window; with 0 it is EGL_DEFAULT_DISPLAY (the
@@ -262,7 +542,15 @@ func (b *glBackend) init() error {
 		}
 	}
 	ctxAttribs := []int32{eglContextMajor, 3, eglNone}
-	ctx, _, _ := purego.SyscallN(f.eglCreateContext, dpy, cfg, uintptr(eglNoContext), uintptr(unsafe.Pointer(&ctxAttribs[0])))
+	var ctx uintptr
+	if b.debug {
+		// A debug context, where the driver supports one, reports more.
+		debugAttribs := []int32{eglContextMajor, 3, eglContextOpenGLDebug, 1, eglNone}
+		ctx, _, _ = purego.SyscallN(f.eglCreateContext, dpy, cfg, uintptr(eglNoContext), uintptr(unsafe.Pointer(&debugAttribs[0])))
+	}
+	if ctx == 0 {
+		ctx, _, _ = purego.SyscallN(f.eglCreateContext, dpy, cfg, uintptr(eglNoContext), uintptr(unsafe.Pointer(&ctxAttribs[0])))
+	}
 	if ctx == 0 {
 		return fmt.Errorf("gpu/gl: eglCreateContext failed")
 	}
@@ -282,16 +570,156 @@ func (b *glBackend) init() error {
 	var vid int32
 	purego.SyscallN(f.eglGetConfigAttrib, dpy, cfg, uintptr(eglNativeVisualID), uintptr(unsafe.Pointer(&vid)))
 	b.visualID = uint32(vid)
+	b.initTimerQuery()
+	if b.hasExtension("GL_EXT_texture_filter_anisotropic") {
+		purego.SyscallN(f.getFloatv, uintptr(glMaxTextureMaxAnisotropy), uintptr(unsafe.Pointer(&b.maxAnisotropy)))
+	}
+	b.initCapabilities()
+	if b.debug {
+		b.initDebugOutput()
+	}
 	return nil
 }
 
+// glDebugBackends maps the user parameter of glDebugCallback to its backend.
+var (
+	glDebugMu       sync.Mutex
+	glDebugBackends = map[uintptr]*glBackend{}
+	glDebugNext     uintptr
+)
+
+// glDebugCallback is the GLDEBUGPROC of every backend: purego callbacks are
+// never freed, so there is one.
+var glDebugCallback = sync.OnceValue(func() uintptr {
+	return purego.NewCallback(func(source, typ, id, severity, length, message, user uintptr) uintptr {
+		if uint32(typ) != glDebugTypeError {
+			return 0
+		}
+		glDebugMu.Lock()
+		b := glDebugBackends[user]
+		glDebugMu.Unlock()
+		// Output is synchronous, so this runs on b's GL thread.
+		if b != nil && len(b.debugMsgs) < 16 {
+			b.debugMsgs = append(b.debugMsgs, cStr(message))
+		}
+		return 0
+	})
+})
+
+// initDebugOutput routes the context's KHR_debug error messages to
+// debugMsgs, if it has KHR_debug (core in GLES 3.2).
+func (b *glBackend) initDebugOutput() {
+	f := &b.fns
+	proc := func(name string) uintptr {
+		cs := append([]byte(name), 0)
+		p, _, _ := purego.SyscallN(f.eglGetProcAddress, uintptr(unsafe.Pointer(&cs[0])))
+		return p
+	}
+	if !b.hasExtension("GL_KHR_debug") {
+		return
+	}
+	callback := proc("glDebugMessageCallback")
+	if callback == 0 {
+		if callback = proc("glDebugMessageCallbackKHR"); callback == 0 {
+			return
+		}
+	}
+	glDebugMu.Lock()
+	glDebugNext++
+	user := glDebugNext
+	glDebugBackends[user] = b
+	glDebugMu.Unlock()
+	purego.SyscallN(f.enable, uintptr(glDebugOutput))
+	purego.SyscallN(f.enable, uintptr(glDebugOutputSynchronous))
+	purego.SyscallN(callback, glDebugCallback(), user)
+}
+
+// initCapabilities queries the context's adapter, limits and features.
+func (b *glBackend) initCapabilities() {
+	f := &b.fns
+	geti := func(pname uintptr) int {
+		var v int32
+		purego.SyscallN(f.getIntegerv, pname, uintptr(unsafe.Pointer(&v)))
+		return int(v)
+	}
+	c := &b.caps
+	vendor, _, _ := purego.SyscallN(f.getString, glVendor)
+	renderer, _, _ := purego.SyscallN(f.getString, glRenderer)
+	c.info = AdapterInfo{Driver: DriverGL, Vendor: cStr(vendor), Name: cStr(renderer)}
+	c.info.Software = strings.Contains(c.info.Name, "llvmpipe") || strings.Contains(c.info.Name, "softpipe")
+
+	var blockSize int64
+	purego.SyscallN(f.getInteger64v, glMaxShaderStorageBlockSize, uintptr(unsafe.Pointer(&blockSize)))
+	c.limits.MaxBufferSize = int(blockSize)
+	for i := range c.limits.MaxComputeWorkgroupSize {
+		var v int32
+		purego.SyscallN(f.getIntegeri, glMaxComputeWorkGroupSize, uintptr(i), uintptr(unsafe.Pointer(&v)))
+		c.limits.MaxComputeWorkgroupSize[i] = int(v)
+	}
+	c.limits.MaxComputeInvocations = geti(glMaxComputeWorkGroupInvocations)
+	c.limits.MaxTextureDimension2D = geti(glMaxTextureSize)
+	c.limits.MaxColorAttachments = geti(glMaxColorAttachments)
+	c.limits.MaxSamplerAnisotropy = max(int(b.maxAnisotropy), 1)
+	c.limits.MinUniformBufferOffsetAlignment = geti(glUniformBufferOffsetAlignment)
+	c.limits.MinStorageBufferOffsetAlignment = geti(glShaderStorageBufferOffsetAlignment)
+
+	if b.timerQuery {
+		c.features |= FeatureTimestampQuery
+	}
+	if b.hasExtension("GL_EXT_color_buffer_float") {
+		c.features |= FeatureFloat32Renderable
+	}
+	if b.maxAnisotropy > 1 {
+		c.features |= FeatureAnisotropicFiltering
+	}
+}
+
+func (b *glBackend) capabilities() capabilities { return b.caps }
+
+// initTimerQuery loads EXT_disjoint_timer_query, which GLES needs for any GPU
+// timing. Extension entry points are not exported by the GLES library, so
+// they come from eglGetProcAddress.
+func (b *glBackend) initTimerQuery() {
+	f := &b.fns
+	if !b.hasExtension("GL_EXT_disjoint_timer_query") {
+		return
+	}
+	proc := func(name string) uintptr {
+		cs := append([]byte(name), 0)
+		p, _, _ := purego.SyscallN(f.eglGetProcAddress, uintptr(unsafe.Pointer(&cs[0])))
+		return p
+	}
+	f.queryCounter = proc("glQueryCounterEXT")
+	f.getQueryObjectui64v = proc("glGetQueryObjectui64vEXT")
+	getQueryiv := proc("glGetQueryivEXT")
+	if f.queryCounter == 0 || f.getQueryObjectui64v == 0 || getQueryiv == 0 {
+		return
+	}
+	b.timerQuery = true
+	purego.SyscallN(getQueryiv, uintptr(glTimestampEXT), uintptr(glQueryCounterBitsEXT), uintptr(unsafe.Pointer(&b.timestampBits)))
+}
+
+// hasExtension reports whether the context exposes the named GL extension.
+func (b *glBackend) hasExtension(name string) bool {
+	f := &b.fns
+	var n int32
+	purego.SyscallN(f.getIntegerv, uintptr(glNumExtensions), uintptr(unsafe.Pointer(&n)))
+	for i := range n {
+		p, _, _ := purego.SyscallN(f.getStringi, uintptr(glExtensions), uintptr(i))
+		if cStr(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
 // --- backend interface ---
 
 type glBuffer struct {
 	b      *glBackend
 	id     uint32
 	size   int
-	target uintptr // GL_SHADER_STORAGE_BUFFER or GL_UNIFORM_BUFFER
+	target uintptr // GL_SHADER_STORAGE_BUFFER, GL_UNIFORM_BUFFER or GL_ELEMENT_ARRAY_BUFFER
 }
 
 func (b *glBackend) newBuffer(size int, usage BufferUsage, data []byte) (backendBuffer, error) {
@@ -299,8 +727,11 @@ func (b *glBackend) newBuffer(size int, usage BufferUsage, data []byte) (backend
 	// namespaces, so the buffer carries its target and the command buffer binds
 	// each one accordingly (see commit).
 	target := uintptr(glShaderStorageBuffer)
-	if usage&BufferUniform != 0 {
+	switch {
+	case usage&BufferUniform != 0:
 		target = uintptr(glUniformBuffer)
+	case usage&BufferIndex != 0 && usage&BufferStorage == 0:
+		target = uintptr(glElementArrayBuffer)
 	}
 	buf := &glBuffer{b: b, size: size, target: target}
 	b.do(func() {
@@ -331,31 +762,68 @@ func (b *glBuffer) bytes() []byte {
 	return out
 }
 
+func (b *glBuffer) read(offset int, p []byte) {
+	b.b.do(func() {
+		f := &b.b.fns
+		purego.SyscallN(f.bindBuffer, glCopyReadBuffer, uintptr(b.id))
+		m, _, _ := purego.SyscallN(f.mapBufferRange, glCopyReadBuffer, uintptr(offset), uintptr(len(p)), uintptr(glMapReadBit))
+		if m != 0 {
+			copy(p, unsafe.Slice((*byte)(unsafe.Pointer(m)), len(p)))
+			purego.SyscallN(f.unmapBuffer, glCopyReadBuffer)
+		}
+	})
+}
+
+func (b *glBuffer) write(offset int, p []byte) {
+	b.b.do(func() {
+		f := &b.b.fns
+		purego.SyscallN(f.bindBuffer, glCopyWriteBuffer, uintptr(b.id))
+		m, _, _ := purego.SyscallN(f.mapBufferRange, glCopyWriteBuffer, uintptr(offset), uintptr(len(p)), uintptr(glMapWriteBit|glMapInvalidateRangeBit))
+		if m != 0 {
+			copy(unsafe.Slice((*byte)(unsafe.Pointer(m)), len(p)), p)
+			purego.SyscallN(f.unmapBuffer, glCopyWriteBuffer)
+		}
+	})
+}
+
 func (b *glBuffer) release() {
 	b.b.do(func() {
 		purego.SyscallN(b.b.fns.deleteBuffers, 1, uintptr(unsafe.Pointer(&b.id)))
 	})
 }
 
-type glShaderModule struct{ glsl string }
+type glShaderModule struct {
+	glsl  string
+	lines []token.Position // Go positions of the GLSL lines, for compile logs
+}
 
-func (glShaderModule) isShaderModule() {}
+// release does nothing: a module is its source, compiled by the pipelines.
+func (glShaderModule) release() {}
 
 func (b *glBackend) newShaderModule(src ShaderSource) (backendShaderModule, error) {
 	if src.GLSL == "" {
 		return nil, fmt.Errorf("gpu/gl: ShaderSource.GLSL is empty (the GL backend needs GLSL; use shader.CompileGLSL)")
 	}
-	return glShaderModule{glsl: src.GLSL}, nil
+	return glShaderModule{glsl: src.GLSL, lines: src.Lines}, nil
 }
 
 type glComputePipeline struct {
+	b       *glBackend
 	program uint32
 	maxThr  int
+	wgx     int // the kernel's workgroup width (layout local_size_x), if declared
 }
 
 func (p glComputePipeline) maxThreads() int { return p.maxThr }
 
-func (b *glBackend) newComputePipeline(mod backendShaderModule, entry string) (backendComputePipeline, error) {
+func (p glComputePipeline) release() { p.b.deleteProgram(p.program) }
+
+// deleteProgram deletes a pipeline's program.
+func (b *glBackend) deleteProgram(prog uint32) {
+	b.do(func() { purego.SyscallN(b.fns.deleteProgram, uintptr(prog)) })
+}
+
+func (b *glBackend) newComputePipeline(mod backendShaderModule, entry string, workgroup [3]int) (backendComputePipeline, error) {
 	gm, ok := mod.(glShaderModule)
 	if !ok {
 		return nil, fmt.Errorf("gpu/gl: shader module is not a GL module")
@@ -375,7 +843,7 @@ func (b *glBackend) newComputePipeline(mod backendShaderModule, entry string) (b
 		var status int32
 		purego.SyscallN(f.getShaderiv, sh, glCompileStatus, uintptr(unsafe.Pointer(&status)))
 		if status == 0 {
-			compileErr = fmt.Errorf("gpu/gl: compute shader compile failed: %s", b.shaderLog(sh))
+			compileErr = fmt.Errorf("gpu/gl: compute shader compile failed: %s", goPositions(b.shaderLog(sh), gm.lines))
 			purego.SyscallN(f.deleteShader, sh)
 			return
 		}
@@ -395,7 +863,7 @@ func (b *glBackend) newComputePipeline(mod backendShaderModule, entry string) (b
 	if compileErr != nil {
 		return nil, compileErr
 	}
-	return glComputePipeline{program: prog, maxThr: int(maxThr)}, nil
+	return glComputePipeline{b: b, program: prog, maxThr: int(maxThr), wgx: workgroup[0]}, nil
 }
 
 // shaderLog reads a shader's info log; must run on the context thread.
@@ -416,12 +884,32 @@ func (b *glBackend) waitIdle() {
 }
 
 func (b *glBackend) close() error {
+	// Finish everything and run the outstanding OnSubmittedWorkDone callbacks
+	// here, while the context thread can still serve their GL calls.
+	var pending []glFence
+	b.do(func() {
+		purego.SyscallN(b.fns.finish)
+		pending, b.fences = b.fences, nil
+		for _, fc := range pending {
+			purego.SyscallN(b.fns.deleteSync, fc.sync)
+		}
+	})
+	for _, fc := range pending {
+		fc.fn()
+	}
 	b.do(func() {
 		f := &b.fns
 		purego.SyscallN(f.eglMakeCurrent, b.dpy, uintptr(eglNoSurface), uintptr(eglNoSurface), uintptr(eglNoContext))
 		purego.SyscallN(f.eglDestroyContext, b.dpy, b.ctx)
 		purego.SyscallN(f.eglTerm, b.dpy)
 	})
+	glDebugMu.Lock()
+	for user, db := range glDebugBackends {
+		if db == b {
+			delete(glDebugBackends, user)
+		}
+	}
+	glDebugMu.Unlock()
 	close(b.reqs)
 	return nil
 }
@@ -431,48 +919,271 @@ func (b *glBackend) close() error {
 // glCmd records GL operations as closures and replays them on the context thread
 // at commit. This serves both compute passes and render passes uniformly.
 type glCmd struct {
-	b    *glBackend
-	ops  []func()
-	prog uint32 // current compute pipeline program
-	gx   int    // current dispatch x
+	b       *glBackend
+	ops     []func()
+	prog    uint32           // current compute pipeline program
+	gx      int              // current dispatch x
+	wgx     int              // current compute pipeline's workgroup width
+	idxType uintptr          // GL_UNSIGNED_SHORT/INT of the bound index buffer
+	idxSize int              // bytes per index of the bound index buffer
+	idxOff  int              // byte offset of the bound index buffer's first index
+	ts      *passTimestamps  // timestamp writes of the open pass
+	occ     *glQuerySet      // occlusion query set of the open render pass
+	rpipe   glRenderPipeline // current render pipeline
+	// pass is the open render pass's color attachment 0, whose framebuffer
+	// holds its attachments, and resolve the resolve target of each color
+	// attachment, nil for none.
+	pass    *glTexture
+	resolve []*glTexture
+	// err is the first command the context cannot run, found as it was
+	// recorded. commit reports it instead of running the command buffer.
+	err error
 }
 
 func (b *glBackend) newCommandBuffer() backendCommandBuffer { return &glCmd{b: b} }
 
 func (c *glCmd) record(fn func()) { c.ops = append(c.ops, fn) }
 
+// fail records err, the first time, as the reason the command buffer cannot
+// run.
+func (c *glCmd) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *glCmd) finish() {}
+
 func (c *glCmd) commit() {
+	if c.err != nil {
+		c.b.report(c.err)
+		return
+	}
+	var err error
 	c.b.do(func() {
 		for _, op := range c.ops {
 			op()
 		}
-		purego.SyscallN(c.b.fns.finish)
+		purego.SyscallN(c.b.fns.flush)
+		err = c.b.glError()
 	})
+	c.b.report(err)
+}
+
+var glErrorNames = map[uintptr]string{
+	glInvalidEnum:                 "GL_INVALID_ENUM",
+	glInvalidValue:                "GL_INVALID_VALUE",
+	glInvalidOperation:            "GL_INVALID_OPERATION",
+	glInvalidFramebufferOperation: "GL_INVALID_FRAMEBUFFER_OPERATION",
+}
+
+// glError drains the context's error flags and returns the first as an
+// *Error, or as ErrDeviceLost for a lost context. GL raises no error at the
+// call that caused it, so this attributes to a commit the errors of every
+// call since the last one. It runs on the GL thread.
+func (b *glBackend) glError() error {
+	var first uintptr
+	for range 16 { // a lost context may not clear its flag
+		e, _, _ := purego.SyscallN(b.fns.getError)
+		if e == 0 {
+			break
+		}
+		if first == 0 {
+			first = e
+		}
+	}
+	// With KHR_debug output the driver has said what went wrong.
+	var detail string
+	if len(b.debugMsgs) > 0 {
+		detail = ": " + strings.Join(b.debugMsgs, "; ")
+		b.debugMsgs = b.debugMsgs[:0]
+	}
+	switch first {
+	case 0:
+		if detail != "" {
+			return &Error{Filter: ErrorFilterValidation, Err: errors.New("gpu/gl" + detail)}
+		}
+		return nil
+	case glContextLost:
+		return fmt.Errorf("gpu/gl: %w (GL_CONTEXT_LOST)", ErrDeviceLost)
+	case glOutOfMemory:
+		return &Error{Filter: ErrorFilterOutOfMemory, Err: errors.New("gpu/gl: GL_OUT_OF_MEMORY" + detail)}
+	}
+	name := glErrorNames[first]
+	if name == "" {
+		name = fmt.Sprintf("GL error %#x", first)
+	}
+	return &Error{Filter: ErrorFilterValidation, Err: fmt.Errorf("gpu/gl: %s%s", name, detail)}
 }
 
 // --- compute pass ---
 
-func (c *glCmd) beginCompute() {}
+func (c *glCmd) beginCompute(ts *passTimestamps) { c.beginTimestamp(ts) }
 
-func (c *glCmd) setComputePipeline(p backendComputePipeline) {
-	prog := p.(glComputePipeline).program
+func (c *glCmd) setComputePipeline(p backendComputePipeline, _ *BindGroupLayout) {
+	gp := p.(glComputePipeline)
+	prog := gp.program
+	c.wgx = gp.wgx
 	c.record(func() { purego.SyscallN(c.b.fns.useProgram, uintptr(prog)) })
 }
 
-func (c *glCmd) setBuffer(buf backendBuffer, offset, index int) {
-	gb := buf.(*glBuffer)
-	c.record(func() { purego.SyscallN(c.b.fns.bindBufferBase, gb.target, uintptr(index), uintptr(gb.id)) })
+func (c *glCmd) setBuffer(buf backendBuffer, offset, size, index int, _ BindingKind) {
+	c.bindRange(buf.(*glBuffer), offset, size, index)
+}
+
+// bindRange binds size bytes at offset of gb to the indexed binding of its
+// target, the whole buffer with glBindBufferBase.
+func (c *glCmd) bindRange(gb *glBuffer, offset, size, index int) {
+	if offset == 0 && size == gb.size {
+		c.record(func() { purego.SyscallN(c.b.fns.bindBufferBase, gb.target, uintptr(index), uintptr(gb.id)) })
+		return
+	}
+	c.record(func() {
+		purego.SyscallN(c.b.fns.bindBufferRange, gb.target, uintptr(index), uintptr(gb.id), uintptr(offset), uintptr(size))
+	})
 }
 
 func (c *glCmd) dispatch(x, y, z int) {
+	groups := workgroups(x, c.wgx)
+	c.record(func() {
+		f := &c.b.fns
+		purego.SyscallN(f.dispatchCompute, uintptr(groups), 1, 1)
+		purego.SyscallN(f.memoryBarrier, uintptr(uint32(glAllBarrierBits)))
+	})
+}
+
+// dispatchIndirect reads the workgroup counts from buf; the barrier after
+// the dispatch before it covers a kernel that wrote them.
+func (c *glCmd) dispatchIndirect(buf backendBuffer, offset int) {
+	gb := buf.(*glBuffer)
 	c.record(func() {
 		f := &c.b.fns
-		purego.SyscallN(f.dispatchCompute, uintptr(x), 1, 1)
+		purego.SyscallN(f.bindBuffer, uintptr(glDispatchIndirectBuffer), uintptr(gb.id))
+		purego.SyscallN(f.dispatchComputeIndirect, uintptr(offset))
 		purego.SyscallN(f.memoryBarrier, uintptr(uint32(glAllBarrierBits)))
 	})
 }
 
-func (c *glCmd) endCompute() {}
+func (c *glCmd) endCompute() { c.endTimestamp() }
+
+// --- queries ---
+
+// glQuerySet is a set of GL query objects. An occlusion query is a
+// GL_ANY_SAMPLES_PASSED query, reading 1 or 0. A pass's timestamps are
+// glQueryCounterEXT writes; on a driver with no timestamp counter (zero
+// counter bits) the pass is timed as one GL_TIME_ELAPSED interval instead,
+// stored in its end query, and its begin query reads 0, so end minus begin
+// is still the pass's duration.
+type glQuerySet struct {
+	b       *glBackend
+	typ     QueryType
+	ids     []uint32
+	written []bool // the query holds a result; GL thread only
+}
+
+func (b *glBackend) newQuerySet(typ QueryType, count int) (backendQuerySet, error) {
+	if typ == QueryTimestamp && !b.timerQuery {
+		return nil, errTimestampUnsupported
+	}
+	q := &glQuerySet{b: b, typ: typ, ids: make([]uint32, count), written: make([]bool, count)}
+	b.do(func() {
+		purego.SyscallN(b.fns.genQueries, uintptr(count), uintptr(unsafe.Pointer(&q.ids[0])))
+	})
+	return q, nil
+}
+
+// begin and end write a pass's timestamps; they run on the GL thread.
+func (q *glQuerySet) begin(ts *passTimestamps) {
+	f := &q.b.fns
+	if q.b.timestampBits > 0 {
+		purego.SyscallN(f.queryCounter, uintptr(q.ids[ts.begin]), uintptr(glTimestampEXT))
+		q.written[ts.begin] = true
+		return
+	}
+	q.written[ts.begin] = false
+	purego.SyscallN(f.beginQuery, uintptr(glTimeElapsedEXT), uintptr(q.ids[ts.end]))
+}
+
+func (q *glQuerySet) end(ts *passTimestamps) {
+	f := &q.b.fns
+	if q.b.timestampBits > 0 {
+		purego.SyscallN(f.queryCounter, uintptr(q.ids[ts.end]), uintptr(glTimestampEXT))
+	} else {
+		purego.SyscallN(f.endQuery, uintptr(glTimeElapsedEXT))
+	}
+	q.written[ts.end] = true
+}
+
+// results waits for each written query's value. GL_GPU_DISJOINT_EXT reports
+// that something (a clock or power state change) made the timings since it
+// was last read meaningless, so then they all read 0.
+func (q *glQuerySet) results(first, count int) ([]uint64, error) {
+	out := make([]uint64, count)
+	q.b.do(func() {
+		f := &q.b.fns
+		if q.typ == QueryOcclusion {
+			for i := range out {
+				if q.written[first+i] {
+					var v uint32
+					purego.SyscallN(f.getQueryObjectuiv, uintptr(q.ids[first+i]), uintptr(glQueryResult), uintptr(unsafe.Pointer(&v)))
+					out[i] = uint64(v)
+				}
+			}
+			return
+		}
+		var disjoint int32
+		purego.SyscallN(f.getIntegerv, uintptr(glGPUDisjointEXT), uintptr(unsafe.Pointer(&disjoint)))
+		if disjoint != 0 {
+			return
+		}
+		for i := range out {
+			if q.written[first+i] {
+				purego.SyscallN(f.getQueryObjectui64v, uintptr(q.ids[first+i]), uintptr(glQueryResult), uintptr(unsafe.Pointer(&out[i])))
+			}
+		}
+	})
+	return out, nil
+}
+
+func (q *glQuerySet) release() {
+	q.b.do(func() {
+		purego.SyscallN(q.b.fns.deleteQueries, uintptr(len(q.ids)), uintptr(unsafe.Pointer(&q.ids[0])))
+	})
+}
+
+// beginTimestamp records the begin write of a pass's timestamps, if it has
+// any, and keeps them for endTimestamp.
+func (c *glCmd) beginTimestamp(ts *passTimestamps) {
+	c.ts = ts
+	if ts == nil {
+		return
+	}
+	q := ts.set.(*glQuerySet)
+	c.record(func() { q.begin(ts) })
+}
+
+func (c *glCmd) beginOcclusionQuery(index int) {
+	q := c.occ
+	c.record(func() {
+		purego.SyscallN(c.b.fns.beginQuery, uintptr(glAnySamplesPassed), uintptr(q.ids[index]))
+		q.written[index] = true
+	})
+}
+
+func (c *glCmd) endOcclusionQuery() {
+	c.record(func() { purego.SyscallN(c.b.fns.endQuery, uintptr(glAnySamplesPassed)) })
+}
+
+// endTimestamp records the end write of the open pass's timestamps.
+func (c *glCmd) endTimestamp() {
+	ts := c.ts
+	c.ts = nil
+	if ts == nil {
+		return
+	}
+	q := ts.set.(*glQuerySet)
+	c.record(func() { q.end(ts) })
+}
 
 // --- render support ---
 
@@ -494,53 +1205,116 @@ type glTexture struct {
 	id      uint32
 	fbo     uint32
 	w, h    int
-	depth   bool // a Depth32Float texture (attached as a depth attachment, not color)
+	target  uintptr // GL_TEXTURE_2D, _2D_MULTISAMPLE, _2D_ARRAY, _CUBE_MAP or _3D
+	format  TextureFormat
+	depth   bool // a depth format (attached as a depth attachment, not color)
 	floatTx bool // an RGBA32Float color texture (readback is 16 bytes/pixel, GL_FLOAT)
 }
 
-func (b *glBackend) newTexture(format TextureFormat, w, h int, renderTarget bool) (backendTexture, error) {
-	t := &glTexture{b: b, w: w, h: h, depth: format == Depth32Float, floatTx: format == RGBA32Float}
+// glTextureFormat returns the internal format GL stores f as, and the format
+// and type its pixels are uploaded as.
+func glTextureFormat(f TextureFormat) (internal, format, typ uintptr) {
+	switch f {
+	case Depth32Float:
+		return glDepthComponent32F, glDepthComponent, glFloat
+	case Depth24Stencil8:
+		return glDepth24Stencil8, glDepthStencil, glUnsignedInt248
+	case RGBA32Float:
+		return glRGBA32F, glRGBA, glFloat
+	case R8Unorm:
+		return glR8, glRed, glUnsignedByte
+	case RG16Float:
+		return glRG16F, glRG, glHalfFloat
+	case RGBA16Float:
+		return glRGBA16F, glRGBA, glHalfFloat
+	case R32Float:
+		return glR32F, glRed, glFloat
+	case BGRA8UnormSRGB:
+		// GLES has no BGRA storage: the texture is RGBA, and writeLevel
+		// and readLevel swap the red and blue bytes.
+		return glSRGB8Alpha8, glRGBA, glUnsignedByte
+	}
+	return glRGBA8, glRGBA, glUnsignedByte
+}
+
+func glTextureTarget(d TextureDimension) uintptr {
+	switch d {
+	case TextureDimension2DArray:
+		return glTexture2DArray
+	case TextureDimensionCube:
+		return glTextureCubeMap
+	case TextureDimension3D:
+		return glTexture3D
+	}
+	return glTexture2D
+}
+
+func (b *glBackend) newTexture(desc TextureDescriptor) (backendTexture, error) {
+	w, h := desc.Width, desc.Height
+	t := &glTexture{
+		b: b, w: w, h: h, target: glTextureTarget(desc.Dimension), format: desc.Format,
+		depth: desc.Format.isDepth(), floatTx: desc.Format == RGBA32Float,
+	}
+	internal, _, _ := glTextureFormat(desc.Format)
+	if desc.SampleCount > 1 {
+		t.target = glTexture2DMS
+		// GL_SAMPLES lists the supported counts, highest first.
+		var most int32
+		b.do(func() {
+			purego.SyscallN(b.fns.getInternalformativ, uintptr(glTexture2DMS), internal, uintptr(glSamples), 1, uintptr(unsafe.Pointer(&most)))
+		})
+		if int(most) < desc.SampleCount {
+			return nil, fmt.Errorf("gpu/gl: texture format %d supports at most %d samples, not %d", int(desc.Format), most, desc.SampleCount)
+		}
+	}
 	b.do(func() {
 		f := &b.fns
 		purego.SyscallN(f.genTextures, 1, uintptr(unsafe.Pointer(&t.id)))
-		purego.SyscallN(f.bindTexture, uintptr(glTexture2D), uintptr(t.id))
-		switch {
-		case t.depth:
-			purego.SyscallN(f.texImage2D, uintptr(glTexture2D), 0, uintptr(glDepthComponent32F), uintptr(w), uintptr(h), 0, uintptr(glDepthComponent), uintptr(glFloat), 0)
-		case t.floatTx:
-			purego.SyscallN(f.texImage2D, uintptr(glTexture2D), 0, uintptr(glRGBA32F), uintptr(w), uintptr(h), 0, uintptr(glRGBA), uintptr(glFloat), 0)
+		purego.SyscallN(f.bindTexture, t.target, uintptr(t.id))
+		// Immutable storage allocates every level (and cube face) up front,
+		// so the texture is complete whichever levels are written.
+		levels := uintptr(desc.MipLevelCount)
+		switch t.target {
+		case glTexture2DMS:
+			// Fixed sample locations, as Metal and Vulkan place them.
+			purego.SyscallN(f.texStorage2DMultisample, t.target, uintptr(desc.SampleCount), internal, uintptr(w), uintptr(h), glTrue)
+		case glTexture2DArray, glTexture3D:
+			purego.SyscallN(f.texStorage3D, t.target, levels, internal, uintptr(w), uintptr(h), uintptr(desc.DepthOrArrayLayers))
 		default:
-			purego.SyscallN(f.texImage2D, uintptr(glTexture2D), 0, uintptr(glRGBA8), uintptr(w), uintptr(h), 0, uintptr(glRGBA), uintptr(glUnsignedByte), 0)
+			purego.SyscallN(f.texStorage2D, t.target, levels, internal, uintptr(w), uintptr(h))
+		}
+		// A multisampled texture is never filtered and takes no parameters.
+		if t.target != glTexture2DMS {
+			purego.SyscallN(f.texParameteri, t.target, uintptr(glTexMinFilter), uintptr(glNearest))
+			purego.SyscallN(f.texParameteri, t.target, uintptr(glTexMagFilter), uintptr(glNearest))
 		}
-		purego.SyscallN(f.texParameteri, uintptr(glTexture2D), uintptr(glTexMinFilter), uintptr(glNearest))
-		purego.SyscallN(f.texParameteri, uintptr(glTexture2D), uintptr(glTexMagFilter), uintptr(glNearest))
 		// A color render target gets its own framebuffer (color attachment 0). A
 		// depth texture carries no framebuffer of its own: beginRender attaches it
 		// to a color pass's framebuffer as the depth attachment.
-		if renderTarget && !t.depth {
+		if desc.RenderTarget && !t.depth {
 			purego.SyscallN(f.genFramebuffers, 1, uintptr(unsafe.Pointer(&t.fbo)))
 			purego.SyscallN(f.bindFramebuffer, uintptr(glFramebuffer), uintptr(t.fbo))
-			purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glColorAttachment0), uintptr(glTexture2D), uintptr(t.id), 0)
+			purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glColorAttachment0), t.target, uintptr(t.id), 0)
 		}
 	})
 	return t, nil
 }
 
-func (t *glTexture) readPixels() []byte {
-	// 4 bytes/pixel for RGBA8, 16 (4 float32) for RGBA32Float.
-	bpp, gltype := 4, uintptr(glUnsignedByte)
-	if t.floatTx {
-		bpp, gltype = 16, uintptr(glFloat)
-	}
-	dst := make([]byte, t.w*t.h*bpp)
+func (t *glTexture) release() {
 	t.b.do(func() {
 		f := &t.b.fns
-		purego.SyscallN(f.bindFramebuffer, uintptr(glFramebuffer), uintptr(t.fbo))
-		purego.SyscallN(f.readPixels, 0, 0, uintptr(t.w), uintptr(t.h), uintptr(glRGBA), gltype, uintptr(unsafe.Pointer(&dst[0])))
+		if t.fbo != 0 {
+			purego.SyscallN(f.deleteFramebuffers, 1, uintptr(unsafe.Pointer(&t.fbo)))
+		}
+		purego.SyscallN(f.deleteTextures, 1, uintptr(unsafe.Pointer(&t.id)))
 	})
+}
+
+func (t *glTexture) readPixels() []byte {
+	dst := t.readLevel(0, 0, t.w, t.h)
 	// GL's framebuffer origin is bottom-left; flip rows so the result is
 	// top-down, matching the Metal backend and image.RGBA.
-	row := t.w * bpp
+	row := t.w * t.format.bytesPerPixel()
 	flipped := make([]byte, len(dst))
 	for y := 0; y < t.h; y++ {
 		copy(flipped[y*row:(y+1)*row], dst[(t.h-1-y)*row:(t.h-y)*row])
@@ -548,15 +1322,111 @@ func (t *glTexture) readPixels() []byte {
 	return flipped
 }
 
-func (t *glTexture) write(pixels []byte, bytesPerRow int) {
+// attach attaches level and layer of t to attachment att of the framebuffer
+// bound to target; must run on the context thread.
+func (t *glTexture) attach(target, att uintptr, level, layer int) {
+	f := &t.b.fns
+	switch t.target {
+	case glTextureCubeMap:
+		purego.SyscallN(f.framebufferTexture2D, target, att, uintptr(glCubeMapPositiveX+layer), uintptr(t.id), uintptr(level))
+	case glTexture2DArray, glTexture3D:
+		purego.SyscallN(f.framebufferTextureLayer, target, att, uintptr(t.id), uintptr(level), uintptr(layer))
+	default:
+		purego.SyscallN(f.framebufferTexture2D, target, att, t.target, uintptr(t.id), uintptr(level))
+	}
+}
+
+// readLevel reads the image through a framebuffer of its own. GLES only
+// guarantees reading color as RGBA bytes or floats, so the pixels are read
+// that way and converted to t's format.
+func (t *glTexture) readLevel(level, layer, w, h int) []byte {
+	typ, size := uintptr(glUnsignedByte), 1
+	switch t.format {
+	case RG16Float, RGBA16Float, R32Float, RGBA32Float:
+		typ, size = glFloat, 4
+	}
+	rgba := make([]byte, w*h*4*size)
 	t.b.do(func() {
 		f := &t.b.fns
-		purego.SyscallN(f.bindTexture, uintptr(glTexture2D), uintptr(t.id))
-		purego.SyscallN(f.texImage2D, uintptr(glTexture2D), 0, uintptr(glRGBA8), uintptr(t.w), uintptr(t.h), 0, uintptr(glRGBA), uintptr(glUnsignedByte), uintptr(unsafe.Pointer(&pixels[0])))
+		var fbo uint32
+		purego.SyscallN(f.genFramebuffers, 1, uintptr(unsafe.Pointer(&fbo)))
+		purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), uintptr(fbo))
+		t.attach(glReadFramebuffer, glColorAttachment0, level, layer)
+		purego.SyscallN(f.readPixels, 0, 0, uintptr(w), uintptr(h), uintptr(glRGBA), typ, uintptr(unsafe.Pointer(&rgba[0])))
+		purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), 0)
+		purego.SyscallN(f.deleteFramebuffers, 1, uintptr(unsafe.Pointer(&fbo)))
+	})
+	n := w * h
+	switch t.format {
+	case BGRA8UnormSRGB:
+		swapRedBlue(rgba)
+	case R8Unorm:
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = rgba[i*4]
+		}
+		return out
+	case R32Float:
+		out := make([]byte, n*4)
+		for i := 0; i < n; i++ {
+			copy(out[i*4:i*4+4], rgba[i*16:])
+		}
+		return out
+	case RG16Float, RGBA16Float:
+		channels := t.format.bytesPerPixel() / 2
+		out := make([]byte, n*channels*2)
+		for i := 0; i < n; i++ {
+			for c := 0; c < channels; c++ {
+				v := math.Float32frombits(binary.LittleEndian.Uint32(rgba[(i*4+c)*4:]))
+				binary.LittleEndian.PutUint16(out[(i*channels+c)*2:], halfBits(v))
+			}
+		}
+		return out
+	}
+	return rgba
+}
+
+func (t *glTexture) generateMipmaps() {
+	t.b.do(func() {
+		f := &t.b.fns
+		purego.SyscallN(f.bindTexture, t.target, uintptr(t.id))
+		purego.SyscallN(f.generateMipmap, t.target)
+	})
+}
+
+func (t *glTexture) writeLevel(level, layer, w, h int, pixels []byte) {
+	_, format, typ := glTextureFormat(t.format)
+	if t.format == BGRA8UnormSRGB {
+		pixels = slices.Clone(pixels)
+		swapRedBlue(pixels)
+	}
+	t.b.do(func() {
+		f := &t.b.fns
+		p := uintptr(unsafe.Pointer(&pixels[0]))
+		purego.SyscallN(f.bindTexture, t.target, uintptr(t.id))
+		// Rows of R8Unorm pixels are not 4-byte aligned.
+		purego.SyscallN(f.pixelStorei, uintptr(glUnpackAlignment), 1)
+		switch t.target {
+		case glTextureCubeMap:
+			purego.SyscallN(f.texSubImage2D, uintptr(glCubeMapPositiveX+layer), uintptr(level), 0, 0, uintptr(w), uintptr(h), format, typ, p)
+		case glTexture2DArray, glTexture3D:
+			purego.SyscallN(f.texSubImage3D, t.target, uintptr(level), 0, 0, uintptr(layer), uintptr(w), uintptr(h), 1, format, typ, p)
+		default:
+			purego.SyscallN(f.texSubImage2D, uintptr(glTexture2D), uintptr(level), 0, 0, uintptr(w), uintptr(h), format, typ, p)
+		}
+		purego.SyscallN(f.pixelStorei, uintptr(glUnpackAlignment), 4)
 		runtime.KeepAlive(pixels)
 	})
 }
 
+// swapRedBlue swaps the first and third byte of every 4-byte pixel, between
+// BGRA and RGBA order.
+func swapRedBlue(p []byte) {
+	for i := 0; i+3 < len(p); i += 4 {
+		p[i], p[i+2] = p[i+2], p[i]
+	}
+}
+
 // --- on-screen window surface ---
 
 // glWindowSurface is an EGL window surface plus a persistent FBO-backed texture
@@ -576,7 +1446,7 @@ func (b *glBackend) newWindowSurface(display, window uintptr, w, h int) (backend
 	_ = display
 	// newTexture marshals onto the context thread itself, so it is called
 	// outside the do() below to avoid a nested (deadlocking) do.
-	bt, err := b.newTexture(RGBA8Unorm, w, h, true)
+	bt, err := b.newTexture(glSurfaceTexture(w, h))
 	if err != nil {
 		return nil, err
 	}
@@ -597,6 +1467,11 @@ func (b *glBackend) newWindowSurface(display, window uintptr, w, h int) (backend
 	return s, nil
 }
 
+// glSurfaceTexture describes a window surface's upload texture.
+func glSurfaceTexture(w, h int) TextureDescriptor {
+	return TextureDescriptor{Format: RGBA8Unorm, Width: w, Height: h, DepthOrArrayLayers: 1, MipLevelCount: 1, RenderTarget: true}
+}
+
 func (s *glWindowSurface) acquire() backendTexture { return s.tex }
 
 func (s *glWindowSurface) present() error {
@@ -628,16 +1503,18 @@ func (s *glWindowSurface) resize(w, h int) error {
 	// The EGL window surface auto-tracks the window size on most drivers; only the
 	// upload/blit texture needs reallocating. newTexture self-marshals onto the
 	// context thread, so it is not wrapped in do() here.
-	bt, err := s.b.newTexture(RGBA8Unorm, w, h, true)
+	bt, err := s.b.newTexture(glSurfaceTexture(w, h))
 	if err != nil {
 		return err
 	}
+	s.tex.release()
 	s.tex = bt.(*glTexture)
 	s.w, s.h = w, h
 	return nil
 }
 
 func (s *glWindowSurface) release() {
+	s.tex.release()
 	s.b.do(func() {
 		purego.SyscallN(s.b.fns.eglDestroySurface, s.b.dpy, s.surf)
 	})
@@ -671,32 +1548,248 @@ func (s *glWindowSurface) readback() []byte {
 	return flipped
 }
 
-type glRenderPipeline struct{ program uint32 }
+type glRenderPipeline struct {
+	b       *glBackend
+	program uint32
+	state   renderState
+	depth   bool // has a depth attachment format; the pass enables the test
+	// baseInstance is the location of the vertex stage's gpu_BaseInstance
+	// uniform (see withBaseInstance), or -1 when it reads no instance id.
+	baseInstance int32
+}
+
+func (p glRenderPipeline) release() { p.b.deleteProgram(p.program) }
+
+var glCompareFuncs = [...]uintptr{
+	CompareNever:        0x0200,
+	CompareLess:         0x0201,
+	CompareEqual:        0x0202,
+	CompareLessEqual:    0x0203,
+	CompareGreater:      0x0204,
+	CompareNotEqual:     0x0205,
+	CompareGreaterEqual: 0x0206,
+	CompareAlways:       0x0207,
+}
+
+var glBlendFactors = [...]uintptr{
+	BlendZero:             0,
+	BlendOne:              1,
+	BlendSrc:              0x0300,
+	BlendOneMinusSrc:      0x0301,
+	BlendSrcAlpha:         0x0302,
+	BlendOneMinusSrcAlpha: 0x0303,
+	BlendDstAlpha:         0x0304,
+	BlendOneMinusDstAlpha: 0x0305,
+	BlendDst:              0x0306,
+	BlendOneMinusDst:      0x0307,
+}
+
+var glBlendOps = [...]uintptr{
+	BlendOpAdd:             0x8006,
+	BlendOpMin:             0x8007,
+	BlendOpMax:             0x8008,
+	BlendOpSubtract:        0x800A,
+	BlendOpReverseSubtract: 0x800B,
+}
+
+// uniformBlend reports whether every color target has the same blend state,
+// which GLES 3.1's global blend state can express without the indexed calls.
+func (s renderState) uniformBlend() bool {
+	for _, bs := range s.blend[1:] {
+		if (bs == nil) != (s.blend[0] == nil) || (bs != nil && *bs != *s.blend[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRenderState sets the GL fixed-function state for p; must run on the
+// context thread. GL state is global, so everything is set on every bind.
+func (b *glBackend) applyRenderState(p glRenderPipeline) {
+	f := &b.fns
+	s := p.state
+	if p.depth {
+		purego.SyscallN(f.depthFunc, glCompareFuncs[s.depthCompare])
+		var mask uintptr
+		if s.depthWrite {
+			mask = glTrue
+		}
+		purego.SyscallN(f.depthMask, mask)
+	}
+
+	if s.cull == CullNone {
+		purego.SyscallN(f.disable, uintptr(glCullFaceEnum))
+	} else {
+		purego.SyscallN(f.enable, uintptr(glCullFaceEnum))
+		face := uintptr(glBack)
+		if s.cull == CullFront {
+			face = glFront
+		}
+		purego.SyscallN(f.cullFace, face)
+	}
+	winding := uintptr(glCCW)
+	if s.frontFace == FrontCW {
+		winding = glCW
+	}
+	purego.SyscallN(f.frontFace, winding)
+
+	channel := func(m ColorWriteMask) uintptr {
+		if s.colorWrite&m != 0 {
+			return glTrue
+		}
+		return 0
+	}
+	purego.SyscallN(f.colorMask, channel(ColorWriteRed), channel(ColorWriteGreen), channel(ColorWriteBlue), channel(ColorWriteAlpha))
 
-func (glRenderPipeline) isRenderPipeline() {}
+	if s.uniformBlend() {
+		bs := s.blend[0]
+		if bs == nil {
+			purego.SyscallN(f.disable, uintptr(glBlend))
+			return
+		}
+		purego.SyscallN(f.enable, uintptr(glBlend))
+		purego.SyscallN(f.blendFuncSeparate, glBlendFactors[bs.Color.SrcFactor], glBlendFactors[bs.Color.DstFactor], glBlendFactors[bs.Alpha.SrcFactor], glBlendFactors[bs.Alpha.DstFactor])
+		purego.SyscallN(f.blendEquationSeparate, glBlendOps[bs.Color.Operation], glBlendOps[bs.Alpha.Operation])
+		return
+	}
+	for i, bs := range s.blend {
+		if bs == nil {
+			purego.SyscallN(f.disablei, uintptr(glBlend), uintptr(i))
+			continue
+		}
+		purego.SyscallN(f.enablei, uintptr(glBlend), uintptr(i))
+		purego.SyscallN(f.blendFuncSeparatei, uintptr(i), glBlendFactors[bs.Color.SrcFactor], glBlendFactors[bs.Color.DstFactor], glBlendFactors[bs.Alpha.SrcFactor], glBlendFactors[bs.Alpha.DstFactor])
+		purego.SyscallN(f.blendEquationSeparatei, uintptr(i), glBlendOps[bs.Color.Operation], glBlendOps[bs.Alpha.Operation])
+	}
+}
 
-func (b *glBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat) (backendRenderPipeline, error) {
+func (b *glBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat, state renderState) (backendRenderPipeline, error) {
 	vs, ok1 := vmod.(glShaderModule)
 	fs, ok2 := fmod.(glShaderModule)
 	if !ok1 || !ok2 {
 		return nil, fmt.Errorf("gpu/gl: render pipeline needs GL shader modules")
 	}
+	if !state.uniformBlend() && b.fns.blendFuncSeparatei == 0 {
+		return nil, fmt.Errorf("gpu/gl: per-target blend states need glBlendFuncSeparatei (GLES 3.2)")
+	}
+	vs.glsl = withBaseInstance(vs.glsl)
 	var prog uint32
 	var perr error
-	b.do(func() { prog, perr = b.linkRender(vs.glsl, fs.glsl) })
+	loc := int32(-1)
+	b.do(func() {
+		if prog, perr = b.linkRender(vs, fs); perr != nil {
+			return
+		}
+		name := []byte(glBaseInstance + "\x00")
+		r, _, _ := purego.SyscallN(b.fns.getUniformLocation, uintptr(prog), uintptr(unsafe.Pointer(&name[0])))
+		loc = int32(r)
+	})
 	if perr != nil {
 		return nil, perr
 	}
-	return glRenderPipeline{program: prog}, nil
+	return glRenderPipeline{b: b, program: prog, state: state, depth: depth != FormatNone, baseInstance: loc}, nil
+}
+
+// glBaseInstance is the uniform withBaseInstance adds to a vertex shader.
+const glBaseInstance = "gpu_BaseInstance"
+
+// withBaseInstance returns the vertex shader src with a base instance: GLES
+// has no draw with one, and gl_InstanceID counts from 0 whatever the
+// firstInstance of the draw, so each use of it becomes gl_InstanceID plus
+// a gpu_BaseInstance uniform the draw sets. Only whole gl_InstanceID tokens
+// outside comments are rewritten. The uniform is declared at the start of
+// the first line after the #version and #extension lines, which must come
+// first, keeping the line numbers of compile logs.
+func withBaseInstance(src string) string {
+	lines := strings.Split(src, "\n")
+	var (
+		comment, used bool // in a block comment; gl_InstanceID rewritten
+		at            int  // the line the uniform is declared on
+		open          = make([]bool, len(lines))
+	)
+	for i, l := range lines {
+		open[i] = comment
+		if t := strings.TrimSpace(l); !comment && (strings.HasPrefix(t, "#version") || strings.HasPrefix(t, "#extension")) {
+			at = i + 1
+		}
+		var n bool
+		lines[i], comment, n = rewriteInstanceID(l, comment)
+		used = used || n
+	}
+	if !used {
+		return src
+	}
+	// A directive line may open a block comment the declaration must not
+	// land in.
+	for at < len(lines) && open[at] {
+		at++
+	}
+	decl := "uniform int " + glBaseInstance + "; "
+	if at == len(lines) {
+		lines = append(lines, "")
+	}
+	lines[at] = decl + lines[at]
+	return strings.Join(lines, "\n")
+}
+
+// rewriteInstanceID rewrites the whole gl_InstanceID tokens of line that
+// are outside comments, comment telling whether the line starts in a block
+// comment. It returns the line, whether it ends in a block comment, and
+// whether it rewrote any token.
+func rewriteInstanceID(line string, comment bool) (string, bool, bool) {
+	const tok = "gl_InstanceID"
+	ident := func(c byte) bool {
+		return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+	}
+	var b strings.Builder
+	used := false
+	for i := 0; i < len(line); {
+		switch rest := line[i:]; {
+		case comment:
+			j := strings.Index(rest, "*/")
+			if j < 0 {
+				b.WriteString(rest)
+				return b.String(), true, used
+			}
+			b.WriteString(rest[:j+2])
+			i += j + 2
+			comment = false
+		case strings.HasPrefix(rest, "//"):
+			b.WriteString(rest)
+			return b.String(), false, used
+		case strings.HasPrefix(rest, "/*"):
+			b.WriteString("/*")
+			i += 2
+			comment = true
+		case strings.HasPrefix(rest, tok) && (len(rest) == len(tok) || !ident(rest[len(tok)])):
+			b.WriteString("(" + tok + " + " + glBaseInstance + ")")
+			i += len(tok)
+			used = true
+		case ident(line[i]):
+			// Skip the rest of an identifier, so a token is never
+			// matched inside one.
+			j := i
+			for j < len(line) && ident(line[j]) {
+				j++
+			}
+			b.WriteString(line[i:j])
+			i = j
+		default:
+			b.WriteByte(line[i])
+			i++
+		}
+	}
+	return b.String(), comment, used
 }
 
 // linkRender compiles a vertex+fragment program; must run on the context thread.
-func (b *glBackend) linkRender(vsrc, fsrc string) (uint32, error) {
+func (b *glBackend) linkRender(vmod, fmod glShaderModule) (uint32, error) {
 	f := &b.fns
 	const glVertexShader = 0x8B31
 	const glFragmentShader = 0x8B30
-	compile := func(kind uintptr, src string) (uintptr, error) {
+	compile := func(kind uintptr, mod glShaderModule) (uintptr, error) {
 		sh, _, _ := purego.SyscallN(f.createShader, kind)
+		src := mod.glsl
 		psrc := &src
 		slen := int32(len(src))
 		purego.SyscallN(f.shaderSource, sh, 1, uintptr(unsafe.Pointer(psrc)), uintptr(unsafe.Pointer(&slen)))
@@ -705,15 +1798,15 @@ func (b *glBackend) linkRender(vsrc, fsrc string) (uint32, error) {
 		var status int32
 		purego.SyscallN(f.getShaderiv, sh, glCompileStatus, uintptr(unsafe.Pointer(&status)))
 		if status == 0 {
-			return 0, fmt.Errorf("gpu/gl: shader compile failed: %s", b.shaderLog(sh))
+			return 0, fmt.Errorf("gpu/gl: shader compile failed: %s", goPositions(b.shaderLog(sh), mod.lines))
 		}
 		return sh, nil
 	}
-	vs, err := compile(glVertexShader, vsrc)
+	vs, err := compile(glVertexShader, vmod)
 	if err != nil {
 		return 0, err
 	}
-	fsh, err := compile(glFragmentShader, fsrc)
+	fsh, err := compile(glFragmentShader, fmod)
 	if err != nil {
 		return 0, err
 	}
@@ -732,7 +1825,60 @@ func (b *glBackend) linkRender(vsrc, fsrc string) (uint32, error) {
 	return uint32(p), nil
 }
 
-func (b *glBackend) newSampler(desc SamplerDescriptor) backendSampler { return nil }
+type glSampler struct{ id uint32 }
+
+func (*glSampler) isSampler() {}
+
+func glFilter(f FilterMode) uintptr {
+	if f == FilterLinear {
+		return glLinear
+	}
+	return glNearest
+}
+
+func glAddress(a AddressMode) uintptr {
+	if a == AddressRepeat {
+		return glRepeat
+	}
+	return glClampToEdge
+}
+
+// glMinify is the GL minification filter of min and mip filters.
+var glMinify = [2][2]uintptr{
+	FilterNearest: {FilterNearest: glNearestMipNearest, FilterLinear: glNearestMipLinear},
+	FilterLinear:  {FilterNearest: glLinearMipNearest, FilterLinear: glLinearMipLinear},
+}
+
+func (b *glBackend) newSampler(desc SamplerDescriptor) backendSampler {
+	s := &glSampler{}
+	b.do(func() {
+		f := &b.fns
+		purego.SyscallN(f.genSamplers, 1, uintptr(unsafe.Pointer(&s.id)))
+		params := [][2]uintptr{
+			{glTexMinFilter, glMinify[desc.MinFilter][desc.MipmapFilter]}, {glTexMagFilter, glFilter(desc.MagFilter)},
+			{glTexWrapS, glAddress(desc.AddressU)}, {glTexWrapT, glAddress(desc.AddressV)},
+			{glTexWrapR, glClampToEdge},
+		}
+		if desc.Compare != CompareUndefined {
+			params = append(params, [2]uintptr{glTextureCompareMode, glCompareRefToTexture}, [2]uintptr{glTextureCompareFunc, glCompareFuncs[desc.Compare]})
+		}
+		for _, p := range params {
+			purego.SyscallN(f.samplerParameteri, uintptr(s.id), p[0], p[1])
+		}
+		type param struct {
+			name uintptr
+			v    float32
+		}
+		fparams := []param{{glTextureMinLod, desc.LodMinClamp}, {glTextureMaxLod, desc.LodMaxClamp}}
+		if b.maxAnisotropy > 0 {
+			fparams = append(fparams, param{glTextureMaxAnisotropy, min(float32(desc.MaxAnisotropy), b.maxAnisotropy)})
+		}
+		for _, p := range fparams {
+			purego.SyscallN(f.samplerParameterfv, uintptr(s.id), p.name, uintptr(unsafe.Pointer(&p.v)))
+		}
+	})
+	return s
+}
 
 func (c *glCmd) beginRender(info renderPassInfo) {
 	t := info.color.(*glTexture)
@@ -741,6 +1887,13 @@ func (c *glCmd) beginRender(info renderPassInfo) {
 	extra := info.extraColor
 	depth, _ := info.depth.(*glTexture)
 	clearDepth := float32(info.clearDepth)
+	c.occ, _ = info.occlusion.(*glQuerySet)
+	c.pass, c.resolve = t, c.resolve[:0]
+	for _, r := range append([]backendTexture{info.resolve}, colorResolves(extra)...) {
+		rt, _ := r.(*glTexture)
+		c.resolve = append(c.resolve, rt)
+	}
+	c.beginTimestamp(info.timestamps)
 	c.record(func() {
 		f := &c.b.fns
 		purego.SyscallN(f.bindFramebuffer, uintptr(glFramebuffer), uintptr(t.fbo))
@@ -752,7 +1905,7 @@ func (c *glCmd) beginRender(info renderPassInfo) {
 		for i, ec := range extra {
 			et := ec.tex.(*glTexture)
 			att := uint32(glColorAttachment1 + i)
-			purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(att), uintptr(glTexture2D), uintptr(et.id), 0)
+			purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(att), et.target, uintptr(et.id), 0)
 			bufs = append(bufs, att)
 		}
 		if len(bufs) > 1 {
@@ -760,9 +1913,17 @@ func (c *glCmd) beginRender(info renderPassInfo) {
 		}
 
 		// Depth: attach + enable the standard 3D test (less, write, fresh clear), or
-		// disable depth testing for a color-only pass.
+		// disable depth testing for a color-only pass. The depth mask must be on for
+		// the clear; the pipeline then sets its own test and mask.
 		if depth != nil {
-			purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glDepthAttachment), uintptr(glTexture2D), uintptr(depth.id), 0)
+			// A depth-stencil texture fills both attachments; a depth-only one
+			// must not be paired with a previous pass's stencil.
+			if depth.format == Depth24Stencil8 {
+				purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glDepthStencilAttachment), depth.target, uintptr(depth.id), 0)
+			} else {
+				purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glStencilAttachment), uintptr(glTexture2D), 0, 0)
+				purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glDepthAttachment), depth.target, uintptr(depth.id), 0)
+			}
 			purego.SyscallN(f.enable, uintptr(glDepthTest))
 			purego.SyscallN(f.depthFunc, uintptr(glLess))
 			purego.SyscallN(f.depthMask, uintptr(glTrue))
@@ -773,6 +1934,8 @@ func (c *glCmd) beginRender(info renderPassInfo) {
 		}
 
 		if clear {
+			// A pipeline's color write mask also masks clears.
+			purego.SyscallN(f.colorMask, glTrue, glTrue, glTrue, glTrue)
 			// glClearBufferfv takes a *GLfloat (an integer-register pointer arg),
 			// so it is safe through SyscallN, unlike glClearColor's float args.
 			vals := [4]float32{float32(cc[0]), float32(cc[1]), float32(cc[2]), float32(cc[3])}
@@ -785,32 +1948,268 @@ func (c *glCmd) beginRender(info renderPassInfo) {
 	})
 }
 
-func (c *glCmd) setRenderPipeline(p backendRenderPipeline) {
-	prog := p.(glRenderPipeline).program
-	c.record(func() { purego.SyscallN(c.b.fns.useProgram, uintptr(prog)) })
+func (c *glCmd) setRenderPipeline(p backendRenderPipeline, _ *BindGroupLayout) {
+	gp := p.(glRenderPipeline)
+	c.rpipe = gp
+	c.record(func() {
+		purego.SyscallN(c.b.fns.useProgram, uintptr(gp.program))
+		c.b.applyRenderState(gp)
+	})
+}
+
+func (c *glCmd) setRenderBuffer(buf backendBuffer, offset, size, index int, _ BindingKind) {
+	c.bindRange(buf.(*glBuffer), offset, size, index)
 }
 
-func (c *glCmd) setRenderBuffer(buf backendBuffer, offset, index int) {
+func (c *glCmd) setVertexBuffer(buf backendBuffer, offset, size, index int) {
 	gb := buf.(*glBuffer)
-	c.record(func() { purego.SyscallN(c.b.fns.bindBufferBase, gb.target, uintptr(index), uintptr(gb.id)) })
+	c.record(func() {
+		purego.SyscallN(c.b.fns.bindBufferRange, uintptr(glShaderStorageBuffer), uintptr(index), uintptr(gb.id), uintptr(offset), uintptr(size))
+	})
+}
+
+// setBaseInstance sets the current pipeline's gpu_BaseInstance to
+// firstInstance, if its vertex stage reads the instance id; it runs on the
+// GL thread.
+func (c *glCmd) setBaseInstance(loc int32, firstInstance int) {
+	if loc >= 0 {
+		purego.SyscallN(c.b.fns.uniform1i, uintptr(loc), uintptr(firstInstance))
+	}
+}
+
+func (c *glCmd) draw(prim Primitive, start, count, firstInstance, instanceCount int) {
+	mode, loc := glPrim(prim), c.rpipe.baseInstance
+	c.record(func() {
+		f := &c.b.fns
+		c.setBaseInstance(loc, firstInstance)
+		if instanceCount == 1 {
+			purego.SyscallN(f.drawArrays, mode, uintptr(start), uintptr(count))
+			return
+		}
+		purego.SyscallN(f.drawArraysInstanced, mode, uintptr(start), uintptr(count), uintptr(instanceCount))
+	})
 }
 
-func (c *glCmd) setVertexBuffer(buf backendBuffer, index int) {
+func (c *glCmd) setIndexBuffer(buf backendBuffer, offset int, format IndexFormat) {
 	gb := buf.(*glBuffer)
+	c.idxOff = offset
+	c.idxType, c.idxSize = uintptr(glUnsignedShort), 2
+	if format == IndexUint32 {
+		c.idxType, c.idxSize = uintptr(glUnsignedInt), 4
+	}
+	// The element array binding is VAO state; the backend's single VAO stays
+	// bound, so binding here holds for the rest of the pass.
+	c.record(func() { purego.SyscallN(c.b.fns.bindBuffer, uintptr(glElementArrayBuffer), uintptr(gb.id)) })
+}
+
+func (c *glCmd) drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int) {
+	mode, typ := glPrim(prim), c.idxType
+	// With an element array buffer bound, the pointer argument is a byte offset.
+	off := uintptr(c.idxOff + firstIndex*c.idxSize)
+	loc := c.rpipe.baseInstance
+	if baseVertex != 0 {
+		// Both entry points are optional before GLES 3.2; see init.
+		if instanceCount == 1 && c.b.fns.drawElementsBaseVertex == 0 {
+			c.fail(&Error{Filter: ErrorFilterValidation, Err: errors.New("gpu/gl: DrawIndexed with a base vertex needs glDrawElementsBaseVertex (GLES 3.2)")})
+			return
+		}
+		if instanceCount != 1 && c.b.fns.drawElementsInstancedBaseVertex == 0 {
+			c.fail(&Error{Filter: ErrorFilterValidation, Err: errors.New("gpu/gl: DrawIndexedInstanced with a base vertex needs glDrawElementsInstancedBaseVertex (GLES 3.2)")})
+			return
+		}
+	}
+	c.record(func() {
+		f := &c.b.fns
+		c.setBaseInstance(loc, firstInstance)
+		switch {
+		case baseVertex == 0 && instanceCount == 1:
+			purego.SyscallN(f.drawElements, mode, uintptr(count), typ, off)
+		case baseVertex == 0:
+			purego.SyscallN(f.drawElementsInstanced, mode, uintptr(count), typ, off, uintptr(instanceCount))
+		case instanceCount == 1:
+			purego.SyscallN(f.drawElementsBaseVertex, mode, uintptr(count), typ, off, uintptr(baseVertex))
+		default:
+			purego.SyscallN(f.drawElementsInstancedBaseVertex, mode, uintptr(count), typ, off, uintptr(instanceCount), uintptr(baseVertex))
+		}
+	})
+}
+
+// GLES 3.1 indirect draws read firstInstance as a reserved field that must
+// be 0, matching the DrawInstanced restriction. With a draw indirect buffer
+// bound, the pointer argument is a byte offset into it.
+
+func (c *glCmd) drawIndirect(prim Primitive, buf backendBuffer, offset int) {
+	mode, gb, loc := glPrim(prim), buf.(*glBuffer), c.rpipe.baseInstance
+	c.record(func() {
+		f := &c.b.fns
+		c.setBaseInstance(loc, 0)
+		purego.SyscallN(f.bindBuffer, uintptr(glDrawIndirectBuffer), uintptr(gb.id))
+		purego.SyscallN(f.drawArraysIndirect, mode, uintptr(offset))
+	})
+}
+
+func (c *glCmd) drawIndexedIndirect(prim Primitive, buf backendBuffer, offset int) {
+	mode, typ, gb, loc := glPrim(prim), c.idxType, buf.(*glBuffer), c.rpipe.baseInstance
+	if c.idxOff != 0 {
+		// The command's firstIndex counts from the start of the buffer.
+		c.fail(&Error{Filter: ErrorFilterValidation, Err: errors.New("gpu/gl: DrawIndexedIndirect from an index slice at a non-zero offset")})
+		return
+	}
+	c.record(func() {
+		f := &c.b.fns
+		c.setBaseInstance(loc, 0)
+		purego.SyscallN(f.bindBuffer, uintptr(glDrawIndirectBuffer), uintptr(gb.id))
+		purego.SyscallN(f.drawElementsIndirect, mode, typ, uintptr(offset))
+	})
+}
+
+func (c *glCmd) endRender() {
+	c.occ = nil
+	// Leave every channel writable for the clears and blits that follow.
+	c.record(func() { purego.SyscallN(c.b.fns.colorMask, glTrue, glTrue, glTrue, glTrue) })
+	// Resolve by blitting each multisampled attachment into its target,
+	// which averages the samples.
+	if slices.ContainsFunc(c.resolve, func(t *glTexture) bool { return t != nil }) {
+		pass, resolve := c.pass, slices.Clone(c.resolve)
+		c.record(func() {
+			f := &c.b.fns
+			fbo := pass.fbo
+			att0 := uint32(glColorAttachment0)
+			for i, r := range resolve {
+				if r == nil {
+					continue
+				}
+				purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), uintptr(fbo))
+				purego.SyscallN(f.readBuffer, uintptr(glColorAttachment0+i))
+				purego.SyscallN(f.bindFramebuffer, uintptr(glDrawFramebuffer), uintptr(r.colorFBO()))
+				purego.SyscallN(f.drawBuffers, 1, uintptr(unsafe.Pointer(&att0)))
+				purego.SyscallN(f.blitFramebuffer, 0, 0, uintptr(r.w), uintptr(r.h), 0, 0, uintptr(r.w), uintptr(r.h),
+					uintptr(glColorBufferBit), uintptr(glNearest))
+			}
+			purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), uintptr(fbo))
+			purego.SyscallN(f.readBuffer, uintptr(glColorAttachment0))
+		})
+	}
+	c.endTimestamp()
+}
+
+// setComputeTexture binds t to texture unit index, which a GLSL kernel's
+// texture of that index samples; setComputeSampler binds the unit's sampler.
+func (c *glCmd) setComputeTexture(index int, t backendTexture) {
+	gt := t.(*glTexture)
+	c.record(func() {
+		f := &c.b.fns
+		purego.SyscallN(f.activeTexture, uintptr(glTexture0+index))
+		purego.SyscallN(f.bindTexture, gt.target, uintptr(gt.id))
+		// Uploads bind textures on unit 0.
+		purego.SyscallN(f.activeTexture, uintptr(glTexture0))
+	})
+}
+
+func (c *glCmd) setComputeSampler(index int, s backendSampler) {
+	gs := s.(*glSampler)
+	c.record(func() { purego.SyscallN(c.b.fns.bindSampler, uintptr(index), uintptr(gs.id)) })
+}
+
+// --- copies ---
+
+// transfer is the format/type pair GL moves t's pixels as, and its bytes per
+// pixel. A BGRA8UnormSRGB texture cannot be copied to or from a buffer, as
+// GL stores it in RGBA order.
+func (t *glTexture) transfer() (format, typ uintptr, bpp int) {
+	if t.format == BGRA8UnormSRGB {
+		panic("gpu/gl: buffer copies of a BGRA8UnormSRGB texture are not supported (GLES stores it as RGBA)")
+	}
+	_, format, typ = glTextureFormat(t.format)
+	return format, typ, t.format.bytesPerPixel()
+}
+
+// colorFBO returns a framebuffer with t as color attachment 0, creating one
+// for a texture that is not a render target; must run on the context thread.
+func (t *glTexture) colorFBO() uint32 {
+	if t.fbo == 0 {
+		f := &t.b.fns
+		purego.SyscallN(f.genFramebuffers, 1, uintptr(unsafe.Pointer(&t.fbo)))
+		purego.SyscallN(f.bindFramebuffer, uintptr(glFramebuffer), uintptr(t.fbo))
+		purego.SyscallN(f.framebufferTexture2D, uintptr(glFramebuffer), uintptr(glColorAttachment0), t.target, uintptr(t.id), 0)
+	}
+	return t.fbo
+}
+
+func (c *glCmd) copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int) {
+	s, d := src.(*glBuffer), dst.(*glBuffer)
 	c.record(func() {
-		purego.SyscallN(c.b.fns.bindBufferBase, uintptr(glShaderStorageBuffer), uintptr(index), uintptr(gb.id))
+		f := &c.b.fns
+		purego.SyscallN(f.bindBuffer, uintptr(glCopyReadBuffer), uintptr(s.id))
+		purego.SyscallN(f.bindBuffer, uintptr(glCopyWriteBuffer), uintptr(d.id))
+		purego.SyscallN(f.copyBufferSubData, uintptr(glCopyReadBuffer), uintptr(glCopyWriteBuffer), uintptr(srcOffset), uintptr(dstOffset), uintptr(size))
 	})
 }
 
-func (c *glCmd) draw(prim Primitive, start, count int) {
-	mode := glPrim(prim)
-	c.record(func() { purego.SyscallN(c.b.fns.drawArrays, mode, uintptr(start), uintptr(count)) })
+// Buffer<->texture copies go through a pixel buffer object: with a buffer bound
+// to GL_PIXEL_(UN)PACK_BUFFER, the pointer argument of glTexSubImage2D and
+// glReadPixels is a byte offset into it. The row length and the binding are
+// reset afterwards so Texture.Write and ReadPixels keep using client memory.
+
+func (c *glCmd) copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int) {
+	s, t := src.(*glBuffer), dst.(*glTexture)
+	format, typ, bpp := t.transfer()
+	c.record(func() {
+		f := &c.b.fns
+		purego.SyscallN(f.bindBuffer, uintptr(glPixelUnpackBuffer), uintptr(s.id))
+		purego.SyscallN(f.pixelStorei, uintptr(glUnpackRowLength), uintptr(bytesPerRow/bpp))
+		purego.SyscallN(f.bindTexture, uintptr(glTexture2D), uintptr(t.id))
+		purego.SyscallN(f.texSubImage2D, uintptr(glTexture2D), 0, uintptr(x), uintptr(y), uintptr(w), uintptr(h), format, typ, uintptr(offset))
+		purego.SyscallN(f.pixelStorei, uintptr(glUnpackRowLength), 0)
+		purego.SyscallN(f.bindBuffer, uintptr(glPixelUnpackBuffer), 0)
+	})
 }
 
-func (c *glCmd) endRender() {}
+func (c *glCmd) copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int) {
+	t, d := src.(*glTexture), dst.(*glBuffer)
+	if t.depth {
+		panic("gpu/gl: CopyTextureToBuffer cannot read a depth texture (GLES has no depth glReadPixels)")
+	}
+	format, typ, bpp := t.transfer()
+	c.record(func() {
+		f := &c.b.fns
+		purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), uintptr(t.colorFBO()))
+		purego.SyscallN(f.bindBuffer, uintptr(glPixelPackBuffer), uintptr(d.id))
+		purego.SyscallN(f.pixelStorei, uintptr(glPackRowLength), uintptr(bytesPerRow/bpp))
+		purego.SyscallN(f.readPixels, uintptr(x), uintptr(y), uintptr(w), uintptr(h), format, typ, uintptr(offset))
+		purego.SyscallN(f.pixelStorei, uintptr(glPackRowLength), 0)
+		purego.SyscallN(f.bindBuffer, uintptr(glPixelPackBuffer), 0)
+	})
+}
 
-func (c *glCmd) setComputeTexture(index int, t backendTexture) {}
-func (c *glCmd) setComputeSampler(index int, s backendSampler) {}
+func (c *glCmd) copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int) {
+	s, d := src.(*glTexture), dst.(*glTexture)
+	f := &c.b.fns
+	if f.copyImageSubData != 0 {
+		c.record(func() {
+			purego.SyscallN(f.copyImageSubData,
+				uintptr(s.id), uintptr(glTexture2D), 0, uintptr(sx), uintptr(sy), 0,
+				uintptr(d.id), uintptr(glTexture2D), 0, uintptr(dx), uintptr(dy), 0,
+				uintptr(w), uintptr(h), 1)
+		})
+		return
+	}
+	// Without glCopyImageSubData, blit between the textures' framebuffers. That
+	// only moves color, and the destination must draw to attachment 0 alone (a
+	// G-buffer framebuffer still routes to all its MRT attachments).
+	if s.depth {
+		panic("gpu/gl: CopyTextureToTexture of a depth texture needs glCopyImageSubData (GLES 3.2)")
+	}
+	c.record(func() {
+		sfbo, dfbo := s.colorFBO(), d.colorFBO()
+		purego.SyscallN(f.bindFramebuffer, uintptr(glReadFramebuffer), uintptr(sfbo))
+		purego.SyscallN(f.bindFramebuffer, uintptr(glDrawFramebuffer), uintptr(dfbo))
+		att := uint32(glColorAttachment0)
+		purego.SyscallN(f.drawBuffers, 1, uintptr(unsafe.Pointer(&att)))
+		purego.SyscallN(f.blitFramebuffer, uintptr(sx), uintptr(sy), uintptr(sx+w), uintptr(sy+h),
+			uintptr(dx), uintptr(dy), uintptr(dx+w), uintptr(dy+h), uintptr(glColorBufferBit), uintptr(glNearest))
+	})
+}
 
 // cStr converts a NUL-terminated C string at p to a Go string.
 func cStr(p uintptr) string {
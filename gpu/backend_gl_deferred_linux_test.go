@@ -151,7 +151,10 @@ func TestGLBackendDeferredKernel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewComputePipeline: %v", err)
 	}
-	bg := dev.NewBindGroup(layout, bge...)
+	bg, err := dev.NewBindGroup(layout, bge...)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Find the output buffer to read back.
 	var outBuf *gpu.Buffer
@@ -15,6 +15,7 @@ import (
 	"encoding/binary"
 	"math"
 	"os"
+	"strings"
 	"testing"
 	"unsafe"
 
@@ -70,7 +71,10 @@ func runGLKernel(t *testing.T, dev *gpu.Device, src, entry string, n int, bufs [
 		gpuBufs[i] = gb
 		bgEntries = append(bgEntries, gpu.BindGroupEntry{Binding: i, Buffer: gb})
 	}
-	bg := dev.NewBindGroup(layout, bgEntries...)
+	bg, err := dev.NewBindGroup(layout, bgEntries...)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	pass := enc.BeginComputePass()
@@ -204,7 +208,10 @@ func Scale(gid uint, a []float32, out []float32, u U) { out[gid] = a[gid] * u.Fa
 	for _, bd := range k.Bindings {
 		bge = append(bge, gpu.BindGroupEntry{Binding: bd.Index, Buffer: bufByName[bd.Name]})
 	}
-	bg := dev.NewBindGroup(layout, bge...)
+	bg, err := dev.NewBindGroup(layout, bge...)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	pass := enc.BeginComputePass()
@@ -223,3 +230,42 @@ func Scale(gid uint, a []float32, out []float32, u U) { out[gid] = a[gid] * u.Fa
 		}
 	}
 }
+
+// TestGLCompileErrorGoPositions checks that a GLSL compile failure names the
+// Go statement the failing line came from, through the kernel's line table.
+func TestGLCompileErrorGoPositions(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL backend conformance test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const src = `//line scale.go:10
+package kernels
+func Scale(gid uint, a []float32, out []float32) {
+	x := a[gid] * 2.0
+	out[gid] = x
+}
+`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Break the GLSL of the store, as a driver bug or a bad edit might.
+	k := ks["Scale"]
+	glsl := strings.Replace(k.GLSL, "out_[gid] = x;", "out_[gid] = missing;", 1)
+	mod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: glsl, Lines: k.Lines})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dev.NewComputePipeline(gpu.ComputePipelineDescriptor{
+		Layout: dev.NewPipelineLayout(dev.NewBindGroupLayout()), Module: mod, Entry: "Scale",
+	})
+	if err == nil || !strings.Contains(err.Error(), "scale.go:13: ") {
+		t.Fatalf("err = %v, want the log to name scale.go:13", err)
+	}
+	t.Log(err)
+}
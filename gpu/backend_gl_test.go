@@ -0,0 +1,55 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || windows
+
+package gpu
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGLBaseVertexUnsupported checks that a base vertex draw on a context
+// without glDrawElementsBaseVertex fails its submission with a validation
+// error, found as it is recorded, rather than on the GL thread.
+func TestGLBaseVertexUnsupported(t *testing.T) {
+	for _, instances := range []int{1, 2} {
+		b := &glBackend{} // no GL entry points resolved
+		var got error
+		b.setErrorHandler(func(err error) { got = err })
+		c := b.newCommandBuffer().(*glCmd)
+		c.setIndexBuffer(&glBuffer{}, 0, IndexUint16)
+		c.drawIndexed(TriangleList, 0, 3, 1, 0, instances)
+		c.commit()
+		var e *Error
+		if !errors.As(got, &e) || e.Filter != ErrorFilterValidation {
+			t.Errorf("instances=%d: commit reported %v, want a validation *Error", instances, got)
+		}
+	}
+}
+
+// TestWithBaseInstance checks that the base instance uniform is declared
+// after the #version and #extension lines, and that only whole
+// gl_InstanceID tokens outside comments are rewritten.
+func TestWithBaseInstance(t *testing.T) {
+	src := "#version 310 es\n" +
+		"#extension GL_EXT_shader_io_blocks : enable\n" +
+		"// reads gl_InstanceID\n" +
+		"/* gl_InstanceID\n" +
+		"   too */ int my_gl_InstanceID;\n" +
+		"void main() { int i = gl_InstanceID*2; /* gl_InstanceID */ }\n"
+	want := "#version 310 es\n" +
+		"#extension GL_EXT_shader_io_blocks : enable\n" +
+		"uniform int gpu_BaseInstance; // reads gl_InstanceID\n" +
+		"/* gl_InstanceID\n" +
+		"   too */ int my_gl_InstanceID;\n" +
+		"void main() { int i = (gl_InstanceID + gpu_BaseInstance)*2; /* gl_InstanceID */ }\n"
+	if got := withBaseInstance(src); got != want {
+		t.Errorf("withBaseInstance:\n%s\nwant:\n%s", got, want)
+	}
+	if src := "#version 310 es\n// gl_InstanceID\nvoid main() {}\n"; withBaseInstance(src) != src {
+		t.Errorf("withBaseInstance changed a shader that only mentions gl_InstanceID in a comment")
+	}
+}
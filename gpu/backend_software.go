@@ -0,0 +1,1345 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+// This file is DriverSoftware: the backend interface implemented in Go, with
+// no system library. Compute kernels run as shader.Program, through the
+// gpumath CPU path, and render pipelines through a rasterizer here with the
+// semantics the GPU backends share. It is what Open falls back to without a
+// GPU, so the Device API can be tested anywhere.
+//
+// Textures are stored as Metal stores them: top-down, row 0 the top of a
+// rendered image (normalized y = +1), and depth in [0, 1]. A command buffer
+// records closures and replays them at commit, on the committing goroutine;
+// commits are serialized, so work completes in submission order by the time
+// Submit returns.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"poly.red/gpu/shader"
+)
+
+type swBackend struct {
+	errorHandler
+	mu    sync.Mutex // held while a command buffer replays
+	start time.Time  // time zero of timestamp queries
+}
+
+func openSoftware() backend { return &swBackend{start: time.Now()} }
+
+func (m *swBackend) windowVisualID() uint32 { return 0 }
+
+// softwareCapabilities are the software driver's: the compute limits GL and
+// Vulkan guarantee, which keeps kernels tested here portable, and every
+// feature but anisotropic filtering.
+var softwareCapabilities = capabilities{
+	info: AdapterInfo{Driver: DriverSoftware, Vendor: "Polyred", Name: "software", Software: true},
+	limits: Limits{
+		MaxBufferSize:           math.MaxInt32,
+		MaxComputeWorkgroupSize: [3]int{128, 128, 64},
+		MaxComputeInvocations:   128,
+		MaxTextureDimension2D:   16384,
+		MaxColorAttachments:     8,
+		MaxSamplerAnisotropy:    1,
+		// Kernels read any offset; 16 is the least GL and Vulkan allow.
+		MinUniformBufferOffsetAlignment: 16,
+		MinStorageBufferOffsetAlignment: 16,
+	},
+	features: FeatureTimestampQuery | FeatureFloat32Renderable,
+}
+
+func (m *swBackend) capabilities() capabilities { return softwareCapabilities }
+
+func (m *swBackend) newWindowSurface(display, window uintptr, w, h int) (backendWindowSurface, error) {
+	return nil, ErrUnsupported
+}
+
+// waitIdle waits for a commit replaying on another goroutine.
+func (m *swBackend) waitIdle() {
+	m.mu.Lock()
+	m.mu.Unlock()
+}
+
+func (m *swBackend) onSubmittedWorkDone(fn func()) {
+	go func() {
+		m.waitIdle()
+		fn()
+	}()
+}
+
+func (m *swBackend) close() error { return nil }
+
+// --- buffers ---
+
+// swBuffer is a buffer's bytes, 4-byte aligned as kernels read them.
+type swBuffer struct{ b []byte }
+
+func (m *swBackend) newBuffer(size int, usage BufferUsage, data []byte) (backendBuffer, error) {
+	words := make([]uint32, (size+3)/4)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)
+	copy(b, data)
+	return &swBuffer{b: b}, nil
+}
+
+func (b *swBuffer) bytes() []byte              { return b.b }
+func (b *swBuffer) read(offset int, p []byte)  { copy(p, b.b[offset:]) }
+func (b *swBuffer) write(offset int, p []byte) { copy(b.b[offset:], p) }
+func (b *swBuffer) release()                   { b.b = nil }
+
+// --- shaders and pipelines ---
+
+type swShaderModule struct{ p *shader.Program }
+
+func (swShaderModule) release() {}
+
+// newShaderModule takes the CPU program of a kernel; the software driver
+// compiles no shader text.
+func (m *swBackend) newShaderModule(src ShaderSource) (backendShaderModule, error) {
+	if src.CPU == nil {
+		return nil, errors.New("gpu/software: a shader module needs a CPU program (ShaderSource.CPU, from shader.CompileCPU)")
+	}
+	return swShaderModule{p: src.CPU}, nil
+}
+
+// swProgram returns the program of mod for a pipeline's entry of stage.
+func swProgram(mod backendShaderModule, entry string, stage shader.Stage) (*shader.Program, error) {
+	p := mod.(swShaderModule).p
+	if entry != "" && entry != p.Name() {
+		return nil, fmt.Errorf("gpu/software: entry %s is not the module's kernel %s", entry, p.Name())
+	}
+	if p.Stage() != stage {
+		return nil, fmt.Errorf("gpu/software: kernel %s is a %s kernel, not a %s one", p.Name(), stageNames[p.Stage()], stageNames[stage])
+	}
+	return p, nil
+}
+
+type swComputePipeline struct {
+	p  *shader.Program
+	wg int // threads per workgroup the kernel declares, or 0
+}
+
+func (*swComputePipeline) release() {}
+
+func (*swComputePipeline) maxThreads() int {
+	return softwareCapabilities.limits.MaxComputeInvocations
+}
+
+func (m *swBackend) newComputePipeline(mod backendShaderModule, entry string, workgroup [3]int) (backendComputePipeline, error) {
+	p, err := swProgram(mod, entry, shader.StageCompute)
+	if err != nil {
+		return nil, err
+	}
+	return &swComputePipeline{p: p, wg: workgroup[0]}, nil
+}
+
+type swRenderPipeline struct {
+	vs, fs *shader.Program
+	state  renderState
+}
+
+func (*swRenderPipeline) release() {}
+
+// newRenderPipeline checks that the fragment kernel takes the varyings the
+// vertex kernel passes. The formats are the pass's to check.
+func (m *swBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat, state renderState) (backendRenderPipeline, error) {
+	vs, err := swProgram(vmod, ventry, shader.StageVertex)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := swProgram(fmod, fentry, shader.StageFragment)
+	if err != nil {
+		return nil, err
+	}
+	if in := fs.Varyings(); len(in) > 0 && !slices.Equal(in, vs.Varyings()) {
+		return nil, fmt.Errorf("gpu/software: fragment kernel %s does not take the varyings vertex kernel %s passes", fs.Name(), vs.Name())
+	}
+	return &swRenderPipeline{vs: vs, fs: fs, state: state}, nil
+}
+
+// --- textures and samplers ---
+
+// swTexture is a texture's texels in its format, one slice per mip level
+// holding the level's layers (or depth slices) one after another. Texel
+// (x, y) of a multisampled texture holds its samples one after another.
+type swTexture struct {
+	desc   TextureDescriptor
+	bpp    int
+	levels [][]byte
+}
+
+func (m *swBackend) newTexture(desc TextureDescriptor) (backendTexture, error) {
+	t := &swTexture{desc: desc, bpp: desc.Format.bytesPerPixel()}
+	for level := range desc.MipLevelCount {
+		w, h, layers := t.size(level)
+		t.levels = append(t.levels, make([]byte, w*h*layers*desc.SampleCount*t.bpp))
+	}
+	return t, nil
+}
+
+func (t *swTexture) release() { t.levels = nil }
+
+// size returns the width, height and layers of mip level.
+func (t *swTexture) size(level int) (w, h, layers int) {
+	layers = t.desc.DepthOrArrayLayers
+	if t.desc.Dimension == TextureDimension3D {
+		layers = mipSize(layers, level)
+	}
+	return mipSize(t.desc.Width, level), mipSize(t.desc.Height, level), layers
+}
+
+// texel returns the bytes of sample s of texel (x, y) of level and layer.
+func (t *swTexture) texel(level, layer, x, y, s int) []byte {
+	w, h, _ := t.size(level)
+	i := (((layer*h+y)*w+x)*t.desc.SampleCount + s) * t.bpp
+	return t.levels[level][i : i+t.bpp]
+}
+
+func (t *swTexture) readPixels() []byte {
+	return t.readLevel(0, 0, t.desc.Width, t.desc.Height)
+}
+
+func (t *swTexture) readLevel(level, layer, w, h int) []byte {
+	n := w * h * t.desc.SampleCount * t.bpp
+	return slices.Clone(t.levels[level][layer*n : (layer+1)*n])
+}
+
+func (t *swTexture) writeLevel(level, layer, w, h int, pixels []byte) {
+	copy(t.levels[level][layer*w*h*t.bpp:], pixels)
+}
+
+func (t *swTexture) generateMipmaps() {
+	d := t.desc
+	(&Texture{b: t, w: d.Width, h: d.Height, format: d.Format, dim: d.Dimension, layers: d.DepthOrArrayLayers, mips: d.MipLevelCount, samples: 1}).generateMipmapsCPU()
+}
+
+type swSampler struct{ desc SamplerDescriptor }
+
+func (*swSampler) isSampler() {}
+
+func (m *swBackend) newSampler(desc SamplerDescriptor) backendSampler { return &swSampler{desc: desc} }
+
+// Sample implements shader.Texture. Without screen-space derivatives there
+// is no anisotropy; lod alone picks the filter, the magnification filter at
+// and below level 0.
+func (t *swTexture) Sample(s shader.Sampler, coord [3]float32, layer int, lod float32) [4]float32 {
+	d := s.(*swSampler).desc
+	u, v, w := coord[0], coord[1], coord[2]
+	switch t.desc.Dimension {
+	case TextureDimensionCube:
+		layer, u, v = cubeFace(coord)
+	case TextureDimension3D:
+		layer = 0
+	default:
+		layer = min(max(layer, 0), t.desc.DepthOrArrayLayers-1)
+	}
+	lod = min(max(lod, d.LodMinClamp), d.LodMaxClamp, float32(t.desc.MipLevelCount-1))
+	filter := d.MinFilter
+	if lod <= 0 {
+		filter = d.MagFilter
+	}
+	if d.MipmapFilter == FilterNearest {
+		return t.filter(d, filter, int(lod+0.5), layer, u, v, w)
+	}
+	lo := int(lod)
+	a := t.filter(d, filter, lo, layer, u, v, w)
+	if f := lod - float32(lo); f > 0 {
+		b := t.filter(d, filter, lo+1, layer, u, v, w)
+		for c := range a {
+			a[c] += (b[c] - a[c]) * f
+		}
+	}
+	return a
+}
+
+// filter reads level at (u, v) of layer, or at (u, v, w) of a 3D texture,
+// with the filter.
+func (t *swTexture) filter(d SamplerDescriptor, filter FilterMode, level, layer int, u, v, w float32) [4]float32 {
+	tw, th, depth := t.size(level)
+	read := func(x, y, z int) [4]float32 {
+		x, y = address(d.AddressU, x, tw), address(d.AddressV, y, th)
+		if t.desc.Dimension == TextureDimension3D {
+			z = address(AddressClampToEdge, z, depth)
+		}
+		return decodeTexel(t.desc.Format, t.texel(level, z, x, y, 0))
+	}
+	if filter == FilterNearest {
+		z := layer
+		if t.desc.Dimension == TextureDimension3D {
+			z = int(floor(w * float32(depth)))
+		}
+		return read(int(floor(u*float32(tw))), int(floor(v*float32(th))), z)
+	}
+	x0, fx := linearTaps(u, tw)
+	y0, fy := linearTaps(v, th)
+	z0, fz, zs := layer, float32(0), 1
+	if t.desc.Dimension == TextureDimension3D {
+		z0, fz = linearTaps(w, depth)
+		zs = 2
+	}
+	var out [4]float32
+	for dz := range zs {
+		wz := 1 - fz
+		if dz == 1 {
+			wz = fz
+		}
+		for dy, wy := range [2]float32{1 - fy, fy} {
+			for dx, wx := range [2]float32{1 - fx, fx} {
+				c := read(x0+dx, y0+dy, z0+dz)
+				for i := range out {
+					out[i] += c[i] * wx * wy * wz
+				}
+			}
+		}
+	}
+	return out
+}
+
+// SampleCompare implements shader.Texture: each texel of level 0 compares
+// as the sampler's Compare function says, and the results filter as the
+// magnification filter does.
+func (t *swTexture) SampleCompare(s shader.Sampler, coord [2]float32, ref float32) float32 {
+	d := s.(*swSampler).desc
+	read := func(x, y int) float32 {
+		x, y = address(d.AddressU, x, t.desc.Width), address(d.AddressV, y, t.desc.Height)
+		if compare(d.Compare, ref, decodeTexel(t.desc.Format, t.texel(0, 0, x, y, 0))[0]) {
+			return 1
+		}
+		return 0
+	}
+	if d.MagFilter == FilterNearest {
+		return read(int(floor(coord[0]*float32(t.desc.Width))), int(floor(coord[1]*float32(t.desc.Height))))
+	}
+	x0, fx := linearTaps(coord[0], t.desc.Width)
+	y0, fy := linearTaps(coord[1], t.desc.Height)
+	return (read(x0, y0)*(1-fx)+read(x0+1, y0)*fx)*(1-fy) + (read(x0, y0+1)*(1-fx)+read(x0+1, y0+1)*fx)*fy
+}
+
+// Load implements shader.Texture. A texel or sample out of range reads 0.
+func (t *swTexture) Load(x, y, sample int) [4]float32 {
+	if x < 0 || y < 0 || sample < 0 || x >= t.desc.Width || y >= t.desc.Height || sample >= t.desc.SampleCount {
+		return [4]float32{}
+	}
+	return decodeTexel(t.desc.Format, t.texel(0, 0, x, y, sample))
+}
+
+func floor(v float32) float32 { return float32(math.Floor(float64(v))) }
+
+// linearTaps returns the first of the two texels a linear filter reads at
+// normalized coordinate u of an extent n texels long, and the weight of the
+// second.
+func linearTaps(u float32, n int) (int, float32) {
+	x := u*float32(n) - 0.5
+	x0 := floor(x)
+	return int(x0), x - x0
+}
+
+// address maps texel i of an extent n texels long into range.
+func address(a AddressMode, i, n int) int {
+	if a == AddressRepeat {
+		return (i%n + n) % n
+	}
+	return min(max(i, 0), n-1)
+}
+
+// cubeFace returns the face a direction points at and the (u, v) it hits,
+// as GL and Metal select them.
+func cubeFace(dir [3]float32) (face int, u, v float32) {
+	x, y, z := dir[0], dir[1], dir[2]
+	ax, ay, az := abs32(x), abs32(y), abs32(z)
+	var sc, tc, ma float32
+	switch {
+	case ax >= ay && ax >= az && x >= 0:
+		face, sc, tc, ma = 0, -z, -y, ax
+	case ax >= ay && ax >= az:
+		face, sc, tc, ma = 1, z, -y, ax
+	case ay >= az && y >= 0:
+		face, sc, tc, ma = 2, x, z, ay
+	case ay >= az:
+		face, sc, tc, ma = 3, x, -z, ay
+	case z >= 0:
+		face, sc, tc, ma = 4, x, -y, az
+	default:
+		face, sc, tc, ma = 5, -x, -y, az
+	}
+	if ma == 0 {
+		return face, 0.5, 0.5
+	}
+	return face, (sc/ma + 1) / 2, (tc/ma + 1) / 2
+}
+
+func abs32(v float32) float32 { return float32(math.Abs(float64(v))) }
+
+// compare reports whether value a passes test f against the stored b.
+func compare(f CompareFunction, a, b float32) bool {
+	switch f {
+	case CompareLess:
+		return a < b
+	case CompareEqual:
+		return a == b
+	case CompareLessEqual:
+		return a <= b
+	case CompareGreater:
+		return a > b
+	case CompareNotEqual:
+		return a != b
+	case CompareGreaterEqual:
+		return a >= b
+	case CompareAlways:
+		return true
+	}
+	return false
+}
+
+// --- queries ---
+
+// swQuerySet holds its values. Timestamps are nanoseconds since the device
+// opened, on the CPU clock the replay runs on; an occlusion query counts the
+// samples that pass, as Metal does.
+type swQuerySet struct{ vals []uint64 }
+
+func (m *swBackend) newQuerySet(typ QueryType, count int) (backendQuerySet, error) {
+	return &swQuerySet{vals: make([]uint64, count)}, nil
+}
+
+func (q *swQuerySet) results(first, count int) ([]uint64, error) {
+	return slices.Clone(q.vals[first : first+count]), nil
+}
+
+func (q *swQuerySet) release() {}
+
+// --- command buffer (record, then replay on commit) ---
+
+// swCmd records commands as closures that replay with the state below,
+// which the commands set and read as a GPU's encoder state. Bindings
+// persist across passes, as GL's do.
+type swCmd struct {
+	m   *swBackend
+	ops []func()
+
+	compute *swComputePipeline
+	bufs    [][]byte // compute kernel buffers, by binding
+	tex     []shader.Texture
+	samp    []shader.Sampler
+
+	pass   *swPass
+	render *swRenderPipeline
+	vbufs  [][]byte // vertex kernel buffers
+	fbufs  [][]byte // fragment kernel buffers
+	index  []byte
+	ifmt   IndexFormat
+	ts     *passTimestamps // of the open pass
+}
+
+func (m *swBackend) newCommandBuffer() backendCommandBuffer { return &swCmd{m: m} }
+
+func (c *swCmd) record(fn func()) { c.ops = append(c.ops, fn) }
+
+// commit replays the command buffer. A command that cannot run, or a kernel
+// that faults (an index out of range), abandons the rest of the buffer and
+// is reported as the device's error instead of crashing the process.
+func (c *swCmd) finish() {}
+
+func (c *swCmd) commit() {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	defer func() {
+		c.ops = nil
+		switch r := recover().(type) {
+		case nil:
+		case *Error:
+			c.m.report(r)
+		case error:
+			c.m.report(&Error{Filter: ErrorFilterInternal, Err: fmt.Errorf("gpu/software: %w", r)})
+		default:
+			c.m.report(&Error{Filter: ErrorFilterInternal, Err: fmt.Errorf("gpu/software: %v", r)})
+		}
+	}()
+	for _, op := range c.ops {
+		op()
+	}
+}
+
+// bind sets slot i of s to v, growing s.
+func bind[T any](s []T, i int, v T) []T {
+	if i >= len(s) {
+		s = append(s, make([]T, i+1-len(s))...)
+	}
+	s[i] = v
+	return s
+}
+
+// bufferAt returns the bytes of buf from offset.
+func bufferAt(buf backendBuffer, offset int) []byte { return buf.(*swBuffer).b[offset:] }
+
+// beginTimestamp and endTimestamp write the open pass's timestamps, if it
+// has any, at replay.
+func (c *swCmd) beginTimestamp(ts *passTimestamps) {
+	c.record(func() {
+		c.ts = ts
+		if ts != nil {
+			ts.set.(*swQuerySet).vals[ts.begin] = uint64(time.Since(c.m.start))
+		}
+	})
+}
+
+func (c *swCmd) endTimestamp() {
+	c.record(func() {
+		if ts := c.ts; ts != nil {
+			ts.set.(*swQuerySet).vals[ts.end] = uint64(time.Since(c.m.start))
+		}
+		c.ts = nil
+	})
+}
+
+// mustBind binds p to its resources. For one missing the replay cannot run
+// the command, and panics with the validation error commit reports.
+func mustBind(p *shader.Program, res shader.Resources) *shader.Bound {
+	b, err := p.Bind(res)
+	if err != nil {
+		panic(&Error{Filter: ErrorFilterValidation, Err: fmt.Errorf("gpu/software: %w", err)})
+	}
+	return b
+}
+
+// --- compute pass ---
+
+func (c *swCmd) beginCompute(ts *passTimestamps) { c.beginTimestamp(ts) }
+
+func (c *swCmd) setComputePipeline(p backendComputePipeline, _ *BindGroupLayout) {
+	c.record(func() { c.compute = p.(*swComputePipeline) })
+}
+
+func (c *swCmd) setBuffer(buf backendBuffer, offset, size, index int, _ BindingKind) {
+	c.record(func() { c.bufs = bind(c.bufs, index, bufferAt(buf, offset)[:size:size]) })
+}
+
+func (c *swCmd) setComputeTexture(index int, t backendTexture) {
+	c.record(func() { c.tex = bind[shader.Texture](c.tex, index, t.(*swTexture)) })
+}
+
+func (c *swCmd) setComputeSampler(index int, s backendSampler) {
+	c.record(func() { c.samp = bind[shader.Sampler](c.samp, index, s.(*swSampler)) })
+}
+
+// dispatch runs x threads, or whole workgroups covering them for a kernel
+// that declares its size. Kernels index one dimension; as on GL, y and z
+// add none.
+func (c *swCmd) dispatch(x, y, z int) {
+	c.record(func() { c.run(x) })
+}
+
+// dispatchIndirect runs the x workgroup count at offset of buf.
+func (c *swCmd) dispatchIndirect(buf backendBuffer, offset int) {
+	c.record(func() {
+		n := int(binary.LittleEndian.Uint32(bufferAt(buf, offset)))
+		c.run(n * max(c.compute.wg, 1))
+	})
+}
+
+func (c *swCmd) run(n int) {
+	p := c.compute
+	mustBind(p.p, shader.Resources{Buffers: c.bufs, Textures: c.tex, Samplers: c.samp}).Dispatch(n, p.wg)
+}
+
+func (c *swCmd) endCompute() { c.endTimestamp() }
+
+// --- render pass ---
+
+// swPass is an open render pass.
+type swPass struct {
+	w, h, samples int
+	color         []*swTexture // attachments 0..N
+	resolve       []*swTexture // their resolve targets, or nil
+	depth         *swTexture
+	occlusion     *swQuerySet
+	query         int // the open occlusion query, or -1
+}
+
+// samplePositions are the sample positions within a pixel, by sample count:
+// the center, or the standard 4x pattern Metal, D3D and Vulkan share.
+var samplePositions = map[int][][2]float64{
+	1: {{0.5, 0.5}},
+	4: {{0.375, 0.125}, {0.875, 0.375}, {0.125, 0.625}, {0.625, 0.875}},
+}
+
+func (c *swCmd) beginRender(info renderPassInfo) {
+	c.beginTimestamp(info.timestamps)
+	c.record(func() {
+		color := info.color.(*swTexture)
+		p := &swPass{w: color.desc.Width, h: color.desc.Height, samples: info.samples, query: -1}
+		add := func(t, resolve backendTexture, clear [4]float64) {
+			tex := t.(*swTexture)
+			p.color = append(p.color, tex)
+			r, _ := resolve.(*swTexture)
+			p.resolve = append(p.resolve, r)
+			if info.load == LoadClear {
+				fill(tex, [4]float32{float32(clear[0]), float32(clear[1]), float32(clear[2]), float32(clear[3])})
+			}
+		}
+		add(info.color, info.resolve, info.clearColor)
+		for _, t := range info.extraColor {
+			add(t.tex, t.resolve, t.clear)
+		}
+		if info.depth != nil {
+			p.depth = info.depth.(*swTexture)
+			fill(p.depth, [4]float32{float32(info.clearDepth)})
+		}
+		if info.occlusion != nil {
+			p.occlusion = info.occlusion.(*swQuerySet)
+		}
+		c.pass = p
+	})
+}
+
+// fill sets every texel of level 0 of t to v.
+func fill(t *swTexture, v [4]float32) {
+	px := appendTexel(t.desc.Format, nil, v)
+	data := t.levels[0]
+	for i := 0; i < len(data); i += len(px) {
+		copy(data[i:], px)
+	}
+}
+
+func (c *swCmd) setRenderPipeline(p backendRenderPipeline, _ *BindGroupLayout) {
+	c.record(func() { c.render = p.(*swRenderPipeline) })
+}
+
+func (c *swCmd) setRenderBuffer(buf backendBuffer, offset, size, index int, _ BindingKind) {
+	c.record(func() { c.fbufs = bind(c.fbufs, index, bufferAt(buf, offset)[:size:size]) })
+}
+
+func (c *swCmd) setVertexBuffer(buf backendBuffer, offset, size, index int) {
+	c.record(func() { c.vbufs = bind(c.vbufs, index, bufferAt(buf, offset)[:size:size]) })
+}
+
+func (c *swCmd) setIndexBuffer(buf backendBuffer, offset int, format IndexFormat) {
+	c.record(func() { c.index, c.ifmt = bufferAt(buf, offset), format })
+}
+
+func (c *swCmd) draw(prim Primitive, start, count, firstInstance, instanceCount int) {
+	c.record(func() { c.drawVertices(prim, sequence(start, count), firstInstance, instanceCount) })
+}
+
+func (c *swCmd) drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int) {
+	c.record(func() { c.drawVertices(prim, c.indices(firstIndex, count, baseVertex), firstInstance, instanceCount) })
+}
+
+func (c *swCmd) drawIndirect(prim Primitive, buf backendBuffer, offset int) {
+	c.record(func() {
+		a := indirectArgs(bufferAt(buf, offset), 4)
+		c.drawVertices(prim, sequence(int(a[2]), int(a[0])), int(a[3]), int(a[1]))
+	})
+}
+
+func (c *swCmd) drawIndexedIndirect(prim Primitive, buf backendBuffer, offset int) {
+	c.record(func() {
+		a := indirectArgs(bufferAt(buf, offset), 5)
+		c.drawVertices(prim, c.indices(int(a[2]), int(a[0]), int(int32(a[3]))), int(a[4]), int(a[1]))
+	})
+}
+
+// indirectArgs reads the n uint32 arguments of an indirect command.
+func indirectArgs(b []byte, n int) []uint32 {
+	a := make([]uint32, n)
+	for i := range a {
+		a[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return a
+}
+
+// sequence returns the vertex ids start to start+count-1.
+func sequence(start, count int) []uint32 {
+	ids := make([]uint32, count)
+	for i := range ids {
+		ids[i] = uint32(start + i)
+	}
+	return ids
+}
+
+// indices returns the vertex ids of count elements of the index buffer from
+// element first, with base added.
+func (c *swCmd) indices(first, count, base int) []uint32 {
+	ids := make([]uint32, count)
+	for i := range ids {
+		var v uint32
+		if c.ifmt == IndexUint32 {
+			v = binary.LittleEndian.Uint32(c.index[(first+i)*4:])
+		} else {
+			v = uint32(binary.LittleEndian.Uint16(c.index[(first+i)*2:]))
+		}
+		ids[i] = v + uint32(base)
+	}
+	return ids
+}
+
+func (c *swCmd) beginOcclusionQuery(index int) {
+	c.record(func() {
+		c.pass.query = index
+		c.pass.occlusion.vals[index] = 0
+	})
+}
+
+func (c *swCmd) endOcclusionQuery() {
+	c.record(func() { c.pass.query = -1 })
+}
+
+// endRender resolves the multisampled attachments, each resolved texel the
+// average of its samples.
+func (c *swCmd) endRender() {
+	c.record(func() {
+		p := c.pass
+		for i, r := range p.resolve {
+			if r == nil {
+				continue
+			}
+			src, f := p.color[i], r.desc.Format
+			for y := range p.h {
+				for x := range p.w {
+					var sum [4]float32
+					for s := range p.samples {
+						v := decodeTexel(f, src.texel(0, 0, x, y, s))
+						for k := range sum {
+							sum[k] += v[k] / float32(p.samples)
+						}
+					}
+					appendTexel(f, r.texel(0, 0, x, y, 0)[:0], sum)
+				}
+			}
+		}
+		c.pass = nil
+	})
+	c.endTimestamp()
+}
+
+// --- copies ---
+
+func (c *swCmd) copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int) {
+	c.record(func() { copy(bufferAt(dst, dstOffset)[:size], bufferAt(src, srcOffset)) })
+}
+
+func (c *swCmd) copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int) {
+	c.record(func() {
+		t := dst.(*swTexture)
+		b := bufferAt(src, offset)
+		for r := range h {
+			copy(t.row(x, y+r, w), b[r*bytesPerRow:])
+		}
+	})
+}
+
+func (c *swCmd) copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int) {
+	c.record(func() {
+		t := src.(*swTexture)
+		b := bufferAt(dst, offset)
+		for r := range h {
+			copy(b[r*bytesPerRow:], t.row(x, y+r, w))
+		}
+	})
+}
+
+func (c *swCmd) copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int) {
+	c.record(func() {
+		s, d := src.(*swTexture), dst.(*swTexture)
+		for r := range h {
+			copy(d.row(dx, dy+r, w), s.row(sx, sy+r, w))
+		}
+	})
+}
+
+// row returns the bytes of w texels of level 0 from (x, y).
+func (t *swTexture) row(x, y, w int) []byte {
+	i := (y*t.desc.Width + x) * t.bpp
+	return t.levels[0][i : i+w*t.bpp]
+}
+
+// --- rasterizer ---
+
+// swVertex is a vertex a vertex kernel output: its clip-space position and
+// varyings.
+type swVertex struct {
+	clip [4]float32
+	vary []float32
+}
+
+// swPoint is a vertex of a primitive in window coordinates: x and y in
+// pixels from the target's top left, snapped to 1/256 of a pixel as GPUs
+// snap them, depth z and 1/w.
+type swPoint struct {
+	x, y, z, invw float64
+	vary          []float32
+}
+
+// swPrim is a point, line or triangle to rasterize. Vertex 0 is the
+// provoking vertex, whose flat varyings the primitive takes.
+type swPrim struct {
+	n          int
+	v          [3]swPoint
+	ymin, ymax int // the rows it may cover
+}
+
+// drawVertices draws instanceCount instances of the primitives of the
+// vertices ids names, in order.
+func (c *swCmd) drawVertices(prim Primitive, ids []uint32, firstInstance, instanceCount int) {
+	rp, p := c.render, c.pass
+	vs := mustBind(rp.vs, shader.Resources{Buffers: c.vbufs})
+	fs := mustBind(rp.fs, shader.Resources{Buffers: c.fbufs})
+	flat := rp.vs.Varyings()
+
+	// Each distinct vertex runs the vertex kernel once per instance.
+	slot := map[uint32]int{}
+	var uniq []uint32
+	refs := make([]int, len(ids))
+	for i, id := range ids {
+		s, ok := slot[id]
+		if !ok {
+			s = len(uniq)
+			slot[id] = s
+			uniq = append(uniq, id)
+		}
+		refs[i] = s
+	}
+	var prims []swPrim
+	verts := make([]swVertex, len(uniq))
+	for inst := firstInstance; inst < firstInstance+instanceCount; inst++ {
+		parallel(len(uniq), func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				v := &verts[i]
+				v.vary = make([]float32, len(flat))
+				v.clip = vs.Vertex(uniq[i], uint32(inst), v.vary)
+			}
+		})
+		prims = p.assemble(prims, prim, verts, refs, flat, rp.state)
+	}
+	if len(rp.fs.Varyings()) == 0 {
+		flat = nil // the fragment kernel takes none
+	}
+	p.raster(prims, fs, rp.state, flat)
+}
+
+// parallel calls fn on ranges splitting 0 to n-1 across the CPUs.
+func parallel(n int, fn func(lo, hi int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(n*w/workers, n*(w+1)/workers)
+	}
+	wg.Wait()
+}
+
+// assemble appends the primitives of prim the vertices verts[refs[i]]
+// form, clipped to the depth range and culled.
+func (p *swPass) assemble(prims []swPrim, prim Primitive, verts []swVertex, refs []int, flat []bool, st renderState) []swPrim {
+	v := func(i int) swVertex { return verts[refs[i]] }
+	switch prim {
+	case PointList:
+		for i := range refs {
+			prims = p.clipPoints(prims, []swVertex{v(i)}, flat, st)
+		}
+	case LineList:
+		for i := 0; i+1 < len(refs); i += 2 {
+			prims = p.clipPoints(prims, []swVertex{v(i), v(i + 1)}, flat, st)
+		}
+	case TriangleList:
+		for i := 0; i+2 < len(refs); i += 3 {
+			prims = p.clipPoints(prims, []swVertex{v(i), v(i + 1), v(i + 2)}, flat, st)
+		}
+	case TriangleStrip:
+		// Odd triangles swap their last two vertices, keeping the winding
+		// of the strip and the first vertex provoking.
+		for i := 0; i+2 < len(refs); i++ {
+			tri := []swVertex{v(i), v(i + 1), v(i + 2)}
+			if i%2 == 1 {
+				tri[1], tri[2] = tri[2], tri[1]
+			}
+			prims = p.clipPoints(prims, tri, flat, st)
+		}
+	}
+	return prims
+}
+
+// clipPoints clips a primitive of one to three vertices to the depth range
+// 0 <= z <= w and appends what remains, in window coordinates. The x and y
+// extents need no clipping: rasterization covers only the target.
+func (p *swPass) clipPoints(prims []swPrim, vs []swVertex, flat []bool, st renderState) []swPrim {
+	inside := func(v swVertex) bool { return v.clip[2] >= 0 && v.clip[2] <= v.clip[3] && v.clip[3] > 0 }
+	if !inside(vs[0]) || len(vs) > 1 && !inside(vs[1]) || len(vs) > 2 && !inside(vs[2]) {
+		if len(vs) == 1 {
+			return prims
+		}
+		vs = clipDepth(vs, flat)
+		if len(vs) < 2 {
+			return prims
+		}
+	}
+	pts := make([]swPoint, len(vs))
+	for i, v := range vs {
+		pts[i] = p.window(v)
+	}
+	if len(pts) < 3 {
+		return append(prims, p.prim(pts...))
+	}
+	for i := 1; i+1 < len(pts); i++ {
+		if t := p.prim(pts[0], pts[i], pts[i+1]); t.visible(st) {
+			prims = append(prims, t)
+		}
+	}
+	return prims
+}
+
+// clipDepth clips the line or convex polygon vs against the planes z = 0
+// and z = w, in clip space where varyings interpolate linearly. New
+// vertices take flat varyings from vs[0], the provoking vertex.
+func clipDepth(vs []swVertex, flat []bool) []swVertex {
+	closed := len(vs) > 2
+	for _, dist := range []func(v swVertex) float32{
+		func(v swVertex) float32 { return v.clip[2] },
+		func(v swVertex) float32 { return v.clip[3] - v.clip[2] },
+	} {
+		var out []swVertex
+		n := len(vs)
+		if !closed {
+			n = 1
+		}
+		for i := range n {
+			a, b := vs[i], vs[(i+1)%len(vs)]
+			da, db := dist(a), dist(b)
+			if da >= 0 {
+				out = append(out, a)
+			}
+			if (da >= 0) != (db >= 0) {
+				out = append(out, lerpVertex(a, b, da/(da-db), vs[0], flat))
+			}
+			if !closed && db >= 0 {
+				out = append(out, b)
+			}
+		}
+		vs = out
+		if len(vs) < 2 {
+			return nil
+		}
+	}
+	return vs
+}
+
+// lerpVertex returns the vertex t of the way from a to b, its flat
+// varyings those of provoking.
+func lerpVertex(a, b swVertex, t float32, provoking swVertex, flat []bool) swVertex {
+	v := swVertex{vary: make([]float32, len(a.vary))}
+	for i := range v.clip {
+		v.clip[i] = a.clip[i] + (b.clip[i]-a.clip[i])*t
+	}
+	for i := range v.vary {
+		if flat[i] {
+			v.vary[i] = provoking.vary[i]
+		} else {
+			v.vary[i] = a.vary[i] + (b.vary[i]-a.vary[i])*t
+		}
+	}
+	return v
+}
+
+// window maps a clip-space vertex to the pass's window coordinates.
+func (p *swPass) window(v swVertex) swPoint {
+	w := float64(v.clip[3])
+	snap := func(f float64) float64 { return math.Round(f*256) / 256 }
+	return swPoint{
+		x:    snap((float64(v.clip[0])/w + 1) / 2 * float64(p.w)),
+		y:    snap((1 - float64(v.clip[1])/w) / 2 * float64(p.h)),
+		z:    float64(v.clip[2]) / w,
+		invw: 1 / w,
+		vary: v.vary,
+	}
+}
+
+// prim returns the primitive of pts, with the rows it may cover.
+func (p *swPass) prim(pts ...swPoint) swPrim {
+	t := swPrim{n: len(pts), ymin: p.h, ymax: -1}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i, v := range pts {
+		t.v[i] = v
+		lo, hi = min(lo, v.y), max(hi, v.y)
+	}
+	t.ymin = int(max(math.Floor(lo)-1, 0))
+	t.ymax = int(min(math.Ceil(hi)+1, float64(p.h-1)))
+	return t
+}
+
+// area is twice the signed area of a triangle in window coordinates, whose
+// y axis points down: it is negative for a counter-clockwise triangle in
+// normalized device coordinates.
+func (t *swPrim) area() float64 {
+	a, b, c := t.v[0], t.v[1], t.v[2]
+	return (b.x-a.x)*(c.y-a.y) - (c.x-a.x)*(b.y-a.y)
+}
+
+// visible reports whether a triangle has area and is not culled.
+func (t *swPrim) visible(st renderState) bool {
+	a := t.area()
+	if a == 0 || math.IsNaN(a) {
+		return false
+	}
+	front := (a < 0) == (st.frontFace == FrontCCW)
+	return !(st.cull == CullBack && !front || st.cull == CullFront && front)
+}
+
+// swEdge is the edge function of a triangle edge, positive inside. Its
+// endpoints are taken in a canonical order, so the two triangles sharing an
+// edge compute the same values, negated.
+type swEdge struct{ ax, ay, dx, dy, s float64 }
+
+func newEdge(a, b swPoint, s float64) swEdge {
+	if a.x > b.x || a.x == b.x && a.y > b.y {
+		a, b, s = b, a, -s
+	}
+	return swEdge{a.x, a.y, b.x - a.x, b.y - a.y, s}
+}
+
+func (e swEdge) at(x, y float64) float64 { return e.s * (e.dx*(y-e.ay) - e.dy*(x-e.ax)) }
+
+// covers reports whether a sample whose edge value is v is inside. A sample
+// on the edge is inside one of the two triangles sharing it: the one its
+// inward normal points right (or down) into.
+func (e swEdge) covers(v float64) bool {
+	if v != 0 {
+		return v > 0
+	}
+	nx, ny := -e.dy*e.s, e.dx*e.s
+	return nx > 0 || nx == 0 && ny > 0
+}
+
+// swFrag is the fragment being drawn: the samples it covers and their
+// depths, its window position, its varyings and their derivatives, and its
+// colors.
+type swFrag struct {
+	mask     uint8
+	depth    [4]float32
+	pos      [4]float32
+	vary     []float32
+	ddx, ddy []float32
+	colors   [][4]float32
+}
+
+// raster draws prims into the pass with the fragment kernel fs, which
+// takes the varyings flat describes. The target is cut into bands of rows
+// that workers draw in parallel, each going through the primitives in
+// order, so a pixel sees them in order and blends as on a GPU.
+func (p *swPass) raster(prims []swPrim, fs *shader.Bound, st renderState, flat []bool) {
+	const band = 16
+	nbands := (p.h + band - 1) / band
+	var (
+		next   atomic.Int64
+		passed atomic.Uint64
+		wg     sync.WaitGroup
+	)
+	for range min(runtime.GOMAXPROCS(0), nbands) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := swRaster{p: p, fs: fs, st: st, flat: flat, frag: swFrag{
+				vary:   make([]float32, len(flat)),
+				colors: make([][4]float32, fs.Program().Targets()),
+			}}
+			if fs.Program().Derivatives() {
+				r.frag.ddx, r.frag.ddy = make([]float32, len(flat)), make([]float32, len(flat))
+			}
+			for {
+				b := int(next.Add(1) - 1)
+				if b >= nbands {
+					break
+				}
+				r.y0, r.y1 = b*band, min((b+1)*band, p.h)
+				for i := range prims {
+					if t := &prims[i]; t.ymax >= r.y0 && t.ymin < r.y1 {
+						r.draw(t)
+					}
+				}
+			}
+			passed.Add(r.passed)
+		}()
+	}
+	wg.Wait()
+	if p.query >= 0 {
+		p.occlusion.vals[p.query] += passed.Load()
+	}
+}
+
+// swRaster draws primitives into rows y0 to y1-1 of a pass.
+type swRaster struct {
+	p      *swPass
+	fs     *shader.Bound
+	st     renderState
+	flat   []bool // the varyings the fragment kernel takes
+	y0, y1 int
+	passed uint64 // samples that passed the depth test
+	frag   swFrag
+}
+
+func (r *swRaster) draw(t *swPrim) {
+	switch t.n {
+	case 1:
+		r.point(t)
+	case 2:
+		r.line(t)
+	default:
+		r.triangle(t)
+	}
+}
+
+func (r *swRaster) triangle(t *swPrim) {
+	p, v := r.p, &t.v
+	a := t.area()
+	s := math.Copysign(1, a)
+	e := [3]swEdge{newEdge(v[1], v[2], s), newEdge(v[2], v[0], s), newEdge(v[0], v[1], s)}
+	area := math.Abs(a)
+	x0 := int(max(math.Floor(min(v[0].x, v[1].x, v[2].x)), 0))
+	x1 := int(min(math.Ceil(max(v[0].x, v[1].x, v[2].x)), float64(p.w-1)))
+	y0 := int(max(math.Floor(min(v[0].y, v[1].y, v[2].y)), float64(r.y0)))
+	y1 := int(min(math.Ceil(max(v[0].y, v[1].y, v[2].y)), float64(r.y1-1)))
+	pos := samplePositions[p.samples]
+	f := &r.frag
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			f.mask = 0
+			for i, o := range pos {
+				sx, sy := float64(x)+o[0], float64(y)+o[1]
+				w0, w1, w2 := e[0].at(sx, sy), e[1].at(sx, sy), e[2].at(sx, sy)
+				if e[0].covers(w0) && e[1].covers(w1) && e[2].covers(w2) {
+					f.mask |= 1 << i
+					f.depth[i] = float32((w0*v[0].z + w1*v[1].z + w2*v[2].z) / area)
+				}
+			}
+			if f.mask == 0 {
+				continue
+			}
+			// The barycentrics at the pixel center, and at the centers
+			// right of and below it for the derivatives.
+			var l [3][3]float64
+			for i, o := range [3][2]float64{{0.5, 0.5}, {1.5, 0.5}, {0.5, 1.5}} {
+				cx, cy := float64(x)+o[0], float64(y)+o[1]
+				l[i] = [3]float64{e[0].at(cx, cy) / area, e[1].at(cx, cy) / area, e[2].at(cx, cy) / area}
+			}
+			r.fragment(t, x, y, l)
+		}
+	}
+}
+
+// line draws a line one fragment per pixel along its major axis, at the
+// pixel centers from its start up to, not including, its end.
+func (r *swRaster) line(t *swPrim) {
+	a, b := t.v[0], t.v[1]
+	dx, dy := b.x-a.x, b.y-a.y
+	major, start := dx, a.x
+	pixel := func(i int, u float64) (int, int) { return i, int(math.Floor(a.y + u*dy)) }
+	if math.Abs(dy) > math.Abs(dx) {
+		major, start = dy, a.y
+		pixel = func(i int, u float64) (int, int) { return int(math.Floor(a.x + u*dx)), i }
+	}
+	if major == 0 {
+		return
+	}
+	lo, hi := math.Min(start, start+major), math.Max(start, start+major)
+	for i := int(math.Ceil(lo - 0.5)); float64(i)+0.5 < hi; i++ {
+		u := (float64(i) + 0.5 - start) / major
+		if u < 0 || u >= 1 {
+			continue
+		}
+		x, y := pixel(i, u)
+		if x < 0 || x >= r.p.w || y < r.y0 || y >= r.y1 {
+			continue
+		}
+		r.cover(t, x, y, [3]float64{1 - u, u, 0})
+	}
+}
+
+func (r *swRaster) point(t *swPrim) {
+	x, y := int(math.Floor(t.v[0].x)), int(math.Floor(t.v[0].y))
+	if x < 0 || x >= r.p.w || y < r.y0 || y >= r.y1 {
+		return
+	}
+	r.cover(t, x, y, [3]float64{1, 0, 0})
+}
+
+// cover draws a fragment of a point or line, which covers every sample of
+// its pixel at the depth at l. Its varyings have no derivatives.
+func (r *swRaster) cover(t *swPrim, x, y int, l [3]float64) {
+	f := &r.frag
+	f.mask = uint8(1)<<r.p.samples - 1
+	z := float32(l[0]*t.v[0].z + l[1]*t.v[1].z + l[2]*t.v[2].z)
+	for i := range r.p.samples {
+		f.depth[i] = z
+	}
+	r.fragment(t, x, y, [3][3]float64{l, l, l})
+}
+
+// fragment depth-tests the samples of the fragment at (x, y) in r.frag,
+// whose barycentric coordinates at the pixel center are l[0], then shades
+// it and writes the samples that pass. The varyings' derivatives are their
+// differences to the centers right of and below it, at l[1] and l[2], as
+// a GPU takes them across a quad of fragments.
+func (r *swRaster) fragment(t *swPrim, x, y int, l [3][3]float64) {
+	p, f, st := r.p, &r.frag, r.st
+	base := (y*p.w + x) * p.samples
+	if d := p.depth; d != nil {
+		for s := range p.samples {
+			if f.mask&(1<<s) == 0 {
+				continue
+			}
+			px := d.levels[0][(base+s)*d.bpp:][:4]
+			stored := math.Float32frombits(binary.LittleEndian.Uint32(px))
+			if !compare(st.depthCompare, f.depth[s], stored) {
+				f.mask &^= 1 << s
+				continue
+			}
+			if st.depthWrite {
+				binary.LittleEndian.PutUint32(px, math.Float32bits(f.depth[s]))
+			}
+		}
+	}
+	for m := f.mask; m != 0; m &= m - 1 {
+		r.passed++
+	}
+	if f.mask == 0 || st.colorWrite == 0 {
+		return
+	}
+
+	v := &t.v
+	l0 := l[0]
+	invw := r.interpolate(t, l0, f.vary)
+	f.pos = [4]float32{float32(x) + 0.5, float32(y) + 0.5, float32(l0[0]*v[0].z + l0[1]*v[1].z + l0[2]*v[2].z), float32(invw)}
+	for k, d := range [2][]float32{f.ddx, f.ddy} {
+		if d == nil {
+			continue
+		}
+		r.interpolate(t, l[1+k], d)
+		for i := range d {
+			if r.flat[i] {
+				d[i] = 0
+			} else {
+				d[i] -= f.vary[i]
+			}
+		}
+	}
+	r.fs.Fragment(f.pos, f.vary, f.ddx, f.ddy, f.colors)
+
+	// Each color the kernel returns goes to the attachment at its index; a
+	// unorm target clamps it before blending.
+	for a, src := range f.colors[:min(len(f.colors), len(p.color))] {
+		tex := p.color[a]
+		format := tex.desc.Format
+		if format != RGBA32Float && format != R32Float && format != RGBA16Float && format != RG16Float {
+			for i := range src {
+				src[i] = min(max(src[i], 0), 1)
+			}
+		}
+		var b *BlendState
+		if a < len(st.blend) {
+			b = st.blend[a]
+		}
+		for s := range p.samples {
+			if f.mask&(1<<s) == 0 {
+				continue
+			}
+			px := tex.levels[0][(base+s)*tex.bpp:][:tex.bpp]
+			out := src
+			if b != nil || st.colorWrite != ColorWriteAll {
+				dst := decodeTexel(format, px)
+				if b != nil {
+					out = blend(b, src, dst)
+				}
+				for i := range out {
+					if st.colorWrite&(1<<i) == 0 {
+						out[i] = dst[i]
+					}
+				}
+			}
+			appendTexel(format, px[:0], out)
+		}
+	}
+}
+
+// interpolate stores in vary the varyings of t at barycentric coordinates
+// l and returns 1/w there. Varyings interpolate in perspective: linearly in
+// clip space; flat ones are the first vertex's.
+func (r *swRaster) interpolate(t *swPrim, l [3]float64, vary []float32) float64 {
+	v := &t.v
+	invw := l[0]*v[0].invw + l[1]*v[1].invw + l[2]*v[2].invw
+	q := [3]float64{l[0] * v[0].invw / invw, l[1] * v[1].invw / invw, l[2] * v[2].invw / invw}
+	for i, flat := range r.flat {
+		val := float64(v[0].vary[i])
+		if !flat {
+			val *= q[0]
+			for k := 1; k < t.n; k++ {
+				val += q[k] * float64(v[k].vary[i])
+			}
+		}
+		vary[i] = float32(val)
+	}
+	return invw
+}
+
+// blend combines a fragment's color src with the stored dst as b says.
+func blend(b *BlendState, src, dst [4]float32) [4]float32 {
+	var out [4]float32
+	for i := range out {
+		c := b.Color
+		if i == 3 {
+			c = b.Alpha
+		}
+		s := src[i] * blendFactor(c.SrcFactor, src, dst, i)
+		d := dst[i] * blendFactor(c.DstFactor, src, dst, i)
+		switch c.Operation {
+		case BlendOpSubtract:
+			out[i] = s - d
+		case BlendOpReverseSubtract:
+			out[i] = d - s
+		case BlendOpMin:
+			out[i] = min(src[i], dst[i])
+		case BlendOpMax:
+			out[i] = max(src[i], dst[i])
+		default:
+			out[i] = s + d
+		}
+	}
+	return out
+}
+
+// blendFactor is factor f of channel i.
+func blendFactor(f BlendFactor, src, dst [4]float32, i int) float32 {
+	switch f {
+	case BlendOne:
+		return 1
+	case BlendSrc:
+		return src[i]
+	case BlendOneMinusSrc:
+		return 1 - src[i]
+	case BlendSrcAlpha:
+		return src[3]
+	case BlendOneMinusSrcAlpha:
+		return 1 - src[3]
+	case BlendDst:
+		return dst[i]
+	case BlendOneMinusDst:
+		return 1 - dst[i]
+	case BlendDstAlpha:
+		return dst[3]
+	case BlendOneMinusDstAlpha:
+		return 1 - dst[3]
+	}
+	return 0
+}
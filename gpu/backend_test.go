@@ -0,0 +1,29 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"go/token"
+	"testing"
+)
+
+// TestGoPositions checks the driver log formats goPositions understands.
+func TestGoPositions(t *testing.T) {
+	lines := make([]token.Position, 12)
+	lines[11] = token.Position{Filename: "shade.go", Line: 40, Column: 3}
+	for _, tc := range []struct{ log, want string }{
+		{"program_source:12:9: error: use of undeclared identifier 'x'", "shade.go:40:3: program_source:12:9: error: use of undeclared identifier 'x'"},
+		{"0:12(5): error: `x' undeclared", "shade.go:40:3: 0:12(5): error: `x' undeclared"},
+		{"0(12) : error C1008: undefined variable \"x\"", "shade.go:40:3: 0(12) : error C1008: undefined variable \"x\""},
+		{"ERROR: 0:12: 'x' : undeclared identifier", "shade.go:40:3: ERROR: 0:12: 'x' : undeclared identifier"},
+		{"0:3(1): error: no Go position", "0:3(1): error: no Go position"},
+		{"0:99(1): error: past the table", "0:99(1): error: past the table"},
+		{"error: no line", "error: no line"},
+	} {
+		if got := goPositions(tc.log, lines); got != tc.want {
+			t.Errorf("goPositions(%q) = %q, want %q", tc.log, got, tc.want)
+		}
+	}
+}
@@ -8,13 +8,23 @@
 // gpu/vk*_linux_test.go probes) behind the private backend interface, so
 // gpu.Open(WithDriver(DriverVulkan)) is a first-class driver alongside Metal and
 // GL. Vulkan is reached through purego (no cgo). Shader modules consume SPIR-V
-// (ShaderSource.SPIRV); a Go->SPIR-V emitter is a follow-up, so callers compile
-// their GLSL to SPIR-V (e.g. with glslang) today. Compute only; render is a
-// follow-up. Verified in CI on Mesa lavapipe.
+// (ShaderSource.SPIRV), which shader.CompileSPIRV emits from the same Go
+// kernels the Metal and GL backends run. Compute and render (a
+// VkRenderPass + framebuffer per pass, depth and MRT attachments) both run
+// through it. Verified in CI on Mesa lavapipe.
+//
+// Every image lives in VK_IMAGE_LAYOUT_GENERAL from creation on, so passes,
+// copies and readbacks need no layout transitions, only the memory barrier
+// commit puts between commands. The viewport is the GL one (NDC y = -1 at
+// image row 0), so render targets are stored bottom-up exactly as on the GL
+// backend, and readPixels flips them the same way.
 package gpu
 
 import (
 	"fmt"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"unsafe"
 
@@ -33,6 +43,20 @@ type (
 		enabledExtensionCount, _ uint32
 		ppEnabledExtensionNames  uintptr
 	}
+	vkDebugUtilsMessengerCreateInfoB struct {
+		sType, _                     uint32
+		pNext                        uintptr
+		flags, severity, typeBits, _ uint32
+		callback, userData           uintptr
+	}
+	vkDebugUtilsMessengerCallbackDataB struct {
+		sType, _           uint32
+		pNext              uintptr
+		flags, _           uint32
+		pMessageIDName     uintptr
+		messageIDNumber, _ int32
+		pMessage           uintptr
+	}
 	vkDeviceQueueCreateInfoB struct {
 		sType                             uint32
 		pNext                             uintptr
@@ -152,6 +176,187 @@ type (
 		flags uint32
 		pInh  uintptr
 	}
+	vkMemoryBarrierB struct {
+		sType                uint32
+		pNext                uintptr
+		srcAccess, dstAccess uint32
+	}
+	vkBufferCopyB       struct{ srcOffset, dstOffset, size uint64 }
+	vkSubresourceRangeB struct {
+		aspectMask, baseMipLevel, levelCount, baseArrayLayer, layerCount uint32
+	}
+	vkSubresourceLayersB struct {
+		aspectMask, mipLevel, baseArrayLayer, layerCount uint32
+	}
+	vkImageCreateInfoB struct {
+		sType                                                          uint32
+		pNext                                                          uintptr
+		flags, imageType, format                                       uint32
+		width, height, depth                                           uint32
+		mipLevels, arrayLayers, samples, tiling, usage, sharingMode, _ uint32
+		pQFI                                                           uintptr
+		initialLayout                                                  uint32
+	}
+	vkImageViewCreateInfoB struct {
+		sType            uint32
+		pNext            uintptr
+		flags            uint32
+		image            uintptr
+		viewType, format uint32
+		components       [4]uint32
+		rng              vkSubresourceRangeB
+	}
+	vkImageMemoryBarrierB struct {
+		sType                            uint32
+		pNext                            uintptr
+		srcAccess, dstAccess             uint32
+		oldLayout, newLayout, srcQ, dstQ uint32
+		image                            uintptr
+		rng                              vkSubresourceRangeB
+	}
+	vkBufferImageCopyB struct {
+		bufferOffset                 uint64
+		bufferRowLength, imageHeight uint32
+		sub                          vkSubresourceLayersB
+		x, y, z                      int32
+		w, h, d                      uint32
+	}
+	vkImageCopyB struct {
+		srcSub     vkSubresourceLayersB
+		sx, sy, sz int32
+		dstSub     vkSubresourceLayersB
+		dx, dy, dz int32
+		w, h, d    uint32
+	}
+	vkImageBlitB struct {
+		srcSub     vkSubresourceLayersB
+		srcOffsets [2][3]int32
+		dstSub     vkSubresourceLayersB
+		dstOffsets [2][3]int32
+	}
+	vkAttachmentDescriptionB struct {
+		flags, format, samples, loadOp, storeOp, stencilLoadOp, stencilStoreOp, initialLayout, finalLayout uint32
+	}
+	vkAttachmentReferenceB struct{ attachment, layout uint32 }
+	vkSubpassDescriptionB  struct {
+		flags, bindPoint, inputCount uint32
+		pInput                       uintptr
+		colorCount                   uint32
+		pColor, pResolve, pDepth     uintptr
+		preserveCount                uint32
+		pPreserve                    uintptr
+	}
+	vkRenderPassCreateInfoB struct {
+		sType                  uint32
+		pNext                  uintptr
+		flags, attachmentCount uint32
+		pAttachments           uintptr
+		subpassCount           uint32
+		pSubpasses             uintptr
+		dependencyCount        uint32
+		pDependencies          uintptr
+	}
+	vkFramebufferCreateInfoB struct {
+		sType                 uint32
+		pNext                 uintptr
+		flags                 uint32
+		renderPass            uintptr
+		attachmentCount       uint32
+		pAttachments          uintptr
+		width, height, layers uint32
+	}
+	vkRenderPassBeginInfoB struct {
+		sType                   uint32
+		pNext                   uintptr
+		renderPass, framebuffer uintptr
+		x, y                    int32
+		w, h                    uint32
+		clearValueCount         uint32
+		pClearValues            uintptr
+	}
+	vkViewportB struct{ x, y, width, height, minDepth, maxDepth float32 }
+	vkRect2DB   struct {
+		x, y int32
+		w, h uint32
+	}
+	vkPipelineVertexInputStateB struct {
+		sType               uint32
+		pNext               uintptr
+		flags, bindingCount uint32
+		pBindings           uintptr
+		attrCount           uint32
+		pAttrs              uintptr
+	}
+	vkPipelineInputAssemblyStateB struct {
+		sType                             uint32
+		pNext                             uintptr
+		flags, topology, primitiveRestart uint32
+	}
+	vkPipelineViewportStateB struct {
+		sType                uint32
+		pNext                uintptr
+		flags, viewportCount uint32
+		pViewports           uintptr
+		scissorCount         uint32
+		pScissors            uintptr
+	}
+	vkPipelineRasterizationStateB struct {
+		sType                                                                   uint32
+		pNext                                                                   uintptr
+		flags, depthClamp, discard, polygonMode, cullMode, frontFace, depthBias uint32
+		biasConstant, biasClamp, biasSlope, lineWidth                           float32
+	}
+	vkPipelineMultisampleStateB struct {
+		sType                         uint32
+		pNext                         uintptr
+		flags, samples, sampleShading uint32
+		minSampleShading              float32
+		pSampleMask                   uintptr
+		alphaToCoverage, alphaToOne   uint32
+	}
+	vkStencilOpStateB struct {
+		failOp, passOp, depthFailOp, compareOp, compareMask, writeMask, reference uint32
+	}
+	vkPipelineDepthStencilStateB struct {
+		sType                                                                uint32
+		pNext                                                                uintptr
+		flags, depthTest, depthWrite, depthCompare, depthBounds, stencilTest uint32
+		front, back                                                          vkStencilOpStateB
+		minBounds, maxBounds                                                 float32
+	}
+	vkColorBlendAttachmentB struct {
+		blendEnable, srcColor, dstColor, colorOp, srcAlpha, dstAlpha, alphaOp, writeMask uint32
+	}
+	vkPipelineColorBlendStateB struct {
+		sType                                          uint32
+		pNext                                          uintptr
+		flags, logicOpEnable, logicOp, attachmentCount uint32
+		pAttachments                                   uintptr
+		constants                                      [4]float32
+	}
+	vkPipelineDynamicStateB struct {
+		sType        uint32
+		pNext        uintptr
+		flags, count uint32
+		pStates      uintptr
+	}
+	vkGraphicsPipelineCreateInfoB struct {
+		sType                                                uint32
+		pNext                                                uintptr
+		flags, stageCount                                    uint32
+		pStages, pVertexInput, pInputAssembly, pTessellation uintptr
+		pViewport, pRasterization, pMultisample              uintptr
+		pDepthStencil, pColorBlend, pDynamic                 uintptr
+		layout, renderPass                                   uintptr
+		subpass                                              uint32
+		basePipeline                                         uintptr
+		baseIndex                                            int32
+	}
+	vkQueryPoolCreateInfoB struct {
+		sType                                       uint32
+		pNext                                       uintptr
+		flags, queryType, queryCount, pipelineStats uint32
+	}
 	vkSubmitInfoB struct {
 		sType             uint32
 		pNext             uintptr
@@ -164,6 +369,14 @@ type (
 	}
 )
 
+const (
+	vksDebugMessenger = 1000128004
+
+	vkDebugSeverityError = 0x1000
+	vkDebugTypeGeneral   = 0x1
+	vkDebugTypeValid     = 0x2
+)
+
 const (
 	vksInstance    = 1
 	vksDevQueue    = 2
@@ -171,28 +384,141 @@ const (
 	vksSubmit      = 4
 	vksMemAlloc    = 5
 	vksBuffer      = 12
+	vksImage       = 14
+	vksImageView   = 15
 	vksShaderMod   = 16
 	vksShaderStage = 18
+	vksVertexInput = 19
+	vksInputAsm    = 20
+	vksViewport    = 22
+	vksRaster      = 23
+	vksMultisample = 24
+	vksDepthState  = 25
+	vksBlendState  = 26
+	vksDynamic     = 27
+	vksGraphicsPip = 28
 	vksComputePipe = 29
 	vksPipeLayout  = 30
 	vksDSL         = 32
 	vksDescPool    = 33
 	vksDSAlloc     = 34
 	vksWriteDS     = 35
+	vksFramebuffer = 37
+	vksRenderPass  = 38
 	vksCmdPool     = 39
 	vksCmdBufAlloc = 40
 	vksCmdBegin    = 42
+	vksPassBegin   = 43
+	vksImgBarrier  = 45
+	vksMemBarrier  = 46
+	vksQueryPool   = 11
 
+	vkUsageTransferSrc  = 0x1
+	vkUsageTransferDst  = 0x2
+	vkUsageUniform      = 0x10
 	vkUsageStorage      = 0x20
+	vkUsageIndex        = 0x40
+	vkUsageIndirect     = 0x100
+	vkMemDeviceLocal    = 0x1
 	vkMemHostVisibleB   = 0x2
 	vkMemHostCoherentB  = 0x4
+	vkDescUniformBuffer = 6
 	vkDescStorageBuffer = 7
+	vkStageVertex       = 0x1
+	vkStageFragment     = 0x10
 	vkStageComputeB     = 0x20
+	vkBindGraphics      = 0
 	vkBindCompute       = 1
+	vkQueueGraphicsBit  = 0x1
 	vkQueueComputeBitB  = 0x2
+	vkStageAllCommands  = 0x10000
+	vkAccessMemoryRead  = 0x8000
+	vkAccessMemoryWrite = 0x10000
+
+	vkFormatRGBA8Unorm     = 37
+	vkFormatRGBA32Float    = 109
+	vkFormatD32Float       = 126
+	vkFormatR8Unorm        = 9
+	vkFormatRG16Float      = 83
+	vkFormatRGBA16Float    = 97
+	vkFormatR32Float       = 100
+	vkFormatD24UnormS8Uint = 129
+	vkFormatBGRA8SRGB      = 50
+
+	vkImageUsageTransferSrc = 0x1
+	vkImageUsageTransferDst = 0x2
+	vkImageUsageSampled     = 0x4
+	vkImageUsageColor       = 0x10
+	vkImageUsageDepth       = 0x20
+	vkAspectColor           = 0x1
+	vkAspectDepth           = 0x2
+	vkAspectStencil         = 0x4
+	vkLayoutUndefined       = 0
+	vkLayoutGeneral         = 1
+	vkImageType2D           = 1
+	vkImageType3D           = 2
+	vkImageCubeCompatible   = 0x10
+	vkFilterLinear          = 1
+	vkSamples1              = 1
+	vkAttachmentUnused      = ^uint32(0)
+	vkQueueFamilyIgnored    = 0xFFFFFFFF
+
+	vkLoadOpLoad      = 0
+	vkLoadOpClear     = 1
+	vkLoadOpDontCare  = 2
+	vkStoreOpStore    = 0
+	vkStoreOpDontCare = 1
+
+	vkIndexUint16 = 0
+	vkIndexUint32 = 1
+
+	vkFrontCCW         = 0
+	vkFrontCW          = 1
+	vkDynamicViewport  = 0
+	vkDynamicScissor   = 1
+	vkTopologyPoints   = 0
+	vkTopologyLines    = 1
+	vkTopologyTriList  = 3
+	vkTopologyTriStrip = 4
+
+	vkQueryTypeOcclusion = 0
+	vkQueryTypeTimestamp = 2
+	vkStageTopOfPipe     = 0x1
+	vkStageBottomOfPipe  = 0x2000
+	vkQueryResult64      = 0x1
+	vkQueryResultWait    = 0x2
+
+	// Byte offsets into VkPhysicalDeviceProperties and
+	// VkQueueFamilyProperties.
+	vkPropsVendorID                        = 8
+	vkPropsDeviceType                      = 16
+	vkPropsDeviceName                      = 20  // char[256]
+	vkPropsMaxImageDimension2D             = 300 // limits (at 296) + 4
+	vkPropsMaxStorageBufferRange           = 324 // limits + 28
+	vkPropsMaxComputeInvocations           = 528 // limits + 232
+	vkPropsMaxComputeWorkGroupSize         = 532 // limits + 236, uint32[3]
+	vkPropsMinUniformBufferOffsetAlignment = 616 // limits + 320, uint64
+	vkPropsMinStorageBufferOffsetAlignment = 624 // limits + 328, uint64
+	vkPropsMaxColorAttachments             = 688 // limits + 392
+	vkPropsTimestampPeriod                 = 720 // limits + 424
+	vkQueueTimestampValidBits              = 8
+
+	vkErrorOutOfHostMemory   = -1
+	vkErrorOutOfDeviceMemory = -2
+	vkErrorDeviceLost        = -4
+
+	vkPhysicalDeviceTypeCPU    = 4
+	vkFormatColorAttachmentBit = 0x80
 )
 
+// vkVendors names the PCI vendor ids of VkPhysicalDeviceProperties.vendorID.
+var vkVendors = map[uint32]string{
+	0x1002: "AMD", 0x106B: "Apple", 0x10DE: "NVIDIA", 0x13B5: "ARM",
+	0x5143: "Qualcomm", 0x8086: "Intel", 0x10005: "Mesa",
+}
+
 type vkBackend struct {
+	errorHandler
 	lib     uintptr
 	fn      map[string]uintptr
 	pd      uintptr
@@ -203,6 +529,20 @@ type vkBackend struct {
 	memProp []byte
 	memN    uint32
 	mu      sync.Mutex
+
+	timestampBits   uint32  // valid bits of the queue's timestamps; 0 if it has none
+	timestampPeriod float64 // nanoseconds per timestamp tick
+
+	renderPasses map[string]uintptr // by attachment formats and load op; see renderPass
+
+	caps capabilities
+
+	// messenger is the VK_EXT_debug_utils messenger of WithValidation, 0
+	// without one; debugMsgs are the error messages it delivered since
+	// submit last reported them.
+	instance, messenger uintptr
+	debugMu             sync.Mutex
+	debugMsgs           []string
 }
 
 func (b *vkBackend) c(name string, args ...uintptr) {
@@ -216,14 +556,14 @@ func (b *vkBackend) c(name string, args ...uintptr) {
 // from the GL backend's openBackend when DriverVulkan is requested. Non-linux
 // builds use the stub in backend_vk_other.go.
 func openVKBackend(c config) (backend, Driver, error) {
-	vb, err := newVKBackend()
+	vb, err := newVKBackend(c.validation)
 	if err != nil {
 		return nil, DriverAuto, err
 	}
 	return vb, DriverVulkan, nil
 }
 
-func newVKBackend() (b *vkBackend, err error) {
+func newVKBackend(validation bool) (b *vkBackend, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("%v", r)
@@ -238,12 +578,25 @@ func newVKBackend() (b *vkBackend, err error) {
 		"vkCreateInstance", "vkEnumeratePhysicalDevices", "vkGetPhysicalDeviceQueueFamilyProperties",
 		"vkCreateDevice", "vkGetDeviceQueue", "vkGetPhysicalDeviceMemoryProperties",
 		"vkCreateBuffer", "vkGetBufferMemoryRequirements", "vkAllocateMemory", "vkBindBufferMemory",
-		"vkMapMemory", "vkDestroyBuffer", "vkFreeMemory", "vkCreateShaderModule",
+		"vkMapMemory", "vkDestroyBuffer", "vkFreeMemory", "vkCreateShaderModule", "vkDestroyShaderModule",
 		"vkCreateDescriptorSetLayout", "vkCreatePipelineLayout", "vkCreateComputePipelines",
+		"vkDestroyDescriptorSetLayout", "vkDestroyPipelineLayout", "vkDestroyPipeline",
 		"vkCreateDescriptorPool", "vkResetDescriptorPool", "vkAllocateDescriptorSets", "vkUpdateDescriptorSets",
 		"vkCreateCommandPool", "vkResetCommandPool", "vkAllocateCommandBuffers", "vkBeginCommandBuffer",
 		"vkCmdBindPipeline", "vkCmdBindDescriptorSets", "vkCmdDispatch", "vkEndCommandBuffer",
+		"vkCmdCopyBuffer", "vkCmdPipelineBarrier", "vkDestroyDescriptorPool", "vkFreeCommandBuffers",
+		"vkCreateImage", "vkGetImageMemoryRequirements", "vkBindImageMemory", "vkCreateImageView",
+		"vkDestroyImage", "vkDestroyImageView",
+		"vkCreateRenderPass", "vkCreateFramebuffer", "vkDestroyFramebuffer", "vkCreateGraphicsPipelines",
+		"vkCmdBeginRenderPass", "vkCmdEndRenderPass", "vkCmdSetViewport", "vkCmdSetScissor",
+		"vkCmdDraw", "vkCmdDrawIndexed", "vkCmdBindIndexBuffer",
+		"vkCmdDispatchIndirect", "vkCmdDrawIndirect", "vkCmdDrawIndexedIndirect",
+		"vkCmdCopyBufferToImage", "vkCmdCopyImageToBuffer", "vkCmdCopyImage", "vkCmdBlitImage",
 		"vkQueueSubmit", "vkDeviceWaitIdle", "vkDestroyDevice",
+		"vkGetPhysicalDeviceProperties", "vkCreateQueryPool", "vkDestroyQueryPool",
+		"vkCmdResetQueryPool", "vkCmdWriteTimestamp", "vkGetQueryPoolResults",
+		"vkCmdBeginQuery", "vkCmdEndQuery", "vkGetPhysicalDeviceFormatProperties",
+		"vkEnumerateInstanceLayerProperties", "vkEnumerateInstanceExtensionProperties", "vkGetInstanceProcAddr",
 	} {
 		p, e := purego.Dlsym(lib, name)
 		if e != nil {
@@ -253,8 +606,34 @@ func newVKBackend() (b *vkBackend, err error) {
 	}
 
 	ici := vkInstanceCreateInfoB{sType: vksInstance}
+	var (
+		layer     = cString(vkValidationLayer)
+		layers    = []uintptr{uintptr(unsafe.Pointer(&layer[0]))}
+		debugExt  = cString(vkDebugUtilsExtension)
+		exts      = []uintptr{uintptr(unsafe.Pointer(&debugExt[0]))}
+		debugInfo = vkDebugUtilsMessengerCreateInfoB{
+			sType:    vksDebugMessenger,
+			severity: vkDebugSeverityError,
+			typeBits: vkDebugTypeGeneral | vkDebugTypeValid,
+		}
+		debug bool
+	)
+	if validation {
+		if b.hasInstanceProperty("vkEnumerateInstanceLayerProperties", vkLayerPropertiesSize, vkValidationLayer) {
+			ici.enabledLayerCount, ici.ppEnabledLayerNames = 1, uintptr(unsafe.Pointer(&layers[0]))
+		}
+		if debug = b.hasInstanceProperty("vkEnumerateInstanceExtensionProperties", vkExtensionPropertiesSize, vkDebugUtilsExtension); debug {
+			ici.enabledExtensionCount, ici.ppEnabledExtensionNames = 1, uintptr(unsafe.Pointer(&exts[0]))
+		}
+	}
 	var instance uintptr
 	b.c("vkCreateInstance", uintptr(unsafe.Pointer(&ici)), 0, uintptr(unsafe.Pointer(&instance)))
+	runtime.KeepAlive(layer)
+	runtime.KeepAlive(debugExt)
+	b.instance = instance
+	if debug {
+		b.initDebugMessenger(&debugInfo)
+	}
 
 	var nd uint32
 	purego.SyscallN(b.fn["vkEnumeratePhysicalDevices"], instance, uintptr(unsafe.Pointer(&nd)), 0)
@@ -269,17 +648,26 @@ func newVKBackend() (b *vkBackend, err error) {
 	purego.SyscallN(b.fn["vkGetPhysicalDeviceQueueFamilyProperties"], b.pd, uintptr(unsafe.Pointer(&qn)), 0)
 	qp := make([]byte, int(qn)*24)
 	purego.SyscallN(b.fn["vkGetPhysicalDeviceQueueFamilyProperties"], b.pd, uintptr(unsafe.Pointer(&qn)), uintptr(unsafe.Pointer(&qp[0])))
+	// Prefer a family that runs both render and compute work (lavapipe and
+	// desktop drivers have one); a compute-only family still opens, and render
+	// pipelines then fail at first use.
 	found := false
-	for q := 0; q < int(qn); q++ {
-		if *(*uint32)(unsafe.Pointer(&qp[q*24]))&vkQueueComputeBitB != 0 {
-			b.qfi = uint32(q)
-			found = true
-			break
+	for _, want := range []uint32{vkQueueGraphicsBit | vkQueueComputeBitB, vkQueueComputeBitB} {
+		for q := 0; q < int(qn) && !found; q++ {
+			if *(*uint32)(unsafe.Pointer(&qp[q*24]))&want == want {
+				b.qfi = uint32(q)
+				found = true
+			}
 		}
 	}
 	if !found {
 		return nil, fmt.Errorf("gpu/vk: no compute queue family")
 	}
+	b.timestampBits = *(*uint32)(unsafe.Pointer(&qp[int(b.qfi)*24+vkQueueTimestampValidBits]))
+	props := make([]byte, 824)
+	purego.SyscallN(b.fn["vkGetPhysicalDeviceProperties"], b.pd, uintptr(unsafe.Pointer(&props[0])))
+	b.timestampPeriod = float64(*(*float32)(unsafe.Pointer(&props[vkPropsTimestampPeriod])))
+	b.initCapabilities(props)
 
 	prio := float32(1)
 	qci := vkDeviceQueueCreateInfoB{sType: vksDevQueue, queueFamilyIndex: b.qfi, queueCnt: 1, pQueuePriorities: uintptr(unsafe.Pointer(&prio))}
@@ -296,6 +684,135 @@ func newVKBackend() (b *vkBackend, err error) {
 	return b, nil
 }
 
+// Instance layer and extension names and property sizes for WithValidation.
+const (
+	vkValidationLayer         = "VK_LAYER_KHRONOS_validation"
+	vkDebugUtilsExtension     = "VK_EXT_debug_utils"
+	vkLayerPropertiesSize     = 520 // VkLayerProperties, its name first
+	vkExtensionPropertiesSize = 260 // VkExtensionProperties, its name first
+)
+
+// cString returns s NUL-terminated.
+func cString(s string) []byte { return append([]byte(s), 0) }
+
+// hasInstanceProperty reports whether enumerate, which lists the instance
+// layers or extensions as properties of size bytes, lists name.
+func (b *vkBackend) hasInstanceProperty(enumerate string, size int, name string) bool {
+	var n uint32
+	purego.SyscallN(b.fn[enumerate], 0, uintptr(unsafe.Pointer(&n)), 0)
+	if n == 0 {
+		return false
+	}
+	props := make([]byte, int(n)*size)
+	purego.SyscallN(b.fn[enumerate], 0, uintptr(unsafe.Pointer(&n)), uintptr(unsafe.Pointer(&props[0])))
+	for i := range int(n) {
+		if cStr(uintptr(unsafe.Pointer(&props[i*size]))) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// vkDebugBackends maps the user data of vkDebugCallback to its backend.
+var (
+	vkDebugMu       sync.Mutex
+	vkDebugBackends = map[uintptr]*vkBackend{}
+	vkDebugNext     uintptr
+)
+
+// vkDebugCallback is the PFN_vkDebugUtilsMessengerCallbackEXT of every
+// backend: purego callbacks are never freed, so there is one. The validation
+// layer may call it on any thread.
+var vkDebugCallback = sync.OnceValue(func() uintptr {
+	return purego.NewCallback(func(severity, types uint32, data *vkDebugUtilsMessengerCallbackDataB, user uintptr) uintptr {
+		vkDebugMu.Lock()
+		b := vkDebugBackends[user]
+		vkDebugMu.Unlock()
+		if b == nil {
+			return 0
+		}
+		msg := cStr(data.pMessage)
+		b.debugMu.Lock()
+		if len(b.debugMsgs) < 16 {
+			b.debugMsgs = append(b.debugMsgs, msg)
+		}
+		b.debugMu.Unlock()
+		return 0 // VK_FALSE: do not abort the call
+	})
+})
+
+// initDebugMessenger creates the messenger of info, which delivers the
+// validation layer's errors to debugMsgs.
+func (b *vkBackend) initDebugMessenger(info *vkDebugUtilsMessengerCreateInfoB) {
+	name := cString("vkCreateDebugUtilsMessengerEXT")
+	create, _, _ := purego.SyscallN(b.fn["vkGetInstanceProcAddr"], b.instance, uintptr(unsafe.Pointer(&name[0])))
+	if create == 0 {
+		return
+	}
+	vkDebugMu.Lock()
+	vkDebugNext++
+	user := vkDebugNext
+	vkDebugBackends[user] = b
+	vkDebugMu.Unlock()
+	info.callback, info.userData = vkDebugCallback(), user
+	purego.SyscallN(create, b.instance, uintptr(unsafe.Pointer(info)), 0, uintptr(unsafe.Pointer(&b.messenger)))
+}
+
+// debugError returns the validation layer's errors since the last call as
+// one validation error, or nil.
+func (b *vkBackend) debugError() error {
+	b.debugMu.Lock()
+	defer b.debugMu.Unlock()
+	if len(b.debugMsgs) == 0 {
+		return nil
+	}
+	err := &Error{Filter: ErrorFilterValidation, Err: fmt.Errorf("gpu/vk: %s", strings.Join(b.debugMsgs, "; "))}
+	b.debugMsgs = b.debugMsgs[:0]
+	return err
+}
+
+// initCapabilities fills b.caps from the physical device's properties.
+func (b *vkBackend) initCapabilities(props []byte) {
+	u32 := func(off int) int { return int(*(*uint32)(unsafe.Pointer(&props[off]))) }
+	c := &b.caps
+	vendor := uint32(u32(vkPropsVendorID))
+	c.info = AdapterInfo{Driver: DriverVulkan, Vendor: vkVendors[vendor]}
+	if c.info.Vendor == "" {
+		c.info.Vendor = fmt.Sprintf("%#04x", vendor)
+	}
+	name := props[vkPropsDeviceName : vkPropsDeviceName+256]
+	if i := slices.Index(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	c.info.Name = string(name)
+	c.info.Software = u32(vkPropsDeviceType) == vkPhysicalDeviceTypeCPU
+
+	c.limits.MaxBufferSize = u32(vkPropsMaxStorageBufferRange)
+	for i := range c.limits.MaxComputeWorkgroupSize {
+		c.limits.MaxComputeWorkgroupSize[i] = u32(vkPropsMaxComputeWorkGroupSize + 4*i)
+	}
+	c.limits.MaxComputeInvocations = u32(vkPropsMaxComputeInvocations)
+	c.limits.MaxTextureDimension2D = u32(vkPropsMaxImageDimension2D)
+	c.limits.MaxColorAttachments = u32(vkPropsMaxColorAttachments)
+	// Samplers are created without anisotropy (the device enables no
+	// samplerAnisotropy feature).
+	c.limits.MaxSamplerAnisotropy = 1
+	u64 := func(off int) int { return int(*(*uint64)(unsafe.Pointer(&props[off]))) }
+	c.limits.MinUniformBufferOffsetAlignment = u64(vkPropsMinUniformBufferOffsetAlignment)
+	c.limits.MinStorageBufferOffsetAlignment = u64(vkPropsMinStorageBufferOffsetAlignment)
+
+	if b.timestampBits != 0 && b.timestampPeriod != 0 {
+		c.features |= FeatureTimestampQuery
+	}
+	var fp struct{ linear, optimal, buffer uint32 } // VkFormatProperties
+	purego.SyscallN(b.fn["vkGetPhysicalDeviceFormatProperties"], b.pd, vkFormatRGBA32Float, uintptr(unsafe.Pointer(&fp)))
+	if fp.optimal&vkFormatColorAttachmentBit != 0 {
+		c.features |= FeatureFloat32Renderable
+	}
+}
+
+func (b *vkBackend) capabilities() capabilities { return b.caps }
+
 func (b *vkBackend) hostMemType(bits uint32) uint32 {
 	for i := 0; i < int(b.memN); i++ {
 		if bits&(1<<uint(i)) == 0 {
@@ -309,11 +826,33 @@ func (b *vkBackend) hostMemType(bits uint32) uint32 {
 	panic("gpu/vk: no host-visible coherent memory type")
 }
 
+// deviceMemType picks a device-local memory type allowed by bits, or else any
+// allowed type (lavapipe's memory is all host memory anyway).
+func (b *vkBackend) deviceMemType(bits uint32) uint32 {
+	fallback := -1
+	for i := 0; i < int(b.memN); i++ {
+		if bits&(1<<uint(i)) == 0 {
+			continue
+		}
+		if *(*uint32)(unsafe.Pointer(&b.memProp[4+i*8]))&vkMemDeviceLocal != 0 {
+			return uint32(i)
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	if fallback < 0 {
+		panic("gpu/vk: no memory type for an image")
+	}
+	return uint32(fallback)
+}
+
 type vkBuffer struct {
 	b              *vkBackend
 	buffer, memory uintptr
 	ptr            unsafe.Pointer
 	size           int
+	uniform        bool // bound as a uniform rather than a storage buffer
 }
 
 func (b *vkBackend) newBuffer(size int, usage BufferUsage, data []byte) (bb backendBuffer, err error) {
@@ -324,8 +863,19 @@ func (b *vkBackend) newBuffer(size int, usage BufferUsage, data []byte) (bb back
 	}()
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	buf := b.allocBuffer(size)
+	buf.uniform = usage&BufferUniform != 0
+	if len(data) > 0 {
+		copy(unsafe.Slice((*byte)(buf.ptr), size), data)
+	}
+	return buf, nil
+}
+
+// allocBuffer creates a host-visible, persistently mapped buffer usable for
+// any binding or transfer. b.mu must be held.
+func (b *vkBackend) allocBuffer(size int) *vkBuffer {
 	buf := &vkBuffer{b: b, size: size}
-	bci := vkBufferCreateInfoB{sType: vksBuffer, size: uint64(size), usage: vkUsageStorage}
+	bci := vkBufferCreateInfoB{sType: vksBuffer, size: uint64(size), usage: vkUsageStorage | vkUsageUniform | vkUsageIndex | vkUsageIndirect | vkUsageTransferSrc | vkUsageTransferDst}
 	b.c("vkCreateBuffer", b.device, uintptr(unsafe.Pointer(&bci)), 0, uintptr(unsafe.Pointer(&buf.buffer)))
 	var req vkMemoryRequirementsB
 	purego.SyscallN(b.fn["vkGetBufferMemoryRequirements"], b.device, buf.buffer, uintptr(unsafe.Pointer(&req)))
@@ -335,10 +885,7 @@ func (b *vkBackend) newBuffer(size int, usage BufferUsage, data []byte) (bb back
 	var p uintptr
 	b.c("vkMapMemory", b.device, buf.memory, 0, uintptr(size), 0, uintptr(unsafe.Pointer(&p)))
 	buf.ptr = unsafe.Pointer(p)
-	if len(data) > 0 {
-		copy(unsafe.Slice((*byte)(buf.ptr), size), data)
-	}
-	return buf, nil
+	return buf
 }
 
 func (b *vkBuffer) bytes() []byte {
@@ -347,22 +894,40 @@ func (b *vkBuffer) bytes() []byte {
 	return out
 }
 
+func (b *vkBuffer) read(offset int, p []byte) {
+	copy(p, unsafe.Slice((*byte)(b.ptr), b.size)[offset:])
+}
+
+func (b *vkBuffer) write(offset int, p []byte) {
+	copy(unsafe.Slice((*byte)(b.ptr), b.size)[offset:], p)
+}
+
 func (b *vkBuffer) release() {
 	b.b.mu.Lock()
 	defer b.b.mu.Unlock()
+	b.free()
+}
+
+// free destroys the buffer; b.b.mu must be held.
+func (b *vkBuffer) free() {
 	purego.SyscallN(b.b.fn["vkDestroyBuffer"], b.b.device, b.buffer, 0)
 	purego.SyscallN(b.b.fn["vkFreeMemory"], b.b.device, b.memory, 0)
 }
 
 type vkModule struct {
+	b      *vkBackend
 	module uintptr
 }
 
-func (vkModule) isShaderModule() {}
+func (m vkModule) release() {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	purego.SyscallN(m.b.fn["vkDestroyShaderModule"], m.b.device, m.module, 0)
+}
 
 func (b *vkBackend) newShaderModule(src ShaderSource) (m backendShaderModule, err error) {
 	if len(src.SPIRV) == 0 {
-		return nil, fmt.Errorf("gpu/vk: ShaderSource.SPIRV is empty (the Vulkan backend needs SPIR-V; compile GLSL with glslang)")
+		return nil, fmt.Errorf("gpu/vk: ShaderSource.SPIRV is empty (the Vulkan backend needs SPIR-V, e.g. from shader.CompileSPIRV)")
 	}
 	if len(src.SPIRV)%4 != 0 {
 		return nil, fmt.Errorf("gpu/vk: SPIR-V length %d is not a multiple of 4", len(src.SPIRV))
@@ -381,13 +946,14 @@ func (b *vkBackend) newShaderModule(src ShaderSource) (m backendShaderModule, er
 	smci := vkShaderModuleCreateInfoB{sType: vksShaderMod, codeSize: uint64(len(src.SPIRV)), pCode: uintptr(unsafe.Pointer(&words[0]))}
 	var mod uintptr
 	b.c("vkCreateShaderModule", b.device, uintptr(unsafe.Pointer(&smci)), 0, uintptr(unsafe.Pointer(&mod)))
-	return vkModule{module: mod}, nil
+	return vkModule{b: b, module: mod}, nil
 }
 
 type vkPipeline struct {
 	b      *vkBackend
 	module uintptr
 	entry  []byte
+	wgx    int // the kernel's workgroup width (LocalSize x), if declared
 
 	built    bool
 	nbind    int
@@ -398,46 +964,235 @@ type vkPipeline struct {
 
 func (p *vkPipeline) maxThreads() int { return 1024 }
 
-func (b *vkBackend) newComputePipeline(mod backendShaderModule, entry string) (backendComputePipeline, error) {
-	// SPIR-V from our GLSL pipeline (glslang) always names the compute entry
-	// point "main" (from GLSL's void main()), regardless of the Device-API entry
-	// name (which is the Go kernel name, used by the Metal/MSL backend). Use the
-	// SPIR-V convention here.
-	return &vkPipeline{b: b, module: mod.(vkModule).module, entry: append([]byte("main"), 0)}, nil
+func (p *vkPipeline) release() {
+	b := p.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.built {
+		purego.SyscallN(b.fn["vkDestroyPipeline"], b.device, p.pipeline, 0)
+		b.destroyLayout(p.dsl, p.layout)
+	}
+}
+
+// destroyLayout destroys a pipeline's descriptor-set and pipeline layouts
+// (see setLayout). b.mu must be held.
+func (b *vkBackend) destroyLayout(dsl, layout uintptr) {
+	purego.SyscallN(b.fn["vkDestroyPipelineLayout"], b.device, layout, 0)
+	purego.SyscallN(b.fn["vkDestroyDescriptorSetLayout"], b.device, dsl, 0)
+}
+
+func (b *vkBackend) newComputePipeline(mod backendShaderModule, entry string, workgroup [3]int) (backendComputePipeline, error) {
+	// shader.CompileSPIRV (like glslang, from GLSL's void main()) always names
+	// the entry point "main", regardless of the Device-API entry name (which is
+	// the Go kernel name, used by the Metal/MSL backend). Use the SPIR-V
+	// convention here.
+	return &vkPipeline{b: b, module: mod.(vkModule).module, entry: append([]byte("main"), 0), wgx: workgroup[0]}, nil
 }
 
 // build lazily creates the descriptor-set layout, pipeline layout and compute
-// pipeline once the binding count is known (at first dispatch).
-func (p *vkPipeline) build(nbind int) {
+// pipeline once the bindings are known (at first dispatch).
+func (p *vkPipeline) build(binds []vkBufBind) {
 	b := p.b
-	binds := make([]vkDSLBindingB, nbind)
-	for i := range binds {
-		binds[i] = vkDSLBindingB{binding: uint32(i), descriptorType: vkDescStorageBuffer, descriptorCount: 1, stageFlags: vkStageComputeB}
-	}
-	dslci := vkDSLCreateInfoB{sType: vksDSL, bindingCount: uint32(nbind), pBindings: uintptr(unsafe.Pointer(&binds[0]))}
-	b.c("vkCreateDescriptorSetLayout", b.device, uintptr(unsafe.Pointer(&dslci)), 0, uintptr(unsafe.Pointer(&p.dsl)))
-	plci := vkPipelineLayoutCreateInfoB{sType: vksPipeLayout, setLayoutCount: 1, pSetLayouts: uintptr(unsafe.Pointer(&p.dsl))}
-	b.c("vkCreatePipelineLayout", b.device, uintptr(unsafe.Pointer(&plci)), 0, uintptr(unsafe.Pointer(&p.layout)))
+	p.dsl, p.layout, p.nbind = b.setLayout(binds, vkStageComputeB)
 	cpci := vkComputePipelineCreateInfoB{
 		sType:  vksComputePipe,
 		stage:  vkShaderStageCreateInfoB{sType: vksShaderStage, stage: vkStageComputeB, module: p.module, pName: uintptr(unsafe.Pointer(&p.entry[0]))},
 		layout: p.layout,
 	}
 	b.c("vkCreateComputePipelines", b.device, 0, 1, uintptr(unsafe.Pointer(&cpci)), 0, uintptr(unsafe.Pointer(&p.pipeline)))
-	p.nbind = nbind
 	p.built = true
 }
 
 type vkBufBind struct {
-	buf   *vkBuffer
-	index int
+	buf          *vkBuffer
+	offset, size int
+	index        int
+}
+
+func (bd vkBufBind) descType() uint32 {
+	if bd.buf.uniform {
+		return vkDescUniformBuffer
+	}
+	return vkDescStorageBuffer
+}
+
+// setLayout creates a descriptor-set layout with one buffer binding per index
+// up to the highest bound one (typed by the buffer bound there, storage for a
+// gap), and a pipeline layout of that one set. b.mu must be held.
+func (b *vkBackend) setLayout(binds []vkBufBind, stages uint32) (dsl, layout uintptr, nbind int) {
+	for _, bd := range binds {
+		if bd.index+1 > nbind {
+			nbind = bd.index + 1
+		}
+	}
+	dslci := vkDSLCreateInfoB{sType: vksDSL, bindingCount: uint32(nbind)}
+	if nbind > 0 {
+		lb := make([]vkDSLBindingB, nbind)
+		for i := range lb {
+			lb[i] = vkDSLBindingB{binding: uint32(i), descriptorType: vkDescStorageBuffer, descriptorCount: 1, stageFlags: stages}
+		}
+		for _, bd := range binds {
+			lb[bd.index].descriptorType = bd.descType()
+		}
+		dslci.pBindings = uintptr(unsafe.Pointer(&lb[0]))
+		defer runtime.KeepAlive(lb)
+	}
+	b.c("vkCreateDescriptorSetLayout", b.device, uintptr(unsafe.Pointer(&dslci)), 0, uintptr(unsafe.Pointer(&dsl)))
+	plci := vkPipelineLayoutCreateInfoB{sType: vksPipeLayout, setLayoutCount: 1, pSetLayouts: uintptr(unsafe.Pointer(&dsl))}
+	b.c("vkCreatePipelineLayout", b.device, uintptr(unsafe.Pointer(&plci)), 0, uintptr(unsafe.Pointer(&layout)))
+	return dsl, layout, nbind
+}
+
+// vkDescriptors is the descriptor pool of one commit: count every command's
+// bindings first, then alloc the pool and hand out a set per command.
+type vkDescriptors struct {
+	sets, storage, uniform int
+	pool                   uintptr
+}
+
+func (d *vkDescriptors) count(binds []vkBufBind) {
+	if len(binds) == 0 {
+		return
+	}
+	d.sets++
+	for _, bd := range binds {
+		if bd.buf.uniform {
+			d.uniform++
+		} else {
+			d.storage++
+		}
+	}
+}
+
+// alloc creates a fresh pool per submit (simplest correct lifetime) sized to
+// the counted sets. b.mu must be held.
+func (d *vkDescriptors) alloc(b *vkBackend) {
+	if d.sets == 0 {
+		return
+	}
+	var sizes []vkDescriptorPoolSizeB
+	if d.storage > 0 {
+		sizes = append(sizes, vkDescriptorPoolSizeB{typ: vkDescStorageBuffer, descriptorCount: uint32(d.storage)})
+	}
+	if d.uniform > 0 {
+		sizes = append(sizes, vkDescriptorPoolSizeB{typ: vkDescUniformBuffer, descriptorCount: uint32(d.uniform)})
+	}
+	dpci := vkDescriptorPoolCreateInfoB{sType: vksDescPool, maxSets: uint32(d.sets), poolSizeCount: uint32(len(sizes)), pPoolSizes: uintptr(unsafe.Pointer(&sizes[0]))}
+	b.c("vkCreateDescriptorPool", b.device, uintptr(unsafe.Pointer(&dpci)), 0, uintptr(unsafe.Pointer(&d.pool)))
+}
+
+// set allocates a descriptor set of layout dsl pointing at binds, or returns
+// 0 when there is nothing to bind.
+func (d *vkDescriptors) set(b *vkBackend, dsl uintptr, binds []vkBufBind) uintptr {
+	if len(binds) == 0 {
+		return 0
+	}
+	var set uintptr
+	dsai := vkDSAllocateInfoB{sType: vksDSAlloc, descriptorPool: d.pool, count: 1, pSetLayouts: uintptr(unsafe.Pointer(&dsl))}
+	b.c("vkAllocateDescriptorSets", b.device, uintptr(unsafe.Pointer(&dsai)), uintptr(unsafe.Pointer(&set)))
+	infos := make([]vkDescriptorBufferInfoB, len(binds))
+	writes := make([]vkWriteDescriptorSetB, len(binds))
+	for j, bd := range binds {
+		infos[j] = vkDescriptorBufferInfoB{buffer: bd.buf.buffer, offset: uint64(bd.offset), rng: uint64(bd.size)}
+		writes[j] = vkWriteDescriptorSetB{
+			sType: vksWriteDS, dstSet: set, dstBinding: uint32(bd.index), descriptorCount: 1,
+			descType: bd.descType(), pBufferInfo: uintptr(unsafe.Pointer(&infos[j])),
+		}
+	}
+	purego.SyscallN(b.fn["vkUpdateDescriptorSets"], b.device, uintptr(len(writes)), uintptr(unsafe.Pointer(&writes[0])), 0, 0)
+	runtime.KeepAlive(infos)
+	return set
+}
+
+func (d *vkDescriptors) destroy(b *vkBackend) {
+	if d.pool != 0 {
+		purego.SyscallN(b.fn["vkDestroyDescriptorPool"], b.device, d.pool, 0)
+	}
+}
+
+// vkOpKind is what a recorded vkOp does.
+type vkOpKind int
+
+const (
+	vkOpDispatch vkOpKind = iota
+	vkOpCopyBuffer
+	vkOpCopyBufferToImage
+	vkOpCopyImageToBuffer
+	vkOpCopyImage
+	vkOpRender
+	vkOpTimestamp
+)
+
+// vkOp is one recorded command: a dispatch of pipe over binds, a copy, a
+// whole render pass or a timestamp write. An indirect dispatch reads its
+// workgroup counts from indirect at offset instead of gx.
+type vkOp struct {
+	kind     vkOpKind
+	pipe     *vkPipeline
+	binds    []vkBufBind
+	gx       int
+	indirect *vkBuffer
+	offset   int
+
+	src, dst       *vkBuffer
+	region         vkBufferCopyB
+	srcImg, dstImg *vkTexture
+	imgRegion      vkBufferImageCopyB
+	imgCopy        vkImageCopyB
+
+	pass *vkPass
+
+	query      *vkQuerySet
+	queryIndex int
+	stage      uint32
 }
 
+// vkPass is a recorded render pass, its draws and the occlusion queries
+// around them.
+type vkPass struct {
+	info    renderPassInfo
+	draws   []vkDraw
+	queries []vkQueryMark
+}
+
+// vkQueryMark begins or ends occlusion query index before draw draw of its
+// pass (after the last draw when draw is len(draws)).
+type vkQueryMark struct {
+	draw, index int
+	end         bool
+}
+
+// vkDraw is one draw: non-indexed when index is nil, and reading its
+// arguments from indirect at offset when that is set.
+type vkDraw struct {
+	pipe    *vkRenderPipeline
+	binds   []vkBufBind
+	prim    Primitive
+	index   *vkBuffer
+	idxOff  int // byte offset of the first index in index
+	idxType uint32
+
+	first, count, baseVertex, firstInstance, instances int
+
+	indirect *vkBuffer
+	offset   int
+}
+
+// vkCmd records dispatches, copies and render passes and replays them into
+// one Vulkan command buffer at commit, with a full memory barrier between
+// consecutive commands so each sees the writes of the ones before it.
 type vkCmd struct {
 	b     *vkBackend
 	pipe  *vkPipeline
 	binds []vkBufBind
-	gx    int
+	ops   []vkOp
+
+	pass    *vkPass         // the render pass being recorded
+	ts      *passTimestamps // timestamp writes of the open pass
+	rpipe   *vkRenderPipeline
+	index   *vkBuffer
+	idxOff  int
+	idxType uint32
 }
 
 func (b *vkBackend) newCommandBuffer() backendCommandBuffer { return &vkCmd{b: b} }
@@ -450,66 +1205,525 @@ func (b *vkBackend) newWindowSurface(display, window uintptr, w, h int) (backend
 
 func (b *vkBackend) windowVisualID() uint32 { return 0 }
 
-func (c *vkCmd) beginCompute() {}
-func (c *vkCmd) setComputePipeline(p backendComputePipeline) {
+func (c *vkCmd) beginCompute(ts *passTimestamps) {
+	c.binds = nil
+	c.beginTimestamp(ts)
+}
+func (c *vkCmd) setComputePipeline(p backendComputePipeline, _ *BindGroupLayout) {
 	c.pipe = p.(*vkPipeline)
 }
-func (c *vkCmd) setBuffer(buf backendBuffer, offset, index int) {
-	c.binds = append(c.binds, vkBufBind{buf: buf.(*vkBuffer), index: index})
+
+// setBuffer binds size bytes at offset of buf at index for the commands
+// recorded after it, replacing an earlier binding at the same index.
+func (c *vkCmd) setBuffer(buf backendBuffer, offset, size, index int, _ BindingKind) {
+	bd := vkBufBind{buf: buf.(*vkBuffer), offset: offset, size: size, index: index}
+	for i := range c.binds {
+		if c.binds[i].index == index {
+			c.binds[i] = bd
+			return
+		}
+	}
+	c.binds = append(c.binds, bd)
 }
-func (c *vkCmd) dispatch(x, y, z int) { c.gx = x }
-func (c *vkCmd) endCompute()          {}
+func (c *vkCmd) dispatch(x, y, z int) {
+	c.ops = append(c.ops, vkOp{kind: vkOpDispatch, pipe: c.pipe, binds: append([]vkBufBind(nil), c.binds...), gx: workgroups(x, c.pipe.wgx)})
+}
+func (c *vkCmd) dispatchIndirect(buf backendBuffer, offset int) {
+	c.ops = append(c.ops, vkOp{kind: vkOpDispatch, pipe: c.pipe, binds: append([]vkBufBind(nil), c.binds...), indirect: buf.(*vkBuffer), offset: offset})
+}
+func (c *vkCmd) endCompute() { c.endTimestamp() }
 
-func (c *vkCmd) commit() {
-	b := c.b
+// Textures and samplers are not bound to compute passes on Vulkan, as on GL.
+func (c *vkCmd) setComputeTexture(index int, t backendTexture) {}
+func (c *vkCmd) setComputeSampler(index int, s backendSampler) {}
+
+func (c *vkCmd) copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int) {
+	c.ops = append(c.ops, vkOp{
+		kind: vkOpCopyBuffer, src: src.(*vkBuffer), dst: dst.(*vkBuffer),
+		region: vkBufferCopyB{srcOffset: uint64(srcOffset), dstOffset: uint64(dstOffset), size: uint64(size)},
+	})
+}
+
+func (c *vkCmd) copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int) {
+	t := dst.(*vkTexture)
+	c.ops = append(c.ops, vkOp{kind: vkOpCopyBufferToImage, src: src.(*vkBuffer), dstImg: t, imgRegion: t.region(offset, bytesPerRow, x, y, w, h)})
+}
+
+func (c *vkCmd) copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int) {
+	t := src.(*vkTexture)
+	c.ops = append(c.ops, vkOp{kind: vkOpCopyImageToBuffer, srcImg: t, dst: dst.(*vkBuffer), imgRegion: t.region(offset, bytesPerRow, x, y, w, h)})
+}
+
+func (c *vkCmd) copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int) {
+	s, d := src.(*vkTexture), dst.(*vkTexture)
+	c.ops = append(c.ops, vkOp{kind: vkOpCopyImage, srcImg: s, dstImg: d, imgCopy: vkImageCopyB{
+		srcSub: s.layers(), sx: int32(sx), sy: int32(sy),
+		dstSub: d.layers(), dx: int32(dx), dy: int32(dy),
+		w: uint32(w), h: uint32(h), d: 1,
+	}})
+}
+
+// --- render pass ---
+
+func (c *vkCmd) beginRender(info renderPassInfo) {
+	c.beginTimestamp(info.timestamps)
+	c.pass = &vkPass{info: info}
+	c.binds, c.rpipe, c.index = nil, nil, nil
+	c.ops = append(c.ops, vkOp{kind: vkOpRender, pass: c.pass})
+}
+
+func (c *vkCmd) setRenderPipeline(p backendRenderPipeline, _ *BindGroupLayout) {
+	c.rpipe = p.(*vkRenderPipeline)
+}
+
+// Vertex data is pulled from storage buffers by vertex index, so a vertex
+// buffer is just another binding, as on GL and Metal.
+func (c *vkCmd) setRenderBuffer(buf backendBuffer, offset, size, index int, kind BindingKind) {
+	c.setBuffer(buf, offset, size, index, kind)
+}
+func (c *vkCmd) setVertexBuffer(buf backendBuffer, offset, size, index int) {
+	c.setBuffer(buf, offset, size, index, StorageBuffer)
+}
+
+func (c *vkCmd) setIndexBuffer(buf backendBuffer, offset int, format IndexFormat) {
+	c.index, c.idxOff, c.idxType = buf.(*vkBuffer), offset, vkIndexUint16
+	if format == IndexUint32 {
+		c.idxType = vkIndexUint32
+	}
+}
+
+func (c *vkCmd) draw(prim Primitive, start, count, firstInstance, instanceCount int) {
+	c.pass.draws = append(c.pass.draws, vkDraw{
+		pipe: c.rpipe, binds: append([]vkBufBind(nil), c.binds...), prim: prim,
+		first: start, count: count, firstInstance: firstInstance, instances: instanceCount,
+	})
+}
+
+func (c *vkCmd) drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int) {
+	c.pass.draws = append(c.pass.draws, vkDraw{
+		pipe: c.rpipe, binds: append([]vkBufBind(nil), c.binds...), prim: prim,
+		index: c.index, idxOff: c.idxOff, idxType: c.idxType,
+		first: firstIndex, count: count, baseVertex: baseVertex, firstInstance: firstInstance, instances: instanceCount,
+	})
+}
+
+func (c *vkCmd) drawIndirect(prim Primitive, buf backendBuffer, offset int) {
+	c.pass.draws = append(c.pass.draws, vkDraw{
+		pipe: c.rpipe, binds: append([]vkBufBind(nil), c.binds...), prim: prim,
+		indirect: buf.(*vkBuffer), offset: offset,
+	})
+}
+
+func (c *vkCmd) drawIndexedIndirect(prim Primitive, buf backendBuffer, offset int) {
+	c.pass.draws = append(c.pass.draws, vkDraw{
+		pipe: c.rpipe, binds: append([]vkBufBind(nil), c.binds...), prim: prim,
+		index: c.index, idxOff: c.idxOff, idxType: c.idxType,
+		indirect: buf.(*vkBuffer), offset: offset,
+	})
+}
+
+func (c *vkCmd) beginOcclusionQuery(index int) {
+	c.pass.queries = append(c.pass.queries, vkQueryMark{draw: len(c.pass.draws), index: index})
+}
+
+func (c *vkCmd) endOcclusionQuery() {
+	q := &c.pass.queries[len(c.pass.queries)-1]
+	c.pass.queries = append(c.pass.queries, vkQueryMark{draw: len(c.pass.draws), index: q.index, end: true})
+}
+
+func (c *vkCmd) endRender() {
+	c.pass = nil
+	c.endTimestamp()
+}
+
+// --- queries ---
+
+// vkQuerySet is a timestamp or occlusion query pool. Reading a query that
+// was reset but never written would wait forever, so it tracks which ones
+// hold a value.
+type vkQuerySet struct {
+	b       *vkBackend
+	typ     QueryType
+	pool    uintptr
+	written []bool // guarded by b.mu
+}
+
+func (b *vkBackend) newQuerySet(typ QueryType, count int) (backendQuerySet, error) {
+	qt := uint32(vkQueryTypeOcclusion)
+	if typ == QueryTimestamp {
+		if b.timestampBits == 0 || b.timestampPeriod == 0 {
+			return nil, errTimestampUnsupported
+		}
+		qt = vkQueryTypeTimestamp
+	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	q := &vkQuerySet{b: b, typ: typ, written: make([]bool, count)}
+	ci := vkQueryPoolCreateInfoB{sType: vksQueryPool, queryType: qt, queryCount: uint32(count)}
+	b.c("vkCreateQueryPool", b.device, uintptr(unsafe.Pointer(&ci)), 0, uintptr(unsafe.Pointer(&q.pool)))
+	return q, nil
+}
 
-	nbind := 0
-	for _, bd := range c.binds {
-		if bd.index+1 > nbind {
-			nbind = bd.index + 1
-		}
+// results reads the written queries. Timestamps are masked to the counter's
+// valid bits and scaled from ticks to nanoseconds.
+func (q *vkQuerySet) results(first, count int) ([]uint64, error) {
+	b := q.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	mask := ^uint64(0)
+	if b.timestampBits < 64 {
+		mask = 1<<b.timestampBits - 1
 	}
-	if !c.pipe.built {
-		c.pipe.build(nbind)
+	out := make([]uint64, count)
+	for i := range out {
+		if !q.written[first+i] {
+			continue
+		}
+		var v uint64
+		b.c("vkGetQueryPoolResults", b.device, q.pool, uintptr(first+i), 1, 8, uintptr(unsafe.Pointer(&v)), 8, vkQueryResult64|vkQueryResultWait)
+		if q.typ == QueryTimestamp {
+			v = uint64(float64(v&mask) * b.timestampPeriod)
+		}
+		out[i] = v
 	}
+	return out, nil
+}
 
-	// Fresh descriptor pool per submit (simplest correct lifetime).
-	poolSize := vkDescriptorPoolSizeB{typ: vkDescStorageBuffer, descriptorCount: uint32(nbind)}
-	dpci := vkDescriptorPoolCreateInfoB{sType: vksDescPool, maxSets: 1, poolSizeCount: 1, pPoolSizes: uintptr(unsafe.Pointer(&poolSize))}
-	var pool uintptr
-	b.c("vkCreateDescriptorPool", b.device, uintptr(unsafe.Pointer(&dpci)), 0, uintptr(unsafe.Pointer(&pool)))
-	dsai := vkDSAllocateInfoB{sType: vksDSAlloc, descriptorPool: pool, count: 1, pSetLayouts: uintptr(unsafe.Pointer(&c.pipe.dsl))}
-	var set uintptr
-	b.c("vkAllocateDescriptorSets", b.device, uintptr(unsafe.Pointer(&dsai)), uintptr(unsafe.Pointer(&set)))
+func (q *vkQuerySet) release() {
+	q.b.mu.Lock()
+	defer q.b.mu.Unlock()
+	purego.SyscallN(q.b.fn["vkDestroyQueryPool"], q.b.device, q.pool, 0)
+}
 
-	infos := make([]vkDescriptorBufferInfoB, len(c.binds))
-	writes := make([]vkWriteDescriptorSetB, len(c.binds))
-	for i, bd := range c.binds {
-		infos[i] = vkDescriptorBufferInfoB{buffer: bd.buf.buffer, rng: uint64(bd.buf.size)}
-		writes[i] = vkWriteDescriptorSetB{
-			sType: vksWriteDS, dstSet: set, dstBinding: uint32(bd.index), descriptorCount: 1,
-			descType: vkDescStorageBuffer, pBufferInfo: uintptr(unsafe.Pointer(&infos[i])),
-		}
+// beginTimestamp records the begin write of a pass's timestamps, if it has
+// any, and keeps them for endTimestamp. The begin write waits for nothing
+// (top of pipe), the end write for all the pass's work (bottom of pipe).
+func (c *vkCmd) beginTimestamp(ts *passTimestamps) {
+	c.ts = ts
+	if ts != nil {
+		c.ops = append(c.ops, vkOp{kind: vkOpTimestamp, query: ts.set.(*vkQuerySet), queryIndex: ts.begin, stage: vkStageTopOfPipe})
 	}
-	purego.SyscallN(b.fn["vkUpdateDescriptorSets"], b.device, uintptr(len(writes)), uintptr(unsafe.Pointer(&writes[0])), 0, 0)
+}
+
+// endTimestamp records the end write of the open pass's timestamps.
+func (c *vkCmd) endTimestamp() {
+	if ts := c.ts; ts != nil {
+		c.ops = append(c.ops, vkOp{kind: vkOpTimestamp, query: ts.set.(*vkQuerySet), queryIndex: ts.end, stage: vkStageBottomOfPipe})
+	}
+	c.ts = nil
+}
+
+// --- submission ---
 
+// submit records one command buffer with rec, submits it and waits for the
+// device to go idle. b.mu must be held.
+func (b *vkBackend) submit(rec func(cmd uintptr)) {
 	purego.SyscallN(b.fn["vkResetCommandPool"], b.device, b.cmdPool, 0)
 	cbai := vkCommandBufferAllocateInfoB{sType: vksCmdBufAlloc, commandPool: b.cmdPool, level: 0, cnt: 1}
 	var cmd uintptr
 	b.c("vkAllocateCommandBuffers", b.device, uintptr(unsafe.Pointer(&cbai)), uintptr(unsafe.Pointer(&cmd)))
 	begin := vkCommandBufferBeginInfoB{sType: vksCmdBegin}
 	b.c("vkBeginCommandBuffer", cmd, uintptr(unsafe.Pointer(&begin)))
-	purego.SyscallN(b.fn["vkCmdBindPipeline"], cmd, vkBindCompute, c.pipe.pipeline)
-	purego.SyscallN(b.fn["vkCmdBindDescriptorSets"], cmd, vkBindCompute, c.pipe.layout, 0, 1, uintptr(unsafe.Pointer(&set)), 0, 0)
-	purego.SyscallN(b.fn["vkCmdDispatch"], cmd, uintptr(c.gx), 1, 1)
+	rec(cmd)
 	b.c("vkEndCommandBuffer", cmd)
 
 	si := vkSubmitInfoB{sType: vksSubmit, cmdCount: 1, pCmd: uintptr(unsafe.Pointer(&cmd))}
-	b.c("vkQueueSubmit", b.queue, 1, uintptr(unsafe.Pointer(&si)), 0)
-	purego.SyscallN(b.fn["vkDeviceWaitIdle"], b.device)
-	purego.SyscallN(b.fn["vkResetDescriptorPool"], b.device, pool, 0)
+	if r, _, _ := purego.SyscallN(b.fn["vkQueueSubmit"], b.queue, 1, uintptr(unsafe.Pointer(&si)), 0); int32(r) != 0 {
+		b.report(vkError("vkQueueSubmit", int32(r)))
+	} else if r, _, _ := purego.SyscallN(b.fn["vkDeviceWaitIdle"], b.device); int32(r) != 0 {
+		b.report(vkError("vkDeviceWaitIdle", int32(r)))
+	}
+	purego.SyscallN(b.fn["vkFreeCommandBuffers"], b.device, b.cmdPool, 1, uintptr(unsafe.Pointer(&cmd)))
+	b.report(b.debugError())
+}
+
+// vkError is the error a failed call returning VkResult r reports.
+func vkError(call string, r int32) error {
+	err := fmt.Errorf("gpu/vk: %s failed: VkResult=%d", call, r)
+	switch r {
+	case vkErrorDeviceLost:
+		return fmt.Errorf("%w: %w", ErrDeviceLost, err)
+	case vkErrorOutOfHostMemory, vkErrorOutOfDeviceMemory:
+		return &Error{Filter: ErrorFilterOutOfMemory, Err: err}
+	}
+	return &Error{Filter: ErrorFilterInternal, Err: err}
+}
+
+func (c *vkCmd) finish() {}
+
+func (c *vkCmd) commit() {
+	if len(c.ops) == 0 {
+		return
+	}
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Build the pipelines the commands use and size the descriptor pool.
+	var ds vkDescriptors
+	for i := range c.ops {
+		op := &c.ops[i]
+		switch op.kind {
+		case vkOpDispatch:
+			if !op.pipe.built {
+				op.pipe.build(op.binds)
+			}
+			ds.count(op.binds)
+		case vkOpRender:
+			for j := range op.pass.draws {
+				d := &op.pass.draws[j]
+				if d.pipe == nil {
+					panic("gpu/vk: draw without a render pipeline")
+				}
+				d.pipe.build(d.binds, d.prim)
+				ds.count(d.binds)
+			}
+		}
+	}
+	ds.alloc(b)
+	defer ds.destroy(b)
+
+	var framebuffers []uintptr
+	b.submit(func(cmd uintptr) {
+		// A query must be reset before it is written again; resetting only
+		// the ones this buffer writes keeps earlier results readable.
+		for _, op := range c.ops {
+			switch {
+			case op.kind == vkOpTimestamp:
+				purego.SyscallN(b.fn["vkCmdResetQueryPool"], cmd, op.query.pool, uintptr(op.queryIndex), 1)
+			case op.kind == vkOpRender && op.pass.info.occlusion != nil:
+				pool := op.pass.info.occlusion.(*vkQuerySet).pool
+				for _, m := range op.pass.queries {
+					if !m.end {
+						purego.SyscallN(b.fn["vkCmdResetQueryPool"], cmd, pool, uintptr(m.index), 1)
+					}
+				}
+			}
+		}
+		barrier := vkMemoryBarrierB{sType: vksMemBarrier, srcAccess: vkAccessMemoryWrite, dstAccess: vkAccessMemoryRead | vkAccessMemoryWrite}
+		for i := range c.ops {
+			op := &c.ops[i]
+			if i > 0 {
+				purego.SyscallN(b.fn["vkCmdPipelineBarrier"], cmd, vkStageAllCommands, vkStageAllCommands, 0, 1, uintptr(unsafe.Pointer(&barrier)), 0, 0, 0, 0)
+			}
+			switch op.kind {
+			case vkOpDispatch:
+				purego.SyscallN(b.fn["vkCmdBindPipeline"], cmd, vkBindCompute, op.pipe.pipeline)
+				if set := ds.set(b, op.pipe.dsl, op.binds); set != 0 {
+					purego.SyscallN(b.fn["vkCmdBindDescriptorSets"], cmd, vkBindCompute, op.pipe.layout, 0, 1, uintptr(unsafe.Pointer(&set)), 0, 0)
+				}
+				if op.indirect != nil {
+					purego.SyscallN(b.fn["vkCmdDispatchIndirect"], cmd, op.indirect.buffer, uintptr(op.offset))
+					break
+				}
+				purego.SyscallN(b.fn["vkCmdDispatch"], cmd, uintptr(op.gx), 1, 1)
+			case vkOpCopyBuffer:
+				purego.SyscallN(b.fn["vkCmdCopyBuffer"], cmd, op.src.buffer, op.dst.buffer, 1, uintptr(unsafe.Pointer(&op.region)))
+			case vkOpCopyBufferToImage:
+				purego.SyscallN(b.fn["vkCmdCopyBufferToImage"], cmd, op.src.buffer, op.dstImg.image, vkLayoutGeneral, 1, uintptr(unsafe.Pointer(&op.imgRegion)))
+			case vkOpCopyImageToBuffer:
+				purego.SyscallN(b.fn["vkCmdCopyImageToBuffer"], cmd, op.srcImg.image, vkLayoutGeneral, op.dst.buffer, 1, uintptr(unsafe.Pointer(&op.imgRegion)))
+			case vkOpCopyImage:
+				purego.SyscallN(b.fn["vkCmdCopyImage"], cmd, op.srcImg.image, vkLayoutGeneral, op.dstImg.image, vkLayoutGeneral, 1, uintptr(unsafe.Pointer(&op.imgCopy)))
+			case vkOpRender:
+				framebuffers = append(framebuffers, b.recordPass(cmd, op.pass, &ds))
+			case vkOpTimestamp:
+				purego.SyscallN(b.fn["vkCmdWriteTimestamp"], cmd, uintptr(op.stage), op.query.pool, uintptr(op.queryIndex))
+			}
+		}
+	})
+	for _, op := range c.ops {
+		switch {
+		case op.kind == vkOpTimestamp:
+			op.query.written[op.queryIndex] = true
+		case op.kind == vkOpRender && op.pass.info.occlusion != nil:
+			q := op.pass.info.occlusion.(*vkQuerySet)
+			for _, m := range op.pass.queries {
+				q.written[m.index] = true
+			}
+		}
+	}
+	for _, fb := range framebuffers {
+		purego.SyscallN(b.fn["vkDestroyFramebuffer"], b.device, fb, 0)
+	}
+	c.ops = nil
+}
+
+// recordPass begins a render pass over p's attachments in a framebuffer it
+// creates (the caller destroys it once the work is done), sets the viewport to
+// the color target and records the draws.
+func (b *vkBackend) recordPass(cmd uintptr, p *vkPass, ds *vkDescriptors) (fb uintptr) {
+	color := p.info.color.(*vkTexture)
+	targets := []*vkTexture{color}
+	for _, ec := range p.info.extraColor {
+		targets = append(targets, ec.tex.(*vkTexture))
+	}
+	var depth *vkTexture
+	if p.info.depth != nil {
+		depth = p.info.depth.(*vkTexture)
+	}
+
+	formats := make([]uint32, len(targets))
+	views := make([]uintptr, 0, len(targets)+1)
+	for i, t := range targets {
+		formats[i] = t.format
+		views = append(views, t.view)
+	}
+	var depthFormat uint32
+	if depth != nil {
+		depthFormat = depth.format
+		views = append(views, depth.view)
+	}
+	// Resolve targets follow the other attachments.
+	resolves := make([]bool, len(targets))
+	for i, r := range append([]backendTexture{p.info.resolve}, colorResolves(p.info.extraColor)...) {
+		if r != nil {
+			resolves[i] = true
+			views = append(views, r.(*vkTexture).view)
+		}
+	}
+	rp := b.renderPass(formats, depthFormat, color.samples, resolves, p.info.load == LoadClear)
+
+	fci := vkFramebufferCreateInfoB{
+		sType: vksFramebuffer, renderPass: rp, attachmentCount: uint32(len(views)), pAttachments: uintptr(unsafe.Pointer(&views[0])),
+		width: uint32(color.w), height: uint32(color.h), layers: 1,
+	}
+	b.c("vkCreateFramebuffer", b.device, uintptr(unsafe.Pointer(&fci)), 0, uintptr(unsafe.Pointer(&fb)))
+
+	// One clear value per attachment, in attachment order; a LoadLoad pass
+	// ignores the color ones.
+	f32 := func(c [4]float64) [4]float32 {
+		return [4]float32{float32(c[0]), float32(c[1]), float32(c[2]), float32(c[3])}
+	}
+	clears := [][4]float32{f32(p.info.clearColor)}
+	for _, ec := range p.info.extraColor {
+		clears = append(clears, f32(ec.clear))
+	}
+	if depth != nil {
+		clears = append(clears, [4]float32{float32(p.info.clearDepth)})
+	}
+	for len(clears) < len(views) {
+		clears = append(clears, [4]float32{})
+	}
+	rpbi := vkRenderPassBeginInfoB{
+		sType: vksPassBegin, renderPass: rp, framebuffer: fb,
+		w: uint32(color.w), h: uint32(color.h),
+		clearValueCount: uint32(len(clears)), pClearValues: uintptr(unsafe.Pointer(&clears[0])),
+	}
+	purego.SyscallN(b.fn["vkCmdBeginRenderPass"], cmd, uintptr(unsafe.Pointer(&rpbi)), 0)
+	vp := vkViewportB{width: float32(color.w), height: float32(color.h), maxDepth: 1}
+	sc := vkRect2DB{w: uint32(color.w), h: uint32(color.h)}
+	purego.SyscallN(b.fn["vkCmdSetViewport"], cmd, 0, 1, uintptr(unsafe.Pointer(&vp)))
+	purego.SyscallN(b.fn["vkCmdSetScissor"], cmd, 0, 1, uintptr(unsafe.Pointer(&sc)))
+
+	// queries emits the occlusion query marks placed before draw i.
+	marks := p.queries
+	queries := func(i int) {
+		for len(marks) > 0 && marks[0].draw == i {
+			pool := p.info.occlusion.(*vkQuerySet).pool
+			if marks[0].end {
+				purego.SyscallN(b.fn["vkCmdEndQuery"], cmd, pool, uintptr(marks[0].index))
+			} else {
+				purego.SyscallN(b.fn["vkCmdBeginQuery"], cmd, pool, uintptr(marks[0].index), 0)
+			}
+			marks = marks[1:]
+		}
+	}
+	for i := range p.draws {
+		queries(i)
+		d := &p.draws[i]
+		purego.SyscallN(b.fn["vkCmdBindPipeline"], cmd, vkBindGraphics, d.pipe.pipelines[d.prim])
+		if set := ds.set(b, d.pipe.dsl, d.binds); set != 0 {
+			purego.SyscallN(b.fn["vkCmdBindDescriptorSets"], cmd, vkBindGraphics, d.pipe.layout, 0, 1, uintptr(unsafe.Pointer(&set)), 0, 0)
+		}
+		switch {
+		case d.index == nil && d.indirect != nil:
+			purego.SyscallN(b.fn["vkCmdDrawIndirect"], cmd, d.indirect.buffer, uintptr(d.offset), 1, 0)
+			continue
+		case d.index == nil:
+			purego.SyscallN(b.fn["vkCmdDraw"], cmd, uintptr(d.count), uintptr(d.instances), uintptr(d.first), uintptr(d.firstInstance))
+			continue
+		}
+		purego.SyscallN(b.fn["vkCmdBindIndexBuffer"], cmd, d.index.buffer, uintptr(d.idxOff), uintptr(d.idxType))
+		if d.indirect != nil {
+			purego.SyscallN(b.fn["vkCmdDrawIndexedIndirect"], cmd, d.indirect.buffer, uintptr(d.offset), 1, 0)
+			continue
+		}
+		purego.SyscallN(b.fn["vkCmdDrawIndexed"], cmd, uintptr(d.count), uintptr(d.instances), uintptr(d.first), uintptr(uint32(int32(d.baseVertex))), uintptr(d.firstInstance))
+	}
+	queries(len(p.draws))
+	purego.SyscallN(b.fn["vkCmdEndRenderPass"], cmd)
+	runtime.KeepAlive(clears)
+	return fb
+}
+
+// renderPass returns the (cached) single-subpass render pass over color
+// attachments of the given formats and an optional depth attachment, all of
+// samples samples, then a single-sampled resolve attachment for each color
+// attachment resolve marks, every one kept in the general layout. Color
+// attachments are cleared or loaded per clear; depth is always cleared, as on
+// GL. Neither load ops nor the resolve attachments of a single subpass affect
+// render pass compatibility, so a pipeline built against the clearing variant
+// without them draws in any. b.mu must be held.
+func (b *vkBackend) renderPass(colors []uint32, depth, samples uint32, resolve []bool, clear bool) uintptr {
+	key := fmt.Sprint(colors, depth, samples, resolve, clear)
+	if rp, ok := b.renderPasses[key]; ok {
+		return rp
+	}
+	load := uint32(vkLoadOpLoad)
+	if clear {
+		load = vkLoadOpClear
+	}
+	var atts []vkAttachmentDescriptionB
+	var refs []vkAttachmentReferenceB
+	for i, f := range colors {
+		atts = append(atts, vkAttachmentDescriptionB{
+			format: f, samples: samples, loadOp: load, storeOp: vkStoreOpStore,
+			stencilLoadOp: vkLoadOpDontCare, stencilStoreOp: vkStoreOpDontCare,
+			initialLayout: vkLayoutGeneral, finalLayout: vkLayoutGeneral,
+		})
+		refs = append(refs, vkAttachmentReferenceB{attachment: uint32(i), layout: vkLayoutGeneral})
+	}
+	sub := vkSubpassDescriptionB{bindPoint: vkBindGraphics, colorCount: uint32(len(refs)), pColor: uintptr(unsafe.Pointer(&refs[0]))}
+	depthRef := vkAttachmentReferenceB{attachment: uint32(len(colors)), layout: vkLayoutGeneral}
+	if depth != 0 {
+		atts = append(atts, vkAttachmentDescriptionB{
+			format: depth, samples: samples, loadOp: vkLoadOpClear, storeOp: vkStoreOpStore,
+			stencilLoadOp: vkLoadOpDontCare, stencilStoreOp: vkStoreOpDontCare,
+			initialLayout: vkLayoutGeneral, finalLayout: vkLayoutGeneral,
+		})
+		sub.pDepth = uintptr(unsafe.Pointer(&depthRef))
+	}
+	var resolveRefs []vkAttachmentReferenceB
+	if slices.Contains(resolve, true) {
+		for i, r := range resolve {
+			ref := vkAttachmentReferenceB{attachment: vkAttachmentUnused, layout: vkLayoutGeneral}
+			if r {
+				ref.attachment = uint32(len(atts))
+				atts = append(atts, vkAttachmentDescriptionB{
+					format: colors[i], samples: vkSamples1, loadOp: vkLoadOpDontCare, storeOp: vkStoreOpStore,
+					stencilLoadOp: vkLoadOpDontCare, stencilStoreOp: vkStoreOpDontCare,
+					initialLayout: vkLayoutGeneral, finalLayout: vkLayoutGeneral,
+				})
+			}
+			resolveRefs = append(resolveRefs, ref)
+		}
+		sub.pResolve = uintptr(unsafe.Pointer(&resolveRefs[0]))
+	}
+	rpci := vkRenderPassCreateInfoB{
+		sType: vksRenderPass, attachmentCount: uint32(len(atts)), pAttachments: uintptr(unsafe.Pointer(&atts[0])),
+		subpassCount: 1, pSubpasses: uintptr(unsafe.Pointer(&sub)),
+	}
+	var rp uintptr
+	b.c("vkCreateRenderPass", b.device, uintptr(unsafe.Pointer(&rpci)), 0, uintptr(unsafe.Pointer(&rp)))
+	runtime.KeepAlive(refs)
+	runtime.KeepAlive(resolveRefs)
+	runtime.KeepAlive(&depthRef)
+	if b.renderPasses == nil {
+		b.renderPasses = map[string]uintptr{}
+	}
+	b.renderPasses[key] = rp
+	return rp
 }
 
 func (b *vkBackend) waitIdle() {
@@ -518,28 +1732,385 @@ func (b *vkBackend) waitIdle() {
 	purego.SyscallN(b.fn["vkDeviceWaitIdle"], b.device)
 }
 
+// onSubmittedWorkDone runs fn right away: commit waits for the device to go
+// idle, so everything submitted has already completed.
+func (b *vkBackend) onSubmittedWorkDone(fn func()) { go fn() }
+
 func (b *vkBackend) close() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	purego.SyscallN(b.fn["vkDeviceWaitIdle"], b.device)
 	purego.SyscallN(b.fn["vkDestroyDevice"], b.device, 0)
+	if b.messenger != 0 {
+		name := cString("vkDestroyDebugUtilsMessengerEXT")
+		if destroy, _, _ := purego.SyscallN(b.fn["vkGetInstanceProcAddr"], b.instance, uintptr(unsafe.Pointer(&name[0]))); destroy != 0 {
+			purego.SyscallN(destroy, b.instance, b.messenger, 0)
+		}
+		vkDebugMu.Lock()
+		for user, db := range vkDebugBackends {
+			if db == b {
+				delete(vkDebugBackends, user)
+			}
+		}
+		vkDebugMu.Unlock()
+	}
 	return nil
 }
 
-// Render / texture / sampler are not implemented on the Vulkan backend yet.
-func (b *vkBackend) newTexture(format TextureFormat, w, h int, renderTarget bool) (backendTexture, error) {
-	return nil, fmt.Errorf("gpu/vk: textures not yet implemented")
+// --- textures ---
+
+// vkTexture is an optimal-tiling image in the general layout, with a view of
+// its first level and layer for use as a render-pass attachment.
+type vkTexture struct {
+	b                   *vkBackend
+	image, memory, view uintptr
+	format              uint32
+	aspect              uint32
+	w, h, bpp           int
+	levels, arrayLayers int    // mip levels and array layers (6 for a cube)
+	volume              bool   // a 3D texture, whose layers are depth slices
+	depth               int    // a 3D texture's depth at level 0
+	samples             uint32 // VkSampleCountFlagBits: the sample count
 }
+
+func (b *vkBackend) newTexture(desc TextureDescriptor) (bt backendTexture, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w, h := desc.Width, desc.Height
+	t := &vkTexture{
+		b: b, format: vkTextureFormat(desc.Format), aspect: vkAspectColor, w: w, h: h,
+		bpp: desc.Format.bytesPerPixel(), levels: desc.MipLevelCount, arrayLayers: desc.DepthOrArrayLayers,
+		volume: desc.Dimension == TextureDimension3D, samples: uint32(desc.SampleCount),
+	}
+	usage := uint32(vkImageUsageTransferSrc | vkImageUsageTransferDst | vkImageUsageSampled)
+	switch desc.Format {
+	case Depth32Float:
+		t.aspect = vkAspectDepth
+		usage |= vkImageUsageDepth
+	case Depth24Stencil8:
+		t.aspect = vkAspectDepth | vkAspectStencil
+		usage |= vkImageUsageDepth
+	default:
+		usage |= vkImageUsageColor
+	}
+	ici := vkImageCreateInfoB{
+		sType: vksImage, imageType: vkImageType2D, format: t.format,
+		width: uint32(w), height: uint32(h), depth: 1, mipLevels: uint32(t.levels), arrayLayers: uint32(t.arrayLayers),
+		samples: t.samples, usage: usage, initialLayout: vkLayoutUndefined,
+	}
+	switch desc.Dimension {
+	case TextureDimension3D:
+		ici.imageType, ici.depth, ici.arrayLayers = vkImageType3D, uint32(t.arrayLayers), 1
+		t.depth, t.arrayLayers = t.arrayLayers, 1
+	case TextureDimensionCube:
+		ici.flags = vkImageCubeCompatible
+	}
+	b.c("vkCreateImage", b.device, uintptr(unsafe.Pointer(&ici)), 0, uintptr(unsafe.Pointer(&t.image)))
+	var req vkMemoryRequirementsB
+	purego.SyscallN(b.fn["vkGetImageMemoryRequirements"], b.device, t.image, uintptr(unsafe.Pointer(&req)))
+	mai := vkMemoryAllocateInfoB{sType: vksMemAlloc, allocationSize: req.size, memoryTypeIdx: b.deviceMemType(req.memoryTypeBits)}
+	b.c("vkAllocateMemory", b.device, uintptr(unsafe.Pointer(&mai)), 0, uintptr(unsafe.Pointer(&t.memory)))
+	b.c("vkBindImageMemory", b.device, t.image, t.memory, 0)
+	if desc.Dimension == TextureDimension2D {
+		ivci := vkImageViewCreateInfoB{
+			sType: vksImageView, image: t.image, viewType: vkImageType2D, format: t.format,
+			rng: vkSubresourceRangeB{aspectMask: t.aspect, levelCount: 1, layerCount: 1},
+		}
+		b.c("vkCreateImageView", b.device, uintptr(unsafe.Pointer(&ivci)), 0, uintptr(unsafe.Pointer(&t.view)))
+	}
+
+	// Move the image to the general layout it keeps for its whole life.
+	b.submit(func(cmd uintptr) {
+		ib := vkImageMemoryBarrierB{
+			sType: vksImgBarrier, dstAccess: vkAccessMemoryRead | vkAccessMemoryWrite,
+			oldLayout: vkLayoutUndefined, newLayout: vkLayoutGeneral,
+			srcQ: vkQueueFamilyIgnored, dstQ: vkQueueFamilyIgnored, image: t.image, rng: t.subresources(),
+		}
+		purego.SyscallN(b.fn["vkCmdPipelineBarrier"], cmd, vkStageAllCommands, vkStageAllCommands, 0, 0, 0, 0, 0, 1, uintptr(unsafe.Pointer(&ib)))
+	})
+	return t, nil
+}
+
+func (t *vkTexture) release() {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	purego.SyscallN(t.b.fn["vkDestroyImageView"], t.b.device, t.view, 0)
+	purego.SyscallN(t.b.fn["vkDestroyImage"], t.b.device, t.image, 0)
+	purego.SyscallN(t.b.fn["vkFreeMemory"], t.b.device, t.memory, 0)
+}
+
+func (t *vkTexture) subresources() vkSubresourceRangeB {
+	return vkSubresourceRangeB{aspectMask: t.aspect, levelCount: uint32(t.levels), layerCount: uint32(t.arrayLayers)}
+}
+
+// layers returns level 0, layer 0 of the image for a copy, which names the
+// depth aspect alone of a depth-stencil image.
+func (t *vkTexture) layers() vkSubresourceLayersB {
+	return t.level(0, 0)
+}
+
+// level returns level and array layer of the image for a copy.
+func (t *vkTexture) level(level, layer int) vkSubresourceLayersB {
+	return vkSubresourceLayersB{aspectMask: t.aspect &^ vkAspectStencil, mipLevel: uint32(level), baseArrayLayer: uint32(layer), layerCount: 1}
+}
+
+// region is the buffer<->image copy of a w x h block at (x, y) whose buffer
+// rows start at offset and are bytesPerRow apart.
+func (t *vkTexture) region(offset, bytesPerRow, x, y, w, h int) vkBufferImageCopyB {
+	return vkBufferImageCopyB{
+		bufferOffset: uint64(offset), bufferRowLength: uint32(bytesPerRow / t.bpp),
+		sub: t.layers(), x: int32(x), y: int32(y), w: uint32(w), h: uint32(h), d: 1,
+	}
+}
+
+// levelRegion is the tightly packed buffer<->image copy of the w x h image
+// of level and layer, a depth slice of a 3D image.
+func (t *vkTexture) levelRegion(level, layer, w, h int) vkBufferImageCopyB {
+	r := vkBufferImageCopyB{sub: t.level(level, layer), w: uint32(w), h: uint32(h), d: 1}
+	if t.volume {
+		r.sub.baseArrayLayer, r.z = 0, int32(layer)
+	}
+	return r
+}
+
+// readPixels copies the image out through a staging buffer and flips its rows
+// top-down, as the GL backend does for its bottom-up storage.
+func (t *vkTexture) readPixels() []byte {
+	b := t.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	row := t.w * t.bpp
+	staging := b.allocBuffer(row * t.h)
+	defer staging.free()
+	region := t.region(0, row, 0, 0, t.w, t.h)
+	b.submit(func(cmd uintptr) {
+		purego.SyscallN(b.fn["vkCmdCopyImageToBuffer"], cmd, t.image, vkLayoutGeneral, staging.buffer, 1, uintptr(unsafe.Pointer(&region)))
+	})
+	src := unsafe.Slice((*byte)(staging.ptr), row*t.h)
+	out := make([]byte, len(src))
+	for y := 0; y < t.h; y++ {
+		copy(out[y*row:(y+1)*row], src[(t.h-1-y)*row:(t.h-y)*row])
+	}
+	return out
+}
+
+func (t *vkTexture) readLevel(level, layer, w, h int) []byte {
+	b := t.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := w * h * t.bpp
+	staging := b.allocBuffer(n)
+	defer staging.free()
+	region := t.levelRegion(level, layer, w, h)
+	b.submit(func(cmd uintptr) {
+		purego.SyscallN(b.fn["vkCmdCopyImageToBuffer"], cmd, t.image, vkLayoutGeneral, staging.buffer, 1, uintptr(unsafe.Pointer(&region)))
+	})
+	return slices.Clone(unsafe.Slice((*byte)(staging.ptr), n))
+}
+
+func (t *vkTexture) writeLevel(level, layer, w, h int, pixels []byte) {
+	b := t.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	staging := b.allocBuffer(len(pixels))
+	defer staging.free()
+	copy(unsafe.Slice((*byte)(staging.ptr), len(pixels)), pixels)
+	region := t.levelRegion(level, layer, w, h)
+	b.submit(func(cmd uintptr) {
+		purego.SyscallN(b.fn["vkCmdCopyBufferToImage"], cmd, staging.buffer, t.image, vkLayoutGeneral, 1, uintptr(unsafe.Pointer(&region)))
+	})
+}
+
+// generateMipmaps blits each level, every layer at once, to the next with
+// linear filtering, a barrier between levels.
+func (t *vkTexture) generateMipmaps() {
+	b := t.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.submit(func(cmd uintptr) {
+		size := func(level int) [3]int32 {
+			d := 1
+			if t.volume {
+				d = mipSize(t.depth, level)
+			}
+			return [3]int32{int32(mipSize(t.w, level)), int32(mipSize(t.h, level)), int32(d)}
+		}
+		for level := 1; level < t.levels; level++ {
+			ib := vkImageMemoryBarrierB{
+				sType: vksImgBarrier, srcAccess: vkAccessMemoryWrite, dstAccess: vkAccessMemoryRead | vkAccessMemoryWrite,
+				oldLayout: vkLayoutGeneral, newLayout: vkLayoutGeneral,
+				srcQ: vkQueueFamilyIgnored, dstQ: vkQueueFamilyIgnored, image: t.image, rng: t.subresources(),
+			}
+			purego.SyscallN(b.fn["vkCmdPipelineBarrier"], cmd, vkStageAllCommands, vkStageAllCommands, 0, 0, 0, 0, 0, 1, uintptr(unsafe.Pointer(&ib)))
+			src, dst := t.level(level-1, 0), t.level(level, 0)
+			src.layerCount, dst.layerCount = uint32(t.arrayLayers), uint32(t.arrayLayers)
+			blit := vkImageBlitB{
+				srcSub: src, srcOffsets: [2][3]int32{{}, size(level - 1)},
+				dstSub: dst, dstOffsets: [2][3]int32{{}, size(level)},
+			}
+			purego.SyscallN(b.fn["vkCmdBlitImage"], cmd, t.image, vkLayoutGeneral, t.image, vkLayoutGeneral, 1, uintptr(unsafe.Pointer(&blit)), vkFilterLinear)
+		}
+	})
+}
+
+// newSampler: samplers are not used by the Vulkan backend yet (no sampled
+// textures in its passes).
 func (b *vkBackend) newSampler(desc SamplerDescriptor) backendSampler { return nil }
-func (b *vkBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat) (backendRenderPipeline, error) {
-	return nil, fmt.Errorf("gpu/vk: render pipelines not yet implemented")
+
+// --- render pipelines ---
+
+// vkRenderPipeline holds the shader stages and state of a render pipeline.
+// Its layout is built at first draw, once the bindings are known (as for
+// compute), and one VkPipeline per primitive topology as draws need them,
+// since the topology is pipeline state in Vulkan but per-draw in the gpu API.
+type vkRenderPipeline struct {
+	b          *vkBackend
+	vmod, fmod uintptr
+	entry      []byte
+	colors     []uint32
+	depth      uint32
+	state      renderState
+
+	dsl, layout uintptr
+	nbind       int
+	pipelines   [PointList + 1]uintptr
 }
 
-func (c *vkCmd) beginRender(info renderPassInfo)               {}
-func (c *vkCmd) setRenderPipeline(backendRenderPipeline)       {}
-func (c *vkCmd) setRenderBuffer(backendBuffer, int, int)       {}
-func (c *vkCmd) setVertexBuffer(backendBuffer, int)            {}
-func (c *vkCmd) draw(prim Primitive, start, count int)         {}
-func (c *vkCmd) endRender()                                    {}
-func (c *vkCmd) setComputeTexture(index int, t backendTexture) {}
-func (c *vkCmd) setComputeSampler(index int, s backendSampler) {}
+func (p *vkRenderPipeline) release() {
+	b := p.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pl := range p.pipelines {
+		if pl != 0 {
+			purego.SyscallN(b.fn["vkDestroyPipeline"], b.device, pl, 0)
+		}
+	}
+	if p.layout != 0 {
+		b.destroyLayout(p.dsl, p.layout)
+	}
+}
+
+func vkTextureFormat(f TextureFormat) uint32 {
+	switch f {
+	case RGBA32Float:
+		return vkFormatRGBA32Float
+	case Depth32Float:
+		return vkFormatD32Float
+	case R8Unorm:
+		return vkFormatR8Unorm
+	case RG16Float:
+		return vkFormatRG16Float
+	case RGBA16Float:
+		return vkFormatRGBA16Float
+	case R32Float:
+		return vkFormatR32Float
+	case Depth24Stencil8:
+		return vkFormatD24UnormS8Uint
+	case BGRA8UnormSRGB:
+		return vkFormatBGRA8SRGB
+	case FormatNone:
+		return 0
+	}
+	return vkFormatRGBA8Unorm
+}
+
+func (b *vkBackend) newRenderPipeline(vmod backendShaderModule, ventry string, fmod backendShaderModule, fentry string, color TextureFormat, extraColor []TextureFormat, depth TextureFormat, state renderState) (backendRenderPipeline, error) {
+	vm, ok1 := vmod.(vkModule)
+	fm, ok2 := fmod.(vkModule)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("gpu/vk: render pipeline shader modules are not Vulkan modules")
+	}
+	if color == FormatNone {
+		color = RGBA8Unorm
+	}
+	p := &vkRenderPipeline{
+		b: b, vmod: vm.module, fmod: fm.module,
+		// As for compute, every stage's SPIR-V entry point is named "main".
+		entry: append([]byte("main"), 0),
+		depth: vkTextureFormat(depth), state: state,
+	}
+	p.colors = append(p.colors, vkTextureFormat(color))
+	for _, f := range extraColor {
+		p.colors = append(p.colors, vkTextureFormat(f))
+	}
+	return p, nil
+}
+
+// build creates the pipeline layout (first call) and the pipeline for prim
+// (first draw of that primitive). b.mu must be held.
+func (p *vkRenderPipeline) build(binds []vkBufBind, prim Primitive) {
+	b := p.b
+	if p.layout == 0 {
+		p.dsl, p.layout, p.nbind = b.setLayout(binds, vkStageVertex|vkStageFragment)
+	}
+	if p.pipelines[prim] != 0 {
+		return
+	}
+
+	stages := [2]vkShaderStageCreateInfoB{
+		{sType: vksShaderStage, stage: vkStageVertex, module: p.vmod, pName: uintptr(unsafe.Pointer(&p.entry[0]))},
+		{sType: vksShaderStage, stage: vkStageFragment, module: p.fmod, pName: uintptr(unsafe.Pointer(&p.entry[0]))},
+	}
+	vertexInput := vkPipelineVertexInputStateB{sType: vksVertexInput}
+	topology := [...]uint32{TriangleList: vkTopologyTriList, TriangleStrip: vkTopologyTriStrip, LineList: vkTopologyLines, PointList: vkTopologyPoints}[prim]
+	inputAsm := vkPipelineInputAssemblyStateB{sType: vksInputAsm, topology: topology}
+	viewport := vkPipelineViewportStateB{sType: vksViewport, viewportCount: 1, scissorCount: 1}
+
+	// The viewport maps NDC as GL does (see the file comment), so a winding
+	// that is counter-clockwise in NDC is clockwise by Vulkan's framebuffer
+	// convention.
+	raster := vkPipelineRasterizationStateB{sType: vksRaster, cullMode: uint32(p.state.cull), frontFace: vkFrontCW, lineWidth: 1}
+	if p.state.frontFace == FrontCW {
+		raster.frontFace = vkFrontCCW
+	}
+	multisample := vkPipelineMultisampleStateB{sType: vksMultisample, samples: uint32(p.state.samples)}
+	depthState := vkPipelineDepthStencilStateB{sType: vksDepthState}
+	if p.depth != 0 {
+		depthState.depthTest = 1
+		depthState.depthCompare = uint32(p.state.depthCompare) - 1 // VkCompareOp starts at NEVER
+		if p.state.depthWrite {
+			depthState.depthWrite = 1
+		}
+	}
+	blends := make([]vkColorBlendAttachmentB, len(p.colors))
+	for i := range blends {
+		blends[i].writeMask = uint32(p.state.colorWrite) // VkColorComponentFlags: R, G, B, A bits as ColorWriteMask
+		if i < len(p.state.blend) && p.state.blend[i] != nil {
+			bs := p.state.blend[i]
+			blends[i].blendEnable = 1
+			blends[i].srcColor, blends[i].dstColor = vkBlendFactor(bs.Color.SrcFactor), vkBlendFactor(bs.Color.DstFactor)
+			blends[i].colorOp = uint32(bs.Color.Operation)
+			blends[i].srcAlpha, blends[i].dstAlpha = vkBlendFactor(bs.Alpha.SrcFactor), vkBlendFactor(bs.Alpha.DstFactor)
+			blends[i].alphaOp = uint32(bs.Alpha.Operation)
+		}
+	}
+	blend := vkPipelineColorBlendStateB{sType: vksBlendState, attachmentCount: uint32(len(blends)), pAttachments: uintptr(unsafe.Pointer(&blends[0]))}
+	dynStates := [2]uint32{vkDynamicViewport, vkDynamicScissor}
+	dynamic := vkPipelineDynamicStateB{sType: vksDynamic, count: 2, pStates: uintptr(unsafe.Pointer(&dynStates[0]))}
+
+	gpci := vkGraphicsPipelineCreateInfoB{
+		sType: vksGraphicsPip, stageCount: 2, pStages: uintptr(unsafe.Pointer(&stages[0])),
+		pVertexInput: uintptr(unsafe.Pointer(&vertexInput)), pInputAssembly: uintptr(unsafe.Pointer(&inputAsm)),
+		pViewport: uintptr(unsafe.Pointer(&viewport)), pRasterization: uintptr(unsafe.Pointer(&raster)),
+		pMultisample: uintptr(unsafe.Pointer(&multisample)), pDepthStencil: uintptr(unsafe.Pointer(&depthState)),
+		pColorBlend: uintptr(unsafe.Pointer(&blend)), pDynamic: uintptr(unsafe.Pointer(&dynamic)),
+		layout: p.layout, renderPass: b.renderPass(p.colors, p.depth, uint32(p.state.samples), nil, true), baseIndex: -1,
+	}
+	b.c("vkCreateGraphicsPipelines", b.device, 0, 1, uintptr(unsafe.Pointer(&gpci)), 0, uintptr(unsafe.Pointer(&p.pipelines[prim])))
+	runtime.KeepAlive(blends)
+}
+
+// vkBlendFactor maps a BlendFactor to its VkBlendFactor; Vulkan orders the
+// destination factors before the alpha ones.
+func vkBlendFactor(f BlendFactor) uint32 {
+	return [...]uint32{
+		BlendZero: 0, BlendOne: 1, BlendSrc: 2, BlendOneMinusSrc: 3,
+		BlendDst: 4, BlendOneMinusDst: 5, BlendSrcAlpha: 6, BlendOneMinusSrcAlpha: 7,
+		BlendDstAlpha: 8, BlendOneMinusDstAlpha: 9,
+	}[f]
+}
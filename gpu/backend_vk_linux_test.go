@@ -87,11 +87,14 @@ void main() { uint i = gl_GlobalInvocationID.x; o[i] = a[i] + b[i]; }`)
 	aBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(a), Usage: gpu.BufferStorage})
 	bBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(b), Usage: gpu.BufferStorage})
 	oBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage})
-	bg := dev.NewBindGroup(layout,
+	bg, err := dev.NewBindGroup(layout,
 		gpu.BindGroupEntry{Binding: 0, Buffer: aBuf},
 		gpu.BindGroupEntry{Binding: 1, Buffer: bBuf},
 		gpu.BindGroupEntry{Binding: 2, Buffer: oBuf},
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	pass := enc.BeginComputePass()
@@ -110,3 +113,42 @@ void main() { uint i = gl_GlobalInvocationID.x; o[i] = a[i] + b[i]; }`)
 	}
 	t.Logf("Vulkan backend through the Device API: %d/%d add results match the CPU", n, n)
 }
+
+// TestVulkanBackendCopy chains buffer copies in one submission: a -> b at an
+// offset, then b -> c, so the second copy must see the first one's write.
+func TestVulkanBackendCopy(t *testing.T) {
+	if os.Getenv("POLYRED_VK_PROBE") != "1" {
+		t.Skip("set POLYRED_VK_PROBE=1 to run the Vulkan backend conformance test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverVulkan))
+	if err != nil {
+		t.Skipf("no Vulkan device: %v", err)
+	}
+	defer dev.Close()
+
+	const n, shift = 256, 16
+	a := make([]float32, n)
+	for i := range a {
+		a[i] = float32(i) + 0.5
+	}
+	aBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(a), Usage: gpu.BufferStorage | gpu.BufferCopySrc})
+	bBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage | gpu.BufferCopySrc | gpu.BufferCopyDst})
+	cBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferCopyDst | gpu.BufferMapRead})
+
+	enc := dev.NewCommandEncoder()
+	enc.CopyBufferToBuffer(aBuf, 0, bBuf, shift*4, (n-shift)*4)
+	enc.CopyBufferToBuffer(bBuf, 0, cBuf, 0, n*4)
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := glFloatsOf(cBuf.Bytes(), n)
+	for i := range got {
+		want := float32(0)
+		if i >= shift {
+			want = a[i-shift]
+		}
+		if got[i] != want {
+			t.Fatalf("Vulkan copy c[%d] = %v, want %v", i, got[i], want)
+		}
+	}
+}
@@ -117,10 +117,13 @@ func TestDeviceCompute_Add(t *testing.T) {
 	m2 := math.NewRandMat[float32](10, 10)
 	n := len(m1.Data)
 	a, b, out := h.buf(t, m1.Data), h.buf(t, m2.Data), h.outBuf(t, n)
-	bg := h.dev.NewBindGroup(h.lay3,
+	bg, err := h.dev.NewBindGroup(h.lay3,
 		gpu.BindGroupEntry{Binding: 0, Buffer: a},
 		gpu.BindGroupEntry{Binding: 1, Buffer: b},
 		gpu.BindGroupEntry{Binding: 2, Buffer: out})
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := math.Mat[float32]{Row: 10, Col: 10, Data: h.run(t, "add0", h.lay3, bg, n, n, out)}
 	if !got.EqEps(m1.Add(m2), gpuEps) {
 		t.Fatalf("Add through Device API != CPU\nGPU=%v\nCPU=%v", got, m1.Add(m2))
@@ -134,10 +137,13 @@ func TestDeviceCompute_Sub(t *testing.T) {
 	m2 := math.NewRandMat[float32](10, 10)
 	n := len(m1.Data)
 	a, b, out := h.buf(t, m1.Data), h.buf(t, m2.Data), h.outBuf(t, n)
-	bg := h.dev.NewBindGroup(h.lay3,
+	bg, err := h.dev.NewBindGroup(h.lay3,
 		gpu.BindGroupEntry{Binding: 0, Buffer: a},
 		gpu.BindGroupEntry{Binding: 1, Buffer: b},
 		gpu.BindGroupEntry{Binding: 2, Buffer: out})
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := math.Mat[float32]{Row: 10, Col: 10, Data: h.run(t, "sub0", h.lay3, bg, n, n, out)}
 	if !got.EqEps(m1.Sub(m2), gpuEps) {
 		t.Fatalf("Sub through Device API != CPU")
@@ -150,9 +156,12 @@ func TestDeviceCompute_Sqrt(t *testing.T) {
 	m1 := math.NewRandMat[float32](10, 10)
 	n := len(m1.Data)
 	a, out := h.buf(t, m1.Data), h.outBuf(t, n)
-	bg := h.dev.NewBindGroup(h.lay2,
+	bg, err := h.dev.NewBindGroup(h.lay2,
 		gpu.BindGroupEntry{Binding: 0, Buffer: a},
 		gpu.BindGroupEntry{Binding: 1, Buffer: out})
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := math.Mat[float32]{Row: 10, Col: 10, Data: h.run(t, "sqrt0", h.lay2, bg, n, n, out)}
 	if !got.EqEps(m1.Sqrt(), gpuEps) {
 		t.Fatalf("Sqrt through Device API != CPU")
@@ -176,11 +185,14 @@ func TestDeviceCompute_Mul(t *testing.T) {
 	if err != nil {
 		t.Fatalf("params buffer: %v", err)
 	}
-	bg := h.dev.NewBindGroup(h.lay4,
+	bg, err := h.dev.NewBindGroup(h.lay4,
 		gpu.BindGroupEntry{Binding: 0, Buffer: a},
 		gpu.BindGroupEntry{Binding: 1, Buffer: b},
 		gpu.BindGroupEntry{Binding: 2, Buffer: out},
 		gpu.BindGroupEntry{Binding: 3, Buffer: pbuf})
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := math.Mat[float32]{Row: 10, Col: 10, Data: h.run(t, "mul0", h.lay4, bg, m2.Col*m1.Row, n, out)}
 	if !got.EqEps(m1.Mul(m2), gpuEps) {
 		t.Fatalf("Mul through Device API != CPU")
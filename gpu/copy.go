@@ -0,0 +1,123 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import "fmt"
+
+// ImageCopyBuffer is the buffer side of a buffer<->texture copy: pixel rows
+// start at Offset and are BytesPerRow apart. A zero BytesPerRow means the rows
+// are tightly packed (width times the texture's bytes per pixel).
+type ImageCopyBuffer struct {
+	Buffer      *Buffer
+	Offset      int
+	BytesPerRow int
+}
+
+// ImageCopyTexture is the texture side of a copy: the texel (X, Y) the copied
+// region starts at.
+//
+// Rows are counted in the texture's storage order, the order Texture.Write
+// uploads them in. That is top-down on Metal, but a GL or Vulkan render target
+// is stored bottom-up (ReadPixels flips it), so there row 0 of a rendered image
+// is its bottom row. Copies never flip, so a chain of copies and passes agrees with
+// itself on every backend.
+//
+// Copies address mip level 0 of a 2D texture.
+type ImageCopyTexture struct {
+	Texture *Texture
+	X, Y    int
+}
+
+// bytesPerPixel is the size of one texel of format f.
+func (f TextureFormat) bytesPerPixel() int {
+	switch f {
+	case R8Unorm:
+		return 1
+	case RGBA16Float:
+		return 8
+	case RGBA32Float:
+		return 16
+	}
+	return 4
+}
+
+// CopyBufferToBuffer copies size bytes from src at srcOffset to dst at
+// dstOffset. The copy is ordered with the passes recorded around it, so a
+// later pass sees its result.
+func (e *CommandEncoder) CopyBufferToBuffer(src *Buffer, srcOffset int, dst *Buffer, dstOffset, size int) {
+	if srcOffset < 0 || dstOffset < 0 || size < 0 || srcOffset+size > src.size || dstOffset+size > dst.size {
+		panic(fmt.Sprintf("gpu: CopyBufferToBuffer of %d bytes out of range (src %d+%d, dst %d+%d)", size, srcOffset, src.size, dstOffset, dst.size))
+	}
+	if size == 0 {
+		return
+	}
+	e.cmd.copyBufferToBuffer(src.b, srcOffset, dst.b, dstOffset, size)
+}
+
+// CopyBufferToTexture copies a width x height region of pixels from a buffer
+// into a texture.
+func (e *CommandEncoder) CopyBufferToTexture(src ImageCopyBuffer, dst ImageCopyTexture, width, height int) {
+	bpr := checkImageCopy("CopyBufferToTexture", src, dst, width, height)
+	if width == 0 || height == 0 {
+		return
+	}
+	e.cmd.copyBufferToTexture(src.Buffer.b, src.Offset, bpr, dst.Texture.b, dst.X, dst.Y, width, height)
+}
+
+// CopyTextureToBuffer copies a width x height region of a texture into a
+// buffer.
+func (e *CommandEncoder) CopyTextureToBuffer(src ImageCopyTexture, dst ImageCopyBuffer, width, height int) {
+	bpr := checkImageCopy("CopyTextureToBuffer", dst, src, width, height)
+	if width == 0 || height == 0 {
+		return
+	}
+	e.cmd.copyTextureToBuffer(src.Texture.b, src.X, src.Y, dst.Buffer.b, dst.Offset, bpr, width, height)
+}
+
+// CopyTextureToTexture copies a width x height region between two textures of
+// the same format.
+func (e *CommandEncoder) CopyTextureToTexture(src, dst ImageCopyTexture, width, height int) {
+	if src.Texture.format != dst.Texture.format {
+		panic("gpu: CopyTextureToTexture between textures of different formats")
+	}
+	checkTextureRegion("CopyTextureToTexture", src, width, height)
+	checkTextureRegion("CopyTextureToTexture", dst, width, height)
+	if width == 0 || height == 0 {
+		return
+	}
+	e.cmd.copyTextureToTexture(src.Texture.b, src.X, src.Y, dst.Texture.b, dst.X, dst.Y, width, height)
+}
+
+// checkImageCopy validates a buffer<->texture copy and returns its buffer row
+// pitch in bytes.
+func checkImageCopy(op string, buf ImageCopyBuffer, tex ImageCopyTexture, width, height int) int {
+	checkTextureRegion(op, tex, width, height)
+	row := width * tex.Texture.format.bytesPerPixel()
+	bpr := buf.BytesPerRow
+	if bpr == 0 {
+		bpr = row
+	}
+	if bpr < row || bpr%tex.Texture.format.bytesPerPixel() != 0 {
+		panic(fmt.Sprintf("gpu: %s BytesPerRow %d is not a whole number of pixels of at least a %d-byte row", op, bpr, row))
+	}
+	if height > 0 && (buf.Offset < 0 || buf.Offset+bpr*(height-1)+row > buf.Buffer.size) {
+		panic(fmt.Sprintf("gpu: %s of %d rows at offset %d overruns a %d-byte buffer", op, height, buf.Offset, buf.Buffer.size))
+	}
+	return bpr
+}
+
+func checkTextureRegion(op string, t ImageCopyTexture, width, height int) {
+	switch {
+	case t.Texture.dim != TextureDimension2D:
+		panic(fmt.Sprintf("gpu: %s of a %v texture", op, t.Texture.dim))
+	case t.Texture.format == Depth24Stencil8:
+		panic(fmt.Sprintf("gpu: %s of a Depth24Stencil8 texture, whose layout is backend-specific", op))
+	case t.Texture.samples != 1:
+		panic(fmt.Sprintf("gpu: %s of a multisampled texture", op))
+	}
+	if t.X < 0 || t.Y < 0 || width < 0 || height < 0 || t.X+width > t.Texture.w || t.Y+height > t.Texture.h {
+		panic(fmt.Sprintf("gpu: %s region %dx%d at (%d,%d) outside a %dx%d texture", op, width, height, t.X, t.Y, t.Texture.w, t.Texture.h))
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// Copy-command conformance for the Metal backend: a buffer copy chains two
+// compute dispatches inside one command buffer, and a buffer -> texture ->
+// texture -> buffer round trip moves a sub-region with padded row pitches.
+package gpu_test
+
+import (
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+func TestMetalCopy(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverMetal))
+	if err != nil {
+		t.Skipf("no Metal device: %v", err)
+	}
+	defer dev.Close()
+
+	t.Run("BufferChain", func(t *testing.T) {
+		ks, err := shader.Compile(`package kernels
+func Double(gid uint, in []float32, out []float32) { out[gid] = in[gid] * 2.0 }`)
+		if err != nil {
+			t.Fatalf("Compile: %v", err)
+		}
+		mod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: ks["Double"].MSL})
+		if err != nil {
+			t.Fatalf("NewShaderModule: %v", err)
+		}
+		layout := dev.NewBindGroupLayout(
+			gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+			gpu.BindGroupLayoutEntry{Binding: 1, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+		)
+		pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "Double"})
+		if err != nil {
+			t.Fatalf("NewComputePipeline: %v", err)
+		}
+
+		const n, shift = 64, 4
+		in := make([]float32, n)
+		for i := range in {
+			in[i] = float32(i) + 1
+		}
+		newBuf := func(data []float32) *gpu.Buffer {
+			b, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Data: bytesOf(data), Usage: gpu.BufferStorage | gpu.BufferCopySrc | gpu.BufferCopyDst})
+			if err != nil {
+				t.Fatalf("NewBuffer: %v", err)
+			}
+			return b
+		}
+		a, b, c, d := newBuf(in), newBuf(nil), newBuf(make([]float32, n)), newBuf(nil)
+
+		enc := dev.NewCommandEncoder()
+		for _, step := range []struct{ in, out *gpu.Buffer }{{a, b}, {c, d}} {
+			pass := enc.BeginComputePass()
+			pass.SetPipeline(pipe)
+			bg, err := dev.NewBindGroup(layout,
+				gpu.BindGroupEntry{Binding: 0, Buffer: step.in},
+				gpu.BindGroupEntry{Binding: 1, Buffer: step.out})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pass.SetBindGroup(0, bg)
+			pass.Dispatch(n, 1, 1)
+			pass.End()
+			if step.out == b {
+				enc.CopyBufferToBuffer(b, 0, c, shift*4, (n-shift)*4)
+			}
+		}
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+
+		got := floatsOf(d.Bytes(), n)
+		for i := range got {
+			want := float32(0)
+			if i >= shift {
+				want = in[i-shift] * 4
+			}
+			if got[i] != want {
+				t.Fatalf("d[%d] = %v, want %v", i, got[i], want)
+			}
+		}
+	})
+
+	t.Run("Texture", func(t *testing.T) {
+		const size, w, h = 8, 3, 2
+		const pitch, offset = 64, 16
+		newTex := func() *gpu.Texture {
+			tex, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: size, Height: size})
+			if err != nil {
+				t.Fatalf("NewTexture: %v", err)
+			}
+			return tex
+		}
+		src, dst := newTex(), newTex()
+		up := make([]byte, offset+pitch*h)
+		for y := 0; y < h; y++ {
+			for i := 0; i < w*4; i++ {
+				up[offset+y*pitch+i] = byte(1 + y*w*4 + i)
+			}
+		}
+		upBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: up, Usage: gpu.BufferCopySrc})
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+		down, err := dev.NewBuffer(gpu.BufferDescriptor{Size: offset + pitch*h, Usage: gpu.BufferCopyDst | gpu.BufferMapRead})
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+
+		enc := dev.NewCommandEncoder()
+		enc.CopyBufferToTexture(gpu.ImageCopyBuffer{Buffer: upBuf, Offset: offset, BytesPerRow: pitch}, gpu.ImageCopyTexture{Texture: src, X: 2, Y: 5}, w, h)
+		enc.CopyTextureToTexture(gpu.ImageCopyTexture{Texture: src, X: 2, Y: 5}, gpu.ImageCopyTexture{Texture: dst, X: 4, Y: 1}, w, h)
+		enc.CopyTextureToBuffer(gpu.ImageCopyTexture{Texture: dst, X: 4, Y: 1}, gpu.ImageCopyBuffer{Buffer: down, Offset: offset, BytesPerRow: pitch}, w, h)
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+
+		got := down.Bytes()
+		pix := dst.ReadPixels() // top-down, the Metal storage order
+		for y := 0; y < h; y++ {
+			for i := 0; i < w*4; i++ {
+				want := up[offset+y*pitch+i]
+				if g := got[offset+y*pitch+i]; g != want {
+					t.Fatalf("buffer row %d byte %d = %d, want %d", y, i, g, want)
+				}
+				if g := pix[((1+y)*size+4)*4+i]; g != want {
+					t.Fatalf("ReadPixels row %d byte %d = %d, want %d", y, i, g, want)
+				}
+			}
+		}
+	})
+}
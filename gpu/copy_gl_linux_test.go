@@ -0,0 +1,173 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Copy-command conformance for the GL backend: a buffer copy chains two
+// compute dispatches inside one command buffer (no CPU readback between them),
+// and a buffer -> texture -> texture -> buffer round trip moves sub-regions
+// with padded row pitches for 8-bit and float textures. Runs in CI on Mesa
+// llvmpipe (software, surfaceless).
+package gpu_test
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+func TestGLCopy(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL copy test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	t.Run("BufferChain", func(t *testing.T) { testGLCopyBufferChain(t, dev) })
+	t.Run("TextureRGBA8", func(t *testing.T) { testGLCopyTexture(t, dev, gpu.RGBA8Unorm, 4) })
+	t.Run("TextureRGBA32Float", func(t *testing.T) { testGLCopyTexture(t, dev, gpu.RGBA32Float, 16) })
+}
+
+// testGLCopyBufferChain doubles a into b, copies b (shifted by 4 elements)
+// into c, doubles c into d, and copies d into a staging buffer, all in one
+// submission.
+func testGLCopyBufferChain(t *testing.T, dev *gpu.Device) {
+	const src = `package kernels
+func Double(gid uint, in []float32, out []float32) { out[gid] = in[gid] * 2.0 }`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: ks["Double"].GLSL})
+	if err != nil {
+		t.Fatalf("NewShaderModule: %v", err)
+	}
+	layout := dev.NewBindGroupLayout(
+		gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+		gpu.BindGroupLayoutEntry{Binding: 1, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+	)
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "Double"})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+
+	const n, shift = 64, 4
+	in := make([]float32, n)
+	for i := range in {
+		in[i] = float32(i) + 1
+	}
+	newBuf := func(data []float32) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Data: glBytesOf(data), Usage: gpu.BufferStorage | gpu.BufferCopySrc | gpu.BufferCopyDst})
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+		return b
+	}
+	a, b, c, d, staging := newBuf(in), newBuf(nil), newBuf(make([]float32, n)), newBuf(nil), newBuf(nil)
+
+	enc := dev.NewCommandEncoder()
+	for _, step := range []struct{ in, out *gpu.Buffer }{{a, b}, {c, d}} {
+		pass := enc.BeginComputePass()
+		pass.SetPipeline(pipe)
+		bg, err := dev.NewBindGroup(layout,
+			gpu.BindGroupEntry{Binding: 0, Buffer: step.in},
+			gpu.BindGroupEntry{Binding: 1, Buffer: step.out})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pass.SetBindGroup(0, bg)
+		pass.Dispatch(n, 1, 1)
+		pass.End()
+		if step.out == b {
+			enc.CopyBufferToBuffer(b, 0, c, shift*4, (n-shift)*4)
+		}
+	}
+	enc.CopyBufferToBuffer(d, 0, staging, 0, n*4)
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := glFloatsOf(staging.Bytes(), n)
+	for i := range got {
+		want := float32(0)
+		if i >= shift {
+			want = in[i-shift] * 4
+		}
+		if got[i] != want {
+			t.Fatalf("staging[%d] = %v, want %v", i, got[i], want)
+		}
+	}
+}
+
+// testGLCopyTexture uploads a 3x2 block with a padded row pitch into a 8x8
+// texture at (2,5), copies it to (4,1) of a second texture, and reads it back
+// into a buffer at an offset, again with padded rows.
+func testGLCopyTexture(t *testing.T, dev *gpu.Device, format gpu.TextureFormat, bpp int) {
+	const size, w, h = 8, 3, 2
+	const pitch, offset = 64, 16
+	newTex := func() *gpu.Texture {
+		tex, err := dev.NewTexture(gpu.TextureDescriptor{Format: format, Width: size, Height: size, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("NewTexture: %v", err)
+		}
+		return tex
+	}
+	src, dst := newTex(), newTex()
+
+	// Distinct channel values: bytes for RGBA8, whole float32s for a float
+	// texture (raw byte patterns there would include denormals and NaNs).
+	up := make([]byte, offset+pitch*h)
+	for y := 0; y < h; y++ {
+		for c := 0; c < w*4; c++ {
+			v := 1 + y*w*4 + c
+			if bpp == 16 {
+				binary.LittleEndian.PutUint32(up[offset+y*pitch+c*4:], math.Float32bits(float32(v)))
+			} else {
+				up[offset+y*pitch+c] = byte(v)
+			}
+		}
+	}
+	upBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: up, Usage: gpu.BufferCopySrc})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	down, err := dev.NewBuffer(gpu.BufferDescriptor{Size: offset + pitch*h, Usage: gpu.BufferCopyDst | gpu.BufferMapRead})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	enc.CopyBufferToTexture(gpu.ImageCopyBuffer{Buffer: upBuf, Offset: offset, BytesPerRow: pitch}, gpu.ImageCopyTexture{Texture: src, X: 2, Y: 5}, w, h)
+	enc.CopyTextureToTexture(gpu.ImageCopyTexture{Texture: src, X: 2, Y: 5}, gpu.ImageCopyTexture{Texture: dst, X: 4, Y: 1}, w, h)
+	enc.CopyTextureToBuffer(gpu.ImageCopyTexture{Texture: dst, X: 4, Y: 1}, gpu.ImageCopyBuffer{Buffer: down, Offset: offset, BytesPerRow: pitch}, w, h)
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := down.Bytes()
+	for y := 0; y < h; y++ {
+		for i := 0; i < w*bpp; i++ {
+			if g, want := got[offset+y*pitch+i], up[offset+y*pitch+i]; g != want {
+				t.Fatalf("row %d byte %d = %d, want %d", y, i, g, want)
+			}
+		}
+	}
+
+	// ReadPixels is top-down, so storage row y of the copy is image row
+	// size-1-y on GL.
+	pix := dst.ReadPixels()
+	for y := 0; y < h; y++ {
+		row := (size - 1 - (1 + y)) * size * bpp
+		for i := 0; i < w*bpp; i++ {
+			if g, want := pix[row+4*bpp+i], up[offset+y*pitch+i]; g != want {
+				t.Fatalf("ReadPixels row %d byte %d = %d, want %d", y, i, g, want)
+			}
+		}
+	}
+}
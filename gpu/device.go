@@ -11,7 +11,14 @@
 // file is Phase 1: the compute subset, with the Metal backend.
 package gpu
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"sync"
+
+	"poly.red/gpu/shader"
+)
 
 // Driver identifies a GPU backend.
 type Driver int
@@ -23,6 +30,11 @@ const (
 	DriverVulkan
 	DriverD3D12
 	DriverGL
+	// DriverSoftware runs everything on the CPU, in Go: kernels of
+	// shader.CompileCPU and a rasterizer with the semantics of the others.
+	// It needs no system library, so Open falls back to it when no GPU
+	// driver opens.
+	DriverSoftware
 )
 
 func (d Driver) String() string {
@@ -35,12 +47,15 @@ func (d Driver) String() string {
 		return "d3d12"
 	case DriverGL:
 		return "gl"
+	case DriverSoftware:
+		return "software"
 	default:
 		return "auto"
 	}
 }
 
-// ErrUnsupported is returned by Open when no usable GPU driver is available.
+// ErrUnsupported is returned by Open when the requested GPU driver is not
+// available, and by operations a driver cannot perform.
 var ErrUnsupported = errors.New("gpu: no supported GPU driver available")
 
 // Option configures Open.
@@ -49,6 +64,8 @@ type Option func(*config)
 type config struct {
 	driver        Driver
 	nativeDisplay uintptr
+	features      Features
+	validation    bool
 }
 
 // WithDriver forces a specific driver instead of auto-selection.
@@ -56,6 +73,13 @@ func WithDriver(d Driver) Option {
 	return func(c *config) { c.driver = d }
 }
 
+// WithRequiredFeatures makes Open fail unless the device has every feature
+// of f. With DriverAuto a GPU driver that lacks one gives way to
+// DriverSoftware, if it has them.
+func WithRequiredFeatures(f Features) Option {
+	return func(c *config) { c.features |= f }
+}
+
 // WithNativeDisplay binds the device to a native display handle (an X11 Display*
 // for the GL backend). On-screen windowed present requires this so the EGL
 // display uses the X11 platform and an X11 window is a valid native window;
@@ -70,32 +94,73 @@ func WithNativeDisplay(d uintptr) Option {
 type Device struct {
 	b      backend
 	driver Driver
+	caps   capabilities
 	queue  *Queue
+	errs   errorState
 }
 
 // Open negotiates a GPU device for the selected (or best available) driver.
+// Without WithDriver it falls back to DriverSoftware when no GPU driver
+// opens, so it always succeeds unless WithRequiredFeatures asks for more
+// than the software driver has.
 func Open(opts ...Option) (*Device, error) {
 	var c config
 	for _, o := range opts {
 		o(&c)
 	}
-	b, drv, err := openBackend(c)
+	var (
+		b   backend
+		drv Driver
+		err = ErrUnsupported
+	)
+	if c.driver != DriverSoftware {
+		if b, drv, err = openBackend(c); err == nil {
+			if err = requireFeatures(b, drv, c.features); err != nil {
+				b.close()
+			}
+		}
+		if err != nil && c.driver != DriverAuto {
+			return nil, err
+		}
+	}
 	if err != nil {
-		return nil, err
+		b, drv = openSoftware(), DriverSoftware
+		if err := requireFeatures(b, drv, c.features); err != nil {
+			return nil, err
+		}
 	}
-	d := &Device{b: b, driver: drv}
+	if c.validation {
+		b = &validBackend{backend: b}
+	}
+	caps := b.capabilities()
+	caps.info.Driver = drv
+	d := &Device{b: b, driver: drv, caps: caps}
 	d.queue = &Queue{d: d}
+	d.errs.lost = make(chan LostInfo, 1)
+	b.setErrorHandler(d.reportError)
 	return d, nil
 }
 
+// requireFeatures fails if b lacks any feature of f.
+func requireFeatures(b backend, drv Driver, f Features) error {
+	if missing := f &^ b.capabilities().features; missing != 0 {
+		return fmt.Errorf("gpu: the %v device lacks %v: %w", drv, missing, ErrUnsupported)
+	}
+	return nil
+}
+
 // Driver reports the active driver.
 func (d *Device) Driver() Driver { return d.driver }
 
 // Queue returns the device's command queue.
 func (d *Device) Queue() *Queue { return d.queue }
 
-// Close releases the device and its backend resources.
-func (d *Device) Close() error { return d.b.close() }
+// Close releases the device and its backend resources. Lost then receives
+// LostDestroyed.
+func (d *Device) Close() error {
+	d.lose(LostInfo{Reason: LostDestroyed, Message: "gpu: device closed"})
+	return d.b.close()
+}
 
 // BufferUsage is a bitmask describing how a buffer will be used; the backend
 // maps it to the appropriate storage mode.
@@ -108,6 +173,8 @@ const (
 	BufferUniform // read-only uniform/constant buffer
 	BufferMapRead
 	BufferMapWrite
+	BufferIndex    // index buffer for RenderPass.SetIndexBuffer / DrawIndexed
+	BufferIndirect // arguments of DispatchIndirect / DrawIndirect / DrawIndexedIndirect
 )
 
 // BufferDescriptor describes a buffer to create.
@@ -120,8 +187,13 @@ type BufferDescriptor struct {
 
 // Buffer is a GPU memory allocation.
 type Buffer struct {
-	b    backendBuffer
-	size int
+	b     backendBuffer
+	d     *Device
+	size  int
+	usage BufferUsage
+
+	mu      sync.Mutex
+	mapping // MapAsync state, guarded by mu
 }
 
 // Size returns the buffer size in bytes.
@@ -147,7 +219,7 @@ func (d *Device) NewBuffer(desc BufferDescriptor) (*Buffer, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Buffer{b: bb, size: size}, nil
+	return &Buffer{b: bb, d: d, size: size, usage: desc.Usage}, nil
 }
 
 // ShaderStage is a bitmask of pipeline stages a binding is visible to.
@@ -162,16 +234,29 @@ const (
 // ShaderSource carries per-backend shader text. Normally produced by the
 // Go→shader compiler; per-language fields let one module hold all variants and
 // allow hand-authored escape-hatch shaders. This phase uses MSL.
+//
+// WGSL (shader.CompileWGSL) is carried for WebGPU-style consumers; none of
+// the current backends compiles it. CPU is a kernel of shader.CompileCPU,
+// the only source DriverSoftware runs.
+//
+// Lines is the line table of the compiled kernel (shader.Kernel.Lines): the
+// Go position each line of the MSL or GLSL came from. When the driver rejects
+// the source, each message of its log that names a line is prefixed with that
+// line's Go position.
 type ShaderSource struct {
 	MSL   string
 	GLSL  string
 	HLSL  string
 	SPIRV []byte
+	WGSL  string
+	CPU   *shader.Program
+	Lines []token.Position
 }
 
 // ShaderModule is a compiled shader library for the active backend.
 type ShaderModule struct {
-	b backendShaderModule
+	b      backendShaderModule
+	kernel *shader.Kernel // reflection data, for NewShaderModuleFromKernel
 }
 
 // NewShaderModule compiles shader source for the active backend.
@@ -183,6 +268,11 @@ func (d *Device) NewShaderModule(src ShaderSource) (*ShaderModule, error) {
 	return &ShaderModule{b: bm}, nil
 }
 
+// Release frees the module. The Vulkan backend builds a pipeline from its
+// modules when it is first used, so release the pipelines of a module
+// before the module.
+func (m *ShaderModule) Release() { m.b.release() }
+
 // BindingKind is the resource type of a bind-group entry.
 type BindingKind int
 
@@ -191,11 +281,26 @@ const (
 	UniformBuffer
 )
 
+func (k BindingKind) String() string {
+	switch k {
+	case StorageBuffer:
+		return "storage buffer"
+	case UniformBuffer:
+		return "uniform buffer"
+	default:
+		return fmt.Sprintf("BindingKind(%d)", int(k))
+	}
+}
+
 // BindGroupLayoutEntry declares one binding in a layout.
 type BindGroupLayoutEntry struct {
 	Binding    int
 	Visibility ShaderStage
 	Kind       BindingKind
+	// MinBindingSize is the fewest bytes the binding's buffer range must
+	// hold, or 0 for no minimum. A layout derived from a kernel takes its
+	// shader.Binding.MinSize.
+	MinBindingSize int
 }
 
 // BindGroupLayout declares the shape of a bind group.
@@ -219,34 +324,69 @@ func (d *Device) NewPipelineLayout(groups ...*BindGroupLayout) *PipelineLayout {
 }
 
 // BindGroupEntry binds a concrete resource to a binding index.
+//
+// Offset and Size select the bytes of Buffer the binding sees; a zero Size
+// binds the rest of the buffer from Offset. Offset must be a multiple of the
+// device's MinStorageBufferOffsetAlignment or MinUniformBufferOffsetAlignment
+// (see Limits).
 type BindGroupEntry struct {
 	Binding int
 	Buffer  *Buffer
+	Offset  int
+	Size    int
+}
+
+// size is the number of bytes e binds.
+func (e BindGroupEntry) size() int {
+	if e.Size == 0 {
+		return e.Buffer.size - e.Offset
+	}
+	return e.Size
 }
 
 // BindGroup is a concrete set of resources matching a BindGroupLayout.
 type BindGroup struct {
 	layout  *BindGroupLayout
 	entries []BindGroupEntry
+	kinds   []BindingKind // the layout binding each entry fills
 }
 
-// NewBindGroup creates a bind group for the given layout.
-func (d *Device) NewBindGroup(layout *BindGroupLayout, entries ...BindGroupEntry) *BindGroup {
-	return &BindGroup{layout: layout, entries: entries}
+// NewBindGroup creates a bind group for the given layout. Every binding of
+// the layout takes exactly one entry, whose buffer was created with the usage
+// its kind needs: BufferStorage for a StorageBuffer, BufferUniform for a
+// UniformBuffer. An entry's range must hold the layout's MinBindingSize.
+func (d *Device) NewBindGroup(layout *BindGroupLayout, entries ...BindGroupEntry) (*BindGroup, error) {
+	kinds, err := checkBindGroup(layout, entries, d.caps.limits)
+	if err != nil {
+		return nil, err
+	}
+	return &BindGroup{layout: layout, entries: entries, kinds: kinds}, nil
 }
 
 // ComputePipelineDescriptor describes a compute pipeline.
+//
+// With a Module from NewShaderModuleFromKernel, a nil Layout is derived from
+// the kernel's bindings (see ComputePipeline.BindGroupLayout), an empty Entry
+// names the kernel and a zero Workgroup takes the kernel's.
 type ComputePipelineDescriptor struct {
 	Label  string
 	Layout *PipelineLayout
 	Module *ShaderModule
 	Entry  string
+
+	// Workgroup is the kernel's workgroup size, from shader.Kernel.Workgroup.
+	// Dispatch then runs whole workgroups of that size, rounding the grid up.
+	// Zero means the kernel declares no workgroup and the backend sizes it.
+	Workgroup [3]int
 }
 
 // ComputePipeline is a compiled compute pipeline.
 type ComputePipeline struct {
 	b      backendComputePipeline
 	layout *PipelineLayout
+	// kernel is the layout of the kernel's own bindings, whose minimum
+	// sizes the validation layer checks, or nil.
+	kernel *BindGroupLayout
 }
 
 // NewComputePipeline creates a compute pipeline.
@@ -254,11 +394,40 @@ func (d *Device) NewComputePipeline(desc ComputePipelineDescriptor) (*ComputePip
 	if desc.Module == nil {
 		return nil, errors.New("gpu: compute pipeline requires a shader module")
 	}
-	bp, err := d.b.newComputePipeline(desc.Module.b, desc.Entry)
+	entry, err := desc.Module.entry(desc.Entry, shader.StageCompute)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := pipelineLayout(desc.Layout, []*ShaderModule{desc.Module}, []ShaderStage{StageCompute})
+	if err != nil {
+		return nil, err
+	}
+	wg := desc.Workgroup
+	if k := desc.Module.kernel; k != nil && wg == [3]int{} {
+		wg = k.Workgroup
+	}
+	bp, err := d.b.newComputePipeline(desc.Module.b, entry, wg)
 	if err != nil {
 		return nil, err
 	}
-	return &ComputePipeline{b: bp, layout: desc.Layout}, nil
+	return &ComputePipeline{b: bp, layout: layout, kernel: kernelLayout([]*ShaderModule{desc.Module}, []ShaderStage{StageCompute})}, nil
+}
+
+// BindGroupLayout returns the layout of bind group group of the pipeline,
+// given or derived, or nil if it has none.
+func (p *ComputePipeline) BindGroupLayout(group int) *BindGroupLayout {
+	return p.layout.group(group)
+}
+
+// Release frees the pipeline. The work recorded with it must have completed.
+func (p *ComputePipeline) Release() { p.b.release() }
+
+// group returns the layout of bind group i, or nil.
+func (l *PipelineLayout) group(i int) *BindGroupLayout {
+	if l == nil || i < 0 || i >= len(l.groups) {
+		return nil
+	}
+	return l.groups[i]
 }
 
 // CommandEncoder records GPU commands into a CommandBuffer.
@@ -272,14 +441,19 @@ func (d *Device) NewCommandEncoder() *CommandEncoder {
 	return &CommandEncoder{d: d, cmd: d.b.newCommandBuffer()}
 }
 
-// BeginComputePass starts a compute pass.
-func (e *CommandEncoder) BeginComputePass() *ComputePass {
-	e.cmd.beginCompute()
+// BeginComputePass starts a compute pass, described by desc if one is given.
+func (e *CommandEncoder) BeginComputePass(desc ...ComputePassDescriptor) *ComputePass {
+	var ts *passTimestamps
+	if len(desc) > 0 {
+		ts = desc[0].TimestampWrites.timestamps()
+	}
+	e.cmd.beginCompute(ts)
 	return &ComputePass{e: e}
 }
 
 // Finish ends recording and returns the command buffer for submission.
 func (e *CommandEncoder) Finish() *CommandBuffer {
+	e.cmd.finish()
 	return &CommandBuffer{cmd: e.cmd}
 }
 
@@ -290,19 +464,20 @@ type ComputePass struct {
 
 // SetPipeline binds the compute pipeline for subsequent dispatches.
 func (p *ComputePass) SetPipeline(cp *ComputePipeline) {
-	p.e.cmd.setComputePipeline(cp.b)
+	p.e.cmd.setComputePipeline(cp.b, cp.kernel)
 }
 
 // SetBindGroup binds a bind group at the given group index. For the flat Metal
 // mapping, bindings translate directly to buffer indices.
 func (p *ComputePass) SetBindGroup(group int, bg *BindGroup) {
-	for _, e := range bg.entries {
-		p.e.cmd.setBuffer(e.Buffer.b, 0, e.Binding)
+	for i, e := range bg.entries {
+		p.e.cmd.setBuffer(e.Buffer.b, e.Offset, e.size(), e.Binding, bg.kinds[i])
 	}
 }
 
 // Dispatch runs the pipeline over a grid of the given number of threads (x*y*z).
-// Workgroup sizing is chosen by the backend from the pipeline limits.
+// Workgroup sizing is chosen by the backend from the pipeline limits, unless
+// the pipeline was created with a Workgroup size.
 func (p *ComputePass) Dispatch(x, y, z int) {
 	p.e.cmd.dispatch(x, y, z)
 }
@@ -333,3 +508,10 @@ func (q *Queue) Submit(cbs ...*CommandBuffer) {
 func (q *Queue) WaitIdle() {
 	q.d.b.waitIdle()
 }
+
+// OnSubmittedWorkDone calls fn, on a goroutine of its own, once all the work
+// submitted before the call has completed on the GPU. Unlike WaitIdle it does
+// not block, so frame N can be waited on while frame N+1 records.
+func (q *Queue) OnSubmittedWorkDone(fn func()) {
+	q.d.b.onSubmittedWorkDone(fn)
+}
@@ -0,0 +1,190 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrorFilter is the kind of an Error, and the kind of errors an error scope
+// captures.
+type ErrorFilter int
+
+const (
+	// ErrorFilterValidation errors are work the driver rejected: a GL call
+	// with invalid arguments, a command with a resource missing.
+	ErrorFilterValidation ErrorFilter = iota
+	// ErrorFilterOutOfMemory errors are allocations the device could not
+	// satisfy.
+	ErrorFilterOutOfMemory
+	// ErrorFilterInternal errors are failures of the driver itself.
+	ErrorFilterInternal
+)
+
+func (f ErrorFilter) String() string {
+	switch f {
+	case ErrorFilterValidation:
+		return "validation"
+	case ErrorFilterOutOfMemory:
+		return "out-of-memory"
+	case ErrorFilterInternal:
+		return "internal"
+	default:
+		return fmt.Sprintf("ErrorFilter(%d)", int(f))
+	}
+}
+
+// Error is an error of a device's work that no method returns, such as a GL
+// error raised while a command buffer replays or a failed Vulkan submit. It
+// goes to the innermost error scope of its Filter (see PushErrorScope), or
+// else to the OnUncapturedError handler.
+//
+// Only errors of the GPU and its driver, and the misuses the validation
+// layer finds (see WithValidation), are Errors. An invalid argument the
+// Device API checks as it is called, such as a copy outside its buffer or
+// texture, a render pass of mismatched attachments or an indirect offset
+// past its buffer, still panics with a "gpu: " message and never reaches an
+// error scope.
+type Error struct {
+	Filter ErrorFilter
+	Err    error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrDeviceLost is wrapped by the error a backend reports when its device
+// has died. It does not reach the error scopes; Device.Lost fires instead.
+var ErrDeviceLost = errors.New("gpu: device lost")
+
+// LostReason is why a device was lost.
+type LostReason int
+
+const (
+	// LostUnknown is a device the driver lost: a context that died, a
+	// removed GPU.
+	LostUnknown LostReason = iota
+	// LostDestroyed is a device that Close released.
+	LostDestroyed
+)
+
+func (r LostReason) String() string {
+	if r == LostDestroyed {
+		return "destroyed"
+	}
+	return "unknown"
+}
+
+// LostInfo describes a device's loss.
+type LostInfo struct {
+	Reason  LostReason
+	Message string
+}
+
+// errorState is a device's error scopes, uncaptured error handler and loss.
+type errorState struct {
+	mu         sync.Mutex
+	scopes     []errorScope
+	uncaptured func(*Error)
+	lost       chan LostInfo // receives once, then closes
+	isLost     bool
+}
+
+type errorScope struct {
+	filter ErrorFilter
+	err    *Error // the first error captured
+}
+
+// PushErrorScope opens an error scope that captures the errors of filter
+// until PopErrorScope. Scopes nest and belong to the device, not to a
+// goroutine: an error goes to the innermost open scope of its filter.
+func (d *Device) PushErrorScope(filter ErrorFilter) {
+	d.errs.mu.Lock()
+	defer d.errs.mu.Unlock()
+	d.errs.scopes = append(d.errs.scopes, errorScope{filter: filter})
+}
+
+// PopErrorScope closes the innermost error scope and returns the first error
+// it captured, an *Error, or nil. It panics without an open scope.
+//
+// The errors of a command buffer are reported when Queue.Submit runs it, so
+// a scope around Submit captures them on every driver but Metal, whose
+// errors are only known once the GPU has run the work.
+func (d *Device) PopErrorScope() error {
+	d.errs.mu.Lock()
+	defer d.errs.mu.Unlock()
+	n := len(d.errs.scopes)
+	if n == 0 {
+		panic("gpu: PopErrorScope without an open error scope")
+	}
+	s := d.errs.scopes[n-1]
+	d.errs.scopes = d.errs.scopes[:n-1]
+	if s.err == nil {
+		return nil
+	}
+	return s.err
+}
+
+// OnUncapturedError sets the function called, on the goroutine that
+// reported it, with every error no open scope captures. Without one such
+// errors are dropped.
+func (d *Device) OnUncapturedError(fn func(err *Error)) {
+	d.errs.mu.Lock()
+	defer d.errs.mu.Unlock()
+	d.errs.uncaptured = fn
+}
+
+// Lost returns a channel that receives once, when the device is lost: its
+// driver lost the GPU, or Close released it. The channel is then closed.
+// Errors of a lost device are dropped.
+func (d *Device) Lost() <-chan LostInfo { return d.errs.lost }
+
+// reportError routes an error of the device's work: one wrapping
+// ErrDeviceLost loses the device, an *Error goes to a scope of its filter and
+// any other error is an internal one. It is the handler the backend reports
+// with, and is safe to call from any goroutine.
+func (d *Device) reportError(err error) {
+	if errors.Is(err, ErrDeviceLost) {
+		d.lose(LostInfo{Reason: LostUnknown, Message: err.Error()})
+		return
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Filter: ErrorFilterInternal, Err: err}
+	}
+	d.errs.mu.Lock()
+	if d.errs.isLost {
+		d.errs.mu.Unlock()
+		return
+	}
+	for i := len(d.errs.scopes) - 1; i >= 0; i-- {
+		if s := &d.errs.scopes[i]; s.filter == e.Filter {
+			if s.err == nil {
+				s.err = e
+			}
+			d.errs.mu.Unlock()
+			return
+		}
+	}
+	fn := d.errs.uncaptured
+	d.errs.mu.Unlock()
+	if fn != nil {
+		fn(e)
+	}
+}
+
+// lose marks the device lost and sends info on its Lost channel, once.
+func (d *Device) lose(info LostInfo) {
+	d.errs.mu.Lock()
+	defer d.errs.mu.Unlock()
+	if d.errs.isLost {
+		return
+	}
+	d.errs.isLost = true
+	d.errs.lost <- info
+	close(d.errs.lost)
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu_test
+
+import (
+	"errors"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// unboundDispatch submits a dispatch of the Samples kernel without its
+// texture, which the software driver reports as a validation error.
+func unboundDispatch(t *testing.T, dev *gpu.Device) {
+	t.Helper()
+	load, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, softwareKernels, "Samples")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(load.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(load)
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(1, 1, 1)
+	cp.End()
+	submit(dev, enc)
+}
+
+func TestErrorScope(t *testing.T) {
+	dev := softwareDevice(t)
+	var uncaptured []*gpu.Error
+	dev.OnUncapturedError(func(err *gpu.Error) { uncaptured = append(uncaptured, err) })
+
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	dev.PushErrorScope(gpu.ErrorFilterOutOfMemory)
+	unboundDispatch(t, dev)
+	if err := dev.PopErrorScope(); err != nil {
+		t.Errorf("out-of-memory scope captured %v", err)
+	}
+	err := dev.PopErrorScope()
+	var e *gpu.Error
+	if !errors.As(err, &e) || e.Filter != gpu.ErrorFilterValidation {
+		t.Fatalf("validation scope captured %v, want a validation *Error", err)
+	}
+	t.Logf("captured: %v", err)
+	if len(uncaptured) != 0 {
+		t.Errorf("captured error also went to OnUncapturedError: %v", uncaptured)
+	}
+
+	// Without a validation scope the error is uncaptured.
+	dev.PushErrorScope(gpu.ErrorFilterInternal)
+	unboundDispatch(t, dev)
+	if err := dev.PopErrorScope(); err != nil {
+		t.Errorf("internal scope captured %v", err)
+	}
+	if len(uncaptured) != 1 || uncaptured[0].Filter != gpu.ErrorFilterValidation {
+		t.Errorf("OnUncapturedError got %v, want one validation error", uncaptured)
+	}
+
+	// A scope keeps its first error only.
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	unboundDispatch(t, dev)
+	unboundDispatch(t, dev)
+	if err := dev.PopErrorScope(); err == nil {
+		t.Error("validation scope captured nothing")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("PopErrorScope without a scope did not panic")
+		}
+	}()
+	dev.PopErrorScope()
+}
+
+func TestDeviceLost(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	lost := dev.Lost()
+	select {
+	case info := <-lost:
+		t.Fatalf("device lost before Close: %+v", info)
+	default:
+	}
+	dev.Close()
+	info, ok := <-lost
+	if !ok || info.Reason != gpu.LostDestroyed {
+		t.Errorf("Lost after Close = %+v, %v, want %v", info, ok, gpu.LostDestroyed)
+	}
+	if _, ok := <-lost; ok {
+		t.Error("Lost channel not closed after the loss")
+	}
+}
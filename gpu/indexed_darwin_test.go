@@ -0,0 +1,127 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// Indexed-draw conformance for the Metal render pipeline, the counterpart of
+// indexed_gl_linux_test.go: two quads share one vertex buffer and are drawn
+// through an index buffer by firstIndex and by baseVertex, for 16- and 32-bit
+// indices. [[vertex_id]] of an indexed draw is the fetched index plus the base
+// vertex, so the vertex function is unchanged from the unindexed tests.
+package gpu_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"poly.red/gpu"
+)
+
+const indexedMSL = `
+#include <metal_stdlib>
+using namespace metal;
+struct VOut { float4 pos [[position]]; float4 color; };
+vertex VOut vmain(uint vid [[vertex_id]],
+                  device const float* pos [[buffer(0)]],
+                  device const float* col [[buffer(1)]]) {
+	VOut o;
+	o.pos = float4(pos[vid*2], pos[vid*2+1], 0.0, 1.0);
+	o.color = float4(col[vid*3], col[vid*3+1], col[vid*3+2], 1.0);
+	return o;
+}
+fragment float4 fmain(VOut in [[stage_in]]) { return in.color; }
+`
+
+func TestRenderIndexed(t *testing.T) {
+	dev, err := gpu.Open()
+	if err != nil {
+		t.Skipf("no GPU device: %v", err)
+	}
+	defer dev.Close()
+
+	mod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: indexedMSL})
+	if err != nil {
+		t.Fatalf("compile shader: %v", err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: mod, VertexEntry: "vmain",
+		FragmentModule: mod, FragmentEntry: "fmain",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+
+	// Vertices 0..3 are the left half of the viewport (red), 4..7 the right half
+	// (green).
+	pos := []float32{
+		-1, -1, 0, -1, -1, 1, 0, 1,
+		0, -1, 1, -1, 0, 1, 1, 1,
+	}
+	col := []float32{
+		1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0,
+		0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0,
+	}
+	quads := []uint32{0, 1, 2, 2, 1, 3, 4, 5, 6, 6, 5, 7}
+	quads16 := make([]uint16, len(quads))
+	for i, v := range quads {
+		quads16[i] = uint16(v)
+	}
+	buf := func(data []byte, usage gpu.BufferUsage) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: data, Usage: usage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	posBuf, colBuf := buf(bytesFromFloats(pos), gpu.BufferStorage), buf(bytesFromFloats(col), gpu.BufferStorage)
+
+	for _, tc := range []struct {
+		name   string
+		format gpu.IndexFormat
+		data   []byte
+	}{
+		{"uint16", gpu.IndexUint16, unsafe.Slice((*byte)(unsafe.Pointer(&quads16[0])), len(quads16)*2)},
+		{"uint32", gpu.IndexUint32, unsafe.Slice((*byte)(unsafe.Pointer(&quads[0])), len(quads)*4)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ib := buf(tc.data, gpu.BufferIndex)
+			defer ib.Release()
+			for _, useBaseVertex := range []bool{false, true} {
+				const W, H = 16, 16
+				color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+				if err != nil {
+					t.Fatalf("color texture: %v", err)
+				}
+				enc := dev.NewCommandEncoder()
+				rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+					ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+				})
+				rp.SetPipeline(pipe)
+				rp.SetVertexBuffer(0, posBuf)
+				rp.SetVertexBuffer(1, colBuf)
+				rp.SetIndexBuffer(ib, tc.format)
+				rp.DrawIndexed(gpu.TriangleList, 0, 6, 0)
+				if useBaseVertex {
+					rp.DrawIndexed(gpu.TriangleList, 0, 6, 4)
+				} else {
+					rp.DrawIndexed(gpu.TriangleList, 6, 6, 0)
+				}
+				rp.End()
+				dev.Queue().Submit(enc.Finish())
+				dev.Queue().WaitIdle()
+
+				pix := color.ReadPixels()
+				left := (8*W + 3) * 4
+				right := (8*W + 12) * 4
+				if pix[left] != 255 || pix[left+1] != 0 || pix[left+2] != 0 {
+					t.Fatalf("baseVertex=%v: left pixel = %v, want red", useBaseVertex, pix[left:left+3])
+				}
+				if pix[right] != 0 || pix[right+1] != 255 || pix[right+2] != 0 {
+					t.Fatalf("baseVertex=%v: right pixel = %v, want green", useBaseVertex, pix[right:right+3])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Indexed-draw conformance for the GL backend: two quads share one vertex
+// storage buffer and are drawn through an index buffer, once by firstIndex
+// (the second half of the index buffer) and once by baseVertex (the first half
+// shifted onto the second quad's vertices), for both 16- and 32-bit indices,
+// from whole buffers and from slices of a BufferPool block.
+// The vertex shader still reads its data by gl_VertexID, which for an indexed
+// draw is the fetched index plus the base vertex. Runs in CI on Mesa llvmpipe
+// (software, surfaceless).
+package gpu_test
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"poly.red/gpu"
+)
+
+const indexedGLVert = `#version 310 es
+layout(std430, binding = 0) readonly buffer _pos { float pos[]; };
+layout(std430, binding = 1) readonly buffer _col { float col[]; };
+out vec3 vcolor;
+void main() {
+	int i = gl_VertexID;
+	gl_Position = vec4(pos[i*2], pos[i*2+1], 0.0, 1.0);
+	vcolor = vec3(col[i*3], col[i*3+1], col[i*3+2]);
+}`
+
+const indexedGLFrag = `#version 310 es
+precision highp float;
+in vec3 vcolor;
+out vec4 fragColor;
+void main() { fragColor = vec4(vcolor, 1.0); }`
+
+func TestGLRenderIndexed(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL indexed draw test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLVert})
+	if err != nil {
+		t.Fatalf("vertex module: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLFrag})
+	if err != nil {
+		t.Fatalf("fragment module: %v", err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+
+	// Vertices 0..3 are the left half of the viewport (red), 4..7 the right half
+	// (green). Each quad is two triangles over its four corners.
+	pos := []float32{
+		-1, -1, 0, -1, -1, 1, 0, 1,
+		0, -1, 1, -1, 0, 1, 1, 1,
+	}
+	col := []float32{
+		1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0,
+		0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0,
+	}
+	quads := []uint32{0, 1, 2, 2, 1, 3, 4, 5, 6, 6, 5, 7}
+	buf := func(data []byte, usage gpu.BufferUsage) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: data, Usage: usage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	posBuf, colBuf := buf(glBytesOf(pos), gpu.BufferStorage), buf(glBytesOf(col), gpu.BufferStorage)
+
+	for _, tc := range []struct {
+		name   string
+		format gpu.IndexFormat
+		data   []byte
+	}{
+		{"uint16", gpu.IndexUint16, indexBytes16(quads)},
+		{"uint32", gpu.IndexUint32, unsafe.Slice((*byte)(unsafe.Pointer(&quads[0])), len(quads)*4)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ib := buf(tc.data, gpu.BufferIndex)
+			defer ib.Release()
+
+			// The same streams as slices of one pool block, none at its start.
+			pool, err := dev.NewBufferPool(gpu.BufferPoolDescriptor{Usage: gpu.BufferStorage | gpu.BufferIndex})
+			if err != nil {
+				t.Fatalf("NewBufferPool: %v", err)
+			}
+			defer pool.Release()
+			write := func(data []byte) gpu.BufferSlice {
+				s, err := pool.Write(data)
+				if err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				return s
+			}
+			write(make([]byte, 4))
+			posSlice, colSlice, ibSlice := write(glBytesOf(pos)), write(glBytesOf(col)), write(tc.data)
+
+			// render draws the left quad (indices 0..5) plus the right quad, reached
+			// either by firstIndex 6 or by reusing indices 0..5 with baseVertex 4,
+			// from the buffers or the pool's slices.
+			render := func(useBaseVertex, pooled bool) []byte {
+				const W, H = 16, 16
+				color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+				if err != nil {
+					t.Fatalf("color texture: %v", err)
+				}
+				enc := dev.NewCommandEncoder()
+				rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+					ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+				})
+				rp.SetPipeline(pipe)
+				if pooled {
+					rp.SetVertexSlice(0, posSlice)
+					rp.SetVertexSlice(1, colSlice)
+					rp.SetIndexSlice(ibSlice, tc.format)
+				} else {
+					rp.SetVertexBuffer(0, posBuf)
+					rp.SetVertexBuffer(1, colBuf)
+					rp.SetIndexBuffer(ib, tc.format)
+				}
+				rp.DrawIndexed(gpu.TriangleList, 0, 6, 0)
+				if useBaseVertex {
+					rp.DrawIndexed(gpu.TriangleList, 0, 6, 4)
+				} else {
+					rp.DrawIndexed(gpu.TriangleList, 6, 6, 0)
+				}
+				rp.End()
+				dev.Queue().Submit(enc.Finish())
+				dev.Queue().WaitIdle()
+				return color.ReadPixels()
+			}
+
+			for _, pooled := range []bool{false, true} {
+				for _, useBaseVertex := range []bool{false, true} {
+					pix := render(useBaseVertex, pooled)
+					left := (8*16 + 3) * 4
+					right := (8*16 + 12) * 4
+					if pix[left] != 255 || pix[left+1] != 0 || pix[left+2] != 0 {
+						t.Fatalf("baseVertex=%v pooled=%v: left pixel = %v, want red", useBaseVertex, pooled, pix[left:left+3])
+					}
+					if pix[right] != 0 || pix[right+1] != 255 || pix[right+2] != 0 {
+						t.Fatalf("baseVertex=%v pooled=%v: right pixel = %v, want green", useBaseVertex, pooled, pix[right:right+3])
+					}
+				}
+			}
+		})
+	}
+}
+
+func indexBytes16(idx []uint32) []byte {
+	b := make([]byte, len(idx)*2)
+	for i, v := range idx {
+		b[i*2], b[i*2+1] = byte(v), byte(v>>8)
+	}
+	return b
+}
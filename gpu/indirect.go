@@ -0,0 +1,68 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import "fmt"
+
+// Sizes in bytes of the arguments an indirect command reads from its buffer.
+// Every argument is a little-endian 32-bit integer.
+const (
+	// DispatchIndirectSize is the size of DispatchIndirect's arguments:
+	// the uint32 workgroup counts x, y and z.
+	DispatchIndirectSize = 12
+	// DrawIndirectSize is the size of DrawIndirect's arguments: the uint32s
+	// vertexCount, instanceCount, firstVertex and firstInstance.
+	DrawIndirectSize = 16
+	// DrawIndexedIndirectSize is the size of DrawIndexedIndirect's
+	// arguments: the uint32s indexCount, instanceCount and firstIndex, the
+	// int32 baseVertex and the uint32 firstInstance.
+	DrawIndexedIndirectSize = 20
+)
+
+// checkIndirect panics unless buf holds size bytes of arguments for the
+// indirect command op at offset.
+func checkIndirect(op string, buf *Buffer, offset, size int) {
+	switch {
+	case buf == nil:
+		panic(fmt.Sprintf("gpu: %s without a buffer", op))
+	case buf.usage&BufferIndirect == 0:
+		panic(fmt.Sprintf("gpu: %s from a buffer without BufferIndirect usage", op))
+	case offset < 0 || offset%4 != 0:
+		panic(fmt.Sprintf("gpu: %s offset %d is not a non-negative multiple of 4", op, offset))
+	case offset+size > buf.size:
+		panic(fmt.Sprintf("gpu: %s reads %d bytes at offset %d of a %d-byte buffer", op, size, offset, buf.size))
+	}
+}
+
+// DispatchIndirect is Dispatch with a grid the GPU reads from buf at offset
+// when the command runs, so an earlier pass can size it without a readback.
+// Unlike Dispatch's thread counts, the arguments (DispatchIndirectSize bytes)
+// count workgroups of the pipeline's Workgroup size, or of one thread for a
+// kernel that declares none.
+func (p *ComputePass) DispatchIndirect(buf *Buffer, offset int) {
+	checkIndirect("DispatchIndirect", buf, offset, DispatchIndirectSize)
+	p.e.cmd.dispatchIndirect(buf.b, offset)
+}
+
+// DrawIndirect is DrawInstanced with arguments (DrawIndirectSize bytes) the
+// GPU reads from buf at offset when the draw runs.
+//
+// The GL backend requires the firstInstance argument to be 0: GLES reserves
+// the field, and the GPU-written value cannot reach the vertex shader.
+func (p *RenderPass) DrawIndirect(prim Primitive, buf *Buffer, offset int) {
+	checkIndirect("DrawIndirect", buf, offset, DrawIndirectSize)
+	p.e.cmd.drawIndirect(prim, buf.b, offset)
+}
+
+// DrawIndexedIndirect is DrawIndexedInstanced with arguments
+// (DrawIndexedIndirectSize bytes) the GPU reads from buf at offset when the
+// draw runs. firstIndex counts indices of the bound index buffer.
+//
+// The GL backend requires the firstInstance argument to be 0: GLES reserves
+// the field, and the GPU-written value cannot reach the vertex shader.
+func (p *RenderPass) DrawIndexedIndirect(prim Primitive, buf *Buffer, offset int) {
+	checkIndirect("DrawIndexedIndirect", buf, offset, DrawIndexedIndirectSize)
+	p.e.cmd.drawIndexedIndirect(prim, buf.b, offset)
+}
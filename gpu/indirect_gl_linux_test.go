@@ -0,0 +1,177 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestGLIndirect has a Go kernel write the arguments of an indirect dispatch,
+// an indirect draw and an indirect indexed draw into one buffer, which the
+// passes after it consume without a readback.
+func TestGLIndirect(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL indirect test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	// Args lays out, by byte offset: a dispatch of 4 workgroups (0), a draw
+	// of the left quad's first triangle (12), and an indexed draw of the
+	// right quad, indices 6..11 (28).
+	const src = `package kernels
+func Args(gid uint, args []uint32) {
+	if gid == 0 {
+		args[0] = 4
+		args[1] = 1
+		args[2] = 1
+		args[3] = 3
+		args[4] = 1
+		args[7] = 6
+		args[8] = 1
+		args[9] = 6
+	}
+}
+func Fill(gid uint, out []float32) {
+	out[gid] = float32(gid) + 1.0
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	pipeline := func(name string) *gpu.ComputePipeline {
+		mod, err := dev.NewShaderModuleFromKernel(ks[name])
+		if err != nil {
+			t.Fatalf("NewShaderModuleFromKernel(%s): %v", name, err)
+		}
+		p, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+		if err != nil {
+			t.Fatalf("NewComputePipeline(%s): %v", name, err)
+		}
+		return p
+	}
+	buf := func(desc gpu.BufferDescriptor) *gpu.Buffer {
+		b, err := dev.NewBuffer(desc)
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+		return b
+	}
+	argsPipe, fillPipe := pipeline("Args"), pipeline("Fill")
+	args := buf(gpu.BufferDescriptor{Size: 12 * 4, Usage: gpu.BufferStorage | gpu.BufferIndirect})
+	out := buf(gpu.BufferDescriptor{Size: 16 * 4, Usage: gpu.BufferStorage})
+	argsBG, err := dev.NewBindGroup(argsPipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: args})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	fillBG, err := dev.NewBindGroup(fillPipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLVert})
+	if err != nil {
+		t.Fatalf("vertex module: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLFrag})
+	if err != nil {
+		t.Fatalf("fragment module: %v", err)
+	}
+	draw, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+	// The quads of TestGLRenderIndexed: left red (vertices 0..3), right
+	// green (4..7).
+	pos := []float32{
+		-1, -1, 0, -1, -1, 1, 0, 1,
+		0, -1, 1, -1, 0, 1, 1, 1,
+	}
+	col := []float32{
+		1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0,
+		0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0,
+	}
+	posBuf := buf(gpu.BufferDescriptor{Data: glBytesOf(pos), Usage: gpu.BufferStorage})
+	colBuf := buf(gpu.BufferDescriptor{Data: glBytesOf(col), Usage: gpu.BufferStorage})
+	ib := buf(gpu.BufferDescriptor{Data: indexBytes16([]uint32{0, 1, 2, 2, 1, 3, 4, 5, 6, 6, 5, 7}), Usage: gpu.BufferIndex})
+	const W, H = 16, 16
+	color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("color texture: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(argsPipe)
+	cp.SetBindGroup(0, argsBG)
+	cp.Dispatch(1, 1, 1)
+	cp.SetPipeline(fillPipe)
+	cp.SetBindGroup(0, fillBG)
+	cp.DispatchIndirect(args, 0)
+	cp.End()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+	})
+	rp.SetPipeline(draw)
+	rp.SetVertexBuffer(0, posBuf)
+	rp.SetVertexBuffer(1, colBuf)
+	rp.SetIndexBuffer(ib, gpu.IndexUint16)
+	rp.DrawIndirect(gpu.TriangleList, args, 12)
+	rp.DrawIndexedIndirect(gpu.TriangleList, args, 28)
+	rp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	// Kernels without a declared workgroup size run one thread per group.
+	got := out.Bytes()
+	for i := 0; i < 16; i++ {
+		want := float32(0)
+		if i < 4 {
+			want = float32(i + 1)
+		}
+		if v := math.Float32frombits(binary.LittleEndian.Uint32(got[i*4:])); v != want {
+			t.Fatalf("out[%d] = %v, want %v", i, v, want)
+		}
+	}
+
+	pix := color.ReadPixels()
+	for _, c := range []struct {
+		x, y    int
+		r, g, b byte
+	}{
+		{1, 8, 255, 0, 0},  // the left quad's first triangle
+		{7, 14, 0, 0, 255}, // its second triangle, not drawn
+		{12, 8, 0, 255, 0}, // the right quad
+	} {
+		i := (c.y*W + c.x) * 4
+		if p := pix[i : i+3]; p[0] != c.r || p[1] != c.g || p[2] != c.b {
+			t.Errorf("pixel (%d, %d) = %v, want %v", c.x, c.y, p, []byte{c.r, c.g, c.b})
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("DrawIndirect from a buffer without BufferIndirect usage did not panic")
+		}
+	}()
+	enc = dev.NewCommandEncoder()
+	rp = enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color})
+	rp.DrawIndirect(gpu.TriangleList, out, 0)
+}
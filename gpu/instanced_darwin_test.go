@@ -0,0 +1,107 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// Instanced-draw conformance for the Metal render pipeline, the counterpart of
+// instanced_gl_linux_test.go. Metal also honors a non-zero first instance, so
+// the indexed case draws the second instance alone by firstInstance.
+package gpu_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"poly.red/gpu"
+)
+
+const instancedMSL = `
+#include <metal_stdlib>
+using namespace metal;
+struct VOut { float4 pos [[position]]; float4 color; };
+vertex VOut vmain(uint vid [[vertex_id]], uint iid [[instance_id]],
+                  device const float* pos [[buffer(0)]],
+                  device const float* ins [[buffer(1)]]) {
+	VOut o;
+	o.pos = float4(pos[vid*2] + ins[iid*4], pos[vid*2+1], 0.0, 1.0);
+	o.color = float4(ins[iid*4+1], ins[iid*4+2], ins[iid*4+3], 1.0);
+	return o;
+}
+fragment float4 fmain(VOut in [[stage_in]]) { return in.color; }
+`
+
+func TestRenderInstanced(t *testing.T) {
+	dev, err := gpu.Open()
+	if err != nil {
+		t.Skipf("no GPU device: %v", err)
+	}
+	defer dev.Close()
+
+	mod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: instancedMSL})
+	if err != nil {
+		t.Fatalf("compile shader: %v", err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: mod, VertexEntry: "vmain",
+		FragmentModule: mod, FragmentEntry: "fmain",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+
+	list := []float32{-1, -1, 0, -1, -1, 1, -1, 1, 0, -1, 0, 1}
+	corners := []float32{-1, -1, 0, -1, -1, 1, 0, 1}
+	ins := []float32{
+		0, 1, 0, 0, // instance 0: in place, red
+		1, 0, 1, 0, // instance 1: shifted right, green
+	}
+	idx := []uint16{0, 1, 2, 2, 1, 3}
+	buf := func(data []byte, usage gpu.BufferUsage) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: data, Usage: usage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	listBuf, cornerBuf := buf(bytesFromFloats(list), gpu.BufferStorage), buf(bytesFromFloats(corners), gpu.BufferStorage)
+	insBuf := buf(bytesFromFloats(ins), gpu.BufferStorage)
+	ib := buf(unsafe.Slice((*byte)(unsafe.Pointer(&idx[0])), len(idx)*2), gpu.BufferIndex)
+
+	for _, indexed := range []bool{false, true} {
+		const W, H = 16, 16
+		color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("color texture: %v", err)
+		}
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+			ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+		})
+		rp.SetPipeline(pipe)
+		rp.SetVertexBuffer(1, insBuf)
+		if indexed {
+			rp.SetVertexBuffer(0, cornerBuf)
+			rp.SetIndexBuffer(ib, gpu.IndexUint16)
+			rp.DrawIndexedInstanced(gpu.TriangleList, 0, 6, 0, 0, 1)
+			rp.DrawIndexedInstanced(gpu.TriangleList, 0, 6, 0, 1, 1)
+		} else {
+			rp.SetVertexBuffer(0, listBuf)
+			rp.DrawInstanced(gpu.TriangleList, 0, 6, 0, 2)
+		}
+		rp.End()
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+
+		pix := color.ReadPixels()
+		left := (8*W + 3) * 4
+		right := (8*W + 12) * 4
+		if pix[left] != 255 || pix[left+1] != 0 || pix[left+2] != 0 {
+			t.Fatalf("indexed=%v: left pixel = %v, want red", indexed, pix[left:left+3])
+		}
+		if pix[right] != 0 || pix[right+1] != 255 || pix[right+2] != 0 {
+			t.Fatalf("indexed=%v: right pixel = %v, want green", indexed, pix[right:right+3])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Instanced-draw conformance for the GL backend: one quad covering the left
+// half of the viewport is drawn twice, the second instance shifted right and
+// recolored by per-instance data read with gl_InstanceID, by both DrawInstanced
+// and DrawIndexedInstanced. Drawing the second instance alone, as firstInstance
+// 1, checks the backend's base instance. Runs in CI on Mesa llvmpipe
+// (software, surfaceless).
+package gpu_test
+
+import (
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+const instancedGLVert = `#version 310 es
+layout(std430, binding = 0) readonly buffer _pos { float pos[]; };
+layout(std430, binding = 1) readonly buffer _ins { float ins[]; };
+out vec3 vcolor;
+void main() {
+	int i = gl_VertexID;
+	int k = gl_InstanceID * 4;
+	gl_Position = vec4(pos[i*2] + ins[k], pos[i*2+1], 0.0, 1.0);
+	vcolor = vec3(ins[k+1], ins[k+2], ins[k+3]);
+}`
+
+func TestGLRenderInstanced(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL instanced draw test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: instancedGLVert})
+	if err != nil {
+		t.Fatalf("vertex module: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLFrag})
+	if err != nil {
+		t.Fatalf("fragment module: %v", err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+
+	// The left-half quad as a triangle list (unindexed) and as four corners
+	// (indexed); each instance is an x offset and a color.
+	list := []float32{-1, -1, 0, -1, -1, 1, -1, 1, 0, -1, 0, 1}
+	corners := []float32{-1, -1, 0, -1, -1, 1, 0, 1}
+	ins := []float32{
+		0, 1, 0, 0, // instance 0: in place, red
+		1, 0, 1, 0, // instance 1: shifted right, green
+	}
+	buf := func(data []byte, usage gpu.BufferUsage) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: data, Usage: usage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	listBuf, cornerBuf := buf(glBytesOf(list), gpu.BufferStorage), buf(glBytesOf(corners), gpu.BufferStorage)
+	insBuf := buf(glBytesOf(ins), gpu.BufferStorage)
+	ib := buf(indexBytes16([]uint32{0, 1, 2, 2, 1, 3}), gpu.BufferIndex)
+
+	for _, tc := range []struct {
+		indexed bool
+		first   int // draws instances first up to 1
+	}{{false, 0}, {true, 0}, {false, 1}, {true, 1}} {
+		indexed := tc.indexed
+		const W, H = 16, 16
+		color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("color texture: %v", err)
+		}
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+			ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+		})
+		rp.SetPipeline(pipe)
+		rp.SetVertexBuffer(1, insBuf)
+		if indexed {
+			rp.SetVertexBuffer(0, cornerBuf)
+			rp.SetIndexBuffer(ib, gpu.IndexUint16)
+			rp.DrawIndexedInstanced(gpu.TriangleList, 0, 6, 0, tc.first, 2-tc.first)
+		} else {
+			rp.SetVertexBuffer(0, listBuf)
+			rp.DrawInstanced(gpu.TriangleList, 0, 6, tc.first, 2-tc.first)
+		}
+		rp.End()
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+
+		pix := color.ReadPixels()
+		left := (8*W + 3) * 4
+		right := (8*W + 12) * 4
+		want := []byte{255, 0, 0} // red
+		if tc.first == 1 {
+			want = []byte{0, 0, 255} // instance 0 not drawn: the clear color
+		}
+		if got := pix[left : left+3]; string(got) != string(want) {
+			t.Fatalf("indexed=%v first=%d: left pixel = %v, want %v", indexed, tc.first, got, want)
+		}
+		if pix[right] != 0 || pix[right+1] != 255 || pix[right+2] != 0 {
+			t.Fatalf("indexed=%v first=%d: right pixel = %v, want green", indexed, tc.first, pix[right:right+3])
+		}
+	}
+}
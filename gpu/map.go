@@ -0,0 +1,123 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MapMode selects what a buffer range is mapped for.
+type MapMode int
+
+const (
+	// MapRead maps a range for reading by the CPU; the buffer needs
+	// BufferMapRead usage.
+	MapRead MapMode = 1 << iota
+	// MapWrite maps a range for writing by the CPU, uploaded on Unmap; the
+	// buffer needs BufferMapWrite usage.
+	MapWrite
+)
+
+// ErrMapAborted is delivered by a MapAsync whose buffer was unmapped before
+// the mapping completed.
+var ErrMapAborted = errors.New("gpu: buffer mapping aborted by Unmap")
+
+type mapState int
+
+const (
+	mapUnmapped mapState = iota
+	mapPending
+	mapMapped
+)
+
+// mapping is the MapAsync state of a Buffer.
+type mapping struct {
+	state  mapState
+	gen    int // bumped by Unmap, so a stale pending map can tell it was aborted
+	mode   MapMode
+	offset int
+	data   []byte
+}
+
+// MapAsync maps size bytes of the buffer at offset once all work submitted
+// before the call has completed, without blocking. The returned channel
+// receives nil when the range is mapped (read it, or fill it for MapWrite,
+// through MappedRange) or the reason it could not be. A zero size maps the
+// rest of the buffer. The buffer stays mapped until Unmap.
+//
+// Reading frame N back while frame N+1 records is a CopyTextureToBuffer into a
+// BufferMapRead buffer, a Submit, then MapAsync on that buffer.
+func (b *Buffer) MapAsync(mode MapMode, offset, size int) <-chan error {
+	done := make(chan error, 1)
+	if size == 0 {
+		size = b.size - offset
+	}
+	var err error
+	switch {
+	case mode != MapRead && mode != MapWrite:
+		err = errors.New("gpu: MapAsync mode must be MapRead or MapWrite")
+	case mode == MapRead && b.usage&BufferMapRead == 0:
+		err = errors.New("gpu: MapAsync(MapRead) needs a buffer created with BufferMapRead")
+	case mode == MapWrite && b.usage&BufferMapWrite == 0:
+		err = errors.New("gpu: MapAsync(MapWrite) needs a buffer created with BufferMapWrite")
+	case offset < 0 || size < 0 || offset+size > b.size:
+		err = fmt.Errorf("gpu: MapAsync range %d+%d outside a %d-byte buffer", offset, size, b.size)
+	}
+	if err != nil {
+		done <- err
+		return done
+	}
+
+	b.mu.Lock()
+	if b.mapping.state != mapUnmapped {
+		b.mu.Unlock()
+		done <- errors.New("gpu: MapAsync on a buffer that is already mapped or mapping")
+		return done
+	}
+	b.mapping.state = mapPending
+	gen := b.mapping.gen
+	b.mu.Unlock()
+
+	b.d.b.onSubmittedWorkDone(func() {
+		data := make([]byte, size)
+		if mode == MapRead {
+			b.b.read(offset, data)
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.mapping.gen != gen {
+			done <- ErrMapAborted
+			return
+		}
+		b.mapping = mapping{state: mapMapped, gen: gen, mode: mode, offset: offset, data: data}
+		done <- nil
+	})
+	return done
+}
+
+// MappedRange returns the range mapped by the last successful MapAsync, or nil
+// if the buffer is not mapped. The slice is valid until Unmap; for MapWrite,
+// what it holds at Unmap is uploaded to the buffer.
+func (b *Buffer) MappedRange() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.mapping.state != mapMapped {
+		return nil
+	}
+	return b.mapping.data
+}
+
+// Unmap ends a mapping, uploading a MapWrite range. Unmapping a buffer whose
+// MapAsync is still pending aborts it with ErrMapAborted.
+func (b *Buffer) Unmap() {
+	b.mu.Lock()
+	m := b.mapping
+	b.mapping = mapping{gen: m.gen + 1}
+	b.mu.Unlock()
+	if m.state == mapMapped && m.mode == MapWrite {
+		b.b.write(m.offset, m.data)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// Asynchronous readback on the Metal backend: a MapWrite buffer is copied into
+// a MapRead buffer and mapped back once the copy has completed.
+package gpu_test
+
+import (
+	"testing"
+
+	"poly.red/gpu"
+)
+
+func TestMetalMapAsync(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverMetal))
+	if err != nil {
+		t.Skipf("no Metal device: %v", err)
+	}
+	defer dev.Close()
+
+	const n = 256
+	up, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n, Usage: gpu.BufferMapWrite | gpu.BufferCopySrc})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	down, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n, Usage: gpu.BufferMapRead | gpu.BufferCopyDst})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	if err := <-up.MapAsync(gpu.MapWrite, 0, 0); err != nil {
+		t.Fatalf("MapAsync(MapWrite): %v", err)
+	}
+	w := up.MappedRange()
+	for i := range w {
+		w[i] = byte(i * 7)
+	}
+	up.Unmap()
+
+	enc := dev.NewCommandEncoder()
+	enc.CopyBufferToBuffer(up, 0, down, 0, n)
+	dev.Queue().Submit(enc.Finish())
+	done := make(chan struct{})
+	dev.Queue().OnSubmittedWorkDone(func() { close(done) })
+
+	if err := <-down.MapAsync(gpu.MapRead, n/2, n/2); err != nil {
+		t.Fatalf("MapAsync(MapRead): %v", err)
+	}
+	for i, g := range down.MappedRange() {
+		if want := byte((n/2 + i) * 7); g != want {
+			t.Fatalf("byte %d = %d, want %d", n/2+i, g, want)
+		}
+	}
+	down.Unmap()
+	<-done
+}
@@ -0,0 +1,175 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Asynchronous readback on the GL backend: MapAsync round trips through
+// MapWrite and MapRead buffers, and a ring of readback buffers keeps several
+// frames outstanding, each one's pixels mapped once its fence signals instead
+// of after a WaitIdle per frame. Runs in CI on Mesa llvmpipe (software,
+// surfaceless).
+package gpu_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+func openGLMapDevice(t *testing.T) *gpu.Device {
+	t.Helper()
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL MapAsync test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	return dev
+}
+
+func TestGLMapAsync(t *testing.T) {
+	dev := openGLMapDevice(t)
+	defer dev.Close()
+
+	const n = 256
+	up, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n, Usage: gpu.BufferMapWrite | gpu.BufferCopySrc})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	down, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n, Usage: gpu.BufferMapRead | gpu.BufferCopyDst})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+
+	if err := <-up.MapAsync(gpu.MapWrite, 0, 0); err != nil {
+		t.Fatalf("MapAsync(MapWrite): %v", err)
+	}
+	w := up.MappedRange()
+	if len(w) != n {
+		t.Fatalf("MappedRange has %d bytes, want %d", len(w), n)
+	}
+	for i := range w {
+		w[i] = byte(i * 7)
+	}
+	up.Unmap()
+	if up.MappedRange() != nil {
+		t.Fatalf("MappedRange after Unmap is not nil")
+	}
+
+	enc := dev.NewCommandEncoder()
+	enc.CopyBufferToBuffer(up, 0, down, 0, n)
+	dev.Queue().Submit(enc.Finish())
+
+	// Map only the second half, at an offset.
+	if err := <-down.MapAsync(gpu.MapRead, n/2, n/2); err != nil {
+		t.Fatalf("MapAsync(MapRead): %v", err)
+	}
+	got := down.MappedRange()
+	for i, g := range got {
+		if want := byte((n/2 + i) * 7); g != want {
+			t.Fatalf("byte %d = %d, want %d", n/2+i, g, want)
+		}
+	}
+	if err := <-down.MapAsync(gpu.MapRead, 0, 0); err == nil {
+		t.Errorf("MapAsync on a mapped buffer succeeded")
+	}
+	down.Unmap()
+
+	for _, c := range []struct {
+		name         string
+		buf          *gpu.Buffer
+		mode         gpu.MapMode
+		offset, size int
+	}{
+		{"read without BufferMapRead", up, gpu.MapRead, 0, 0},
+		{"write without BufferMapWrite", down, gpu.MapWrite, 0, 0},
+		{"range past the end", down, gpu.MapRead, n / 2, n},
+		{"no mode", down, 0, 0, 0},
+	} {
+		if err := <-c.buf.MapAsync(c.mode, c.offset, c.size); err == nil {
+			t.Errorf("%s: MapAsync succeeded", c.name)
+		}
+	}
+}
+
+// TestGLMapAsyncFramesInFlight clears a render target to a per-frame color,
+// copies it into one of a ring of readback buffers and maps that buffer
+// without waiting. A frame's pixels are only waited on when its ring slot is
+// reused, so up to ring frames are outstanding while the next one records,
+// and each must still read back its own color although the render target has
+// since been cleared again. (llvmpipe rasterizes at glFlush, so on it the
+// overlap is between recording and readback rather than on the GPU itself.)
+func TestGLMapAsyncFramesInFlight(t *testing.T) {
+	dev := openGLMapDevice(t)
+	defer dev.Close()
+
+	const size, ring, frames = 512, 3, 24
+	tex, err := dev.NewTexture(gpu.TextureDescriptor{Width: size, Height: size, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("NewTexture: %v", err)
+	}
+	type slot struct {
+		buf    *gpu.Buffer
+		frame  int
+		mapped <-chan error
+	}
+	slots := make([]slot, ring)
+	for i := range slots {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Size: size * size * 4, Usage: gpu.BufferMapRead | gpu.BufferCopyDst})
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+		slots[i] = slot{buf: b, frame: -1}
+	}
+
+	check := func(s *slot) {
+		if err := <-s.mapped; err != nil {
+			t.Fatalf("frame %d: MapAsync: %v", s.frame, err)
+		}
+		px := s.buf.MappedRange()
+		for _, i := range []int{0, size*size/2 + size/3, size*size - 1} {
+			if g, want := px[i*4], byte(s.frame); g != want {
+				t.Fatalf("frame %d: pixel %d red = %d, want %d", s.frame, i, g, want)
+			}
+		}
+		s.buf.Unmap()
+	}
+
+	// Every frame's OnSubmittedWorkDone callback must run, too.
+	var done sync.WaitGroup
+	done.Add(frames)
+	for f := 0; f < frames; f++ {
+		s := &slots[f%ring]
+		if s.frame >= 0 {
+			check(s)
+		}
+		enc := dev.NewCommandEncoder()
+		enc.BeginRenderPass(gpu.RenderPassDescriptor{
+			ColorTexture: tex,
+			Load:         gpu.LoadClear,
+			ClearColor:   [4]float64{float64(f) / 255, 0.5, 0.25, 1},
+		}).End()
+		enc.CopyTextureToBuffer(gpu.ImageCopyTexture{Texture: tex}, gpu.ImageCopyBuffer{Buffer: s.buf}, size, size)
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().OnSubmittedWorkDone(done.Done)
+		s.frame, s.mapped = f, s.buf.MapAsync(gpu.MapRead, 0, 0)
+	}
+	for i := range slots {
+		check(&slots[i])
+	}
+	done.Wait()
+
+	// A map still pending when its buffer is unmapped is aborted; one that
+	// already completed is simply unmapped.
+	b := slots[0].buf
+	m := b.MapAsync(gpu.MapRead, 0, 0)
+	b.Unmap()
+	if err := <-m; err != nil && !errors.Is(err, gpu.ErrMapAborted) {
+		t.Errorf("MapAsync after Unmap: %v", err)
+	}
+}
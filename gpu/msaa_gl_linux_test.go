@@ -0,0 +1,154 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestGLMultisample draws a triangle into a 4x multisampled target with a
+// resolve target, then checks the resolve against the samples a kernel loads
+// from the multisampled texture: each resolved pixel is their average, and
+// pixels on the triangle's diagonal edge are partly covered.
+func TestGLMultisample(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL multisample test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const W, H = 16, 16
+	ms, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true, SampleCount: 4})
+	if err != nil {
+		t.Skipf("no 4x multisampled RGBA8Unorm: %v", err)
+	}
+	resolved, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("resolve texture: %v", err)
+	}
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLVert})
+	if err != nil {
+		t.Fatalf("vertex module: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: indexedGLFrag})
+	if err != nil {
+		t.Fatalf("fragment module: %v", err)
+	}
+	draw, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm, SampleCount: 4,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+	// A red triangle over the lower-left half, its hypotenuse a diagonal.
+	pos := []float32{-1, -1, 1, -1, -1, 1}
+	col := []float32{1, 0, 0, 1, 0, 0, 1, 0, 0}
+	posBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(pos), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	colBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(col), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+
+	const src = `package kernels
+type Vec4 struct{ X, Y, Z, W float32 }
+func Samples(gid uint, tex Texture2DMS, out []float32) {
+	x := int(gid % 16)
+	y := int(gid / 16)
+	out[gid*4] = tex.Load(x, y, 0).X
+	out[gid*4+1] = tex.Load(x, y, 1).X
+	out[gid*4+2] = tex.Load(x, y, 2).X
+	out[gid*4+3] = tex.Load(x, y, 3).X
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Samples"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	load, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: W * H * 4 * 4, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(load.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: ms, ResolveTarget: resolved, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1},
+	})
+	rp.SetPipeline(draw)
+	rp.SetVertexBuffer(0, posBuf)
+	rp.SetVertexBuffer(1, colBuf)
+	rp.Draw(gpu.TriangleList, 0, 3)
+	rp.End()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(load)
+	cp.SetBindGroup(0, bg)
+	cp.SetTexture(0, ms)
+	cp.Dispatch(W*H, 1, 1)
+	cp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	// ReadPixels is top-down; the kernel indexes texels bottom-up.
+	pix := resolved.ReadPixels()
+	samples := glFloatsOf(out.Bytes(), W*H*4)
+	partial := 0
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			s := samples[(y*W+x)*4:][:4]
+			mean := (s[0] + s[1] + s[2] + s[3]) / 4
+			got := pix[((H-1-y)*W+x)*4]
+			if want := math.Round(float64(mean) * 255); math.Abs(float64(got)-want) > 1 {
+				t.Fatalf("resolved red at (%d, %d) = %d, want %v, the mean of samples %v", x, y, got, want, s)
+			}
+			if mean > 0 && mean < 1 {
+				partial++
+			}
+		}
+	}
+	if partial == 0 {
+		t.Errorf("no partly covered pixels along the triangle's edge")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("a single-sampled pipeline in a multisampled pass did not panic")
+		}
+	}()
+	single, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+	enc = dev.NewCommandEncoder()
+	enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: ms}).SetPipeline(single)
+}
@@ -0,0 +1,172 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// GPU timestamp sampling (MTLCounterSampleBuffer), for timing compute and
+// render passes. Requires macOS 11 or newer and a GPU that samples counters
+// at stage boundaries (Apple silicon); SupportsStageBoundarySampling reports
+// which.
+package mtl
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/ebitengine/purego/objc"
+)
+
+var (
+	selRespondsToSelector      = objc.RegisterName("respondsToSelector:")
+	selSupportsCounterSampling = objc.RegisterName("supportsCounterSampling:")
+	selCounterSets             = objc.RegisterName("counterSets")
+	selCount                   = objc.RegisterName("count")
+	selObjectAtIndex           = objc.RegisterName("objectAtIndex:")
+	selIsEqualToString         = objc.RegisterName("isEqualToString:")
+	selSetCounterSet           = objc.RegisterName("setCounterSet:")
+	selSetSampleCount          = objc.RegisterName("setSampleCount:")
+	selNewCounterSampleBuffer  = objc.RegisterName("newCounterSampleBufferWithDescriptor:error:")
+	selResolveCounterRange     = objc.RegisterName("resolveCounterRange:")
+	selBytes                   = objc.RegisterName("bytes")
+	selLength                  = objc.RegisterName("length")
+	selSampleTimestamps        = objc.RegisterName("sampleTimestamps:gpuTimestamp:")
+	selSampleBufferAttachments = objc.RegisterName("sampleBufferAttachments")
+	selSetSampleBuffer         = objc.RegisterName("setSampleBuffer:")
+	selSetStartOfEncoderSample = objc.RegisterName("setStartOfEncoderSampleIndex:")
+	selSetEndOfEncoderSample   = objc.RegisterName("setEndOfEncoderSampleIndex:")
+	selSetStartOfVertexSample  = objc.RegisterName("setStartOfVertexSampleIndex:")
+	selSetEndOfFragmentSample  = objc.RegisterName("setEndOfFragmentSampleIndex:")
+	selComputePassDescriptor   = objc.RegisterName("computePassDescriptor")
+	selComputeEncoderWithDesc  = objc.RegisterName("computeCommandEncoderWithDescriptor:")
+)
+
+const (
+	// CounterErrorValue is the value of a sample the GPU failed to take
+	// (MTLCounterErrorValue).
+	CounterErrorValue = ^uint64(0)
+
+	counterSamplingStageBoundary = uint64(0) // MTLCounterSamplingPointAtStageBoundary
+)
+
+// nsRange is NSRange, passed by value.
+type nsRange struct{ location, length uint64 }
+
+// SupportsStageBoundarySampling reports whether the device can take counter
+// samples at the start and end of a pass, which ComputePassDescriptor and
+// RenderPassDescriptor sample buffers need.
+//
+// https://developer.apple.com/documentation/metal/mtldevice/3564405-supportscountersampling.
+func (d Device) SupportsStageBoundarySampling() bool {
+	if !objc.Send[bool](d.device, selRespondsToSelector, selSupportsCounterSampling) {
+		return false
+	}
+	return objc.Send[bool](d.device, selSupportsCounterSampling, counterSamplingStageBoundary)
+}
+
+// CounterSampleBuffer holds GPU counter samples taken by passes.
+//
+// https://developer.apple.com/documentation/metal/mtlcountersamplebuffer.
+type CounterSampleBuffer struct {
+	sampleBuffer objc.ID
+}
+
+// MakeTimestampSampleBuffer creates a shared sample buffer of count samples
+// of the device's timestamp counter set.
+//
+// https://developer.apple.com/documentation/metal/mtldevice/3566530-makecountersamplebuffer.
+func (d Device) MakeTimestampSampleBuffer(count int) (CounterSampleBuffer, error) {
+	sets := d.device.Send(selCounterSets)
+	var set objc.ID
+	for i := uint64(0); sets != 0 && i < objc.Send[uint64](sets, selCount); i++ {
+		s := sets.Send(selObjectAtIndex, i)
+		if objc.Send[bool](s.Send(selName), selIsEqualToString, nsString("timestamp")) {
+			set = s
+			break
+		}
+	}
+	if set == 0 {
+		return CounterSampleBuffer{}, errors.New("device has no timestamp counter set")
+	}
+	desc := objc.ID(objc.GetClass("MTLCounterSampleBufferDescriptor")).Send(selAlloc).Send(selInit)
+	defer desc.Send(selRelease)
+	desc.Send(selSetCounterSet, set)
+	desc.Send(selSetSampleCount, uint64(count))
+	desc.Send(selSetStorageMode, uint64(StorageModeShared))
+	var err objc.ID
+	sb := d.device.Send(selNewCounterSampleBuffer, desc, unsafe.Pointer(&err))
+	if sb == 0 {
+		return CounterSampleBuffer{}, errors.New(nsErrorString(err))
+	}
+	return CounterSampleBuffer{sb}, nil
+}
+
+// SampleTimestamps samples the CPU clock (in nanoseconds) and the GPU
+// timestamp counter at the same moment, to convert GPU timestamps to time.
+//
+// https://developer.apple.com/documentation/metal/mtldevice/3564407-sampletimestamps.
+func (d Device) SampleTimestamps() (cpu, gpu uint64) {
+	d.device.Send(selSampleTimestamps, unsafe.Pointer(&cpu), unsafe.Pointer(&gpu))
+	return cpu, gpu
+}
+
+// ResolveCounterRange returns count samples starting at first, in GPU
+// timestamp ticks. A sample that was not taken reads CounterErrorValue or 0.
+// The passes writing them must have completed.
+//
+// https://developer.apple.com/documentation/metal/mtlcountersamplebuffer/3564411-resolvecounterrange.
+func (s CounterSampleBuffer) ResolveCounterRange(first, count int) []uint64 {
+	out := make([]uint64, count)
+	data := s.sampleBuffer.Send(selResolveCounterRange, nsRange{uint64(first), uint64(count)})
+	if data == 0 {
+		return out
+	}
+	n := min(int(objc.Send[uint64](data, selLength))/8, count)
+	if n > 0 {
+		copy(out, unsafe.Slice((*uint64)(objc.Send[unsafe.Pointer](data, selBytes)), n))
+	}
+	return out
+}
+
+// Release frees the sample buffer.
+func (s CounterSampleBuffer) Release() {
+	s.sampleBuffer.Send(selRelease)
+}
+
+// SampleBufferAttachment samples the timestamp counter into Buffer at the
+// start of a pass (sample Start) and at its end (sample End).
+type SampleBufferAttachment struct {
+	Buffer     CounterSampleBuffer
+	Start, End int
+}
+
+// ComputePassDescriptor describes a compute pass.
+type ComputePassDescriptor struct {
+	// SampleBuffer, if set, takes timestamps at the start and end of the
+	// pass.
+	SampleBuffer *SampleBufferAttachment
+}
+
+// MakeComputeCommandEncoderWithDescriptor creates a compute command encoder
+// for the pass desc describes.
+//
+// https://developer.apple.com/documentation/metal/mtlcommandbuffer/3564448-computecommandencoderwithdescrip.
+func (cb CommandBuffer) MakeComputeCommandEncoderWithDescriptor(desc ComputePassDescriptor) ComputeCommandEncoder {
+	d := objc.ID(objc.GetClass("MTLComputePassDescriptor")).Send(selComputePassDescriptor)
+	if sb := desc.SampleBuffer; sb != nil {
+		att := d.Send(selSampleBufferAttachments).Send(selObjectAtIndexed, uint64(0))
+		att.Send(selSetSampleBuffer, sb.Buffer.sampleBuffer)
+		att.Send(selSetStartOfEncoderSample, uint64(sb.Start))
+		att.Send(selSetEndOfEncoderSample, uint64(sb.End))
+	}
+	return ComputeCommandEncoder{CommandEncoder{cb.commandBuffer.Send(selComputeEncoderWithDesc, d)}}
+}
+
+// setRender sets the render pass descriptor d to sample the timestamp
+// counter before the pass's first vertex and after its last fragment.
+func (sb *SampleBufferAttachment) setRender(d objc.ID) {
+	att := d.Send(selSampleBufferAttachments).Send(selObjectAtIndexed, uint64(0))
+	att.Send(selSetSampleBuffer, sb.Buffer.sampleBuffer)
+	att.Send(selSetStartOfVertexSample, uint64(sb.Start))
+	att.Send(selSetEndOfFragmentSample, uint64(sb.End))
+}
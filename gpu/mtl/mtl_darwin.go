@@ -53,6 +53,7 @@ var (
 	selIsHeadless            = objc.RegisterName("isHeadless")
 	selIsRemovable           = objc.RegisterName("isRemovable")
 	selRegistryID            = objc.RegisterName("registryID")
+	selMaxBufferLength       = objc.RegisterName("maxBufferLength")
 	selUTF8String            = objc.RegisterName("UTF8String")
 	selLocalizedDescription  = objc.RegisterName("localizedDescription")
 	selStringWithUTF8String  = objc.RegisterName("stringWithUTF8String:")
@@ -67,11 +68,15 @@ var (
 	selSetBytes              = objc.RegisterName("setBytes:length:atIndex:")
 	selSetBuffer             = objc.RegisterName("setBuffer:offset:atIndex:")
 	selDispatchThreads       = objc.RegisterName("dispatchThreads:threadsPerThreadgroup:")
+	selDispatchThreadgroups  = objc.RegisterName("dispatchThreadgroups:threadsPerThreadgroup:")
+	selDispatchIndirect      = objc.RegisterName("dispatchThreadgroupsWithIndirectBuffer:indirectBufferOffset:threadsPerThreadgroup:")
 	selEndEncoding           = objc.RegisterName("endEncoding")
 	selCommit                = objc.RegisterName("commit")
 	selWaitUntilCompleted    = objc.RegisterName("waitUntilCompleted")
 	selPresentDrawable       = objc.RegisterName("presentDrawable:")
 	selAddCompletedHandler   = objc.RegisterName("addCompletedHandler:")
+	selError                 = objc.RegisterName("error")
+	selCode                  = objc.RegisterName("code")
 	selNewBufferWithBytes    = objc.RegisterName("newBufferWithBytes:length:options:")
 	selNewBufferWithLength   = objc.RegisterName("newBufferWithLength:options:")
 	selContents              = objc.RegisterName("contents")
@@ -88,7 +93,16 @@ var (
 	selTexWidth              = objc.RegisterName("width")
 	selTexHeight             = objc.RegisterName("height")
 	selReplaceRegion         = objc.RegisterName("replaceRegion:mipmapLevel:withBytes:bytesPerRow:")
+	selReplaceRegionSlice    = objc.RegisterName("replaceRegion:mipmapLevel:slice:withBytes:bytesPerRow:bytesPerImage:")
+	selSetTextureType        = objc.RegisterName("setTextureType:")
+	selSetDepth              = objc.RegisterName("setDepth:")
+	selSetArrayLength        = objc.RegisterName("setArrayLength:")
+	selSetMipmapLevelCount   = objc.RegisterName("setMipmapLevelCount:")
 	selCopyFromTexture       = objc.RegisterName("copyFromTexture:sourceSlice:sourceLevel:sourceOrigin:sourceSize:toTexture:destinationSlice:destinationLevel:destinationOrigin:")
+	selCopyBufferToBuffer    = objc.RegisterName("copyFromBuffer:sourceOffset:toBuffer:destinationOffset:size:")
+	selCopyBufferToTexture   = objc.RegisterName("copyFromBuffer:sourceOffset:sourceBytesPerRow:sourceBytesPerImage:sourceSize:toTexture:destinationSlice:destinationLevel:destinationOrigin:")
+	selGenerateMipmaps       = objc.RegisterName("generateMipmapsForTexture:")
+	selCopyTextureToBuffer   = objc.RegisterName("copyFromTexture:sourceSlice:sourceLevel:sourceOrigin:sourceSize:toBuffer:destinationOffset:destinationBytesPerRow:destinationBytesPerImage:")
 	selSetLanguageVersion    = objc.RegisterName("setLanguageVersion:")
 )
 
@@ -164,6 +178,13 @@ func (d Device) Available() bool {
 	return d.device != 0
 }
 
+// MaxBufferLength returns the largest buffer the device can allocate, in
+// bytes.
+// https://developer.apple.com/documentation/metal/mtldevice/2966563-maxbufferlength.
+func (d Device) MaxBufferLength() int {
+	return int(objc.Send[uint64](d.device, selMaxBufferLength))
+}
+
 // Device returns the underlying id<MTLDevice> pointer.
 func (d Device) Device() unsafe.Pointer { return toPtr(d.device) }
 
@@ -212,6 +233,21 @@ func (d Device) MakeTexture(td TextureDescriptor) Texture {
 	desc.Send(selSetWidth, uint64(td.Width))
 	desc.Send(selSetHeight, uint64(td.Height))
 	desc.Send(selSetStorageMode, uint64(td.StorageMode))
+	if td.TextureType != 0 {
+		desc.Send(selSetTextureType, uint64(td.TextureType))
+	}
+	if td.Depth > 1 {
+		desc.Send(selSetDepth, uint64(td.Depth))
+	}
+	if td.ArrayLength > 1 {
+		desc.Send(selSetArrayLength, uint64(td.ArrayLength))
+	}
+	if td.MipmapLevelCount > 1 {
+		desc.Send(selSetMipmapLevelCount, uint64(td.MipmapLevelCount))
+	}
+	if td.SampleCount > 1 {
+		desc.Send(selSetSampleCount, uint64(td.SampleCount))
+	}
 	if td.Usage != 0 {
 		desc.Send(selSetUsage, uint64(td.Usage))
 	}
@@ -254,26 +290,50 @@ const (
 // PixelFormat defines data formats that describe the organization
 // and characteristics of individual pixels in a texture.
 // https://developer.apple.com/documentation/metal/mtlpixelformat.
-type PixelFormat uint8
+type PixelFormat uint16
 
 // The data formats that describe the organization and characteristics
 // of individual pixels in a texture.
 const (
-	PixelFormatRGBA8UNorm     PixelFormat = 70  // Ordinary format with four 8-bit normalized unsigned integer components in RGBA order.
-	PixelFormatBGRA8UNorm     PixelFormat = 80  // Ordinary format with four 8-bit normalized unsigned integer components in BGRA order.
-	PixelFormatBGRA8UNormSRGB PixelFormat = 81  // Ordinary format with four 8-bit normalized unsigned integer components in BGRA order with conversion between sRGB and linear space.
-	PixelFormatRGBA32Float    PixelFormat = 125 // Four 32-bit floating-point components in RGBA order, for a float render target (G-buffer).
-	PixelFormatDepth32Float   PixelFormat = 252 // A pixel format with one 32-bit floating-point component, used for a depth render target.
+	PixelFormatR8UNorm              PixelFormat = 10  // One 8-bit normalized unsigned integer component.
+	PixelFormatR32Float             PixelFormat = 55  // One 32-bit floating-point component.
+	PixelFormatRG16Float            PixelFormat = 65  // Two 16-bit floating-point components.
+	PixelFormatRGBA8UNorm           PixelFormat = 70  // Ordinary format with four 8-bit normalized unsigned integer components in RGBA order.
+	PixelFormatBGRA8UNorm           PixelFormat = 80  // Ordinary format with four 8-bit normalized unsigned integer components in BGRA order.
+	PixelFormatBGRA8UNormSRGB       PixelFormat = 81  // Ordinary format with four 8-bit normalized unsigned integer components in BGRA order with conversion between sRGB and linear space.
+	PixelFormatRGBA16Float          PixelFormat = 115 // Four 16-bit floating-point components in RGBA order.
+	PixelFormatRGBA32Float          PixelFormat = 125 // Four 32-bit floating-point components in RGBA order, for a float render target (G-buffer).
+	PixelFormatDepth32Float         PixelFormat = 252 // A pixel format with one 32-bit floating-point component, used for a depth render target.
+	PixelFormatDepth32FloatStencil8 PixelFormat = 260 // A 32-bit floating-point depth component and an 8-bit stencil component.
 )
 
-// TextureDescriptor configures new Texture objects.
+// TextureType is the dimension and arrangement of a texture's images.
+// https://developer.apple.com/documentation/metal/mtltexturetype.
+type TextureType uint8
+
+const (
+	TextureType2D            TextureType = 2
+	TextureType2DArray       TextureType = 3
+	TextureType2DMultisample TextureType = 4
+	TextureTypeCube          TextureType = 5
+	TextureType3D            TextureType = 7
+)
+
+// TextureDescriptor configures new Texture objects. A zero TextureType is
+// TextureType2D, and zero Depth, ArrayLength, MipmapLevelCount and
+// SampleCount are 1.
 // https://developer.apple.com/documentation/metal/mtltexturedescriptor.
 type TextureDescriptor struct {
-	PixelFormat PixelFormat
-	Width       int
-	Height      int
-	StorageMode StorageMode
-	Usage       TextureUsage
+	TextureType      TextureType
+	PixelFormat      PixelFormat
+	Width            int
+	Height           int
+	Depth            int
+	ArrayLength      int
+	MipmapLevelCount int
+	SampleCount      int
+	StorageMode      StorageMode
+	Usage            TextureUsage
 }
 
 // Texture is a memory allocation for storing formatted
@@ -305,6 +365,15 @@ func (t Texture) ReplaceRegion(region Region, level int, pixelBytes []byte, byte
 	t.texture.Send(selReplaceRegion, r, uint64(level), unsafe.Pointer(&pixelBytes[0]), uint64(bytesPerRow))
 }
 
+// ReplaceRegionSlice copies a block of pixels into a section of a slice (an
+// array layer or cube face) of a mip level. bytesPerImage is the size of
+// one 2D image of a region more than one texel deep.
+// https://developer.apple.com/documentation/metal/mtltexture/1515598-replaceregion.
+func (t Texture) ReplaceRegionSlice(region Region, level, slice int, pixelBytes []byte, bytesPerRow, bytesPerImage int) {
+	r := mtlRegion{origin: region.Origin.c(), size: region.Size.c()}
+	t.texture.Send(selReplaceRegionSlice, r, uint64(level), uint64(slice), unsafe.Pointer(&pixelBytes[0]), uint64(bytesPerRow), uint64(bytesPerImage))
+}
+
 // CommandQueue is a queue that organizes the order
 // in which command buffers are executed by the GPU.
 // https://developer.apple.com/documentation/metal/mtlcommandqueue.
@@ -366,6 +435,35 @@ func (cb CommandBuffer) AddCompletedHandler(f func()) {
 	cb.commandBuffer.Send(selAddCompletedHandler, block)
 }
 
+// CommandBufferError is the error of a command buffer that failed to run.
+// https://developer.apple.com/documentation/metal/mtlcommandbuffererror/code.
+type CommandBufferError struct {
+	Code        int
+	Description string
+}
+
+// Command buffer error codes.
+const (
+	CommandBufferErrorAccessRevoked = 4
+	CommandBufferErrorOutOfMemory   = 8
+	CommandBufferErrorDeviceRemoved = 11
+)
+
+func (e *CommandBufferError) Error() string {
+	return fmt.Sprintf("command buffer error %d: %s", e.Code, e.Description)
+}
+
+// Error returns the error the command buffer failed with, or nil. It is only
+// meaningful once the command buffer has completed.
+// https://developer.apple.com/documentation/metal/mtlcommandbuffer/1443017-error.
+func (cb CommandBuffer) Error() error {
+	e := cb.commandBuffer.Send(selError)
+	if e == 0 {
+		return nil
+	}
+	return &CommandBufferError{Code: int(objc.Send[int64](e, selCode)), Description: nsErrorString(e)}
+}
+
 // Release frees the command buffer.
 func (cb CommandBuffer) Release() {
 	cb.commandBuffer.Send(selRelease)
@@ -417,6 +515,22 @@ func (cce ComputeCommandEncoder) DispatchThreads(threadsPerGrid, threadsPerThrea
 	cce.commandEncoder.Send(selDispatchThreads, threadsPerGrid.c(), threadsPerThreadgroup.c())
 }
 
+// DispatchThreadgroups encodes a compute command using a grid aligned to
+// threadgroup boundaries.
+//
+// https://developer.apple.com/documentation/metal/mtlcomputecommandencoder/1443138-dispatchthreadgroups?language=objc
+func (cce ComputeCommandEncoder) DispatchThreadgroups(threadgroupsPerGrid, threadsPerThreadgroup Size) {
+	cce.commandEncoder.Send(selDispatchThreadgroups, threadgroupsPerGrid.c(), threadsPerThreadgroup.c())
+}
+
+// DispatchThreadgroupsWithIndirectBuffer is DispatchThreadgroups with the
+// threadgroup counts (three uint32s) read from indirectBuffer at offset.
+//
+// https://developer.apple.com/documentation/metal/mtlcomputecommandencoder/1443157-dispatchthreadgroupswithindirect?language=objc
+func (cce ComputeCommandEncoder) DispatchThreadgroupsWithIndirectBuffer(indirectBuffer Buffer, offset int, threadsPerThreadgroup Size) {
+	cce.commandEncoder.Send(selDispatchIndirect, indirectBuffer.buffer, uint64(offset), threadsPerThreadgroup.c())
+}
+
 // CommandEncoder is an encoder that writes sequential GPU commands
 // into a command buffer.
 // https://developer.apple.com/documentation/metal/mtlcommandencoder.
@@ -450,6 +564,48 @@ func (bce BlitCommandEncoder) CopyFromTexture(
 	)
 }
 
+// CopyFromBuffer encodes a command to copy size bytes from a source buffer
+// into a destination buffer.
+// https://developer.apple.com/documentation/metal/mtlblitcommandencoder/1400767-copyfrombuffer.
+func (bce BlitCommandEncoder) CopyFromBuffer(src Buffer, srcOffset int, dst Buffer, dstOffset, size int) {
+	bce.commandEncoder.Send(selCopyBufferToBuffer,
+		src.buffer, uint64(srcOffset), dst.buffer, uint64(dstOffset), uint64(size),
+	)
+}
+
+// CopyFromBufferToTexture encodes a command to copy image data from a source
+// buffer into a slice of a destination texture.
+// https://developer.apple.com/documentation/metal/mtlblitcommandencoder/1400771-copyfrombuffer.
+func (bce BlitCommandEncoder) CopyFromBufferToTexture(
+	src Buffer, srcOffset, srcBytesPerRow, srcBytesPerImage int, srcSize Size,
+	dst Texture, dstSlice, dstLevel int, dstOrigin Origin,
+) {
+	bce.commandEncoder.Send(selCopyBufferToTexture,
+		src.buffer, uint64(srcOffset), uint64(srcBytesPerRow), uint64(srcBytesPerImage), srcSize.c(),
+		dst.texture, uint64(dstSlice), uint64(dstLevel), dstOrigin.c(),
+	)
+}
+
+// CopyFromTextureToBuffer encodes a command to copy image data from a slice of
+// a source texture into a destination buffer.
+// https://developer.apple.com/documentation/metal/mtlblitcommandencoder/1400756-copyfromtexture.
+func (bce BlitCommandEncoder) CopyFromTextureToBuffer(
+	src Texture, srcSlice, srcLevel int, srcOrigin Origin, srcSize Size,
+	dst Buffer, dstOffset, dstBytesPerRow, dstBytesPerImage int,
+) {
+	bce.commandEncoder.Send(selCopyTextureToBuffer,
+		src.texture, uint64(srcSlice), uint64(srcLevel), srcOrigin.c(), srcSize.c(),
+		dst.buffer, uint64(dstOffset), uint64(dstBytesPerRow), uint64(dstBytesPerImage),
+	)
+}
+
+// GenerateMipmaps encodes a command that generates mipmaps for a texture
+// from its base level.
+// https://developer.apple.com/documentation/metal/mtlblitcommandencoder/1400748-generatemipmapsfortexture.
+func (bce BlitCommandEncoder) GenerateMipmaps(t Texture) {
+	bce.commandEncoder.Send(selGenerateMipmaps, t.texture)
+}
+
 // Release frees the blit command encoder.
 func (bce BlitCommandEncoder) Release() {
 	bce.commandEncoder.Send(selRelease)
@@ -579,6 +735,11 @@ type Library struct {
 	library objc.ID
 }
 
+// Release frees the library.
+func (l Library) Release() {
+	l.library.Send(selRelease)
+}
+
 // MakeLibrary creates a new library that contains
 // the functions stored in the specified source string.
 //
@@ -624,6 +785,11 @@ type ComputePipelineState struct {
 	computePipelineState objc.ID
 }
 
+// Release frees the pipeline state.
+func (cps ComputePipelineState) Release() {
+	cps.computePipelineState.Send(selRelease)
+}
+
 // MakeComputePipelineState creates a compute pipeline state object.
 //
 // https://developer.apple.com/documentation/metal/mtldevice/1433427-newcomputepipelinestatewithfunct.
@@ -26,6 +26,8 @@ var (
 	selSetTexture          = objc.RegisterName("setTexture:")
 	selSetLoadAction       = objc.RegisterName("setLoadAction:")
 	selSetStoreAction      = objc.RegisterName("setStoreAction:")
+	selSetResolveTexture   = objc.RegisterName("setResolveTexture:")
+	selSetRasterSamples    = objc.RegisterName("setRasterSampleCount:")
 	selSetClearColor       = objc.RegisterName("setClearColor:")
 	selRenderEncoder       = objc.RegisterName("renderCommandEncoderWithDescriptor:")
 	selSetRenderPipeline   = objc.RegisterName("setRenderPipelineState:")
@@ -33,25 +35,52 @@ var (
 	selSetFragmentBuffer   = objc.RegisterName("setFragmentBuffer:offset:atIndex:")
 	selSetVertexBytes      = objc.RegisterName("setVertexBytes:length:atIndex:")
 	selDrawPrimitives      = objc.RegisterName("drawPrimitives:vertexStart:vertexCount:")
+	selDrawInstanced       = objc.RegisterName("drawPrimitives:vertexStart:vertexCount:instanceCount:baseInstance:")
+	selDrawIndexed         = objc.RegisterName("drawIndexedPrimitives:indexCount:indexType:indexBuffer:indexBufferOffset:instanceCount:baseVertex:baseInstance:")
+	selDrawIndirect        = objc.RegisterName("drawPrimitives:indirectBuffer:indirectBufferOffset:")
+	selDrawIndexedIndirect = objc.RegisterName("drawIndexedPrimitives:indexType:indexBuffer:indexBufferOffset:indirectBuffer:indirectBufferOffset:")
 	selSetUsage            = objc.RegisterName("setUsage:")
 	selGetBytes            = objc.RegisterName("getBytes:bytesPerRow:fromRegion:mipmapLevel:")
+	selGetBytesSlice       = objc.RegisterName("getBytes:bytesPerRow:bytesPerImage:fromRegion:mipmapLevel:slice:")
 
 	selNewSamplerState   = objc.RegisterName("newSamplerStateWithDescriptor:")
 	selSetMinFilter      = objc.RegisterName("setMinFilter:")
 	selSetMagFilter      = objc.RegisterName("setMagFilter:")
 	selSetSAddressMode   = objc.RegisterName("setSAddressMode:")
 	selSetTAddressMode   = objc.RegisterName("setTAddressMode:")
+	selSetRAddressMode   = objc.RegisterName("setRAddressMode:")
+	selSetMipFilter      = objc.RegisterName("setMipFilter:")
+	selSetLodMinClamp    = objc.RegisterName("setLodMinClamp:")
+	selSetLodMaxClamp    = objc.RegisterName("setLodMaxClamp:")
+	selSetMaxAnisotropy  = objc.RegisterName("setMaxAnisotropy:")
+	selSetCompareFunc    = objc.RegisterName("setCompareFunction:")
 	selSetComputeTexture = objc.RegisterName("setTexture:atIndex:")
 	selSetComputeSampler = objc.RegisterName("setSamplerState:atIndex:")
 
 	// Depth-stencil support.
 	selSetDepthAttachPixFmt = objc.RegisterName("setDepthAttachmentPixelFormat:")
 	selDepthAttachment      = objc.RegisterName("depthAttachment")
+	selSetStencilPixFmt     = objc.RegisterName("setStencilAttachmentPixelFormat:")
+	selStencilAttachment    = objc.RegisterName("stencilAttachment")
 	selSetClearDepth        = objc.RegisterName("setClearDepth:")
 	selNewDepthStencilState = objc.RegisterName("newDepthStencilStateWithDescriptor:")
 	selSetDepthCompareFunc  = objc.RegisterName("setDepthCompareFunction:")
 	selSetDepthWriteEnabled = objc.RegisterName("setDepthWriteEnabled:")
 	selSetDepthStencilState = objc.RegisterName("setDepthStencilState:")
+
+	selSetBlendingEnabled     = objc.RegisterName("setBlendingEnabled:")
+	selSetSourceRGBBlend      = objc.RegisterName("setSourceRGBBlendFactor:")
+	selSetDestinationRGBBlend = objc.RegisterName("setDestinationRGBBlendFactor:")
+	selSetRGBBlendOperation   = objc.RegisterName("setRgbBlendOperation:")
+	selSetSourceAlphaBlend    = objc.RegisterName("setSourceAlphaBlendFactor:")
+	selSetDestAlphaBlend      = objc.RegisterName("setDestinationAlphaBlendFactor:")
+	selSetAlphaBlendOperation = objc.RegisterName("setAlphaBlendOperation:")
+	selSetCullMode            = objc.RegisterName("setCullMode:")
+	selSetFrontFacingWinding  = objc.RegisterName("setFrontFacingWinding:")
+	selSetWriteMask           = objc.RegisterName("setWriteMask:")
+
+	selSetVisibilityResultBuffer = objc.RegisterName("setVisibilityResultBuffer:")
+	selSetVisibilityResultMode   = objc.RegisterName("setVisibilityResultMode:offset:")
 )
 
 // SamplerMinMagFilter selects nearest or linear filtering.
@@ -62,6 +91,15 @@ const (
 	SamplerFilterLinear  SamplerMinMagFilter = 1
 )
 
+// SamplerMipFilter selects how a sample picks mip levels.
+type SamplerMipFilter uint8
+
+const (
+	SamplerMipFilterNotMipmapped SamplerMipFilter = 0 // always level 0
+	SamplerMipFilterNearest      SamplerMipFilter = 1
+	SamplerMipFilterLinear       SamplerMipFilter = 2
+)
+
 // SamplerAddressMode selects how out-of-range texture coordinates are handled.
 type SamplerAddressMode uint8
 
@@ -74,8 +112,16 @@ const (
 type SamplerDescriptor struct {
 	MinFilter    SamplerMinMagFilter
 	MagFilter    SamplerMinMagFilter
+	MipFilter    SamplerMipFilter
 	SAddressMode SamplerAddressMode
 	TAddressMode SamplerAddressMode
+	RAddressMode SamplerAddressMode
+	LodMinClamp  float32
+	LodMaxClamp  float32
+	// MaxAnisotropy is 1 to 16; 0 leaves the default, 1.
+	MaxAnisotropy int
+	// CompareFunction is what sample_compare tests with.
+	CompareFunction CompareFunction
 }
 
 // SamplerState is a compiled texture sampler.
@@ -90,6 +136,14 @@ func (d Device) MakeSamplerState(sd SamplerDescriptor) SamplerState {
 	desc.Send(selSetMagFilter, uint64(sd.MagFilter))
 	desc.Send(selSetSAddressMode, uint64(sd.SAddressMode))
 	desc.Send(selSetTAddressMode, uint64(sd.TAddressMode))
+	desc.Send(selSetRAddressMode, uint64(sd.RAddressMode))
+	desc.Send(selSetMipFilter, uint64(sd.MipFilter))
+	desc.Send(selSetLodMinClamp, sd.LodMinClamp)
+	desc.Send(selSetLodMaxClamp, sd.LodMaxClamp)
+	if sd.MaxAnisotropy > 0 {
+		desc.Send(selSetMaxAnisotropy, uint64(sd.MaxAnisotropy))
+	}
+	desc.Send(selSetCompareFunc, uint64(sd.CompareFunction))
 	s := d.device.Send(selNewSamplerState, desc)
 	desc.Send(selRelease)
 	return SamplerState{s}
@@ -133,8 +187,10 @@ const (
 type StoreAction uint8
 
 const (
-	StoreActionDontCare StoreAction = 0
-	StoreActionStore    StoreAction = 1
+	StoreActionDontCare                   StoreAction = 0
+	StoreActionStore                      StoreAction = 1
+	StoreActionMultisampleResolve         StoreAction = 2
+	StoreActionStoreAndMultisampleResolve StoreAction = 3
 )
 
 // PrimitiveType is the geometry primitive a draw call assembles.
@@ -149,6 +205,15 @@ const (
 	PrimitiveTypeTriangleStrip PrimitiveType = 4
 )
 
+// IndexType is the element type of an index buffer.
+// https://developer.apple.com/documentation/metal/mtlindextype.
+type IndexType uint8
+
+const (
+	IndexTypeUInt16 IndexType = 0
+	IndexTypeUInt32 IndexType = 1
+)
+
 // ClearColor is the value an attachment is cleared to.
 type ClearColor struct{ Red, Green, Blue, Alpha float64 }
 
@@ -158,16 +223,108 @@ type RenderPipelineState struct {
 	renderPipelineState objc.ID
 }
 
+// Release frees the pipeline state.
+func (rps RenderPipelineState) Release() {
+	rps.renderPipelineState.Send(selRelease)
+}
+
 // CompareFunction is the depth comparison test.
 // https://developer.apple.com/documentation/metal/mtlcomparefunction.
 type CompareFunction uint8
 
 const (
-	CompareFunctionNever     CompareFunction = 0
-	CompareFunctionLess      CompareFunction = 1
-	CompareFunctionLessEqual CompareFunction = 3
-	CompareFunctionGreater   CompareFunction = 4
-	CompareFunctionAlways    CompareFunction = 7
+	CompareFunctionNever        CompareFunction = 0
+	CompareFunctionLess         CompareFunction = 1
+	CompareFunctionEqual        CompareFunction = 2
+	CompareFunctionLessEqual    CompareFunction = 3
+	CompareFunctionGreater      CompareFunction = 4
+	CompareFunctionNotEqual     CompareFunction = 5
+	CompareFunctionGreaterEqual CompareFunction = 6
+	CompareFunctionAlways       CompareFunction = 7
+)
+
+// BlendFactor scales a blend source or destination term.
+// https://developer.apple.com/documentation/metal/mtlblendfactor.
+type BlendFactor uint8
+
+const (
+	BlendFactorZero                     BlendFactor = 0
+	BlendFactorOne                      BlendFactor = 1
+	BlendFactorSourceColor              BlendFactor = 2
+	BlendFactorOneMinusSourceColor      BlendFactor = 3
+	BlendFactorSourceAlpha              BlendFactor = 4
+	BlendFactorOneMinusSourceAlpha      BlendFactor = 5
+	BlendFactorDestinationColor         BlendFactor = 6
+	BlendFactorOneMinusDestinationColor BlendFactor = 7
+	BlendFactorDestinationAlpha         BlendFactor = 8
+	BlendFactorOneMinusDestinationAlpha BlendFactor = 9
+)
+
+// BlendOperation combines the blend source and destination terms.
+// https://developer.apple.com/documentation/metal/mtlblendoperation.
+type BlendOperation uint8
+
+const (
+	BlendOperationAdd             BlendOperation = 0
+	BlendOperationSubtract        BlendOperation = 1
+	BlendOperationReverseSubtract BlendOperation = 2
+	BlendOperationMin             BlendOperation = 3
+	BlendOperationMax             BlendOperation = 4
+)
+
+// ColorAttachmentBlend is the blend state of one pipeline color attachment.
+type ColorAttachmentBlend struct {
+	Enabled                bool
+	SourceRGBFactor        BlendFactor
+	DestinationRGBFactor   BlendFactor
+	RGBOperation           BlendOperation
+	SourceAlphaFactor      BlendFactor
+	DestinationAlphaFactor BlendFactor
+	AlphaOperation         BlendOperation
+}
+
+// ColorWriteMask selects the channels a pipeline writes to a color
+// attachment.
+// https://developer.apple.com/documentation/metal/mtlcolorwritemask.
+type ColorWriteMask uint8
+
+const (
+	ColorWriteMaskNone  ColorWriteMask = 0
+	ColorWriteMaskAlpha ColorWriteMask = 1
+	ColorWriteMaskBlue  ColorWriteMask = 2
+	ColorWriteMaskGreen ColorWriteMask = 4
+	ColorWriteMaskRed   ColorWriteMask = 8
+	ColorWriteMaskAll   ColorWriteMask = 0xF
+)
+
+// VisibilityResultMode selects what a render command encoder's draws write
+// to the visibility result buffer.
+// https://developer.apple.com/documentation/metal/mtlvisibilityresultmode.
+type VisibilityResultMode uint8
+
+const (
+	VisibilityResultModeDisabled VisibilityResultMode = 0
+	VisibilityResultModeBoolean  VisibilityResultMode = 1
+	VisibilityResultModeCounting VisibilityResultMode = 2
+)
+
+// CullMode selects the faces a render command encoder discards.
+// https://developer.apple.com/documentation/metal/mtlcullmode.
+type CullMode uint8
+
+const (
+	CullModeNone  CullMode = 0
+	CullModeFront CullMode = 1
+	CullModeBack  CullMode = 2
+)
+
+// Winding is the vertex winding of a front-facing triangle.
+// https://developer.apple.com/documentation/metal/mtlwinding.
+type Winding uint8
+
+const (
+	WindingClockwise        Winding = 0
+	WindingCounterClockwise Winding = 1
 )
 
 // DepthStencilState is a compiled depth/stencil state.
@@ -176,6 +333,11 @@ type DepthStencilState struct {
 	depthStencilState objc.ID
 }
 
+// Release frees the depth/stencil state.
+func (dss DepthStencilState) Release() {
+	dss.depthStencilState.Send(selRelease)
+}
+
 // DepthStencilDescriptor configures a depth/stencil state.
 type DepthStencilDescriptor struct {
 	DepthCompareFunction CompareFunction
@@ -205,6 +367,17 @@ type RenderPipelineDescriptor struct {
 	ExtraColorPixelFormats []PixelFormat
 	// DepthPixelFormat is the depth attachment format, or 0 (Invalid) for none.
 	DepthPixelFormat PixelFormat
+	// StencilPixelFormat is the stencil attachment format, or 0 for none; a
+	// depth-stencil format is set as both.
+	StencilPixelFormat PixelFormat
+	// Blend is the blend state of color attachments 0..N; missing entries do
+	// not blend.
+	Blend []ColorAttachmentBlend
+	// WriteMasks are the write masks of color attachments 0..N; missing
+	// entries write every channel.
+	WriteMasks []ColorWriteMask
+	// SampleCount is the attachments' sample count; 0 means 1.
+	SampleCount int
 }
 
 // MakeRenderPipelineState creates a render pipeline state object.
@@ -221,6 +394,26 @@ func (d Device) MakeRenderPipelineState(desc RenderPipelineDescriptor) (RenderPi
 		a.Send(selSetPixelFormat, uint64(f))
 	}
 	rpd.Send(selSetDepthAttachPixFmt, uint64(desc.DepthPixelFormat))
+	rpd.Send(selSetStencilPixFmt, uint64(desc.StencilPixelFormat))
+	for i, b := range desc.Blend {
+		if !b.Enabled {
+			continue
+		}
+		a := rpd.Send(selColorAttachments).Send(selObjectAtIndexed, uint64(i))
+		a.Send(selSetBlendingEnabled, uint64(1))
+		a.Send(selSetSourceRGBBlend, uint64(b.SourceRGBFactor))
+		a.Send(selSetDestinationRGBBlend, uint64(b.DestinationRGBFactor))
+		a.Send(selSetRGBBlendOperation, uint64(b.RGBOperation))
+		a.Send(selSetSourceAlphaBlend, uint64(b.SourceAlphaFactor))
+		a.Send(selSetDestAlphaBlend, uint64(b.DestinationAlphaFactor))
+		a.Send(selSetAlphaBlendOperation, uint64(b.AlphaOperation))
+	}
+	for i, m := range desc.WriteMasks {
+		rpd.Send(selColorAttachments).Send(selObjectAtIndexed, uint64(i)).Send(selSetWriteMask, uint64(m))
+	}
+	if desc.SampleCount > 1 {
+		rpd.Send(selSetRasterSamples, uint64(desc.SampleCount))
+	}
 
 	var err objc.ID
 	pso := d.device.Send(selNewRenderPipeline, rpd, unsafe.Pointer(&err))
@@ -236,6 +429,9 @@ type ColorAttachment struct {
 	LoadAction  LoadAction
 	StoreAction StoreAction
 	ClearColor  ClearColor
+	// ResolveTexture, if set (a non-zero texture id), receives the resolved
+	// samples of a multisampled Texture under a resolving StoreAction.
+	ResolveTexture Texture
 }
 
 // DepthAttachment configures a render-pass depth attachment.
@@ -244,6 +440,9 @@ type DepthAttachment struct {
 	LoadAction  LoadAction
 	StoreAction StoreAction
 	ClearDepth  float64
+	// Stencil also attaches Texture, of a depth-stencil format, as the
+	// stencil attachment, cleared to 0 and not stored.
+	Stencil bool
 }
 
 // RenderPassDescriptor describes a render pass's attachments.
@@ -255,6 +454,12 @@ type RenderPassDescriptor struct {
 	// Depth is the optional depth attachment. It is used when its Texture is set
 	// (a non-zero texture id).
 	Depth DepthAttachment
+	// SampleBuffer, if set, takes timestamps at the start and end of the
+	// pass.
+	SampleBuffer *SampleBufferAttachment
+	// VisibilityResultBuffer, if set (a non-zero buffer id), receives the
+	// results of SetVisibilityResultMode.
+	VisibilityResultBuffer Buffer
 }
 
 // objc builds the MTLRenderPassDescriptor.
@@ -265,6 +470,9 @@ func (rp RenderPassDescriptor) objc() objc.ID {
 		att.Send(selSetTexture, c.Texture.texture)
 		att.Send(selSetLoadAction, uint64(c.LoadAction))
 		att.Send(selSetStoreAction, uint64(c.StoreAction))
+		if c.ResolveTexture.texture != 0 {
+			att.Send(selSetResolveTexture, c.ResolveTexture.texture)
+		}
 		att.Send(selSetClearColor, mtlClearColor{c.ClearColor.Red, c.ClearColor.Green, c.ClearColor.Blue, c.ClearColor.Alpha})
 	}
 	setColor(0, rp.ColorAttachment0)
@@ -277,6 +485,18 @@ func (rp RenderPassDescriptor) objc() objc.ID {
 		da.Send(selSetLoadAction, uint64(rp.Depth.LoadAction))
 		da.Send(selSetStoreAction, uint64(rp.Depth.StoreAction))
 		da.Send(selSetClearDepth, rp.Depth.ClearDepth)
+		if rp.Depth.Stencil {
+			sa := d.Send(selStencilAttachment)
+			sa.Send(selSetTexture, rp.Depth.Texture.texture)
+			sa.Send(selSetLoadAction, uint64(LoadActionClear))
+			sa.Send(selSetStoreAction, uint64(StoreActionDontCare))
+		}
+	}
+	if rp.SampleBuffer != nil {
+		rp.SampleBuffer.setRender(d)
+	}
+	if rp.VisibilityResultBuffer.buffer != 0 {
+		d.Send(selSetVisibilityResultBuffer, rp.VisibilityResultBuffer.buffer)
 	}
 	return d
 }
@@ -303,6 +523,24 @@ func (rce RenderCommandEncoder) SetDepthStencilState(s DepthStencilState) {
 	rce.commandEncoder.Send(selSetDepthStencilState, s.depthStencilState)
 }
 
+// SetCullMode sets which faces subsequent draws discard.
+func (rce RenderCommandEncoder) SetCullMode(m CullMode) {
+	rce.commandEncoder.Send(selSetCullMode, uint64(m))
+}
+
+// SetFrontFacingWinding sets the winding of a front-facing triangle.
+func (rce RenderCommandEncoder) SetFrontFacingWinding(w Winding) {
+	rce.commandEncoder.Send(selSetFrontFacingWinding, uint64(w))
+}
+
+// SetVisibilityResultMode makes subsequent draws record, at offset bytes
+// into the pass's visibility result buffer, whether (or, counting, how many)
+// samples passed the depth test.
+// https://developer.apple.com/documentation/metal/mtlrendercommandencoder/1515556-setvisibilityresultmode.
+func (rce RenderCommandEncoder) SetVisibilityResultMode(mode VisibilityResultMode, offset int) {
+	rce.commandEncoder.Send(selSetVisibilityResultMode, uint64(mode), uint64(offset))
+}
+
 // SetVertexBuffer binds a buffer for the vertex function.
 func (rce RenderCommandEncoder) SetVertexBuffer(b Buffer, offset, index int) {
 	rce.commandEncoder.Send(selSetVertexBuffer, b.buffer, uint64(offset), uint64(index))
@@ -323,8 +561,42 @@ func (rce RenderCommandEncoder) DrawPrimitives(typ PrimitiveType, vertexStart, v
 	rce.commandEncoder.Send(selDrawPrimitives, uint64(typ), uint64(vertexStart), uint64(vertexCount))
 }
 
+// DrawPrimitivesInstanced draws instanceCount instances of vertexCount
+// vertices; [[instance_id]] counts up from baseInstance.
+func (rce RenderCommandEncoder) DrawPrimitivesInstanced(typ PrimitiveType, vertexStart, vertexCount, instanceCount, baseInstance int) {
+	rce.commandEncoder.Send(selDrawInstanced, uint64(typ), uint64(vertexStart), uint64(vertexCount), uint64(instanceCount), uint64(baseInstance))
+}
+
+// DrawIndexedPrimitives draws indexCount vertices whose ids are read from
+// indexBuffer at indexBufferOffset; baseVertex is added to each index.
+func (rce RenderCommandEncoder) DrawIndexedPrimitives(typ PrimitiveType, indexCount int, indexType IndexType, indexBuffer Buffer, indexBufferOffset, instanceCount, baseVertex, baseInstance int) {
+	rce.commandEncoder.Send(selDrawIndexed, uint64(typ), uint64(indexCount), uint64(indexType), indexBuffer.buffer, uint64(indexBufferOffset), uint64(instanceCount), int64(baseVertex), uint64(baseInstance))
+}
+
+// DrawPrimitivesIndirect draws with the arguments (vertexCount,
+// instanceCount, vertexStart, baseInstance; uint32s) read from
+// indirectBuffer at offset.
+func (rce RenderCommandEncoder) DrawPrimitivesIndirect(typ PrimitiveType, indirectBuffer Buffer, offset int) {
+	rce.commandEncoder.Send(selDrawIndirect, uint64(typ), indirectBuffer.buffer, uint64(offset))
+}
+
+// DrawIndexedPrimitivesIndirect draws indexed vertices with the arguments
+// (indexCount, instanceCount, indexStart, baseVertex, baseInstance; 32-bit)
+// read from indirectBuffer at offset. indexStart counts indices from
+// indexBufferOffset.
+func (rce RenderCommandEncoder) DrawIndexedPrimitivesIndirect(typ PrimitiveType, indexType IndexType, indexBuffer Buffer, indexBufferOffset int, indirectBuffer Buffer, offset int) {
+	rce.commandEncoder.Send(selDrawIndexedIndirect, uint64(typ), uint64(indexType), indexBuffer.buffer, uint64(indexBufferOffset), indirectBuffer.buffer, uint64(offset))
+}
+
 // GetBytes reads texture pixels back into dst (e.g. for headless readback).
 func (t Texture) GetBytes(dst []byte, bytesPerRow int, region Region, level int) {
 	r := mtlRegion{origin: region.Origin.c(), size: region.Size.c()}
 	t.texture.Send(selGetBytes, unsafe.Pointer(&dst[0]), uint64(bytesPerRow), r, uint64(level))
 }
+
+// GetBytesSlice reads the pixels of a region of a slice (an array layer or
+// cube face) of a mip level into dst.
+func (t Texture) GetBytesSlice(dst []byte, bytesPerRow, bytesPerImage int, region Region, level, slice int) {
+	r := mtlRegion{origin: region.Origin.c(), size: region.Size.c()}
+	t.texture.Send(selGetBytesSlice, unsafe.Pointer(&dst[0]), uint64(bytesPerRow), uint64(bytesPerImage), r, uint64(level), uint64(slice))
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestGLOcclusionQuery draws a near red occluder, then tests a triangle
+// behind it and one in front of it with a pipeline that writes no color, each
+// inside an occlusion query. Only the front one may pass, and neither may
+// change the color target.
+func TestGLOcclusionQuery(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL occlusion test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: depthGLVert})
+	if err != nil {
+		t.Fatalf("vertex module: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: depthGLFrag})
+	if err != nil {
+		t.Fatalf("fragment module: %v", err)
+	}
+	desc := gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "main",
+		FragmentModule: fmod, FragmentEntry: "main",
+		ColorFormat: gpu.RGBA8Unorm,
+		DepthFormat: gpu.Depth32Float,
+	}
+	pipe, err := dev.NewRenderPipeline(desc)
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+	desc.DepthCompare, desc.DepthWriteEnabled = gpu.CompareLessEqual, false
+	desc.ColorWriteMask = gpu.ColorWriteNone
+	proxy, err := dev.NewRenderPipeline(desc)
+	if err != nil {
+		t.Fatalf("proxy pipeline: %v", err)
+	}
+
+	qs, err := dev.NewQuerySet(gpu.QuerySetDescriptor{Type: gpu.QueryOcclusion, Count: 3})
+	if err != nil {
+		t.Fatalf("NewQuerySet: %v", err)
+	}
+	defer qs.Release()
+
+	buf := func(d []float32) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(d), Usage: gpu.BufferStorage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	tri := func(z float32) *gpu.Buffer { return buf([]float32{-1, -1, z, 3, -1, z, -1, 3, z}) }
+	red := buf([]float32{1, 0, 0, 1, 0, 0, 1, 0, 0})
+	green := buf([]float32{0, 1, 0, 0, 1, 0, 0, 1, 0})
+
+	const W, H = 16, 16
+	color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("color texture: %v", err)
+	}
+	depth, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("depth texture: %v", err)
+	}
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1},
+		DepthTexture: depth, ClearDepth: 1,
+		OcclusionQuerySet: qs,
+	})
+	rp.SetPipeline(pipe)
+	rp.SetVertexBuffer(0, tri(0))
+	rp.SetVertexBuffer(1, red)
+	rp.Draw(gpu.TriangleList, 0, 3)
+	rp.SetPipeline(proxy)
+	rp.SetVertexBuffer(1, green)
+	for i, z := range []float32{0.5, -0.5} { // behind, in front
+		rp.BeginOcclusionQuery(i)
+		rp.SetVertexBuffer(0, tri(z))
+		rp.Draw(gpu.TriangleList, 0, 3)
+		rp.EndOcclusionQuery()
+	}
+	rp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	res, err := qs.Results(0, 3)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if res[0] != 0 || res[1] == 0 || res[2] != 0 {
+		t.Fatalf("occlusion results %v, want [0 >0 0] (behind, in front, unused)", res)
+	}
+	pix := color.ReadPixels()
+	c := ((H/2)*W + W/2) * 4
+	if pix[c] < 200 || pix[c+1] > 60 {
+		t.Fatalf("center=(%d,%d,%d), want the red occluder: a ColorWriteNone draw wrote color", pix[c], pix[c+1], pix[c+2])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("BeginOcclusionQuery without an OcclusionQuerySet did not panic")
+		}
+	}()
+	enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color}).BeginOcclusionQuery(0)
+}
@@ -21,7 +21,7 @@ func TestShadingParityMetal(t *testing.T) {
 		t.Skipf("no Metal device: %v", err)
 	}
 	defer dev.Close()
-	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, []shader.Binding, error) {
+	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, *shader.Kernel, error) {
 		ks, err := shader.Compile(goSrc)
 		if err != nil {
 			return nil, nil, err
@@ -30,6 +30,51 @@ func TestShadingParityMetal(t *testing.T) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return mod, ks[entry].Bindings, nil
+		return mod, ks[entry], nil
+	})
+}
+
+// renderParityMSL holds the Metal shaders of runRenderParity.
+const renderParityMSL = `
+#include <metal_stdlib>
+using namespace metal;
+struct VOut {
+	float4 pos [[position]];
+	float4 color;
+	float z;
+};
+struct FOut {
+	float4 color [[color(0)]];
+	float4 data [[color(1)]];
+};
+vertex VOut vmain(uint vid [[vertex_id]], device const float* v [[buffer(0)]]) {
+	uint i = vid * 8;
+	VOut o;
+	o.pos = float4(v[i], v[i+1], v[i+2], 1.0);
+	o.color = float4(v[i+4], v[i+5], v[i+6], v[i+7]);
+	o.z = v[i+2];
+	return o;
+}
+fragment FOut fmain(VOut in [[stage_in]]) {
+	FOut o;
+	o.color = in.color;
+	o.data = float4(in.color.rgb * 2.0, in.z);
+	return o;
+}
+`
+
+// TestRenderParityMetal runs the shared render parity on the Metal backend.
+func TestRenderParityMetal(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverMetal))
+	if err != nil {
+		t.Skipf("no Metal device: %v", err)
+	}
+	defer dev.Close()
+	runRenderParity(t, dev, func() (*gpu.ShaderModule, string, *gpu.ShaderModule, string, error) {
+		mod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: renderParityMSL})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		return mod, "vmain", mod, "fmain", nil
 	})
 }
@@ -8,7 +8,6 @@ package gpu_test
 
 import (
 	"os"
-	"strings"
 	"testing"
 
 	"poly.red/gpu"
@@ -26,7 +25,7 @@ func TestShadingParityGL(t *testing.T) {
 		t.Skipf("no GL device: %v", err)
 	}
 	defer dev.Close()
-	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, []shader.Binding, error) {
+	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, *shader.Kernel, error) {
 		ks, err := shader.CompileGLSL(goSrc)
 		if err != nil {
 			return nil, nil, err
@@ -35,13 +34,13 @@ func TestShadingParityGL(t *testing.T) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return mod, ks[entry].Bindings, nil
+		return mod, ks[entry], nil
 	})
 }
 
 // TestShadingParityVulkan runs the shared cross-backend shading parity on the
-// Vulkan backend (Go kernel -> GLSL -> SPIR-V via glslang). Runs in the vk-probe
-// CI job.
+// Vulkan backend (Go kernel -> SPIR-V via shader.CompileSPIRV, no external
+// tools). Runs in the vk-probe CI job.
 func TestShadingParityVulkan(t *testing.T) {
 	if os.Getenv("POLYRED_VK_PROBE") != "1" {
 		t.Skip("set POLYRED_VK_PROBE=1 to run the Vulkan shading parity")
@@ -51,20 +50,91 @@ func TestShadingParityVulkan(t *testing.T) {
 		t.Skipf("no Vulkan device: %v", err)
 	}
 	defer dev.Close()
-	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, []shader.Binding, error) {
-		ks, err := shader.CompileGLSL(goSrc)
+	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, *shader.Kernel, error) {
+		ks, err := shader.CompileSPIRV(goSrc)
 		if err != nil {
 			return nil, nil, err
 		}
-		// CompileGLSL targets GLES (#version 310 es) for the GL backend; glslang
-		// compiles desktop/Vulkan GLSL (#version 450) for SPIR-V. The body is
-		// identical, so retarget the version header for the Vulkan path.
-		glsl := strings.Replace(ks[entry].GLSL, "#version 310 es", "#version 450", 1)
-		spv := glslToSPIRV(t, glsl)
-		mod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: spv})
+		mod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: ks[entry].SPIRV})
 		if err != nil {
 			return nil, nil, err
 		}
-		return mod, ks[entry].Bindings, nil
+		return mod, ks[entry], nil
+	})
+}
+
+// renderParityGLVert and renderParityGLFrag are the GL (GLSL ES) shaders of
+// runRenderParity.
+const renderParityGLVert = `#version 310 es
+layout(std430, binding = 0) readonly buffer _v { float v[]; };
+out vec4 vcolor;
+out float vz;
+void main() {
+	int i = gl_VertexID * 8;
+	gl_Position = vec4(v[i], v[i+1], v[i+2], 1.0);
+	vcolor = vec4(v[i+4], v[i+5], v[i+6], v[i+7]);
+	vz = v[i+2];
+}`
+
+const renderParityGLFrag = `#version 310 es
+precision highp float;
+in vec4 vcolor;
+in float vz;
+layout(location = 0) out vec4 color;
+layout(location = 1) out vec4 data;
+void main() {
+	color = vcolor;
+	data = vec4(vcolor.rgb * 2.0, vz);
+}`
+
+// TestRenderParityGL runs the shared render parity on the GL backend.
+func TestRenderParityGL(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL render parity")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+	runRenderParity(t, dev, func() (*gpu.ShaderModule, string, *gpu.ShaderModule, string, error) {
+		vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: renderParityGLVert})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: renderParityGLFrag})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		return vmod, "main", fmod, "main", nil
+	})
+}
+
+// TestRenderParityVulkan runs the shared render parity on the Vulkan backend
+// (Go kernels -> SPIR-V via shader.CompileSPIRV, no external tools). Runs in
+// the vk-probe CI job.
+func TestRenderParityVulkan(t *testing.T) {
+	if os.Getenv("POLYRED_VK_PROBE") != "1" {
+		t.Skip("set POLYRED_VK_PROBE=1 to run the Vulkan render parity")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverVulkan))
+	if err != nil {
+		t.Skipf("no Vulkan device: %v", err)
+	}
+	defer dev.Close()
+	runRenderParity(t, dev, func() (*gpu.ShaderModule, string, *gpu.ShaderModule, string, error) {
+		ks, err := shader.CompileSPIRV(renderParityKernels)
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		vmod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: ks["RenderVert"].SPIRV})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		fmod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: ks["RenderFrag"].SPIRV})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		return vmod, "RenderVert", fmod, "RenderFrag", nil
 	})
 }
@@ -9,7 +9,8 @@
 // points (parity_darwin_test.go: Metal; parity_linux_test.go: GL + Vulkan) call
 // runShadingParity with a backend-specific module builder. Because every backend
 // is checked against the same oracle, passing on each CI job proves the backends
-// agree with each other (and the CPU) within tolerance.
+// agree with each other (and the CPU) within tolerance. runRenderParity does
+// the same for the render pipeline, with a scene whose pixels are known exactly.
 package gpu_test
 
 import (
@@ -19,6 +20,7 @@ import (
 
 	"poly.red/gpu"
 	"poly.red/gpu/shader"
+	"poly.red/gpu/shader/gpumath"
 	"poly.red/gpu/shader/gpumath/kernels"
 )
 
@@ -194,41 +196,51 @@ func cpuShade(s parityScene) []float32 {
 	return out
 }
 
-// mkFunc builds a backend-specific shader module + bindings from a Go kernel.
-type mkFunc func(goSrc, entry string) (*gpu.ShaderModule, []shader.Binding, error)
+// mkFunc builds a backend-specific shader module from a Go kernel, returning
+// the compiled kernel for its bindings and workgroup size.
+type mkFunc func(goSrc, entry string) (*gpu.ShaderModule, *shader.Kernel, error)
 
 // runCompute compiles goSrc for dev, runs `entry` over count threads with the
-// named storage-buffer inputs, and returns the contents of outName.
+// named buffer inputs, and returns the contents of outName. Inputs bound to a
+// uniform struct parameter go into a uniform buffer.
 func runCompute(t *testing.T, dev *gpu.Device, mk mkFunc, goSrc, entry string, inputs map[string][]float32, outName string, count int) []float32 {
 	t.Helper()
-	mod, binds, err := mk(goSrc, entry)
+	mod, k, err := mk(goSrc, entry)
 	if err != nil {
 		t.Fatalf("compile %s for %v: %v", entry, dev.Driver(), err)
 	}
 	var le []gpu.BindGroupLayoutEntry
 	var bge []gpu.BindGroupEntry
 	bufByName := map[string]*gpu.Buffer{}
-	for _, b := range binds {
+	for _, b := range k.Bindings {
 		data, ok := inputs[b.Name]
 		if !ok {
 			t.Fatalf("kernel binding %q has no input", b.Name)
 		}
-		buf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: parityBytes(data), Usage: gpu.BufferStorage})
+		kind, usage := gpu.StorageBuffer, gpu.BufferStorage
+		if b.Kind == shader.UniformBuffer {
+			kind, usage = gpu.UniformBuffer, gpu.BufferUniform
+		}
+		buf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: parityBytes(data), Usage: usage})
 		if err != nil {
 			t.Fatalf("buffer %q: %v", b.Name, err)
 		}
 		bufByName[b.Name] = buf
-		le = append(le, gpu.BindGroupLayoutEntry{Binding: b.Index, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer})
+		le = append(le, gpu.BindGroupLayoutEntry{Binding: b.Index, Visibility: gpu.StageCompute, Kind: kind})
 		bge = append(bge, gpu.BindGroupEntry{Binding: b.Index, Buffer: buf})
 	}
 	layout := dev.NewBindGroupLayout(le...)
 	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{
 		Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: entry,
+		Workgroup: k.Workgroup,
 	})
 	if err != nil {
 		t.Fatalf("pipeline %s: %v", entry, err)
 	}
-	bg := dev.NewBindGroup(layout, bge...)
+	bg, err := dev.NewBindGroup(layout, bge...)
+	if err != nil {
+		t.Fatal(err)
+	}
 	enc := dev.NewCommandEncoder()
 	pass := enc.BeginComputePass()
 	pass.SetPipeline(pipe)
@@ -260,6 +272,9 @@ func runParity(t *testing.T, dev *gpu.Device, mk mkFunc) {
 	runShadingParity(t, dev, mk)
 	runTrigParity(t, dev, mk)
 	runAuthorOnceParity(t, dev, mk)
+	runWorkgroupParity(t, dev, mk)
+	runTypedBufferParity(t, dev, mk)
+	runControlFlowParity(t, dev, mk)
 }
 
 // runAuthorOnceParity proves the unified-renderer thesis: the *same* kernel
@@ -330,3 +345,297 @@ func runTrigParity(t *testing.T, dev *gpu.Device, mk mkFunc) {
 	// trig implementations differ slightly across software rasterizers.
 	compareParity(t, dev, "trig", got, want, 1e-3)
 }
+
+// runWorkgroupParity runs the author-once Histogram workgroup kernel (shared
+// memory, barriers and atomics) over a pixel count that leaves the last
+// workgroup partly idle, on the GPU and through gpumath.Dispatch on the CPU.
+// The counts are exact, so the two must agree bit for bit.
+func runWorkgroupParity(t *testing.T, dev *gpu.Device, mk mkFunc) {
+	t.Helper()
+	const n = 1000
+	px := make([]float32, n*4)
+	for i := 0; i < n; i++ {
+		px[i*4], px[i*4+1], px[i*4+2], px[i*4+3] = float32(i%7)/6, float32(i%13)/12, float32(i%29)/28, 1
+	}
+	want := make([]uint32, 16)
+	p := kernels.HistogramParams{Count: n}
+	gpumath.Dispatch(n, 64, func(gid, lid, wid uint) {
+		kernels.Histogram(gid, lid, px, p, want)
+	})
+
+	// The uniform and the counts travel as the bits of float32 buffers.
+	params := []float32{math.Float32frombits(n), 0, 0, 0}
+	out := runCompute(t, dev, mk, kernels.HistogramSrc, "Histogram",
+		map[string][]float32{"px": px, "p": params, "hist": make([]float32, 16)}, "hist", n)
+	for i := range want {
+		if got := math.Float32bits(out[i]); got != want[i] {
+			t.Fatalf("%v histogram bin %d = %d, want %d", dev.Driver(), i, got, want[i])
+		}
+	}
+	t.Logf("%v workgroup histogram matches gpumath.Dispatch: %v", dev.Driver(), want)
+}
+
+// typedKernelSrc reads and writes struct storage buffers, whose layout the
+// host side builds with shader.Layout from the same struct definitions.
+const typedKernelSrc = `
+package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type Light struct {
+	Pos   Vec4
+	Color Vec4
+	Range float32
+	Kind  uint32
+}
+
+type Frag struct {
+	Color Vec4
+	Depth float32
+	ID    int32
+}
+
+func Gather(gid uint, lights []Light, scale []Vec4, out []Frag) {
+	l := lights[gid]
+	f := Frag{l.Color * scale[gid], l.Pos.Z + l.Range, int32(l.Kind) - 2}
+	if l.Kind > 1 {
+		f.Color.W = 1.0
+	}
+	out[gid] = f
+}
+`
+
+// runTypedBufferParity runs typedKernelSrc on buffers packed by shader.Layout
+// and compares the GPU's Frag bytes with shader.Layout of the CPU result. The
+// values are small dyadic numbers, so every backend must match exactly.
+func runTypedBufferParity(t *testing.T, dev *gpu.Device, mk mkFunc) {
+	t.Helper()
+	type light struct {
+		Pos, Color gpumath.Vec4
+		Range      float32
+		Kind       uint32
+	}
+	type frag struct {
+		Color gpumath.Vec4
+		Depth float32
+		ID    int32
+	}
+	const n = 64
+	lights := make([]light, n)
+	scale := make([]gpumath.Vec4, n)
+	want := make([]frag, n)
+	for i := range lights {
+		l := light{
+			Pos:   gpumath.Vec4{X: 1, Y: 2, Z: float32(i) / 4, W: 1},
+			Color: gpumath.Vec4{X: 0.5, Y: float32(i % 5), Z: 2, W: 0.25},
+			Range: float32(i) * 2, Kind: uint32(i % 4),
+		}
+		lights[i], scale[i] = l, gpumath.Vec4{X: 2, Y: 0.5, Z: float32(i), W: 4}
+		want[i] = frag{Color: l.Color.Mul(scale[i]), Depth: l.Pos.Z + l.Range, ID: int32(l.Kind) - 2}
+		if l.Kind > 1 {
+			want[i].Color.W = 1
+		}
+	}
+	floats := func(b []byte, err error) []float32 {
+		if err != nil {
+			t.Fatalf("shader.Layout: %v", err)
+		}
+		return parityFloats(b, len(b)/4)
+	}
+	wantBytes, err := shader.Layout(want)
+	if err != nil {
+		t.Fatalf("shader.Layout: %v", err)
+	}
+	got := runCompute(t, dev, mk, typedKernelSrc, "Gather", map[string][]float32{
+		"lights": floats(shader.Layout(lights)),
+		"scale":  floats(shader.Layout(scale)),
+		"out":    make([]float32, len(wantBytes)/4),
+	}, "out", n)
+	if gotBytes := parityBytes(got); string(gotBytes) != string(wantBytes) {
+		for i := range wantBytes {
+			if gotBytes[i] != wantBytes[i] {
+				t.Fatalf("%v typed buffers: byte %d (Frag %d) = %d, want %d", dev.Driver(), i, i/32, gotBytes[i], wantBytes[i])
+			}
+		}
+	}
+	t.Logf("%v typed buffers: %d Frag elements match shader.Layout of the CPU result", dev.Driver(), n)
+}
+
+// runControlFlowParity runs the author-once Visibility kernel, whose switch,
+// labeled break/continue, early return and multi-value helpers the compiler
+// lowers, over a 32x8 scene on the GPU and as Go on the CPU.
+func runControlFlowParity(t *testing.T, dev *gpu.Device, mk mkFunc) {
+	t.Helper()
+	const w, h = 32, 8
+	lights := []float32{
+		0, 4, 3, 8, 20, // point lights: kind, x, y, intensity, range
+		0, 25, 6, 5, 12,
+		1, 0.6, -0.8, 0.5, 0, // directional
+		3, 0, 0, 100, 100, // off
+		0, 16, 1, 2, 3,
+	}
+	occluders := []float32{10.3, 4.1, 1.2, 19.7, 2.2, 0.8, 27.1, 6.6, 0.5}
+	p := kernels.VisibilityParams{Width: w, Lights: 5, Occluders: 3, MaxLights: 3}
+	want := make([]float32, w*h*2)
+	for gid := uint(0); gid < w*h; gid++ {
+		kernels.Visibility(gid, lights, occluders, p, want)
+	}
+
+	// The uniform travels as the bits of a float32 buffer.
+	params := []float32{
+		math.Float32frombits(p.Width), math.Float32frombits(p.Lights),
+		math.Float32frombits(p.Occluders), math.Float32frombits(p.MaxLights),
+	}
+	got := runCompute(t, dev, mk, kernels.VisibilitySrc, "Visibility", map[string][]float32{
+		"lights": lights, "occluders": occluders, "p": params, "out": make([]float32, w*h*2),
+	}, "out", w*h)
+	compareParity(t, dev, "control flow GPU vs CPU-as-Go", got, want, 1e-3)
+}
+
+// renderParityKernels is runRenderParity's vertex and fragment stages as Go
+// kernels, for the backends that take their shaders from the shader package.
+const renderParityKernels = `
+package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type Varyings struct {
+	Pos   Vec4 ` + "`gpu:\"position\"`" + `
+	Color Vec4
+	Z     float32
+}
+
+type Targets struct {
+	Color Vec4
+	Data  Vec4
+}
+
+//gpu:vertex
+func RenderVert(vid uint, v []float32) Varyings {
+	i := vid * 8
+	return Varyings{
+		Pos:   Vec4{v[i], v[i+1], v[i+2], 1},
+		Color: Vec4{v[i+4], v[i+5], v[i+6], v[i+7]},
+		Z:     v[i+2],
+	}
+}
+
+//gpu:fragment
+func RenderFrag(in Varyings) Targets {
+	c := in.Color
+	return Targets{Color: c, Data: Vec4{c.X * 2, c.Y * 2, c.Z * 2, in.Z}}
+}
+`
+
+// renderMkFunc builds a backend's vertex and fragment modules for
+// runRenderParity, and the entry points to use in them.
+type renderMkFunc func() (vmod *gpu.ShaderModule, ventry string, fmod *gpu.ShaderModule, fentry string, err error)
+
+// runRenderParity draws four indexed quads into an RGBA8 color target, an
+// RGBA32Float data target and a depth buffer, and checks one pixel per
+// quadrant. The vertex shader reads 8 floats per vertex (x, y, z, pad, r, g,
+// b, a) from the storage buffer at binding 0 and passes the color and z on;
+// the fragment shader writes the color to target 0 and (rgb*2, z) to
+// target 1. The quads, each drawn with baseVertex selecting its 4 vertices:
+//
+//	A: full screen, red, z 0.5
+//	B: top-left quadrant, green, z 0.25 (in front of A)
+//	C: right half, blue, z 0.75 (behind A, fails the depth test)
+//	D: full screen, white, z 0.1, clockwise (culled as a back face)
+//
+// so the top-left quadrant is green and the rest red on every backend.
+func runRenderParity(t *testing.T, dev *gpu.Device, mk renderMkFunc) {
+	t.Helper()
+	vmod, ventry, fmod, fentry, err := mk()
+	if err != nil {
+		t.Fatalf("render shaders for %v: %v", dev.Driver(), err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: ventry,
+		FragmentModule: fmod, FragmentEntry: fentry,
+		ColorFormat:       gpu.RGBA8Unorm,
+		ExtraColorFormats: []gpu.TextureFormat{gpu.RGBA32Float},
+		DepthFormat:       gpu.Depth32Float,
+		CullMode:          gpu.CullBack,
+		FrontFace:         gpu.FrontCCW,
+	})
+	if err != nil {
+		t.Fatalf("render pipeline: %v", err)
+	}
+
+	quad := func(x0, y0, x1, y1, z float32, c [4]float32, cw bool) []float32 {
+		corners := [4][2]float32{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+		if cw {
+			corners = [4][2]float32{{x0, y0}, {x0, y1}, {x1, y1}, {x1, y0}}
+		}
+		var v []float32
+		for _, p := range corners {
+			v = append(v, p[0], p[1], z, 0, c[0], c[1], c[2], c[3])
+		}
+		return v
+	}
+	var verts []float32
+	verts = append(verts, quad(-1, -1, 1, 1, 0.5, [4]float32{1, 0, 0, 1}, false)...)
+	verts = append(verts, quad(-1, 0, 0, 1, 0.25, [4]float32{0, 1, 0, 1}, false)...)
+	verts = append(verts, quad(0, -1, 1, 1, 0.75, [4]float32{0, 0, 1, 1}, false)...)
+	verts = append(verts, quad(-1, -1, 1, 1, 0.1, [4]float32{1, 1, 1, 1}, true)...)
+	vbuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: parityBytes(verts), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("vertex buffer: %v", err)
+	}
+	indices := []uint16{0, 1, 2, 0, 2, 3}
+	ibuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: unsafe.Slice((*byte)(unsafe.Pointer(&indices[0])), len(indices)*2), Usage: gpu.BufferIndex})
+	if err != nil {
+		t.Fatalf("index buffer: %v", err)
+	}
+
+	const W, H = 32, 32
+	tex := func(f gpu.TextureFormat) *gpu.Texture {
+		x, err := dev.NewTexture(gpu.TextureDescriptor{Format: f, Width: W, Height: H, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("texture: %v", err)
+		}
+		return x
+	}
+	color, data, depth := tex(gpu.RGBA8Unorm), tex(gpu.RGBA32Float), tex(gpu.Depth32Float)
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1},
+		ExtraColorTargets: []gpu.ColorTarget{{Texture: data}},
+		DepthTexture:      depth, ClearDepth: 1,
+	})
+	rp.SetPipeline(pipe)
+	rp.SetVertexBuffer(0, vbuf)
+	rp.SetIndexBuffer(ibuf, gpu.IndexUint16)
+	for q := 0; q < 4; q++ {
+		rp.DrawIndexed(gpu.TriangleList, 0, len(indices), q*4)
+	}
+	rp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	pix, fpix := color.ReadPixels(), parityFloats(data.ReadPixels(), W*H*4)
+	for _, c := range []struct {
+		name string
+		x, y int
+		rgb  [3]uint8
+		data [4]float32
+	}{
+		{"top-left", W / 4, H / 4, [3]uint8{0, 255, 0}, [4]float32{0, 2, 0, 0.25}},
+		{"top-right", 3 * W / 4, H / 4, [3]uint8{255, 0, 0}, [4]float32{2, 0, 0, 0.5}},
+		{"bottom-left", W / 4, 3 * H / 4, [3]uint8{255, 0, 0}, [4]float32{2, 0, 0, 0.5}},
+		{"bottom-right", 3 * W / 4, 3 * H / 4, [3]uint8{255, 0, 0}, [4]float32{2, 0, 0, 0.5}},
+	} {
+		i := (c.y*W + c.x) * 4
+		if got := [3]uint8{pix[i], pix[i+1], pix[i+2]}; got != c.rgb {
+			t.Errorf("%v render parity: %s color = %v, want %v", dev.Driver(), c.name, got, c.rgb)
+		}
+		for k, want := range c.data {
+			if d := math.Abs(float64(fpix[i+k] - want)); d > 1e-5 {
+				t.Errorf("%v render parity: %s data[%d] = %v, want %v", dev.Driver(), c.name, k, fpix[i+k], want)
+			}
+		}
+	}
+	t.Logf("%v render parity: indexed draws, depth test, culling and both targets match", dev.Driver())
+}
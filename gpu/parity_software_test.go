@@ -0,0 +1,59 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu_test
+
+import (
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestShadingParitySoftware runs the shared cross-backend shading parity on
+// the software driver (Go kernel -> shader.Program), which needs no system
+// library and so runs everywhere.
+func TestShadingParitySoftware(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	defer dev.Close()
+	runParity(t, dev, func(goSrc, entry string) (*gpu.ShaderModule, *shader.Kernel, error) {
+		ks, err := shader.CompileCPU(goSrc)
+		if err != nil {
+			return nil, nil, err
+		}
+		mod, err := dev.NewShaderModule(gpu.ShaderSource{CPU: ks[entry].CPU})
+		if err != nil {
+			return nil, nil, err
+		}
+		return mod, ks[entry], nil
+	})
+}
+
+// TestRenderParitySoftware runs the shared render parity on the software
+// driver (Go kernels -> shader.Program).
+func TestRenderParitySoftware(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	defer dev.Close()
+	runRenderParity(t, dev, func() (*gpu.ShaderModule, string, *gpu.ShaderModule, string, error) {
+		ks, err := shader.CompileCPU(renderParityKernels)
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		vmod, err := dev.NewShaderModule(gpu.ShaderSource{CPU: ks["RenderVert"].CPU})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		fmod, err := dev.NewShaderModule(gpu.ShaderSource{CPU: ks["RenderFrag"].CPU})
+		if err != nil {
+			return nil, "", nil, "", err
+		}
+		return vmod, "RenderVert", fmod, "RenderFrag", nil
+	})
+}
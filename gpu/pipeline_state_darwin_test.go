@@ -0,0 +1,164 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+// Fixed-function pipeline state conformance for the Metal render pipeline, the
+// counterpart of pipeline_state_gl_linux_test.go. The winding of a front face
+// is set explicitly, so the same counter-clockwise triangles are culled as on GL.
+package gpu_test
+
+import (
+	"testing"
+
+	"poly.red/gpu"
+)
+
+const pipelineStateMSL = `
+#include <metal_stdlib>
+using namespace metal;
+struct VOut { float4 pos [[position]]; float4 color; };
+vertex VOut vmain(uint vid [[vertex_id]],
+                  device const float* pos [[buffer(0)]],
+                  device const float* col [[buffer(1)]]) {
+	VOut o;
+	o.pos = float4(pos[vid*3], pos[vid*3+1], pos[vid*3+2], 1.0);
+	o.color = float4(col[vid*3], col[vid*3+1], col[vid*3+2], 1.0);
+	return o;
+}
+fragment float4 fmain(VOut in [[stage_in]]) { return in.color; }
+fragment float4 fhalf(VOut in [[stage_in]]) { return float4(in.color.rgb, 0.5); }
+`
+
+func TestRenderPipelineState(t *testing.T) {
+	dev, err := gpu.Open()
+	if err != nil {
+		t.Skipf("no GPU device: %v", err)
+	}
+	defer dev.Close()
+
+	mod, err := dev.NewShaderModule(gpu.ShaderSource{MSL: pipelineStateMSL})
+	if err != nil {
+		t.Fatalf("compile shader: %v", err)
+	}
+	// half selects the alpha-0.5 fragment function.
+	pipeline := func(desc gpu.RenderPipelineDescriptor, half bool) *gpu.RenderPipeline {
+		desc.VertexModule, desc.VertexEntry = mod, "vmain"
+		desc.FragmentModule, desc.FragmentEntry = mod, "fmain"
+		if half {
+			desc.FragmentEntry = "fhalf"
+		}
+		desc.ColorFormat = gpu.RGBA8Unorm
+		p, err := dev.NewRenderPipeline(desc)
+		if err != nil {
+			t.Fatalf("render pipeline: %v", err)
+		}
+		return p
+	}
+	buf := func(d []float32) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: bytesFromFloats(d), Usage: gpu.BufferStorage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	// Counter-clockwise full-screen triangles at three depths (Metal NDC depth
+	// is [0,1]).
+	near := buf([]float32{-1, -1, 0.25, 3, -1, 0.25, -1, 3, 0.25})
+	mid := buf([]float32{-1, -1, 0.5, 3, -1, 0.5, -1, 3, 0.5})
+	far := buf([]float32{-1, -1, 0.75, 3, -1, 0.75, -1, 3, 0.75})
+	red := buf([]float32{1, 0, 0, 1, 0, 0, 1, 0, 0})
+	green := buf([]float32{0, 1, 0, 0, 1, 0, 0, 1, 0})
+	white := buf([]float32{1, 1, 1, 1, 1, 1, 1, 1, 1})
+
+	type draw struct {
+		pipe     *gpu.RenderPipeline
+		pos, col *gpu.Buffer
+	}
+	const W, H = 16, 16
+	// render clears to blue (and depth to 1 when withDepth), runs the draws and
+	// returns the center pixel.
+	render := func(withDepth bool, draws ...draw) [3]uint8 {
+		color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("color texture: %v", err)
+		}
+		desc := gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1}}
+		if withDepth {
+			depth, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: W, Height: H, RenderTarget: true})
+			if err != nil {
+				t.Fatalf("depth texture: %v", err)
+			}
+			desc.DepthTexture, desc.ClearDepth = depth, 1
+		}
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(desc)
+		for _, d := range draws {
+			rp.SetPipeline(d.pipe)
+			rp.SetVertexBuffer(0, d.pos)
+			rp.SetVertexBuffer(1, d.col)
+			rp.Draw(gpu.TriangleList, 0, 3)
+		}
+		rp.End()
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+		pix := color.ReadPixels()
+		c := ((H/2)*W + W/2) * 4
+		return [3]uint8{pix[c], pix[c+1], pix[c+2]}
+	}
+	near8 := func(got [3]uint8, want [3]uint8) bool {
+		for i := range got {
+			if d := int(got[i]) - int(want[i]); d < -2 || d > 2 {
+				return false
+			}
+		}
+		return true
+	}
+
+	t.Run("blend", func(t *testing.T) {
+		blend := pipeline(gpu.RenderPipelineDescriptor{Blend: &gpu.BlendAlpha}, true)
+		opaque := pipeline(gpu.RenderPipelineDescriptor{}, true)
+		if got := render(false, draw{blend, mid, red}); !near8(got, [3]uint8{128, 0, 128}) {
+			t.Fatalf("half red over blue = %v, want ~(128,0,128)", got)
+		}
+		// Blending is pipeline state: an unblended pipeline in the same pass
+		// overwrites.
+		if got := render(false, draw{blend, mid, red}, draw{opaque, mid, green}); !near8(got, [3]uint8{0, 255, 0}) {
+			t.Fatalf("unblended green after blended red = %v, want green", got)
+		}
+	})
+
+	t.Run("cull", func(t *testing.T) {
+		for _, tc := range []struct {
+			name  string
+			cull  gpu.CullMode
+			front gpu.FrontFace
+			drawn bool
+		}{
+			{"none", gpu.CullNone, gpu.FrontCCW, true},
+			{"back/ccw", gpu.CullBack, gpu.FrontCCW, true},
+			{"front/ccw", gpu.CullFront, gpu.FrontCCW, false},
+			{"back/cw", gpu.CullBack, gpu.FrontCW, false},
+		} {
+			p := pipeline(gpu.RenderPipelineDescriptor{CullMode: tc.cull, FrontFace: tc.front}, false)
+			got := render(false, draw{p, mid, red})
+			if drawn := got == [3]uint8{255, 0, 0}; drawn != tc.drawn {
+				t.Fatalf("%s: center = %v, drawn %v, want drawn %v", tc.name, got, drawn, tc.drawn)
+			}
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		less := pipeline(gpu.RenderPipelineDescriptor{DepthFormat: gpu.Depth32Float}, false)
+		greaterNoWrite := pipeline(gpu.RenderPipelineDescriptor{
+			DepthFormat: gpu.Depth32Float, DepthCompare: gpu.CompareGreater, DepthWriteEnabled: false,
+		}, false)
+		// far passes "greater" against near's depth but must not store its own,
+		// so mid still fails "less" against near and far's green stays.
+		got := render(true, draw{less, near, red}, draw{greaterNoWrite, far, green}, draw{less, mid, white})
+		if got != [3]uint8{0, 255, 0} {
+			t.Fatalf("center = %v, want green (far drawn by greater, not written)", got)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Fixed-function pipeline state conformance for the GL backend: alpha blending
+// over the clear color, back/front face culling of a counter-clockwise
+// triangle, and a configured depth test with depth writes off. Each case draws
+// full-screen triangles (the big-triangle trick of depth_gl_linux_test.go) and
+// checks the center pixel. Runs in CI on Mesa llvmpipe (software, surfaceless).
+package gpu_test
+
+import (
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// halfAlphaGLFrag outputs the vertex color at alpha 0.5.
+const halfAlphaGLFrag = `#version 310 es
+precision highp float;
+in vec3 vcolor;
+out vec4 fragColor;
+void main() { fragColor = vec4(vcolor, 0.5); }`
+
+func TestGLRenderPipelineState(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL pipeline state test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	mod := func(src string) *gpu.ShaderModule {
+		m, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: src})
+		if err != nil {
+			t.Fatalf("shader module: %v", err)
+		}
+		return m
+	}
+	vmod, fmod, halfMod := mod(depthGLVert), mod(depthGLFrag), mod(halfAlphaGLFrag)
+	pipeline := func(desc gpu.RenderPipelineDescriptor) *gpu.RenderPipeline {
+		desc.VertexModule, desc.VertexEntry = vmod, "main"
+		if desc.FragmentModule == nil {
+			desc.FragmentModule = fmod
+		}
+		desc.FragmentEntry = "main"
+		desc.ColorFormat = gpu.RGBA8Unorm
+		p, err := dev.NewRenderPipeline(desc)
+		if err != nil {
+			t.Fatalf("render pipeline: %v", err)
+		}
+		return p
+	}
+	buf := func(d []float32) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(d), Usage: gpu.BufferStorage})
+		if err != nil {
+			t.Fatalf("buffer: %v", err)
+		}
+		return b
+	}
+	// Counter-clockwise full-screen triangles at three depths.
+	near := buf([]float32{-1, -1, -0.5, 3, -1, -0.5, -1, 3, -0.5})
+	mid := buf([]float32{-1, -1, 0, 3, -1, 0, -1, 3, 0})
+	far := buf([]float32{-1, -1, 0.5, 3, -1, 0.5, -1, 3, 0.5})
+	red := buf([]float32{1, 0, 0, 1, 0, 0, 1, 0, 0})
+	green := buf([]float32{0, 1, 0, 0, 1, 0, 0, 1, 0})
+	white := buf([]float32{1, 1, 1, 1, 1, 1, 1, 1, 1})
+
+	type draw struct {
+		pipe     *gpu.RenderPipeline
+		pos, col *gpu.Buffer
+	}
+	const W, H = 16, 16
+	// render clears to blue (and depth to 1 when withDepth), runs the draws and
+	// returns the center pixel.
+	render := func(withDepth bool, draws ...draw) [3]uint8 {
+		color, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+		if err != nil {
+			t.Fatalf("color texture: %v", err)
+		}
+		desc := gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1}}
+		if withDepth {
+			depth, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: W, Height: H, RenderTarget: true})
+			if err != nil {
+				t.Fatalf("depth texture: %v", err)
+			}
+			desc.DepthTexture, desc.ClearDepth = depth, 1
+		}
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(desc)
+		for _, d := range draws {
+			rp.SetPipeline(d.pipe)
+			rp.SetVertexBuffer(0, d.pos)
+			rp.SetVertexBuffer(1, d.col)
+			rp.Draw(gpu.TriangleList, 0, 3)
+		}
+		rp.End()
+		dev.Queue().Submit(enc.Finish())
+		dev.Queue().WaitIdle()
+		pix := color.ReadPixels()
+		c := ((H/2)*W + W/2) * 4
+		return [3]uint8{pix[c], pix[c+1], pix[c+2]}
+	}
+	near8 := func(got [3]uint8, want [3]uint8) bool {
+		for i := range got {
+			if d := int(got[i]) - int(want[i]); d < -2 || d > 2 {
+				return false
+			}
+		}
+		return true
+	}
+
+	t.Run("blend", func(t *testing.T) {
+		blend := pipeline(gpu.RenderPipelineDescriptor{FragmentModule: halfMod, Blend: &gpu.BlendAlpha})
+		opaque := pipeline(gpu.RenderPipelineDescriptor{FragmentModule: halfMod})
+		if got := render(false, draw{blend, mid, red}); !near8(got, [3]uint8{128, 0, 128}) {
+			t.Fatalf("half red over blue = %v, want ~(128,0,128)", got)
+		}
+		// Blending is pipeline state: an unblended pipeline in the same pass
+		// overwrites.
+		if got := render(false, draw{blend, mid, red}, draw{opaque, mid, green}); !near8(got, [3]uint8{0, 255, 0}) {
+			t.Fatalf("unblended green after blended red = %v, want green", got)
+		}
+	})
+
+	t.Run("cull", func(t *testing.T) {
+		for _, tc := range []struct {
+			name  string
+			cull  gpu.CullMode
+			front gpu.FrontFace
+			drawn bool
+		}{
+			{"none", gpu.CullNone, gpu.FrontCCW, true},
+			{"back/ccw", gpu.CullBack, gpu.FrontCCW, true},
+			{"front/ccw", gpu.CullFront, gpu.FrontCCW, false},
+			{"back/cw", gpu.CullBack, gpu.FrontCW, false},
+		} {
+			p := pipeline(gpu.RenderPipelineDescriptor{CullMode: tc.cull, FrontFace: tc.front})
+			got := render(false, draw{p, mid, red})
+			if drawn := got == [3]uint8{255, 0, 0}; drawn != tc.drawn {
+				t.Fatalf("%s: center = %v, drawn %v, want drawn %v", tc.name, got, drawn, tc.drawn)
+			}
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		less := pipeline(gpu.RenderPipelineDescriptor{DepthFormat: gpu.Depth32Float})
+		greaterNoWrite := pipeline(gpu.RenderPipelineDescriptor{
+			DepthFormat: gpu.Depth32Float, DepthCompare: gpu.CompareGreater, DepthWriteEnabled: false,
+		})
+		// far passes "greater" against near's depth but must not store its own,
+		// so mid still fails "less" against near and far's green stays.
+		got := render(true, draw{less, near, red}, draw{greaterNoWrite, far, green}, draw{less, mid, white})
+		if got != [3]uint8{0, 255, 0} {
+			t.Fatalf("center = %v, want green (far drawn by greater, not written)", got)
+		}
+	})
+}
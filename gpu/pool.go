@@ -0,0 +1,140 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import "errors"
+
+// defaultPoolBlockSize is the block size of a BufferPool whose descriptor
+// leaves it zero.
+const defaultPoolBlockSize = 1 << 20
+
+// BufferPoolDescriptor describes a buffer pool to create.
+type BufferPoolDescriptor struct {
+	Label string
+	// Usage is the usage of every block, e.g. BufferStorage or
+	// BufferUniform.
+	Usage BufferUsage
+	// BlockSize is the size of the pool's blocks in bytes; 0 means 1 MiB.
+	// A larger allocation gets a block of its own size.
+	BlockSize int
+}
+
+// BufferSlice is a range of a buffer, as a BufferPool hands it out.
+type BufferSlice struct {
+	Buffer *Buffer
+	Offset int
+	Size   int
+}
+
+// Slice returns the size bytes of b at offset; a zero size is the rest of
+// the buffer.
+func (b *Buffer) Slice(offset, size int) BufferSlice {
+	if size == 0 {
+		size = b.size - offset
+	}
+	return BufferSlice{Buffer: b, Offset: offset, Size: size}
+}
+
+// Entry returns the bind group entry binding s at binding.
+func (s BufferSlice) Entry(binding int) BindGroupEntry {
+	return BindGroupEntry{Binding: binding, Buffer: s.Buffer, Offset: s.Offset, Size: s.Size}
+}
+
+// BufferPool sub-allocates short-lived buffer data, such as the inputs of
+// one frame's kernels, from large persistent buffers. Allocations are
+// aligned for binding at their offset (see Limits) and live until Reset,
+// which hands the same blocks out again: a frame loop allocates, submits,
+// waits for the queue and resets, and creates no buffer once its blocks
+// have grown to the frame's needs.
+//
+// A BufferPool is not safe for concurrent use.
+type BufferPool struct {
+	d         *Device
+	label     string
+	usage     BufferUsage
+	blockSize int
+	align     int
+
+	blocks []*Buffer
+	cur    int // block allocations come from
+	off    int // first free byte of blocks[cur]
+}
+
+// NewBufferPool creates an empty buffer pool.
+func (d *Device) NewBufferPool(desc BufferPoolDescriptor) (*BufferPool, error) {
+	if desc.Usage&(BufferStorage|BufferUniform) == 0 {
+		return nil, errors.New("gpu: buffer pool usage must include BufferStorage or BufferUniform")
+	}
+	if desc.BlockSize < 0 {
+		return nil, errors.New("gpu: buffer pool block size must be >= 0")
+	}
+	p := &BufferPool{d: d, label: desc.Label, usage: desc.Usage, blockSize: desc.BlockSize, align: 4}
+	if p.blockSize == 0 {
+		p.blockSize = defaultPoolBlockSize
+	}
+	lim := d.caps.limits
+	if desc.Usage&BufferStorage != 0 {
+		p.align = max(p.align, lim.MinStorageBufferOffsetAlignment)
+	}
+	if desc.Usage&BufferUniform != 0 {
+		p.align = max(p.align, lim.MinUniformBufferOffsetAlignment)
+	}
+	return p, nil
+}
+
+// Alloc returns size bytes of the pool, valid until Reset. Their contents
+// are undefined.
+func (p *BufferPool) Alloc(size int) (BufferSlice, error) {
+	if size <= 0 {
+		return BufferSlice{}, errors.New("gpu: buffer pool allocation size must be > 0")
+	}
+	for ; p.cur < len(p.blocks); p.cur, p.off = p.cur+1, 0 {
+		if p.off+size <= p.blocks[p.cur].size {
+			return p.take(size), nil
+		}
+	}
+	b, err := p.d.NewBuffer(BufferDescriptor{Label: p.label, Size: max(size, p.blockSize), Usage: p.usage})
+	if err != nil {
+		return BufferSlice{}, err
+	}
+	p.blocks = append(p.blocks, b)
+	p.cur, p.off = len(p.blocks)-1, 0
+	return p.take(size), nil
+}
+
+// take allocates size bytes at p.off of the current block, which has them.
+func (p *BufferPool) take(size int) BufferSlice {
+	s := BufferSlice{Buffer: p.blocks[p.cur], Offset: p.off, Size: size}
+	p.off = min(alignUp(p.off+size, p.align), s.Buffer.size)
+	return s
+}
+
+// Write allocates len(data) bytes of the pool and copies data into them.
+func (p *BufferPool) Write(data []byte) (BufferSlice, error) {
+	s, err := p.Alloc(len(data))
+	if err != nil {
+		return s, err
+	}
+	s.Buffer.b.write(s.Offset, data)
+	return s, nil
+}
+
+// Reset frees every allocation of the pool for reuse. The GPU must be done
+// with them: Reset after Queue.WaitIdle, or from OnSubmittedWorkDone of the
+// last submission that read them.
+func (p *BufferPool) Reset() { p.cur, p.off = 0, 0 }
+
+// Release frees the pool's buffers. The pool is empty afterwards and can
+// allocate again.
+func (p *BufferPool) Release() {
+	for _, b := range p.blocks {
+		b.Release()
+	}
+	p.blocks = nil
+	p.Reset()
+}
+
+// alignUp rounds n up to a multiple of a.
+func alignUp(n, a int) int { return (n + a - 1) / a * a }
@@ -0,0 +1,38 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestGLBufferPool runs testBufferPool on GL, which binds the slices with
+// glBindBufferRange.
+func TestGLBufferPool(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL backend conformance test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+	ks, err := shader.CompileGLSL(poolKernels)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Add"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	t.Logf("storage buffer offset alignment: %d", dev.Limits().MinStorageBufferOffsetAlignment)
+	testBufferPool(t, dev, mod)
+}
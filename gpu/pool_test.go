@@ -0,0 +1,96 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu_test
+
+import (
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// poolKernels are the kernels of the pool tests: Add sums a and b into out.
+const poolKernels = `package kernels
+
+func Add(gid uint, a []float32, b []float32, out []float32) {
+	out[gid] = a[gid] + b[gid]
+}
+`
+
+func TestBufferPool(t *testing.T) {
+	dev := softwareDevice(t)
+	testBufferPool(t, dev, softwareModule(t, dev, poolKernels, "Add"))
+}
+
+// testBufferPool binds slices of one pool block at their offsets to mod's
+// Add and checks that it sees each slice's own data, and that Reset reuses
+// the block.
+func testBufferPool(t *testing.T, dev *gpu.Device, mod *gpu.ShaderModule) {
+	t.Helper()
+	add, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	// A block holds the three slices of a frame.
+	align := dev.Limits().MinStorageBufferOffsetAlignment
+	blockSize := 3 * max(align, 16)
+	pool, err := dev.NewBufferPool(gpu.BufferPoolDescriptor{Usage: gpu.BufferStorage, BlockSize: blockSize})
+	if err != nil {
+		t.Fatalf("NewBufferPool: %v", err)
+	}
+	defer pool.Release()
+
+	frame := func(base float32) (out gpu.BufferSlice) {
+		t.Helper()
+		a, err := pool.Write(parityBytes([]float32{base, base + 1, base + 2}))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		b, err := pool.Write(parityBytes([]float32{10, 20, 30}))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if out, err = pool.Alloc(12); err != nil {
+			t.Fatalf("Alloc: %v", err)
+		}
+		for _, s := range []gpu.BufferSlice{a, b, out} {
+			if s.Buffer != a.Buffer || s.Offset%align != 0 || s.Size != 12 {
+				t.Fatalf("slice %+v, want 12 bytes of the first block at a multiple of %d", s, align)
+			}
+		}
+		if a.Offset == b.Offset || b.Offset == out.Offset {
+			t.Fatalf("slices overlap: %d, %d, %d", a.Offset, b.Offset, out.Offset)
+		}
+		bg, err := dev.NewBindGroup(add.BindGroupLayout(0), a.Entry(0), b.Entry(1), out.Entry(2))
+		if err != nil {
+			t.Fatalf("NewBindGroup: %v", err)
+		}
+		enc := dev.NewCommandEncoder()
+		cp := enc.BeginComputePass()
+		cp.SetPipeline(add)
+		cp.SetBindGroup(0, bg)
+		cp.Dispatch(3, 1, 1)
+		cp.End()
+		submit(dev, enc)
+		got := parityFloats(out.Buffer.Bytes()[out.Offset:], 3)
+		if want := []float32{base + 10, base + 21, base + 32}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Errorf("out = %v, want %v", got, want)
+		}
+		return out
+	}
+	first := frame(1)
+	pool.Reset()
+	if second := frame(100); second != first {
+		t.Errorf("after Reset, out = %+v, want the first frame's %+v", second, first)
+	}
+
+	// An allocation larger than a block gets a block of its own.
+	big, err := pool.Alloc(4 * blockSize)
+	if err != nil {
+		t.Fatalf("Alloc: %v", err)
+	}
+	if big.Buffer == first.Buffer || big.Offset != 0 || big.Buffer.Size() != 4*blockSize {
+		t.Errorf("oversize allocation %+v of a %d-byte buffer, want a block of its own", big, big.Buffer.Size())
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"errors"
+	"fmt"
+)
+
+// QueryType is the kind of value the queries of a QuerySet record.
+type QueryType int
+
+const (
+	// QueryTimestamp queries record the GPU time, in nanoseconds, at which
+	// a pass began or ended. See PassTimestampWrites.
+	QueryTimestamp QueryType = iota
+	// QueryOcclusion queries record whether any sample of the draws between
+	// RenderPass.BeginOcclusionQuery and EndOcclusionQuery passed the depth
+	// test. See RenderPassDescriptor.OcclusionQuerySet.
+	QueryOcclusion
+)
+
+func (t QueryType) String() string {
+	switch t {
+	case QueryTimestamp:
+		return "timestamp"
+	case QueryOcclusion:
+		return "occlusion"
+	default:
+		return fmt.Sprintf("QueryType(%d)", int(t))
+	}
+}
+
+// errTimestampUnsupported is returned by NewQuerySet for timestamp queries on
+// a device whose driver cannot time GPU work.
+var errTimestampUnsupported = errors.New("gpu: timestamp queries are not supported by this device")
+
+// QuerySetDescriptor describes a query set to create.
+type QuerySetDescriptor struct {
+	Label string
+	Type  QueryType
+	Count int // number of queries, indexed 0..Count-1
+}
+
+// QuerySet is a fixed number of queries of one type. Passes write them (see
+// PassTimestampWrites); Results reads them back once that work is done.
+type QuerySet struct {
+	b     backendQuerySet
+	typ   QueryType
+	count int
+}
+
+// NewQuerySet creates a query set. It fails for a query type the device
+// cannot record.
+func (d *Device) NewQuerySet(desc QuerySetDescriptor) (*QuerySet, error) {
+	if desc.Count <= 0 {
+		return nil, errors.New("gpu: query set count must be > 0")
+	}
+	if desc.Type != QueryTimestamp && desc.Type != QueryOcclusion {
+		return nil, fmt.Errorf("gpu: unknown query type %v", desc.Type)
+	}
+	bq, err := d.b.newQuerySet(desc.Type, desc.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &QuerySet{b: bq, typ: desc.Type, count: desc.Count}, nil
+}
+
+// Type returns the type of the set's queries.
+func (q *QuerySet) Type() QueryType { return q.typ }
+
+// Count returns the number of queries in the set.
+func (q *QuerySet) Count() int { return q.count }
+
+// Results returns the values of count queries starting at first. Call it
+// once the submissions writing them have completed (after Queue.WaitIdle or
+// from Queue.OnSubmittedWorkDone).
+//
+// Timestamps are nanoseconds on a GPU clock: only differences between them
+// are meaningful, and only within one device. A query no pass wrote reads 0,
+// as does a pair the driver could not time (a GL disjoint operation, such as
+// a power state change, during the work).
+//
+// An occlusion query reads non-zero when a sample of its draws passed the
+// depth test and 0 when all were occluded. Only zero versus non-zero is
+// portable: Metal counts the passing samples, GL and Vulkan may report 1.
+func (q *QuerySet) Results(first, count int) ([]uint64, error) {
+	if first < 0 || count < 0 || first+count > q.count {
+		return nil, fmt.Errorf("gpu: query results %d+%d out of range of a set of %d", first, count, q.count)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	return q.b.results(first, count)
+}
+
+// Release frees the query set.
+func (q *QuerySet) Release() { q.b.release() }
+
+// PassTimestampWrites asks a compute or render pass to write the GPU time it
+// begins at into query BeginIndex of QuerySet and the time it ends at into
+// EndIndex. EndIndex minus BeginIndex is then the pass's GPU duration.
+type PassTimestampWrites struct {
+	QuerySet   *QuerySet
+	BeginIndex int
+	EndIndex   int
+}
+
+// passTimestamps is the backend-facing form of PassTimestampWrites.
+type passTimestamps struct {
+	set        backendQuerySet
+	begin, end int
+}
+
+// timestamps checks w and returns its backend form, or nil when w is nil.
+func (w *PassTimestampWrites) timestamps() *passTimestamps {
+	if w == nil {
+		return nil
+	}
+	q := w.QuerySet
+	switch {
+	case q == nil:
+		panic("gpu: PassTimestampWrites without a QuerySet")
+	case q.typ != QueryTimestamp:
+		panic(fmt.Sprintf("gpu: PassTimestampWrites into a %v query set", q.typ))
+	case w.BeginIndex < 0 || w.BeginIndex >= q.count || w.EndIndex < 0 || w.EndIndex >= q.count:
+		panic(fmt.Sprintf("gpu: PassTimestampWrites indices %d, %d out of range of a set of %d", w.BeginIndex, w.EndIndex, q.count))
+	case w.BeginIndex == w.EndIndex:
+		panic("gpu: PassTimestampWrites begin and end share an index")
+	}
+	return &passTimestamps{set: q.b, begin: w.BeginIndex, end: w.EndIndex}
+}
+
+// ComputePassDescriptor describes a compute pass.
+type ComputePassDescriptor struct {
+	Label string
+	// TimestampWrites, if set, records when the pass begins and ends on the
+	// GPU.
+	TimestampWrites *PassTimestampWrites
+}
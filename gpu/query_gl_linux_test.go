@@ -0,0 +1,113 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestGLTimestamps times two compute passes and a render pass of one
+// submission and checks the timestamps come back in pass order.
+func TestGLTimestamps(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL timestamp test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	qs, err := dev.NewQuerySet(gpu.QuerySetDescriptor{Type: gpu.QueryTimestamp, Count: 8})
+	if err != nil {
+		t.Skipf("no timestamp queries: %v", err)
+	}
+	defer qs.Release()
+
+	const src = `package kernels
+func Spin(gid uint, out []float32) {
+	v := float32(gid)
+	for i := 0; i < 256; i++ {
+		v = v*0.5 + 1.0
+	}
+	out[gid] = v
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Spin"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	const n = 1 << 14
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(pipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	tex, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: 64, Height: 64, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("NewTexture: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	for i := 0; i < 2; i++ {
+		cp := enc.BeginComputePass(gpu.ComputePassDescriptor{
+			TimestampWrites: &gpu.PassTimestampWrites{QuerySet: qs, BeginIndex: 2 * i, EndIndex: 2*i + 1},
+		})
+		cp.SetPipeline(pipe)
+		cp.SetBindGroup(0, bg)
+		cp.Dispatch(n, 1, 1)
+		cp.End()
+	}
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: tex, Load: gpu.LoadClear, ClearColor: [4]float64{1, 0, 0, 1},
+		TimestampWrites: &gpu.PassTimestampWrites{QuerySet: qs, BeginIndex: 4, EndIndex: 5},
+	})
+	rp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	ts, err := qs.Results(0, 8)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	t.Logf("timestamps: %v", ts)
+	if ts[0] == 0 {
+		t.Fatalf("first compute pass has no begin timestamp: %v", ts)
+	}
+	for i := 1; i < 6; i++ {
+		if ts[i] < ts[i-1] {
+			t.Fatalf("timestamp %d (%d) before timestamp %d (%d)", i, ts[i], i-1, ts[i-1])
+		}
+	}
+	if ts[6] != 0 || ts[7] != 0 {
+		t.Fatalf("unwritten queries read %d, %d; want 0", ts[6], ts[7])
+	}
+	if _, err := qs.Results(4, 5); err == nil {
+		t.Fatalf("Results past the end of the set succeeded")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("a pass writing begin and end to one query did not panic")
+		}
+	}()
+	enc.BeginComputePass(gpu.ComputePassDescriptor{TimestampWrites: &gpu.PassTimestampWrites{QuerySet: qs, BeginIndex: 1, EndIndex: 1}})
+}
@@ -0,0 +1,249 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"poly.red/gpu/shader"
+)
+
+// NewShaderModuleFromKernel compiles a kernel of the Go→shader compiler for
+// the active backend: its MSL on Metal, GLSL on GL, SPIR-V on Vulkan and its
+// CPU program on DriverSoftware, so k must come from the compiler for that
+// language. The module keeps k's reflection data (stage, bindings, workgroup
+// size): a pipeline built from it derives its layout when the descriptor's
+// Layout is nil, and an explicit Layout that disagrees with the kernel's
+// bindings is rejected.
+func (d *Device) NewShaderModuleFromKernel(k *shader.Kernel) (*ShaderModule, error) {
+	if k == nil {
+		return nil, errors.New("gpu: nil kernel")
+	}
+	var src ShaderSource
+	switch d.driver {
+	case DriverMetal:
+		src = ShaderSource{MSL: k.MSL, Lines: k.Lines}
+	case DriverGL:
+		src = ShaderSource{GLSL: k.GLSL, Lines: k.Lines}
+	case DriverVulkan:
+		src = ShaderSource{SPIRV: k.SPIRV}
+	case DriverSoftware:
+		src = ShaderSource{CPU: k.CPU}
+	}
+	if src.MSL == "" && src.GLSL == "" && len(src.SPIRV) == 0 && src.CPU == nil {
+		return nil, fmt.Errorf("gpu: kernel %s has no source for the %v driver", k.Name, d.driver)
+	}
+	m, err := d.NewShaderModule(src)
+	if err != nil {
+		return nil, err
+	}
+	m.kernel = k
+	return m, nil
+}
+
+// stageNames names the shader stages in errors.
+var stageNames = map[shader.Stage]string{
+	shader.StageCompute:  "compute",
+	shader.StageVertex:   "vertex",
+	shader.StageFragment: "fragment",
+}
+
+// entry resolves a pipeline's entry point in m for a stage. A module made
+// from a kernel has one entry, the kernel, which an empty name selects; other
+// modules take the name as given.
+func (m *ShaderModule) entry(name string, stage shader.Stage) (string, error) {
+	k := m.kernel
+	if k == nil {
+		return name, nil
+	}
+	if name != "" && name != k.Name {
+		return "", fmt.Errorf("gpu: entry %s is not in the module of kernel %s", name, k.Name)
+	}
+	if k.Stage != stage {
+		return "", fmt.Errorf("gpu: kernel %s is a %s kernel, not a %s one", k.Name, stageNames[k.Stage], stageNames[stage])
+	}
+	return k.Name, nil
+}
+
+// kernelEntries returns the bind group layout entries of k's buffers, visible
+// to vis. Textures and samplers are bound with SetTexture and SetSampler,
+// outside bind groups, so they have none.
+func kernelEntries(k *shader.Kernel, vis ShaderStage) []BindGroupLayoutEntry {
+	var es []BindGroupLayoutEntry
+	for _, b := range k.SortedBindings() {
+		if kind, ok := bindingKind(b.Kind); ok {
+			es = append(es, BindGroupLayoutEntry{Binding: b.Index, Visibility: vis, Kind: kind, MinBindingSize: b.MinSize})
+		}
+	}
+	return es
+}
+
+// bindingKind returns the bind group kind of a kernel binding, if it is a
+// buffer.
+func bindingKind(k shader.BindingKind) (BindingKind, bool) {
+	switch k {
+	case shader.StorageBuffer:
+		return StorageBuffer, true
+	case shader.UniformBuffer:
+		return UniformBuffer, true
+	}
+	return 0, false
+}
+
+// kernelLayout returns the bind group layout of the kernels of mods (nil
+// for a module not made from a kernel), each visible to its stage in vis:
+// their buffers, where one both stages use is visible to both and needs the
+// larger of their minimum sizes. It is nil when no module has a kernel.
+func kernelLayout(mods []*ShaderModule, vis []ShaderStage) *BindGroupLayout {
+	if !reflected(mods) {
+		return nil
+	}
+	var es []BindGroupLayoutEntry
+	for i, m := range mods {
+		if m == nil || m.kernel == nil {
+			continue
+		}
+	next:
+		for _, e := range kernelEntries(m.kernel, vis[i]) {
+			for j := range es {
+				if es[j].Binding == e.Binding && es[j].Kind == e.Kind {
+					es[j].Visibility |= e.Visibility
+					es[j].MinBindingSize = max(es[j].MinBindingSize, e.MinBindingSize)
+					continue next
+				}
+			}
+			es = append(es, e)
+		}
+	}
+	return &BindGroupLayout{entries: es}
+}
+
+// pipelineLayout returns the layout of a pipeline running the kernels of
+// mods, each visible to its stage in vis. A nil layout is derived from the
+// kernels, as one bind group of kernelLayout. A given layout must declare
+// every kernel buffer, with its kind, in group 0.
+//
+// A binding is named by its index and kind together: GL numbers storage and
+// uniform buffers separately, so a kernel's first of each are both binding 0.
+func pipelineLayout(layout *PipelineLayout, mods []*ShaderModule, vis []ShaderStage) (*PipelineLayout, error) {
+	if layout == nil {
+		g := kernelLayout(mods, vis)
+		if g == nil {
+			return nil, nil
+		}
+		return &PipelineLayout{groups: []*BindGroupLayout{g}}, nil
+	}
+	group := layout.group(0)
+	for _, m := range mods {
+		if m == nil || m.kernel == nil {
+			continue
+		}
+		for _, b := range m.kernel.SortedBindings() {
+			kind, ok := bindingKind(b.Kind)
+			if !ok {
+				continue
+			}
+			if group == nil || !slices.ContainsFunc(group.entries, func(e BindGroupLayoutEntry) bool {
+				return e.Binding == b.Index && e.Kind == kind
+			}) {
+				return nil, fmt.Errorf("gpu: layout has no %v binding %d for %s of kernel %s", kind, b.Index, b.Name, m.kernel.Name)
+			}
+		}
+	}
+	return layout, nil
+}
+
+// reflected reports whether any of mods was made from a kernel.
+func reflected(mods []*ShaderModule) bool {
+	for _, m := range mods {
+		if m != nil && m.kernel != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// usage is the buffer usage a binding of kind k needs, and its name.
+func (k BindingKind) usage() (BufferUsage, string) {
+	if k == UniformBuffer {
+		return BufferUniform, "BufferUniform"
+	}
+	return BufferStorage, "BufferStorage"
+}
+
+// offsetAlignment is what the offset of a binding of kind k is a multiple
+// of under lim.
+func (k BindingKind) offsetAlignment(lim Limits) int {
+	if k == UniformBuffer {
+		return lim.MinUniformBufferOffsetAlignment
+	}
+	return lim.MinStorageBufferOffsetAlignment
+}
+
+// bindingSlot is a binding of a layout, named by its index and kind
+// together (see pipelineLayout).
+type bindingSlot struct {
+	binding int
+	kind    BindingKind
+}
+
+// checkBindGroup reports the first entry of a bind group that does not fit
+// layout, or a binding of layout that has no entry, and otherwise returns
+// the kind of the binding each entry fills. Where the layout has a storage
+// and a uniform buffer at one index, the entry's buffer usage says which of
+// the two it fills. Entry offsets are checked against the alignments of lim
+// and entry sizes against the layout's MinBindingSize.
+func checkBindGroup(layout *BindGroupLayout, entries []BindGroupEntry, lim Limits) ([]BindingKind, error) {
+	if layout == nil {
+		return nil, errors.New("gpu: bind group requires a layout")
+	}
+	filled := map[bindingSlot]bool{}
+	var out []BindingKind
+	for _, e := range entries {
+		var les []BindGroupLayoutEntry
+		for _, le := range layout.entries {
+			if le.Binding == e.Binding {
+				les = append(les, le)
+			}
+		}
+		if len(les) == 0 {
+			return nil, fmt.Errorf("gpu: bind group entry for binding %d, which the layout does not declare", e.Binding)
+		}
+		if e.Buffer == nil {
+			return nil, fmt.Errorf("gpu: bind group entry for binding %d has no buffer", e.Binding)
+		}
+		if e.Offset < 0 || e.Size < 0 || e.Offset+e.Size > e.Buffer.size {
+			return nil, fmt.Errorf("gpu: bind group entry for binding %d has range [%d, +%d) outside its %d-byte buffer", e.Binding, e.Offset, e.Size, e.Buffer.size)
+		}
+		i := slices.IndexFunc(les, func(le BindGroupLayoutEntry) bool {
+			usage, _ := le.Kind.usage()
+			return e.Buffer.usage&usage != 0 && !filled[bindingSlot{e.Binding, le.Kind}]
+		})
+		if i < 0 {
+			if slices.ContainsFunc(les, func(le BindGroupLayoutEntry) bool { return filled[bindingSlot{e.Binding, le.Kind}] }) {
+				return nil, fmt.Errorf("gpu: bind group has two entries for binding %d", e.Binding)
+			}
+			_, name := les[0].Kind.usage()
+			return nil, fmt.Errorf("gpu: binding %d is a %v, but its buffer was not created with %s usage", e.Binding, les[0].Kind, name)
+		}
+		le := les[i]
+		if a := le.Kind.offsetAlignment(lim); a > 0 && e.Offset%a != 0 {
+			return nil, fmt.Errorf("gpu: binding %d has offset %d, which is not a multiple of the device's %v offset alignment %d", e.Binding, e.Offset, le.Kind, a)
+		}
+		if size := e.size(); size < le.MinBindingSize {
+			return nil, fmt.Errorf("gpu: binding %d has %d bytes, fewer than the %d its %v needs", e.Binding, size, le.MinBindingSize, le.Kind)
+		}
+		filled[bindingSlot{e.Binding, le.Kind}] = true
+		out = append(out, le.Kind)
+	}
+	for _, le := range layout.entries {
+		if !filled[bindingSlot{le.Binding, le.Kind}] {
+			return nil, fmt.Errorf("gpu: bind group has no entry for %v binding %d", le.Kind, le.Binding)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// TestGLKernelModule runs a kernel with a uniform through a module made by
+// NewShaderModuleFromKernel, with no hand-built layout: the pipeline derives
+// it, and NewBindGroup checks the entries against it.
+func TestGLKernelModule(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL backend conformance test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const src = `package kernels
+type U struct{ Factor float32 }
+func Scale(gid uint, a []float32, u U, out []float32) { out[gid] = a[gid] * u.Factor }`
+	msl, err := shader.Compile(src)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if _, err := dev.NewShaderModuleFromKernel(msl["Scale"]); err == nil {
+		t.Fatalf("an MSL-only kernel made a GL module")
+	}
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Scale"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	bad := dev.NewBindGroupLayout(
+		gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+		gpu.BindGroupLayoutEntry{Binding: 1, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+	)
+	_, err = dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(bad), Module: mod})
+	if err == nil || !strings.Contains(err.Error(), "no uniform buffer binding 0 for u of kernel Scale") {
+		t.Fatalf("mismatched layout: err = %v", err)
+	}
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+
+	const n = 256
+	const factor float32 = 1.5
+	a := make([]float32, n)
+	for i := range a {
+		a[i] = float32(i)
+	}
+	ub := make([]byte, 16)
+	binary.LittleEndian.PutUint32(ub, math.Float32bits(factor))
+	aBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(a), Usage: gpu.BufferStorage})
+	uBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Data: ub, Usage: gpu.BufferUniform})
+	outBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage})
+
+	// GLSL numbers storage and uniform buffers apart: a and out are storage
+	// buffers 0 and 1, u is uniform buffer 0.
+	layout := pipe.BindGroupLayout(0)
+	_, err = dev.NewBindGroup(layout,
+		gpu.BindGroupEntry{Binding: 0, Buffer: aBuf},
+		gpu.BindGroupEntry{Binding: 1, Buffer: uBuf},
+		gpu.BindGroupEntry{Binding: 0, Buffer: outBuf})
+	if err == nil || !strings.Contains(err.Error(), "binding 1 is a storage buffer") {
+		t.Fatalf("mismatched bind group: err = %v", err)
+	}
+	bg, err := dev.NewBindGroup(layout,
+		gpu.BindGroupEntry{Binding: 0, Buffer: aBuf},
+		gpu.BindGroupEntry{Binding: 0, Buffer: uBuf},
+		gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	pass := enc.BeginComputePass()
+	pass.SetPipeline(pipe)
+	pass.SetBindGroup(0, bg)
+	pass.Dispatch(n, 1, 1)
+	pass.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := glFloatsOf(outBuf.Bytes(), n)
+	for i := range got {
+		if want := a[i] * factor; got[i] != want {
+			t.Fatalf("Scale[%d] = %v, want %v", i, got[i], want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"poly.red/gpu/shader"
+)
+
+// TestPipelineLayout checks the layouts derived from, and checked against,
+// the reflection data of kernel modules.
+func TestPipelineLayout(t *testing.T) {
+	ks, err := shader.Compile(`package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type U struct{ Scale float32 }
+type VOut struct {
+	Pos Vec4 ` + "`gpu:\"position\"`" + `
+}
+func Scale(gid uint, a []float32, u U, out []float32) { out[gid] = a[gid] * u.Scale }
+
+//gpu:vertex
+func V(vid uint, pos []Vec4) VOut { return VOut{pos[vid]} }
+
+//gpu:fragment
+func F(in VOut, u U) Vec4 { return in.Pos * u.Scale }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := func(name string) *ShaderModule { return &ShaderModule{kernel: ks[name]} }
+
+	l, err := pipelineLayout(nil, []*ShaderModule{mod("Scale")}, []ShaderStage{StageCompute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BindGroupLayoutEntry{
+		{Binding: 0, Visibility: StageCompute, Kind: StorageBuffer, MinBindingSize: 4},
+		{Binding: 1, Visibility: StageCompute, Kind: UniformBuffer, MinBindingSize: 4},
+		{Binding: 2, Visibility: StageCompute, Kind: StorageBuffer, MinBindingSize: 4},
+	}
+	if got := l.group(0).entries; !slices.Equal(got, want) {
+		t.Errorf("compute layout = %v, want %v", got, want)
+	}
+
+	// A render pipeline's layout holds the buffers of both stages.
+	l, err = pipelineLayout(nil, []*ShaderModule{mod("V"), mod("F")}, []ShaderStage{StageVertex, StageFragment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []BindGroupLayoutEntry{
+		{Binding: 0, Visibility: StageVertex, Kind: StorageBuffer, MinBindingSize: 16},
+		{Binding: 0, Visibility: StageFragment, Kind: UniformBuffer, MinBindingSize: 4},
+	}
+	if got := l.group(0).entries; !slices.Equal(got, want) {
+		t.Errorf("render layout = %v, want %v", got, want)
+	}
+	want = []BindGroupLayoutEntry{
+		{Binding: 0, Visibility: StageCompute, Kind: StorageBuffer},
+		{Binding: 1, Visibility: StageCompute, Kind: UniformBuffer},
+		{Binding: 2, Visibility: StageCompute, Kind: StorageBuffer},
+	}
+
+	// Modules without reflection keep a nil layout, as before.
+	if l, err := pipelineLayout(nil, []*ShaderModule{{}}, []ShaderStage{StageCompute}); l != nil || err != nil {
+		t.Errorf("unreflected module: layout %v, err %v, want nil, nil", l, err)
+	}
+
+	for _, tc := range []struct {
+		entries []BindGroupLayoutEntry
+		err     string
+	}{
+		{want, ""},
+		{append(want[:2:2], BindGroupLayoutEntry{Binding: 3, Kind: StorageBuffer}), "layout has no storage buffer binding 2 for out of kernel Scale"},
+		{[]BindGroupLayoutEntry{want[0], {Binding: 1, Kind: StorageBuffer}, want[2]}, "layout has no uniform buffer binding 1 for u of kernel Scale"},
+	} {
+		given := &PipelineLayout{groups: []*BindGroupLayout{{entries: tc.entries}}}
+		_, err := pipelineLayout(given, []*ShaderModule{mod("Scale")}, []ShaderStage{StageCompute})
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("layout %v: err = %v, want %q", tc.entries, err, tc.err)
+		}
+	}
+
+	if _, err := mod("V").entry("", shader.StageCompute); err == nil || !strings.Contains(err.Error(), "kernel V is a vertex kernel, not a compute one") {
+		t.Errorf("stage mismatch: err = %v", err)
+	}
+	if _, err := mod("Scale").entry("Add", shader.StageCompute); err == nil {
+		t.Errorf("wrong entry: want an error")
+	}
+}
+
+// TestCheckBindGroup checks the bind group entries NewBindGroup rejects.
+func TestCheckBindGroup(t *testing.T) {
+	layout := &BindGroupLayout{entries: []BindGroupLayoutEntry{
+		{Binding: 0, Kind: StorageBuffer},
+		{Binding: 1, Kind: UniformBuffer, MinBindingSize: 16},
+	}}
+	storage := &Buffer{size: 64, usage: BufferStorage | BufferCopyDst}
+	uniform := &Buffer{size: 64, usage: BufferUniform}
+	lim := Limits{MinUniformBufferOffsetAlignment: 32, MinStorageBufferOffsetAlignment: 16}
+	for _, tc := range []struct {
+		entries []BindGroupEntry
+		err     string
+	}{
+		{[]BindGroupEntry{{Binding: 1, Buffer: uniform}, {Binding: 0, Buffer: storage}}, ""},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}}, "no entry for uniform buffer binding 1"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 1, Buffer: uniform}, {Binding: 2, Buffer: storage}}, "binding 2, which the layout does not declare"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 0, Buffer: storage}}, "two entries for binding 0"},
+		{[]BindGroupEntry{{Binding: 0}, {Binding: 1, Buffer: uniform}}, "binding 0 has no buffer"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: uniform}, {Binding: 1, Buffer: uniform}}, "binding 0 is a storage buffer, but its buffer was not created with BufferStorage usage"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 1, Buffer: storage}}, "binding 1 is a uniform buffer, but its buffer was not created with BufferUniform usage"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage, Offset: 48}, {Binding: 1, Buffer: uniform, Offset: 32, Size: 32}}, ""},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage, Offset: 48, Size: 32}, {Binding: 1, Buffer: uniform}}, "range [48, +32) outside its 64-byte buffer"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage, Offset: -16}, {Binding: 1, Buffer: uniform}}, "range [-16, +0) outside"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 1, Buffer: uniform, Offset: 16}}, "offset 16, which is not a multiple of the device's uniform buffer offset alignment 32"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 1, Buffer: uniform, Offset: 32, Size: 16}}, ""},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 1, Buffer: uniform, Offset: 32, Size: 8}}, "binding 1 has 8 bytes, fewer than the 16 its uniform buffer needs"},
+	} {
+		if _, err := checkBindGroup(layout, tc.entries, lim); tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("entries %v: err = %v, want %q", tc.entries, err, tc.err)
+		}
+	}
+
+	// GL numbers storage and uniform buffers apart: the usage of a buffer
+	// bound at 0 picks the entry it fills.
+	layout = &BindGroupLayout{entries: []BindGroupLayoutEntry{
+		{Binding: 0, Kind: StorageBuffer},
+		{Binding: 0, Kind: UniformBuffer},
+	}}
+	for _, tc := range []struct {
+		entries []BindGroupEntry
+		err     string
+	}{
+		{[]BindGroupEntry{{Binding: 0, Buffer: uniform}, {Binding: 0, Buffer: storage}}, ""},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}}, "no entry for uniform buffer binding 0"},
+		{[]BindGroupEntry{{Binding: 0, Buffer: storage}, {Binding: 0, Buffer: storage}}, "two entries for binding 0"},
+	} {
+		if _, err := checkBindGroup(layout, tc.entries, lim); tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("entries %v: err = %v, want %q", tc.entries, err, tc.err)
+		}
+	}
+	if _, err := checkBindGroup(nil, nil, lim); err == nil {
+		t.Errorf("nil layout: want an error")
+	}
+}
@@ -4,7 +4,12 @@
 
 package gpu
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"poly.red/gpu/shader"
+)
 
 // TextureFormat is a texture pixel format.
 type TextureFormat int
@@ -20,22 +25,56 @@ const (
 	// RGBA32Float is 32-bit float RGBA, for a float render target such as a
 	// G-buffer attachment that stores world positions or normals at full precision.
 	RGBA32Float
+	// R8Unorm is a single 8-bit normalized unsigned channel.
+	R8Unorm
+	// RG16Float is two 16-bit (half) float channels.
+	RG16Float
+	// RGBA16Float is 16-bit (half) float RGBA.
+	RGBA16Float
+	// R32Float is a single 32-bit float channel.
+	R32Float
+	// Depth24Stencil8 is a depth format with a stencil channel, for a depth
+	// render target. Its depth precision is at least 24 bits: Metal stores it
+	// as Depth32Float_Stencil8, which Apple GPUs support and 24-bit depth is not.
+	Depth24Stencil8
+	// BGRA8UnormSRGB is 8-bit BGRA with sRGB encoding: samples and blends are
+	// in linear space, stored bytes are sRGB-encoded and in B, G, R, A order.
+	BGRA8UnormSRGB
 )
 
 // TextureDescriptor describes a texture to create.
 type TextureDescriptor struct {
-	Label        string
-	Format       TextureFormat
-	Width        int
-	Height       int
-	RenderTarget bool // usable as a render-pass color attachment
+	Label  string
+	Format TextureFormat
+	// Dimension is the texture's shape; the zero value is a single 2D image.
+	Dimension TextureDimension
+	Width     int
+	Height    int
+	// DepthOrArrayLayers is the depth of a 3D texture or the layer count of
+	// a 2D array; 0 means 1, or 6 for a cube map, which must have 6.
+	DepthOrArrayLayers int
+	// MipLevelCount is the number of mip levels, each half the size of the
+	// one before down to 1x1; 0 means 1.
+	MipLevelCount int
+	RenderTarget  bool // usable as a render-pass color attachment
+	// SampleCount is the number of samples per texel: 0 means 1, and 4
+	// makes a multisampled 2D render target or depth texture, drawn by
+	// pipelines of the same SampleCount and read back through a pass's
+	// ResolveTarget or a kernel's Texture2DMS.Load.
+	SampleCount int
 }
 
 // Texture is a GPU image, usable as a render target and/or sampled resource.
 type Texture struct {
-	b backendTexture
-	w int
-	h int
+	b            backendTexture
+	w            int
+	h            int
+	format       TextureFormat
+	dim          TextureDimension
+	layers       int // DepthOrArrayLayers
+	mips         int
+	samples      int // per texel, 1 unless multisampled
+	renderTarget bool
 }
 
 // Width returns the texture width in pixels.
@@ -45,12 +84,20 @@ func (t *Texture) Width() int { return t.w }
 func (t *Texture) Height() int { return t.h }
 
 // ReadPixels copies the texture's pixels back to CPU memory (tightly packed,
-// 4 bytes/pixel for RGBA8Unorm). Used for headless render-to-image.
-func (t *Texture) ReadPixels() []byte { return t.b.readPixels() }
+// 4 bytes/pixel for RGBA8Unorm). Used for headless render-to-image. It panics
+// for a multisampled texture: read its pass's ResolveTarget instead.
+func (t *Texture) ReadPixels() []byte {
+	t.checkSingleSampled("ReadPixels")
+	return t.b.readPixels()
+}
 
 // Write uploads tightly-packed pixel data (4 bytes/pixel for RGBA8Unorm) into
-// the texture.
-func (t *Texture) Write(pixels []byte) { t.b.write(pixels, t.w*4) }
+// the texture. It is WriteLevel(0, 0, pixels).
+func (t *Texture) Write(pixels []byte) { t.WriteLevel(0, 0, pixels) }
+
+// Release frees the texture. A surface's textures belong to the surface:
+// do not release them.
+func (t *Texture) Release() { t.b.release() }
 
 // FilterMode selects texture filtering.
 type FilterMode int
@@ -72,8 +119,30 @@ const (
 type SamplerDescriptor struct {
 	MinFilter FilterMode
 	MagFilter FilterMode
-	AddressU  AddressMode
-	AddressV  AddressMode
+	// MipmapFilter blends the two nearest mip levels (FilterLinear; with
+	// linear MinFilter and MagFilter, trilinear filtering) or reads the
+	// nearest one (FilterNearest, the default).
+	MipmapFilter FilterMode
+	AddressU     AddressMode
+	AddressV     AddressMode
+	// LodMinClamp and LodMaxClamp bound the mip level of detail sampled.
+	// A zero LodMaxClamp means 32, no bound.
+	LodMinClamp float32
+	LodMaxClamp float32
+	// MaxAnisotropy is the most samples anisotropic filtering takes for a
+	// texel stretched across the screen; 0 or 1 turns it off. Above 1 it
+	// needs every filter linear, and the device may clamp it (to 16 at most).
+	// It follows the screen-space derivatives of a fragment shader's
+	// coordinates: leave it off for samples at an explicit level and in
+	// compute kernels, which have none.
+	MaxAnisotropy int
+	// Compare makes a comparison sampler, which a kernel passes to a depth
+	// texture's SampleCompare: each texel read is 1 where the reference
+	// value compares to it as Compare says and 0 where not, so linear
+	// filtering returns the fraction that pass (percentage-closer filtering
+	// for shadow maps). CompareUndefined, the default, makes an ordinary
+	// sampler.
+	Compare CompareFunction
 }
 
 // Sampler describes how a shader reads a texture.
@@ -81,8 +150,14 @@ type Sampler struct {
 	b backendSampler
 }
 
-// NewSampler creates a sampler.
+// NewSampler creates a sampler. It panics for an invalid descriptor: a
+// negative LodMinClamp, a LodMaxClamp below it, or anisotropy without linear
+// filters.
 func (d *Device) NewSampler(desc SamplerDescriptor) *Sampler {
+	desc, err := desc.normalize()
+	if err != nil {
+		panic(err)
+	}
 	return &Sampler{b: d.b.newSampler(desc)}
 }
 
@@ -91,7 +166,8 @@ func (p *ComputePass) SetTexture(index int, t *Texture) {
 	p.e.cmd.setComputeTexture(index, t.b)
 }
 
-// SetSampler binds a sampler at the given sampler index.
+// SetSampler binds a sampler at the given sampler index. GL has no separate
+// sampler bindings: the sampler at index i applies to the texture at index i.
 func (p *ComputePass) SetSampler(index int, s *Sampler) {
 	p.e.cmd.setComputeSampler(index, s.b)
 }
@@ -101,15 +177,25 @@ func (d *Device) NewTexture(desc TextureDescriptor) (*Texture, error) {
 	if desc.Width <= 0 || desc.Height <= 0 {
 		return nil, errors.New("gpu: texture dimensions must be > 0")
 	}
-	bt, err := d.b.newTexture(desc.Format, desc.Width, desc.Height, desc.RenderTarget)
+	desc, err := desc.normalize()
 	if err != nil {
 		return nil, err
 	}
-	return &Texture{b: bt, w: desc.Width, h: desc.Height}, nil
+	bt, err := d.b.newTexture(desc)
+	if err != nil {
+		return nil, err
+	}
+	return &Texture{
+		b: bt, w: desc.Width, h: desc.Height, format: desc.Format,
+		dim: desc.Dimension, layers: desc.DepthOrArrayLayers, mips: desc.MipLevelCount,
+		samples: desc.SampleCount, renderTarget: desc.RenderTarget,
+	}, nil
 }
 
 // RenderPipelineDescriptor describes a render pipeline. The vertex and fragment
-// stages may come from the same or different shader modules.
+// stages may come from the same or different shader modules. With modules from
+// NewShaderModuleFromKernel, a nil Layout is derived from both kernels'
+// bindings and empty entries name the kernels.
 type RenderPipelineDescriptor struct {
 	Label          string
 	Layout         *PipelineLayout
@@ -122,13 +208,175 @@ type RenderPipelineDescriptor struct {
 	// ColorFormat). Empty for a single color target. Used for a G-buffer (MRT).
 	ExtraColorFormats []TextureFormat
 	// DepthFormat is the depth attachment format (FormatNone for no depth test).
-	// When set, the pipeline depth-tests with "less" and writes depth.
 	DepthFormat TextureFormat
+	// DepthCompare is the depth test a fragment must pass against the depth
+	// attachment, and DepthWriteEnabled whether a passing fragment writes its
+	// depth. The zero DepthCompare (CompareUndefined) is the standard 3D test:
+	// "less" with depth writes on, whatever DepthWriteEnabled says.
+	DepthCompare      CompareFunction
+	DepthWriteEnabled bool
+
+	// Blend is the blend state of color attachment 0 and ExtraBlends those of
+	// attachments 1..N, matched to ExtraColorFormats. A nil state (or a missing
+	// ExtraBlends entry) writes the fragment's output unblended.
+	Blend       *BlendState
+	ExtraBlends []*BlendState
+	// ColorWriteMask selects the channels written to every color attachment.
+	// The zero value writes all of them; ColorWriteNone none, for a draw that
+	// only tests depth, such as an occlusion query's proxy geometry.
+	ColorWriteMask ColorWriteMask
+
+	// CullMode selects which faces are discarded before rasterization and
+	// FrontFace the winding (in normalized device coordinates) of a front face.
+	CullMode  CullMode
+	FrontFace FrontFace
+
+	// SampleCount is the sample count of the attachments the pipeline draws
+	// into: 0 means 1, and 4 for multisampled ones.
+	SampleCount int
+}
+
+// CompareFunction is a depth comparison: a fragment passes when its depth
+// compares true against the stored depth.
+type CompareFunction int
+
+const (
+	// CompareUndefined is the zero value, the pipeline's default test.
+	CompareUndefined CompareFunction = iota
+	CompareNever
+	CompareLess
+	CompareEqual
+	CompareLessEqual
+	CompareGreater
+	CompareNotEqual
+	CompareGreaterEqual
+	CompareAlways
+)
+
+// BlendFactor scales a blend source or destination term.
+type BlendFactor int
+
+const (
+	BlendZero BlendFactor = iota
+	BlendOne
+	BlendSrc
+	BlendOneMinusSrc
+	BlendSrcAlpha
+	BlendOneMinusSrcAlpha
+	BlendDst
+	BlendOneMinusDst
+	BlendDstAlpha
+	BlendOneMinusDstAlpha
+)
+
+// BlendOperation combines the scaled source and destination terms.
+type BlendOperation int
+
+const (
+	BlendOpAdd             BlendOperation = iota // src + dst
+	BlendOpSubtract                              // src - dst
+	BlendOpReverseSubtract                       // dst - src
+	BlendOpMin                                   // min(src, dst), factors ignored
+	BlendOpMax                                   // max(src, dst), factors ignored
+)
+
+// BlendComponent is the blend equation of the color or the alpha channel:
+// Operation(src*SrcFactor, dst*DstFactor).
+type BlendComponent struct {
+	SrcFactor BlendFactor
+	DstFactor BlendFactor
+	Operation BlendOperation
+}
+
+// BlendState blends a color target's new fragment (src) with its stored value
+// (dst), the color and alpha channels separately.
+type BlendState struct {
+	Color BlendComponent
+	Alpha BlendComponent
+}
+
+// BlendAlpha is the usual "over" compositing of non-premultiplied colors.
+var BlendAlpha = BlendState{
+	Color: BlendComponent{SrcFactor: BlendSrcAlpha, DstFactor: BlendOneMinusSrcAlpha},
+	Alpha: BlendComponent{SrcFactor: BlendOne, DstFactor: BlendOneMinusSrcAlpha},
+}
+
+// ColorWriteMask is a set of color channels a render pipeline writes.
+type ColorWriteMask int
+
+const (
+	ColorWriteRed ColorWriteMask = 1 << iota
+	ColorWriteGreen
+	ColorWriteBlue
+	ColorWriteAlpha
+	// ColorWriteNone writes no channel. The zero ColorWriteMask cannot mean
+	// that, as it is the default of writing them all.
+	ColorWriteNone
+
+	ColorWriteAll = ColorWriteRed | ColorWriteGreen | ColorWriteBlue | ColorWriteAlpha
+)
+
+// CullMode selects the faces a render pipeline discards.
+type CullMode int
+
+const (
+	CullNone CullMode = iota
+	CullFront
+	CullBack
+)
+
+// FrontFace is the vertex winding of a front-facing triangle.
+type FrontFace int
+
+const (
+	FrontCCW FrontFace = iota // counter-clockwise
+	FrontCW                   // clockwise
+)
+
+// renderState is a render pipeline's fixed-function state as handed to the
+// backend: one blend entry per color target, the channels written (0 for
+// none) and a resolved depth test.
+type renderState struct {
+	blend        []*BlendState
+	colorWrite   ColorWriteMask
+	depthCompare CompareFunction
+	depthWrite   bool
+	cull         CullMode
+	frontFace    FrontFace
+	samples      int
+}
+
+func (desc *RenderPipelineDescriptor) state() renderState {
+	s := renderState{
+		blend:        make([]*BlendState, 1+len(desc.ExtraColorFormats)),
+		depthCompare: desc.DepthCompare,
+		depthWrite:   desc.DepthWriteEnabled,
+		cull:         desc.CullMode,
+		frontFace:    desc.FrontFace,
+		samples:      max(desc.SampleCount, 1),
+	}
+	s.blend[0] = desc.Blend
+	copy(s.blend[1:], desc.ExtraBlends)
+	switch desc.ColorWriteMask {
+	case 0:
+		s.colorWrite = ColorWriteAll
+	case ColorWriteNone:
+		s.colorWrite = 0
+	default:
+		s.colorWrite = desc.ColorWriteMask & ColorWriteAll
+	}
+	if s.depthCompare == CompareUndefined {
+		s.depthCompare, s.depthWrite = CompareLess, true
+	}
+	return s
 }
 
 // RenderPipeline is a compiled render pipeline.
 type RenderPipeline struct {
-	b backendRenderPipeline
+	b       backendRenderPipeline
+	layout  *PipelineLayout
+	samples int
+	kernel  *BindGroupLayout // as in ComputePipeline
 }
 
 // NewRenderPipeline creates a render pipeline.
@@ -136,13 +384,43 @@ func (d *Device) NewRenderPipeline(desc RenderPipelineDescriptor) (*RenderPipeli
 	if desc.VertexModule == nil || desc.FragmentModule == nil {
 		return nil, errors.New("gpu: render pipeline requires vertex and fragment modules")
 	}
-	bp, err := d.b.newRenderPipeline(desc.VertexModule.b, desc.VertexEntry, desc.FragmentModule.b, desc.FragmentEntry, desc.ColorFormat, desc.ExtraColorFormats, desc.DepthFormat)
+	if len(desc.ExtraBlends) > len(desc.ExtraColorFormats) {
+		return nil, errors.New("gpu: render pipeline has more ExtraBlends than ExtraColorFormats")
+	}
+	if desc.SampleCount != 0 && desc.SampleCount != 1 && desc.SampleCount != 4 {
+		return nil, fmt.Errorf("gpu: render pipeline sample count %d is not 1 or 4", desc.SampleCount)
+	}
+	ventry, err := desc.VertexModule.entry(desc.VertexEntry, shader.StageVertex)
+	if err != nil {
+		return nil, err
+	}
+	fentry, err := desc.FragmentModule.entry(desc.FragmentEntry, shader.StageFragment)
 	if err != nil {
 		return nil, err
 	}
-	return &RenderPipeline{b: bp}, nil
+	layout, err := pipelineLayout(desc.Layout, []*ShaderModule{desc.VertexModule, desc.FragmentModule}, []ShaderStage{StageVertex, StageFragment})
+	if err != nil {
+		return nil, err
+	}
+	bp, err := d.b.newRenderPipeline(desc.VertexModule.b, ventry, desc.FragmentModule.b, fentry, desc.ColorFormat, desc.ExtraColorFormats, desc.DepthFormat, desc.state())
+	if err != nil {
+		return nil, err
+	}
+	return &RenderPipeline{
+		b: bp, layout: layout, samples: max(desc.SampleCount, 1),
+		kernel: kernelLayout([]*ShaderModule{desc.VertexModule, desc.FragmentModule}, []ShaderStage{StageVertex, StageFragment}),
+	}, nil
+}
+
+// BindGroupLayout returns the layout of bind group group of the pipeline,
+// given or derived, or nil if it has none.
+func (p *RenderPipeline) BindGroupLayout(group int) *BindGroupLayout {
+	return p.layout.group(group)
 }
 
+// Release frees the pipeline. The work recorded with it must have completed.
+func (p *RenderPipeline) Release() { p.b.release() }
+
 // LoadOp is what a render pass does with the target at the start.
 type LoadOp int
 
@@ -163,12 +441,34 @@ const (
 	PointList
 )
 
+// IndexFormat is the element type of an index buffer.
+type IndexFormat int
+
+const (
+	// IndexUint16 is 16-bit unsigned indices (2 bytes each).
+	IndexUint16 IndexFormat = iota
+	// IndexUint32 is 32-bit unsigned indices (4 bytes each).
+	IndexUint32
+)
+
+// size returns the size of one index in bytes.
+func (f IndexFormat) size() int {
+	if f == IndexUint32 {
+		return 4
+	}
+	return 2
+}
+
 // RenderPassDescriptor describes a render pass (single color attachment, optional
 // depth attachment).
 type RenderPassDescriptor struct {
 	ColorTexture *Texture
-	Load         LoadOp
-	ClearColor   [4]float64 // RGBA, used when Load == LoadClear
+	// ResolveTarget, if set, receives the average of each texel's samples of
+	// a multisampled ColorTexture when the pass ends. It is a single-sampled
+	// render target of the same format and size.
+	ResolveTarget *Texture
+	Load          LoadOp
+	ClearColor    [4]float64 // RGBA, used when Load == LoadClear
 	// ExtraColorTargets are color attachments 1..N (attachment 0 is ColorTexture).
 	// Each is cleared to its ClearColor when Load == LoadClear. Used for a G-buffer.
 	ExtraColorTargets []ColorTarget
@@ -176,63 +476,206 @@ type RenderPassDescriptor struct {
 	// defaults to 1.0 when zero). Nil for no depth.
 	DepthTexture *Texture
 	ClearDepth   float64
+	// TimestampWrites, if set, records when the pass begins and ends on the
+	// GPU.
+	TimestampWrites *PassTimestampWrites
+	// OcclusionQuerySet is the QueryOcclusion set that BeginOcclusionQuery
+	// indexes into.
+	OcclusionQuerySet *QuerySet
 }
 
 // ColorTarget is one color attachment of a render pass.
 type ColorTarget struct {
-	Texture    *Texture
-	ClearColor [4]float64
+	Texture *Texture
+	// ResolveTarget is as RenderPassDescriptor.ResolveTarget, for Texture.
+	ResolveTarget *Texture
+	ClearColor    [4]float64
 }
 
 // RenderPass encodes draw commands.
 type RenderPass struct {
-	e *CommandEncoder
+	e         *CommandEncoder
+	occlusion *QuerySet
+	query     int // index of the open occlusion query, or -1
+	samples   int // the attachments' sample count
 }
 
 // BeginRenderPass starts a render pass.
 func (e *CommandEncoder) BeginRenderPass(desc RenderPassDescriptor) *RenderPass {
+	samples := desc.ColorTexture.samples
 	info := renderPassInfo{
 		color:      desc.ColorTexture.b,
+		resolve:    checkResolve(desc.ColorTexture, desc.ResolveTarget),
 		load:       desc.Load,
 		clearColor: desc.ClearColor,
+		timestamps: desc.TimestampWrites.timestamps(),
+		samples:    samples,
 	}
 	for _, t := range desc.ExtraColorTargets {
-		info.extraColor = append(info.extraColor, renderColorTarget{tex: t.Texture.b, clear: t.ClearColor})
+		if t.Texture.samples != samples {
+			panic(fmt.Sprintf("gpu: render pass color attachments of %d and %d samples", samples, t.Texture.samples))
+		}
+		info.extraColor = append(info.extraColor, renderColorTarget{
+			tex: t.Texture.b, resolve: checkResolve(t.Texture, t.ResolveTarget), clear: t.ClearColor,
+		})
 	}
 	if desc.DepthTexture != nil {
+		if desc.DepthTexture.samples != samples {
+			panic(fmt.Sprintf("gpu: render pass depth attachment of %d samples with color of %d", desc.DepthTexture.samples, samples))
+		}
 		info.depth = desc.DepthTexture.b
 		info.clearDepth = desc.ClearDepth
 		if info.clearDepth == 0 {
 			info.clearDepth = 1
 		}
 	}
+	if q := desc.OcclusionQuerySet; q != nil {
+		if q.typ != QueryOcclusion {
+			panic(fmt.Sprintf("gpu: OcclusionQuerySet is a %v query set", q.typ))
+		}
+		info.occlusion = q.b
+	}
 	e.cmd.beginRender(info)
-	return &RenderPass{e: e}
+	return &RenderPass{e: e, occlusion: desc.OcclusionQuerySet, query: -1, samples: samples}
+}
+
+// checkResolve panics unless resolve, if set, can receive the samples of
+// color attachment t, and returns its backend texture.
+func checkResolve(t, resolve *Texture) backendTexture {
+	if resolve == nil {
+		return nil
+	}
+	switch {
+	case t.samples == 1:
+		panic("gpu: ResolveTarget of a single-sampled color attachment")
+	case resolve.samples != 1:
+		panic("gpu: ResolveTarget is multisampled")
+	case resolve.format != t.format || resolve.w != t.w || resolve.h != t.h:
+		panic(fmt.Sprintf("gpu: ResolveTarget %dx%d of format %d does not match its %dx%d attachment of format %d",
+			resolve.w, resolve.h, int(resolve.format), t.w, t.h, int(t.format)))
+	case !resolve.renderTarget:
+		panic("gpu: ResolveTarget is not a render target")
+	}
+	return resolve.b
+}
+
+// BeginOcclusionQuery starts occlusion query index of the pass's
+// OcclusionQuerySet: until EndOcclusionQuery, it records whether any sample
+// drawn passes the depth test. Queries do not nest, and each index is used
+// at most once per pass.
+func (p *RenderPass) BeginOcclusionQuery(index int) {
+	switch {
+	case p.occlusion == nil:
+		panic("gpu: BeginOcclusionQuery in a pass without an OcclusionQuerySet")
+	case p.query >= 0:
+		panic(fmt.Sprintf("gpu: BeginOcclusionQuery while occlusion query %d is open", p.query))
+	case index < 0 || index >= p.occlusion.count:
+		panic(fmt.Sprintf("gpu: occlusion query %d out of range of a set of %d", index, p.occlusion.count))
+	}
+	p.query = index
+	p.e.cmd.beginOcclusionQuery(index)
+}
+
+// EndOcclusionQuery ends the open occlusion query.
+func (p *RenderPass) EndOcclusionQuery() {
+	if p.query < 0 {
+		panic("gpu: EndOcclusionQuery without an open occlusion query")
+	}
+	p.query = -1
+	p.e.cmd.endOcclusionQuery()
 }
 
 // SetPipeline binds the render pipeline.
 func (p *RenderPass) SetPipeline(rp *RenderPipeline) {
-	p.e.cmd.setRenderPipeline(rp.b)
+	if rp.samples != p.samples {
+		panic(fmt.Sprintf("gpu: render pipeline of %d samples in a pass of %d", rp.samples, p.samples))
+	}
+	p.e.cmd.setRenderPipeline(rp.b, rp.kernel)
 }
 
 // SetBindGroup binds resources for the render stages.
 func (p *RenderPass) SetBindGroup(group int, bg *BindGroup) {
-	for _, e := range bg.entries {
-		p.e.cmd.setRenderBuffer(e.Buffer.b, 0, e.Binding)
+	for i, e := range bg.entries {
+		p.e.cmd.setRenderBuffer(e.Buffer.b, e.Offset, e.size(), e.Binding, bg.kinds[i])
 	}
 }
 
 // SetVertexBuffer binds a vertex buffer at the given index.
 func (p *RenderPass) SetVertexBuffer(index int, b *Buffer) {
-	p.e.cmd.setVertexBuffer(b.b, index)
+	p.SetVertexSlice(index, b.Slice(0, 0))
+}
+
+// SetVertexSlice binds the bytes of s, such as a BufferPool allocation, as
+// the vertex buffer at the given index. Vertex kernels read their vertex
+// buffers as storage, so s.Offset must be a multiple of the device's
+// MinStorageBufferOffsetAlignment.
+func (p *RenderPass) SetVertexSlice(index int, s BufferSlice) {
+	p.checkSlice("SetVertexSlice", s, p.e.d.caps.limits.MinStorageBufferOffsetAlignment)
+	p.e.cmd.setVertexBuffer(s.Buffer.b, s.Offset, s.Size, index)
+}
+
+// checkSlice panics unless s is a range of its buffer at a multiple of
+// align.
+func (p *RenderPass) checkSlice(op string, s BufferSlice, align int) {
+	switch {
+	case s.Buffer == nil:
+		panic(fmt.Sprintf("gpu: %s without a buffer", op))
+	case s.Offset < 0 || s.Size <= 0 || s.Offset+s.Size > s.Buffer.size:
+		panic(fmt.Sprintf("gpu: %s of range [%d, +%d) outside its %d-byte buffer", op, s.Offset, s.Size, s.Buffer.size))
+	case s.Offset%align != 0:
+		panic(fmt.Sprintf("gpu: %s offset %d is not a multiple of %d", op, s.Offset, align))
+	}
 }
 
 // Draw draws count vertices starting at start.
 func (p *RenderPass) Draw(prim Primitive, start, count int) {
-	p.e.cmd.draw(prim, start, count)
+	p.e.cmd.draw(prim, start, count, 0, 1)
+}
+
+// DrawInstanced draws instanceCount instances of count vertices starting at
+// start. The vertex shader sees the instance index (firstInstance upward) as
+// its instance id (the iid parameter of a //gpu:vertex kernel), which it uses
+// to read per-instance data from a vertex buffer.
+//
+// gl_InstanceID does not include a base instance, so the GL backend adds
+// firstInstance to it through a uniform of the vertex shader.
+func (p *RenderPass) DrawInstanced(prim Primitive, start, count, firstInstance, instanceCount int) {
+	p.e.cmd.draw(prim, start, count, firstInstance, instanceCount)
+}
+
+// SetIndexBuffer binds the index buffer (created with BufferIndex) that
+// subsequent DrawIndexed calls read, holding indices of the given format.
+func (p *RenderPass) SetIndexBuffer(b *Buffer, format IndexFormat) {
+	p.SetIndexSlice(b.Slice(0, 0), format)
+}
+
+// SetIndexSlice is SetIndexBuffer for the bytes of s, such as a BufferPool
+// allocation. s.Offset must be a multiple of the index size.
+func (p *RenderPass) SetIndexSlice(s BufferSlice, format IndexFormat) {
+	p.checkSlice("SetIndexSlice", s, format.size())
+	p.e.cmd.setIndexBuffer(s.Buffer.b, s.Offset, format)
+}
+
+// DrawIndexed draws indexCount vertices whose ids come from the bound index
+// buffer, starting at element firstIndex. baseVertex is added to every index
+// before the vertex shader sees it (as its vertex id), so several meshes can
+// share one set of vertex buffers. A GLES 3.1 context without the base
+// vertex extension cannot run a non-zero baseVertex; the submission reports
+// a validation *Error and does not run.
+func (p *RenderPass) DrawIndexed(prim Primitive, firstIndex, indexCount, baseVertex int) {
+	p.e.cmd.drawIndexed(prim, firstIndex, indexCount, baseVertex, 0, 1)
+}
+
+// DrawIndexedInstanced is DrawIndexed for instanceCount instances, with the
+// instance id as in DrawInstanced.
+func (p *RenderPass) DrawIndexedInstanced(prim Primitive, firstIndex, indexCount, baseVertex, firstInstance, instanceCount int) {
+	p.e.cmd.drawIndexed(prim, firstIndex, indexCount, baseVertex, firstInstance, instanceCount)
 }
 
 // End finishes the render pass.
 func (p *RenderPass) End() {
+	if p.query >= 0 {
+		panic(fmt.Sprintf("gpu: render pass ended with occlusion query %d open", p.query))
+	}
 	p.e.cmd.endRender()
 }
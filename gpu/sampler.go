@@ -0,0 +1,33 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import "fmt"
+
+// maxAnisotropy is the largest MaxAnisotropy a sampler takes effect with.
+const maxAnisotropy = 16
+
+// normalize checks desc and fills in its defaults: a LodMaxClamp of 32 and a
+// MaxAnisotropy of 1, clamped to maxAnisotropy.
+func (desc SamplerDescriptor) normalize() (SamplerDescriptor, error) {
+	if desc.LodMaxClamp == 0 {
+		desc.LodMaxClamp = 32
+	}
+	switch {
+	case desc.LodMinClamp < 0:
+		return desc, fmt.Errorf("gpu: sampler LodMinClamp %v is negative", desc.LodMinClamp)
+	case desc.LodMaxClamp < desc.LodMinClamp:
+		return desc, fmt.Errorf("gpu: sampler LodMaxClamp %v is below LodMinClamp %v", desc.LodMaxClamp, desc.LodMinClamp)
+	case desc.MaxAnisotropy < 0:
+		return desc, fmt.Errorf("gpu: sampler MaxAnisotropy %d is negative", desc.MaxAnisotropy)
+	case desc.Compare < CompareUndefined || desc.Compare > CompareAlways:
+		return desc, fmt.Errorf("gpu: unknown sampler compare function %d", int(desc.Compare))
+	}
+	desc.MaxAnisotropy = min(max(desc.MaxAnisotropy, 1), maxAnisotropy)
+	if desc.MaxAnisotropy > 1 && (desc.MinFilter != FilterLinear || desc.MagFilter != FilterLinear || desc.MipmapFilter != FilterLinear) {
+		return desc, fmt.Errorf("gpu: sampler MaxAnisotropy %d needs linear Min, Mag and Mipmap filters", desc.MaxAnisotropy)
+	}
+	return desc, nil
+}
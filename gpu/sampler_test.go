@@ -0,0 +1,53 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSamplerDescriptorNormalize checks the defaults NewSampler fills in and
+// the settings it rejects.
+func TestSamplerDescriptorNormalize(t *testing.T) {
+	trilinear := SamplerDescriptor{MinFilter: FilterLinear, MagFilter: FilterLinear, MipmapFilter: FilterLinear}
+	aniso := func(n int) SamplerDescriptor { d := trilinear; d.MaxAnisotropy = n; return d }
+	for _, c := range []struct {
+		desc       SamplerDescriptor
+		lodMax     float32
+		anisotropy int
+	}{
+		{SamplerDescriptor{}, 32, 1},
+		{SamplerDescriptor{LodMinClamp: 1, LodMaxClamp: 2}, 2, 1},
+		{aniso(8), 32, 8},
+		{aniso(64), 32, maxAnisotropy},
+		{SamplerDescriptor{Compare: CompareLess}, 32, 1},
+	} {
+		got, err := c.desc.normalize()
+		if err != nil {
+			t.Errorf("normalize(%+v): %v", c.desc, err)
+			continue
+		}
+		if got.LodMaxClamp != c.lodMax || got.MaxAnisotropy != c.anisotropy {
+			t.Errorf("normalize(%+v) = LodMaxClamp %v, MaxAnisotropy %d; want %v, %d",
+				c.desc, got.LodMaxClamp, got.MaxAnisotropy, c.lodMax, c.anisotropy)
+		}
+	}
+
+	for _, c := range []struct {
+		desc SamplerDescriptor
+		err  string
+	}{
+		{SamplerDescriptor{LodMinClamp: -1}, "negative"},
+		{SamplerDescriptor{LodMinClamp: 4, LodMaxClamp: 2}, "below LodMinClamp"},
+		{aniso(-1), "negative"},
+		{SamplerDescriptor{MaxAnisotropy: 4}, "linear"},
+		{SamplerDescriptor{Compare: CompareAlways + 1}, "compare function"},
+	} {
+		if _, err := c.desc.normalize(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("normalize(%+v) error = %v, want one mentioning %q", c.desc, err, c.err)
+		}
+	}
+}
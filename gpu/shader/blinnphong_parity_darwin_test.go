@@ -138,7 +138,10 @@ func runShade(t *testing.T, dev *gpu.Device, params []float32) []float32 {
 	}
 	inBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: len(params) * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst, Data: pbytes(params)})
 	outBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 4 * 4, Usage: gpu.BufferStorage | gpu.BufferMapRead})
-	bg := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: inBuf}, gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	bg, err := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: inBuf}, gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	if err != nil {
+		t.Fatal(err)
+	}
 	enc := dev.NewCommandEncoder()
 	cp := enc.BeginComputePass()
 	cp.SetPipeline(pipe)
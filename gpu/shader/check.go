@@ -0,0 +1,1415 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Type checking: before any target is emitted, compileAll checks every kernel
+// and helper body against the DSL's types. They are Go's, with the shader
+// operator overloads stock go/types would reject: + - * / between vectors of
+// one size or a vector and a float32, and Mat4 * Mat4, Mat4 * Vec4 and
+// Vec4 * Mat4. uint and uint32 (int and int32) are one 32-bit type. Untyped
+// constants convert as in Go, so 2 is a float32 next to a float32, but a
+// typed int never mixes with a float32 without a conversion. Every error
+// names the Go position it was found at.
+
+// Error is a compile error at a position in the Go source. The file is
+// kernel.go unless the source starts with a //line directive naming it.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+const (
+	untypedInt   = "untyped int"
+	untypedFloat = "untyped float"
+)
+
+// operand is the type of a checked expression and, for a constant, its value.
+// A call of a function without a result has the type ""; one of a helper with
+// several results has them as its tuple.
+type operand struct {
+	typ   string
+	val   constant.Value
+	tuple []operand
+}
+
+func (x operand) untyped() bool { return x.typ == untypedInt || x.typ == untypedFloat }
+
+// variable is a name in scope. Uniform parameters, textures and samplers are
+// read-only, and so are buffer and shared-array names (their elements are
+// not).
+type variable struct {
+	typ      string
+	readonly bool
+}
+
+type scope struct {
+	vars   map[string]variable
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (variable, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return variable{}, false
+}
+
+// jump is an enclosing for or switch statement, which break (and, for a
+// for, continue) may leave.
+type jump struct {
+	label *ast.Ident // nil if unlabeled
+	loop  bool
+	used  bool // a break or continue names the label
+}
+
+type checker struct {
+	fset    *token.FileSet
+	structs map[string]*ast.StructType
+	funcs   map[string]*ast.FuncDecl
+	scope   *scope
+	results []string // the checked function's result types
+	jumps   []*jump  // the enclosing fors and switches, innermost last
+	labels  map[string]bool
+	stageIn string // a fragment kernel's input parameter, whose fields Dfdx takes
+}
+
+// checkFuncs type-checks the kernels and the helpers they may call.
+func checkFuncs(fset *token.FileSet, kernels []*ast.FuncDecl, helpers map[string]*ast.FuncDecl, structs map[string]*ast.StructType, shared map[string]sharedVar) error {
+	globals := &scope{vars: map[string]variable{}}
+	for name, sv := range shared {
+		globals.vars[name] = variable{typ: sv.elem + "[]", readonly: true}
+	}
+	c := &checker{fset: fset, structs: structs, funcs: helpers}
+	for _, fn := range sortedFuncs(helpers) {
+		c.scope = &scope{vars: map[string]variable{}, parent: globals}
+		c.stageIn = ""
+		sig, err := helperSig(fn, structs)
+		if err != nil {
+			return c.errorf(fn, "func %s: %v", fn.Name.Name, err)
+		}
+		for i, p := range sig.params {
+			c.scope.vars[p.name] = variable{typ: sig.types[i]}
+		}
+		c.results = sig.results
+		if err := c.body(fn); err != nil {
+			return err
+		}
+	}
+	for _, fn := range kernels {
+		c.scope = &scope{vars: map[string]variable{}, parent: globals}
+		if err := c.kernelParams(fn); err != nil {
+			return err
+		}
+		if err := c.body(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedFuncs orders funcs as they appear in the source.
+func sortedFuncs(funcs map[string]*ast.FuncDecl) []*ast.FuncDecl {
+	list := make([]*ast.FuncDecl, 0, len(funcs))
+	for _, fn := range funcs {
+		list = append(list, fn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Pos() < list[j].Pos() })
+	return list
+}
+
+// body checks a function body, and that a function with a result ends in a
+// return.
+func (c *checker) body(fn *ast.FuncDecl) error {
+	c.labels = map[string]bool{}
+	if err := c.stmts(fn.Body.List); err != nil {
+		return err
+	}
+	if len(c.results) > 0 && !terminates(fn.Body.List) {
+		return c.errorAt(fn.Body.Rbrace, "missing return")
+	}
+	return nil
+}
+
+// terminates reports whether a statement list always ends in a return.
+func terminates(list []ast.Stmt) bool {
+	return len(list) > 0 && terminating(list[len(list)-1], "")
+}
+
+// terminating reports whether s always ends in a return, as Go defines it: a
+// for without a condition or a switch with a default count when no break
+// leaves them. label is the label of s, if any.
+func terminating(s ast.Stmt, label string) bool {
+	switch s := s.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BlockStmt:
+		return terminates(s.List)
+	case *ast.IfStmt:
+		return s.Else != nil && terminates(s.Body.List) && terminating(s.Else, "")
+	case *ast.LabeledStmt:
+		return terminating(s.Stmt, s.Label.Name)
+	case *ast.ForStmt:
+		return s.Cond == nil && !breaks(s.Body.List, label)
+	case *ast.SwitchStmt:
+		dflt := false
+		for _, cc := range s.Body.List {
+			cc := cc.(*ast.CaseClause)
+			if !terminates(cc.Body) || breaks(cc.Body, label) {
+				return false
+			}
+			dflt = dflt || cc.List == nil
+		}
+		return dflt
+	}
+	return false
+}
+
+// kernelParams declares a kernel's parameters the way the emitters bind
+// them: the ids first, then buffers, uniforms, textures and samplers.
+func (c *checker) kernelParams(fn *ast.FuncDecl) error {
+	stage := stageOf(fn.Doc)
+	params := flattenParams(fn.Type.Params)
+	c.stageIn = ""
+	declare := func(p param, typ string, readonly bool) {
+		c.scope.vars[p.name] = variable{typ: typ, readonly: readonly}
+	}
+	intParam := func(p param) (string, bool) {
+		t, ok := identType(p.typ)
+		if !ok || !isIntType(t) {
+			return "", false
+		}
+		mt, _ := goToMSLType(t)
+		return mt, true
+	}
+	if stage == StageCompute || stage == StageVertex {
+		if len(params) == 0 {
+			return c.errorf(fn.Type.Params, "kernel needs a leading id parameter")
+		}
+		t, ok := intParam(params[0])
+		if !ok {
+			return c.errorf(params[0].typ, "first parameter %q must be the int/uint id", params[0].name)
+		}
+		declare(params[0], t, false)
+		params = params[1:]
+	}
+	if stage == StageCompute {
+		var ids []param
+		ids, params = workgroupIDs(params)
+		for _, p := range ids {
+			t, _ := intParam(p)
+			declare(p, t, false)
+		}
+	}
+	if stage == StageVertex && len(params) > 0 {
+		if t, ok := intParam(params[0]); ok {
+			declare(params[0], t, false)
+			params = params[1:]
+		}
+	}
+	stageIn := stage == StageFragment
+	for _, p := range params {
+		switch t := p.typ.(type) {
+		case *ast.ArrayType:
+			elem, err := bufferElem(p, t, c.structs)
+			if err != nil {
+				return c.errorf(t, "%v", err)
+			}
+			declare(p, elem+"[]", true)
+			continue
+		case *ast.Ident:
+			switch t.Name {
+			case "Texture2D", "Texture2DArray", "TextureCube", "Texture3D", "TextureDepth2D", "Texture2DMS":
+				declare(p, textureTypes[t.Name], true)
+				continue
+			case "Sampler", "SamplerComparison":
+				declare(p, samplerTypes[t.Name], true)
+				continue
+			}
+			if _, ok := c.structs[t.Name]; ok {
+				// The first struct of a fragment kernel is its interpolated
+				// input, a value; later structs are uniforms.
+				declare(p, t.Name, !stageIn)
+				if stageIn {
+					c.stageIn = p.name
+				}
+				stageIn = false
+				continue
+			}
+			return c.errorf(t, "parameter %q: unsupported type %q", p.name, t.Name)
+		}
+		return c.errorf(p.typ, "parameter %q: unsupported parameter type", p.name)
+	}
+
+	c.results = nil
+	if stage != StageCompute {
+		res := fn.Type.Results
+		if res == nil || len(res.List) != 1 || len(res.List[0].Names) > 1 {
+			return c.errorf(fn.Type, "%s kernel must return exactly one value", stageName(stage))
+		}
+		t, err := valueType(res.List[0].Type, c.structs)
+		if err != nil {
+			return c.errorf(res.List[0].Type, "result: %v", err)
+		}
+		if stage == StageFragment && t != "float4" && !c.colors(t) {
+			return c.errorf(res.List[0].Type, "fragment kernel returns %s, not a Vec4 or a struct of Vec4 colors", goName(t))
+		}
+		c.results = []string{t}
+	} else if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
+		return c.errorf(fn.Type.Results, "compute kernels cannot return a value")
+	}
+	return nil
+}
+
+// colors reports whether a fragment kernel may return struct t: one Vec4
+// field per color target, none of them tagged.
+func (c *checker) colors(t string) bool {
+	st, ok := c.structs[t]
+	if !ok || len(st.Fields.List) == 0 {
+		return false
+	}
+	for _, f := range st.Fields.List {
+		if ft, _ := identType(f.Type); ft != "Vec4" || f.Tag != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) errorf(n ast.Node, format string, args ...any) error {
+	return c.errorAt(n.Pos(), format, args...)
+}
+
+func (c *checker) errorAt(pos token.Pos, format string, args ...any) error {
+	return &Error{Pos: c.fset.Position(pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+// push opens a block scope; the returned func closes it.
+func (c *checker) push() func() {
+	c.scope = &scope{vars: map[string]variable{}, parent: c.scope}
+	return func() { c.scope = c.scope.parent }
+}
+
+func (c *checker) stmts(list []ast.Stmt) error {
+	for _, s := range list {
+		if err := c.stmt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) stmt(s ast.Stmt) error {
+	switch st := s.(type) {
+	case *ast.AssignStmt:
+		return c.assign(st)
+	case *ast.DeclStmt:
+		return c.declStmt(st)
+	case *ast.IncDecStmt:
+		x, err := c.lvalue(st.X)
+		if err != nil {
+			return err
+		}
+		if !isNumeric(x.typ) {
+			return c.errorf(st, "invalid operation: %s%s (non-numeric type %s)", types.ExprString(st.X), st.Tok, goName(x.typ))
+		}
+		return nil
+	case *ast.BlockStmt:
+		defer c.push()()
+		return c.stmts(st.List)
+	case *ast.IfStmt:
+		defer c.push()()
+		if st.Init != nil {
+			if err := c.stmt(st.Init); err != nil {
+				return err
+			}
+		}
+		if err := c.cond(st.Cond, "if"); err != nil {
+			return err
+		}
+		if err := c.stmt(st.Body); err != nil {
+			return err
+		}
+		if st.Else != nil {
+			return c.stmt(st.Else)
+		}
+		return nil
+	case *ast.ForStmt:
+		return c.forStmt(st, nil)
+	case *ast.SwitchStmt:
+		return c.switchStmt(st, nil)
+	case *ast.LabeledStmt:
+		var err error
+		switch s := st.Stmt.(type) {
+		case *ast.ForStmt:
+			err = c.forStmt(s, st.Label)
+		case *ast.SwitchStmt:
+			err = c.switchStmt(s, st.Label)
+		default:
+			return c.errorf(st, "only for and switch statements may be labeled")
+		}
+		return err
+	case *ast.BranchStmt:
+		return c.branch(st)
+	case *ast.ExprStmt:
+		call, ok := st.X.(*ast.CallExpr)
+		if !ok {
+			return c.errorf(st, "%s is not used", types.ExprString(st.X))
+		}
+		_, err := c.call(call)
+		return err
+	case *ast.ReturnStmt:
+		if len(c.results) == 0 && len(st.Results) > 0 {
+			return c.errorf(st.Results[0], "too many return values")
+		}
+		xs, err := c.operands(st.Results, len(c.results))
+		if err != nil {
+			return err
+		}
+		if len(xs) != len(c.results) {
+			return c.errorf(st, "wrong number of return values (have %d, want %d)", len(xs), len(c.results))
+		}
+		for i, x := range xs {
+			if err := c.assignable(valueExpr(st.Results, i), x, c.results[i], "return statement"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.errorf(s, "unsupported statement %T", s)
+}
+
+// forStmt checks a for statement with the given label, if any.
+func (c *checker) forStmt(st *ast.ForStmt, label *ast.Ident) error {
+	defer c.push()()
+	if st.Init != nil {
+		if err := c.stmt(st.Init); err != nil {
+			return err
+		}
+	}
+	if st.Cond != nil {
+		if err := c.cond(st.Cond, "for"); err != nil {
+			return err
+		}
+	}
+	if st.Post != nil {
+		if err := c.stmt(st.Post); err != nil {
+			return err
+		}
+	}
+	return c.enter(&jump{label: label, loop: true}, func() error { return c.stmt(st.Body) })
+}
+
+// switchStmt checks an expression switch with the given label, if any. The
+// tag is compared to each case as with ==, so it is a number or a bool;
+// without one, every case is a condition.
+func (c *checker) switchStmt(st *ast.SwitchStmt, label *ast.Ident) error {
+	defer c.push()()
+	if st.Init != nil {
+		if err := c.stmt(st.Init); err != nil {
+			return err
+		}
+	}
+	tag := operand{typ: "bool"}
+	if st.Tag != nil {
+		x, err := c.expr(st.Tag)
+		if err != nil {
+			return err
+		}
+		tag.typ = defaultType(x.typ)
+		if !isNumeric(tag.typ) && tag.typ != "bool" {
+			return c.errorf(st.Tag, "cannot switch on %s (%s)", types.ExprString(st.Tag), goName(tag.typ))
+		}
+	}
+	return c.enter(&jump{label: label}, func() error {
+		var dflt *ast.CaseClause
+		for _, s := range st.Body.List {
+			cc := s.(*ast.CaseClause)
+			if cc.List == nil {
+				if dflt != nil {
+					return c.errorf(cc, "multiple defaults in switch")
+				}
+				dflt = cc
+			}
+			for _, e := range cc.List {
+				x, err := c.expr(e)
+				if err != nil {
+					return err
+				}
+				switch {
+				case st.Tag == nil && x.typ != "bool":
+					return c.errorf(e, "invalid case %s in switch (mismatched types %s and bool)", types.ExprString(e), goName(defaultType(x.typ)))
+				case x.untyped() && isNumeric(tag.typ):
+					if err := c.representable(e, x, tag.typ); err != nil {
+						return err
+					}
+				case x.typ != tag.typ:
+					return c.errorf(e, "invalid case %s in switch on %s (mismatched types %s and %s)", types.ExprString(e), types.ExprString(st.Tag), goName(defaultType(x.typ)), goName(tag.typ))
+				}
+			}
+			closeScope := c.push()
+			err := c.stmts(cc.Body)
+			closeScope()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// enter checks a for or switch body with j the innermost jump, then that a
+// label on it is used.
+func (c *checker) enter(j *jump, body func() error) error {
+	if j.label != nil {
+		if c.labels[j.label.Name] {
+			return c.errorf(j.label, "label %s already defined", j.label.Name)
+		}
+		c.labels[j.label.Name] = true
+	}
+	c.jumps = append(c.jumps, j)
+	err := body()
+	c.jumps = c.jumps[:len(c.jumps)-1]
+	if err == nil && j.label != nil && !j.used {
+		err = c.errorf(j.label, "label %s defined and not used", j.label.Name)
+	}
+	return err
+}
+
+// branch checks that a break or continue has a for or switch to leave.
+// Shaders have no goto, and a case cannot fall through.
+func (c *checker) branch(st *ast.BranchStmt) error {
+	switch st.Tok {
+	case token.FALLTHROUGH:
+		return c.errorf(st, "fallthrough is not supported; list the values in one case")
+	case token.GOTO:
+		return c.errorf(st, "goto is not supported")
+	}
+	cont := st.Tok == token.CONTINUE
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		j := c.jumps[i]
+		switch {
+		case st.Label != nil && (j.label == nil || j.label.Name != st.Label.Name):
+			continue
+		case st.Label != nil && cont && !j.loop:
+			return c.errorf(st.Label, "invalid continue label %s", st.Label.Name)
+		case st.Label == nil && cont && !j.loop:
+			continue
+		}
+		j.used = j.used || st.Label != nil
+		return nil
+	}
+	switch {
+	case st.Label != nil:
+		return c.errorf(st.Label, "invalid %s label %s", st.Tok, st.Label.Name)
+	case cont:
+		return c.errorf(st, "continue is not in a loop")
+	}
+	return c.errorf(st, "break is not in a loop or switch")
+}
+
+// cond checks the condition of an if or for statement.
+func (c *checker) cond(e ast.Expr, kind string) error {
+	x, err := c.expr(e)
+	if err != nil {
+		return err
+	}
+	if x.typ != "bool" {
+		return c.errorf(e, "non-boolean condition in %s statement", kind)
+	}
+	return nil
+}
+
+func (c *checker) assign(st *ast.AssignStmt) error {
+	rhs, err := c.operands(st.Rhs, len(st.Lhs))
+	if err != nil {
+		return err
+	}
+	if len(rhs) != len(st.Lhs) {
+		return c.errorf(st, "%s", mismatch(len(st.Lhs), st.Rhs, len(rhs)))
+	}
+	switch st.Tok {
+	case token.DEFINE:
+		fresh := false
+		for i, l := range st.Lhs {
+			id, ok := l.(*ast.Ident)
+			if !ok {
+				return c.errorf(l, "non-name %s on left side of :=", types.ExprString(l))
+			}
+			if id.Name == "_" {
+				continue
+			}
+			if v, ok := c.scope.vars[id.Name]; ok {
+				if err := c.assignable(valueExpr(st.Rhs, i), rhs[i], v.typ, "assignment"); err != nil {
+					return err
+				}
+				continue
+			}
+			fresh = true
+			c.scope.vars[id.Name] = variable{typ: defaultType(rhs[i].typ)}
+		}
+		if !fresh {
+			return c.errorf(st, "no new variables on left side of :=")
+		}
+		return nil
+	case token.ASSIGN:
+		for i, l := range st.Lhs {
+			if id, ok := l.(*ast.Ident); ok && id.Name == "_" {
+				continue
+			}
+			x, err := c.lvalue(l)
+			if err != nil {
+				return err
+			}
+			if err := c.assignable(valueExpr(st.Rhs, i), rhs[i], x.typ, "assignment"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// x op= y
+	x, err := c.lvalue(st.Lhs[0])
+	if err != nil {
+		return err
+	}
+	op := token.Token(int(st.Tok) - int(token.ADD_ASSIGN) + int(token.ADD))
+	r, err := c.arith(st, op, x, rhs[0])
+	if err != nil {
+		return err
+	}
+	if r.typ != x.typ {
+		return c.errorf(st, "cannot assign %s to %s (%s) in assignment", goName(r.typ), types.ExprString(st.Lhs[0]), goName(x.typ))
+	}
+	return nil
+}
+
+// operands checks exprs, the values of n variables or results: one value
+// each, or a single call of a helper with n results, whose tuple it returns.
+// The caller reports a count other than n.
+func (c *checker) operands(exprs []ast.Expr, n int) ([]operand, error) {
+	if len(exprs) == 1 && n > 1 {
+		if call, ok := exprs[0].(*ast.CallExpr); ok {
+			x, err := c.call(call)
+			if err != nil || x.tuple == nil {
+				return []operand{x}, err
+			}
+			return x.tuple, nil
+		}
+	}
+	xs := make([]operand, len(exprs))
+	for i, e := range exprs {
+		x, err := c.expr(e)
+		if err != nil {
+			return nil, err
+		}
+		xs[i] = x
+	}
+	return xs, nil
+}
+
+// valueExpr is the expression giving the i'th of the values exprs holds.
+func valueExpr(exprs []ast.Expr, i int) ast.Expr {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return exprs[i]
+}
+
+// mismatch describes assigning values values, from exprs, to n variables.
+func mismatch(n int, exprs []ast.Expr, values int) string {
+	if call, ok := exprs[0].(*ast.CallExpr); ok && len(exprs) == 1 {
+		s := "s"
+		if values == 1 {
+			s = ""
+		}
+		return fmt.Sprintf("assignment mismatch: %d variables but %s returns %d value%s", n, types.ExprString(call), values, s)
+	}
+	return fmt.Sprintf("assignment mismatch: %d variables but %d values", n, len(exprs))
+}
+
+// lvalue checks an assignment target: a local, a buffer or shared-array
+// element, or a field or component of one.
+func (c *checker) lvalue(e ast.Expr) (operand, error) {
+	switch l := e.(type) {
+	case *ast.Ident:
+		v, ok := c.scope.lookup(l.Name)
+		if !ok {
+			return operand{}, c.errorf(l, "undefined identifier %q", l.Name)
+		}
+		if v.readonly {
+			return operand{}, c.errorf(l, "cannot assign to %s (neither a local nor a buffer element)", l.Name)
+		}
+		return operand{typ: v.typ}, nil
+	case *ast.IndexExpr:
+		return c.expr(l)
+	case *ast.SelectorExpr:
+		if _, err := c.lvalue(l.X); err != nil {
+			return operand{}, err
+		}
+		return c.expr(l)
+	case *ast.ParenExpr:
+		return c.lvalue(l.X)
+	}
+	return operand{}, c.errorf(e, "cannot assign to %s", types.ExprString(e))
+}
+
+func (c *checker) declStmt(st *ast.DeclStmt) error {
+	gd, ok := st.Decl.(*ast.GenDecl)
+	if !ok || gd.Tok != token.VAR {
+		return c.errorf(st, "unsupported declaration")
+	}
+	for _, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		typ := ""
+		if vs.Type != nil {
+			t, err := valueType(vs.Type, c.structs)
+			if err != nil {
+				return c.errorf(vs.Type, "%v", err)
+			}
+			typ = t
+		}
+		var xs []operand
+		if len(vs.Values) > 0 {
+			var err error
+			if xs, err = c.operands(vs.Values, len(vs.Names)); err != nil {
+				return err
+			}
+			if len(xs) != len(vs.Names) {
+				return c.errorf(vs, "%s", mismatch(len(vs.Names), vs.Values, len(xs)))
+			}
+		}
+		for i, name := range vs.Names {
+			t := typ
+			if xs != nil {
+				if t == "" {
+					t = defaultType(xs[i].typ)
+				}
+				if err := c.assignable(valueExpr(vs.Values, i), xs[i], t, "variable declaration"); err != nil {
+					return err
+				}
+			}
+			if _, ok := c.scope.vars[name.Name]; ok {
+				return c.errorf(name, "%s redeclared in this block", name.Name)
+			}
+			c.scope.vars[name.Name] = variable{typ: t}
+		}
+	}
+	return nil
+}
+
+func (c *checker) expr(e ast.Expr) (operand, error) {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		if ex.Name == "true" || ex.Name == "false" {
+			return operand{typ: "bool", val: constant.MakeBool(ex.Name == "true")}, nil
+		}
+		v, ok := c.scope.lookup(ex.Name)
+		if !ok {
+			return operand{}, c.errorf(ex, "undefined identifier %q", ex.Name)
+		}
+		return operand{typ: v.typ}, nil
+	case *ast.BasicLit:
+		switch ex.Kind {
+		case token.INT:
+			return operand{typ: untypedInt, val: constant.MakeFromLiteral(ex.Value, ex.Kind, 0)}, nil
+		case token.FLOAT:
+			return operand{typ: untypedFloat, val: constant.MakeFromLiteral(ex.Value, ex.Kind, 0)}, nil
+		}
+		return operand{}, c.errorf(ex, "unsupported literal %s", ex.Value)
+	case *ast.ParenExpr:
+		return c.expr(ex.X)
+	case *ast.UnaryExpr:
+		return c.unary(ex)
+	case *ast.BinaryExpr:
+		return c.binary(ex)
+	case *ast.IndexExpr:
+		x, err := c.expr(ex.X)
+		if err != nil {
+			return operand{}, err
+		}
+		if err := c.index(ex.Index); err != nil {
+			return operand{}, err
+		}
+		switch {
+		case strings.HasSuffix(x.typ, "[]"):
+			return operand{typ: strings.TrimSuffix(x.typ, "[]")}, nil
+		case isVecType(x.typ):
+			return operand{typ: "float"}, nil
+		}
+		return operand{}, c.errorf(ex, "cannot index %s (%s)", types.ExprString(ex.X), goName(x.typ))
+	case *ast.SelectorExpr:
+		x, err := c.expr(ex.X)
+		if err != nil {
+			return operand{}, err
+		}
+		if t, ok := c.field(x.typ, ex.Sel.Name); ok {
+			return operand{typ: t}, nil
+		}
+		return operand{}, c.errorf(ex.Sel, "%s.%s undefined (type %s has no field %s)", types.ExprString(ex.X), ex.Sel.Name, goName(x.typ), ex.Sel.Name)
+	case *ast.CallExpr:
+		x, err := c.call(ex)
+		switch {
+		case err != nil:
+		case x.typ == "":
+			err = c.errorf(ex, "%s (no value) used as value", types.ExprString(ex))
+		case x.tuple != nil:
+			err = c.errorf(ex, "multiple-value %s (value of type %s) in single-value context", types.ExprString(ex), x.typ)
+		}
+		return x, err
+	case *ast.CompositeLit:
+		return c.compositeLit(ex)
+	}
+	return operand{}, c.errorf(e, "unsupported expression %T", e)
+}
+
+// index checks a buffer, shared-array or vector index.
+func (c *checker) index(e ast.Expr) error {
+	i, err := c.expr(e)
+	if err != nil {
+		return err
+	}
+	if i.typ == untypedInt || i.typ == untypedFloat && i.val != nil && isIntegral(i.val) {
+		if constant.Sign(i.val) < 0 {
+			return c.errorf(e, "invalid argument: index %s must not be negative", types.ExprString(e))
+		}
+		return nil
+	}
+	if !isIntType(i.typ) {
+		return c.errorf(e, "invalid argument: index %s (%s) must be integer", types.ExprString(e), goName(i.typ))
+	}
+	return nil
+}
+
+// field returns the type of a struct field or vector component (or swizzle)
+// of a value of type t.
+func (c *checker) field(t, name string) (string, bool) {
+	if st, ok := c.structs[t]; ok {
+		for _, f := range st.Fields.List {
+			for _, n := range f.Names {
+				if n.Name == name {
+					ft, _ := identType(f.Type)
+					if mt, ok := goToMSLType(ft); ok {
+						return mt, true
+					}
+					return ft, true
+				}
+			}
+		}
+		return "", false
+	}
+	n := vecLen(t)
+	sw := strings.ToLower(name)
+	if !isVecType(t) || !isSwizzle(sw) {
+		return "", false
+	}
+	for _, r := range sw {
+		if strings.IndexRune("xyzw", r) >= n {
+			return "", false
+		}
+	}
+	if len(sw) == 1 {
+		return "float", true
+	}
+	return fmt.Sprintf("float%d", len(sw)), true
+}
+
+func (c *checker) unary(ex *ast.UnaryExpr) (operand, error) {
+	x, err := c.expr(ex.X)
+	if err != nil {
+		return operand{}, err
+	}
+	ok := false
+	switch ex.Op {
+	case token.ADD, token.SUB:
+		ok = x.untyped() || isNumeric(x.typ) || isVecType(x.typ) || x.typ == "float4x4"
+	case token.NOT:
+		ok = x.typ == "bool"
+	case token.XOR:
+		ok = x.typ == untypedInt || isIntType(x.typ)
+	default:
+		return operand{}, c.errorf(ex, "unsupported operator %s", ex.Op)
+	}
+	if !ok {
+		return operand{}, c.errorf(ex, "invalid operation: operator %s not defined on %s (%s)", ex.Op, types.ExprString(ex.X), goName(x.typ))
+	}
+	if x.val != nil {
+		prec := uint(0)
+		if x.typ == "uint" {
+			prec = 32
+		}
+		x.val = constant.UnaryOp(ex.Op, x.val, prec)
+	}
+	return x, nil
+}
+
+func (c *checker) binary(ex *ast.BinaryExpr) (operand, error) {
+	x, err := c.expr(ex.X)
+	if err != nil {
+		return operand{}, err
+	}
+	y, err := c.expr(ex.Y)
+	if err != nil {
+		return operand{}, err
+	}
+	switch ex.Op {
+	case token.LAND, token.LOR:
+		if x.typ != "bool" || y.typ != "bool" {
+			return operand{}, c.errorf(ex, "invalid operation: operator %s not defined on %s (%s)", ex.Op, types.ExprString(ex.X), goName(x.typ))
+		}
+		return operand{typ: "bool"}, nil
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		t, err := c.match(ex, x, y)
+		if err != nil {
+			return operand{}, err
+		}
+		switch {
+		case t == "bool" && (ex.Op == token.EQL || ex.Op == token.NEQ):
+		case !isNumeric(t) && t != untypedInt && t != untypedFloat:
+			return operand{}, c.errorf(ex, "invalid operation: %s (cannot compare %s values)", types.ExprString(ex), goName(t))
+		}
+		r := operand{typ: "bool"}
+		if x.val != nil && y.val != nil {
+			r.val = constant.MakeBool(constant.Compare(x.val, ex.Op, y.val))
+		}
+		return r, nil
+	case token.SHL, token.SHR:
+		if !(x.typ == untypedInt || isIntType(x.typ)) || !(y.typ == untypedInt || isIntType(y.typ)) {
+			return operand{}, c.errorf(ex, "invalid operation: shift %s of non-integer operands", types.ExprString(ex))
+		}
+		r := operand{typ: x.typ}
+		if x.val != nil && y.val != nil {
+			s, _ := constant.Uint64Val(y.val)
+			r.val = constant.Shift(x.val, ex.Op, uint(s))
+		}
+		return r, nil
+	}
+	return c.arith(ex, ex.Op, x, y)
+}
+
+// arith checks the arithmetic or bitwise x op y.
+func (c *checker) arith(n ast.Node, op token.Token, x, y operand) (operand, error) {
+	bad := func() (operand, error) {
+		return operand{}, c.errorf(n, "invalid operation: %s (mismatched types %s and %s)", exprString(n), goName(x.typ), goName(y.typ))
+	}
+	mathOp := op == token.ADD || op == token.SUB || op == token.MUL || op == token.QUO
+	floatScalar := func(o operand) bool { return o.typ == "float" || o.untyped() }
+	switch {
+	case isVecType(x.typ) || isVecType(y.typ) || x.typ == "float4x4" || y.typ == "float4x4":
+		if !mathOp {
+			t := x.typ
+			if !isVecType(t) && t != "float4x4" {
+				t = y.typ
+			}
+			return operand{}, c.errorf(n, "invalid operation: operator %s not defined on %s", op, goName(t))
+		}
+		switch {
+		case x.typ == y.typ && (op != token.QUO || x.typ != "float4x4"):
+			return operand{typ: x.typ}, nil
+		case floatScalar(y) && (op != token.ADD && op != token.SUB || isVecType(x.typ)):
+			return operand{typ: x.typ}, nil
+		case floatScalar(x) && (op == token.MUL || isVecType(y.typ)):
+			return operand{typ: y.typ}, nil
+		case op == token.MUL && (x.typ == "float4x4" && y.typ == "float4" || x.typ == "float4" && y.typ == "float4x4"):
+			return operand{typ: "float4"}, nil
+		}
+		return bad()
+	case !(x.untyped() || isNumeric(x.typ)) || !(y.untyped() || isNumeric(y.typ)):
+		t := x.typ
+		if x.untyped() || isNumeric(x.typ) {
+			t = y.typ
+		}
+		return operand{}, c.errorf(n, "invalid operation: operator %s not defined on %s", op, goName(t))
+	}
+	t, err := c.match(n, x, y)
+	if err != nil {
+		return operand{}, err
+	}
+	intOnly := op == token.REM || op == token.AND || op == token.OR || op == token.XOR || op == token.AND_NOT
+	if intOnly && (t == "float" || t == untypedFloat) {
+		return operand{}, c.errorf(n, "invalid operation: operator %s not defined on %s", op, goName(t))
+	}
+	r := operand{typ: t}
+	if x.val != nil && y.val != nil {
+		if (op == token.QUO || op == token.REM) && constant.Sign(y.val) == 0 {
+			return operand{}, c.errorf(n, "invalid operation: division by zero")
+		}
+		if op == token.QUO && t != "float" && t != untypedFloat {
+			op = token.QUO_ASSIGN // integer division
+		}
+		r.val = constant.BinaryOp(x.val, op, y.val)
+	}
+	return r, nil
+}
+
+// match returns the common type of two scalar operands: their type if they
+// agree, the typed one's if the other is an untyped constant it can hold.
+func (c *checker) match(n ast.Node, x, y operand) (string, error) {
+	switch {
+	case x.typ == y.typ:
+		return x.typ, nil
+	case x.untyped() && y.untyped():
+		return untypedFloat, nil
+	case x.untyped() && isNumeric(y.typ):
+		return y.typ, c.representable(n, x, y.typ)
+	case y.untyped() && isNumeric(x.typ):
+		return x.typ, c.representable(n, y, x.typ)
+	}
+	return "", c.errorf(n, "invalid operation: %s (mismatched types %s and %s)", exprString(n), goName(x.typ), goName(y.typ))
+}
+
+// representable checks that the untyped x converts to the scalar type t.
+func (c *checker) representable(n ast.Node, x operand, t string) error {
+	if x.val == nil {
+		return nil
+	}
+	switch t {
+	case "int", "uint":
+		if !isIntegral(x.val) {
+			return c.errorf(n, "%s (untyped float constant) truncated to %s", x.val, goName(t))
+		}
+		v := constant.ToInt(x.val)
+		lo, hi := int64(math.MinInt32), int64(math.MaxInt32)
+		if t == "uint" {
+			lo, hi = 0, math.MaxUint32
+		}
+		if constant.Compare(v, token.LSS, constant.MakeInt64(lo)) || constant.Compare(v, token.GTR, constant.MakeInt64(hi)) {
+			return c.errorf(n, "%s overflows %s", x.val, goName(t))
+		}
+	}
+	return nil
+}
+
+// assignable checks that x, the value of e, can be stored in a t.
+func (c *checker) assignable(e ast.Expr, x operand, t, context string) error {
+	if x.typ == t {
+		return nil
+	}
+	if x.untyped() && isNumeric(t) {
+		return c.representable(e, x, t)
+	}
+	return c.errorf(e, "cannot use %s (%s) as %s value in %s", types.ExprString(e), goName(x.typ), goName(t), context)
+}
+
+func (c *checker) call(ex *ast.CallExpr) (operand, error) {
+	args := make([]operand, len(ex.Args))
+	for i, a := range ex.Args {
+		x, err := c.expr(a)
+		if err != nil {
+			return operand{}, err
+		}
+		if x.typ == "" {
+			return operand{}, c.errorf(a, "%s (no value) used as value", types.ExprString(a))
+		}
+		args[i] = x
+	}
+	if sel, ok := ex.Fun.(*ast.SelectorExpr); ok {
+		recv, err := c.expr(sel.X)
+		if err != nil {
+			return operand{}, err
+		}
+		return c.method(ex, sel, recv, args)
+	}
+	id, ok := ex.Fun.(*ast.Ident)
+	if !ok {
+		return operand{}, c.errorf(ex.Fun, "unsupported call target")
+	}
+	name := id.Name
+	argc := func(n int) error {
+		if len(args) != n {
+			return c.errorf(ex, "%s takes %d arguments, got %d", name, n, len(args))
+		}
+		return nil
+	}
+
+	if name == "WorkgroupBarrier" {
+		return operand{}, argc(0)
+	}
+	if atomicOps[name] != (atomicOp{}) {
+		if err := argc(3); err != nil {
+			return operand{}, err
+		}
+		if id, ok := ex.Args[0].(*ast.Ident); !ok || args[0].typ != "uint[]" {
+			return operand{}, c.errorf(ex.Args[0], "atomics update []uint32 buffers and shared arrays, not %q", types.ExprString(ex.Args[0]))
+		} else if _, isVar := c.scope.lookup(id.Name); !isVar {
+			return operand{}, c.errorf(id, "undefined identifier %q", id.Name)
+		}
+		if err := c.index(ex.Args[1]); err != nil {
+			return operand{}, err
+		}
+		return operand{typ: "uint"}, c.assignable(ex.Args[2], args[2], "uint", "argument to "+name)
+	}
+	if h, ok := c.funcs[name]; ok {
+		sig, err := helperSig(h, c.structs)
+		if err != nil {
+			return operand{}, c.errorf(ex, "%s: %v", name, err)
+		}
+		if err := argc(len(sig.types)); err != nil {
+			return operand{}, err
+		}
+		for i, a := range ex.Args {
+			if err := c.assignable(a, args[i], sig.types[i], "argument to "+name); err != nil {
+				return operand{}, err
+			}
+		}
+		if len(sig.results) > 1 {
+			x := operand{}
+			var names []string
+			for _, t := range sig.results {
+				x.tuple = append(x.tuple, operand{typ: t})
+				names = append(names, goName(t))
+			}
+			x.typ = "(" + strings.Join(names, ", ") + ")"
+			return x, nil
+		}
+		return operand{typ: sig.ret}, nil
+	}
+	if t, ok := vecCtor[name]; ok {
+		return c.construct(ex, name, t, ex.Args, args)
+	}
+	mt, ok := builtins[name]
+	if !ok {
+		return operand{}, c.errorf(ex.Fun, "call to %q is not in the builtin/conversion whitelist", name)
+	}
+	switch mt {
+	case "float", "int", "uint":
+		if err := argc(1); err != nil {
+			return operand{}, err
+		}
+		x := args[0]
+		if !x.untyped() && !isNumeric(x.typ) {
+			return operand{}, c.errorf(ex, "cannot convert %s (%s) to type %s", types.ExprString(ex.Args[0]), goName(x.typ), name)
+		}
+		if x.untyped() {
+			if err := c.representable(ex, x, mt); err != nil {
+				return operand{}, err
+			}
+		}
+		return operand{typ: mt, val: x.val}, nil
+	case "dfdx", "dfdy":
+		if err := argc(1); err != nil {
+			return operand{}, err
+		}
+		return c.derivative(ex, name, args[0])
+	}
+	return c.builtin(ex, name, mt, args)
+}
+
+// derivative checks Dfdx or Dfdy, which take a float field of a fragment
+// kernel's input other than its position: the rasterizer interpolates the
+// field at the neighbouring fragments, which the CPU target needs to compute
+// the difference.
+func (c *checker) derivative(ex *ast.CallExpr, name string, x operand) (operand, error) {
+	sel, ok := ex.Args[0].(*ast.SelectorExpr)
+	var id *ast.Ident
+	if ok {
+		id, ok = sel.X.(*ast.Ident)
+	}
+	if ok && c.stageIn != "" && id.Name == c.stageIn && (x.typ == "float" || isVecType(x.typ)) {
+		in, _ := c.scope.lookup(c.stageIn)
+		for _, f := range c.structs[in.typ].Fields.List {
+			for _, n := range f.Names {
+				if n.Name == sel.Sel.Name && !isPosition(f) {
+					return x, nil
+				}
+			}
+		}
+	}
+	return operand{}, c.errorf(ex.Args[0], "%s takes a float32 or vector field of the fragment kernel's input, not %s", name, types.ExprString(ex.Args[0]))
+}
+
+// isPosition reports whether struct field f is tagged gpu:"position".
+func isPosition(f *ast.Field) bool {
+	return f.Tag != nil && reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("gpu") == "position"
+}
+
+// builtin checks a call of a math builtin, mt being its MSL name.
+func (c *checker) builtin(ex *ast.CallExpr, name, mt string, args []operand) (operand, error) {
+	arity := map[string]int{
+		"min": 2, "max": 2, "pow": 2, "dot": 2, "cross": 2, "reflect": 2,
+		"clamp": 3, "mix": 3,
+	}[mt]
+	if arity == 0 {
+		arity = 1
+	}
+	if mt == "atan" && len(args) == 2 {
+		arity = 2
+	}
+	if len(args) != arity {
+		return operand{}, c.errorf(ex, "%s takes %d arguments, got %d", name, arity, len(args))
+	}
+	// Every argument shares the first typed argument's type, except mix's
+	// weight, which may also be a float32.
+	t := ""
+	for _, a := range args {
+		if !a.untyped() {
+			t = a.typ
+			break
+		}
+	}
+	if t == "" {
+		t = "float"
+	}
+	for i, a := range args {
+		if mt == "mix" && i == 2 && (a.typ == "float" || a.untyped()) {
+			continue
+		}
+		if err := c.assignable(ex.Args[i], a, t, "argument to "+name); err != nil {
+			return operand{}, err
+		}
+	}
+	switch {
+	case mt == "abs" || mt == "min" || mt == "max" || mt == "clamp":
+		if !isNumeric(t) && !isVecType(t) {
+			return operand{}, c.errorf(ex, "%s of %s", name, goName(t))
+		}
+	case mt == "dot" || mt == "normalize" || mt == "reflect":
+		if !isVecType(t) {
+			return operand{}, c.errorf(ex, "%s takes vectors, not %s", name, goName(t))
+		}
+	case mt == "cross":
+		if t != "float3" {
+			return operand{}, c.errorf(ex, "%s takes Vec3s, not %s", name, goName(t))
+		}
+	default:
+		if t != "float" && !isVecType(t) {
+			return operand{}, c.errorf(ex, "%s takes float32 or vector arguments, not %s", name, goName(t))
+		}
+	}
+	if mt == "dot" || mt == "length" {
+		return operand{typ: "float"}, nil
+	}
+	return operand{typ: t}, nil
+}
+
+// construct checks a vector or matrix constructor (V4(...), Vec4{...}): its
+// arguments are float32s and vectors whose components add up to the
+// result's, a Mat4's being four Vec4 columns.
+func (c *checker) construct(n ast.Node, name, t string, exprs []ast.Expr, args []operand) (operand, error) {
+	if t == "float4x4" {
+		if len(args) != 4 {
+			return operand{}, c.errorf(n, "%s takes 4 Vec4 columns, got %d arguments", name, len(args))
+		}
+		for i, a := range args {
+			if err := c.assignable(exprs[i], a, "float4", "argument to "+name); err != nil {
+				return operand{}, err
+			}
+		}
+		return operand{typ: t}, nil
+	}
+	count := 0
+	for i, a := range args {
+		switch {
+		case isVecType(a.typ):
+			count += vecLen(a.typ)
+		default:
+			if err := c.assignable(exprs[i], a, "float", "argument to "+name); err != nil {
+				return operand{}, err
+			}
+			count++
+		}
+	}
+	if count != vecLen(t) {
+		return operand{}, c.errorf(n, "%s needs %d components, got %d", name, vecLen(t), count)
+	}
+	return operand{typ: t}, nil
+}
+
+// method checks a gpumath vector or matrix method or a texture sample.
+func (c *checker) method(ex *ast.CallExpr, sel *ast.SelectorExpr, recv operand, args []operand) (operand, error) {
+	name := sel.Sel.Name
+	want := func(ts ...string) error {
+		if len(args) != len(ts) {
+			return c.errorf(ex, "%s takes %d arguments, got %d", name, len(ts), len(args))
+		}
+		for i, t := range ts {
+			if err := c.assignable(ex.Args[i], args[i], t, "argument to "+name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case textureCoords[recv.typ] != nil && recv.typ != "depth2d" && (name == "Sample" || name == "SampleLevel"):
+		ts := append([]string{"sampler"}, textureCoords[recv.typ]...)
+		if name == "SampleLevel" {
+			ts = append(ts, "float")
+		}
+		return operand{typ: "float4"}, want(ts...)
+	case recv.typ == "depth2d" && name == "SampleCompare":
+		return operand{typ: "float"}, want("sampler_comparison", "float2", "float")
+	case recv.typ == "texture2d_ms" && name == "Load":
+		return operand{typ: "float4"}, want("int", "int", "int")
+	case recv.typ == "float4x4" && name == "MulV":
+		return operand{typ: "float4"}, want("float4")
+	case isVecType(recv.typ):
+		switch name {
+		case "Add", "Sub", "Mul":
+			return recv, want(recv.typ)
+		case "Scale", "Div":
+			return recv, want("float")
+		case "Dot":
+			return operand{typ: "float"}, want(recv.typ)
+		case "Length":
+			return operand{typ: "float"}, want()
+		case "Normalize":
+			return recv, want()
+		}
+	}
+	return operand{}, c.errorf(sel.Sel, "unsupported method %q on %s", name, goName(recv.typ))
+}
+
+func (c *checker) compositeLit(ex *ast.CompositeLit) (operand, error) {
+	tname, ok := identType(ex.Type)
+	if !ok {
+		return operand{}, c.errorf(ex, "unsupported composite literal")
+	}
+	if mt, ok := goToMSLType(tname); ok && (isVecType(mt) || mt == "float4x4") {
+		args := make([]operand, len(ex.Elts))
+		for i, e := range ex.Elts {
+			if kv, ok := e.(*ast.KeyValueExpr); ok {
+				return operand{}, c.errorf(kv, "keyed %s literals are not supported; list all components", tname)
+			}
+			x, err := c.expr(e)
+			if err != nil {
+				return operand{}, err
+			}
+			args[i] = x
+		}
+		if len(args) == 0 {
+			return operand{typ: mt}, nil
+		}
+		return c.construct(ex, tname, mt, ex.Elts, args)
+	}
+	st, ok := c.structs[tname]
+	if !ok {
+		return operand{}, c.errorf(ex.Type, "unsupported composite type %q", tname)
+	}
+	var names []string
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	keyed := false
+	if len(ex.Elts) > 0 {
+		_, keyed = ex.Elts[0].(*ast.KeyValueExpr)
+	}
+	if !keyed && len(ex.Elts) > 0 && len(ex.Elts) != len(names) {
+		return operand{}, c.errorf(ex, "%s literal has %d values, want %d", tname, len(ex.Elts), len(names))
+	}
+	seen := map[string]bool{}
+	for i, e := range ex.Elts {
+		name, val := "", e
+		if kv, ok := e.(*ast.KeyValueExpr); ok != keyed {
+			return operand{}, c.errorf(e, "mixture of field:value and value elements in %s literal", tname)
+		} else if ok {
+			key, isID := kv.Key.(*ast.Ident)
+			if !isID {
+				return operand{}, c.errorf(kv.Key, "invalid field name %s in %s literal", types.ExprString(kv.Key), tname)
+			}
+			name, val = key.Name, kv.Value
+			if seen[name] {
+				return operand{}, c.errorf(kv.Key, "duplicate field name %s in %s literal", name, tname)
+			}
+			seen[name] = true
+		} else {
+			name = names[i]
+		}
+		ft, ok := c.field(tname, name)
+		if !ok {
+			return operand{}, c.errorf(e, "unknown field %s in %s literal", name, tname)
+		}
+		x, err := c.expr(val)
+		if err != nil {
+			return operand{}, err
+		}
+		if err := c.assignable(val, x, ft, "struct literal"); err != nil {
+			return operand{}, err
+		}
+	}
+	return operand{typ: tname}, nil
+}
+
+// defaultType is the type a variable declared from a value of type t takes.
+func defaultType(t string) string {
+	switch t {
+	case untypedInt:
+		return "int"
+	case untypedFloat:
+		return "float"
+	}
+	return t
+}
+
+func isNumeric(t string) bool { return t == "float" || t == "int" || t == "uint" }
+
+func isIntegral(v constant.Value) bool {
+	return constant.ToInt(v).Kind() == constant.Int
+}
+
+// goName spells a canonical type as kernel source does.
+func goName(t string) string {
+	switch t {
+	case "float":
+		return "float32"
+	case "float2":
+		return "Vec2"
+	case "float3":
+		return "Vec3"
+	case "float4":
+		return "Vec4"
+	case "float4x4":
+		return "Mat4"
+	case "texture2d":
+		return "Texture2D"
+	case "texture2d_array":
+		return "Texture2DArray"
+	case "texturecube":
+		return "TextureCube"
+	case "texture3d":
+		return "Texture3D"
+	case "depth2d":
+		return "TextureDepth2D"
+	case "texture2d_ms":
+		return "Texture2DMS"
+	case "sampler":
+		return "Sampler"
+	case "sampler_comparison":
+		return "SamplerComparison"
+	case "":
+		return "no value"
+	}
+	if strings.HasSuffix(t, "[]") {
+		return "[]" + goName(strings.TrimSuffix(t, "[]"))
+	}
+	return t
+}
+
+// exprString prints the expression an error is about; an op-assignment
+// prints whole.
+func exprString(n ast.Node) string {
+	switch n := n.(type) {
+	case ast.Expr:
+		return types.ExprString(n)
+	case *ast.AssignStmt:
+		return types.ExprString(n.Lhs[0]) + " " + n.Tok.String() + " " + types.ExprString(n.Rhs[0])
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"errors"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// TestCheckRejected checks the type errors every target reports, and the Go
+// position each names.
+func TestCheckRejected(t *testing.T) {
+	const head = `package k
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+type P struct {
+	Scale float32
+	N     uint32
+}
+`
+	// Line 8 of each source is the kernel's signature.
+	cases := []struct {
+		name, body, want string
+		line, col        int
+	}{
+		{"vector sizes", "\tv := Vec3{1, 2, 3}\n\tw := Vec4{1, 2, 3, 4}\n\tu := v + w\n", "mismatched types Vec3 and Vec4", 11, 7},
+		{"int and float", "\tn := 3\n\tout[gid] = out[gid] * n\n", "mismatched types float32 and int", 10, 13},
+		{"int and float assignment", "\tout[gid] = int(gid)\n", "cannot use int(gid) (int) as float32 value in assignment", 9, 13},
+		{"truncated constant", "\tn := int(gid) + 0.5\n", "0.5 (untyped float constant) truncated to int", 9, 7},
+		{"builtin arguments", "\tout[gid] = clamp(out[gid], 0.0)\n", "clamp takes 3 arguments, got 2", 9, 13},
+		{"builtin types", "\tout[gid] = dot(Vec3{1, 2, 3}, Vec4{1, 2, 3, 4})\n", "(Vec4) as Vec3 value in argument to dot", 9, 32},
+		{"constructor components", "\tv := V4(1, 2, 3)\n", "V4 needs 4 components, got 3", 9, 7},
+		{"helper arguments", "\tout[gid] = half(1, 2)\n", "half takes 1 arguments, got 2", 9, 13},
+		{"helper argument type", "\tout[gid] = half(Vec4{})\n", "cannot use Vec4{} (Vec4) as float32 value in argument to half", 9, 18},
+		{"no such field", "\tout[gid] = p.Scal\n", "p.Scal undefined (type P has no field Scal)", 9, 15},
+		{"no such component", "\tv := Vec3{1, 2, 3}\n\tout[gid] = v.W\n", "v.W undefined (type Vec3 has no field W)", 10, 15},
+		{"uniform write", "\tp.Scale = 2\n", "cannot assign to p", 9, 2},
+		{"condition", "\tif p.N {\n\t\tout[gid] = 0\n\t}\n", "non-boolean condition in if statement", 9, 5},
+		{"float remainder", "\tout[gid] = out[gid] % 2\n", "operator % not defined on float32", 9, 13},
+		{"out of scope", "\tif p.N > 0 {\n\t\tx := 1.0\n\t}\n\tout[gid] = x\n", `undefined identifier "x"`, 12, 13},
+		{"no new variables", "\tx := 1.0\n\tx := 2.0\n", "no new variables on left side of :=", 10, 2},
+		{"fallthrough", "\tswitch p.N {\n\tcase 0:\n\t\tfallthrough\n\tdefault:\n\t}\n", "fallthrough is not supported", 11, 3},
+		{"case type", "\tswitch p.N {\n\tcase out[gid]:\n\t}\n", "invalid case out[gid] in switch on p.N (mismatched types float32 and uint)", 10, 7},
+		{"continue outside loop", "\tif p.N > 0 {\n\t\tcontinue\n\t}\n", "continue is not in a loop", 10, 3},
+		{"unknown label", "\tfor {\n\t\tbreak outer\n\t}\n", "invalid break label outer", 10, 9},
+		{"unused label", "L:\n\tfor {\n\t}\n", "label L defined and not used", 9, 1},
+		{"continue switch", "L:\n\tswitch p.N {\n\tcase 0:\n\t\tcontinue L\n\t}\n", "invalid continue label L", 12, 12},
+		{"multiple values", "\tout[gid] = split(1)\n", "multiple-value split(1) (value of type (float32, float32)) in single-value context", 9, 13},
+		{"assignment mismatch", "\ta, b, c := split(1)\n", "assignment mismatch: 3 variables but split(1) returns 2 values", 9, 2},
+		{"return count", "\treturn 1\n", "too many return values", 9, 9},
+	}
+	compilers := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL,
+	}
+	for _, tc := range cases {
+		src := head + "func K(gid uint, p P, out []float32) {\n" + tc.body + "}\n" +
+			"func half(x float32) float32 { return x / 2 }\n" +
+			"func split(x float32) (float32, float32) { return x, -x }\n"
+		for lang, compile := range compilers {
+			t.Run(tc.name+"/"+lang, func(t *testing.T) {
+				_, err := compile(src)
+				var e *Error
+				if !errors.As(err, &e) || !strings.Contains(e.Msg, tc.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+				}
+				if e.Pos.Filename != "kernel.go" || e.Pos.Line != tc.line || e.Pos.Column != tc.col {
+					t.Fatalf("error at %v, want kernel.go:%d:%d", e.Pos, tc.line, tc.col)
+				}
+			})
+		}
+	}
+}
+
+// TestCheckRejectedStages checks what the checker allows a fragment kernel
+// only: derivatives of its input's varyings, and colors as its result.
+func TestCheckRejectedStages(t *testing.T) {
+	const head = `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct {
+	Pos   Vec4 ` + "`gpu:\"position\"`" + `
+	Color Vec4
+}
+`
+	cases := []struct{ name, src, want string }{
+		{"derivative in compute", "func K(gid uint, out []Vec4) { out[gid] = Dfdx(out[gid]) }", "Dfdx takes a float32 or vector field of the fragment kernel's input, not out[gid]"},
+		{"derivative of a local", "//gpu:fragment\nfunc F(in VOut) Vec4 {\n\tc := in.Color\n\treturn Dfdy(c)\n}", "Dfdy takes a float32 or vector field of the fragment kernel's input, not c"},
+		{"derivative of the position", "//gpu:fragment\nfunc F(in VOut) Vec4 { return Dfdx(in.Pos) }", "not in.Pos"},
+		{"scalar color", "//gpu:fragment\nfunc F(in VOut) float32 { return in.Color.X }", "fragment kernel returns float32, not a Vec4 or a struct of Vec4 colors"},
+		{"varyings as colors", "//gpu:fragment\nfunc F(in VOut) VOut { return in }", "fragment kernel returns VOut"},
+	}
+	compilers := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL, "CPU": CompileCPU,
+	}
+	for _, tc := range cases {
+		for lang, compile := range compilers {
+			t.Run(tc.name+"/"+lang, func(t *testing.T) {
+				_, err := compile(head + tc.src + "\n")
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// TestCheckAccepted checks the DSL extensions of Go the checker allows: the
+// vector and matrix operators, swizzles, untyped constants and builtins
+// generic over float32 and vectors.
+func TestCheckAccepted(t *testing.T) {
+	const src = `package k
+type Vec2 struct{ X, Y float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+type Mat4 struct{ C0, C1, C2, C3 Vec4 }
+type P struct {
+	M Mat4
+	K uint32
+}
+func K(gid uint, p P, in []Vec4, out []float32) {
+	v := p.M * in[gid] * 2
+	v = v - 1 + 0.5*v/2
+	xy := v.XY + Vec2{1, 2}
+	s := dot(normalize(v), Vec4{0, 0, 1, 0}) + length(xy)
+	s = clamp(s, 0, 1) * mix(1.0, 2.0, 0.5)
+	m := mix(v, in[gid], s)
+	n := int(gid) % 3
+	if p.K > 2 && n >= 1 || !(s < 0.5) {
+		s += float32(n << 1)
+	}
+	out[gid] = s + m.W + V4(xy.X, 1, xy).Z
+}
+`
+	for lang, compile := range map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL,
+	} {
+		if _, err := compile(src); err != nil {
+			t.Errorf("%s: %v", lang, err)
+		}
+	}
+}
+
+// TestKernelLines checks that the line table maps generated lines back to
+// the Go statements, and that //line directives name the file.
+func TestKernelLines(t *testing.T) {
+	const src = `//line shade.go:20
+package k
+func K(gid uint, in []float32, out []float32) {
+	x := in[gid] * 2.0
+	if x > 1.0 {
+		x = 1.0
+	} else if x < 0.0 {
+		x = 0.0
+	}
+	out[gid] = x
+}
+`
+	for lang, compile := range map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "WGSL": CompileWGSL,
+	} {
+		ks, err := compile(src)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		k := ks["K"]
+		text := k.MSL + k.GLSL + k.WGSL
+		if strings.Contains(text, lineMark) {
+			t.Fatalf("%s: line marks left in:\n%s", lang, text)
+		}
+		lines := strings.Split(text, "\n")
+		if len(k.Lines) != len(lines)-1 {
+			t.Fatalf("%s: %d line table entries for %d lines", lang, len(k.Lines), len(lines)-1)
+		}
+		want := map[string]int{"x = 1.0;": 24, "} else ": 25, "x = 0.0;": 26, "= x;": 28}
+		for i, l := range lines[:len(lines)-1] {
+			for frag, line := range want {
+				if strings.Contains(l, frag) {
+					if p := k.Lines[i]; p.Filename != "shade.go" || p.Line != line {
+						t.Errorf("%s: line %d %q maps to %v, want shade.go:%d", lang, i+1, l, p, line)
+					}
+					delete(want, frag)
+				}
+			}
+			if strings.HasPrefix(l, "#") || strings.HasPrefix(l, "struct") {
+				if k.Lines[i] != (token.Position{}) {
+					t.Errorf("%s: declaration line %q maps to %v", lang, l, k.Lines[i])
+				}
+			}
+		}
+		if len(want) > 0 {
+			t.Errorf("%s: no lines for %v in:\n%s", lang, want, text)
+		}
+	}
+}
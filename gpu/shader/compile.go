@@ -4,23 +4,30 @@
 
 // Package shader is the Go→shader compiler for the GPU abstraction. It parses a
 // restricted subset of Go compute kernels and emits backend shading-language
-// source (MSL in this phase) plus the matching binding layout, so kernels are
-// authored in Go instead of hand-written per backend.
+// source (MSL, GLSL, WGSL), a SPIR-V binary or a Program the CPU runs (see
+// cpu.go), plus the matching binding layout, so kernels are authored in Go
+// instead of hand-written per backend.
 //
 // See specs/foundations/gpu-phase2-goshader.md and docs/gpu-abstraction.md §6b.
 //
 // Supported subset (compute, this phase): a kernel is a top-level func whose
 // first parameter is the thread id (an int/uint, conventionally named gid) and
-// whose remaining parameters are []float32 storage buffers or a struct-by-value
-// uniform. Bodies may use arithmetic, indexing, short/var declarations, for/if,
-// type conversions (uint/int/float32) and a whitelist of math builtins.
+// whose remaining parameters are storage buffers or a struct-by-value uniform.
+// A buffer is a slice of float32, uint32, int32, a vector or matrix type, or a
+// kernel struct of those (see layout.go and Layout for its byte layout). Bodies
+// may use arithmetic, indexing, short/var declarations, for/if/switch,
+// labeled break and continue, type conversions (uint/int/float32 and the
+// 32-bit spellings) and a whitelist of math builtins; lower.go rewrites the
+// statements shading languages lack before any target is emitted.
 //
-// Validation: bare identifiers in value position are resolved against the
-// kernel's parameter/local environment, so a typo or undefined reference is
-// reported ("undefined identifier") rather than silently emitted into the
-// generated MSL. Full go/types checking is deliberately not used: the DSL
-// overloads operators on vector/matrix struct types (e.g. m * v with m a Mat4),
-// which is not valid Go, so stock go/types would reject most real kernels.
+// Validation: every kernel and helper is type-checked before any target is
+// emitted (see check.go), so an undefined name, a Vec3 used as a Vec4, an int
+// mixed with a float32 or a wrong argument count is reported as an *Error at
+// its file:line:col in the Go source rather than by the driver. Stock go/types
+// is deliberately not used: the DSL overloads operators on vector/matrix
+// struct types (e.g. m * v with m a Mat4), which is not valid Go. Each text
+// kernel also carries a line table (Kernel.Lines) that maps driver compile
+// errors back to Go positions.
 package shader
 
 import (
@@ -28,7 +35,7 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"reflect"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -48,18 +55,43 @@ type Binding struct {
 	Index int
 	Name  string
 	Kind  BindingKind
+	// MinSize is the fewest bytes a buffer bound here must hold: one element
+	// of a []T storage buffer, the whole struct of a uniform. It is 0 for
+	// textures and samplers.
+	MinSize int
 }
 
 // Kernel is a compiled kernel (compute, vertex, or fragment). MSL is set by
-// Compile; GLSL is set by CompileGLSL. Bindings are per-target: the GLSL compute
-// emitter numbers storage buffers (SSBO) and uniform blocks (UBO) in separate
-// binding spaces, matching how a GL backend binds them.
+// Compile; GLSL is set by CompileGLSL; SPIRV is set by CompileSPIRV; WGSL is
+// set by CompileWGSL; CPU is set by CompileCPU and numbers its bindings as
+// MSL does. Bindings are per-target: the GLSL compute emitter numbers
+// storage buffers (SSBO) and uniform blocks (UBO) in separate binding spaces,
+// matching how a GL backend binds them, MSL and SPIR-V number all buffers in
+// one space, and WGSL numbers every resource, textures and samplers included,
+// in one @group(0) space. MSL and GLSL number textures and samplers in spaces
+// of their own; GLSL has no sampler objects, so a GLSL kernel must sample the
+// texture at index i with the sampler at index i.
+//
+// Workgroup is a compute kernel's workgroup size from its //gpu:workgroup
+// directive, zero without one. Pass it to gpu.ComputePipelineDescriptor so
+// the backend launches whole workgroups of that size.
+//
+// Lines maps the MSL, GLSL or WGSL back to the Go source: Lines[i] is the
+// position of the Go statement line i+1 was compiled from, or the zero
+// Position for a line no statement produced (a declaration, say). Pass it in
+// gpu.ShaderSource.Lines so driver compile errors name Go positions. SPIR-V
+// kernels have no line table.
 type Kernel struct {
-	Name     string
-	Stage    Stage
-	Bindings []Binding
-	MSL      string
-	GLSL     string
+	Name      string
+	Stage     Stage
+	Bindings  []Binding
+	Workgroup [3]int
+	MSL       string
+	GLSL      string
+	SPIRV     []byte
+	WGSL      string
+	CPU       *Program
+	Lines     []token.Position
 }
 
 // builtins maps allowed Go call targets to their MSL spelling.
@@ -73,6 +105,7 @@ var builtins = map[string]string{
 	"cross": "cross", "reflect": "reflect",
 	// type conversions
 	"float32": "float", "float": "float", "uint": "uint", "int": "int",
+	"uint32": "uint", "int32": "int",
 	// gpumath capitalized free functions (author-once kernels): same shader
 	// builtins, spelled to be valid exported Go. See gpu/shader/gpumath.
 	"Normalize": "normalize", "Dot": "dot", "Length": "length",
@@ -81,6 +114,9 @@ var builtins = map[string]string{
 	"Atan": "atan", "Asin": "asin", "Acos": "acos", "Exp": "exp", "Log": "log",
 	"Floor": "floor", "Ceil": "ceil", "Round": "round", "Fract": "fract",
 	"Clampf": "clamp", "Minf": "min", "Maxf": "max", "Absf": "abs",
+	// Screen-space derivatives of a fragment kernel's input field (see
+	// checker.derivative).
+	"Dfdx": "dfdx", "Dfdy": "dfdy",
 }
 
 // gpumath constructors map to a canonical (MSL-spelled) vector/matrix type; the
@@ -146,18 +182,29 @@ func stageOf(doc *ast.CommentGroup) Stage {
 // returning them keyed by function name. Struct types referenced as uniform
 // parameters are emitted into each kernel's MSL.
 func Compile(src string) (map[string]*Kernel, error) {
-	return compileAll(src, false)
+	return compileAll(src, targetMSL)
 }
 
 // CompileGLSL is like Compile but emits GLSL ES 3.10 compute source (Kernel.GLSL)
-// for the OpenGL ES backend. It supports compute kernels with []float32 storage
-// buffers and struct-by-value uniforms; vertex/fragment and texture/sampler
+// for the OpenGL ES backend. It supports compute kernels with storage buffers
+// and struct-by-value uniforms; vertex/fragment and texture/sampler
 // kernels are not yet supported and return an error.
 func CompileGLSL(src string) (map[string]*Kernel, error) {
-	return compileAll(src, true)
+	return compileAll(src, targetGLSL)
 }
 
-func compileAll(src string, glsl bool) (map[string]*Kernel, error) {
+// target is the shading language compileAll emits.
+type target int
+
+const (
+	targetMSL target = iota
+	targetGLSL
+	targetSPIRV
+	targetWGSL
+	targetCPU
+)
+
+func compileAll(src string, tgt target) (map[string]*Kernel, error) {
 	fset := token.NewFileSet()
 	file, err := parser.ParseFile(fset, "kernel.go", src, parser.ParseComments)
 	if err != nil {
@@ -165,14 +212,24 @@ func compileAll(src string, glsl bool) (map[string]*Kernel, error) {
 	}
 
 	structs := map[string]*ast.StructType{}
+	shared := map[string]sharedVar{}
 	var funcs []*ast.FuncDecl
 	for _, d := range file.Decls {
 		switch decl := d.(type) {
 		case *ast.GenDecl:
 			for _, s := range decl.Specs {
-				if ts, ok := s.(*ast.TypeSpec); ok {
-					if st, ok := ts.Type.(*ast.StructType); ok {
-						structs[ts.Name.Name] = st
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					if st, ok := s.Type.(*ast.StructType); ok {
+						structs[s.Name.Name] = st
+					}
+				case *ast.ValueSpec:
+					sv, ok, err := sharedDecl(s)
+					if err != nil {
+						return nil, fmt.Errorf("shader: %w", err)
+					}
+					if ok {
+						shared[sv.name] = sv
 					}
 				}
 			}
@@ -183,18 +240,54 @@ func compileAll(src string, glsl bool) (map[string]*Kernel, error) {
 		}
 	}
 
+	kernels, helpers, err := splitFuncs(funcs)
+	if err != nil {
+		return nil, fmt.Errorf("shader: %w", err)
+	}
+	if err := checkFuncs(fset, kernels, helpers, structs, shared); err != nil {
+		return nil, err
+	}
+	if err := lowerFuncs(kernels, helpers, structs); err != nil {
+		return nil, fmt.Errorf("shader: %w", err)
+	}
+
 	out := map[string]*Kernel{}
-	for _, fn := range funcs {
+	for _, fn := range kernels {
+		kernelErr := func(err error) error {
+			return &Error{Pos: fset.Position(fn.Pos()), Msg: fmt.Sprintf("kernel %s: %v", fn.Name.Name, err)}
+		}
+		if err := checkWorkgroup(fn, stageOf(fn.Doc), shared); err != nil {
+			return nil, kernelErr(err)
+		}
 		var k *Kernel
 		var err error
-		if glsl {
-			k, err = compileKernelGLSL(fn, structs)
-		} else {
-			k, err = compileKernel(fn, structs)
+		switch tgt {
+		case targetGLSL:
+			k, err = compileKernelGLSL(fn, structs, helpers, shared)
+		case targetSPIRV:
+			k, err = compileKernelSPIRV(fn, structs, helpers, shared)
+		case targetWGSL:
+			k, err = compileKernelWGSL(fn, structs, helpers, shared)
+		case targetCPU:
+			k, err = compileKernelCPU(fset, fn, structs, helpers, shared)
+		default:
+			k, err = compileKernel(fn, structs, helpers, shared)
 		}
 		if err != nil {
-			return nil, fmt.Errorf("shader: kernel %s: %w", fn.Name.Name, err)
+			return nil, kernelErr(err)
 		}
+		switch tgt {
+		case targetMSL:
+			k.MSL, k.Lines = lineTable(k.MSL, fset)
+		case targetGLSL:
+			k.GLSL, k.Lines = lineTable(k.GLSL, fset)
+		case targetWGSL:
+			k.WGSL, k.Lines = lineTable(k.WGSL, fset)
+		}
+		if size, ok, _ := workgroupSize(fn.Doc); ok {
+			k.Workgroup = size
+		}
+		bindingSizes(k, fn, structs)
 		out[k.Name] = k
 	}
 	return out, nil
@@ -202,9 +295,15 @@ func compileAll(src string, glsl bool) (map[string]*Kernel, error) {
 
 type compiler struct {
 	structs map[string]*ast.StructType
-	env     map[string]string // var name -> canonical (MSL-spelled) type
-	written map[string]bool   // buffer params written to (=> non-const)
-	glsl    bool              // emit GLSL type spellings instead of MSL
+	env     map[string]string        // var name -> canonical (MSL-spelled) type
+	written map[string]bool          // buffer params written to (=> non-const)
+	tgt     target                   // language emitted: MSL spellings unless GLSL or WGSL
+	stage   Stage                    // the kernel's stage (WGSL samples differ outside fragments)
+	funcs   map[string]*ast.FuncDecl // helper functions kernels may call
+	result  string                   // a helper's result type ("" in kernels)
+	atomic  map[string]bool          // buffers and shared arrays updated atomically
+	units   map[string]int           // GLSL texture and sampler params -> binding index
+	colors  string                   // the struct of a fragment kernel's colors, if it returns one
 	buf     strings.Builder
 }
 
@@ -218,13 +317,36 @@ var glslReserved = map[string]bool{
 	"bool": true, "vec2": true, "vec3": true, "vec4": true, "mat2": true,
 	"mat3": true, "mat4": true, "sampler2D": true, "highp": true, "lowp": true,
 	"mediump": true, "precision": true, "discard": true, "struct": true,
+	"sampler2DArray": true, "samplerCube": true, "sampler3D": true,
+	"sampler2DShadow": true, "texture": true, "textureLod": true,
+	"sampler2DMS": true, "texelFetch": true,
 }
 
+// textureTypes and samplerTypes map the kernel texture and sampler parameter
+// types to their canonical (MSL-spelled) types, and textureCoords lists what
+// a sample takes after the sampler for each: a 2D array's layer index
+// follows its coordinates. A color texture has Sample, and SampleLevel with
+// the mip level last; a depth texture has SampleCompare, with a comparison
+// sampler and the depth reference last, returning a float. A multisampled
+// texture is not sampled: its Load(x, y, sample) reads one sample of a texel.
+var (
+	textureTypes = map[string]string{
+		"Texture2D": "texture2d", "Texture2DArray": "texture2d_array",
+		"TextureCube": "texturecube", "Texture3D": "texture3d",
+		"TextureDepth2D": "depth2d", "Texture2DMS": "texture2d_ms",
+	}
+	samplerTypes  = map[string]string{"Sampler": "sampler", "SamplerComparison": "sampler_comparison"}
+	textureCoords = map[string][]string{
+		"texture2d": {"float2"}, "texture2d_array": {"float2", "int"},
+		"texturecube": {"float3"}, "texture3d": {"float3"}, "depth2d": {"float2"},
+	}
+)
+
 // name returns an identifier's spelling in the target language: identity for MSL
-// (so Metal output is byte-identical), reserved-word-mangled for GLSL. env keys
-// always use the original Go name; only emitted text is mangled.
+// (so Metal output is byte-identical), reserved-word-mangled for GLSL and WGSL.
+// env keys always use the original Go name; only emitted text is mangled.
 func (c *compiler) name(n string) string {
-	if c.glsl && glslReserved[n] {
+	if (c.tgt == targetGLSL && glslReserved[n]) || (c.tgt == targetWGSL && wgslReserved[n]) {
 		return n + "_"
 	}
 	return n
@@ -233,10 +355,14 @@ func (c *compiler) name(n string) string {
 // zero is the zero-initializer for a canonical (MSL-spelled) type. MSL accepts a
 // scalar 0 everywhere (`float4 v = 0;`, `float x = 0;`), but GLSL is strict: a
 // vector/matrix needs a constructor (`vec4(0.0)`) and a float needs a float
-// literal (`0.0`). Integers use `0` in both.
+// literal (`0.0`). Integers use `0` in both. WGSL spells every zero value as
+// the type's zero constructor (`vec4<f32>()`, `f32()`).
 func (c *compiler) zero(mt string) string {
-	if !c.glsl {
+	switch c.tgt {
+	case targetMSL:
 		return "0"
+	case targetWGSL:
+		return c.typ(mt) + "()"
 	}
 	switch {
 	case isVecType(mt) || mt == "float4x4":
@@ -250,10 +376,13 @@ func (c *compiler) zero(mt string) string {
 
 // typ maps a canonical (MSL-spelled) type to the target language's spelling. For
 // the MSL target it is the identity, so the Metal output stays byte-identical;
-// for GLSL it rewrites the vector/matrix/texture spellings.
+// for GLSL and WGSL it rewrites the vector/matrix/texture spellings.
 func (c *compiler) typ(t string) string {
-	if !c.glsl {
+	switch c.tgt {
+	case targetMSL:
 		return t
+	case targetWGSL:
+		return wgslType(t)
 	}
 	switch t {
 	case "float2":
@@ -266,6 +395,16 @@ func (c *compiler) typ(t string) string {
 		return "mat4"
 	case "texture2d":
 		return "sampler2D"
+	case "texture2d_array":
+		return "sampler2DArray"
+	case "texturecube":
+		return "samplerCube"
+	case "texture3d":
+		return "sampler3D"
+	case "depth2d":
+		return "sampler2DShadow"
+	case "texture2d_ms":
+		return "sampler2DMS"
 	default:
 		return t // float, int, uint, and struct names are spelled the same
 	}
@@ -292,28 +431,16 @@ func isSwizzle(s string) bool {
 	return true
 }
 
-func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kernel, error) {
+func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType, funcs map[string]*ast.FuncDecl, shared map[string]sharedVar) (*Kernel, error) {
 	stage := stageOf(fn.Doc)
 	params := flattenParams(fn.Type.Params)
+	helpers, err := helpersOf(fn, funcs)
+	if err != nil {
+		return nil, err
+	}
 
-	c := &compiler{structs: structs, env: map[string]string{}, written: map[string]bool{}}
-
-	// First pass: detect which buffer params are written (appear on the LHS of
-	// an index assignment), so reads stay const.
-	ast.Inspect(fn.Body, func(n ast.Node) bool {
-		as, ok := n.(*ast.AssignStmt)
-		if !ok {
-			return true
-		}
-		for _, lhs := range as.Lhs {
-			if ix, ok := lhs.(*ast.IndexExpr); ok {
-				if id, ok := ix.X.(*ast.Ident); ok {
-					c.written[id.Name] = true
-				}
-			}
-		}
-		return true
-	})
+	// Buffers the kernel never stores to stay const.
+	c := &compiler{structs: structs, env: map[string]string{}, written: writtenParams(fn.Body), funcs: funcs, atomic: atomicTargets(fn.Body)}
 
 	// compute and vertex kernels take a leading id parameter
 	// (thread_position_in_grid / vertex_id); fragment kernels do not.
@@ -333,9 +460,27 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 		idName = gid.name
 		bufParams = params[1:]
 	}
+	// A compute kernel may take the invocation's index in its workgroup and
+	// the workgroup's index next.
+	var wgIDs []param
+	if stage == StageCompute {
+		wgIDs, bufParams = workgroupIDs(bufParams)
+		for _, p := range wgIDs {
+			c.env[p.name] = "uint"
+		}
+	}
+	// A vertex kernel may take a second integer parameter, the instance id
+	// ([[instance_id]]) of an instanced draw.
+	var iidName string
+	if stage == StageVertex && len(bufParams) > 0 {
+		if t, ok := identType(bufParams[0].typ); ok && isIntType(t) {
+			iidName = bufParams[0].name
+			c.env[iidName] = "uint"
+			bufParams = bufParams[1:]
+		}
+	}
 
 	var bindings []Binding
-	var usedStructs []string
 	bufIndex := 0
 	texIndex := 0
 	samplerIndex := 0
@@ -343,39 +488,37 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 	var sig []string
 	for _, p := range bufParams {
 		switch t := p.typ.(type) {
-		case *ast.ArrayType: // []float32 storage buffer
-			if t.Len != nil {
-				return nil, fmt.Errorf("parameter %q: only slices ([]float32) are supported as buffers", p.name)
-			}
-			elt, ok := identType(t.Elt)
-			if !ok {
-				return nil, fmt.Errorf("parameter %q: unsupported slice element", p.name)
-			}
-			mt, ok := goToMSLType(elt)
-			if !ok {
-				return nil, fmt.Errorf("parameter %q: unsupported slice element %q", p.name, elt)
+		case *ast.ArrayType: // []T storage buffer
+			mt, err := bufferElem(p, t, structs)
+			if err != nil {
+				return nil, err
 			}
 			qual := "device "
-			if !c.written[p.name] {
+			if !c.written[p.name] && !c.atomic[p.name] {
 				qual += "const "
 			}
+			if c.atomic[p.name] {
+				mt = "atomic_uint"
+			}
 			sig = append(sig, fmt.Sprintf("%s%s* %s [[buffer(%d)]]", qual, mt, p.name, bufIndex))
+			mt = strings.TrimPrefix(mt, "atomic_")
 			bindings = append(bindings, Binding{Index: bufIndex, Name: p.name, Kind: StorageBuffer})
 			c.env[p.name] = mt + "*"
 			bufIndex++
 		case *ast.Ident:
 			// Texture / sampler params use separate MSL index spaces.
 			switch t.Name {
-			case "Texture2D":
-				sig = append(sig, fmt.Sprintf("texture2d<float> %s [[texture(%d)]]", p.name, texIndex))
+			case "Texture2D", "Texture2DArray", "TextureCube", "Texture3D", "TextureDepth2D", "Texture2DMS":
+				tt := textureTypes[t.Name]
+				sig = append(sig, fmt.Sprintf("%s<float> %s [[texture(%d)]]", tt, p.name, texIndex))
 				bindings = append(bindings, Binding{Index: texIndex, Name: p.name, Kind: SampledTexture})
-				c.env[p.name] = "texture2d"
+				c.env[p.name] = tt
 				texIndex++
 				continue
-			case "Sampler":
+			case "Sampler", "SamplerComparison":
 				sig = append(sig, fmt.Sprintf("sampler %s [[sampler(%d)]]", p.name, samplerIndex))
 				bindings = append(bindings, Binding{Index: samplerIndex, Name: p.name, Kind: SamplerBinding})
-				c.env[p.name] = "sampler"
+				c.env[p.name] = samplerTypes[t.Name]
 				samplerIndex++
 				continue
 			}
@@ -384,7 +527,6 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 				return nil, fmt.Errorf("parameter %q: unsupported type %q", p.name, t.Name)
 			}
 			c.env[p.name] = t.Name
-			usedStructs = append(usedStructs, t.Name)
 			if stage == StageFragment && !stageInUsed {
 				// the first struct param of a fragment is the interpolated
 				// vertex output (varyings) delivered via stage_in
@@ -408,9 +550,22 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 		}
 		sig = append(sig, fmt.Sprintf("uint %s %s", idName, attr))
 	}
+	for i, p := range wgIDs {
+		attr := [2]string{"[[thread_index_in_threadgroup]]", "[[threadgroup_position_in_grid]]"}[i]
+		sig = append(sig, fmt.Sprintf("uint %s %s", p.name, attr))
+	}
+	if iidName != "" {
+		sig = append(sig, fmt.Sprintf("uint %s [[instance_id]]", iidName))
+	}
 
 	var body strings.Builder
-	bc := &compiler{structs: structs, env: c.env, written: c.written, buf: body}
+	bc := &compiler{structs: structs, env: c.env, written: c.written, funcs: funcs, atomic: c.atomic, buf: body}
+	// Threadgroup memory is declared in the kernel's scope.
+	for _, sv := range sharedOf(fn, shared) {
+		bc.indent(1)
+		bc.buf.WriteString(bc.sharedDeclText(sv) + "\n")
+		bc.env[sv.name] = sv.elem + "*"
+	}
 	if err := bc.stmts(fn.Body.List, 1); err != nil {
 		return nil, err
 	}
@@ -432,9 +587,12 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 			// built-in vector return (e.g. fragment float4)
 			ret = mt
 		} else if _, isStruct := structs[rt]; isStruct {
-			// vertex output struct (varyings + [[position]])
+			// vertex output struct (varyings + [[position]]), or a
+			// fragment's colors
 			ret = rt
-			usedStructs = append(usedStructs, rt)
+			if stage == StageFragment {
+				c.colors = rt
+			}
 		} else {
 			return nil, fmt.Errorf("unsupported return type %q", rt)
 		}
@@ -442,73 +600,87 @@ func compileKernel(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kerne
 
 	var msl strings.Builder
 	msl.WriteString("#include <metal_stdlib>\nusing namespace metal;\n\n")
-	for _, name := range usedStructs {
-		emitStruct(&msl, name, structs[name])
+	for _, name := range usedStructs(structs, append([]ast.Node{fn}, funcNodes(helpers)...)...) {
+		c.emitStruct(&msl, name, structs[name])
+	}
+	for _, h := range helpers {
+		if err := c.emitHelper(&msl, h); err != nil {
+			return nil, fmt.Errorf("func %s: %w", h.Name.Name, err)
+		}
 	}
 	fmt.Fprintf(&msl, "%s %s %s(%s) {\n%s}\n", kw, ret, fn.Name.Name, strings.Join(sig, ",\n    "), bc.buf.String())
 
 	return &Kernel{Name: fn.Name.Name, Stage: stage, Bindings: bindings, MSL: msl.String()}, nil
 }
 
-// compileKernelGLSL emits a GLSL ES 3.10 compute shader for fn. It reuses the
+// compileKernelGLSL emits a GLSL ES 3.10 shader for fn. It reuses the
 // shared body translation (compiler with glsl=true) but lays out resources the
 // GL way: storage buffers as std430 SSBO blocks, the uniform struct as a std140
 // UBO block, and the thread id from gl_GlobalInvocationID. The id is bound to an
 // int local (GLSL forbids mixing uint with int literals, which the kernels use
 // pervasively as in gid*4); explicit uint() conversions in the source still work.
-func compileKernelGLSL(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*Kernel, error) {
-	if stage := stageOf(fn.Doc); stage != StageCompute {
-		return nil, fmt.Errorf("GLSL backend supports compute kernels only (no vertex/fragment yet)")
-	}
+// A vertex or fragment kernel becomes a function main calls (see renderMain).
+func compileKernelGLSL(fn *ast.FuncDecl, structs map[string]*ast.StructType, funcs map[string]*ast.FuncDecl, shared map[string]sharedVar) (*Kernel, error) {
+	stage := stageOf(fn.Doc)
 	params := flattenParams(fn.Type.Params)
-	c := &compiler{structs: structs, env: map[string]string{}, written: map[string]bool{}, glsl: true}
+	helpers, err := helpersOf(fn, funcs)
+	if err != nil {
+		return nil, err
+	}
+	// Buffers the kernel never stores to stay readonly.
+	c := &compiler{structs: structs, env: map[string]string{}, written: writtenParams(fn.Body), tgt: targetGLSL, stage: stage, funcs: funcs, atomic: atomicTargets(fn.Body), units: map[string]int{}}
 
-	// First pass: which buffer params are written (so reads stay readonly).
-	ast.Inspect(fn.Body, func(n ast.Node) bool {
-		as, ok := n.(*ast.AssignStmt)
-		if !ok {
-			return true
+	// Compute and vertex kernels take a leading id parameter, and a vertex
+	// kernel may take the instance id next; fragment kernels take neither.
+	var ids []string
+	var wgIDs []param
+	if stage != StageFragment {
+		if len(params) == 0 {
+			return nil, fmt.Errorf("kernel needs a leading id parameter")
 		}
-		for _, lhs := range as.Lhs {
-			if ix, ok := lhs.(*ast.IndexExpr); ok {
-				if id, ok := ix.X.(*ast.Ident); ok {
-					c.written[id.Name] = true
-				}
-			}
+		gid := params[0]
+		gidType, ok := identType(gid.typ)
+		if !ok || !isIntType(gidType) {
+			return nil, fmt.Errorf("first parameter %q must be the int/uint id", gid.name)
 		}
-		return true
-	})
-
-	if len(params) == 0 {
-		return nil, fmt.Errorf("kernel needs a leading id parameter")
+		ids = append(ids, gid.name)
+		c.env[gid.name] = "int"
+		params = params[1:]
 	}
-	gid := params[0]
-	gidType, ok := identType(gid.typ)
-	if !ok || !isIntType(gidType) {
-		return nil, fmt.Errorf("first parameter %q must be the int/uint id", gid.name)
+	if stage == StageCompute {
+		// The workgroup ids keep their declared types; unlike the id, they
+		// were not used as ints before GLSL typed untyped constants.
+		wgIDs, params = workgroupIDs(params)
+		for _, p := range wgIDs {
+			t, _ := identType(p.typ)
+			c.env[p.name], _ = goToMSLType(t)
+		}
 	}
-	idName := gid.name
-	c.env[idName] = "int"
+	if stage == StageVertex && len(params) > 0 {
+		if t, ok := identType(params[0].typ); ok && isIntType(t) {
+			ids = append(ids, params[0].name)
+			c.env[params[0].name] = "int"
+			params = params[1:]
+		}
+	}
+	var stageIn *param // a fragment kernel's interpolated vertex output
 
 	var bindings []Binding
 	var decls []string
-	ssboIndex, uboIndex := 0, 0
-	for _, p := range params[1:] {
+	var elemStructs []string // structs stored in buffers, declared before them
+	ssboIndex, uboIndex, texIndex, samplerIndex := 0, 0, 0, 0
+	for _, p := range params {
 		switch t := p.typ.(type) {
-		case *ast.ArrayType: // []float32 -> std430 SSBO
-			if t.Len != nil {
-				return nil, fmt.Errorf("parameter %q: only slices ([]float32) are supported as buffers", p.name)
-			}
-			elt, ok := identType(t.Elt)
-			if !ok {
-				return nil, fmt.Errorf("parameter %q: unsupported slice element", p.name)
+		case *ast.ArrayType: // []T -> std430 SSBO
+			mt, err := bufferElem(p, t, structs)
+			if err != nil {
+				return nil, err
 			}
-			mt, ok := goToMSLType(elt)
-			if !ok {
-				return nil, fmt.Errorf("parameter %q: unsupported slice element %q", p.name, elt)
+			if _, ok := structs[mt]; ok {
+				elemStructs = append(elemStructs, mt)
 			}
 			qual := ""
-			if !c.written[p.name] {
+			if !c.written[p.name] && !c.atomic[p.name] {
 				qual = "readonly "
 			}
 			decls = append(decls, fmt.Sprintf("layout(std430, binding = %d) %sbuffer _ssbo%d { %s %s[]; };", ssboIndex, qual, ssboIndex, c.typ(mt), c.name(p.name)))
@@ -516,14 +688,35 @@ func compileKernelGLSL(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*K
 			c.env[p.name] = mt + "*"
 			ssboIndex++
 		case *ast.Ident:
+			// Textures and samplers number their own index spaces, as on
+			// Metal. GLSL has no separate sampler objects: a texture is a
+			// sampler uniform, and the GL backend applies the sampler bound
+			// at index i to the texture at index i (see sample).
 			switch t.Name {
-			case "Texture2D", "Sampler":
-				return nil, fmt.Errorf("parameter %q: GLSL backend does not support textures/samplers yet", p.name)
+			case "Texture2D", "Texture2DArray", "TextureCube", "Texture3D", "TextureDepth2D", "Texture2DMS":
+				tt := textureTypes[t.Name]
+				decls = append(decls, fmt.Sprintf("layout(binding = %d) uniform highp %s %s;", texIndex, c.typ(tt), c.name(p.name)))
+				bindings = append(bindings, Binding{Index: texIndex, Name: p.name, Kind: SampledTexture})
+				c.env[p.name] = tt
+				c.units[p.name] = texIndex
+				texIndex++
+				continue
+			case "Sampler", "SamplerComparison":
+				bindings = append(bindings, Binding{Index: samplerIndex, Name: p.name, Kind: SamplerBinding})
+				c.env[p.name] = samplerTypes[t.Name]
+				c.units[p.name] = samplerIndex
+				samplerIndex++
+				continue
 			}
 			st, ok := structs[t.Name]
 			if !ok {
 				return nil, fmt.Errorf("parameter %q: unsupported type %q", p.name, t.Name)
 			}
+			if stage == StageFragment && stageIn == nil {
+				stageIn = &p
+				c.env[p.name] = t.Name
+				continue
+			}
 			var fields []string
 			for _, f := range st.Fields.List {
 				ft, _ := identType(f.Type)
@@ -544,44 +737,224 @@ func compileKernelGLSL(fn *ast.FuncDecl, structs map[string]*ast.StructType) (*K
 		}
 	}
 
+	for _, sv := range sharedOf(fn, shared) {
+		decls = append(decls, c.sharedDeclText(sv))
+		c.env[sv.name] = sv.elem + "*"
+	}
+
 	var body strings.Builder
-	bc := &compiler{structs: structs, env: c.env, written: c.written, glsl: true, buf: body}
+	bc := &compiler{structs: structs, env: c.env, written: c.written, tgt: targetGLSL, funcs: funcs, atomic: c.atomic, units: c.units, buf: body}
 	if err := bc.stmts(fn.Body.List, 1); err != nil {
 		return nil, err
 	}
 
 	var src strings.Builder
-	src.WriteString("#version 310 es\nprecision highp float;\nlayout(local_size_x = 1) in;\n\n")
+	used := []ast.Node{fn.Body}
+	if stage == StageCompute {
+		size, _, _ := workgroupSize(fn.Doc)
+		local := fmt.Sprintf("local_size_x = %d", size[0])
+		if size[1] > 1 || size[2] > 1 {
+			local += fmt.Sprintf(", local_size_y = %d, local_size_z = %d", size[1], size[2])
+		}
+		fmt.Fprintf(&src, "#version 310 es\nprecision highp float;\nlayout(%s) in;\n\n", local)
+	} else {
+		// Fragment shaders have no default int precision.
+		src.WriteString("#version 310 es\nprecision highp float;\nprecision highp int;\n\n")
+		used[0] = fn // the stage structs may appear in the signature only
+	}
+	declared := map[string]bool{}
+	for _, name := range elemStructs {
+		if !declared[name] {
+			c.emitStruct(&src, name, structs[name])
+			declared[name] = true
+		}
+	}
 	for _, d := range decls {
 		src.WriteString(d + "\n")
 	}
-	src.WriteString("\nvoid main() {\n")
-	fmt.Fprintf(&src, "    int %s = int(gl_GlobalInvocationID.x);\n", c.name(idName))
+	// Uniform structs are declared as blocks above; the structs the body and
+	// helpers build as values need declarations of their own.
+	var names []string
+	for _, name := range usedStructs(structs, append(used, funcNodes(helpers)...)...) {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		src.WriteString("\n")
+		for _, name := range names {
+			c.emitStruct(&src, name, structs[name])
+		}
+	} else if len(helpers) > 0 {
+		src.WriteString("\n")
+	}
+	for _, h := range helpers {
+		if err := c.emitHelper(&src, h); err != nil {
+			return nil, fmt.Errorf("func %s: %w", h.Name.Name, err)
+		}
+	}
+	if len(helpers) == 0 {
+		src.WriteString("\n")
+	}
+	if stage != StageCompute {
+		if err := c.renderMain(&src, fn, stage, ids, stageIn, bc.buf.String()); err != nil {
+			return nil, err
+		}
+		return &Kernel{Name: fn.Name.Name, Stage: stage, Bindings: bindings, GLSL: src.String()}, nil
+	}
+	src.WriteString("void main() {\n")
+	fmt.Fprintf(&src, "    int %s = int(gl_GlobalInvocationID.x);\n", c.name(ids[0]))
+	for i, p := range wgIDs {
+		v := [2]string{"gl_LocalInvocationIndex", "gl_WorkGroupID.x"}[i]
+		if t := c.env[p.name]; t == "int" {
+			v = "int(" + v + ")"
+		}
+		fmt.Fprintf(&src, "    %s %s = %s;\n", c.typ(c.env[p.name]), c.name(p.name), v)
+	}
 	src.WriteString(bc.buf.String())
 	src.WriteString("}\n")
 
 	return &Kernel{Name: fn.Name.Name, Stage: StageCompute, Bindings: bindings, GLSL: src.String()}, nil
 }
 
-func emitStruct(w *strings.Builder, name string, st *ast.StructType) {
+// renderMain writes a vertex or fragment kernel as a GLSL function of its ids
+// or its stage-in struct, and the main that calls it. A vertex main copies the
+// result's `gpu:"position"` field to gl_Position, remapping the kernels' [0,1]
+// clip depth to GL's [-1,1], and its other fields to the varyings at the next
+// locations, integers flat. A fragment main rebuilds the stage-in struct from
+// gl_FragCoord and those varyings, and writes each color of the result to the
+// output at its location.
+func (c *compiler) renderMain(w *strings.Builder, fn *ast.FuncDecl, stage Stage, ids []string, stageIn *param, body string) error {
+	kw := map[Stage]string{StageVertex: "vertex", StageFragment: "fragment"}[stage]
+	if fn.Type.Results == nil || len(fn.Type.Results.List) != 1 {
+		return fmt.Errorf("%s kernel must return exactly one value", kw)
+	}
+	rt, _ := identType(fn.Type.Results.List[0].Type)
+	ret, ok := goToMSLType(rt)
+	if _, isStruct := c.structs[rt]; isStruct && !ok {
+		ret = rt
+	} else if ret != "float4" {
+		return fmt.Errorf("unsupported return type %q", rt)
+	}
+	// varyings lists the fields of st other than its position, in order.
+	varyings := func(st *ast.StructType) (pos string, fields []string, types []string) {
+		for _, f := range st.Fields.List {
+			ft, _ := identType(f.Type)
+			mt, ok := goToMSLType(ft)
+			if !ok {
+				mt = ft
+			}
+			for _, n := range f.Names {
+				if isPosition(f) {
+					pos = n.Name
+					continue
+				}
+				fields, types = append(fields, n.Name), append(types, mt)
+			}
+		}
+		return pos, fields, types
+	}
+	decl := func(dir string, i int, mt string) string {
+		flat := ""
+		if isIntType(mt) {
+			flat = "flat "
+		}
+		return fmt.Sprintf("layout(location = %d) %s%s %s gpu_Varying%d;\n", i, flat, dir, c.typ(mt), i)
+	}
+
+	var params, out []string
+	var in, call string
+	switch stage {
+	case StageVertex:
+		for _, id := range ids {
+			params = append(params, "int "+c.name(id))
+		}
+		call = strings.Join([]string{"gl_VertexID", "gl_InstanceID"}[:len(ids)], ", ")
+		pos := "gpu_out"
+		if ret != "float4" {
+			p, fields, types := varyings(c.structs[rt])
+			if p == "" {
+				return fmt.Errorf("struct %s: a vertex output needs a `gpu:\"position\"` field", rt)
+			}
+			pos += "." + p
+			for i, f := range fields {
+				w.WriteString(decl("out", i, types[i]))
+				out = append(out, fmt.Sprintf("gpu_Varying%d = gpu_out.%s;", i, f))
+			}
+		}
+		out = append(out, "gl_Position = "+pos+";", "gl_Position.z = 2.0 * gl_Position.z - gl_Position.w;")
+	case StageFragment:
+		if stageIn != nil {
+			t, _ := identType(stageIn.typ)
+			params = append(params, t+" "+c.name(stageIn.name))
+			p, fields, types := varyings(c.structs[t])
+			var vals []string
+			for _, f := range c.structs[t].Fields.List {
+				for _, n := range f.Names {
+					if n.Name == p {
+						vals = append(vals, "gl_FragCoord")
+						continue
+					}
+					i := slices.Index(fields, n.Name)
+					w.WriteString(decl("in", i, types[i]))
+					vals = append(vals, fmt.Sprintf("gpu_Varying%d", i))
+				}
+			}
+			call = "gpu_in"
+			in = fmt.Sprintf("    %s gpu_in = %s(%s);\n", t, t, strings.Join(vals, ", "))
+		}
+		if ret == "float4" {
+			w.WriteString("layout(location = 0) out vec4 gpu_Color0;\n")
+			out = append(out, "gpu_Color0 = gpu_out;")
+			break
+		}
+		i := 0
+		for _, f := range c.structs[rt].Fields.List {
+			for _, n := range f.Names {
+				fmt.Fprintf(w, "layout(location = %d) out vec4 gpu_Color%d;\n", i, i)
+				out = append(out, fmt.Sprintf("gpu_Color%d = gpu_out.%s;", i, n.Name))
+				i++
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%s %s(%s) {\n%s}\n\n", c.typ(ret), c.name(fn.Name.Name), strings.Join(params, ", "), body)
+	fmt.Fprintf(w, "void main() {\n%s    %s gpu_out = %s(%s);\n", in, c.typ(ret), c.name(fn.Name.Name), call)
+	for _, o := range out {
+		fmt.Fprintf(w, "    %s\n", o)
+	}
+	w.WriteString("}\n")
+	return nil
+}
+
+// emitStruct declares struct name in MSL or GLSL.
+func (c *compiler) emitStruct(w *strings.Builder, name string, st *ast.StructType) {
 	fmt.Fprintf(w, "struct %s {\n", name)
+	varyings := slices.ContainsFunc(st.Fields.List, isPosition)
+	color := 0
 	for _, f := range st.Fields.List {
 		ft, _ := identType(f.Type)
 		mt, ok := goToMSLType(ft)
 		if !ok {
 			mt = ft
 		}
-		// A `gpu:"position"` tag marks the clip-space position output.
+		// A `gpu:"position"` tag marks the clip-space position output, and
+		// the other fields of its struct are varyings, integers flat. The
+		// fields of the struct a fragment kernel returns are its colors.
 		attr := ""
-		if f.Tag != nil {
-			tag := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
-			switch tag.Get("gpu") {
-			case "position":
+		if c.tgt == targetMSL {
+			switch {
+			case isPosition(f):
 				attr = " [[position]]"
+			case varyings && isIntType(mt):
+				attr = " [[flat]]"
 			}
 		}
 		for _, n := range f.Names {
-			fmt.Fprintf(w, "    %s %s%s;\n", mt, n.Name, attr)
+			if c.tgt == targetMSL && name == c.colors {
+				attr = fmt.Sprintf(" [[color(%d)]]", color)
+				color++
+			}
+			fmt.Fprintf(w, "    %s %s%s;\n", c.typ(mt), n.Name, attr)
 		}
 	}
 	w.WriteString("};\n\n")
@@ -627,6 +1000,7 @@ func (c *compiler) stmts(list []ast.Stmt, depth int) error {
 }
 
 func (c *compiler) stmt(s ast.Stmt, depth int) error {
+	c.mark(s.Pos())
 	switch st := s.(type) {
 	case *ast.AssignStmt:
 		return c.assign(st, depth)
@@ -637,6 +1011,9 @@ func (c *compiler) stmt(s ast.Stmt, depth int) error {
 	case *ast.IfStmt:
 		return c.ifStmt(st, depth)
 	case *ast.IncDecStmt:
+		if name, ok := c.atomicElem(st.X); ok {
+			return fmt.Errorf("%s is updated atomically; use AtomicAddU32", name)
+		}
 		c.indent(depth)
 		e, err := c.expr(st.X)
 		if err != nil {
@@ -646,6 +1023,24 @@ func (c *compiler) stmt(s ast.Stmt, depth int) error {
 		return nil
 	case *ast.BlockStmt:
 		return c.stmts(st.List, depth)
+	case *ast.BranchStmt:
+		// Lowering leaves only unlabeled breaks and continues, each leaving
+		// the innermost loop.
+		c.indent(depth)
+		c.buf.WriteString(st.Tok.String() + ";\n")
+		return nil
+	case *ast.ExprStmt:
+		call, ok := st.X.(*ast.CallExpr)
+		if !ok {
+			return fmt.Errorf("unsupported expression statement")
+		}
+		v, err := c.call(call)
+		if err != nil {
+			return err
+		}
+		c.indent(depth)
+		c.buf.WriteString(v + ";\n")
+		return nil
 	case *ast.ReturnStmt:
 		c.indent(depth)
 		if len(st.Results) == 0 {
@@ -656,13 +1051,35 @@ func (c *compiler) stmt(s ast.Stmt, depth int) error {
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(&c.buf, "return %s;\n", v)
+		fmt.Fprintf(&c.buf, "return %s;\n", c.coerce(st.Results[0], v, c.result))
 		return nil
 	default:
 		return fmt.Errorf("unsupported statement %T", s)
 	}
 }
 
+// coerce spells v, the compiled e, as a value of canonical type t. Only GLSL
+// needs it: GLSL ES converts no int implicitly, so an untyped integer constant
+// passed, returned or assigned as a float or uint is wrapped in float() or
+// uint().
+func (c *compiler) coerce(e ast.Expr, v, t string) string {
+	if c.tgt == targetGLSL && (t == "float" || t == "uint") && isUntyped(e) && c.inferType(e) == "int" {
+		return t + "(" + v + ")"
+	}
+	return v
+}
+
+// atomicElem reports whether e is an element of an atomic buffer or shared
+// array, and which.
+func (c *compiler) atomicElem(e ast.Expr) (string, bool) {
+	if ix, ok := e.(*ast.IndexExpr); ok {
+		if id, ok := ix.X.(*ast.Ident); ok && c.atomic[id.Name] {
+			return id.Name, true
+		}
+	}
+	return "", false
+}
+
 func (c *compiler) assign(st *ast.AssignStmt, depth int) error {
 	if len(st.Lhs) != 1 || len(st.Rhs) != 1 {
 		return fmt.Errorf("only single assignments are supported")
@@ -682,13 +1099,42 @@ func (c *compiler) assign(st *ast.AssignStmt, depth int) error {
 		typ := c.inferType(st.Rhs[0])
 		c.env[id.Name] = typ
 		c.indent(depth)
+		if c.tgt == targetWGSL {
+			// WGSL infers the type from the initializer, as Go does.
+			fmt.Fprintf(&c.buf, "var %s = %s;\n", c.name(id.Name), rhs)
+			return nil
+		}
 		c.buf.WriteString(fmt.Sprintf("%s %s = %s;\n", c.typ(typ), c.name(id.Name), rhs))
 		return nil
 	}
+	if name, ok := c.atomicElem(st.Lhs[0]); ok {
+		if st.Tok != token.ASSIGN {
+			return fmt.Errorf("%s is updated atomically; use the Atomic intrinsics", name)
+		}
+		ix := st.Lhs[0].(*ast.IndexExpr)
+		idx, err := c.expr(ix.Index)
+		if err != nil {
+			return err
+		}
+		c.indent(depth)
+		fmt.Fprintf(&c.buf, "%s;\n", c.atomicStore(fmt.Sprintf("%s[%s]", c.name(name), idx), c.coerce(st.Rhs[0], rhs, "uint")))
+		return nil
+	}
 	lhs, err := c.expr(st.Lhs[0])
 	if err != nil {
 		return err
 	}
+	switch st.Tok {
+	case token.ASSIGN:
+		rhs = c.coerce(st.Rhs[0], rhs, c.inferType(st.Lhs[0]))
+	case token.SHL_ASSIGN, token.SHR_ASSIGN:
+	default:
+		// x op= 1 takes 1 as x's scalar type, as x op 1 does.
+		rhs = c.coerce(st.Rhs[0], rhs, scalarOf(c.inferType(st.Lhs[0])))
+	}
+	if c.tgt == targetWGSL && (st.Tok == token.SHL_ASSIGN || st.Tok == token.SHR_ASSIGN) {
+		rhs = "u32(" + rhs + ")" // WGSL shift counts are u32
+	}
 	c.indent(depth)
 	c.buf.WriteString(fmt.Sprintf("%s %s %s;\n", lhs, st.Tok.String(), rhs))
 	return nil
@@ -701,6 +1147,12 @@ func (c *compiler) declStmt(st *ast.DeclStmt, depth int) error {
 	}
 	for _, spec := range gd.Specs {
 		vs := spec.(*ast.ValueSpec)
+		if c.tgt == targetWGSL {
+			if err := c.varSpecWGSL(vs, depth); err != nil {
+				return err
+			}
+			continue
+		}
 		mt := "float"
 		if vs.Type != nil {
 			if gt, ok := identType(vs.Type); ok {
@@ -736,7 +1188,11 @@ func (c *compiler) forStmt(st *ast.ForStmt, depth int) error {
 		if err != nil {
 			return err
 		}
-		init = fmt.Sprintf("%s %s = %s", c.typ(typ), c.name(id.Name), v)
+		if c.tgt == targetWGSL {
+			init = fmt.Sprintf("var %s = %s", c.name(id.Name), v)
+		} else {
+			init = fmt.Sprintf("%s %s = %s", c.typ(typ), c.name(id.Name), v)
+		}
 	}
 	if st.Cond != nil {
 		v, err := c.expr(st.Cond)
@@ -745,12 +1201,32 @@ func (c *compiler) forStmt(st *ast.ForStmt, depth int) error {
 		}
 		cond = v
 	}
-	if ix, ok := st.Post.(*ast.IncDecStmt); ok {
-		v, err := c.expr(ix.X)
+	switch ps := st.Post.(type) {
+	case nil:
+	case *ast.IncDecStmt:
+		v, err := c.expr(ps.X)
 		if err != nil {
 			return err
 		}
-		post = v + ix.Tok.String()
+		post = v + ps.Tok.String()
+	case *ast.AssignStmt:
+		if ps.Tok == token.DEFINE || len(ps.Lhs) != 1 || len(ps.Rhs) != 1 {
+			return fmt.Errorf("unsupported loop post statement")
+		}
+		l, err := c.expr(ps.Lhs[0])
+		if err != nil {
+			return err
+		}
+		r, err := c.expr(ps.Rhs[0])
+		if err != nil {
+			return err
+		}
+		if ps.Tok == token.ASSIGN {
+			r = c.coerce(ps.Rhs[0], r, c.inferType(ps.Lhs[0]))
+		}
+		post = fmt.Sprintf("%s %s %s", l, ps.Tok, r)
+	default:
+		return fmt.Errorf("unsupported loop post statement")
 	}
 	c.indent(depth)
 	c.buf.WriteString(fmt.Sprintf("for (%s; %s; %s) {\n", init, cond, post))
@@ -785,6 +1261,7 @@ func (c *compiler) ifStmt(st *ast.IfStmt, depth int) error {
 		c.buf.WriteString("}\n")
 	case *ast.IfStmt: // else if
 		c.buf.WriteString("} else ")
+		c.mark(e.Pos())
 		return c.ifStmt(e, depth)
 	default:
 		return fmt.Errorf("unsupported else clause")
@@ -824,6 +1301,14 @@ func (c *compiler) expr(e ast.Expr) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if c.tgt == targetWGSL && (ex.Op == token.SHL || ex.Op == token.SHR) {
+			r = "u32(" + r + ")" // WGSL shift counts are u32
+		}
+		if ex.Op != token.SHL && ex.Op != token.SHR && ex.Op != token.LAND && ex.Op != token.LOR {
+			// An untyped constant takes the other operand's type, as in Go.
+			l = c.coerce(ex.X, l, c.inferType(ex.Y))
+			r = c.coerce(ex.Y, r, c.inferType(ex.X))
+		}
 		return fmt.Sprintf("(%s %s %s)", l, ex.Op.String(), r), nil
 	case *ast.IndexExpr:
 		base, err := c.expr(ex.X)
@@ -834,6 +1319,9 @@ func (c *compiler) expr(e ast.Expr) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if id, ok := ex.X.(*ast.Ident); ok && c.atomic[id.Name] {
+			return c.atomicLoad(fmt.Sprintf("%s[%s]", base, idx)), nil
+		}
 		return fmt.Sprintf("%s[%s]", base, idx), nil
 	case *ast.SelectorExpr:
 		base, err := c.expr(ex.X)
@@ -857,6 +1345,9 @@ func (c *compiler) expr(e ast.Expr) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if c.tgt == targetWGSL && ex.Op == token.XOR {
+			return "~" + v, nil // Go's bitwise complement
+		}
 		return ex.Op.String() + v, nil
 	}
 	return "", fmt.Errorf("unsupported expression %T", e)
@@ -885,10 +1376,15 @@ func (c *compiler) compositeLit(ex *ast.CompositeLit) (string, error) {
 	}
 
 	if st, isStruct := c.structs[tname]; isStruct {
-		var fieldNames []string
+		var fieldNames, fieldTypes []string
 		for _, f := range st.Fields.List {
+			ft, _ := identType(f.Type)
+			if mt, ok := goToMSLType(ft); ok {
+				ft = mt
+			}
 			for _, n := range f.Names {
 				fieldNames = append(fieldNames, n.Name)
+				fieldTypes = append(fieldTypes, ft)
 			}
 		}
 		keyed := map[string]string{}
@@ -901,30 +1397,41 @@ func (c *compiler) compositeLit(ex *ast.CompositeLit) (string, error) {
 				if err != nil {
 					return "", err
 				}
-				keyed[kv.Key.(*ast.Ident).Name] = v
+				name := kv.Key.(*ast.Ident).Name
+				if i := slices.Index(fieldNames, name); i >= 0 {
+					v = c.coerce(kv.Value, v, fieldTypes[i])
+				}
+				keyed[name] = v
 			} else {
 				v, err := c.expr(e)
 				if err != nil {
 					return "", err
 				}
+				if i := len(positional); i < len(fieldTypes) {
+					v = c.coerce(e, v, fieldTypes[i])
+				}
 				positional = append(positional, v)
 			}
 		}
 		var ordered []string
 		if isKeyed {
-			for _, fn := range fieldNames {
-				if v, ok := keyed[fn]; ok {
+			for i, fn := range fieldNames {
+				switch v, ok := keyed[fn]; {
+				case ok:
 					ordered = append(ordered, v)
-				} else {
+				case c.tgt == targetWGSL:
+					// WGSL does not convert 0 to a vector or struct.
+					ordered = append(ordered, c.zero(fieldTypes[i]))
+				default:
 					ordered = append(ordered, "0")
 				}
 			}
 		} else {
 			ordered = positional
 		}
-		// MSL builds a struct value with brace syntax (Name{...}); GLSL uses a
-		// constructor call (Name(...)).
-		if c.glsl {
+		// MSL builds a struct value with brace syntax (Name{...}); GLSL and
+		// WGSL use a constructor call (Name(...)).
+		if c.tgt != targetMSL {
 			return fmt.Sprintf("%s(%s)", tname, strings.Join(ordered, ", ")), nil
 		}
 		return fmt.Sprintf("%s{%s}", tname, strings.Join(ordered, ", ")), nil
@@ -975,9 +1482,10 @@ func (c *compiler) call(ex *ast.CallExpr) (string, error) {
 			return fmt.Sprintf("length(%s)", base), nil
 		case "Normalize":
 			return fmt.Sprintf("normalize(%s)", base), nil
-		case "Sample":
-			// Texture2D.Sample(samp, uv) -> tex.sample(...)
-			return fmt.Sprintf("%s.sample(%s)", base, strings.Join(args, ", ")), nil
+		case "Sample", "SampleLevel", "SampleCompare":
+			return c.sample(sel.X, ex.Args, base, args, name)
+		case "Load":
+			return c.load(base, args)
 		}
 		return "", fmt.Errorf("unsupported method %q", name)
 	}
@@ -986,6 +1494,27 @@ func (c *compiler) call(ex *ast.CallExpr) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("unsupported call target")
 	}
+	if v, ok, err := c.workgroupCall(id.Name, ex.Args); ok {
+		return v, err
+	}
+	if h, ok := c.funcs[id.Name]; ok {
+		if n := len(flattenParams(h.Type.Params)); len(ex.Args) != n {
+			return "", fmt.Errorf("%s takes %d arguments, got %d", id.Name, n, len(ex.Args))
+		}
+		sig, err := helperSig(h, c.structs)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", id.Name, err)
+		}
+		var args []string
+		for i, a := range ex.Args {
+			v, err := c.expr(a)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, c.coerce(a, v, sig.types[i]))
+		}
+		return fmt.Sprintf("%s(%s)", c.name(id.Name), strings.Join(args, ", ")), nil
+	}
 	// gpumath vector/matrix constructors: emit the target type's constructor
 	// (V4 -> float4 on MSL, vec4 on GLSL) via c.typ.
 	if mt, ok := vecCtor[id.Name]; ok {
@@ -1011,9 +1540,121 @@ func (c *compiler) call(ex *ast.CallExpr) (string, error) {
 		}
 		args = append(args, v)
 	}
+	switch {
+	case msl == "float" || msl == "int" || msl == "uint":
+		msl = c.typ(msl) // conversions are spelled f32/i32/u32 in WGSL
+	case msl == "atan" && len(args) == 2 && c.tgt == targetWGSL:
+		msl = "atan2"
+	case msl == "dfdx" || msl == "dfdy":
+		switch c.tgt {
+		case targetGLSL:
+			msl = "dF" + msl[2:]
+		case targetWGSL:
+			msl = "dp" + msl[2:]
+		}
+	}
 	return fmt.Sprintf("%s(%s)", msl, strings.Join(args, ", ")), nil
 }
 
+// sample emits a texture sample by method (Sample, SampleLevel or
+// SampleCompare): base is the texture tex, and args the sampler, the
+// coordinates, a 2D array's layer and the mip level or the depth reference,
+// as argExprs spell them in the source.
+func (c *compiler) sample(tex ast.Expr, argExprs []ast.Expr, base string, args []string, method string) (string, error) {
+	tt := c.inferType(tex)
+	n := 1 + len(textureCoords[tt])
+	if method != "Sample" {
+		n++
+	}
+	if len(args) != n {
+		return "", fmt.Errorf("%s.%s takes %d arguments, got %d", tt, method, n, len(args))
+	}
+	samp, coords := args[0], args[1]
+	var layer, lod, ref string
+	if tt == "texture2d_array" {
+		layer = args[2]
+	}
+	switch method {
+	case "SampleLevel":
+		lod = args[n-1]
+	case "SampleCompare":
+		ref = args[n-1]
+	}
+	switch c.tgt {
+	case targetGLSL:
+		t, ok1 := tex.(*ast.Ident)
+		s, ok2 := argExprs[0].(*ast.Ident)
+		if !ok1 || !ok2 {
+			return "", fmt.Errorf("GLSL samples a texture parameter with a sampler parameter")
+		}
+		if ti, si := c.units[t.Name], c.units[s.Name]; ti != si {
+			return "", fmt.Errorf("GLSL samples texture %s (index %d) with the sampler of its own index, not %s (index %d)", t.Name, ti, s.Name, si)
+		}
+		switch {
+		case layer != "":
+			coords = fmt.Sprintf("vec3(%s, float(%s))", coords, layer)
+		case ref != "":
+			// A shadow sampler takes the reference as the last coordinate.
+			coords = fmt.Sprintf("vec3(%s, float(%s))", coords, ref)
+		}
+		// A compute shader has no derivatives to pick a level from.
+		if lod == "" {
+			lod = "0.0"
+		}
+		return fmt.Sprintf("textureLod(%s, %s, float(%s))", base, coords, lod), nil
+	case targetWGSL:
+		parts := []string{base, samp, coords}
+		if layer != "" {
+			parts = append(parts, layer)
+		}
+		fn := "textureSample"
+		if ref != "" {
+			fn, parts = "textureSampleCompare", append(parts, ref)
+		}
+		if lod == "" {
+			// Implicit-LOD sampling is fragment-only in WGSL; other
+			// stages read the base level.
+			if c.stage == StageFragment {
+				return fmt.Sprintf("%s(%s)", fn, strings.Join(parts, ", ")), nil
+			}
+			if ref != "" {
+				return fmt.Sprintf("%sLevel(%s)", fn, strings.Join(parts, ", ")), nil
+			}
+			lod = "0.0"
+		}
+		return fmt.Sprintf("%sLevel(%s, %s)", fn, strings.Join(parts, ", "), lod), nil
+	}
+	// Texture2D.Sample(samp, uv) -> tex.sample(...)
+	fn := "sample"
+	parts := []string{samp, coords}
+	if layer != "" {
+		parts = append(parts, "uint("+layer+")")
+	}
+	if lod != "" {
+		parts = append(parts, "level("+lod+")")
+	}
+	if ref != "" {
+		fn, parts = "sample_compare", append(parts, ref)
+	}
+	return fmt.Sprintf("%s.%s(%s)", base, fn, strings.Join(parts, ", ")), nil
+}
+
+// load emits a multisampled texture's Load: args are the texel's x and y and
+// the sample index, read as stored, without filtering.
+func (c *compiler) load(base string, args []string) (string, error) {
+	if len(args) != 3 {
+		return "", fmt.Errorf("texture2d_ms.Load takes 3 arguments, got %d", len(args))
+	}
+	x, y, s := args[0], args[1], args[2]
+	switch c.tgt {
+	case targetGLSL:
+		return fmt.Sprintf("texelFetch(%s, ivec2(%s, %s), %s)", base, x, y, s), nil
+	case targetWGSL:
+		return fmt.Sprintf("textureLoad(%s, vec2<i32>(%s, %s), %s)", base, x, y, s), nil
+	}
+	return fmt.Sprintf("%s.read(uint2(%s, %s), uint(%s))", base, x, y, s), nil
+}
+
 // inferType returns the MSL type of an expression for declaration purposes.
 func (c *compiler) inferType(e ast.Expr) string {
 	switch ex := e.(type) {
@@ -1023,14 +1664,19 @@ func (c *compiler) inferType(e ast.Expr) string {
 		}
 		return "float"
 	case *ast.Ident:
+		if ex.Name == "true" || ex.Name == "false" {
+			return "bool"
+		}
 		if t, ok := c.env[ex.Name]; ok {
 			return strings.TrimSuffix(t, "*")
 		}
 	case *ast.CallExpr:
 		if sel, ok := ex.Fun.(*ast.SelectorExpr); ok {
 			switch sel.Sel.Name {
-			case "Sample":
-				return "float4" // Texture2D.Sample returns a float4
+			case "Sample", "SampleLevel", "Load":
+				return "float4" // texture samples and loads are float4
+			case "SampleCompare":
+				return "float"
 			case "Add", "Sub", "Mul", "Scale", "Div", "Normalize":
 				return c.inferType(sel.X) // vector-preserving: receiver's type
 			case "MulV":
@@ -1040,6 +1686,13 @@ func (c *compiler) inferType(e ast.Expr) string {
 			}
 		}
 		if id, ok := ex.Fun.(*ast.Ident); ok {
+			if h, ok := c.funcs[id.Name]; ok {
+				sig, _ := helperSig(h, c.structs)
+				return sig.ret
+			}
+			if _, ok := atomicOps[id.Name]; ok {
+				return "uint"
+			}
 			if mt, ok := goToMSLType(id.Name); ok {
 				return mt
 			}
@@ -1057,7 +1710,7 @@ func (c *compiler) inferType(e ast.Expr) string {
 			// vector-preserving builtins return their argument's type
 			switch id.Name {
 			case "normalize", "cross", "reflect", "min", "max", "clamp", "abs",
-				"Normalize", "Cross", "Reflect", "Mix":
+				"Normalize", "Cross", "Reflect", "Mix", "Dfdx", "Dfdy":
 				if len(ex.Args) > 0 {
 					return c.inferType(ex.Args[0])
 				}
@@ -1072,6 +1725,10 @@ func (c *compiler) inferType(e ast.Expr) string {
 			}
 		}
 	case *ast.BinaryExpr:
+		switch ex.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			return "bool"
+		}
 		lt := c.inferType(ex.X)
 		rt := c.inferType(ex.Y)
 		// a vector operand makes the result that vector type (vec op scalar)
@@ -1098,18 +1755,18 @@ func (c *compiler) inferType(e ast.Expr) string {
 			return tn // user struct
 		}
 	case *ast.SelectorExpr:
-		// struct field: look up field type
-		if base, ok := ex.X.(*ast.Ident); ok {
-			if sname, ok := c.env[base.Name]; ok {
-				if st, ok := c.structs[sname]; ok {
-					for _, f := range st.Fields.List {
-						for _, n := range f.Names {
-							if n.Name == ex.Sel.Name {
-								ft, _ := identType(f.Type)
-								if m, ok := goToMSLType(ft); ok {
-									return m
-								}
-							}
+		// struct field (of a local, a uniform or a buffer element): look up
+		// the field type
+		if st, ok := c.structs[c.inferType(ex.X)]; ok {
+			for _, f := range st.Fields.List {
+				for _, n := range f.Names {
+					if n.Name == ex.Sel.Name {
+						ft, _ := identType(f.Type)
+						if m, ok := goToMSLType(ft); ok {
+							return m
+						}
+						if _, ok := c.structs[ft]; ok {
+							return ft
 						}
 					}
 				}
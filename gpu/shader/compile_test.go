@@ -95,3 +95,187 @@ func K(gid int, a []float32) {
 		t.Fatal("expected error for goroutine in kernel, got nil")
 	}
 }
+
+func TestCompileInstanceID(t *testing.T) {
+	src := `package k
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+//gpu:vertex
+func VInst(vid uint, iid uint, pos []float32, off []float32) Vec4 {
+	return Vec4{pos[vid*2] + off[iid], pos[vid*2+1], 0, 1}
+}
+`
+	ks, err := Compile(src)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	k := ks["VInst"]
+	if len(k.Bindings) != 2 || k.Bindings[0].Name != "pos" || k.Bindings[1].Name != "off" {
+		t.Fatalf("VInst bindings = %+v, want pos, off", k.Bindings)
+	}
+	for _, want := range []string{
+		"device const float* pos [[buffer(0)]]",
+		"device const float* off [[buffer(1)]]",
+		"uint vid [[vertex_id]]",
+		"uint iid [[instance_id]]",
+	} {
+		if !strings.Contains(k.MSL, want) {
+			t.Fatalf("VInst MSL missing %q\n---\n%s", want, k.MSL)
+		}
+	}
+}
+
+func TestCompileTextureKinds(t *testing.T) {
+	src := `package k
+
+type Vec2 struct{ X, Y float32 }
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+
+func K(gid uint, layers Texture2DArray, sky TextureCube, vol Texture3D, samp Sampler, out []float32) {
+	a := layers.Sample(samp, Vec2{0.5, 0.5}, int(gid))
+	b := sky.SampleLevel(samp, Vec3{0, 1, 0}, 2.0)
+	c := vol.Sample(samp, Vec3{0.5, 0.5, 0.5})
+	out[gid] = a.X + b.Y + c.Z
+}
+`
+	ks, err := Compile(src)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	k := ks["K"]
+	for _, want := range []string{
+		"texture2d_array<float> layers [[texture(0)]]",
+		"texturecube<float> sky [[texture(1)]]",
+		"texture3d<float> vol [[texture(2)]]",
+		"layers.sample(samp, float2(0.5, 0.5), uint(int(gid)))",
+		"sky.sample(samp, float3(0, 1, 0), level(2.0))",
+		"vol.sample(samp, float3(0.5, 0.5, 0.5))",
+	} {
+		if !strings.Contains(k.MSL, want) {
+			t.Fatalf("K MSL missing %q\n---\n%s", want, k.MSL)
+		}
+	}
+
+	bad := `package k
+
+type Vec2 struct{ X, Y float32 }
+
+func K(gid uint, layers Texture2DArray, samp Sampler, out []float32) {
+	c := layers.Sample(samp, Vec2{0.5, 0.5})
+	out[gid] = c.X
+}
+`
+	if _, err := Compile(bad); err == nil {
+		t.Fatal("expected an error sampling a 2D array without a layer, got nil")
+	}
+}
+
+func TestCompileSampleCompare(t *testing.T) {
+	src := `package k
+
+type Vec2 struct{ X, Y float32 }
+
+func Shadow(gid uint, depth TextureDepth2D, cmp SamplerComparison, out []float32) {
+	out[gid] = depth.SampleCompare(cmp, Vec2{0.5, 0.5}, 0.25)
+}
+`
+	for _, c := range []struct {
+		name    string
+		compile func(string) (map[string]*Kernel, error)
+		src     func(*Kernel) string
+		want    []string
+	}{
+		{"MSL", Compile, func(k *Kernel) string { return k.MSL }, []string{
+			"depth2d<float> depth [[texture(0)]]",
+			"sampler cmp [[sampler(0)]]",
+			"depth.sample_compare(cmp, float2(0.5, 0.5), 0.25)",
+		}},
+		{"GLSL", CompileGLSL, func(k *Kernel) string { return k.GLSL }, []string{
+			"layout(binding = 0) uniform highp sampler2DShadow depth;",
+			"textureLod(depth, vec3(vec2(0.5, 0.5), float(0.25)), float(0.0))",
+		}},
+		{"WGSL", CompileWGSL, func(k *Kernel) string { return k.WGSL }, []string{
+			"var depth: texture_depth_2d;",
+			"var cmp: sampler_comparison;",
+			"textureSampleCompareLevel(depth, cmp, vec2<f32>(0.5, 0.5), 0.25)",
+		}},
+	} {
+		ks, err := c.compile(src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, want := range c.want {
+			if got := c.src(ks["Shadow"]); !strings.Contains(got, want) {
+				t.Errorf("%s missing %q\n---\n%s", c.name, want, got)
+			}
+		}
+	}
+
+	// A depth texture is only compared, with a comparison sampler.
+	for _, bad := range []string{
+		"out[gid] = depth.Sample(cmp, Vec2{0.5, 0.5}).X",
+		"out[gid] = depth.SampleCompare(samp, Vec2{0.5, 0.5}, 0.25)",
+	} {
+		src := "package k\ntype Vec2 struct{ X, Y float32 }\ntype Vec4 struct{ X, Y, Z, W float32 }\n" +
+			"func K(gid uint, depth TextureDepth2D, cmp SamplerComparison, samp Sampler, out []float32) {\n\t" + bad + "\n}\n"
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q): expected an error, got nil", bad)
+		}
+	}
+}
+
+func TestCompileTexture2DMSLoad(t *testing.T) {
+	src := `package k
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+func Samples(gid uint, tex Texture2DMS, out []float32) {
+	v := tex.Load(int(gid), 1, 3)
+	out[gid] = v.X
+}
+`
+	for _, c := range []struct {
+		name    string
+		compile func(string) (map[string]*Kernel, error)
+		src     func(*Kernel) string
+		want    []string
+	}{
+		{"MSL", Compile, func(k *Kernel) string { return k.MSL }, []string{
+			"texture2d_ms<float> tex [[texture(0)]]",
+			"tex.read(uint2(int(gid), 1), uint(3))",
+		}},
+		{"GLSL", CompileGLSL, func(k *Kernel) string { return k.GLSL }, []string{
+			"layout(binding = 0) uniform highp sampler2DMS tex;",
+			"texelFetch(tex, ivec2(int(gid), 1), 3)",
+		}},
+		{"WGSL", CompileWGSL, func(k *Kernel) string { return k.WGSL }, []string{
+			"var tex: texture_multisampled_2d<f32>;",
+			"textureLoad(tex, vec2<i32>(i32(gid), 1), 3)",
+		}},
+	} {
+		ks, err := c.compile(src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, want := range c.want {
+			if got := c.src(ks["Samples"]); !strings.Contains(got, want) {
+				t.Errorf("%s missing %q\n---\n%s", c.name, want, got)
+			}
+		}
+	}
+
+	// A multisampled texture is loaded with integer coordinates, not sampled.
+	for _, bad := range []string{
+		"out[gid] = tex.Sample(samp, Vec2{0.5, 0.5}).X",
+		"out[gid] = tex.Load(0.5, 1, 0).X",
+		"out[gid] = tex.Load(0, 1).X",
+	} {
+		src := "package k\ntype Vec2 struct{ X, Y float32 }\ntype Vec4 struct{ X, Y, Z, W float32 }\n" +
+			"func K(gid uint, tex Texture2DMS, samp Sampler, out []float32) {\n\t" + bad + "\n}\n"
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q): expected an error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"unsafe"
+
+	"poly.red/gpu/shader/gpumath"
+)
+
+// CompileCPU is like Compile but compiles each kernel to a Program
+// (Kernel.CPU) that runs on the CPU, for the software driver. Bindings are
+// numbered as Compile numbers them: buffers and uniforms in one space,
+// textures and samplers in spaces of their own.
+//
+// A Program runs the lowered kernel the way the targets do, with the
+// semantics of gpumath: float32 arithmetic, 32-bit integers that wrap,
+// WGSL's integer division by zero (x/0 is x, x%0 is 0) and shift counts
+// taken modulo 32. Buffer and shared-array accesses out of bounds read
+// zero and write nothing, as robust buffer access does. A uniform struct is
+// laid out as on Metal. Sample without a level reads level 0: the
+// derivatives Fragment takes serve Dfdx and Dfdy only.
+func CompileCPU(src string) (map[string]*Kernel, error) {
+	return compileAll(src, targetCPU)
+}
+
+// Program is a kernel compiled to run on the CPU. Bind it to the resources
+// its bindings name to run it.
+//
+// A Program keeps each invocation's values in a frame of 32-bit words laid
+// out as a storage buffer lays them out (a Vec3 takes four), so a buffer
+// element, a uniform and a local copy word for word. Every expression of the
+// kernel and its helpers owns words of the frame, assigned when it is
+// compiled, and helpers, which cannot recurse, have theirs too; running a
+// statement is calling the closure it was compiled to.
+type Program struct {
+	name      string
+	stage     Stage
+	body      cpuStmt
+	frame     []uint32 // a new frame: constants set, everything else zero
+	ids       [3]int   // frame words of the id, workgroup index (or instance id) and workgroup id; -1 if unused
+	nbufs     int
+	ntex      int
+	nsamp     int
+	bufNames  []string
+	texNames  []string
+	sampNames []string
+	shared    []int // the words of each shared array
+	barrier   bool  // the kernel uses workgroup features
+
+	ret      int    // frame words of a vertex or fragment kernel's result
+	retType  string // its type
+	colors   []int  // offsets of a fragment kernel's colors in its result
+	stageIn  int    // frame words of a fragment kernel's input struct, or -1
+	deriv    [2]int // frame words of its x and y derivatives, or -1 if unused
+	io       cpuIO  // the varyings the vertex kernel writes or the fragment kernel reads
+	position int    // offset of the position field in the io struct, or -1
+}
+
+// cpuIO is the layout of a vertex kernel's output struct or a fragment
+// kernel's input struct, its position field aside.
+type cpuIO struct {
+	words []int  // the struct word each varying float is at
+	flat  []bool // whether it is an integer, taken from one vertex
+}
+
+// Texture is a texture a Program reads. The software driver implements it;
+// coordinates, layers and levels are as the kernel passes them.
+type Texture interface {
+	// Sample filters the texture with s at coord, at mip level lod: coord
+	// is (u, v) for a 2D texture and a 2D array, whose layer is layer, the
+	// direction for a cube map and (u, v, w) for a 3D texture.
+	Sample(s Sampler, coord [3]float32, layer int, lod float32) [4]float32
+	// SampleCompare compares ref to the depth texels at coord with the
+	// comparison sampler s, and filters the results.
+	SampleCompare(s Sampler, coord [2]float32, ref float32) float32
+	// Load reads sample of texel (x, y) of a multisampled texture.
+	Load(x, y, sample int) [4]float32
+}
+
+// Sampler is a sampler a Program passes to a Texture.
+type Sampler any
+
+// Resources are what a Program binds, by binding index: the bytes of its
+// buffers and uniforms, which must be 4-byte aligned, and its textures and
+// samplers.
+type Resources struct {
+	Buffers  [][]byte
+	Textures []Texture
+	Samplers []Sampler
+}
+
+// Bound is a Program bound to its resources. Its methods may be called
+// concurrently.
+type Bound struct {
+	p      *Program
+	bufs   [][]uint32
+	tex    []Texture
+	samp   []Sampler
+	frames sync.Pool
+}
+
+// cpuInv is the state of one invocation.
+type cpuInv struct {
+	w      []uint32   // the frame
+	bufs   [][]uint32 // the buffers and uniforms, by binding
+	tex    []Texture
+	samp   []Sampler
+	shared [][]uint32 // the workgroup's shared arrays
+}
+
+// Name returns the name of the program's kernel.
+func (p *Program) Name() string { return p.name }
+
+// Stage returns the stage the program's kernel runs in.
+func (p *Program) Stage() Stage { return p.stage }
+
+// Varyings describes the values a vertex kernel passes to a fragment
+// kernel, one entry per float32 component of its output struct, position
+// aside (of its input struct, for a fragment kernel): true for an integer
+// component, which is taken from the primitive's first vertex rather than
+// interpolated. It is empty when the kernel returns (takes) a bare Vec4.
+func (p *Program) Varyings() []bool { return p.io.flat }
+
+// Targets returns the number of colors a fragment kernel writes: one for a
+// Vec4, a field each for a struct of them.
+func (p *Program) Targets() int { return len(p.colors) }
+
+// Derivatives reports whether a fragment kernel takes Dfdx or Dfdy of its
+// varyings, which Fragment then needs.
+func (p *Program) Derivatives() bool { return p.deriv != [2]int{-1, -1} }
+
+// Bind checks that res holds every resource the program's kernel binds
+// and returns the program bound to them.
+func (p *Program) Bind(res Resources) (*Bound, error) {
+	b := &Bound{p: p, bufs: make([][]uint32, p.nbufs), tex: make([]Texture, p.ntex), samp: make([]Sampler, p.nsamp)}
+	for i := range b.bufs {
+		if i >= len(res.Buffers) || res.Buffers[i] == nil {
+			return nil, fmt.Errorf("shader: kernel %s: buffer %d (%s) is not bound", p.name, i, p.bufNames[i])
+		}
+		w, err := words(res.Buffers[i])
+		if err != nil {
+			return nil, fmt.Errorf("shader: kernel %s: buffer %d (%s): %w", p.name, i, p.bufNames[i], err)
+		}
+		b.bufs[i] = w
+	}
+	for i := range b.tex {
+		if i >= len(res.Textures) || res.Textures[i] == nil {
+			return nil, fmt.Errorf("shader: kernel %s: texture %d (%s) is not bound", p.name, i, p.texNames[i])
+		}
+		b.tex[i] = res.Textures[i]
+	}
+	for i := range b.samp {
+		if i >= len(res.Samplers) || res.Samplers[i] == nil {
+			return nil, fmt.Errorf("shader: kernel %s: sampler %d (%s) is not bound", p.name, i, p.sampNames[i])
+		}
+		b.samp[i] = res.Samplers[i]
+	}
+	return b, nil
+}
+
+// Program returns the program b binds.
+func (b *Bound) Program() *Program { return b.p }
+
+// words views b as the 32-bit words a kernel reads; a trailing partial word
+// is out of bounds.
+func words(b []byte) ([]uint32, error) {
+	if len(b) < 4 {
+		return []uint32{}, nil
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%4 != 0 {
+		return nil, errors.New("not 4-byte aligned")
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), len(b)/4), nil
+}
+
+// invocation returns an invocation to run; put it back with release. A
+// frame is reused as it is: a kernel writes every word it reads before
+// reading it, but for its constants, which it never writes.
+func (b *Bound) invocation() *cpuInv {
+	if in, ok := b.frames.Get().(*cpuInv); ok {
+		return in
+	}
+	return &cpuInv{w: slices.Clone(b.p.frame), bufs: b.bufs, tex: b.tex, samp: b.samp}
+}
+
+func (b *Bound) release(in *cpuInv) {
+	in.shared = nil
+	b.frames.Put(in)
+}
+
+// setID stores id in frame word i, unless the kernel does not take it.
+func (in *cpuInv) setID(i int, id uint32) {
+	if i >= 0 {
+		in.w[i] = id
+	}
+}
+
+// Dispatch runs a compute kernel for invocations 0 to n-1. With a
+// workgroup size, it runs whole workgroups of that many invocations, the
+// grid rounded up. A kernel with shared memory or barriers runs its
+// workgroups one after another through gpumath.Dispatch, each with shared
+// memory of its own; other kernels run their invocations in parallel.
+func (b *Bound) Dispatch(n, workgroup int) {
+	p := b.p
+	if p.stage != StageCompute {
+		panic(fmt.Sprintf("shader: Dispatch of %s kernel %s", stageName(p.stage), p.name))
+	}
+	if p.barrier {
+		var mu sync.Mutex
+		cur, shared := ^uint(0), [][]uint32(nil)
+		gpumath.Dispatch(n, workgroup, func(gid, lid, wid uint) {
+			mu.Lock()
+			if wid != cur {
+				cur, shared = wid, make([][]uint32, len(p.shared))
+				for i, n := range p.shared {
+					shared[i] = make([]uint32, n)
+				}
+			}
+			sh := shared
+			mu.Unlock()
+			in := b.invocation()
+			in.shared = sh
+			in.setID(p.ids[0], uint32(gid))
+			in.setID(p.ids[1], uint32(lid))
+			in.setID(p.ids[2], uint32(wid))
+			p.body(in)
+			b.release(in)
+		})
+		return
+	}
+	size := max(workgroup, 1)
+	n = (n + size - 1) / size * size
+	workers := min(runtime.GOMAXPROCS(0), n)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			in := b.invocation()
+			defer b.release(in)
+			for gid := lo; gid < hi; gid++ {
+				in.setID(p.ids[0], uint32(gid))
+				in.setID(p.ids[1], uint32(gid%size))
+				in.setID(p.ids[2], uint32(gid/size))
+				p.body(in)
+			}
+		}(n*w/workers, n*(w+1)/workers)
+	}
+	wg.Wait()
+}
+
+// Vertex runs a vertex kernel for vertex vid of instance iid, returning the
+// clip-space position and storing its varyings in varyings, which holds
+// len(Varyings()) values.
+func (b *Bound) Vertex(vid, iid uint32, varyings []float32) [4]float32 {
+	p := b.p
+	if p.stage != StageVertex {
+		panic(fmt.Sprintf("shader: Vertex of %s kernel %s", stageName(p.stage), p.name))
+	}
+	in := b.invocation()
+	defer b.release(in)
+	in.setID(p.ids[0], vid)
+	in.setID(p.ids[1], iid)
+	p.body(in)
+	out := in.w[p.ret:]
+	if p.position < 0 {
+		return vec4Words(out)
+	}
+	for i, w := range p.io.words {
+		varyings[i] = f32(out[w])
+	}
+	return vec4Words(out[p.position:])
+}
+
+// Fragment runs a fragment kernel for a fragment at pos, its window
+// position (x and y at the pixel center, the depth, and 1/w), with the
+// interpolated varyings, and stores its colors in colors, which holds
+// Targets() of them. ddx and ddy are the varyings' derivatives along x and
+// y, which Dfdx and Dfdy read; they may be nil unless Derivatives().
+func (b *Bound) Fragment(pos [4]float32, varyings, ddx, ddy []float32, colors [][4]float32) {
+	p := b.p
+	if p.stage != StageFragment {
+		panic(fmt.Sprintf("shader: Fragment of %s kernel %s", stageName(p.stage), p.name))
+	}
+	in := b.invocation()
+	defer b.release(in)
+	if p.stageIn >= 0 {
+		st := in.w[p.stageIn:]
+		for i, w := range p.io.words {
+			st[w] = w32(varyings[i])
+		}
+		if p.position >= 0 {
+			for i, v := range pos {
+				st[p.position+i] = w32(v)
+			}
+		}
+		for k, d := range [2][]float32{ddx, ddy} {
+			if p.deriv[k] < 0 {
+				continue
+			}
+			st := in.w[p.deriv[k]:]
+			for i, w := range p.io.words {
+				st[w] = w32(d[i])
+			}
+		}
+	}
+	p.body(in)
+	for i, off := range p.colors {
+		colors[i] = vec4Words(in.w[p.ret+off:])
+	}
+}
+
+func vec4Words(w []uint32) [4]float32 {
+	return [4]float32{f32(w[0]), f32(w[1]), f32(w[2]), f32(w[3])}
+}
@@ -0,0 +1,1891 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+	"reflect"
+	"strings"
+
+	"poly.red/gpu/shader/gpumath"
+)
+
+// The CPU target: rather than text, a kernel compiles to a tree of Go
+// closures over the invocation's frame (see Program). Every expression is
+// compiled to the frame words its value is left in and the closure that
+// computes it, which is nil for a variable or constant, read in place; every
+// statement to a closure reporting how control leaves it. The checker, kept
+// in step with the declarations along the way, gives the type of each
+// expression, so the compiler follows exactly the rules the emitters do.
+
+// cpuRun computes an expression into its frame words.
+type cpuRun func(in *cpuInv)
+
+func (f cpuRun) call(in *cpuInv) {
+	if f != nil {
+		f(in)
+	}
+}
+
+// cpuStmt runs a statement.
+type cpuStmt func(in *cpuInv) cpuCtl
+
+// cpuCtl is how control leaves a statement.
+type cpuCtl uint8
+
+const (
+	ctlNext cpuCtl = iota
+	ctlBreak
+	ctlContinue
+	ctlReturn
+)
+
+// cpuVal is a compiled expression: its value, of type typ, is at frame word
+// off once run has run.
+type cpuVal struct {
+	typ string
+	off int
+	run cpuRun
+}
+
+// cpuRef is a compiled location: a variable, a buffer, uniform or shared
+// element, or a field or component of one. Once run has run, it is at frame
+// word frame or, when addr is set, where addr says: a buffer or the frame,
+// and the word in it, negative out of bounds. A swizzle of several
+// components lists their words relative to that.
+type cpuRef struct {
+	typ   string
+	run   cpuRun
+	frame int
+	addr  func(in *cpuInv) ([]uint32, int)
+	swz   []int
+}
+
+func (r *cpuRef) at(in *cpuInv) ([]uint32, int) {
+	if r.addr != nil {
+		return r.addr(in)
+	}
+	return in.w, r.frame
+}
+
+// read copies the n words of the value at mem[off:] to frame word dst,
+// reading zero out of bounds.
+func (r *cpuRef) read(in *cpuInv, mem []uint32, off, dst, n int) {
+	if r.swz != nil {
+		for i, s := range r.swz {
+			if off < 0 || off+s >= len(mem) {
+				in.w[dst+i] = 0
+			} else {
+				in.w[dst+i] = mem[off+s]
+			}
+		}
+		return
+	}
+	if off < 0 || off+n > len(mem) {
+		clear(in.w[dst : dst+n])
+		return
+	}
+	copy(in.w[dst:dst+n], mem[off:off+n])
+}
+
+// write copies n words from frame word src to the value at mem[off:],
+// writing nothing out of bounds.
+func (r *cpuRef) write(in *cpuInv, mem []uint32, off, src, n int) {
+	if r.swz != nil {
+		for i, s := range r.swz {
+			if off >= 0 && off+s < len(mem) {
+				mem[off+s] = in.w[src+i]
+			}
+		}
+		return
+	}
+	if off >= 0 && off+n <= len(mem) {
+		copy(mem[off:off+n], in.w[src:src+n])
+	}
+}
+
+// cpuResource is a buffer, uniform, texture, sampler or shared array of
+// the kernel: its binding (or shared array) index and its element type.
+type cpuResource struct {
+	index   int
+	elem    string
+	uniform bool
+}
+
+// cpuFunc is a compiled helper: the frame words of its parameters and
+// result. The kernel itself has a cpuFunc for its result.
+type cpuFunc struct {
+	params  []int
+	types   []string
+	ret     int
+	retType string
+	body    cpuStmt
+}
+
+// cpuScope maps the variables of a block to their frame words.
+type cpuScope struct {
+	vars   map[string]int
+	parent *cpuScope
+}
+
+func (s *cpuScope) lookup(name string) (int, bool) {
+	for ; s != nil; s = s.parent {
+		if off, ok := s.vars[name]; ok {
+			return off, true
+		}
+	}
+	return 0, false
+}
+
+// cpuLayout is the layout of a type in 32-bit words: that of a storage
+// buffer (a Vec3 takes four words) and, for structs, of Metal, whose
+// structs may nest.
+type cpuLayout struct {
+	size, align int
+	fields      []cpuField
+}
+
+type cpuField struct {
+	name, typ string
+	off       int
+}
+
+type cpuCompiler struct {
+	chk     *checker // the types of expressions
+	globals *scope
+	structs map[string]*ast.StructType
+	funcs   map[string]*ast.FuncDecl
+	helpers map[string]*cpuFunc // the helpers compiled so far
+	layouts map[string]cpuLayout
+	res     map[string]cpuResource // the kernel's buffers, uniforms, textures and samplers
+	shared  map[string]cpuResource
+	scope   *cpuScope
+	fn      *cpuFunc // the function being compiled
+	frame   []uint32
+	stageIn int    // frame words of a fragment kernel's input struct, or -1
+	inType  string // its type
+	deriv   [2]int // frame words of its x and y derivatives, -1 until Dfdx or Dfdy needs them
+}
+
+// compileKernelCPU compiles kernel fn, binding its parameters as
+// compileKernel does.
+func compileKernelCPU(fset *token.FileSet, fn *ast.FuncDecl, structs map[string]*ast.StructType, funcs map[string]*ast.FuncDecl, shared map[string]sharedVar) (*Kernel, error) {
+	stage := stageOf(fn.Doc)
+	globals := &scope{vars: map[string]variable{}}
+	for name, sv := range shared {
+		globals.vars[name] = variable{typ: sv.elem + "[]", readonly: true}
+	}
+	c := &cpuCompiler{
+		chk:     &checker{fset: fset, structs: structs, funcs: funcs, scope: &scope{vars: map[string]variable{}, parent: globals}},
+		globals: globals,
+		structs: structs,
+		funcs:   funcs,
+		helpers: map[string]*cpuFunc{},
+		layouts: map[string]cpuLayout{},
+		res:     map[string]cpuResource{},
+		shared:  map[string]cpuResource{},
+		scope:   &cpuScope{vars: map[string]int{}},
+		stageIn: -1,
+		deriv:   [2]int{-1, -1},
+	}
+	// The checker declares the parameters with the types the emitters bind
+	// them with; it is the compiler's oracle for the type of every
+	// expression.
+	if err := c.chk.kernelParams(fn); err != nil {
+		return nil, err
+	}
+	p := &Program{name: fn.Name.Name, stage: stage, ids: [3]int{-1, -1, -1}, stageIn: -1, position: -1}
+	params := flattenParams(fn.Type.Params)
+	local := func(pr param) int {
+		off := c.alloc(c.chk.scope.vars[pr.name].typ)
+		c.scope.vars[pr.name] = off
+		return off
+	}
+	if stage == StageCompute || stage == StageVertex {
+		p.ids[0] = local(params[0])
+		params = params[1:]
+	}
+	if stage == StageCompute {
+		var ids []param
+		ids, params = workgroupIDs(params)
+		for i, pr := range ids {
+			p.ids[1+i] = local(pr)
+		}
+	}
+	if stage == StageVertex && len(params) > 0 {
+		if t, ok := identType(params[0].typ); ok && isIntType(t) {
+			p.ids[1] = local(params[0])
+			params = params[1:]
+		}
+	}
+	var bindings []Binding
+	for _, pr := range params {
+		typ := c.chk.scope.vars[pr.name].typ
+		switch {
+		case strings.HasSuffix(typ, "[]"):
+			c.res[pr.name] = cpuResource{index: p.nbufs, elem: strings.TrimSuffix(typ, "[]")}
+			bindings = append(bindings, Binding{Index: p.nbufs, Name: pr.name, Kind: StorageBuffer})
+			p.bufNames = append(p.bufNames, pr.name)
+			p.nbufs++
+		case textureCoords[typ] != nil || typ == "texture2d_ms":
+			c.res[pr.name] = cpuResource{index: p.ntex, elem: typ}
+			bindings = append(bindings, Binding{Index: p.ntex, Name: pr.name, Kind: SampledTexture})
+			p.texNames = append(p.texNames, pr.name)
+			p.ntex++
+		case typ == "sampler" || typ == "sampler_comparison":
+			c.res[pr.name] = cpuResource{index: p.nsamp, elem: typ}
+			bindings = append(bindings, Binding{Index: p.nsamp, Name: pr.name, Kind: SamplerBinding})
+			p.sampNames = append(p.sampNames, pr.name)
+			p.nsamp++
+		case stage == StageFragment && p.stageIn < 0:
+			p.stageIn = local(pr)
+			c.stageIn, c.inType = p.stageIn, typ
+			io, pos, err := c.io(typ)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %w", pr.name, err)
+			}
+			p.io, p.position = io, pos
+		default:
+			c.res[pr.name] = cpuResource{index: p.nbufs, elem: typ, uniform: true}
+			bindings = append(bindings, Binding{Index: p.nbufs, Name: pr.name, Kind: UniformBuffer})
+			p.bufNames = append(p.bufNames, pr.name)
+			p.nbufs++
+		}
+	}
+	for i, sv := range sharedOf(fn, shared) {
+		c.shared[sv.name] = cpuResource{index: i, elem: sv.elem}
+		p.shared = append(p.shared, sv.n*c.layout(sv.elem).size)
+	}
+	p.barrier = len(p.shared) > 0 || usesBarrier(fn)
+
+	if stage != StageCompute {
+		p.retType = c.chk.results[0]
+		p.ret = c.alloc(p.retType)
+		switch {
+		case p.retType == "float4":
+			p.colors = []int{0}
+		case stage == StageFragment && c.structs[p.retType] != nil:
+			// The checker allows a struct of Vec4 colors only.
+			for _, f := range c.layout(p.retType).fields {
+				p.colors = append(p.colors, f.off)
+			}
+		case stage == StageVertex && c.structs[p.retType] != nil:
+			io, pos, err := c.io(p.retType)
+			if err != nil {
+				return nil, fmt.Errorf("result: %w", err)
+			}
+			if pos < 0 {
+				return nil, fmt.Errorf("result %s has no field tagged gpu:\"position\"", p.retType)
+			}
+			p.io, p.position = io, pos
+		default:
+			return nil, fmt.Errorf("%s kernel returns %s; the CPU target takes a Vec4 or a struct", stageName(stage), goName(p.retType))
+		}
+	}
+	c.fn = &cpuFunc{ret: p.ret, retType: p.retType}
+	body, err := c.stmts(fn.Body.List)
+	if err != nil {
+		return nil, err
+	}
+	p.body, p.frame, p.deriv = body, c.frame, c.deriv
+	return &Kernel{Name: fn.Name.Name, Stage: stage, Bindings: bindings, CPU: p}, nil
+}
+
+// usesBarrier reports whether fn calls WorkgroupBarrier.
+func usesBarrier(fn *ast.FuncDecl) bool {
+	found := false
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "WorkgroupBarrier" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// io lays out the varyings of struct t, which may have a field tagged
+// gpu:"position", a Vec4, whose word offset it returns (-1 if none).
+func (c *cpuCompiler) io(t string) (cpuIO, int, error) {
+	st := c.structs[t]
+	if st == nil {
+		return cpuIO{}, -1, fmt.Errorf("%s is not a struct", goName(t))
+	}
+	var io cpuIO
+	pos := -1
+	fields := c.layout(t).fields
+	i := 0
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("gpu")
+		}
+		for range f.Names {
+			fl := fields[i]
+			i++
+			switch {
+			case tag == "position":
+				if fl.typ != "float4" {
+					return cpuIO{}, -1, fmt.Errorf("position field %s is a %s, not a Vec4", fl.name, goName(fl.typ))
+				}
+				pos = fl.off
+			case fl.typ == "float" || isVecType(fl.typ):
+				for j := range vecLen(fl.typ) {
+					io.words = append(io.words, fl.off+j)
+					io.flat = append(io.flat, false)
+				}
+			case fl.typ == "int" || fl.typ == "uint":
+				io.words = append(io.words, fl.off)
+				io.flat = append(io.flat, true)
+			default:
+				return cpuIO{}, -1, fmt.Errorf("varying %s: %s cannot be interpolated", fl.name, goName(fl.typ))
+			}
+		}
+	}
+	return io, pos, nil
+}
+
+// alloc returns the first of the frame words for a new value of type t.
+func (c *cpuCompiler) alloc(t string) int {
+	off := len(c.frame)
+	c.frame = append(c.frame, make([]uint32, c.layout(t).size)...)
+	return off
+}
+
+// layout lays out type t. A bool, which only a variable holds, takes a
+// word.
+func (c *cpuCompiler) layout(t string) cpuLayout {
+	if l, ok := c.layouts[t]; ok {
+		return l
+	}
+	var l cpuLayout
+	switch t {
+	case "", "float", "int", "uint", "bool":
+		l = cpuLayout{size: 1, align: 1}
+	case "float2":
+		l = cpuLayout{size: 2, align: 2}
+	case "float3", "float4":
+		l = cpuLayout{size: 4, align: 4}
+	case "float4x4":
+		l = cpuLayout{size: 16, align: 4}
+	default:
+		l.align = 1
+		for _, f := range c.structs[t].Fields.List {
+			ft, _ := identType(f.Type)
+			if mt, ok := goToMSLType(ft); ok {
+				ft = mt
+			}
+			fl := c.layout(ft)
+			for _, n := range f.Names {
+				l.size = (l.size + fl.align - 1) / fl.align * fl.align
+				l.fields = append(l.fields, cpuField{name: n.Name, typ: ft, off: l.size})
+				l.size += fl.size
+			}
+			l.align = max(l.align, fl.align)
+		}
+		l.size = max(1, (l.size+l.align-1)/l.align*l.align)
+	}
+	c.layouts[t] = l
+	return l
+}
+
+// words is the number of words a value of type t holds, padding aside: a
+// Vec3 holds three.
+func (c *cpuCompiler) words(t string) int {
+	if t == "float3" {
+		return 3
+	}
+	return c.layout(t).size
+}
+
+// lanes is the number of components of a scalar, vector or matrix type.
+func lanes(t string) int {
+	if t == "float4x4" {
+		return 16
+	}
+	return vecLen(t)
+}
+
+// push opens a block scope in the compiler and the checker; the returned
+// func closes it.
+func (c *cpuCompiler) push() func() {
+	c.scope = &cpuScope{vars: map[string]int{}, parent: c.scope}
+	pop := c.chk.push()
+	return func() {
+		c.scope = c.scope.parent
+		pop()
+	}
+}
+
+// declare gives variable name of type t frame words in the innermost scope.
+func (c *cpuCompiler) declare(name, t string) int {
+	off := c.alloc(t)
+	c.scope.vars[name] = off
+	c.chk.scope.vars[name] = variable{typ: t}
+	return off
+}
+
+func (c *cpuCompiler) errorf(n ast.Node, format string, args ...any) error {
+	return c.chk.errorf(n, format, args...)
+}
+
+// operand checks e, which the checker has accepted, for its type and
+// constant value. A call may have no value.
+func (c *cpuCompiler) operand(e ast.Expr) (operand, error) {
+	if call, ok := ast.Unparen(e).(*ast.CallExpr); ok {
+		return c.chk.call(call)
+	}
+	return c.chk.expr(e)
+}
+
+// resolve is the type an expression of type x takes where a want is
+// expected: an untyped constant converts to a scalar want, and otherwise
+// takes its default type. An untyped expression that is not constant (a
+// shift of a constant) is an int.
+func resolve(x operand, want string) string {
+	switch {
+	case !x.untyped():
+		return x.typ
+	case isNumeric(want):
+		return want
+	case x.val != nil:
+		return defaultType(x.typ)
+	}
+	return "int"
+}
+
+// stmts compiles a statement list in the current scope.
+func (c *cpuCompiler) stmts(list []ast.Stmt) (cpuStmt, error) {
+	var ss []cpuStmt
+	for _, s := range list {
+		cs, err := c.stmt(s)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, cs)
+	}
+	switch len(ss) {
+	case 0:
+		return func(*cpuInv) cpuCtl { return ctlNext }, nil
+	case 1:
+		return ss[0], nil
+	}
+	return func(in *cpuInv) cpuCtl {
+		for _, s := range ss {
+			if ctl := s(in); ctl != ctlNext {
+				return ctl
+			}
+		}
+		return ctlNext
+	}, nil
+}
+
+// block compiles a statement list in a scope of its own.
+func (c *cpuCompiler) block(list []ast.Stmt) (cpuStmt, error) {
+	defer c.push()()
+	return c.stmts(list)
+}
+
+// next runs f as a statement that control leaves normally.
+func next(f cpuRun) cpuStmt {
+	if f == nil {
+		return func(*cpuInv) cpuCtl { return ctlNext }
+	}
+	return func(in *cpuInv) cpuCtl {
+		f(in)
+		return ctlNext
+	}
+}
+
+// seq runs fs in order.
+func seq(fs ...cpuRun) cpuRun {
+	var list []cpuRun
+	for _, f := range fs {
+		if f != nil {
+			list = append(list, f)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	case 2:
+		a, b := list[0], list[1]
+		return func(in *cpuInv) {
+			a(in)
+			b(in)
+		}
+	}
+	return func(in *cpuInv) {
+		for _, f := range list {
+			f(in)
+		}
+	}
+}
+
+func (c *cpuCompiler) stmt(s ast.Stmt) (cpuStmt, error) {
+	switch st := s.(type) {
+	case *ast.AssignStmt:
+		f, err := c.assign(st)
+		return next(f), err
+	case *ast.DeclStmt:
+		f, err := c.declStmt(st)
+		return next(f), err
+	case *ast.IncDecStmt:
+		op := token.ADD
+		if st.Tok == token.DEC {
+			op = token.SUB
+		}
+		x, err := c.operand(st.X)
+		if err != nil {
+			return nil, err
+		}
+		one := constant.MakeInt64(1)
+		f, err := c.update(st, st.X, op, c.constant(one, x.typ))
+		return next(f), err
+	case *ast.BlockStmt:
+		return c.block(st.List)
+	case *ast.IfStmt:
+		return c.ifStmt(st)
+	case *ast.ForStmt:
+		return c.forStmt(st)
+	case *ast.BranchStmt:
+		if st.Tok == token.CONTINUE {
+			return func(*cpuInv) cpuCtl { return ctlContinue }, nil
+		}
+		return func(*cpuInv) cpuCtl { return ctlBreak }, nil
+	case *ast.ExprStmt:
+		v, err := c.expr(st.X, "")
+		return next(v.run), err
+	case *ast.ReturnStmt:
+		if len(st.Results) == 0 {
+			return func(*cpuInv) cpuCtl { return ctlReturn }, nil
+		}
+		v, err := c.expr(st.Results[0], c.fn.retType)
+		if err != nil {
+			return nil, err
+		}
+		ret := cpuRef{typ: c.fn.retType, frame: c.fn.ret}
+		store := c.store(&ret, v)
+		return func(in *cpuInv) cpuCtl {
+			store(in)
+			return ctlReturn
+		}, nil
+	}
+	// Lowering leaves no switches or labels.
+	return nil, c.errorf(s, "unsupported statement %T", s)
+}
+
+func (c *cpuCompiler) ifStmt(st *ast.IfStmt) (cpuStmt, error) {
+	defer c.push()()
+	init := next(nil)
+	if st.Init != nil {
+		var err error
+		if init, err = c.stmt(st.Init); err != nil {
+			return nil, err
+		}
+	}
+	cond, err := c.expr(st.Cond, "bool")
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.stmt(st.Body)
+	if err != nil {
+		return nil, err
+	}
+	els := next(nil)
+	if st.Else != nil {
+		if els, err = c.stmt(st.Else); err != nil {
+			return nil, err
+		}
+	}
+	return func(in *cpuInv) cpuCtl {
+		init(in)
+		cond.run.call(in)
+		if in.w[cond.off] != 0 {
+			return body(in)
+		}
+		return els(in)
+	}, nil
+}
+
+func (c *cpuCompiler) forStmt(st *ast.ForStmt) (cpuStmt, error) {
+	defer c.push()()
+	init, post := next(nil), next(nil)
+	var err error
+	if st.Init != nil {
+		if init, err = c.stmt(st.Init); err != nil {
+			return nil, err
+		}
+	}
+	cond := cpuVal{off: -1}
+	if st.Cond != nil {
+		if cond, err = c.expr(st.Cond, "bool"); err != nil {
+			return nil, err
+		}
+	}
+	if st.Post != nil {
+		if post, err = c.stmt(st.Post); err != nil {
+			return nil, err
+		}
+	}
+	body, err := c.stmt(st.Body)
+	if err != nil {
+		return nil, err
+	}
+	return func(in *cpuInv) cpuCtl {
+		for init(in); ; post(in) {
+			if cond.off >= 0 {
+				cond.run.call(in)
+				if in.w[cond.off] == 0 {
+					return ctlNext
+				}
+			}
+			switch body(in) {
+			case ctlBreak:
+				return ctlNext
+			case ctlReturn:
+				return ctlReturn
+			}
+		}
+	}, nil
+}
+
+// assign compiles =, := and op=. Lowering unpacks the results of helpers,
+// so each value on the right is one expression.
+func (c *cpuCompiler) assign(st *ast.AssignStmt) (cpuRun, error) {
+	if st.Tok != token.ASSIGN && st.Tok != token.DEFINE {
+		op := token.Token(int(st.Tok) - int(token.ADD_ASSIGN) + int(token.ADD))
+		x, err := c.operand(st.Lhs[0])
+		if err != nil {
+			return nil, err
+		}
+		want := scalarOf(x.typ)
+		if op == token.SHL || op == token.SHR {
+			want = "uint"
+		}
+		y, err := c.expr(st.Rhs[0], want)
+		if err != nil {
+			return nil, err
+		}
+		return c.update(st, st.Lhs[0], op, y)
+	}
+	blank := func(e ast.Expr) bool {
+		id, ok := e.(*ast.Ident)
+		return ok && id.Name == "_"
+	}
+	// The locations on the left, for assignment (nil for _ and names :=
+	// declares).
+	refs := make([]*cpuRef, len(st.Lhs))
+	for i, l := range st.Lhs {
+		if blank(l) {
+			continue
+		}
+		if st.Tok == token.DEFINE {
+			id := l.(*ast.Ident)
+			off, ok := c.scope.vars[id.Name]
+			if !ok {
+				continue
+			}
+			refs[i] = &cpuRef{typ: c.chk.scope.vars[id.Name].typ, frame: off}
+			continue
+		}
+		r, err := c.ref(l)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = &r
+	}
+	vals := make([]cpuVal, len(st.Rhs))
+	for i, e := range st.Rhs {
+		want := ""
+		if refs[i] != nil {
+			want = refs[i].typ
+		}
+		v, err := c.expr(e, want)
+		if err != nil {
+			return nil, err
+		}
+		if len(st.Rhs) > 1 {
+			v = c.copied(v)
+		}
+		vals[i] = v
+	}
+	var runs []cpuRun
+	for i, l := range st.Lhs {
+		switch {
+		case blank(l):
+			runs = append(runs, vals[i].run)
+		case refs[i] == nil:
+			off := c.declare(l.(*ast.Ident).Name, vals[i].typ)
+			runs = append(runs, c.store(&cpuRef{typ: vals[i].typ, frame: off}, vals[i]))
+		default:
+			runs = append(runs, c.store(refs[i], vals[i]))
+		}
+	}
+	return seq(runs...), nil
+}
+
+// update compiles x op= y, finding x once.
+func (c *cpuCompiler) update(n ast.Node, lhs ast.Expr, op token.Token, y cpuVal) (cpuRun, error) {
+	r, err := c.ref(lhs)
+	if err != nil {
+		return nil, err
+	}
+	_, f, err := c.binop(n, op, r.typ, y.typ)
+	if err != nil {
+		return nil, err
+	}
+	if r.addr == nil && r.swz == nil {
+		frame := r.frame
+		return seq(r.run, y.run, func(in *cpuInv) { f(in.w, frame, frame, y.off) }), nil
+	}
+	tmp, words := c.alloc(r.typ), c.words(r.typ)
+	return seq(r.run, y.run, func(in *cpuInv) {
+		mem, off := r.at(in)
+		r.read(in, mem, off, tmp, words)
+		f(in.w, tmp, tmp, y.off)
+		r.write(in, mem, off, tmp, words)
+	}), nil
+}
+
+// copied returns v in frame words of its own, so that later assignments
+// do not change it.
+func (c *cpuCompiler) copied(v cpuVal) cpuVal {
+	dst, n := c.alloc(v.typ), c.words(v.typ)
+	src, run := v.off, v.run
+	return cpuVal{typ: v.typ, off: dst, run: func(in *cpuInv) {
+		run.call(in)
+		copy(in.w[dst:dst+n], in.w[src:src+n])
+	}}
+}
+
+// store compiles storing v at r.
+func (c *cpuCompiler) store(r *cpuRef, v cpuVal) cpuRun {
+	n, src := c.words(r.typ), v.off
+	if r.addr == nil && r.swz == nil {
+		dst := r.frame
+		if dst == src {
+			return seq(r.run, v.run)
+		}
+		return seq(r.run, v.run, func(in *cpuInv) { copy(in.w[dst:dst+n], in.w[src:src+n]) })
+	}
+	return seq(r.run, v.run, func(in *cpuInv) {
+		mem, off := r.at(in)
+		r.write(in, mem, off, src, n)
+	})
+}
+
+// load compiles reading r.
+func (c *cpuCompiler) load(r cpuRef) cpuVal {
+	if r.addr == nil && r.swz == nil {
+		return cpuVal{typ: r.typ, off: r.frame, run: r.run}
+	}
+	dst, n := c.alloc(r.typ), c.words(r.typ)
+	return cpuVal{typ: r.typ, off: dst, run: seq(r.run, func(in *cpuInv) {
+		mem, off := r.at(in)
+		r.read(in, mem, off, dst, n)
+	})}
+}
+
+func (c *cpuCompiler) declStmt(st *ast.DeclStmt) (cpuRun, error) {
+	var runs []cpuRun
+	for _, spec := range st.Decl.(*ast.GenDecl).Specs {
+		vs := spec.(*ast.ValueSpec)
+		typ := ""
+		if vs.Type != nil {
+			t, err := valueType(vs.Type, c.structs)
+			if err != nil {
+				return nil, c.errorf(vs.Type, "%v", err)
+			}
+			typ = t
+		}
+		vals := make([]cpuVal, len(vs.Values))
+		for i, e := range vs.Values {
+			v, err := c.expr(e, typ)
+			if err != nil {
+				return nil, err
+			}
+			if len(vs.Values) > 1 {
+				v = c.copied(v)
+			}
+			vals[i] = v
+		}
+		for i, name := range vs.Names {
+			if vs.Values == nil {
+				off := c.declare(name.Name, typ)
+				n := c.words(typ)
+				runs = append(runs, func(in *cpuInv) { clear(in.w[off : off+n]) })
+				continue
+			}
+			t := typ
+			if t == "" {
+				t = vals[i].typ
+			}
+			off := c.declare(name.Name, t)
+			runs = append(runs, c.store(&cpuRef{typ: t, frame: off}, vals[i]))
+		}
+	}
+	return seq(runs...), nil
+}
+
+// constant returns v as a t.
+func (c *cpuCompiler) constant(v constant.Value, t string) cpuVal {
+	off := c.alloc(t)
+	switch t {
+	case "float":
+		f, _ := constant.Float32Val(constant.ToFloat(v))
+		c.frame[off] = math.Float32bits(f)
+	case "bool":
+		if constant.BoolVal(v) {
+			c.frame[off] = 1
+		}
+	default:
+		c.frame[off] = intBits(v)
+	}
+	return cpuVal{typ: t, off: off}
+}
+
+// intBits is constant v as a 32-bit integer: wrapped if too large, and
+// truncated toward zero if a float.
+func intBits(v constant.Value) uint32 {
+	if i := constant.ToInt(v); i.Kind() == constant.Int {
+		if n, ok := constant.Int64Val(i); ok {
+			return uint32(n)
+		}
+		n, _ := constant.Uint64Val(i)
+		return uint32(n)
+	}
+	f, _ := constant.Float64Val(v)
+	return uint32(int64(f))
+}
+
+// expr compiles e, converting an untyped constant to want (see resolve).
+func (c *cpuCompiler) expr(e ast.Expr, want string) (cpuVal, error) {
+	x, err := c.operand(e)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	t := resolve(x, want)
+	if x.val != nil {
+		return c.constant(x.val, t), nil
+	}
+	switch ex := e.(type) {
+	case *ast.ParenExpr:
+		return c.expr(ex.X, want)
+	case *ast.Ident, *ast.IndexExpr, *ast.SelectorExpr:
+		r, err := c.ref(e)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		return c.load(r), nil
+	case *ast.UnaryExpr:
+		return c.unary(ex, t)
+	case *ast.BinaryExpr:
+		return c.binary(ex, t)
+	case *ast.CallExpr:
+		return c.call(ex, t)
+	case *ast.CompositeLit:
+		return c.compositeLit(ex)
+	}
+	return cpuVal{}, c.errorf(e, "unsupported expression %T", e)
+}
+
+// ref compiles e as a location. A value that is not one (a call, say) is
+// computed into frame words of its own.
+func (c *cpuCompiler) ref(e ast.Expr) (cpuRef, error) {
+	x, err := c.operand(e)
+	if err != nil {
+		return cpuRef{}, err
+	}
+	switch ex := e.(type) {
+	case *ast.ParenExpr:
+		return c.ref(ex.X)
+	case *ast.Ident:
+		if off, ok := c.scope.lookup(ex.Name); ok && x.val == nil {
+			return cpuRef{typ: x.typ, frame: off}, nil
+		}
+		if r, ok := c.res[ex.Name]; ok && r.uniform {
+			k := r.index
+			return cpuRef{typ: x.typ, frame: -1, addr: func(in *cpuInv) ([]uint32, int) { return in.bufs[k], 0 }}, nil
+		}
+	case *ast.IndexExpr:
+		base, err := c.operand(ex.X)
+		if err != nil {
+			return cpuRef{}, err
+		}
+		if strings.HasSuffix(base.typ, "[]") {
+			return c.element(ex, x.typ)
+		}
+		b, err := c.ref(ex.X)
+		if err != nil {
+			return cpuRef{}, err
+		}
+		if b.swz != nil {
+			v := c.load(b)
+			b = cpuRef{typ: v.typ, frame: v.off, run: v.run}
+		}
+		i, err := c.operand(ex.Index)
+		if err != nil {
+			return cpuRef{}, err
+		}
+		n := vecLen(b.typ)
+		if i.val != nil {
+			if k := int(int32(intBits(i.val))); k >= 0 && k < n {
+				return offset(b, k, x.typ), nil
+			}
+		}
+		idx, err := c.expr(ex.Index, "int")
+		if err != nil {
+			return cpuRef{}, err
+		}
+		return cpuRef{typ: x.typ, frame: -1, run: seq(b.run, idx.run), addr: func(in *cpuInv) ([]uint32, int) {
+			mem, off := b.at(in)
+			if i := in.w[idx.off]; off >= 0 && i < uint32(n) {
+				return mem, off + int(i)
+			}
+			return mem, -1
+		}}, nil
+	case *ast.SelectorExpr:
+		b, err := c.ref(ex.X)
+		if err != nil {
+			return cpuRef{}, err
+		}
+		if st := c.structs[b.typ]; st != nil {
+			for _, f := range c.layout(b.typ).fields {
+				if f.name == ex.Sel.Name {
+					return offset(b, f.off, x.typ), nil
+				}
+			}
+		}
+		var comps []int
+		for _, r := range strings.ToLower(ex.Sel.Name) {
+			k := strings.IndexRune("xyzw", r)
+			if b.swz != nil {
+				k = b.swz[k]
+			}
+			comps = append(comps, k)
+		}
+		b.swz = nil
+		if len(comps) == 1 {
+			return offset(b, comps[0], x.typ), nil
+		}
+		b.typ, b.swz = x.typ, comps
+		return b, nil
+	}
+	v, err := c.expr(e, "")
+	if err != nil {
+		return cpuRef{}, err
+	}
+	return cpuRef{typ: v.typ, frame: v.off, run: v.run}, nil
+}
+
+// offset is the location of the value of type t that starts word off into
+// the value at r.
+func offset(r cpuRef, off int, t string) cpuRef {
+	if r.addr == nil {
+		return cpuRef{typ: t, frame: r.frame + off, run: r.run}
+	}
+	addr := r.addr
+	return cpuRef{typ: t, frame: -1, run: r.run, addr: func(in *cpuInv) ([]uint32, int) {
+		mem, o := addr(in)
+		if o < 0 {
+			return mem, o
+		}
+		return mem, o + off
+	}}
+}
+
+// element compiles buf[i], for a buffer or shared array buf of elements of
+// type t.
+func (c *cpuCompiler) element(ex *ast.IndexExpr, t string) (cpuRef, error) {
+	mem, err := c.array(ex.X)
+	if err != nil {
+		return cpuRef{}, err
+	}
+	idx, err := c.expr(ex.Index, "int")
+	if err != nil {
+		return cpuRef{}, err
+	}
+	stride := uint64(c.layout(t).size)
+	return cpuRef{typ: t, frame: -1, run: idx.run, addr: func(in *cpuInv) ([]uint32, int) {
+		m := mem(in)
+		// A negative int index is a huge uint32: out of bounds too.
+		if o := uint64(in.w[idx.off]) * stride; o < uint64(len(m)) {
+			return m, int(o)
+		}
+		return m, -1
+	}}, nil
+}
+
+// array returns the words of buffer or shared array e.
+func (c *cpuCompiler) array(e ast.Expr) (func(in *cpuInv) []uint32, error) {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	if ok {
+		if _, local := c.scope.lookup(id.Name); !local {
+			if r, ok := c.res[id.Name]; ok && !r.uniform {
+				k := r.index
+				return func(in *cpuInv) []uint32 { return in.bufs[k] }, nil
+			}
+			if r, ok := c.shared[id.Name]; ok {
+				k := r.index
+				return func(in *cpuInv) []uint32 { return in.shared[k] }, nil
+			}
+		}
+	}
+	return nil, c.errorf(e, "%s is not a buffer or shared array", exprString(e))
+}
+
+func (c *cpuCompiler) unary(ex *ast.UnaryExpr, t string) (cpuVal, error) {
+	x, err := c.expr(ex.X, t)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	if ex.Op == token.ADD {
+		return x, nil
+	}
+	var f func(uint32) uint32
+	switch {
+	case ex.Op == token.NOT:
+		f = func(a uint32) uint32 { return a ^ 1 }
+	case ex.Op == token.XOR:
+		f = func(a uint32) uint32 { return ^a }
+	case scalarOf(x.typ) == "float":
+		f = func(a uint32) uint32 { return a ^ 1<<31 }
+	default:
+		f = func(a uint32) uint32 { return -a }
+	}
+	dst, n := c.alloc(x.typ), lanes(x.typ)
+	return cpuVal{typ: x.typ, off: dst, run: seq(x.run, func(in *cpuInv) {
+		for i := range n {
+			in.w[dst+i] = f(in.w[x.off+i])
+		}
+	})}, nil
+}
+
+func (c *cpuCompiler) binary(ex *ast.BinaryExpr, t string) (cpuVal, error) {
+	xo, err := c.operand(ex.X)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	yo, err := c.operand(ex.Y)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	var wantX, wantY string
+	switch ex.Op {
+	case token.LAND, token.LOR:
+		x, err := c.expr(ex.X, "bool")
+		if err != nil {
+			return cpuVal{}, err
+		}
+		y, err := c.expr(ex.Y, "bool")
+		if err != nil {
+			return cpuVal{}, err
+		}
+		dst, and := c.alloc("bool"), ex.Op == token.LAND
+		return cpuVal{typ: "bool", off: dst, run: func(in *cpuInv) {
+			x.run.call(in)
+			if (in.w[x.off] != 0) != and {
+				in.w[dst] = in.w[x.off]
+				return
+			}
+			y.run.call(in)
+			in.w[dst] = in.w[y.off]
+		}}, nil
+	case token.SHL, token.SHR:
+		wantX, wantY = t, "uint"
+	default:
+		// An untyped operand takes the other's (component) type.
+		common := t
+		switch {
+		case !xo.untyped():
+			common = resolve(xo, "")
+		case !yo.untyped():
+			common = resolve(yo, "")
+		case t == "bool":
+			common = resolve(xo, "")
+		}
+		wantX, wantY = scalarOf(common), scalarOf(common)
+	}
+	x, err := c.expr(ex.X, wantX)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	y, err := c.expr(ex.Y, wantY)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	rt, f, err := c.binop(ex, ex.Op, x.typ, y.typ)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	dst := c.alloc(rt)
+	return cpuVal{typ: rt, off: dst, run: seq(x.run, y.run, func(in *cpuInv) { f(in.w, dst, x.off, y.off) })}, nil
+}
+
+// binop compiles x op y for operands of types xt and yt, returning the
+// result type and a func computing it from frame words a and b into frame
+// words d, which may be a's.
+func (c *cpuCompiler) binop(n ast.Node, op token.Token, xt, yt string) (string, func(w []uint32, d, a, b int), error) {
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		cmp := compareOp(op, xt)
+		return "bool", func(w []uint32, d, a, b int) {
+			if cmp(w[a], w[b]) {
+				w[d] = 1
+			} else {
+				w[d] = 0
+			}
+		}, nil
+	case token.MUL:
+		switch {
+		case xt == "float4x4" && yt == "float4x4":
+			return xt, func(w []uint32, d, a, b int) {
+				var r [16]uint32
+				for col := range 4 {
+					for row := range 4 {
+						var s float32
+						for k := range 4 {
+							s += f32(w[a+k*4+row]) * f32(w[b+col*4+k])
+						}
+						r[col*4+row] = w32(s)
+					}
+				}
+				copy(w[d:d+16], r[:])
+			}, nil
+		case xt == "float4x4" && yt == "float4":
+			return yt, func(w []uint32, d, a, b int) {
+				var r [4]uint32
+				for row := range 4 {
+					var s float32
+					for k := range 4 {
+						s += f32(w[a+k*4+row]) * f32(w[b+k])
+					}
+					r[row] = w32(s)
+				}
+				copy(w[d:d+4], r[:])
+			}, nil
+		case xt == "float4" && yt == "float4x4":
+			return xt, func(w []uint32, d, a, b int) {
+				var r [4]uint32
+				for col := range 4 {
+					var s float32
+					for k := range 4 {
+						s += f32(w[a+k]) * f32(w[b+col*4+k])
+					}
+					r[col] = w32(s)
+				}
+				copy(w[d:d+4], r[:])
+			}, nil
+		}
+	}
+	rt := xt
+	if lanes(yt) > lanes(xt) {
+		rt = yt
+	}
+	f := scalarOp(op, scalarOf(rt))
+	if f == nil {
+		return "", nil, c.errorf(n, "unsupported operator %s on %s", op, goName(rt))
+	}
+	k, as, bs := lanes(rt), min(lanes(xt)-1, 1), min(lanes(yt)-1, 1)
+	if k == 1 {
+		return rt, func(w []uint32, d, a, b int) { w[d] = f(w[a], w[b]) }, nil
+	}
+	return rt, func(w []uint32, d, a, b int) {
+		for i := range k {
+			w[d+i] = f(w[a+i*as], w[b+i*bs])
+		}
+	}, nil
+}
+
+// scalarOp is op on scalars of type t: float32 arithmetic, or wrapping
+// 32-bit integer arithmetic with WGSL's division by zero and shift counts
+// taken modulo 32.
+func scalarOp(op token.Token, t string) func(a, b uint32) uint32 {
+	if t == "float" {
+		switch op {
+		case token.ADD:
+			return func(a, b uint32) uint32 { return w32(f32(a) + f32(b)) }
+		case token.SUB:
+			return func(a, b uint32) uint32 { return w32(f32(a) - f32(b)) }
+		case token.MUL:
+			return func(a, b uint32) uint32 { return w32(f32(a) * f32(b)) }
+		case token.QUO:
+			return func(a, b uint32) uint32 { return w32(f32(a) / f32(b)) }
+		}
+		return nil
+	}
+	signed := t == "int"
+	switch op {
+	case token.ADD:
+		return func(a, b uint32) uint32 { return a + b }
+	case token.SUB:
+		return func(a, b uint32) uint32 { return a - b }
+	case token.MUL:
+		return func(a, b uint32) uint32 { return a * b }
+	case token.QUO:
+		if signed {
+			return func(a, b uint32) uint32 {
+				if b == 0 {
+					return a
+				}
+				return uint32(int32(a) / int32(b))
+			}
+		}
+		return func(a, b uint32) uint32 {
+			if b == 0 {
+				return a
+			}
+			return a / b
+		}
+	case token.REM:
+		if signed {
+			return func(a, b uint32) uint32 {
+				if b == 0 {
+					return 0
+				}
+				return uint32(int32(a) % int32(b))
+			}
+		}
+		return func(a, b uint32) uint32 {
+			if b == 0 {
+				return 0
+			}
+			return a % b
+		}
+	case token.AND:
+		return func(a, b uint32) uint32 { return a & b }
+	case token.OR:
+		return func(a, b uint32) uint32 { return a | b }
+	case token.XOR:
+		return func(a, b uint32) uint32 { return a ^ b }
+	case token.AND_NOT:
+		return func(a, b uint32) uint32 { return a &^ b }
+	case token.SHL:
+		return func(a, b uint32) uint32 { return a << (b & 31) }
+	case token.SHR:
+		if signed {
+			return func(a, b uint32) uint32 { return uint32(int32(a) >> (b & 31)) }
+		}
+		return func(a, b uint32) uint32 { return a >> (b & 31) }
+	}
+	return nil
+}
+
+// compareOp is comparison op on scalars (or bools) of type t.
+func compareOp(op token.Token, t string) func(a, b uint32) bool {
+	switch op {
+	case token.EQL:
+		if t == "float" {
+			return func(a, b uint32) bool { return f32(a) == f32(b) }
+		}
+		return func(a, b uint32) bool { return a == b }
+	case token.NEQ:
+		if t == "float" {
+			return func(a, b uint32) bool { return f32(a) != f32(b) }
+		}
+		return func(a, b uint32) bool { return a != b }
+	}
+	less := func(a, b uint32) bool { return a < b }
+	switch t {
+	case "float":
+		less = func(a, b uint32) bool { return f32(a) < f32(b) }
+	case "int":
+		less = func(a, b uint32) bool { return int32(a) < int32(b) }
+	}
+	switch op {
+	case token.LSS:
+		return less
+	case token.GTR:
+		return func(a, b uint32) bool { return less(b, a) }
+	case token.LEQ:
+		if t == "float" {
+			return func(a, b uint32) bool { return f32(a) <= f32(b) }
+		}
+		return func(a, b uint32) bool { return !less(b, a) }
+	}
+	if t == "float" {
+		return func(a, b uint32) bool { return f32(a) >= f32(b) }
+	}
+	return func(a, b uint32) bool { return !less(a, b) }
+}
+
+func (c *cpuCompiler) call(ex *ast.CallExpr, t string) (cpuVal, error) {
+	if sel, ok := ex.Fun.(*ast.SelectorExpr); ok {
+		return c.method(ex, sel)
+	}
+	name := ex.Fun.(*ast.Ident).Name
+	switch {
+	case name == "WorkgroupBarrier":
+		return cpuVal{run: func(*cpuInv) { gpumath.WorkgroupBarrier() }}, nil
+	case atomicOps[name] != (atomicOp{}):
+		return c.atomic(ex, name)
+	case c.funcs[name] != nil:
+		return c.callHelper(ex, name)
+	case vecCtor[name] != "":
+		return c.construct(vecCtor[name], ex.Args)
+	}
+	switch mt := builtins[name]; mt {
+	case "float", "int", "uint":
+		x, err := c.expr(ex.Args[0], mt)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		return c.convert(x, mt), nil
+	case "dfdx", "dfdy":
+		return c.derivative(ex, mt)
+	default:
+		return c.builtin(ex, mt)
+	}
+}
+
+// derivative compiles Dfdx or Dfdy of a field of the fragment kernel's
+// input struct, which the checker allows only: it reads the field of the
+// copy of the struct that Fragment fills with the derivatives along x or y.
+func (c *cpuCompiler) derivative(ex *ast.CallExpr, mt string) (cpuVal, error) {
+	r, err := c.ref(ex.Args[0])
+	if err != nil {
+		return cpuVal{}, err
+	}
+	k := 0
+	if mt == "dfdy" {
+		k = 1
+	}
+	if c.deriv[k] < 0 {
+		c.deriv[k] = c.alloc(c.inType)
+	}
+	return c.load(cpuRef{typ: r.typ, run: r.run, frame: c.deriv[k] + r.frame - c.stageIn}), nil
+}
+
+// convert converts x to scalar type t. A float converts to an integer
+// truncated toward zero and clamped to its range, NaN to zero; an int and a
+// uint convert keeping their bits.
+func (c *cpuCompiler) convert(x cpuVal, t string) cpuVal {
+	var f func(uint32) uint32
+	switch {
+	case x.typ == t || x.typ != "float" && t != "float":
+		return cpuVal{typ: t, off: x.off, run: x.run}
+	case t == "float" && x.typ == "int":
+		f = func(a uint32) uint32 { return w32(float32(int32(a))) }
+	case t == "float":
+		f = func(a uint32) uint32 { return w32(float32(a)) }
+	case t == "int":
+		f = func(a uint32) uint32 {
+			v := f32(a)
+			switch {
+			case v != v:
+				return 0
+			case v <= math.MinInt32:
+				return 1 << 31
+			case v >= math.MaxInt32:
+				return math.MaxInt32
+			}
+			return uint32(int32(v))
+		}
+	default:
+		f = func(a uint32) uint32 {
+			v := f32(a)
+			switch {
+			case !(v > 0):
+				return 0
+			case v >= math.MaxUint32:
+				return math.MaxUint32
+			}
+			return uint32(v)
+		}
+	}
+	dst := c.alloc(t)
+	return cpuVal{typ: t, off: dst, run: seq(x.run, func(in *cpuInv) { in.w[dst] = f(in.w[x.off]) })}
+}
+
+// atomic compiles an atomic update of a []uint32 element; out of bounds it
+// updates nothing and returns zero.
+func (c *cpuCompiler) atomic(ex *ast.CallExpr, name string) (cpuVal, error) {
+	mem, err := c.array(ex.Args[0])
+	if err != nil {
+		return cpuVal{}, err
+	}
+	i, err := c.expr(ex.Args[1], "int")
+	if err != nil {
+		return cpuVal{}, err
+	}
+	v, err := c.expr(ex.Args[2], "uint")
+	if err != nil {
+		return cpuVal{}, err
+	}
+	op := map[string]func([]uint32, uint, uint32) uint32{
+		"AtomicAddU32": gpumath.AtomicAddU32,
+		"AtomicMinU32": gpumath.AtomicMinU32,
+		"AtomicMaxU32": gpumath.AtomicMaxU32,
+	}[name]
+	dst := c.alloc("uint")
+	return cpuVal{typ: "uint", off: dst, run: seq(i.run, v.run, func(in *cpuInv) {
+		m, k := mem(in), in.w[i.off]
+		if int(k) >= len(m) {
+			in.w[dst] = 0
+			return
+		}
+		in.w[dst] = op(m, uint(k), in.w[v.off])
+	})}, nil
+}
+
+// callHelper compiles a call of helper name: the arguments are computed,
+// then copied to its parameters, and its result copied out of its frame
+// words before another call can change them.
+func (c *cpuCompiler) callHelper(ex *ast.CallExpr, name string) (cpuVal, error) {
+	h, err := c.helper(name)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	args := make([]cpuVal, len(ex.Args))
+	for i, a := range ex.Args {
+		if args[i], err = c.expr(a, h.types[i]); err != nil {
+			return cpuVal{}, err
+		}
+	}
+	sizes := make([]int, len(args))
+	for i, t := range h.types {
+		sizes[i] = c.words(t)
+	}
+	res := cpuVal{typ: h.retType, off: -1}
+	n := 0
+	if h.retType != "" {
+		res.off, n = c.alloc(h.retType), c.words(h.retType)
+	}
+	res.run = func(in *cpuInv) {
+		for _, a := range args {
+			a.run.call(in)
+		}
+		for i, a := range args {
+			p := h.params[i]
+			copy(in.w[p:p+sizes[i]], in.w[a.off:a.off+sizes[i]])
+		}
+		h.body(in)
+		if n > 0 {
+			copy(in.w[res.off:res.off+n], in.w[h.ret:h.ret+n])
+		}
+	}
+	return res, nil
+}
+
+// helper compiles helper name, once per kernel, into frame words of its
+// own: it cannot recurse, so no call of it is running when it is called.
+func (c *cpuCompiler) helper(name string) (*cpuFunc, error) {
+	if h := c.helpers[name]; h != nil {
+		return h, nil
+	}
+	fn := c.funcs[name]
+	sig, err := helperSig(fn, c.structs)
+	if err != nil {
+		return nil, c.errorf(fn, "func %s: %v", name, err)
+	}
+	saved, chkSaved, results, cur := c.scope, c.chk.scope, c.chk.results, c.fn
+	defer func() { c.scope, c.chk.scope, c.chk.results, c.fn = saved, chkSaved, results, cur }()
+	c.scope = &cpuScope{vars: map[string]int{}}
+	c.chk.scope = &scope{vars: map[string]variable{}, parent: c.globals}
+	c.chk.results = sig.results
+	h := &cpuFunc{types: sig.types, retType: sig.ret}
+	for i, p := range sig.params {
+		h.params = append(h.params, c.declare(p.name, sig.types[i]))
+	}
+	if sig.ret != "" {
+		h.ret = c.alloc(sig.ret)
+	}
+	c.fn = h
+	if h.body, err = c.stmts(fn.Body.List); err != nil {
+		return nil, err
+	}
+	c.helpers[name] = h
+	return h, nil
+}
+
+// construct compiles a vector or matrix from its components, a matrix from
+// its columns.
+func (c *cpuCompiler) construct(t string, exprs []ast.Expr) (cpuVal, error) {
+	dst := c.alloc(t)
+	var runs []cpuRun
+	pos := 0
+	for _, e := range exprs {
+		want := "float"
+		if t == "float4x4" {
+			want = "float4"
+		}
+		v, err := c.expr(e, want)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		n, at, src := vecLen(v.typ), dst+pos, v.off
+		runs = append(runs, v.run, func(in *cpuInv) { copy(in.w[at:at+n], in.w[src:src+n]) })
+		pos += n
+	}
+	return cpuVal{typ: t, off: dst, run: seq(runs...)}, nil
+}
+
+func (c *cpuCompiler) compositeLit(ex *ast.CompositeLit) (cpuVal, error) {
+	tname, _ := identType(ex.Type)
+	if mt, ok := goToMSLType(tname); ok {
+		return c.construct(mt, ex.Elts)
+	}
+	l := c.layout(tname)
+	dst := c.alloc(tname)
+	var runs []cpuRun
+	for i, e := range ex.Elts {
+		f := l.fields[i]
+		if kv, ok := e.(*ast.KeyValueExpr); ok {
+			for _, g := range l.fields {
+				if g.name == kv.Key.(*ast.Ident).Name {
+					f = g
+				}
+			}
+			e = kv.Value
+		}
+		v, err := c.expr(e, f.typ)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		runs = append(runs, c.store(&cpuRef{typ: f.typ, frame: dst + f.off}, v))
+	}
+	return cpuVal{typ: tname, off: dst, run: seq(runs...)}, nil
+}
+
+// builtin compiles a call of math builtin mt, its arguments of the first
+// typed argument's type (a float32 if none is), mix's weight perhaps a
+// float32.
+func (c *cpuCompiler) builtin(ex *ast.CallExpr, mt string) (cpuVal, error) {
+	t := "float"
+	for _, a := range ex.Args {
+		x, err := c.operand(a)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		if !x.untyped() {
+			t = x.typ
+			break
+		}
+	}
+	args := make([]cpuVal, len(ex.Args))
+	for i, a := range ex.Args {
+		v, err := c.expr(a, scalarOf(t))
+		if err != nil {
+			return cpuVal{}, err
+		}
+		args[i] = v
+	}
+	var runs []cpuRun
+	for _, a := range args {
+		runs = append(runs, a.run)
+	}
+	run := seq(runs...)
+	n, s := lanes(t), scalarOf(t)
+	// val is the result of type typ that f computes into frame words dst.
+	val := func(typ string, f func(w []uint32, dst int)) cpuVal {
+		dst := c.alloc(typ)
+		return cpuVal{typ: typ, off: dst, run: seq(run, func(in *cpuInv) { f(in.w, dst) })}
+	}
+	// lanewise applies f to the components of the arguments, a scalar
+	// argument (mix's weight) standing for each.
+	lanewise := func(f func(a []uint32) uint32) cpuVal {
+		offs := make([]int, len(args))
+		steps := make([]int, len(args))
+		for i, a := range args {
+			offs[i], steps[i] = a.off, min(lanes(a.typ)-1, 1)
+		}
+		return val(t, func(w []uint32, dst int) {
+			var in [3]uint32
+			for k := range n {
+				for i, off := range offs {
+					in[i] = w[off+k*steps[i]]
+				}
+				w[dst+k] = f(in[:len(offs)])
+			}
+		})
+	}
+	float1 := func(f func(float64) float64) cpuVal {
+		return lanewise(func(a []uint32) uint32 { return w32(float32(f(float64(f32(a[0]))))) })
+	}
+	a0 := args[0].off
+	switch mt {
+	case "sqrt":
+		return float1(math.Sqrt), nil
+	case "floor":
+		return float1(math.Floor), nil
+	case "ceil":
+		return float1(math.Ceil), nil
+	case "round":
+		return float1(math.Round), nil
+	case "sin":
+		return float1(math.Sin), nil
+	case "cos":
+		return float1(math.Cos), nil
+	case "tan":
+		return float1(math.Tan), nil
+	case "asin":
+		return float1(math.Asin), nil
+	case "acos":
+		return float1(math.Acos), nil
+	case "exp":
+		return float1(math.Exp), nil
+	case "log":
+		return float1(math.Log), nil
+	case "atan":
+		if len(args) == 2 {
+			return lanewise(func(a []uint32) uint32 {
+				return w32(float32(math.Atan2(float64(f32(a[0])), float64(f32(a[1])))))
+			}), nil
+		}
+		return float1(math.Atan), nil
+	case "fract":
+		return lanewise(func(a []uint32) uint32 {
+			x := f32(a[0])
+			return w32(x - float32(math.Floor(float64(x))))
+		}), nil
+	case "pow":
+		return lanewise(func(a []uint32) uint32 {
+			return w32(float32(math.Pow(float64(f32(a[0])), float64(f32(a[1])))))
+		}), nil
+	case "abs":
+		switch s {
+		case "float":
+			return lanewise(func(a []uint32) uint32 { return a[0] &^ (1 << 31) }), nil
+		case "int":
+			return lanewise(func(a []uint32) uint32 {
+				if int32(a[0]) < 0 {
+					return -a[0]
+				}
+				return a[0]
+			}), nil
+		}
+		return lanewise(func(a []uint32) uint32 { return a[0] }), nil
+	case "min", "max", "clamp":
+		less := compareOp(token.LSS, s)
+		lo := func(a, b uint32) uint32 {
+			if less(b, a) {
+				return b
+			}
+			return a
+		}
+		hi := func(a, b uint32) uint32 {
+			if less(a, b) {
+				return b
+			}
+			return a
+		}
+		switch mt {
+		case "min":
+			return lanewise(func(a []uint32) uint32 { return lo(a[0], a[1]) }), nil
+		case "max":
+			return lanewise(func(a []uint32) uint32 { return hi(a[0], a[1]) }), nil
+		}
+		return lanewise(func(a []uint32) uint32 { return lo(hi(a[0], a[1]), a[2]) }), nil
+	case "mix":
+		return lanewise(func(a []uint32) uint32 {
+			x, y, w := f32(a[0]), f32(a[1]), f32(a[2])
+			return w32(x + (y-x)*w)
+		}), nil
+	case "dot":
+		a1 := args[1].off
+		return val("float", func(w []uint32, dst int) { w[dst] = w32(dot(w, a0, a1, n)) }), nil
+	case "length":
+		return val("float", func(w []uint32, dst int) { w[dst] = w32(length(w, a0, n)) }), nil
+	case "normalize":
+		return val(t, func(w []uint32, dst int) { normalize(w, dst, a0, n) }), nil
+	case "cross":
+		a1 := args[1].off
+		return val(t, func(w []uint32, dst int) {
+			x, y := w[a0:a0+3], w[a1:a1+3]
+			r := [3]float32{
+				f32(x[1])*f32(y[2]) - f32(x[2])*f32(y[1]),
+				f32(x[2])*f32(y[0]) - f32(x[0])*f32(y[2]),
+				f32(x[0])*f32(y[1]) - f32(x[1])*f32(y[0]),
+			}
+			for i, v := range r {
+				w[dst+i] = w32(v)
+			}
+		}), nil
+	case "reflect":
+		a1 := args[1].off
+		return val(t, func(w []uint32, dst int) {
+			d := 2 * dot(w, a1, a0, n)
+			for i := range n {
+				w[dst+i] = w32(f32(w[a0+i]) - d*f32(w[a1+i]))
+			}
+		}), nil
+	}
+	return cpuVal{}, c.errorf(ex, "builtin %s is not supported on the CPU", mt)
+}
+
+func dot(w []uint32, a, b, n int) float32 {
+	var s float32
+	for i := range n {
+		s += f32(w[a+i]) * f32(w[b+i])
+	}
+	return s
+}
+
+func length(w []uint32, a, n int) float32 {
+	return float32(math.Sqrt(float64(dot(w, a, a, n))))
+}
+
+// normalize is gpumath's: a zero vector stays zero.
+func normalize(w []uint32, d, a, n int) {
+	l := length(w, a, n)
+	if l == 0 {
+		copy(w[d:d+n], w[a:a+n])
+		return
+	}
+	for i := range n {
+		w[d+i] = w32(f32(w[a+i]) * (1 / l))
+	}
+}
+
+// method compiles a vector or matrix method or a texture sample.
+func (c *cpuCompiler) method(ex *ast.CallExpr, sel *ast.SelectorExpr) (cpuVal, error) {
+	recv, err := c.operand(sel.X)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	name := sel.Sel.Name
+	if textureCoords[recv.typ] != nil || recv.typ == "texture2d_ms" {
+		return c.sample(ex, sel, recv.typ)
+	}
+	x, err := c.expr(sel.X, "")
+	if err != nil {
+		return cpuVal{}, err
+	}
+	var args []cpuVal
+	for _, a := range ex.Args {
+		v, err := c.expr(a, "float")
+		if err != nil {
+			return cpuVal{}, err
+		}
+		args = append(args, v)
+	}
+	op := map[string]token.Token{"Add": token.ADD, "Sub": token.SUB, "Mul": token.MUL, "Scale": token.MUL, "Div": token.QUO, "MulV": token.MUL}[name]
+	if op != token.ILLEGAL {
+		rt, f, err := c.binop(ex, op, x.typ, args[0].typ)
+		if err != nil {
+			return cpuVal{}, err
+		}
+		dst, y := c.alloc(rt), args[0]
+		return cpuVal{typ: rt, off: dst, run: seq(x.run, y.run, func(in *cpuInv) { f(in.w, dst, x.off, y.off) })}, nil
+	}
+	n := vecLen(x.typ)
+	switch name {
+	case "Dot":
+		dst, y := c.alloc("float"), args[0]
+		return cpuVal{typ: "float", off: dst, run: seq(x.run, y.run, func(in *cpuInv) { in.w[dst] = w32(dot(in.w, x.off, y.off, n)) })}, nil
+	case "Length":
+		dst := c.alloc("float")
+		return cpuVal{typ: "float", off: dst, run: seq(x.run, func(in *cpuInv) { in.w[dst] = w32(length(in.w, x.off, n)) })}, nil
+	case "Normalize":
+		dst := c.alloc(x.typ)
+		return cpuVal{typ: x.typ, off: dst, run: seq(x.run, func(in *cpuInv) { normalize(in.w, dst, x.off, n) })}, nil
+	}
+	return cpuVal{}, c.errorf(sel.Sel, "unsupported method %q on %s", name, goName(x.typ))
+}
+
+// sample compiles a texture's Sample, SampleLevel, SampleCompare or Load.
+func (c *cpuCompiler) sample(ex *ast.CallExpr, sel *ast.SelectorExpr, tt string) (cpuVal, error) {
+	tex, err := c.resource(sel.X)
+	if err != nil {
+		return cpuVal{}, err
+	}
+	want := append([]string{"sampler"}, textureCoords[tt]...)
+	switch sel.Sel.Name {
+	case "SampleLevel":
+		want = append(want, "float")
+	case "SampleCompare":
+		want = []string{"sampler_comparison", "float2", "float"}
+	case "Load":
+		want = []string{"int", "int", "int"}
+	}
+	samp := -1
+	var args []cpuVal
+	for i, a := range ex.Args {
+		if i == 0 && sel.Sel.Name != "Load" {
+			if samp, err = c.resource(a); err != nil {
+				return cpuVal{}, err
+			}
+			continue
+		}
+		v, err := c.expr(a, want[i])
+		if err != nil {
+			return cpuVal{}, err
+		}
+		args = append(args, v)
+	}
+	var runs []cpuRun
+	for _, a := range args {
+		runs = append(runs, a.run)
+	}
+	run := seq(runs...)
+	coord := args[0]
+	if sel.Sel.Name == "Load" {
+		dst, y, s := c.alloc("float4"), args[1], args[2]
+		return cpuVal{typ: "float4", off: dst, run: seq(run, func(in *cpuInv) {
+			w := in.w
+			putVec4(w[dst:], in.tex[tex].Load(int(int32(w[coord.off])), int(int32(w[y.off])), int(int32(w[s.off]))))
+		})}, nil
+	}
+	if sel.Sel.Name == "SampleCompare" {
+		dst, ref := c.alloc("float"), args[1]
+		return cpuVal{typ: "float", off: dst, run: seq(run, func(in *cpuInv) {
+			w := in.w
+			uv := [2]float32{f32(w[coord.off]), f32(w[coord.off+1])}
+			w[dst] = w32(in.tex[tex].SampleCompare(in.samp[samp], uv, f32(w[ref.off])))
+		})}, nil
+	}
+	n := vecLen(coord.typ)
+	layer, lod := -1, -1
+	rest := args[1:]
+	if tt == "texture2d_array" {
+		layer, rest = rest[0].off, rest[1:]
+	}
+	if len(rest) > 0 {
+		lod = rest[0].off
+	}
+	dst := c.alloc("float4")
+	return cpuVal{typ: "float4", off: dst, run: seq(run, func(in *cpuInv) {
+		w := in.w
+		var uvw [3]float32
+		for i := range n {
+			uvw[i] = f32(w[coord.off+i])
+		}
+		l, level := 0, float32(0)
+		if layer >= 0 {
+			l = int(int32(w[layer]))
+		}
+		if lod >= 0 {
+			level = f32(w[lod])
+		}
+		putVec4(w[dst:], in.tex[tex].Sample(in.samp[samp], uvw, l, level))
+	})}, nil
+}
+
+// resource returns the binding of texture or sampler e.
+func (c *cpuCompiler) resource(e ast.Expr) (int, error) {
+	if id, ok := ast.Unparen(e).(*ast.Ident); ok {
+		if r, ok := c.res[id.Name]; ok {
+			return r.index, nil
+		}
+	}
+	return 0, c.errorf(e, "%s is not a texture or sampler parameter", exprString(e))
+}
+
+func putVec4(w []uint32, v [4]float32) {
+	for i, f := range v {
+		w[i] = w32(f)
+	}
+}
+
+func f32(w uint32) float32 { return math.Float32frombits(w) }
+func w32(f float32) uint32 { return math.Float32bits(f) }
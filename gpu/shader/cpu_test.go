@@ -0,0 +1,355 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"poly.red/gpu/shader/gpumath"
+	gokernels "poly.red/gpu/shader/gpumath/kernels"
+)
+
+// cpuBuffer lays elems out as a buffer a Program binds.
+func cpuBuffer[T any](t *testing.T, elems []T) []byte {
+	t.Helper()
+	b, err := Layout(elems)
+	if err != nil {
+		t.Fatalf("Layout: %v", err)
+	}
+	return b
+}
+
+func cpuFloats(b []byte) []float32 {
+	out := make([]float32, len(b)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return out
+}
+
+func cpuUints(b []byte) []uint32 {
+	out := make([]uint32, len(b)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return out
+}
+
+// cpuKernel compiles kernel name of src for the CPU and binds it to res.
+func cpuKernel(t *testing.T, src, name string, res Resources) (*Kernel, *Bound) {
+	t.Helper()
+	ks, err := CompileCPU(src)
+	if err != nil {
+		t.Fatalf("CompileCPU: %v", err)
+	}
+	k := ks[name]
+	if k == nil || k.CPU == nil {
+		t.Fatalf("kernel %s not compiled", name)
+	}
+	b, err := k.CPU.Bind(res)
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	return k, b
+}
+
+func TestCPUCompute(t *testing.T) {
+	a := cpuBuffer(t, []float32{1, 2, 3, 4, 5, 6})
+	b := cpuBuffer(t, []float32{6, 5, 4, 3, 2, 1, 0, 1, 2, 3, 4, 5})
+	out := cpuBuffer(t, make([]float32, 4))
+	params := cpuBuffer(t, []struct{ WidthA, HeightA, WidthB uint32 }{{3, 2, 2}})
+	k, bound := cpuKernel(t, kernels, "Mul", Resources{Buffers: [][]byte{a, b, out, params}})
+	if len(k.Bindings) != 4 || k.Bindings[3].Kind != UniformBuffer {
+		t.Fatalf("Mul bindings = %+v, want three buffers and a uniform", k.Bindings)
+	}
+	bound.Dispatch(4, 0)
+	// [1 2 3; 4 5 6] x [6 5; 4 3; 2 1]
+	want := []float32{20, 14, 56, 41}
+	for i, got := range cpuFloats(out) {
+		if got != want[i] {
+			t.Fatalf("Mul = %v, want %v", cpuFloats(out), want)
+		}
+	}
+}
+
+// TestCPUSemantics runs control flow, helpers, vectors, matrices and
+// integer edge cases, each invocation writing one result.
+func TestCPUSemantics(t *testing.T) {
+	const src = `package k
+
+type Vec2 struct{ X, Y float32 }
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+type Mat4 struct{ C0, C1, C2, C3 Vec4 }
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func pick(i int) float32 {
+	switch i {
+	case 0, 1:
+		return 10
+	case 2:
+		return 20
+	}
+	return 30
+}
+
+func K(gid uint, lights []Vec4, out []float32, iout []int32) {
+	switch gid {
+	case 0:
+		q, r := divmod(-7, 2)
+		iout[0] = int32(q*10 + r)
+	case 1:
+		q, r := divmod(7, 0)
+		iout[1] = int32(q*10 + r)
+	case 2:
+		n := 0
+	outer:
+		for i := 0; i < 10; i++ {
+			for j := 0; j < 10; j++ {
+				if j == 3 {
+					continue outer
+				}
+				if i == 4 {
+					break outer
+				}
+				n++
+			}
+		}
+		iout[2] = int32(n)
+	case 3:
+		m := M4(V4(1, 0, 0, 0), V4(0, 2, 0, 0), V4(0, 0, 3, 0), V4(4, 5, 6, 1))
+		v := m.MulV(V4(1, 1, 1, 1))
+		w := m * m * V4(1, 0, 0, 1)
+		out[3] = v.X + v.Y*10 + v.Z*100 + w.X*1000
+	case 4:
+		v := V3(3, 4, 12)
+		out[4] = length(v) + normalize(V3(0, 0, 0)).X + dot(v.xy, Vec2{1, 1})
+	case 5:
+		out[5] = pick(0) + pick(2) + pick(7)
+	case 6:
+		s := uint(33)
+		x := uint(1) << s
+		y := -8 >> 1
+		iout[6] = int32(x) + int32(y)*100
+	case 7:
+		v := Vec4{1, 2, 3, 4}
+		v.xy = v.yx
+		v.W += 10
+		i := 2
+		v[i] = 7
+		out[7] = v.X*1000 + v.Y*100 + v.Z*10 + v.W
+	case 8:
+		out[8] = lights[1].Z + lights[99].X
+		lights[99].X = 5
+	case 9:
+		neg, big := float32(-2.5), float32(1e20)
+		out[9] = clamp(float32(int(neg)), -1, 1) + mix(2, 4, 0.25) + float32(int(big)/1000000000)
+	}
+}
+`
+	lights := cpuBuffer(t, []gpumath.Vec4{{X: 1, Y: 2, Z: 3, W: 4}, {X: 5, Y: 6, Z: 7, W: 8}})
+	out := cpuBuffer(t, make([]float32, 10))
+	iout := cpuBuffer(t, make([]int32, 10))
+	_, bound := cpuKernel(t, src, "K", Resources{Buffers: [][]byte{lights, out, iout}})
+	bound.Dispatch(10, 0)
+
+	f, i := cpuFloats(out), cpuUints(iout)
+	for _, c := range []struct {
+		name      string
+		got, want float32
+	}{
+		{"matrices", f[3], 5 + 7*10 + 9*100 + 9*1000},
+		{"vectors", f[4], 13 + 0 + 7},
+		{"helper switch", f[5], 10 + 20 + 30},
+		{"swizzles", f[7], 2000 + 100 + 70 + 14},
+		{"out of bounds", f[8], 7},
+		{"conversions", f[9], -1 + 2.5 + 2},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		name      string
+		got, want int32
+	}{
+		{"negative division", int32(i[0]), -30 - 1},
+		{"division by zero", int32(i[1]), 70},
+		{"labeled loops", int32(i[2]), 12},
+		{"shifts", int32(i[6]), 2 - 400},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+// TestCPUWorkgroup runs the reduction and histogram of workgroupKernelSrc.
+func TestCPUWorkgroup(t *testing.T) {
+	in := make([]float32, 128)
+	var want [2]float32
+	for i := range in {
+		in[i] = float32(i%16) / 16
+		want[i/64] += in[i]
+	}
+	inBuf := cpuBuffer(t, in)
+	out := cpuBuffer(t, make([]float32, 2))
+	k, bound := cpuKernel(t, workgroupKernelSrc, "Sum", Resources{Buffers: [][]byte{inBuf, out}})
+	bound.Dispatch(128, k.Workgroup[0])
+	if got := cpuFloats(out); got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Sum = %v, want %v", got, want)
+	}
+
+	hist := cpuBuffer(t, make([]uint32, 17))
+	k, bound = cpuKernel(t, workgroupKernelSrc, "Hist", Resources{Buffers: [][]byte{inBuf, hist}})
+	bound.Dispatch(128, k.Workgroup[0])
+	h := cpuUints(hist)
+	for b := range 16 {
+		if h[b] != 8 {
+			t.Fatalf("Hist = %v, want 8 in each of 16 bins", h)
+		}
+	}
+	if h[16] != 15 {
+		t.Errorf("Hist max bin = %d, want 15", h[16])
+	}
+}
+
+// TestCPURender runs a vertex kernel with varyings, a fragment kernel
+// reading them and its position, and one writing two colors from their
+// derivatives.
+func TestCPURender(t *testing.T) {
+	const src = `package k
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type VOut struct {
+	Pos   Vec4 ` + "`gpu:\"position\"`" + `
+	Color Vec4
+	ID    uint
+}
+
+//gpu:vertex
+func VS(vid uint, iid uint, pos []float32) VOut {
+	return VOut{Pos: V4(pos[vid], 0, 0, 1), Color: V4(float32(iid), 0.5, 0, 1), ID: vid + iid}
+}
+
+//gpu:fragment
+func FS(in VOut) Vec4 {
+	return V4(in.Color.X+in.Pos.X, in.Color.Y, float32(in.ID), in.Pos.W)
+}
+
+type Colors struct{ A, B Vec4 }
+
+//gpu:fragment
+func MRT(in VOut) Colors {
+	return Colors{A: in.Color, B: Dfdx(in.Color) + Dfdy(in.Color)}
+}
+`
+	pos := cpuBuffer(t, []float32{0.25, 0.5})
+	vk, vs := cpuKernel(t, src, "VS", Resources{Buffers: [][]byte{pos}})
+	flat := vk.CPU.Varyings()
+	if len(flat) != 5 || flat[0] || !flat[4] {
+		t.Fatalf("VS varyings = %v, want 4 interpolated and 1 flat", flat)
+	}
+	vary := make([]float32, len(flat))
+	if got := vs.Vertex(1, 3, vary); got != [4]float32{0.5, 0, 0, 1} {
+		t.Errorf("VS position = %v", got)
+	}
+	if vary[0] != 3 || vary[1] != 0.5 || math.Float32bits(vary[4]) != 4 {
+		t.Errorf("VS varyings = %v", vary)
+	}
+	fk, fs := cpuKernel(t, src, "FS", Resources{})
+	got := make([][4]float32, fk.CPU.Targets())
+	fs.Fragment([4]float32{10.5, 2.5, 0.5, 2}, vary, nil, nil, got)
+	if fk.CPU.Derivatives() || len(got) != 1 || got[0] != [4]float32{13.5, 0.5, 4, 2} {
+		t.Errorf("FS = %v, want [13.5 0.5 4 2]", got)
+	}
+	mk, mrt := cpuKernel(t, src, "MRT", Resources{})
+	got = make([][4]float32, mk.CPU.Targets())
+	ddx, ddy := []float32{1, 2, 3, 4, 0}, []float32{10, 20, 30, 40, 0}
+	mrt.Fragment([4]float32{10.5, 2.5, 0.5, 2}, vary, ddx, ddy, got)
+	if !mk.CPU.Derivatives() || len(got) != 2 || got[0] != [4]float32{3, 0.5, 0, 1} || got[1] != [4]float32{11, 22, 33, 44} {
+		t.Errorf("MRT = %v, want [[3 0.5 0 1] [11 22 33 44]]", got)
+	}
+
+	bad := `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct{ Color Vec4 }
+
+//gpu:vertex
+func VS(vid uint) VOut { return VOut{} }
+`
+	if _, err := CompileCPU(bad); err == nil {
+		t.Error("a vertex kernel without a position compiled")
+	}
+}
+
+// TestCPUKernelsParity runs author-once kernels as Go and as Programs on
+// the same inputs.
+func TestCPUKernelsParity(t *testing.T) {
+	close := func(a, b []float32) bool {
+		for i := range a {
+			if d := math.Abs(float64(a[i] - b[i])); d > 1e-5*max(1, math.Abs(float64(a[i]))) {
+				return false
+			}
+		}
+		return true
+	}
+	rnd := func(n int, seed, scale float32) []float32 {
+		out := make([]float32, n)
+		for i := range out {
+			out[i] = float32(math.Mod(float64(seed)*float64(i+1)*7.31, 1)) * scale
+		}
+		return out
+	}
+
+	const px = 64
+	normals, worldpos, basecol := rnd(px*4, 0.37, 2), rnd(px*4, 0.61, 10), rnd(px*4, 0.83, 255)
+	lights := []float32{
+		0, 1, 5, 2, 1, 255, 255, 255, 1, 8, // point light
+		1, 0, -1, -1, 0, 200, 180, 160, 1, 0.5, // directional light
+	}
+	matidx := make([]float32, px)
+	for i := range matidx {
+		matidx[i] = float32(i % 2)
+	}
+	materials := rnd(18, 0.29, 1)
+	materials[8], materials[17] = 16, 64
+	scene := []float32{0, 0, 10, 1, 0.2, 2}
+	want := make([]float32, px*4)
+	for gid := range uint(px) {
+		gokernels.Shade(gid, normals, worldpos, basecol, lights, matidx, materials, scene, want)
+	}
+	out := cpuBuffer(t, make([]float32, px*4))
+	bufs := [][]byte{}
+	for _, b := range [][]float32{normals, worldpos, basecol, lights, matidx, materials, scene} {
+		bufs = append(bufs, cpuBuffer(t, b))
+	}
+	_, bound := cpuKernel(t, gokernels.ShadeSrc, "Shade", Resources{Buffers: append(bufs, out)})
+	bound.Dispatch(px, 0)
+	if got := cpuFloats(out); !close(want, got) {
+		t.Errorf("Shade on the CPU = %v\nas Go = %v", got, want)
+	}
+
+	occluders := []float32{4.5, 2, 0.5, 0.5, 0.5, 0.25}
+	vlights := []float32{0, 2.5, 3.5, 6, 5, 1, 0, -1, 0.5, 0, 7, 0, 0, 100, 100}
+	p := gokernels.VisibilityParams{Width: 8, Lights: 3, Occluders: 2, MaxLights: 2}
+	want = make([]float32, px*2)
+	for gid := range uint(px) {
+		gokernels.Visibility(gid, vlights, occluders, p, want)
+	}
+	out = cpuBuffer(t, make([]float32, px*2))
+	res := Resources{Buffers: [][]byte{cpuBuffer(t, vlights), cpuBuffer(t, occluders), cpuBuffer(t, []gokernels.VisibilityParams{p}), out}}
+	_, bound = cpuKernel(t, gokernels.VisibilitySrc, "Visibility", res)
+	bound.Dispatch(px, 0)
+	if got := cpuFloats(out); !close(want, got) {
+		t.Errorf("Visibility on the CPU = %v\nas Go = %v", got, want)
+	}
+}
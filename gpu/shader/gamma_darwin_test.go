@@ -70,9 +70,12 @@ func TestGoShaderGammaMatchesEngine(t *testing.T) {
 	}
 	inBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst, Data: f32b(in)})
 	outBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4, Usage: gpu.BufferStorage | gpu.BufferMapRead})
-	bg := dev.NewBindGroup(layout,
+	bg, err := dev.NewBindGroup(layout,
 		gpu.BindGroupEntry{Binding: 0, Buffer: inBuf},
 		gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	cp := enc.BeginComputePass()
@@ -137,7 +137,7 @@ func TestCompileGLSLCompute(t *testing.T) {
 	}
 }
 
-// TestCompileGLSLRejectsUnsupported verifies the GLSL compute emitter rejects
+// TestCompileGLSLRejectsUnsupported verifies the GLSL emitter rejects
 // what it does not yet support, with a clear error, rather than emitting bad
 // shader source.
 func TestCompileGLSLRejectsUnsupported(t *testing.T) {
@@ -146,18 +146,19 @@ func TestCompileGLSLRejectsUnsupported(t *testing.T) {
 		src  string
 	}{
 		{
-			name: "vertex stage",
+			name: "vertex output without a position",
 			src: `package k
 type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct{ Color Vec4 }
 //gpu:vertex
-func V(vid uint, pos []float32) Vec4 { return Vec4{pos[vid], 0, 0, 1} }`,
+func V(vid uint) VOut { return VOut{} }`,
 		},
 		{
-			name: "texture param",
+			name: "sampler of another index",
 			src: `package k
 type Vec4 struct{ X, Y, Z, W float32 }
-func K(gid uint, tex Texture2D, samp Sampler, out []float32) {
-	c := tex.Sample(samp, Vec2{0, 0})
+func K(gid uint, tex Texture2D, a, b Sampler, out []float32) {
+	c := tex.Sample(b, Vec2{0, 0})
 	out[gid] = c.X
 }`,
 		},
@@ -170,3 +171,94 @@ func K(gid uint, tex Texture2D, samp Sampler, out []float32) {
 		})
 	}
 }
+
+// TestCompileGLSLRenderStages checks the vertex and fragment stages of the
+// forward pass: each kernel is a function main calls, the vertex main remaps
+// the clip depth to GL's and passes the varyings at matching locations, the
+// integer one flat, and the fragment main rebuilds the input struct from
+// gl_FragCoord and writes each color to its own output.
+func TestCompileGLSLRenderStages(t *testing.T) {
+	ks, err := CompileGLSL(kernelpkg.ForwardSrc)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	for _, tc := range []struct {
+		kernel string
+		want   []string
+	}{
+		{"ForwardVertex", []string{
+			"ForwardVaryings ForwardVertex(int vid, int iid) {",
+			"ForwardVaryings gpu_out = ForwardVertex(gl_VertexID, gl_InstanceID);",
+			"layout(location = 3) flat out int gpu_Varying3;",
+			"gpu_Varying0 = gpu_out.World;",
+			"gl_Position = gpu_out.Pos;",
+			"gl_Position.z = 2.0 * gl_Position.z - gl_Position.w;",
+		}},
+		{"ForwardFragment", []string{
+			"precision highp int;",
+			"layout(location = 3) flat in int gpu_Varying3;",
+			"ForwardVaryings gpu_in = ForwardVaryings(gl_FragCoord, gpu_Varying0, gpu_Varying1, gpu_Varying2, gpu_Varying3);",
+			"dFdx(in_.UV)",
+			"layout(location = 2) out vec4 gpu_Color2;",
+			"gpu_Color2 = gpu_out.UV;",
+		}},
+	} {
+		k := ks[tc.kernel]
+		if k == nil {
+			t.Fatalf("no kernel %s", tc.kernel)
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(k.GLSL, w) {
+				t.Errorf("%s GLSL missing %q:\n%s", tc.kernel, w, k.GLSL)
+			}
+		}
+	}
+}
+
+// TestCompileGLSLTextures checks each texture kind becomes a sampler uniform at
+// its own binding, and Sample and SampleLevel become textureLod with a 2D
+// array's layer folded into the coordinates.
+func TestCompileGLSLTextures(t *testing.T) {
+	const src = `package k
+type Vec2 struct{ X, Y float32 }
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+func K(gid uint, img Texture2D, layers Texture2DArray, sky TextureCube, vol Texture3D, s0, s1, s2, s3 Sampler, out []float32) {
+	a := img.Sample(s0, Vec2{0.5, 0.5})
+	b := layers.SampleLevel(s1, Vec2{0.5, 0.5}, 2, 1.0)
+	c := sky.Sample(s2, Vec3{1, 0, 0})
+	d := vol.SampleLevel(s3, Vec3{0.5, 0.5, 0.5}, 0.5)
+	out[gid] = a.X + b.Y + c.Z + d.W
+}`
+	ks, err := CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	k := ks["K"]
+	for _, want := range []string{
+		"layout(binding = 0) uniform highp sampler2D img;",
+		"layout(binding = 1) uniform highp sampler2DArray layers;",
+		"layout(binding = 2) uniform highp samplerCube sky;",
+		"layout(binding = 3) uniform highp sampler3D vol;",
+		"textureLod(img, vec2(0.5, 0.5), float(0.0))",
+		"textureLod(layers, vec3(vec2(0.5, 0.5), float(2)), float(1.0))",
+		"textureLod(sky, vec3(1, 0, 0), float(0.0))",
+		"textureLod(vol, vec3(0.5, 0.5, 0.5), float(0.5))",
+	} {
+		if !strings.Contains(k.GLSL, want) {
+			t.Errorf("GLSL missing %q:\n%s", want, k.GLSL)
+		}
+	}
+	var tex, samp int
+	for _, b := range k.Bindings {
+		switch b.Kind {
+		case SampledTexture:
+			tex++
+		case SamplerBinding:
+			samp++
+		}
+	}
+	if tex != 4 || samp != 4 {
+		t.Errorf("bindings = %d textures and %d samplers, want 4 and 4: %+v", tex, samp, k.Bindings)
+	}
+}
@@ -107,3 +107,11 @@ func Maxf(a, b float32) float32 {
 func (m Mat4) MulV(v Vec4) Vec4 {
 	return m.C0.Scale(v.X).Add(m.C1.Scale(v.Y)).Add(m.C2.Scale(v.Z)).Add(m.C3.Scale(v.W))
 }
+
+// --- fragment derivatives ---
+
+// Dfdx and Dfdy are the screen-space derivatives of a fragment kernel's input
+// field v along x and y, the difference from the neighbouring fragment. A
+// fragment kernel called as plain Go has no neighbours, so they return zero.
+func Dfdx(v Vec4) Vec4 { return Vec4{} }
+func Dfdy(v Vec4) Vec4 { return Vec4{} }
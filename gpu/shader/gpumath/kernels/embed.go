@@ -27,3 +27,26 @@ var ShadowSrc string
 //
 //go:embed ao.go
 var AOSrc string
+
+// QuantizeSrc is the source of quantize.go (the deferred-to-gamma hand-off).
+//
+//go:embed quantize.go
+var QuantizeSrc string
+
+// HistogramSrc is the source of histogram.go (the luminance histogram, a
+// workgroup kernel).
+//
+//go:embed histogram.go
+var HistogramSrc string
+
+// VisibilitySrc is the source of visibility.go (2D light visibility, which
+// uses switch, labeled loops and multi-value helpers).
+//
+//go:embed visibility.go
+var VisibilitySrc string
+
+// ForwardSrc is the source of forward.go (the forward pass's vertex and
+// fragment stages, which write the G-buffer).
+//
+//go:embed forward.go
+var ForwardSrc string
@@ -0,0 +1,66 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import . "poly.red/gpu/shader/gpumath"
+
+// ForwardVaryings is what ForwardVertex hands the rasterizer: the clip-space
+// position, and per vertex the world position, world normal, texture
+// coordinate and material id.
+type ForwardVaryings struct {
+	Pos   Vec4 `gpu:"position"`
+	World Vec4
+	Nor   Vec4
+	UV    Vec4
+	Mat   int32
+}
+
+// GBuffer is the forward pass's four color targets: xyz world position and
+// w depth; xyz unit world normal and w material id; u, v and their squared
+// screen-space gradients for LOD; and in x the sample's coverage, 1, which a
+// multisample resolve turns into the share of a pixel's samples drawn.
+type GBuffer struct {
+	World Vec4
+	Nor   Vec4
+	UV    Vec4
+	Cover Vec4
+}
+
+// ForwardVertex is the forward pass's vertex stage, authored once: its source
+// (ForwardSrc) compiles to every driver, the CPU included. Each instance has
+// three column-major matrices in inst: the clip transform, the world transform
+// and the normal transform. The clip position is negated, as the CPU
+// rasterizer's homogeneous divide is, and its z remapped to [0,1].
+//
+//gpu:vertex
+func ForwardVertex(vid uint, iid uint, pos []Vec4, nor []Vec4, mid []float32, uv []Vec2, inst []Mat4) ForwardVaryings {
+	k := iid * 3
+	p := pos[vid]
+	c := inst[k].MulV(p)
+	n := nor[vid]
+	return ForwardVaryings{
+		Pos:   V4(-c.X, -c.Y, (c.Z-c.W)*0.5, -c.W),
+		World: inst[k+1].MulV(p),
+		Nor:   inst[k+2].MulV(V4(n.X, n.Y, n.Z, 0)),
+		UV:    V4(uv[vid].X, uv[vid].Y, 0, 0),
+		Mat:   int32(mid[vid]),
+	}
+}
+
+// ForwardFragment is the forward pass's fragment stage: it writes the G-buffer
+// the deferred pass shades. The depth is the CPU rasterizer's [-1,1] one.
+//
+//gpu:fragment
+func ForwardFragment(in ForwardVaryings) GBuffer {
+	dx := Dfdx(in.UV)
+	dy := Dfdy(in.UV)
+	n := Normalize(V4(in.Nor.X, in.Nor.Y, in.Nor.Z, 0))
+	return GBuffer{
+		World: V4(in.World.X, in.World.Y, in.World.Z, 1-in.Pos.Z*2),
+		Nor:   V4(n.X, n.Y, n.Z, float32(in.Mat)),
+		UV:    V4(in.UV.X, in.UV.Y, Dot(dx, dx), Dot(dy, dy)),
+		Cover: V4(1, 0, 0, 0),
+	}
+}
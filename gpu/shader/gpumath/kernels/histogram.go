@@ -0,0 +1,42 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import . "poly.red/gpu/shader/gpumath"
+
+// HistogramParams is Histogram's uniform block: the number of pixels, padded
+// to 16 bytes.
+type HistogramParams struct {
+	Count uint32
+	Pad1  uint32
+	Pad2  uint32
+	Pad3  uint32
+}
+
+// histBins are one workgroup's counts, merged into the output once the
+// workgroup is done, so most atomics stay in shared memory.
+var histBins = Shared[uint32](16)
+
+// Histogram counts RGBA pixels (four floats each) into 16 Rec. 709 luminance
+// bins, hist[0:16], which the caller zeroes. It runs in workgroups of 64: on
+// the CPU through Dispatch, on the GPU with the grid rounded up to whole
+// workgroups, which is why pixels from p.Count on are skipped rather than
+// returned from (every invocation must reach the barriers).
+//
+//gpu:workgroup 64
+func Histogram(gid, lid uint, px []float32, p HistogramParams, hist []uint32) {
+	if lid < 16 {
+		histBins[lid] = 0
+	}
+	WorkgroupBarrier()
+	if int(gid) < int(p.Count) {
+		l := 0.2126*px[gid*4] + 0.7152*px[gid*4+1] + 0.0722*px[gid*4+2]
+		AtomicAddU32(histBins, uint(Clampf(l*16.0, 0.0, 15.0)), 1)
+	}
+	WorkgroupBarrier()
+	if lid < 16 {
+		AtomicAddU32(hist, lid, histBins[lid])
+	}
+}
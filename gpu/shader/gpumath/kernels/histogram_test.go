@@ -0,0 +1,36 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import (
+	"testing"
+
+	"poly.red/gpu/shader/gpumath"
+)
+
+// TestHistogram runs the author-once Histogram workgroup kernel as Go through
+// gpumath.Dispatch over a pixel count that is not a multiple of the workgroup
+// size, and checks it against a direct count.
+func TestHistogram(t *testing.T) {
+	const n = 1000
+	px := make([]float32, n*4)
+	var want [16]uint32
+	for i := 0; i < n; i++ {
+		r, g, b := float32(i%7)/6, float32(i%13)/12, float32(i%29)/28
+		px[i*4], px[i*4+1], px[i*4+2], px[i*4+3] = r, g, b, 1
+		l := 0.2126*r + 0.7152*g + 0.0722*b
+		want[uint(gpumath.Clampf(l*16, 0, 15))]++
+	}
+	hist := make([]uint32, 16)
+	p := HistogramParams{Count: n}
+	gpumath.Dispatch(n, 64, func(gid, lid, wid uint) {
+		Histogram(gid, lid, px, p, hist)
+	})
+	for i := range want {
+		if hist[i] != want[i] {
+			t.Fatalf("hist = %v, want %v", hist, want)
+		}
+	}
+}
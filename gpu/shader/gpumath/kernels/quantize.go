@@ -0,0 +1,27 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import . "poly.red/gpu/shader/gpumath"
+
+// Quantize hands the deferred chain's shaded float buffer to the gamma pass
+// (SRGB) without a CPU round trip, authored once: it rounds each fragment's
+// R, G, B to the 8-bit value the CPU stores and normalizes it, so the gamma
+// pass sees exactly the bytes it would have read from the image. A fragment
+// the shader did not touch (background or unshaded) carries its final color in
+// preset (0..255, R at preset[gid*4]); preset[gid*4+3] < 0 marks a shaded one.
+func Quantize(gid uint, color []float32, preset []float32, out []float32) {
+	r := color[gid*4]
+	g := color[gid*4+1]
+	b := color[gid*4+2]
+	if preset[gid*4+3] >= 0.0 {
+		r = preset[gid*4]
+		g = preset[gid*4+1]
+		b = preset[gid*4+2]
+	}
+	out[gid*3] = Clampf(Round(r), 0.0, 255.0) / 255.0
+	out[gid*3+1] = Clampf(Round(g), 0.0, 255.0) / 255.0
+	out[gid*3+2] = Clampf(Round(b), 0.0, 255.0) / 255.0
+}
@@ -0,0 +1,23 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import "testing"
+
+// TestQuantize checks the author-once Quantize kernel run as Go: a shaded
+// fragment is rounded and clamped to a byte, a preset one passes through.
+func TestQuantize(t *testing.T) {
+	color := []float32{127.6, -3, 300, 9, 10, 20, 30, 40}
+	preset := []float32{0, 0, 0, -1, 255, 0, 51, 255}
+	out := make([]float32, 6)
+	Quantize(0, color, preset, out)
+	Quantize(1, color, preset, out)
+	want := []float32{128.0 / 255, 0, 1, 1, 0, 51.0 / 255}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Errorf("out[%d] = %v, want %v", i, out[i], want[i])
+		}
+	}
+}
@@ -25,20 +25,10 @@ func Shade(gid uint, normals []float32, worldpos []float32, basecol []float32, l
 	count := int(scene[5])
 	acc := col.Scale(ambientI)
 	for i := 0; i < count; i++ {
-		lt := lights[i*10]
 		lp := V4(lights[i*10+1], lights[i*10+2], lights[i*10+3], lights[i*10+4])
 		lc := V4(lights[i*10+5], lights[i*10+6], lights[i*10+7], lights[i*10+8])
 		li := lights[i*10+9]
-		var L Vec4
-		var I float32
-		if lt < 0.5 {
-			Ldir := lp.Sub(wpos)
-			L = Normalize(Ldir)
-			I = li / Length(Ldir)
-		} else {
-			L = V4(-lp.X, -lp.Y, -lp.Z, 0)
-			I = li
-		}
+		L, I := lightAt(int(lights[i*10]), lp, li, wpos)
 		V := Normalize(camPos.Sub(wpos))
 		H := Normalize(L.Add(V))
 		Ld := Clampf(Dot(N, L), 0.0, 1.0)
@@ -50,3 +40,16 @@ func Shade(gid uint, normals []float32, worldpos []float32, basecol []float32, l
 	out[gid*4+2] = acc.Z
 	out[gid*4+3] = col.W
 }
+
+// lightAt returns the unit direction from wpos toward a light of the given
+// kind and the light's intensity there: a point light (kind 0) at lp falls
+// off with distance, a directional light (kind 1) shining along lp does not.
+func lightAt(kind int, lp Vec4, li float32, wpos Vec4) (Vec4, float32) {
+	switch kind {
+	case 0:
+		Ldir := lp.Sub(wpos)
+		return Normalize(Ldir), li / Length(Ldir)
+	default:
+		return V4(-lp.X, -lp.Y, -lp.Z, 0), li
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import . "poly.red/gpu/shader/gpumath"
+
+// VisibilityParams sizes a Visibility dispatch: the image width, the numbers
+// of lights and occluders, and how many lights a pixel takes at most.
+type VisibilityParams struct {
+	Width     uint32
+	Lights    uint32
+	Occluders uint32
+	MaxLights uint32
+}
+
+// Visibility lights a 2D scene past circular occluders, authored once. A
+// light is 5 floats: kind, x, y, intensity and range. Kind 0 is a point light
+// at x, y reaching range pixels, whose intensity falls off with distance
+// beyond 1; kind 1 is a directional light shining along x, y; any other kind
+// is off. An occluder is 3 floats: x, y and radius. Each pixel sums the first
+// p.MaxLights lights it sees into out[gid*2] and counts them in
+// out[gid*2+1]; a pixel inside an occluder sees none.
+func Visibility(gid uint, lights []float32, occluders []float32, p VisibilityParams, out []float32) {
+	px := float32(int(gid)%int(p.Width)) + 0.5
+	py := float32(int(gid)/int(p.Width)) + 0.5
+	out[gid*2] = 0
+	out[gid*2+1] = 0
+	for j := uint32(0); j < p.Occluders; j++ {
+		ox := occluders[j*3] - px
+		oy := occluders[j*3+1] - py
+		if ox*ox+oy*oy < occluders[j*3+2]*occluders[j*3+2] {
+			return
+		}
+	}
+	sum := float32(0)
+	seen := uint32(0)
+scan:
+	for i := uint32(0); i < p.Lights; i++ {
+		kind := int(lights[i*5])
+		dx, dy, reach := toLight(kind, lights[i*5+1], lights[i*5+2], px, py)
+		e := lights[i*5+3]
+		switch kind {
+		case 0:
+			if reach <= 1 {
+				break
+			}
+			if reach > lights[i*5+4] {
+				continue
+			}
+			e /= reach
+		case 1:
+		default:
+			continue
+		}
+		for j := uint32(0); j < p.Occluders; j++ {
+			t, miss := nearest(occluders[j*3]-px, occluders[j*3+1]-py, dx, dy)
+			if t > 0 && t < reach && miss < occluders[j*3+2]*occluders[j*3+2] {
+				continue scan
+			}
+		}
+		sum += e
+		seen++
+		if seen == p.MaxLights {
+			break scan
+		}
+	}
+	out[gid*2] = sum
+	out[gid*2+1] = float32(seen)
+}
+
+// toLight returns the unit direction from the pixel at px, py toward a light
+// and the light's distance along it. lx, ly is where a point light is, and
+// the direction a directional light shines; that one is infinitely far.
+func toLight(kind int, lx, ly, px, py float32) (float32, float32, float32) {
+	if kind == 1 {
+		l := Sqrt(lx*lx + ly*ly)
+		return -lx / l, -ly / l, 1e30
+	}
+	x := lx - px
+	y := ly - py
+	l := Sqrt(x*x + y*y)
+	return x / l, y / l, l
+}
+
+// nearest returns how far along the unit direction dx, dy the point at
+// offset ox, oy lies, and its squared distance from that line.
+func nearest(ox, oy, dx, dy float32) (float32, float32) {
+	t := ox*dx + oy*dy
+	qx := ox - t*dx
+	qy := oy - t*dy
+	return t, qx*qx + qy*qy
+}
@@ -0,0 +1,60 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kernels
+
+import (
+	"math"
+	"testing"
+)
+
+// TestVisibility checks the Visibility kernel run as Go on one row of 8
+// pixels, one case for each way out of its loops and switch.
+func TestVisibility(t *testing.T) {
+	lights := []float32{
+		0, 2.5, 3.5, 6, 5, // point light
+		1, 0, -1, 0.5, 0, // directional light shining down
+		7, 0, 0, 100, 100, // unknown kind: off
+		0, 7.5, 1, 0.25, 1, // point light reaching one pixel, unattenuated
+	}
+	occluders := []float32{
+		4.5, 2, 0.5,
+		0.5, 0.5, 0.25,
+	}
+	run := func(maxLights uint32) []float32 {
+		out := make([]float32, 16)
+		p := VisibilityParams{Width: 8, Lights: 4, Occluders: 2, MaxLights: maxLights}
+		for gid := uint(0); gid < 8; gid++ {
+			Visibility(gid, lights, occluders, p, out)
+		}
+		return out
+	}
+	inv := func(x float32) float32 { return float32(1 / math.Sqrt(float64(x))) }
+
+	out := run(4)
+	want := []struct {
+		sum  float32
+		seen float32
+		why  string
+	}{
+		{0, 0, "inside an occluder"},
+		{6*inv(10) + 0.5, 2, "both lights"},
+		{2 + 0.5, 2, "both lights"},
+		{6*inv(10) + 0.5, 2, "both lights"},
+		{6 * inv(13), 1, "directional light occluded"},
+		{0.5, 1, "point light occluded"},
+		{0.5, 1, "point light occluded at its range"},
+		{0.5 + 0.25, 2, "point light out of range, near light unattenuated"},
+	}
+	for i, w := range want {
+		if got := out[i*2]; math.Abs(float64(got-w.sum)) > 1e-5 || out[i*2+1] != w.seen {
+			t.Errorf("pixel %d (%s): got %v, %v want %v, %v", i, w.why, got, out[i*2+1], w.sum, w.seen)
+		}
+	}
+
+	out = run(1)
+	if out[4] != 2 || out[5] != 1 {
+		t.Errorf("MaxLights 1: pixel 2 got %v, %v want 2, 1", out[4], out[5])
+	}
+}
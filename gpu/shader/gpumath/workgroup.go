@@ -0,0 +1,145 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpumath
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// --- workgroups (the compiler lowers these to threadgroup/shared memory,
+// barriers and atomics) ---
+//
+// A compute kernel marked //gpu:workgroup N runs in workgroups of N
+// invocations that share memory and synchronize at barriers. It may take the
+// invocation's index within its workgroup and the workgroup's index as
+// integer parameters after the id:
+//
+//	var tile = Shared[float32](64)
+//
+//	//gpu:workgroup 64
+//	func Sum(gid, lid, wid uint, in []float32, out []float32) { ... }
+//
+// On the CPU, Dispatch runs such a kernel the way the GPU does.
+
+// Shared allocates n elements of workgroup-shared memory. Declare shared
+// memory at package level (var tile = Shared[float32](64)); every invocation
+// of a workgroup sees the same elements. The compiler emits a threadgroup /
+// shared / workgroup array of the element type, which must be a scalar or
+// vector; atomics need uint32. Shared memory starts undefined on the GPU, so
+// kernels initialize what they read.
+func Shared[T any](n int) []T { return make([]T, n) }
+
+// WorkgroupBarrier waits until every invocation of the workgroup has reached
+// it, and makes their writes to shared memory visible to each other. Every
+// invocation must reach the same barriers, as on the GPU. Outside Dispatch it
+// does nothing.
+func WorkgroupBarrier() {
+	if b := current.Load(); b != nil {
+		b.wait()
+	}
+}
+
+// AtomicAddU32 adds v to buf[i] atomically and returns the previous value.
+// buf is a []uint32 buffer parameter or Shared array.
+func AtomicAddU32(buf []uint32, i uint, v uint32) uint32 {
+	return atomic.AddUint32(&buf[i], v) - v
+}
+
+// AtomicMinU32 stores min(buf[i], v) atomically and returns the previous
+// value.
+func AtomicMinU32(buf []uint32, i uint, v uint32) uint32 {
+	for {
+		old := atomic.LoadUint32(&buf[i])
+		if old <= v || atomic.CompareAndSwapUint32(&buf[i], old, v) {
+			return old
+		}
+	}
+}
+
+// AtomicMaxU32 stores max(buf[i], v) atomically and returns the previous
+// value.
+func AtomicMaxU32(buf []uint32, i uint, v uint32) uint32 {
+	for {
+		old := atomic.LoadUint32(&buf[i])
+		if old >= v || atomic.CompareAndSwapUint32(&buf[i], old, v) {
+			return old
+		}
+	}
+}
+
+var (
+	dispatchMu sync.Mutex              // one Dispatch at a time: shared memory is global
+	current    atomic.Pointer[barrier] // the running workgroup's barrier
+)
+
+// Dispatch runs kernel over n invocations in workgroups of size invocations,
+// as Device.Dispatch does on the GPU: the grid is rounded up to whole
+// workgroups, so kernels check their id against the data size. The
+// invocations of a workgroup run concurrently and meet at WorkgroupBarrier;
+// workgroups run one after another. kernel is called with the invocation's
+// global id, its index in the workgroup and the workgroup's index.
+func Dispatch(n, size int, kernel func(gid, lid, wid uint)) {
+	if size < 1 {
+		size = 1
+	}
+	dispatchMu.Lock()
+	defer dispatchMu.Unlock()
+	for wid := 0; wid*size < n; wid++ {
+		b := &barrier{n: size}
+		b.cond.L = &b.mu
+		current.Store(b)
+		var wg sync.WaitGroup
+		for lid := 0; lid < size; lid++ {
+			wg.Add(1)
+			go func(lid int) {
+				defer wg.Done()
+				defer b.leave()
+				kernel(uint(wid*size+lid), uint(lid), uint(wid))
+			}(lid)
+		}
+		wg.Wait()
+	}
+	current.Store(nil)
+}
+
+// barrier is a reusable workgroup barrier. An invocation that returns leaves
+// it, so the others do not wait for it at later barriers.
+type barrier struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	n       int // invocations still running
+	arrived int
+	gen     int
+}
+
+func (b *barrier) wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.arrived++
+	if b.arrived == b.n {
+		b.release()
+		return
+	}
+	for gen := b.gen; gen == b.gen; {
+		b.cond.Wait()
+	}
+}
+
+func (b *barrier) leave() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.n--
+	if b.n > 0 && b.arrived == b.n {
+		b.release()
+	}
+}
+
+// release opens the barrier for the waiting invocations; b.mu is held.
+func (b *barrier) release() {
+	b.arrived = 0
+	b.gen++
+	b.cond.Broadcast()
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpumath
+
+import "testing"
+
+// TestDispatch checks the ids Dispatch passes and that a barrier orders the
+// writes of a workgroup before its reads, with a shared-memory reduction over
+// a grid rounded up to whole workgroups.
+func TestDispatch(t *testing.T) {
+	const n, size = 100, 16
+	tile := Shared[float32](size)
+	in := make([]float32, n)
+	for i := range in {
+		in[i] = float32(i)
+	}
+	out := make([]float32, (n+size-1)/size)
+	calls := make([]uint32, 1)
+	Dispatch(n, size, func(gid, lid, wid uint) {
+		AtomicAddU32(calls, 0, 1)
+		if gid != wid*size+lid {
+			t.Errorf("gid %d, lid %d, wid %d", gid, lid, wid)
+		}
+		tile[lid] = 0
+		if gid < n {
+			tile[lid] = in[gid]
+		}
+		WorkgroupBarrier()
+		for s := uint(size / 2); s > 0; s /= 2 {
+			if lid < s {
+				tile[lid] += tile[lid+s]
+			}
+			WorkgroupBarrier()
+		}
+		if lid == 0 {
+			out[wid] = tile[0]
+		}
+	})
+	if calls[0] != 7*size {
+		t.Fatalf("%d invocations, want %d", calls[0], 7*size)
+	}
+	for w, got := range out {
+		var want float32
+		for i := w * size; i < (w+1)*size && i < n; i++ {
+			want += in[i]
+		}
+		if got != want {
+			t.Errorf("workgroup %d sum = %v, want %v", w, got, want)
+		}
+	}
+}
+
+// TestDispatchEarlyReturn checks that invocations returning before a barrier
+// do not keep the rest of the workgroup waiting.
+func TestDispatchEarlyReturn(t *testing.T) {
+	hits := make([]uint32, 1)
+	Dispatch(8, 8, func(gid, lid, wid uint) {
+		if lid%2 == 1 {
+			return
+		}
+		WorkgroupBarrier()
+		AtomicAddU32(hits, 0, 1)
+		WorkgroupBarrier()
+	})
+	if hits[0] != 4 {
+		t.Fatalf("%d invocations passed the barriers, want 4", hits[0])
+	}
+}
+
+func TestAtomicsU32(t *testing.T) {
+	buf := []uint32{5, 5, 5}
+	if old := AtomicAddU32(buf, 0, 3); old != 5 || buf[0] != 8 {
+		t.Errorf("AtomicAddU32: old %d, now %d", old, buf[0])
+	}
+	if old := AtomicMinU32(buf, 1, 2); old != 5 || buf[1] != 2 {
+		t.Errorf("AtomicMinU32: old %d, now %d", old, buf[1])
+	}
+	if old := AtomicMinU32(buf, 1, 9); old != 2 || buf[1] != 2 {
+		t.Errorf("AtomicMinU32 larger: old %d, now %d", old, buf[1])
+	}
+	if old := AtomicMaxU32(buf, 2, 9); old != 5 || buf[2] != 9 {
+		t.Errorf("AtomicMaxU32: old %d, now %d", old, buf[2])
+	}
+	// Outside Dispatch a barrier does nothing.
+	WorkgroupBarrier()
+}
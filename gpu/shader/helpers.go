@@ -0,0 +1,302 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Helper functions: a top-level func that kernels call (fresnel, attenuate,
+// ...) is compiled as a device function of each kernel that reaches it
+// instead of as a kernel of its own. Parameters and results may be scalars,
+// vectors, matrices or structs, and a helper may return several results;
+// buffers, textures and samplers stay kernel parameters. Shaders cannot recurse, so call cycles are rejected.
+
+// isHelperDirective reports whether a func's doc comment marks it //gpu:func.
+func isHelperDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == "//gpu:func" {
+			return true
+		}
+	}
+	return false
+}
+
+// callees lists the funcs in byName that fn calls, in order of first call.
+func callees(fn *ast.FuncDecl, byName map[string]*ast.FuncDecl) []string {
+	var names []string
+	seen := map[string]bool{}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if id, ok := call.Fun.(*ast.Ident); ok && byName[id.Name] != nil && !seen[id.Name] {
+				seen[id.Name] = true
+				names = append(names, id.Name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// splitFuncs separates the helpers from the kernels. A func is a helper if
+// it is marked //gpu:func, or if it has no stage directive and some func
+// calls it; every other func is a kernel. Calling a vertex or fragment kernel
+// is an error, as is a call cycle among the helpers.
+func splitFuncs(funcs []*ast.FuncDecl) ([]*ast.FuncDecl, map[string]*ast.FuncDecl, error) {
+	byName := map[string]*ast.FuncDecl{}
+	for _, fn := range funcs {
+		byName[fn.Name.Name] = fn
+	}
+	called := map[string]bool{}
+	for _, fn := range funcs {
+		for _, name := range callees(fn, byName) {
+			called[name] = true
+		}
+	}
+	var kernels []*ast.FuncDecl
+	helpers := map[string]*ast.FuncDecl{}
+	for _, fn := range funcs {
+		switch name := fn.Name.Name; {
+		case isHelperDirective(fn.Doc):
+			helpers[name] = fn
+		case called[name] && stageOf(fn.Doc) != StageCompute:
+			return nil, nil, fmt.Errorf("%s kernel %s is called; mark shared code //gpu:func", stageName(stageOf(fn.Doc)), name)
+		case called[name]:
+			helpers[name] = fn
+		default:
+			kernels = append(kernels, fn)
+		}
+	}
+
+	// Check every helper for recursion, not only those a kernel reaches.
+	names := make([]string, 0, len(helpers))
+	for name := range helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := helpersOf(helpers[name], helpers); err != nil {
+			return nil, nil, err
+		}
+	}
+	return kernels, helpers, nil
+}
+
+// stageName is the directive spelling of a stage.
+func stageName(s Stage) string {
+	return map[Stage]string{StageCompute: "compute", StageVertex: "vertex", StageFragment: "fragment"}[s]
+}
+
+// helpersOf returns the helpers fn calls, directly or through other helpers,
+// each after the helpers it calls, so emitting them in order declares every
+// function before its first use.
+func helpersOf(fn *ast.FuncDecl, helpers map[string]*ast.FuncDecl) ([]*ast.FuncDecl, error) {
+	var order []*ast.FuncDecl
+	const visiting, done = 1, 2
+	state := map[string]int{fn.Name.Name: visiting}
+	var visit func(f *ast.FuncDecl, path []string) error
+	visit = func(f *ast.FuncDecl, path []string) error {
+		for _, name := range callees(f, helpers) {
+			switch state[name] {
+			case visiting:
+				return fmt.Errorf("recursive call %s -> %s: shaders cannot recurse", strings.Join(path, " -> "), name)
+			case done:
+				continue
+			}
+			state[name] = visiting
+			if err := visit(helpers[name], append(path, name)); err != nil {
+				return err
+			}
+			state[name] = done
+			order = append(order, helpers[name])
+		}
+		return nil
+	}
+	if err := visit(fn, []string{fn.Name.Name}); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// funcSig is a helper's signature in canonical (MSL-spelled) types. results
+// lists the result types; ret is the result of a func with exactly one, and
+// empty otherwise. Lowering turns a func with several results into one
+// returning a struct of them, so the emitters only ever see ret.
+type funcSig struct {
+	params  []param
+	types   []string
+	ret     string
+	results []string
+}
+
+// helperSig resolves a helper's parameter and result types.
+func helperSig(fn *ast.FuncDecl, structs map[string]*ast.StructType) (funcSig, error) {
+	sig := funcSig{params: flattenParams(fn.Type.Params)}
+	for _, p := range sig.params {
+		t, err := valueType(p.typ, structs)
+		if err != nil {
+			return funcSig{}, fmt.Errorf("parameter %q: %w", p.name, err)
+		}
+		sig.types = append(sig.types, t)
+	}
+	if res := fn.Type.Results; res != nil {
+		for _, f := range res.List {
+			t, err := valueType(f.Type, structs)
+			if err != nil {
+				return funcSig{}, fmt.Errorf("result: %w", err)
+			}
+			for range max(1, len(f.Names)) {
+				sig.results = append(sig.results, t)
+			}
+		}
+		if len(sig.results) == 1 {
+			sig.ret = sig.results[0]
+		}
+	}
+	return sig, nil
+}
+
+// valueType is the canonical type of a helper parameter or result: a scalar,
+// vector, matrix or struct.
+func valueType(e ast.Expr, structs map[string]*ast.StructType) (string, error) {
+	if _, ok := e.(*ast.ArrayType); ok {
+		return "", fmt.Errorf("buffers cannot be passed to helper functions")
+	}
+	name, ok := identType(e)
+	if !ok {
+		return "", fmt.Errorf("unsupported type")
+	}
+	if mt, ok := goToMSLType(name); ok {
+		return mt, nil
+	}
+	if _, ok := structs[name]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("unsupported type %q", name)
+}
+
+// usedStructs lists the structs the nodes refer to, including those nested
+// as field types, each after the structs it contains. Structs standing in for
+// the built-in vector and matrix types (Vec4 and friends) are skipped.
+func usedStructs(structs map[string]*ast.StructType, nodes ...ast.Node) []string {
+	var names []string
+	seen := map[string]bool{}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		st, ok := structs[id.Name]
+		if _, builtin := goToMSLType(id.Name); !ok || builtin || seen[id.Name] {
+			return true
+		}
+		seen[id.Name] = true
+		ast.Inspect(st, visit)
+		names = append(names, id.Name)
+		return true
+	}
+	for _, n := range nodes {
+		ast.Inspect(n, visit)
+	}
+	return names
+}
+
+// funcNodes returns the helpers as nodes for usedStructs.
+func funcNodes(fns []*ast.FuncDecl) []ast.Node {
+	nodes := make([]ast.Node, len(fns))
+	for i, fn := range fns {
+		nodes[i] = fn
+	}
+	return nodes
+}
+
+// emitHelper writes h as a function of the target language. Go parameters
+// are assignable; WGSL's are not, so a WGSL helper copies each parameter it
+// assigns into a var of the same name.
+func (c *compiler) emitHelper(w *strings.Builder, h *ast.FuncDecl) error {
+	sig, err := helperSig(h, c.structs)
+	if err != nil {
+		return err
+	}
+	hc := &compiler{structs: c.structs, env: map[string]string{}, written: map[string]bool{}, tgt: c.tgt, stage: c.stage, funcs: c.funcs, result: sig.ret}
+	assigned := assignedNames(h.Body)
+	var params []string
+	for i, p := range sig.params {
+		t := sig.types[i]
+		hc.env[p.name] = t
+		switch {
+		case c.tgt != targetWGSL:
+			params = append(params, hc.typ(t)+" "+hc.name(p.name))
+		case assigned[p.name]:
+			params = append(params, fmt.Sprintf("_%s: %s", p.name, hc.typ(t)))
+			hc.indent(1)
+			fmt.Fprintf(&hc.buf, "var %s = _%s;\n", hc.name(p.name), p.name)
+		default:
+			params = append(params, fmt.Sprintf("%s: %s", hc.name(p.name), hc.typ(t)))
+		}
+	}
+	if err := hc.stmts(h.Body.List, 1); err != nil {
+		return err
+	}
+	if c.tgt == targetWGSL {
+		ret := ""
+		if sig.ret != "" {
+			ret = " -> " + hc.typ(sig.ret)
+		}
+		fmt.Fprintf(w, "fn %s(%s)%s {\n%s}\n\n", hc.name(h.Name.Name), strings.Join(params, ", "), ret, hc.buf.String())
+		return nil
+	}
+	ret := "void"
+	if sig.ret != "" {
+		ret = hc.typ(sig.ret)
+	}
+	fmt.Fprintf(w, "%s %s(%s) {\n%s}\n\n", ret, hc.name(h.Name.Name), strings.Join(params, ", "), hc.buf.String())
+	return nil
+}
+
+// assignedNames reports the variables body assigns to or increments,
+// directly or through a field, index or swizzle.
+func assignedNames(body *ast.BlockStmt) map[string]bool {
+	names := map[string]bool{}
+	mark := func(e ast.Expr) {
+		for {
+			switch x := e.(type) {
+			case *ast.Ident:
+				names[x.Name] = true
+				return
+			case *ast.SelectorExpr:
+				e = x.X
+			case *ast.IndexExpr:
+				e = x.X
+			case *ast.ParenExpr:
+				e = x.X
+			default:
+				return
+			}
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE {
+				for _, lhs := range s.Lhs {
+					mark(lhs)
+				}
+			}
+		case *ast.IncDecStmt:
+			mark(s.X)
+		}
+		return true
+	})
+	return names
+}
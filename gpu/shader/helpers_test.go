@@ -0,0 +1,193 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// helperKernelSrc calls helpers of every supported shape: scalar, vector and
+// struct parameters and results, a helper marked //gpu:func, one found only
+// by reachability, a helper calling another, and one assigning a parameter.
+const helperKernelSrc = `
+package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type Light struct {
+	Dir   Vec4
+	Power float32
+}
+
+//gpu:func
+func fresnel(cosT float32, f0 float32) float32 {
+	m := clamp(1.0-cosT, 0.0, 1.0)
+	return f0 + (1.0-f0)*m*m*m*m*m
+}
+
+func light(x, y, z, p float32) Light {
+	return Light{Dir: normalize(Vec4{x, y, z, 0}), Power: p}
+}
+
+func shade(n Vec4, l Light) Vec4 {
+	d := max(dot(n, l.Dir), 0.0)
+	if d > 0.5 {
+		return n * (d * l.Power)
+	}
+	return n * fresnel(d, 0.04)
+}
+
+func bump(v float32, k int) float32 {
+	for k > 0 {
+		v = v * 1.5
+		k--
+	}
+	return v
+}
+
+func Lit(gid uint, nrm []float32, out []float32) {
+	n := Vec4{nrm[gid*4], nrm[gid*4+1], nrm[gid*4+2], 0}
+	c := shade(n, light(0.3, 0.5, 0.8, 2))
+	out[gid*4] = c.X
+	out[gid*4+1] = bump(c.Y, int(nrm[gid*4+3]))
+	out[gid*4+2] = fresnel(c.Z, 0.5)
+}
+`
+
+// TestCompileHelpers checks that helpers become functions of the kernel in
+// every target, declared before their first use, and not kernels of their own.
+func TestCompileHelpers(t *testing.T) {
+	text := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "WGSL": CompileWGSL,
+	}
+	decl := map[string]string{"MSL": " %s(", "GLSL": " %s(", "WGSL": "fn %s("}
+	entry := map[string]string{"MSL": "kernel void Lit(", "GLSL": "void main(", "WGSL": "fn Lit("}
+	for lang, compile := range text {
+		ks, err := compile(helperKernelSrc)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		if len(ks) != 1 || ks["Lit"] == nil {
+			t.Fatalf("%s: kernels = %v, want only Lit", lang, keys(ks))
+		}
+		src := ks["Lit"].MSL + ks["Lit"].GLSL + ks["Lit"].WGSL
+		// fresnel is called by shade, so must come first; the kernel last.
+		last := -1
+		for _, name := range []string{"fresnel", "light", "shade", "bump"} {
+			at := strings.Index(src, fmt.Sprintf(decl[lang], name))
+			if at < 0 {
+				t.Fatalf("%s: no function %s:\n%s", lang, name, src)
+			}
+			if name == "fresnel" || name == "shade" {
+				if at < last {
+					t.Fatalf("%s: %s declared after a function calling it:\n%s", lang, name, src)
+				}
+				last = at
+			}
+		}
+		if k := strings.Index(src, entry[lang]); k < last {
+			t.Fatalf("%s: kernel emitted before its helpers:\n%s", lang, src)
+		}
+	}
+
+	gl, _ := CompileGLSL(helperKernelSrc)
+	if !strings.Contains(gl["Lit"].GLSL, "light(0.3, 0.5, 0.8, float(2))") {
+		t.Fatalf("GLSL passes an int constant to a float parameter:\n%s", gl["Lit"].GLSL)
+	}
+	wg, _ := CompileWGSL(helperKernelSrc)
+	if !strings.Contains(wg["Lit"].WGSL, "fn bump(_v: f32, _k: i32) -> f32 {\n    var v = _v;\n    var k = _k;") {
+		t.Fatalf("WGSL bump does not copy its assigned parameters:\n%s", wg["Lit"].WGSL)
+	}
+
+	ks, err := CompileSPIRV(helperKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fns, calls int
+	for _, in := range decodeSPIRV(t, "Lit", ks["Lit"].SPIRV) {
+		switch in.op {
+		case spvOpFunction:
+			fns++
+		case spvOpFunctionCall:
+			calls++
+		}
+	}
+	if fns != 5 || calls != 5 {
+		t.Fatalf("SPIR-V has %d functions and %d calls, want 5 and 5", fns, calls)
+	}
+}
+
+func keys(ks map[string]*Kernel) []string {
+	var names []string
+	for name := range ks {
+		names = append(names, name)
+	}
+	return names
+}
+
+// TestCompileHelpersRejected checks what helpers cannot do in any target.
+func TestCompileHelpersRejected(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{
+			name: "recursion",
+			src: `package k
+func fact(n int) int { if n < 2 { return 1 }; return n * fact(n-1) }
+func K(gid uint, out []float32) { out[gid] = float32(fact(4)) }`,
+			want: "recursive call fact -> fact",
+		},
+		{
+			name: "mutual recursion",
+			src: `package k
+//gpu:func
+func even(n int) int { if n == 0 { return 1 }; return odd(n - 1) }
+//gpu:func
+func odd(n int) int { if n == 0 { return 0 }; return even(n - 1) }
+func K(gid uint, out []float32) { out[gid] = 1 }`,
+			want: "recursive call even -> odd -> even",
+		},
+		{
+			name: "buffer parameter",
+			src: `package k
+func get(b []float32, i uint) float32 { return b[i] }
+func K(gid uint, in []float32, out []float32) { out[gid] = get(in, gid) }`,
+			want: "buffers cannot be passed",
+		},
+		{
+			name: "called vertex kernel",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct{ Pos Vec4 ` + "`gpu:\"position\"`" + ` }
+//gpu:vertex
+func V(vid uint) VOut { return VOut{Vec4{0, 0, 0, 1}} }
+//gpu:vertex
+func W(vid uint) VOut { return V(vid) }`,
+			want: "vertex kernel V is called",
+		},
+		{
+			name: "arity",
+			src: `package k
+func sq(x float32) float32 { return x * x }
+func K(gid uint, out []float32) { out[gid] = sq(1, 2) }`,
+			want: "sq takes 1 arguments, got 2",
+		},
+	}
+	compilers := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL,
+	}
+	for _, tc := range cases {
+		for lang, compile := range compilers {
+			t.Run(tc.name+"/"+lang, func(t *testing.T) {
+				_, err := compile(tc.src)
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+				}
+			})
+		}
+	}
+}
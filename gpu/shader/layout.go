@@ -0,0 +1,273 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"math"
+	"reflect"
+)
+
+// Storage buffers hold scalars, vectors, matrices or kernel structs of them
+// ([]float32, []uint32, []int32, []Vec4, []Light, ...). The compiler lays a
+// struct element out the same way for every target: each field at the next
+// multiple of its alignment (4 for scalars, 8 for Vec2, 16 for Vec3, Vec4 and
+// Mat4), the struct aligned to its largest field and its size rounded up to
+// that, which is the array stride. This is both the Metal and the std430 /
+// WGSL layout, except that std430 and WGSL pack a scalar into the last 4
+// bytes of a Vec3 and Metal does not; a Vec3 field followed by a scalar is
+// rejected rather than laid out differently per backend.
+//
+// Layout packs host-side values into that layout, so host code and kernels
+// share one struct definition.
+
+// layoutField is a struct field and its offset in a storage buffer.
+type layoutField struct {
+	name, typ string // typ is the MSL type name
+	offset    int
+}
+
+// storageAlign returns the alignment and size of a storage-buffer value of
+// type t.
+func storageAlign(t string) (align, size int, err error) {
+	switch t {
+	case "float", "int", "uint":
+		return 4, 4, nil
+	case "float2":
+		return 8, 8, nil
+	case "float3", "float4":
+		return 16, 16, nil
+	case "float4x4":
+		return 16, 64, nil
+	}
+	return 0, 0, fmt.Errorf("type %q is not supported in a storage buffer", t)
+}
+
+// structLayout sets the offsets of a storage-buffer struct's fields and
+// returns its alignment and size.
+func structLayout(fields []layoutField) (align, size int, err error) {
+	align = 4
+	for i := range fields {
+		f := &fields[i]
+		a, s, err := storageAlign(f.typ)
+		if err != nil {
+			return 0, 0, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		if i > 0 && fields[i-1].typ == "float3" && a < 8 {
+			return 0, 0, fmt.Errorf("field %s follows Vec3 field %s, which backends pad differently; use a Vec4", f.name, fields[i-1].name)
+		}
+		size = (size + a - 1) / a * a
+		f.offset = size
+		size += s
+		align = max(align, a)
+	}
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("empty struct")
+	}
+	return align, (size + align - 1) / align * align, nil
+}
+
+// storageFields lays out a kernel struct as a storage-buffer element.
+func storageFields(st *ast.StructType) ([]layoutField, int, error) {
+	var fields []layoutField
+	for _, f := range st.Fields.List {
+		gt, _ := identType(f.Type)
+		mt, ok := goToMSLType(gt)
+		if !ok {
+			return nil, 0, fmt.Errorf("field %s: type %q is not supported in a storage buffer", fieldName(f), gt)
+		}
+		for _, n := range f.Names {
+			fields = append(fields, layoutField{name: n.Name, typ: mt})
+		}
+	}
+	_, size, err := structLayout(fields)
+	return fields, size, err
+}
+
+func fieldName(f *ast.Field) string {
+	if len(f.Names) == 0 {
+		return "(embedded)"
+	}
+	return f.Names[0].Name
+}
+
+// bufferElem resolves the element type of a []T buffer parameter: the MSL
+// name of a scalar, vector or matrix, or the name of a kernel struct with a
+// storage layout.
+func bufferElem(p param, at *ast.ArrayType, structs map[string]*ast.StructType) (string, error) {
+	if at.Len != nil {
+		return "", fmt.Errorf("parameter %q: only slices are supported as buffers", p.name)
+	}
+	elt, ok := identType(at.Elt)
+	if !ok {
+		return "", fmt.Errorf("parameter %q: unsupported slice element", p.name)
+	}
+	if mt, ok := goToMSLType(elt); ok {
+		return mt, nil
+	}
+	st, ok := structs[elt]
+	if !ok {
+		return "", fmt.Errorf("parameter %q: unsupported slice element %q", p.name, elt)
+	}
+	if _, _, err := storageFields(st); err != nil {
+		return "", fmt.Errorf("parameter %q: %s: %w", p.name, elt, err)
+	}
+	return elt, nil
+}
+
+// bindingSizes sets the MinSize of k's buffer bindings from the parameter
+// types of fn, its source.
+func bindingSizes(k *Kernel, fn *ast.FuncDecl, structs map[string]*ast.StructType) {
+	types := map[string]ast.Expr{}
+	for _, p := range flattenParams(fn.Type.Params) {
+		types[p.name] = p.typ
+	}
+	for i, b := range k.Bindings {
+		if b.Kind == StorageBuffer || b.Kind == UniformBuffer {
+			k.Bindings[i].MinSize = bufferSize(types[b.Name], structs)
+		}
+	}
+}
+
+// bufferSize returns the size of the element of a []T parameter, or of a
+// struct parameter, in the storage layout; 0 if it has none.
+func bufferSize(t ast.Expr, structs map[string]*ast.StructType) int {
+	if at, ok := t.(*ast.ArrayType); ok {
+		t = at.Elt
+	}
+	name, ok := identType(t)
+	if !ok {
+		return 0
+	}
+	if mt, ok := goToMSLType(name); ok {
+		_, size, _ := storageAlign(mt)
+		return size
+	}
+	if st, ok := structs[name]; ok {
+		if _, size, err := storageFields(st); err == nil {
+			return size
+		}
+	}
+	return 0
+}
+
+// Layout packs elems into the bytes a kernel's []T storage buffer holds, on
+// every backend. T is a scalar (float32, uint32, int32; int and uint are
+// stored as 32 bits, as kernels see them), a vector or matrix type named
+// Vec2, Vec3, Vec4 or Mat4 of float32 components (gpumath's, say), or a
+// struct of those, such as the kernel struct itself. Padding bytes are zero.
+func Layout[T any](elems []T) ([]byte, error) {
+	t := reflect.TypeFor[T]()
+	var fields []layoutField
+	var goFields []int // field index in T, for structs
+	stride := 0
+	if mt, err := hostType(t); err == nil {
+		_, stride, _ = storageAlign(mt)
+		fields = []layoutField{{name: t.Name(), typ: mt}}
+	} else if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("shader: Layout: %w", err)
+	} else {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			mt, err := hostType(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("shader: Layout: %s.%s: %w", t.Name(), f.Name, err)
+			}
+			fields = append(fields, layoutField{name: f.Name, typ: mt})
+			goFields = append(goFields, i)
+		}
+		if _, stride, err = structLayout(fields); err != nil {
+			return nil, fmt.Errorf("shader: Layout: %s: %w", t.Name(), err)
+		}
+	}
+
+	out := make([]byte, stride*len(elems))
+	for i := range elems {
+		v := reflect.ValueOf(&elems[i]).Elem()
+		for j, f := range fields {
+			fv := v
+			if goFields != nil {
+				fv = v.Field(goFields[j])
+			}
+			putHost(out[i*stride+f.offset:], fv)
+		}
+	}
+	return out, nil
+}
+
+// hostType maps a Go type to the MSL type a kernel declares for it, checking
+// that vectors and matrices are made of the right number of float32s.
+func hostType(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Uint32, reflect.Uint:
+		return "uint", nil
+	case reflect.Int32, reflect.Int:
+		return "int", nil
+	}
+	mt, ok := goToMSLType(t.Name())
+	if !ok || mt == "float" || mt == "int" || mt == "uint" {
+		return "", fmt.Errorf("type %v is not supported in a storage buffer", t)
+	}
+	want := map[string]int{"float2": 2, "float3": 3, "float4": 4, "float4x4": 16}[mt]
+	if n, ok := floatCount(t); !ok || n != want {
+		return "", fmt.Errorf("%v is not %d float32s", t, want)
+	}
+	return mt, nil
+}
+
+// floatCount counts the float32s of a struct or array made only of them.
+func floatCount(t reflect.Type) (int, bool) {
+	switch t.Kind() {
+	case reflect.Float32:
+		return 1, true
+	case reflect.Array:
+		n, ok := floatCount(t.Elem())
+		return n * t.Len(), ok
+	case reflect.Struct:
+		total := 0
+		for i := range t.NumField() {
+			n, ok := floatCount(t.Field(i).Type)
+			if !ok {
+				return 0, false
+			}
+			total += n
+		}
+		return total, true
+	}
+	return 0, false
+}
+
+// putHost writes v, a value hostType accepted, at the start of b; vector and
+// matrix components go in field order.
+func putHost(b []byte, v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Float32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v.Float())))
+		return 4
+	case reflect.Uint32, reflect.Uint:
+		binary.LittleEndian.PutUint32(b, uint32(v.Uint()))
+		return 4
+	case reflect.Int32, reflect.Int:
+		binary.LittleEndian.PutUint32(b, uint32(int32(v.Int())))
+		return 4
+	case reflect.Array:
+		n := 0
+		for i := range v.Len() {
+			n += putHost(b[n:], v.Index(i))
+		}
+		return n
+	case reflect.Struct:
+		n := 0
+		for i := range v.NumField() {
+			n += putHost(b[n:], v.Field(i))
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,277 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"poly.red/gpu/shader/gpumath"
+)
+
+// typedBufferKernelSrc reads and writes struct, uint, int and vector
+// buffers: whole elements, fields and vector components of fields.
+const typedBufferKernelSrc = `
+package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type Light struct {
+	Pos   Vec4
+	Color Vec4
+	Range float32
+	Kind  uint32
+}
+
+type Frag struct {
+	Color Vec4
+	Depth float32
+	ID    int32
+}
+
+func Shade(gid uint, lights []Light, ids []uint32, offs []int32, dirs []Vec4, out []Frag) {
+	l := lights[gid]
+	c := l.Color * (l.Range / (1.0 + dot(l.Pos, dirs[gid])))
+	if lights[gid].Kind > 2 {
+		c = c * 0.5
+	}
+	out[gid] = Frag{c, float32(ids[gid]%7) + lights[gid].Pos.X, offs[gid] + 3}
+	out[gid].Color.W = 1.0
+}
+`
+
+// TestCompileTypedBuffers checks the struct and typed buffer declarations of
+// every target, and the SPIR-V layout decorations of the Light element.
+func TestCompileTypedBuffers(t *testing.T) {
+	want := map[string][]string{
+		"MSL": {
+			"device const Light* lights [[buffer(0)]]",
+			"device const uint* ids [[buffer(1)]]",
+			"device const int* offs [[buffer(2)]]",
+			"device const float4* dirs [[buffer(3)]]",
+			"device Frag* out [[buffer(4)]]",
+			"if ((lights[gid].Kind > 2)) {",
+			"out[gid].Color.w = 1.0;",
+		},
+		"GLSL": {
+			"struct Light {\n    vec4 Pos;\n    vec4 Color;\n    float Range;\n    uint Kind;\n};",
+			"readonly buffer _ssbo0 { Light lights[]; };",
+			"readonly buffer _ssbo1 { uint ids[]; };",
+			"buffer _ssbo4 { Frag out_[]; };",
+			"if ((lights[gid].Kind > uint(2))) {",
+		},
+		"WGSL": {
+			"var<storage, read> lights: array<Light>;",
+			"var<storage, read> offs: array<i32>;",
+			"var<storage, read> dirs: array<vec4<f32>>;",
+			"var<storage, read_write> out: array<Frag>;",
+		},
+	}
+	text := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "WGSL": CompileWGSL,
+	}
+	for lang, compile := range text {
+		ks, err := compile(typedBufferKernelSrc)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		k := ks["Shade"]
+		src := k.MSL + k.GLSL + k.WGSL
+		for _, w := range want[lang] {
+			if !strings.Contains(src, w) {
+				t.Errorf("%s: missing %q in:\n%s", lang, w, src)
+			}
+		}
+		if lang == "GLSL" && strings.Index(src, "struct Frag") > strings.Index(src, "_ssbo4") {
+			t.Errorf("GLSL: Frag declared after the buffer holding it:\n%s", src)
+		}
+	}
+
+	ks, err := CompileSPIRV(typedBufferKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insts := decodeSPIRV(t, "Shade", ks["Shade"].SPIRV)
+	offsets := map[uint32][]uint32{} // struct id -> member offsets
+	strides := map[uint32]bool{}
+	for _, in := range insts {
+		switch {
+		case in.op == spvOpMemberDecorate && in.operands[2] == spvDecOffset:
+			offsets[in.operands[0]] = append(offsets[in.operands[0]], in.operands[3])
+		case in.op == spvOpDecorate && in.operands[1] == spvDecArrayStride:
+			strides[in.operands[2]] = true
+		}
+	}
+	var light, frag bool
+	for _, offs := range offsets {
+		switch fmt.Sprint(offs) {
+		case "[0 16 32 36]":
+			light = true
+		case "[0 16 20]":
+			frag = true
+		}
+	}
+	if !light || !frag {
+		t.Errorf("SPIR-V member offsets %v, want a Light (0,16,32,36) and a Frag (0,16,20)", offsets)
+	}
+	for _, s := range []uint32{4, 16, 32, 48} {
+		if !strides[s] {
+			t.Errorf("SPIR-V array strides %v, want %d among them", strides, s)
+		}
+	}
+}
+
+// TestBindingMinSize checks the MinSize of each buffer binding on every
+// target: one element of a storage buffer, the struct of a uniform.
+func TestBindingMinSize(t *testing.T) {
+	src := typedBufferKernelSrc + `
+type Params struct {
+	Tint  Vec4
+	Scale float32
+}
+
+func Tint(gid uint, p Params, out []Vec4) {
+	out[gid] = p.Tint * p.Scale
+}
+`
+	want := map[string]int{"lights": 48, "ids": 4, "offs": 4, "dirs": 16, "out": 32, "p": 32}
+	for lang, compile := range map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL, "CPU": CompileCPU,
+	} {
+		ks, err := compile(src)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		for _, k := range []*Kernel{ks["Shade"], ks["Tint"]} {
+			for _, b := range k.Bindings {
+				w := want[b.Name]
+				if k.Name == "Tint" && b.Name == "out" {
+					w = 16
+				}
+				if b.MinSize != w {
+					t.Errorf("%s: %s binding %s has MinSize %d, want %d", lang, k.Name, b.Name, b.MinSize, w)
+				}
+			}
+		}
+	}
+}
+
+// TestCompileTypedBuffersRejected checks the element types every target
+// refuses.
+func TestCompileTypedBuffersRejected(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{
+			name: "vec3 then scalar",
+			src: `package k
+type P struct {
+	N Vec3
+	D float32
+}
+func K(gid uint, ps []P, out []float32) { out[gid] = ps[gid].D }`,
+			want: "field D follows Vec3 field N",
+		},
+		{
+			name: "nested struct",
+			src: `package k
+type In struct{ A float32 }
+type P struct{ I In }
+func K(gid uint, ps []P, out []float32) { out[gid] = ps[gid].I.A }`,
+			want: `field I: type "In" is not supported in a storage buffer`,
+		},
+		{
+			name: "array",
+			src: `package k
+func K(gid uint, ps [4]float32, out []float32) { out[gid] = ps[0] }`,
+			want: "only slices are supported as buffers",
+		},
+		{
+			name: "unknown element",
+			src: `package k
+func K(gid uint, ps []float64, out []float32) { out[gid] = 1 }`,
+			want: `unsupported slice element "float64"`,
+		},
+	}
+	compilers := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL,
+	}
+	for _, tc := range cases {
+		for lang, compile := range compilers {
+			t.Run(tc.name+"/"+lang, func(t *testing.T) {
+				_, err := compile(tc.src)
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// TestLayout checks the bytes Layout packs for structs, vectors and scalars.
+func TestLayout(t *testing.T) {
+	type Light struct {
+		Pos   gpumath.Vec4
+		Color gpumath.Vec4
+		Range float32
+		Kind  uint32
+	}
+	b, err := Layout([]Light{
+		{Pos: gpumath.Vec4{X: 1, Y: 2, Z: 3, W: 4}, Color: gpumath.Vec4{X: 5, Y: 6, Z: 7, W: 8}, Range: 9, Kind: 10},
+		{Range: 11, Kind: 12},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 96 {
+		t.Fatalf("len = %d, want 2 elements of 48 bytes", len(b))
+	}
+	f := func(off int) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b[off:])) }
+	u := func(off int) uint32 { return binary.LittleEndian.Uint32(b[off:]) }
+	if f(0) != 1 || f(12) != 4 || f(16) != 5 || f(32) != 9 || u(36) != 10 || u(40) != 0 || f(48+32) != 11 || u(48+36) != 12 {
+		t.Fatalf("Light bytes = %v", b)
+	}
+
+	// A mix of alignments: Vec2 at 8, Mat4 at 16, the struct rounded to 16.
+	type Mixed struct {
+		A int32
+		B gpumath.Vec2
+		M gpumath.Mat4
+		C int
+	}
+	b, err = Layout([]Mixed{{A: -1, B: gpumath.Vec2{X: 2, Y: 3}, M: gpumath.Mat4{C3: gpumath.Vec4{W: 7}}, C: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 96 || u(0) != math.MaxUint32 || f(8) != 2 || f(12) != 3 || f(16+60) != 7 || u(80) != 5 {
+		t.Fatalf("Mixed bytes (%d) = %v", len(b), b)
+	}
+
+	// Vec3 elements are padded to 16 bytes; scalars are packed.
+	if b, _ = Layout([]gpumath.Vec3{{X: 1, Y: 2, Z: 3}, {X: 4}}); len(b) != 32 || f(16) != 4 {
+		t.Fatalf("Vec3 bytes = %v", b)
+	}
+	if b, _ = Layout([]uint32{1, 2, 3}); len(b) != 12 || u(8) != 3 {
+		t.Fatalf("uint32 bytes = %v", b)
+	}
+
+	type BadPad struct {
+		N gpumath.Vec3
+		D float32
+	}
+	if _, err := Layout([]BadPad{{}}); err == nil || !strings.Contains(err.Error(), "follows Vec3") {
+		t.Errorf("BadPad: err = %v", err)
+	}
+	type BadField struct{ S string }
+	if _, err := Layout([]BadField{{}}); err == nil || !strings.Contains(err.Error(), "BadField.S") {
+		t.Errorf("BadField: err = %v", err)
+	}
+	if _, err := Layout([]float64{1}); err == nil {
+		t.Errorf("float64: no error")
+	}
+}
@@ -90,7 +90,10 @@ func TestGoShaderLightUniform(t *testing.T) {
 	lightBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferUniform, Data: lub(light)})
 
 	layout := dev.NewBindGroupLayout(gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageFragment, Kind: gpu.UniformBuffer})
-	bg := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: lightBuf})
+	bg, err := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: lightBuf})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: target, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1}})
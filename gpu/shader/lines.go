@@ -0,0 +1,52 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Line tables: the text emitters mark the line each Go statement starts on,
+// and compileAll strips the marks into Kernel.Lines, so a driver log about
+// line n of the generated source can name the Go position Lines[n-1].
+
+// lineMark brackets a token.Pos in emitted text; no emitted source has NULs.
+const lineMark = "\x00"
+
+// mark tags the line being written with the Go position pos.
+func (c *compiler) mark(pos token.Pos) {
+	fmt.Fprintf(&c.buf, "%s%d%s", lineMark, pos, lineMark)
+}
+
+// lineTable strips the marks from src and returns the Go position of each of
+// its lines: that of the last statement marked on or above it, up to the
+// next unindented line, which starts a declaration of its own.
+func lineTable(src string, fset *token.FileSet) (string, []token.Position) {
+	var out strings.Builder
+	var lines []token.Position
+	var cur token.Position
+	for l := range strings.Lines(src) {
+		marked := false
+		for {
+			i := strings.Index(l, lineMark)
+			if i < 0 {
+				break
+			}
+			j := i + 1 + strings.Index(l[i+1:], lineMark)
+			p, _ := strconv.Atoi(l[i+1 : j])
+			cur, marked = fset.Position(token.Pos(p)), true
+			l = l[:i] + l[j+1:]
+		}
+		if !marked && l != "" && l[0] != ' ' && l[0] != '\n' {
+			cur = token.Position{}
+		}
+		out.WriteString(l)
+		lines = append(lines, cur)
+	}
+	return out.String(), lines
+}
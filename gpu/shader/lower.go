@@ -0,0 +1,401 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"sort"
+)
+
+// Lowering: once the checker accepts the source, compileAll rewrites the Go
+// control flow the targets have no direct spelling for into the statements
+// every emitter already handles, so MSL, GLSL, WGSL and SPIR-V agree.
+//
+//   - A switch becomes an if/else chain over a temporary holding its tag,
+//     default last. If a break leaves the switch, the chain runs in a
+//     one-trip for loop ending in a break.
+//   - break and continue lose their labels. One whose target is not the
+//     innermost loop sets a flag and breaks instead; after each loop it
+//     leaves, the flag is tested to break (or continue) again.
+//   - A helper with several results returns a struct of them, named
+//     <helper>Results with fields R0, R1, ...; a return builds it, and a
+//     multi-value assignment or var declaration unpacks it from a temporary.
+//
+// The new statements carry the positions of the Go ones they stand for, so
+// line tables still name the source.
+
+// lowerFuncs lowers the kernels and helpers in place, adding the result
+// structs of multi-result helpers to structs.
+func lowerFuncs(kernels []*ast.FuncDecl, helpers map[string]*ast.FuncDecl, structs map[string]*ast.StructType) error {
+	l := &lowerer{results: map[string]int{}}
+	names := make([]string, 0, len(helpers))
+	for name := range helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := helpers[name]
+		sig, err := helperSig(fn, structs)
+		if err != nil {
+			return err
+		}
+		if len(sig.results) < 2 {
+			continue
+		}
+		st := resultsName(name)
+		if _, ok := structs[st]; ok {
+			return fmt.Errorf("func %s: type %s is taken, but names the struct of its results", name, st)
+		}
+		var fields []*ast.Field
+		for _, f := range fn.Type.Results.List {
+			for range max(1, len(f.Names)) {
+				fields = append(fields, &ast.Field{Names: []*ast.Ident{ast.NewIdent(fmt.Sprintf("R%d", len(fields)))}, Type: f.Type})
+			}
+		}
+		structs[st] = &ast.StructType{Fields: &ast.FieldList{List: fields}}
+		fn.Type.Results = &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{NamePos: fn.Type.Results.Pos(), Name: st}}}}
+		l.results[name] = len(fields)
+	}
+	for _, fn := range append(sortedFuncs(helpers), kernels...) {
+		l.fn = fn.Name.Name
+		fn.Body.List = l.block(fn.Body.List)
+	}
+	return nil
+}
+
+// resultsName names the struct of the results of helper fn.
+func resultsName(fn string) string { return fn + "Results" }
+
+type lowerer struct {
+	results map[string]int // the helpers with several results, and how many
+	fn      string         // the function being lowered
+	n       int            // temporaries named so far
+	targets []*jumpTarget  // the enclosing fors and switches, innermost last
+}
+
+// jumpTarget is a for or switch that break or continue may leave.
+type jumpTarget struct {
+	label string
+	loop  bool   // a for once lowered: a Go for, or a switch a break leaves
+	cont  bool   // a Go for, which continue may name
+	brk   string // the flag set to break out of it, once needed
+	next  string // the flag set to continue it, once needed
+	exits []exit // the flags set in it for targets further out
+}
+
+// exit is a flag set for a break or continue out of several loops.
+type exit struct {
+	flag string
+	to   *jumpTarget
+	cont bool
+	pos  token.Pos
+}
+
+func (l *lowerer) block(list []ast.Stmt) []ast.Stmt {
+	var out []ast.Stmt
+	for _, s := range list {
+		out = append(out, l.stmt(s)...)
+	}
+	return out
+}
+
+func (l *lowerer) stmt(s ast.Stmt) []ast.Stmt {
+	switch st := s.(type) {
+	case *ast.BlockStmt:
+		st.List = l.block(st.List)
+	case *ast.IfStmt:
+		st.Body.List = l.block(st.Body.List)
+		if st.Else != nil {
+			l.stmt(st.Else)
+		}
+	case *ast.ForStmt:
+		return l.forStmt(st, "")
+	case *ast.SwitchStmt:
+		return l.switchStmt(st, "")
+	case *ast.LabeledStmt:
+		if f, ok := st.Stmt.(*ast.ForStmt); ok {
+			return l.forStmt(f, st.Label.Name)
+		}
+		return l.switchStmt(st.Stmt.(*ast.SwitchStmt), st.Label.Name)
+	case *ast.BranchStmt:
+		return l.branch(st)
+	case *ast.AssignStmt:
+		if len(st.Lhs) > 1 && len(st.Rhs) == 1 {
+			return l.unpack(st.Rhs[0], st.Lhs, st.Tok, st)
+		}
+	case *ast.DeclStmt:
+		return l.declStmt(st)
+	case *ast.ReturnStmt:
+		return l.returnStmt(st)
+	}
+	return []ast.Stmt{s}
+}
+
+func (l *lowerer) forStmt(st *ast.ForStmt, label string) []ast.Stmt {
+	t := &jumpTarget{label: label, loop: true, cont: true}
+	l.targets = append(l.targets, t)
+	st.Body.List = l.block(st.Body.List)
+	l.targets = l.targets[:len(l.targets)-1]
+	return l.around(t, st)
+}
+
+// switchStmt lowers a switch to an if/else chain comparing a temporary
+// holding the tag with each case, in a one-trip loop if a break leaves it.
+func (l *lowerer) switchStmt(st *ast.SwitchStmt, label string) []ast.Stmt {
+	t := &jumpTarget{label: label}
+	var clauses []*ast.CaseClause
+	for _, s := range st.Body.List {
+		cc := s.(*ast.CaseClause)
+		clauses = append(clauses, cc)
+		t.loop = t.loop || breaks(cc.Body, label)
+	}
+	l.targets = append(l.targets, t)
+	for _, cc := range clauses {
+		cc.Body = l.block(cc.Body)
+	}
+	l.targets = l.targets[:len(l.targets)-1]
+
+	var list []ast.Stmt
+	if st.Init != nil {
+		list = l.stmt(st.Init)
+	}
+	var tag *ast.Ident
+	if st.Tag != nil {
+		tag = l.temp("_sw", st.Tag.Pos())
+		list = append(list, define(tag, st.Tag))
+	}
+	var chain ast.Stmt
+	for _, cc := range clauses {
+		if cc.List == nil {
+			chain = &ast.BlockStmt{Lbrace: cc.Case, List: cc.Body}
+		}
+	}
+	for i := len(clauses) - 1; i >= 0; i-- {
+		cc := clauses[i]
+		if cc.List == nil {
+			continue
+		}
+		var cond ast.Expr
+		for _, e := range cc.List {
+			if tag != nil {
+				e = &ast.BinaryExpr{X: ast.NewIdent(tag.Name), OpPos: e.Pos(), Op: token.EQL, Y: e}
+			}
+			if cond == nil {
+				cond = e
+			} else {
+				cond = &ast.BinaryExpr{X: cond, OpPos: e.Pos(), Op: token.LOR, Y: e}
+			}
+		}
+		chain = &ast.IfStmt{If: cc.Case, Cond: cond, Body: &ast.BlockStmt{Lbrace: cc.Colon, List: cc.Body}, Else: chain}
+	}
+	if t.loop {
+		body := []ast.Stmt{&ast.BranchStmt{TokPos: st.Body.Rbrace, Tok: token.BREAK}}
+		if chain != nil {
+			body = append([]ast.Stmt{chain}, body...)
+		}
+		chain = &ast.ForStmt{For: st.Switch, Body: &ast.BlockStmt{Lbrace: st.Body.Lbrace, List: body}}
+	}
+	if chain != nil {
+		list = append(list, l.around(t, chain)...)
+	}
+	return []ast.Stmt{&ast.BlockStmt{Lbrace: st.Switch, List: list}}
+}
+
+// around declares the flags of t before s, its lowered statement, and tests
+// after it the flags set in it for targets further out.
+func (l *lowerer) around(t *jumpTarget, s ast.Stmt) []ast.Stmt {
+	var out []ast.Stmt
+	for _, flag := range []string{t.brk, t.next} {
+		if flag != "" {
+			out = append(out, define(&ast.Ident{NamePos: s.Pos(), Name: flag}, ast.NewIdent("false")))
+		}
+	}
+	out = append(out, s)
+	if !t.loop {
+		return out
+	}
+	for _, x := range t.exits {
+		inner := l.loop()
+		then := []ast.Stmt{&ast.BranchStmt{TokPos: x.pos, Tok: token.BREAK}}
+		switch {
+		case x.cont && inner == x.to:
+			then = []ast.Stmt{setFlag(x.flag, false, x.pos), &ast.BranchStmt{TokPos: x.pos, Tok: token.CONTINUE}}
+		case inner != x.to:
+			inner.exit(x)
+		}
+		cond := &ast.Ident{NamePos: x.pos, Name: x.flag}
+		out = append(out, &ast.IfStmt{If: x.pos, Cond: cond, Body: &ast.BlockStmt{Lbrace: x.pos, List: then}})
+	}
+	return out
+}
+
+// branch lowers a break or continue: one leaving the innermost loop stays,
+// unlabeled; one going further sets its target's flag and breaks.
+func (l *lowerer) branch(st *ast.BranchStmt) []ast.Stmt {
+	cont := st.Tok == token.CONTINUE
+	var to *jumpTarget
+	for i := len(l.targets) - 1; i >= 0 && to == nil; i-- {
+		t := l.targets[i]
+		switch {
+		case st.Label != nil:
+			if t.label == st.Label.Name {
+				to = t
+			}
+		case !cont || t.cont:
+			to = t
+		}
+	}
+	inner := l.loop()
+	if inner == to {
+		return []ast.Stmt{&ast.BranchStmt{TokPos: st.TokPos, Tok: st.Tok}}
+	}
+	flag := &to.brk
+	if cont {
+		flag = &to.next
+	}
+	if *flag == "" {
+		l.n++
+		*flag = fmt.Sprintf("_%s%d", st.Tok, l.n)
+	}
+	inner.exit(exit{flag: *flag, to: to, cont: cont, pos: st.TokPos})
+	return []ast.Stmt{setFlag(*flag, true, st.TokPos), &ast.BranchStmt{TokPos: st.TokPos, Tok: token.BREAK}}
+}
+
+// loop is the innermost target that is a loop once lowered.
+func (l *lowerer) loop() *jumpTarget {
+	for i := len(l.targets) - 1; i >= 0; i-- {
+		if l.targets[i].loop {
+			return l.targets[i]
+		}
+	}
+	return nil
+}
+
+// exit records that x's flag may be set when t ends.
+func (t *jumpTarget) exit(x exit) {
+	for _, y := range t.exits {
+		if y.flag == x.flag {
+			return
+		}
+	}
+	t.exits = append(t.exits, x)
+}
+
+// unpack lowers lhs tok call, a call of a helper with several results, to
+// a temporary holding the struct it returns and an assignment of each
+// field. A name := declares is new unless declared before in its scope.
+func (l *lowerer) unpack(call ast.Expr, lhs []ast.Expr, tok token.Token, decl ast.Node) []ast.Stmt {
+	tmp := l.temp("_r", lhs[0].Pos())
+	out := []ast.Stmt{define(tmp, call)}
+	for i, e := range lhs {
+		id, ok := e.(*ast.Ident)
+		if ok && id.Name == "_" {
+			continue
+		}
+		t := tok
+		if ok && tok == token.DEFINE && (id.Obj == nil || id.Obj.Decl != decl) {
+			t = token.ASSIGN
+		}
+		out = append(out, &ast.AssignStmt{Lhs: []ast.Expr{e}, TokPos: e.Pos(), Tok: t, Rhs: []ast.Expr{resultField(tmp, i)}})
+	}
+	return out
+}
+
+// declStmt lowers var a, b = f() like a, b := f(), keeping the declared
+// type; other declarations stay.
+func (l *lowerer) declStmt(st *ast.DeclStmt) []ast.Stmt {
+	multi := func(vs *ast.ValueSpec) bool { return len(vs.Values) == 1 && len(vs.Names) > 1 }
+	gd := st.Decl.(*ast.GenDecl)
+	if !slices.ContainsFunc(gd.Specs, func(s ast.Spec) bool { return multi(s.(*ast.ValueSpec)) }) {
+		return []ast.Stmt{st}
+	}
+	var out []ast.Stmt
+	for _, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if !multi(vs) {
+			out = append(out, &ast.DeclStmt{Decl: &ast.GenDecl{TokPos: vs.Pos(), Tok: token.VAR, Specs: []ast.Spec{vs}}})
+			continue
+		}
+		tmp := l.temp("_r", vs.Pos())
+		out = append(out, define(tmp, vs.Values[0]))
+		for i, name := range vs.Names {
+			if name.Name == "_" {
+				continue
+			}
+			one := &ast.ValueSpec{Names: []*ast.Ident{name}, Type: vs.Type, Values: []ast.Expr{resultField(tmp, i)}}
+			out = append(out, &ast.DeclStmt{Decl: &ast.GenDecl{TokPos: name.Pos(), Tok: token.VAR, Specs: []ast.Spec{one}}})
+		}
+	}
+	return out
+}
+
+// returnStmt lowers a return from a helper with several results to one of
+// the struct of them.
+func (l *lowerer) returnStmt(st *ast.ReturnStmt) []ast.Stmt {
+	n, ok := l.results[l.fn]
+	if !ok {
+		return []ast.Stmt{st}
+	}
+	var out []ast.Stmt
+	results := st.Results
+	if len(results) == 1 {
+		// return g(), g having the same results.
+		tmp := l.temp("_r", st.Return)
+		out = append(out, define(tmp, results[0]))
+		results = nil
+		for i := range n {
+			results = append(results, resultField(tmp, i))
+		}
+	}
+	lit := &ast.CompositeLit{Type: &ast.Ident{NamePos: st.Return, Name: resultsName(l.fn)}, Lbrace: st.Return, Elts: results}
+	return append(out, &ast.ReturnStmt{Return: st.Return, Results: []ast.Expr{lit}})
+}
+
+// temp names a new temporary.
+func (l *lowerer) temp(prefix string, pos token.Pos) *ast.Ident {
+	l.n++
+	return &ast.Ident{NamePos: pos, Name: fmt.Sprintf("%s%d", prefix, l.n)}
+}
+
+func define(id *ast.Ident, v ast.Expr) *ast.AssignStmt {
+	return &ast.AssignStmt{Lhs: []ast.Expr{id}, TokPos: id.Pos(), Tok: token.DEFINE, Rhs: []ast.Expr{v}}
+}
+
+func setFlag(flag string, v bool, pos token.Pos) *ast.AssignStmt {
+	return &ast.AssignStmt{Lhs: []ast.Expr{&ast.Ident{NamePos: pos, Name: flag}}, TokPos: pos, Tok: token.ASSIGN, Rhs: []ast.Expr{ast.NewIdent(fmt.Sprint(v))}}
+}
+
+func resultField(tmp *ast.Ident, i int) ast.Expr {
+	return &ast.SelectorExpr{X: ast.NewIdent(tmp.Name), Sel: ast.NewIdent(fmt.Sprintf("R%d", i))}
+}
+
+// breaks reports whether a break in list leaves the for or switch whose body
+// it is: an unlabeled one outside nested fors and switches, or one naming
+// label.
+func breaks(list []ast.Stmt, label string) bool {
+	var walk func(n ast.Node, nested bool) bool
+	walk = func(n ast.Node, nested bool) bool {
+		found := false
+		ast.Inspect(n, func(m ast.Node) bool {
+			switch m := m.(type) {
+			case *ast.BranchStmt:
+				if m.Tok == token.BREAK && (m.Label == nil && !nested || m.Label != nil && m.Label.Name == label) {
+					found = true
+				}
+			case *ast.ForStmt, *ast.SwitchStmt:
+				if m != n {
+					found = found || walk(m, true)
+					return false
+				}
+			}
+			return !found
+		})
+		return found
+	}
+	return walk(&ast.BlockStmt{List: list}, false)
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"strings"
+	"testing"
+)
+
+// controlKernelSrc uses every statement lowering rewrites: a tagged switch
+// with a multi-value case and a break, a tagless one, labeled break and
+// continue out of nested loops, an early return from a loop, and helpers with
+// several results, unpacked by :=, = and var and forwarded by return.
+const controlKernelSrc = `
+package kernels
+
+func minmax(a, b float32) (float32, float32) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+func sorted(a, b float32) (lo, hi float32) {
+	return minmax(a, b)
+}
+
+func Control(gid uint, in []float32, out []float32) {
+	x := in[gid]
+	switch int(gid) % 4 {
+	case 0, 1:
+		if x < 0 {
+			break
+		}
+		x = x * 2
+	case 2:
+		x = -x
+	default:
+		x = 0
+	}
+	switch {
+	case x > 10:
+		x = 10
+	case x < -10:
+		x = -10
+	}
+	n := 0
+outer:
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			if j > i {
+				continue outer
+			}
+			if n > 5 {
+				break outer
+			}
+			n++
+		}
+	}
+	for k := 0; k < 8; k++ {
+		if in[k] < 0 {
+			out[gid] = -1
+			return
+		}
+	}
+	lo, hi := sorted(x, float32(n))
+	var a, _ = minmax(hi, lo)
+	lo, hi = minmax(a, x)
+	out[gid] = lo + hi
+}
+`
+
+// TestCompileControlFlow checks what the lowering leaves for the emitters:
+// switches as if chains on a temporary, a breaking switch in a one-pass loop,
+// labeled branches through flags, and results packed in a struct.
+func TestCompileControlFlow(t *testing.T) {
+	for lang, tc := range map[string]struct {
+		compile func(string) (map[string]*Kernel, error)
+		want    []string
+	}{
+		"MSL": {Compile, []string{
+			"struct minmaxResults {\n    float R0;\n    float R1;\n};",
+			"return minmaxResults{a, b};",
+			"minmaxResults _r1 = minmax(a, b);\n    return sortedResults{_r1.R0, _r1.R1};",
+			"int _sw2 = (int(gid) % 4);",
+			"if (((_sw2 == 0) || (_sw2 == 1))) {",
+			"for (; ; ) {",
+			"bool _continue3 = false;",
+			"_continue3 = true;\n                break;",
+			"if (_continue3) {\n            _continue3 = false;\n            continue;\n        }",
+			"if (_break4) {\n            break;\n        }",
+			"float lo = _r5.R0;",
+			"float a = _r6.R0;",
+			"lo = _r7.R0;",
+		}},
+		"GLSL": {CompileGLSL, []string{
+			"struct minmaxResults {",
+			"return minmaxResults(a, b);",
+			"int _sw2 = (int(gid) % 4);",
+			"for (; ; ) {",
+			"if (_continue3) {",
+			"float lo = _r5.R0;",
+		}},
+		"WGSL": {CompileWGSL, []string{
+			"struct minmaxResults {",
+			"fn sorted(a: f32, b: f32) -> sortedResults {",
+			"for (; ; ) {",
+			"var lo = _r5.R0;",
+		}},
+	} {
+		ks, err := tc.compile(controlKernelSrc)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		src := ks["Control"].MSL + ks["Control"].GLSL + ks["Control"].WGSL
+		for _, w := range tc.want {
+			if !strings.Contains(src, w) {
+				t.Errorf("%s: missing %q in:\n%s", lang, w, src)
+			}
+		}
+		if strings.Contains(src, "outer") || strings.Contains(src, "switch") {
+			t.Errorf("%s: label or switch left in:\n%s", lang, src)
+		}
+	}
+	if _, err := CompileSPIRV(controlKernelSrc); err != nil {
+		t.Fatalf("SPIR-V: %v", err)
+	}
+}
@@ -80,10 +80,13 @@ func TestGoShaderMat4(t *testing.T) {
 	vb, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferStorage | gpu.BufferCopyDst, Data: matBytes(v)})
 	ub, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 64, Usage: gpu.BufferUniform, Data: matBytes(mat)})
 	out, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferStorage | gpu.BufferMapRead})
-	bg := dev.NewBindGroup(layout,
+	bg, err := dev.NewBindGroup(layout,
 		gpu.BindGroupEntry{Binding: 0, Buffer: vb},
 		gpu.BindGroupEntry{Binding: 1, Buffer: ub},
 		gpu.BindGroupEntry{Binding: 2, Buffer: out})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	cp := enc.BeginComputePass()
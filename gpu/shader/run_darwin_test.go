@@ -129,10 +129,13 @@ func TestGoShaderEndToEnd(t *testing.T) {
 	t.Run("Add", func(t *testing.T) {
 		pipe, layout := build("Add")
 		a, b, ob := storage(m1.Data), storage(m2.Data), out(n)
-		bg := dev.NewBindGroup(layout,
+		bg, err := dev.NewBindGroup(layout,
 			gpu.BindGroupEntry{Binding: 0, Buffer: a},
 			gpu.BindGroupEntry{Binding: 1, Buffer: b},
 			gpu.BindGroupEntry{Binding: 2, Buffer: ob})
+		if err != nil {
+			t.Fatal(err)
+		}
 		got := math.Mat[float32]{Row: 10, Col: 10, Data: dispatch(pipe, bg, n, n, ob)}
 		if !got.EqEps(m1.Add(m2), gpuEps) {
 			t.Fatal("Go→shader Add != CPU")
@@ -142,10 +145,13 @@ func TestGoShaderEndToEnd(t *testing.T) {
 	t.Run("Sub", func(t *testing.T) {
 		pipe, layout := build("Sub")
 		a, b, ob := storage(m1.Data), storage(m2.Data), out(n)
-		bg := dev.NewBindGroup(layout,
+		bg, err := dev.NewBindGroup(layout,
 			gpu.BindGroupEntry{Binding: 0, Buffer: a},
 			gpu.BindGroupEntry{Binding: 1, Buffer: b},
 			gpu.BindGroupEntry{Binding: 2, Buffer: ob})
+		if err != nil {
+			t.Fatal(err)
+		}
 		got := math.Mat[float32]{Row: 10, Col: 10, Data: dispatch(pipe, bg, n, n, ob)}
 		if !got.EqEps(m1.Sub(m2), gpuEps) {
 			t.Fatal("Go→shader Sub != CPU")
@@ -155,9 +161,12 @@ func TestGoShaderEndToEnd(t *testing.T) {
 	t.Run("Sqrt", func(t *testing.T) {
 		pipe, layout := build("Sqrt")
 		a, ob := storage(m1.Data), out(n)
-		bg := dev.NewBindGroup(layout,
+		bg, err := dev.NewBindGroup(layout,
 			gpu.BindGroupEntry{Binding: 0, Buffer: a},
 			gpu.BindGroupEntry{Binding: 1, Buffer: ob})
+		if err != nil {
+			t.Fatal(err)
+		}
 		got := math.Mat[float32]{Row: 10, Col: 10, Data: dispatch(pipe, bg, n, n, ob)}
 		if !got.EqEps(m1.Sqrt(), gpuEps) {
 			t.Fatal("Go→shader Sqrt != CPU")
@@ -174,11 +183,14 @@ func TestGoShaderEndToEnd(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		bg := dev.NewBindGroup(layout,
+		bg, err := dev.NewBindGroup(layout,
 			gpu.BindGroupEntry{Binding: 0, Buffer: a},
 			gpu.BindGroupEntry{Binding: 1, Buffer: b},
 			gpu.BindGroupEntry{Binding: 2, Buffer: ob},
 			gpu.BindGroupEntry{Binding: 3, Buffer: pbuf})
+		if err != nil {
+			t.Fatal(err)
+		}
 		got := math.Mat[float32]{Row: 10, Col: 10, Data: dispatch(pipe, bg, m2.Col*m1.Row, n, ob)}
 		if !got.EqEps(m1.Mul(m2), gpuEps) {
 			t.Fatal("Go→shader Mul != CPU")
@@ -69,7 +69,10 @@ func TestGoShaderTextureSampling(t *testing.T) {
 	samp := dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterNearest, MagFilter: gpu.FilterNearest})
 
 	out, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: 4 * 4 * 4, Usage: gpu.BufferStorage | gpu.BufferMapRead})
-	bg := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	bg, err := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	cp := enc.BeginComputePass()
@@ -87,7 +87,10 @@ func TestGoShaderSpecular(t *testing.T) {
 	parBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: len(params) * 4, Usage: gpu.BufferUniform, Data: sb(params)})
 
 	layout := dev.NewBindGroupLayout(gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageFragment, Kind: gpu.UniformBuffer})
-	bg := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: parBuf})
+	bg, err := dev.NewBindGroup(layout, gpu.BindGroupEntry{Binding: 0, Buffer: parBuf})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	enc := dev.NewCommandEncoder()
 	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: target, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1}})
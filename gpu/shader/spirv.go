@@ -0,0 +1,2012 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CompileSPIRV is like Compile but emits a SPIR-V 1.0 binary (Kernel.SPIRV)
+// for the Vulkan backend, straight from the Go AST with no external tools.
+// It supports compute kernels with storage buffers and struct-by-value
+// uniforms, and vertex/fragment kernels in the forms Compile accepts:
+// textures and samplers are not supported yet. Helper functions become
+// SPIR-V functions the entry point calls.
+//
+// Resources are laid out as on Metal: every buffer parameter takes the next
+// binding in descriptor set 0, storage buffers as std430 blocks and uniform
+// structs as std140 blocks. Every module's entry point is named "main",
+// whatever the kernel is called, as glslang names it. A compute kernel runs
+// one invocation per workgroup, like the GLSL kernels, so Dispatch(n, 1, 1)
+// runs it n times, unless it declares a //gpu:workgroup size.
+func CompileSPIRV(src string) (map[string]*Kernel, error) {
+	return compileAll(src, targetSPIRV)
+}
+
+// spvVarKind is what a name in a SPIR-V kernel's scope refers to.
+type spvVarKind int
+
+const (
+	spvLocal   spvVarKind = iota // a Function-storage variable (id is its pointer)
+	spvValue                     // an immutable value, like the thread id
+	spvBuffer                    // a storage buffer parameter (id is the block variable)
+	spvUniform                   // a uniform struct parameter (id is the block variable)
+	spvShared                    // a Shared array (id is the Workgroup variable)
+)
+
+type spvVar struct {
+	kind spvVarKind
+	id   uint32
+	typ  string // the value type; the element type of a buffer
+}
+
+// spvVal is an expression's result: its id and canonical type.
+type spvVal struct {
+	id  uint32
+	typ string
+}
+
+// spvOutput is an Output variable a vertex or fragment kernel's return
+// value (or one field of it) is stored to.
+type spvOutput struct {
+	id    uint32
+	field int // the returned struct's field, or -1 for the whole value
+	typ   string
+}
+
+// spvCompiler translates one kernel into a SPIR-V module. Locals live in
+// Function variables, so control flow needs no phis except for && and ||.
+type spvCompiler struct {
+	m       *spvModule
+	structs map[string]*ast.StructType
+	written map[string]bool
+	scopes  []map[string]*spvVar
+
+	vars       []uint32 // OpVariables, which must open the entry block
+	body       []uint32
+	block      uint32 // the block being emitted
+	terminated bool   // the block has its terminator
+
+	outputs []spvOutput // a vertex or fragment kernel's outputs
+	ret     string      // the struct type a vertex kernel returns, if any
+	iface   []uint32    // the entry point's Input and Output variables
+
+	funcs  map[string]spvFunc // the helpers compiled into the module so far
+	helper bool               // compiling a helper rather than the entry point
+	result string             // the helper's result type, "" for none
+
+	loops []spvLoop // the enclosing loops, innermost last
+}
+
+// spvLoop is the merge block and continue target of a loop, where break and
+// continue branch.
+type spvLoop struct {
+	merge, cont uint32
+}
+
+// spvFunc is a helper function of the module.
+type spvFunc struct {
+	id  uint32
+	sig funcSig
+}
+
+func compileKernelSPIRV(fn *ast.FuncDecl, structs map[string]*ast.StructType, funcs map[string]*ast.FuncDecl, shared map[string]sharedVar) (*Kernel, error) {
+	stage := stageOf(fn.Doc)
+	c := &spvCompiler{m: newSPVModule(), structs: structs, written: writtenParams(fn.Body), funcs: map[string]spvFunc{}}
+	for name := range atomicTargets(fn.Body) {
+		c.written[name] = true
+	}
+	for name, st := range structs {
+		fields, err := spvStructFields(st)
+		if err != nil {
+			return nil, fmt.Errorf("struct %s: %w", name, err)
+		}
+		c.m.structs[name] = fields
+	}
+	c.push()
+
+	helpers, err := helpersOf(fn, funcs)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range helpers {
+		if err := c.function(h); err != nil {
+			return nil, fmt.Errorf("func %s: %w", h.Name.Name, err)
+		}
+	}
+
+	params := flattenParams(fn.Type.Params)
+	hasID := stage == StageCompute || stage == StageVertex
+	if hasID {
+		if len(params) == 0 {
+			return nil, fmt.Errorf("kernel needs a leading id parameter")
+		}
+		if t, ok := identType(params[0].typ); !ok || !isIntType(t) {
+			return nil, fmt.Errorf("first parameter %q must be the int/uint id", params[0].name)
+		}
+	}
+
+	void := c.m.mustTyp("void")
+	fnID := c.m.id()
+	spvInst(&c.m.funcs, spvOpFunction, void, fnID, 0, c.m.funcType(void))
+	c.block = c.m.id()
+	spvInst(&c.m.funcs, spvOpLabel, c.block)
+
+	bindings, err := c.params(stage, params, hasID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range sharedOf(fn, shared) {
+		if err := c.shared(sv); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.results(stage, fn.Type.Results); err != nil {
+		return nil, err
+	}
+	if err := c.stmts(fn.Body.List); err != nil {
+		return nil, err
+	}
+	if !c.terminated {
+		c.emit(spvOpReturn)
+	}
+	c.m.funcs = append(c.m.funcs, c.vars...)
+	c.m.funcs = append(c.m.funcs, c.body...)
+	spvInst(&c.m.funcs, spvOpFunctionEnd)
+
+	model := map[Stage]uint32{StageCompute: spvModelCompute, StageVertex: spvModelVertex, StageFragment: spvModelFragment}[stage]
+	spvInst(&c.m.entry, spvOpEntryPoint, append(append([]uint32{model, fnID}, spvString("main")...), c.iface...)...)
+	switch stage {
+	case StageCompute:
+		size, _, _ := workgroupSize(fn.Doc)
+		spvInst(&c.m.entry, spvOpExecutionMode, fnID, spvModeLocalSize, uint32(size[0]), uint32(size[1]), uint32(size[2]))
+	case StageFragment:
+		spvInst(&c.m.entry, spvOpExecutionMode, fnID, spvModeOriginUpperLeft)
+	}
+	spvInst(&c.m.names, spvOpName, append([]uint32{fnID}, spvString(fn.Name.Name)...)...)
+
+	return &Kernel{Name: fn.Name.Name, Stage: stage, Bindings: bindings, SPIRV: c.m.bytes()}, nil
+}
+
+// function compiles helper h into a function of the module. Its parameters
+// are copied into Function variables, as Go parameters are assignable.
+func (c *spvCompiler) function(h *ast.FuncDecl) error {
+	m := c.m
+	sig, err := helperSig(h, c.structs)
+	if err != nil {
+		return err
+	}
+	ret := m.mustTyp("void")
+	if sig.ret != "" {
+		if ret, err = m.typ(sig.ret); err != nil {
+			return err
+		}
+	}
+	var types []uint32
+	for _, t := range sig.types {
+		id, err := m.typ(t)
+		if err != nil {
+			return err
+		}
+		types = append(types, id)
+	}
+	fc := &spvCompiler{m: m, structs: c.structs, written: map[string]bool{}, funcs: c.funcs, helper: true, result: sig.ret}
+	fc.push()
+	id := m.id()
+	spvInst(&m.funcs, spvOpFunction, ret, id, 0, m.funcType(ret, types...))
+	var args []spvVal
+	for i, t := range sig.types {
+		arg := spvVal{m.id(), t}
+		spvInst(&m.funcs, spvOpFunctionParameter, types[i], arg.id)
+		args = append(args, arg)
+	}
+	fc.block = m.id()
+	spvInst(&m.funcs, spvOpLabel, fc.block)
+	for i, p := range sig.params {
+		if err := fc.declare(p.name, sig.types[i], &args[i]); err != nil {
+			return err
+		}
+	}
+	if err := fc.stmts(h.Body.List); err != nil {
+		return err
+	}
+	if !fc.terminated {
+		// Go ends a func with a result in a return, so only the merge block
+		// of an if/else that returns on both sides can get here.
+		if sig.ret == "" {
+			fc.emit(spvOpReturn)
+		} else {
+			fc.emit(spvOpUnreachable)
+		}
+	}
+	m.funcs = append(m.funcs, fc.vars...)
+	m.funcs = append(m.funcs, fc.body...)
+	spvInst(&m.funcs, spvOpFunctionEnd)
+	spvInst(&m.names, spvOpName, append([]uint32{id}, spvString(h.Name.Name)...)...)
+	c.funcs[h.Name.Name] = spvFunc{id: id, sig: sig}
+	return nil
+}
+
+// writtenParams reports which buffer parameters are stored to (an indexed
+// assignment, to an element or a field of one, or ++/--), so the others can
+// be declared read-only.
+func writtenParams(body *ast.BlockStmt) map[string]bool {
+	written := map[string]bool{}
+	mark := func(e ast.Expr) {
+		for {
+			if sel, ok := e.(*ast.SelectorExpr); ok {
+				e = sel.X
+			} else if p, ok := e.(*ast.ParenExpr); ok {
+				e = p.X
+			} else {
+				break
+			}
+		}
+		if ix, ok := e.(*ast.IndexExpr); ok {
+			if id, ok := ix.X.(*ast.Ident); ok {
+				written[id.Name] = true
+			}
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range s.Lhs {
+				mark(lhs)
+			}
+		case *ast.IncDecStmt:
+			mark(s.X)
+		}
+		return true
+	})
+	return written
+}
+
+// spvStructFields resolves the field types of a kernel struct.
+func spvStructFields(st *ast.StructType) ([]spvField, error) {
+	var fields []spvField
+	for _, f := range st.Fields.List {
+		ft, ok := identType(f.Type)
+		if !ok {
+			return nil, fmt.Errorf("unsupported field type")
+		}
+		if mt, ok := goToMSLType(ft); ok {
+			ft = mt
+		}
+		pos := false
+		if f.Tag != nil {
+			pos = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("gpu") == "position"
+		}
+		for _, n := range f.Names {
+			fields = append(fields, spvField{name: n.Name, typ: ft, position: pos})
+		}
+	}
+	return fields, nil
+}
+
+// params declares the kernel's parameters: the stage's ids as built-in
+// inputs, buffers and uniforms as descriptor bindings and a fragment's
+// varyings struct as Location inputs.
+func (c *spvCompiler) params(stage Stage, params []param, hasID bool) ([]Binding, error) {
+	m := c.m
+	if hasID {
+		gt, _ := identType(params[0].typ)
+		var v spvVal
+		if stage == StageCompute {
+			xyz := c.op(spvOpLoad, c.uint3(), c.input("uint3", spvBuiltInGlobalInvocationID))
+			v = spvVal{c.op(spvOpCompositeExtract, m.mustTyp("uint"), xyz, 0), "uint"}
+		} else {
+			v = spvVal{c.op(spvOpLoad, m.mustTyp("int"), c.input("int", spvBuiltInVertexIndex)), "int"}
+		}
+		if err := c.defineID(params[0].name, gt, v); err != nil {
+			return nil, err
+		}
+		params = params[1:]
+	}
+	// A compute kernel may take its workgroup ids next.
+	if stage == StageCompute {
+		var ids []param
+		ids, params = workgroupIDs(params)
+		for i, p := range ids {
+			var v spvVal
+			if i == 0 {
+				v = spvVal{c.op(spvOpLoad, m.mustTyp("uint"), c.input("uint", spvBuiltInLocalInvocationIndex)), "uint"}
+			} else {
+				xyz := c.op(spvOpLoad, c.uint3(), c.input("uint3", spvBuiltInWorkgroupID))
+				v = spvVal{c.op(spvOpCompositeExtract, m.mustTyp("uint"), xyz, 0), "uint"}
+			}
+			t, _ := identType(p.typ)
+			if err := c.defineID(p.name, t, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// A vertex kernel may take a second integer parameter, the instance id.
+	if stage == StageVertex && len(params) > 0 {
+		if t, ok := identType(params[0].typ); ok && isIntType(t) {
+			v := spvVal{c.op(spvOpLoad, m.mustTyp("int"), c.input("int", spvBuiltInInstanceIndex)), "int"}
+			if err := c.defineID(params[0].name, t, v); err != nil {
+				return nil, err
+			}
+			params = params[1:]
+		}
+	}
+
+	var bindings []Binding
+	stageIn := false
+	for _, p := range params {
+		switch t := p.typ.(type) {
+		case *ast.ArrayType:
+			mt, err := bufferElem(p, t, c.structs)
+			if err != nil {
+				return nil, err
+			}
+			id, err := c.storageBuffer(mt, len(bindings), !c.written[p.name])
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %w", p.name, err)
+			}
+			bindings = append(bindings, Binding{Index: len(bindings), Name: p.name, Kind: StorageBuffer})
+			c.define(p.name, &spvVar{kind: spvBuffer, id: id, typ: mt})
+		case *ast.Ident:
+			switch t.Name {
+			case "Texture2D", "Texture2DArray", "TextureCube", "Texture3D", "TextureDepth2D", "Texture2DMS", "Sampler", "SamplerComparison":
+				return nil, fmt.Errorf("parameter %q: SPIR-V backend does not support textures/samplers yet", p.name)
+			}
+			if _, ok := c.structs[t.Name]; !ok {
+				return nil, fmt.Errorf("parameter %q: unsupported type %q", p.name, t.Name)
+			}
+			if stage == StageFragment && !stageIn {
+				// The first struct parameter of a fragment kernel is the
+				// interpolated vertex output.
+				stageIn = true
+				if err := c.varyingsIn(p.name, t.Name); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			id, err := c.uniformBlock(t.Name, len(bindings))
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %w", p.name, err)
+			}
+			bindings = append(bindings, Binding{Index: len(bindings), Name: p.name, Kind: UniformBuffer})
+			c.define(p.name, &spvVar{kind: spvUniform, id: id, typ: t.Name})
+		default:
+			return nil, fmt.Errorf("parameter %q: unsupported parameter type", p.name)
+		}
+	}
+	return bindings, nil
+}
+
+// defineID binds an id parameter to the built-in id value v, converted to
+// the parameter's declared type (int or uint).
+func (c *spvCompiler) defineID(name, goType string, v spvVal) error {
+	t, _ := goToMSLType(goType)
+	v, err := c.convert(v, t)
+	if err != nil {
+		return err
+	}
+	c.define(name, &spvVar{kind: spvValue, id: v.id, typ: t})
+	return nil
+}
+
+// uint3 is the type of GlobalInvocationId, the only unsigned vector.
+func (c *spvCompiler) uint3() uint32 {
+	return c.m.cached("t:uint3", func(id uint32) {
+		spvInst(&c.m.globals, spvOpTypeVector, id, c.m.mustTyp("uint"), 3)
+	})
+}
+
+// input declares a built-in Input variable of type t.
+func (c *spvCompiler) input(t string, builtin uint32) uint32 {
+	var tid uint32
+	if t == "uint3" {
+		tid = c.uint3()
+	} else {
+		tid = c.m.mustTyp(t)
+	}
+	id := c.global(spvStorageInput, tid)
+	c.m.decorate(id, spvDecBuiltIn, builtin)
+	return id
+}
+
+// global declares a module-scope variable; Input and Output ones join the
+// entry point's interface.
+func (c *spvCompiler) global(storage, typ uint32) uint32 {
+	id := c.m.id()
+	spvInst(&c.m.globals, spvOpVariable, c.m.ptr(storage, typ), id, storage)
+	if storage == spvStorageInput || storage == spvStorageOutput {
+		c.iface = append(c.iface, id)
+	}
+	return id
+}
+
+// storageBuffer declares a std430 buffer block { T data[]; } at binding.
+func (c *spvCompiler) storageBuffer(elem string, binding int, readonly bool) (uint32, error) {
+	m := c.m
+	var stride int
+	if fields, ok := m.structs[elem]; ok {
+		_, stride, _ = structLayout(layoutFieldsOf(fields))
+	} else {
+		_, s, err := storageAlign(elem)
+		if err != nil {
+			return 0, err
+		}
+		stride = s
+	}
+	et := c.bufferType(elem)
+	rta := m.cached("rta:"+elem, func(id uint32) {
+		spvInst(&m.globals, spvOpTypeRuntimeArray, id, et)
+		m.decorate(id, spvDecArrayStride, uint32(stride))
+	})
+	// Each buffer gets its own block type, so read-only is per parameter.
+	block := m.id()
+	spvInst(&m.globals, spvOpTypeStruct, block, rta)
+	m.decorate(block, spvDecBufferBlock)
+	m.memberDecorate(block, 0, spvDecOffset, 0)
+	if elem == "float4x4" {
+		m.memberDecorate(block, 0, spvDecColMajor)
+		m.memberDecorate(block, 0, spvDecMatrixStride, 16)
+	}
+	if readonly {
+		m.memberDecorate(block, 0, spvDecNonWritable)
+	}
+	id := c.global(spvStorageUniform, block)
+	m.decorate(id, spvDecDescriptorSet, 0)
+	m.decorate(id, spvDecBinding, uint32(binding))
+	return id, nil
+}
+
+// bufferType is the type of a storage-buffer element: the canonical type of
+// a scalar, vector or matrix, and for a struct a copy of it decorated with
+// its storage layout (see layout.go). Values of the struct keep the
+// canonical type, so loadStruct and storeStruct copy elements member by
+// member.
+func (c *spvCompiler) bufferType(t string) uint32 {
+	m := c.m
+	fields, ok := m.structs[t]
+	if !ok {
+		return m.mustTyp(t)
+	}
+	return m.cached("sbo:"+t, func(id uint32) {
+		lf := layoutFieldsOf(fields)
+		structLayout(lf)
+		members := []uint32{id}
+		for i, f := range lf {
+			members = append(members, m.mustTyp(f.typ))
+			m.memberDecorate(id, uint32(i), spvDecOffset, uint32(f.offset))
+			if f.typ == "float4x4" {
+				m.memberDecorate(id, uint32(i), spvDecColMajor)
+				m.memberDecorate(id, uint32(i), spvDecMatrixStride, 16)
+			}
+		}
+		spvInst(&m.globals, spvOpTypeStruct, members...)
+	})
+}
+
+func layoutFieldsOf(fields []spvField) []layoutField {
+	lf := make([]layoutField, len(fields))
+	for i, f := range fields {
+		lf[i] = layoutField{name: f.name, typ: f.typ}
+	}
+	return lf
+}
+
+// loadStruct loads the struct buffer element ptr points to as a value.
+func (c *spvCompiler) loadStruct(ptr uint32, t string) spvVal {
+	var parts []uint32
+	for i, f := range c.m.structs[t] {
+		ft := c.m.mustTyp(f.typ)
+		fp := c.op(spvOpAccessChain, c.m.ptr(spvStorageUniform, ft), ptr, c.m.intConst(int32(i)))
+		parts = append(parts, c.op(spvOpLoad, ft, fp))
+	}
+	return spvVal{c.op(spvOpCompositeConstruct, c.m.mustTyp(t), parts...), t}
+}
+
+// storeStruct stores the struct value v to the buffer element ptr points to.
+func (c *spvCompiler) storeStruct(ptr uint32, t string, v uint32) {
+	for i, f := range c.m.structs[t] {
+		ft := c.m.mustTyp(f.typ)
+		part := c.op(spvOpCompositeExtract, ft, v, uint32(i))
+		fp := c.op(spvOpAccessChain, c.m.ptr(spvStorageUniform, ft), ptr, c.m.intConst(int32(i)))
+		c.emit(spvOpStore, fp, part)
+	}
+}
+
+// uniformBlock declares struct name as a std140 uniform block at binding.
+func (c *spvCompiler) uniformBlock(name string, binding int) (uint32, error) {
+	m := c.m
+	fields := m.structs[name]
+	block := m.id()
+	var members []uint32
+	offset := 0
+	for i, f := range fields {
+		align, size, err := std140(f.typ)
+		if err != nil {
+			return 0, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		offset = (offset + align - 1) / align * align
+		m.memberDecorate(block, uint32(i), spvDecOffset, uint32(offset))
+		if f.typ == "float4x4" {
+			m.memberDecorate(block, uint32(i), spvDecColMajor)
+			m.memberDecorate(block, uint32(i), spvDecMatrixStride, 16)
+		}
+		offset += size
+		members = append(members, m.mustTyp(f.typ))
+	}
+	spvInst(&m.globals, spvOpTypeStruct, append([]uint32{block}, members...)...)
+	m.decorate(block, spvDecBlock)
+	m.ids["ubo:"+name] = block
+	id := c.global(spvStorageUniform, block)
+	m.decorate(id, spvDecDescriptorSet, 0)
+	m.decorate(id, spvDecBinding, uint32(binding))
+	return id, nil
+}
+
+// varyingsIn declares a fragment kernel's varyings struct param as Input
+// variables, one per field (FragCoord for the position field, Locations
+// numbered like the vertex outputs for the rest), and gathers them into a
+// local of the struct type.
+func (c *spvCompiler) varyingsIn(name, typ string) error {
+	m := c.m
+	st, err := m.typ(typ)
+	if err != nil {
+		return err
+	}
+	var parts []uint32
+	loc := uint32(0)
+	for _, f := range m.structs[typ] {
+		ft, err := m.typ(f.typ)
+		if err != nil {
+			return err
+		}
+		in := c.global(spvStorageInput, ft)
+		if f.position {
+			m.decorate(in, spvDecBuiltIn, spvBuiltInFragCoord)
+		} else {
+			m.decorate(in, spvDecLocation, loc)
+			if isIntType(f.typ) {
+				m.decorate(in, spvDecFlat)
+			}
+			loc++
+		}
+		parts = append(parts, c.op(spvOpLoad, ft, in))
+	}
+	v := c.op(spvOpCompositeConstruct, st, parts...)
+	ptr := c.local(typ)
+	c.emit(spvOpStore, ptr, v)
+	c.define(name, &spvVar{kind: spvLocal, id: ptr, typ: typ})
+	return nil
+}
+
+// results declares the Output variables a vertex or fragment kernel's
+// return value is stored to: the position field (or a returned float4) as
+// the vertex Position, the other fields as Locations; a fragment kernel's
+// float4 as the color at Location 0.
+func (c *spvCompiler) results(stage Stage, results *ast.FieldList) error {
+	if stage == StageCompute {
+		return nil
+	}
+	kw := map[Stage]string{StageVertex: "vertex", StageFragment: "fragment"}[stage]
+	if results == nil || len(results.List) != 1 {
+		return fmt.Errorf("%s kernel must return exactly one value", kw)
+	}
+	rt, _ := identType(results.List[0].Type)
+	if mt, ok := goToMSLType(rt); ok {
+		if mt != "float4" {
+			return fmt.Errorf("unsupported return type %q", rt)
+		}
+		out := c.global(spvStorageOutput, c.m.mustTyp("float4"))
+		if stage == StageVertex {
+			c.m.decorate(out, spvDecBuiltIn, spvBuiltInPosition)
+		} else {
+			c.m.decorate(out, spvDecLocation, 0)
+		}
+		c.outputs = []spvOutput{{id: out, field: -1, typ: "float4"}}
+		return nil
+	}
+	// A vertex kernel's varyings, or a fragment kernel's colors.
+	fields, ok := c.m.structs[rt]
+	if !ok {
+		return fmt.Errorf("unsupported return type %q", rt)
+	}
+	c.ret = rt
+	loc := uint32(0)
+	for i, f := range fields {
+		ft, err := c.m.typ(f.typ)
+		if err != nil {
+			return err
+		}
+		out := c.global(spvStorageOutput, ft)
+		if f.position {
+			c.m.decorate(out, spvDecBuiltIn, spvBuiltInPosition)
+		} else {
+			c.m.decorate(out, spvDecLocation, loc)
+			if isIntType(f.typ) {
+				c.m.decorate(out, spvDecFlat)
+			}
+			loc++
+		}
+		c.outputs = append(c.outputs, spvOutput{id: out, field: i, typ: f.typ})
+	}
+	return nil
+}
+
+// --- emission helpers ---
+
+// emit appends an instruction without a result to the current block.
+func (c *spvCompiler) emit(op uint32, operands ...uint32) {
+	spvInst(&c.body, op, operands...)
+}
+
+// op appends an instruction with a result of type typ and returns its id.
+func (c *spvCompiler) op(op, typ uint32, operands ...uint32) uint32 {
+	id := c.m.id()
+	spvInst(&c.body, op, append([]uint32{typ, id}, operands...)...)
+	return id
+}
+
+func (c *spvCompiler) ext(inst uint32, typ string, args ...uint32) spvVal {
+	return spvVal{c.op(spvOpExtInst, c.m.mustTyp(typ), append([]uint32{c.m.glslExt, inst}, args...)...), typ}
+}
+
+// label starts block id.
+func (c *spvCompiler) label(id uint32) {
+	c.emit(spvOpLabel, id)
+	c.block, c.terminated = id, false
+}
+
+// branch ends the current block with a jump to target, unless it already
+// ended (with a return).
+func (c *spvCompiler) branch(target uint32) {
+	if !c.terminated {
+		c.emit(spvOpBranch, target)
+	}
+	c.terminated = true
+}
+
+// local allocates a Function variable of type t.
+func (c *spvCompiler) local(t string) uint32 {
+	id := c.m.id()
+	spvInst(&c.vars, spvOpVariable, c.m.ptr(spvStorageFunction, c.m.mustTyp(t)), id, spvStorageFunction)
+	return id
+}
+
+func (c *spvCompiler) push() { c.scopes = append(c.scopes, map[string]*spvVar{}) }
+func (c *spvCompiler) pop()  { c.scopes = c.scopes[:len(c.scopes)-1] }
+
+func (c *spvCompiler) define(name string, v *spvVar) { c.scopes[len(c.scopes)-1][name] = v }
+
+func (c *spvCompiler) lookup(name string) (*spvVar, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if v, ok := c.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// --- statements ---
+
+func (c *spvCompiler) stmts(list []ast.Stmt) error {
+	for _, s := range list {
+		if c.terminated {
+			return nil // the rest of the block is unreachable
+		}
+		if err := c.stmt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *spvCompiler) scoped(list []ast.Stmt) error {
+	c.push()
+	defer c.pop()
+	return c.stmts(list)
+}
+
+func (c *spvCompiler) stmt(s ast.Stmt) error {
+	switch st := s.(type) {
+	case *ast.AssignStmt:
+		return c.assign(st)
+	case *ast.DeclStmt:
+		return c.declStmt(st)
+	case *ast.ForStmt:
+		return c.forStmt(st)
+	case *ast.IfStmt:
+		return c.ifStmt(st)
+	case *ast.IncDecStmt:
+		ptr, t, err := c.pointer(st.X, true)
+		if err != nil {
+			return err
+		}
+		op := token.ADD
+		if st.Tok == token.DEC {
+			op = token.SUB
+		}
+		one, err := c.literal("1", token.INT, t)
+		if err != nil {
+			return err
+		}
+		v, err := c.arith(op, spvVal{c.op(spvOpLoad, c.m.mustTyp(t), ptr), t}, one)
+		if err != nil {
+			return err
+		}
+		c.emit(spvOpStore, ptr, v.id)
+		return nil
+	case *ast.BlockStmt:
+		return c.scoped(st.List)
+	case *ast.ReturnStmt:
+		return c.returnStmt(st)
+	case *ast.BranchStmt:
+		// Lowering leaves only unlabeled breaks and continues, each leaving
+		// the innermost loop.
+		loop := c.loops[len(c.loops)-1]
+		if st.Tok == token.BREAK {
+			c.branch(loop.merge)
+		} else {
+			c.branch(loop.cont)
+		}
+		return nil
+	case *ast.ExprStmt:
+		call, ok := st.X.(*ast.CallExpr)
+		if !ok {
+			return fmt.Errorf("unsupported expression statement")
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			if f, ok := c.funcs[id.Name]; ok {
+				_, err := c.callFunc(id.Name, f, call.Args)
+				return err
+			}
+		}
+		_, err := c.call(call, "")
+		return err
+	default:
+		return fmt.Errorf("unsupported statement %T", s)
+	}
+}
+
+func (c *spvCompiler) returnStmt(st *ast.ReturnStmt) error {
+	if c.helper {
+		if len(st.Results) == 0 {
+			c.emit(spvOpReturn)
+		} else {
+			v, err := c.expr(st.Results[0], hintOf(c.result))
+			if err != nil {
+				return err
+			}
+			if v, err = c.convert(v, c.result); err != nil {
+				return err
+			}
+			c.emit(spvOpReturnValue, v.id)
+		}
+		c.terminated = true
+		return nil
+	}
+	if len(st.Results) > 0 {
+		if len(c.outputs) == 0 {
+			return fmt.Errorf("compute kernels cannot return a value")
+		}
+		v, err := c.expr(st.Results[0], "")
+		if err != nil {
+			return err
+		}
+		for _, o := range c.outputs {
+			part := v
+			if o.field >= 0 {
+				if v.typ != c.ret {
+					return fmt.Errorf("cannot return %s", v.typ)
+				}
+				part = spvVal{c.op(spvOpCompositeExtract, c.m.mustTyp(o.typ), v.id, uint32(o.field)), o.typ}
+			}
+			if part, err = c.convert(part, o.typ); err != nil {
+				return err
+			}
+			c.emit(spvOpStore, o.id, part.id)
+		}
+	}
+	c.emit(spvOpReturn)
+	c.terminated = true
+	return nil
+}
+
+func (c *spvCompiler) assign(st *ast.AssignStmt) error {
+	if len(st.Lhs) != 1 || len(st.Rhs) != 1 {
+		return fmt.Errorf("only single assignments are supported")
+	}
+	if st.Tok == token.DEFINE {
+		id, ok := st.Lhs[0].(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("only identifiers may be declared with :=")
+		}
+		v, err := c.expr(st.Rhs[0], "")
+		if err != nil {
+			return err
+		}
+		return c.declare(id.Name, v.typ, &v)
+	}
+	ptr, t, err := c.pointer(st.Lhs[0], true)
+	if err != nil {
+		return err
+	}
+	v, err := c.expr(st.Rhs[0], scalarOf(t))
+	if err != nil {
+		return err
+	}
+	if st.Tok != token.ASSIGN {
+		op, ok := spvAssignOps[st.Tok]
+		if !ok {
+			return fmt.Errorf("unsupported assignment %s", st.Tok)
+		}
+		cur := spvVal{c.op(spvOpLoad, c.m.mustTyp(t), ptr), t}
+		if v, err = c.arith(op, cur, v); err != nil {
+			return err
+		}
+	}
+	if v, err = c.convert(v, t); err != nil {
+		return err
+	}
+	if _, ok := c.m.structs[t]; ok && c.storageOf(st.Lhs[0]) == spvStorageUniform {
+		c.storeStruct(ptr, t, v.id)
+		return nil
+	}
+	c.emit(spvOpStore, ptr, v.id)
+	return nil
+}
+
+var spvAssignOps = map[token.Token]token.Token{
+	token.ADD_ASSIGN: token.ADD, token.SUB_ASSIGN: token.SUB, token.MUL_ASSIGN: token.MUL,
+	token.QUO_ASSIGN: token.QUO, token.REM_ASSIGN: token.REM,
+	token.AND_ASSIGN: token.AND, token.OR_ASSIGN: token.OR, token.XOR_ASSIGN: token.XOR,
+	token.SHL_ASSIGN: token.SHL, token.SHR_ASSIGN: token.SHR,
+}
+
+// declare defines a new local of type t, initialized to v (converted to t)
+// or to the zero value.
+func (c *spvCompiler) declare(name, t string, v *spvVal) error {
+	if _, err := c.m.typ(t); err != nil {
+		return err
+	}
+	ptr := c.local(t)
+	if v != nil {
+		cv, err := c.convert(*v, t)
+		if err != nil {
+			return err
+		}
+		c.emit(spvOpStore, ptr, cv.id)
+	} else {
+		z, err := c.m.null(t)
+		if err != nil {
+			return err
+		}
+		c.emit(spvOpStore, ptr, z)
+	}
+	c.define(name, &spvVar{kind: spvLocal, id: ptr, typ: t})
+	return nil
+}
+
+func (c *spvCompiler) declStmt(st *ast.DeclStmt) error {
+	gd, ok := st.Decl.(*ast.GenDecl)
+	if !ok || gd.Tok != token.VAR {
+		return fmt.Errorf("unsupported declaration")
+	}
+	for _, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		t := ""
+		if vs.Type != nil {
+			gt, ok := identType(vs.Type)
+			if !ok {
+				return fmt.Errorf("unsupported variable type")
+			}
+			t = gt
+			if mt, ok := goToMSLType(gt); ok {
+				t = mt
+			}
+		}
+		for i, name := range vs.Names {
+			if i >= len(vs.Values) {
+				if t == "" {
+					t = "float"
+				}
+				if err := c.declare(name.Name, t, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			v, err := c.expr(vs.Values[i], scalarOf(t))
+			if err != nil {
+				return err
+			}
+			vt := t
+			if vt == "" {
+				vt = v.typ
+			}
+			if err := c.declare(name.Name, vt, &v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forStmt emits a structured loop:
+//
+//	header:   OpLoopMerge merge cont; OpBranch check
+//	check:    cond; OpBranchConditional cond body merge
+//	body:     ...; OpBranch cont
+//	cont:     post; OpBranch header
+//	merge:
+func (c *spvCompiler) forStmt(st *ast.ForStmt) error {
+	c.push()
+	defer c.pop()
+	if st.Init != nil {
+		if err := c.stmt(st.Init); err != nil {
+			return err
+		}
+	}
+	header, check, body, cont, merge := c.m.id(), c.m.id(), c.m.id(), c.m.id(), c.m.id()
+	c.branch(header)
+	c.label(header)
+	c.emit(spvOpLoopMerge, merge, cont, 0)
+	c.branch(check)
+	c.label(check)
+	if st.Cond != nil {
+		cond, err := c.expr(st.Cond, "")
+		if err != nil {
+			return err
+		}
+		if cond.typ != "bool" {
+			return fmt.Errorf("loop condition is %s, not bool", cond.typ)
+		}
+		c.emit(spvOpBranchConditional, cond.id, body, merge)
+		c.terminated = true
+	} else {
+		c.branch(body)
+	}
+	c.label(body)
+	c.loops = append(c.loops, spvLoop{merge, cont})
+	err := c.scoped(st.Body.List)
+	c.loops = c.loops[:len(c.loops)-1]
+	if err != nil {
+		return err
+	}
+	c.branch(cont)
+	c.label(cont)
+	if st.Post != nil {
+		if err := c.stmt(st.Post); err != nil {
+			return err
+		}
+	}
+	c.branch(header)
+	c.label(merge)
+	return nil
+}
+
+func (c *spvCompiler) ifStmt(st *ast.IfStmt) error {
+	if st.Init != nil {
+		return fmt.Errorf("if statements with an init statement are not supported")
+	}
+	cond, err := c.expr(st.Cond, "")
+	if err != nil {
+		return err
+	}
+	if cond.typ != "bool" {
+		return fmt.Errorf("if condition is %s, not bool", cond.typ)
+	}
+	then, merge := c.m.id(), c.m.id()
+	els := merge
+	if st.Else != nil {
+		els = c.m.id()
+	}
+	c.emit(spvOpSelectionMerge, merge, 0)
+	c.emit(spvOpBranchConditional, cond.id, then, els)
+	c.terminated = true
+	c.label(then)
+	if err := c.scoped(st.Body.List); err != nil {
+		return err
+	}
+	c.branch(merge)
+	if st.Else != nil {
+		c.label(els)
+		switch e := st.Else.(type) {
+		case *ast.BlockStmt:
+			err = c.scoped(e.List)
+		case *ast.IfStmt:
+			err = c.ifStmt(e)
+		default:
+			err = fmt.Errorf("unsupported else clause")
+		}
+		if err != nil {
+			return err
+		}
+		c.branch(merge)
+	}
+	c.label(merge)
+	return nil
+}
+
+// --- expressions ---
+
+// isUntyped reports whether e is a constant expression of literals, which
+// (as in Go) takes its type from the other operand.
+func isUntyped(e ast.Expr) bool {
+	switch ex := e.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isUntyped(ex.X)
+	case *ast.UnaryExpr:
+		return (ex.Op == token.SUB || ex.Op == token.ADD) && isUntyped(ex.X)
+	case *ast.BinaryExpr:
+		return isUntyped(ex.X) && isUntyped(ex.Y)
+	}
+	return false
+}
+
+// expr compiles e. hint is the scalar type an untyped constant in e takes
+// ("" for its default type).
+func (c *spvCompiler) expr(e ast.Expr, hint string) (spvVal, error) {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		if ex.Name == "true" || ex.Name == "false" {
+			return spvVal{c.m.boolConst(ex.Name == "true"), "bool"}, nil
+		}
+		v, ok := c.lookup(ex.Name)
+		if !ok {
+			return spvVal{}, fmt.Errorf("undefined identifier %q", ex.Name)
+		}
+		switch v.kind {
+		case spvValue:
+			return spvVal{v.id, v.typ}, nil
+		case spvLocal:
+			return spvVal{c.op(spvOpLoad, c.m.mustTyp(v.typ), v.id), v.typ}, nil
+		}
+		return spvVal{}, fmt.Errorf("%q can only be indexed or have its fields read", ex.Name)
+	case *ast.BasicLit:
+		return c.literal(ex.Value, ex.Kind, hint)
+	case *ast.ParenExpr:
+		return c.expr(ex.X, hint)
+	case *ast.UnaryExpr:
+		return c.unary(ex, hint)
+	case *ast.BinaryExpr:
+		return c.binary(ex, hint)
+	case *ast.IndexExpr:
+		ptr, t, err := c.pointer(ex, false)
+		if err != nil {
+			return spvVal{}, err
+		}
+		if _, ok := c.m.structs[t]; ok {
+			return c.loadStruct(ptr, t), nil
+		}
+		return spvVal{c.op(spvOpLoad, c.m.mustTyp(t), ptr), t}, nil
+	case *ast.SelectorExpr:
+		return c.selector(ex)
+	case *ast.CallExpr:
+		return c.call(ex, hint)
+	case *ast.CompositeLit:
+		return c.compositeLit(ex)
+	}
+	return spvVal{}, fmt.Errorf("unsupported expression %T", e)
+}
+
+// literal compiles a numeric literal as type hint when that is numeric, else
+// its default type (int for an integer literal, float otherwise).
+func (c *spvCompiler) literal(text string, kind token.Token, hint string) (spvVal, error) {
+	t := "float"
+	if kind == token.INT && (hint == "int" || hint == "uint" || hint == "" || hint == "bool") {
+		t = "int"
+		if hint == "uint" {
+			t = "uint"
+		}
+	}
+	switch kind {
+	case token.INT:
+		n, err := strconv.ParseInt(text, 0, 64)
+		if err != nil {
+			return spvVal{}, fmt.Errorf("bad literal %s: %w", text, err)
+		}
+		switch t {
+		case "float":
+			return spvVal{c.m.floatConst(float32(n)), t}, nil
+		case "uint":
+			return spvVal{c.m.constant(t, uint32(n)), t}, nil
+		}
+		return spvVal{c.m.intConst(int32(n)), t}, nil
+	case token.FLOAT:
+		f, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return spvVal{}, fmt.Errorf("bad literal %s: %w", text, err)
+		}
+		return spvVal{c.m.floatConst(float32(f)), "float"}, nil
+	}
+	return spvVal{}, fmt.Errorf("unsupported literal %s", text)
+}
+
+func (c *spvCompiler) unary(ex *ast.UnaryExpr, hint string) (spvVal, error) {
+	// Fold a negative literal into a constant.
+	if lit, ok := ex.X.(*ast.BasicLit); ok && ex.Op == token.SUB {
+		return c.literal("-"+lit.Value, lit.Kind, hint)
+	}
+	v, err := c.expr(ex.X, hint)
+	if err != nil {
+		return spvVal{}, err
+	}
+	t := c.m.mustTyp(v.typ)
+	switch ex.Op {
+	case token.ADD:
+		return v, nil
+	case token.SUB:
+		switch scalarOf(v.typ) {
+		case "float":
+			return spvVal{c.op(spvOpFNegate, t, v.id), v.typ}, nil
+		case "int", "uint":
+			return spvVal{c.op(spvOpSNegate, t, v.id), v.typ}, nil
+		}
+	case token.NOT:
+		if v.typ == "bool" {
+			return spvVal{c.op(spvOpLogicalNot, t, v.id), v.typ}, nil
+		}
+	case token.XOR:
+		if isIntType(v.typ) {
+			return spvVal{c.op(spvOpNot, t, v.id), v.typ}, nil
+		}
+	}
+	return spvVal{}, fmt.Errorf("unsupported unary %s on %s", ex.Op, v.typ)
+}
+
+// operands compiles both sides of a binary operation, giving an untyped
+// constant side the other side's scalar type.
+func (c *spvCompiler) operands(x, y ast.Expr, hint string) (l, r spvVal, err error) {
+	switch {
+	case isUntyped(x) && !isUntyped(y):
+		if r, err = c.expr(y, hint); err != nil {
+			return
+		}
+		l, err = c.expr(x, scalarOf(r.typ))
+	case isUntyped(y) && !isUntyped(x):
+		if l, err = c.expr(x, hint); err != nil {
+			return
+		}
+		r, err = c.expr(y, scalarOf(l.typ))
+	default:
+		if l, err = c.expr(x, hint); err != nil {
+			return
+		}
+		r, err = c.expr(y, hint)
+	}
+	return
+}
+
+func (c *spvCompiler) binary(ex *ast.BinaryExpr, hint string) (spvVal, error) {
+	switch ex.Op {
+	case token.LAND, token.LOR:
+		return c.logical(ex)
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		l, r, err := c.operands(ex.X, ex.Y, "")
+		if err != nil {
+			return spvVal{}, err
+		}
+		return c.compare(ex.Op, l, r)
+	}
+	l, r, err := c.operands(ex.X, ex.Y, hint)
+	if err != nil {
+		return spvVal{}, err
+	}
+	return c.arith(ex.Op, l, r)
+}
+
+// logical emits a short-circuit && or ||: the right operand is evaluated in
+// its own block only when the left one does not decide the result.
+func (c *spvCompiler) logical(ex *ast.BinaryExpr) (spvVal, error) {
+	l, err := c.expr(ex.X, "")
+	if err != nil {
+		return spvVal{}, err
+	}
+	if l.typ != "bool" {
+		return spvVal{}, fmt.Errorf("operand of %s is %s, not bool", ex.Op, l.typ)
+	}
+	from := c.block
+	rhs, merge := c.m.id(), c.m.id()
+	c.emit(spvOpSelectionMerge, merge, 0)
+	if ex.Op == token.LAND {
+		c.emit(spvOpBranchConditional, l.id, rhs, merge)
+	} else {
+		c.emit(spvOpBranchConditional, l.id, merge, rhs)
+	}
+	c.terminated = true
+	c.label(rhs)
+	r, err := c.expr(ex.Y, "")
+	if err != nil {
+		return spvVal{}, err
+	}
+	if r.typ != "bool" {
+		return spvVal{}, fmt.Errorf("operand of %s is %s, not bool", ex.Op, r.typ)
+	}
+	rEnd := c.block
+	c.branch(merge)
+	c.label(merge)
+	return spvVal{c.op(spvOpPhi, c.m.mustTyp("bool"), l.id, from, r.id, rEnd), "bool"}, nil
+}
+
+// promote converts two scalars to their common type: float if either is,
+// else uint if either is, else int (C's usual conversions, which the MSL and
+// GLSL targets inherit).
+func (c *spvCompiler) promote(l, r spvVal) (spvVal, spvVal, error) {
+	if l.typ == r.typ {
+		return l, r, nil
+	}
+	t := "int"
+	switch {
+	case l.typ == "float" || r.typ == "float":
+		t = "float"
+	case l.typ == "uint" || r.typ == "uint":
+		t = "uint"
+	}
+	var err error
+	if l, err = c.convert(l, t); err != nil {
+		return l, r, err
+	}
+	r, err = c.convert(r, t)
+	return l, r, err
+}
+
+var spvCompareOps = map[token.Token][3]uint32{ // float, int, uint
+	token.EQL: {spvOpFOrdEqual, spvOpIEqual, spvOpIEqual},
+	token.NEQ: {spvOpFUnordNotEqual, spvOpINotEqual, spvOpINotEqual},
+	token.LSS: {spvOpFOrdLessThan, spvOpSLessThan, spvOpULessThan},
+	token.LEQ: {spvOpFOrdLessThanEqual, spvOpSLessThanEqual, spvOpULessThanEqual},
+	token.GTR: {spvOpFOrdGreaterThan, spvOpSGreaterThan, spvOpUGreaterThan},
+	token.GEQ: {spvOpFOrdGreaterThanEqual, spvOpSGreaterThanEqual, spvOpUGreaterThanEqual},
+}
+
+func (c *spvCompiler) compare(op token.Token, l, r spvVal) (spvVal, error) {
+	b := c.m.mustTyp("bool")
+	if l.typ == "bool" && r.typ == "bool" {
+		switch op {
+		case token.EQL:
+			return spvVal{c.op(spvOpLogicalEqual, b, l.id, r.id), "bool"}, nil
+		case token.NEQ:
+			return spvVal{c.op(spvOpLogicalNotEqual, b, l.id, r.id), "bool"}, nil
+		}
+	}
+	if !isScalar(l.typ) || !isScalar(r.typ) {
+		return spvVal{}, fmt.Errorf("cannot compare %s %s %s", l.typ, op, r.typ)
+	}
+	l, r, err := c.promote(l, r)
+	if err != nil {
+		return spvVal{}, err
+	}
+	ops := spvCompareOps[op]
+	code := ops[0]
+	switch l.typ {
+	case "int":
+		code = ops[1]
+	case "uint":
+		code = ops[2]
+	}
+	return spvVal{c.op(code, b, l.id, r.id), "bool"}, nil
+}
+
+func isScalar(t string) bool { return t == "float" || isIntType(t) }
+
+// arith emits l op r for scalars, float vectors (with a scalar operand
+// broadcast) and the float4x4 products.
+func (c *spvCompiler) arith(op token.Token, l, r spvVal) (spvVal, error) {
+	if l.typ == "float4x4" || r.typ == "float4x4" {
+		return c.matrixArith(op, l, r)
+	}
+	lv, rv := isVecType(l.typ), isVecType(r.typ)
+	if lv || rv {
+		var err error
+		if lv && rv && l.typ != r.typ {
+			return spvVal{}, fmt.Errorf("mismatched vector operands %s %s %s", l.typ, op, r.typ)
+		}
+		if op == token.MUL && lv != rv {
+			v, s := l, r
+			if rv {
+				v, s = r, l
+			}
+			if s, err = c.convert(s, "float"); err != nil {
+				return spvVal{}, err
+			}
+			return spvVal{c.op(spvOpVectorTimesScalar, c.m.mustTyp(v.typ), v.id, s.id), v.typ}, nil
+		}
+		t := l.typ
+		if !lv {
+			t = r.typ
+		}
+		if l, err = c.convert(l, t); err != nil {
+			return spvVal{}, err
+		}
+		if r, err = c.convert(r, t); err != nil {
+			return spvVal{}, err
+		}
+	} else {
+		if !isScalar(l.typ) || !isScalar(r.typ) {
+			return spvVal{}, fmt.Errorf("unsupported operands %s %s %s", l.typ, op, r.typ)
+		}
+		var err error
+		if op == token.SHL || op == token.SHR {
+			// A shift keeps its left operand's type.
+			if !isIntType(l.typ) || !isIntType(r.typ) {
+				return spvVal{}, fmt.Errorf("shift of %s by %s", l.typ, r.typ)
+			}
+		} else if l, r, err = c.promote(l, r); err != nil {
+			return spvVal{}, err
+		}
+	}
+
+	float := scalarOf(l.typ) == "float"
+	signed := l.typ == "int"
+	var code uint32
+	switch op {
+	case token.ADD:
+		code = pick(float, spvOpFAdd, spvOpIAdd)
+	case token.SUB:
+		code = pick(float, spvOpFSub, spvOpISub)
+	case token.MUL:
+		code = pick(float, spvOpFMul, spvOpIMul)
+	case token.QUO:
+		code = pick(float, spvOpFDiv, pick(signed, spvOpSDiv, spvOpUDiv))
+	case token.REM:
+		code = pick(float, spvOpFRem, pick(signed, spvOpSRem, spvOpUMod))
+	case token.AND, token.OR, token.XOR, token.SHL, token.SHR:
+		if float {
+			return spvVal{}, fmt.Errorf("operator %s on %s", op, l.typ)
+		}
+		code = map[token.Token]uint32{
+			token.AND: spvOpBitwiseAnd, token.OR: spvOpBitwiseOr, token.XOR: spvOpBitwiseXor,
+			token.SHL: spvOpShiftLeftLogical, token.SHR: pick(signed, spvOpShiftRightArith, spvOpShiftRightLogical),
+		}[op]
+	default:
+		return spvVal{}, fmt.Errorf("unsupported operator %s", op)
+	}
+	return spvVal{c.op(code, c.m.mustTyp(l.typ), l.id, r.id), l.typ}, nil
+}
+
+func pick(cond bool, a, b uint32) uint32 {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// matrixArith emits the float4x4 products: matrix * vector, vector * matrix,
+// matrix * matrix and matrix * scalar.
+func (c *spvCompiler) matrixArith(op token.Token, l, r spvVal) (spvVal, error) {
+	if op != token.MUL {
+		return spvVal{}, fmt.Errorf("unsupported matrix operator %s", op)
+	}
+	switch {
+	case l.typ == "float4x4" && r.typ == "float4":
+		return spvVal{c.op(spvOpMatrixTimesVector, c.m.mustTyp("float4"), l.id, r.id), "float4"}, nil
+	case l.typ == "float4" && r.typ == "float4x4":
+		return spvVal{c.op(spvOpVectorTimesMatrix, c.m.mustTyp("float4"), l.id, r.id), "float4"}, nil
+	case l.typ == "float4x4" && r.typ == "float4x4":
+		return spvVal{c.op(spvOpMatrixTimesMatrix, c.m.mustTyp("float4x4"), l.id, r.id), "float4x4"}, nil
+	case isScalar(l.typ) || isScalar(r.typ):
+		mat, s := l, r
+		if l.typ != "float4x4" {
+			mat, s = r, l
+		}
+		s, err := c.convert(s, "float")
+		if err != nil {
+			return spvVal{}, err
+		}
+		return spvVal{c.op(spvOpMatrixTimesScalar, c.m.mustTyp("float4x4"), mat.id, s.id), "float4x4"}, nil
+	}
+	return spvVal{}, fmt.Errorf("unsupported operands %s * %s", l.typ, r.typ)
+}
+
+// convert converts v to type t: between scalars as a C cast would, and a
+// scalar to a float vector by broadcasting it.
+func (c *spvCompiler) convert(v spvVal, t string) (spvVal, error) {
+	if v.typ == t {
+		return v, nil
+	}
+	if isVecType(t) && isScalar(v.typ) {
+		s, err := c.convert(v, "float")
+		if err != nil {
+			return spvVal{}, err
+		}
+		parts := make([]uint32, vecLen(t))
+		for i := range parts {
+			parts[i] = s.id
+		}
+		return spvVal{c.op(spvOpCompositeConstruct, c.m.mustTyp(t), parts...), t}, nil
+	}
+	if !isScalar(v.typ) || !isScalar(t) {
+		return spvVal{}, fmt.Errorf("cannot convert %s to %s", v.typ, t)
+	}
+	var code uint32
+	switch {
+	case v.typ == "float" && t == "int":
+		code = spvOpConvertFToS
+	case v.typ == "float" && t == "uint":
+		code = spvOpConvertFToU
+	case v.typ == "int" && t == "float":
+		code = spvOpConvertSToF
+	case v.typ == "uint" && t == "float":
+		code = spvOpConvertUToF
+	default: // int <-> uint
+		code = spvOpBitcast
+	}
+	return spvVal{c.op(code, c.m.mustTyp(t), v.id), t}, nil
+}
+
+// pointer returns a pointer to the storage an addressable expression names,
+// and its type: a local, a buffer element, a uniform field, a field of an
+// addressable struct or one component of an addressable vector.
+func (c *spvCompiler) pointer(e ast.Expr, write bool) (uint32, string, error) {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		v, ok := c.lookup(ex.Name)
+		if !ok {
+			return 0, "", fmt.Errorf("undefined identifier %q", ex.Name)
+		}
+		if v.kind != spvLocal {
+			return 0, "", fmt.Errorf("cannot assign to %q", ex.Name)
+		}
+		return v.id, v.typ, nil
+	case *ast.ParenExpr:
+		return c.pointer(ex.X, write)
+	case *ast.IndexExpr:
+		id, ok := ex.X.(*ast.Ident)
+		if !ok {
+			return 0, "", fmt.Errorf("only buffer parameters can be indexed")
+		}
+		v, ok := c.lookup(id.Name)
+		if !ok {
+			return 0, "", fmt.Errorf("undefined identifier %q", id.Name)
+		}
+		if v.kind != spvBuffer && v.kind != spvShared {
+			return 0, "", fmt.Errorf("only buffer parameters can be indexed, not %q", id.Name)
+		}
+		idx, err := c.expr(ex.Index, "int")
+		if err != nil {
+			return 0, "", err
+		}
+		if !isIntType(idx.typ) {
+			return 0, "", fmt.Errorf("index of %q is %s, not an integer", id.Name, idx.typ)
+		}
+		if v.kind == spvShared {
+			return c.op(spvOpAccessChain, c.m.ptr(spvStorageWorkgroup, c.m.mustTyp(v.typ)), v.id, idx.id), v.typ, nil
+		}
+		ptr := c.op(spvOpAccessChain, c.m.ptr(spvStorageUniform, c.bufferType(v.typ)), v.id, c.m.intConst(0), idx.id)
+		return ptr, v.typ, nil
+	case *ast.SelectorExpr:
+		if base, ok := ex.X.(*ast.Ident); ok {
+			if v, ok := c.lookup(base.Name); ok && v.kind == spvUniform {
+				if write {
+					return 0, "", fmt.Errorf("cannot assign to uniform %q", base.Name)
+				}
+				i, f, err := c.field(v.typ, ex.Sel.Name)
+				if err != nil {
+					return 0, "", err
+				}
+				return c.op(spvOpAccessChain, c.m.ptr(spvStorageUniform, c.m.mustTyp(f.typ)), v.id, c.m.intConst(int32(i))), f.typ, nil
+			}
+		}
+		ptr, t, err := c.pointer(ex.X, write)
+		if err != nil {
+			return 0, "", err
+		}
+		storage := c.storageOf(ex.X)
+		if isVecType(t) {
+			sw := strings.ToLower(ex.Sel.Name)
+			i := strings.IndexByte("xyzw", sw[0])
+			if len(sw) != 1 || i < 0 || i >= vecLen(t) {
+				return 0, "", fmt.Errorf("cannot address component %s of %s", ex.Sel.Name, t)
+			}
+			return c.op(spvOpAccessChain, c.m.ptr(storage, c.m.mustTyp("float")), ptr, c.m.intConst(int32(i))), "float", nil
+		}
+		i, f, err := c.field(t, ex.Sel.Name)
+		if err != nil {
+			return 0, "", err
+		}
+		return c.op(spvOpAccessChain, c.m.ptr(storage, c.m.mustTyp(f.typ)), ptr, c.m.intConst(int32(i))), f.typ, nil
+	}
+	return 0, "", fmt.Errorf("cannot address %T", e)
+}
+
+// storageOf is the storage class of the variable an addressable expression
+// is part of: Uniform for buffers and uniforms, Workgroup for shared arrays,
+// Function for locals.
+func (c *spvCompiler) storageOf(e ast.Expr) uint32 {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		if v, ok := c.lookup(ex.Name); ok && v.kind == spvUniform {
+			return spvStorageUniform
+		}
+	case *ast.ParenExpr:
+		return c.storageOf(ex.X)
+	case *ast.SelectorExpr:
+		return c.storageOf(ex.X)
+	case *ast.IndexExpr:
+		if id, ok := ex.X.(*ast.Ident); ok {
+			if v, ok := c.lookup(id.Name); ok && v.kind == spvShared {
+				return spvStorageWorkgroup
+			}
+		}
+		return spvStorageUniform
+	}
+	return spvStorageFunction
+}
+
+// field looks up a struct field by name.
+func (c *spvCompiler) field(typ, name string) (int, spvField, error) {
+	fields, ok := c.m.structs[typ]
+	if !ok {
+		return 0, spvField{}, fmt.Errorf("%s has no field %s", typ, name)
+	}
+	for i, f := range fields {
+		if f.name == name {
+			return i, f, nil
+		}
+	}
+	return 0, spvField{}, fmt.Errorf("%s has no field %s", typ, name)
+}
+
+// addressable reports whether e names storage pointer can address, so a
+// selector on it can load just the selected part.
+func (c *spvCompiler) addressable(e ast.Expr) bool {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		v, ok := c.lookup(ex.Name)
+		return ok && (v.kind == spvLocal || v.kind == spvUniform)
+	case *ast.ParenExpr:
+		return c.addressable(ex.X)
+	case *ast.IndexExpr:
+		return true
+	case *ast.SelectorExpr:
+		return c.addressable(ex.X)
+	}
+	return false
+}
+
+// selector compiles a field read or a vector swizzle.
+func (c *spvCompiler) selector(ex *ast.SelectorExpr) (spvVal, error) {
+	sw := strings.ToLower(ex.Sel.Name)
+	if c.addressable(ex.X) {
+		if base, ok := ex.X.(*ast.Ident); ok {
+			if v, _ := c.lookup(base.Name); v.kind == spvUniform {
+				ptr, t, err := c.pointer(ex, false)
+				if err != nil {
+					return spvVal{}, err
+				}
+				return spvVal{c.op(spvOpLoad, c.m.mustTyp(t), ptr), t}, nil
+			}
+		}
+		if t, err := c.pointerType(ex.X); err == nil && (!isVecType(t) || len(sw) == 1) {
+			ptr, t, err := c.pointer(ex, false)
+			if err != nil {
+				return spvVal{}, err
+			}
+			return spvVal{c.op(spvOpLoad, c.m.mustTyp(t), ptr), t}, nil
+		}
+	}
+	v, err := c.expr(ex.X, "")
+	if err != nil {
+		return spvVal{}, err
+	}
+	if isVecType(v.typ) && isSwizzle(sw) {
+		idx := make([]uint32, len(sw))
+		for i := range sw {
+			idx[i] = uint32(strings.IndexByte("xyzw", sw[i]))
+			if int(idx[i]) >= vecLen(v.typ) {
+				return spvVal{}, fmt.Errorf("%s has no component %c", v.typ, sw[i])
+			}
+		}
+		if len(idx) == 1 {
+			return spvVal{c.op(spvOpCompositeExtract, c.m.mustTyp("float"), v.id, idx[0]), "float"}, nil
+		}
+		t := vecOf(len(idx))
+		return spvVal{c.op(spvOpVectorShuffle, c.m.mustTyp(t), append([]uint32{v.id, v.id}, idx...)...), t}, nil
+	}
+	i, f, err := c.field(v.typ, ex.Sel.Name)
+	if err != nil {
+		return spvVal{}, err
+	}
+	return spvVal{c.op(spvOpCompositeExtract, c.m.mustTyp(f.typ), v.id, uint32(i)), f.typ}, nil
+}
+
+// pointerType is the type of an addressable expression, without emitting
+// any code.
+func (c *spvCompiler) pointerType(e ast.Expr) (string, error) {
+	switch ex := e.(type) {
+	case *ast.Ident:
+		v, ok := c.lookup(ex.Name)
+		if !ok {
+			return "", fmt.Errorf("undefined identifier %q", ex.Name)
+		}
+		return v.typ, nil
+	case *ast.ParenExpr:
+		return c.pointerType(ex.X)
+	case *ast.IndexExpr:
+		return c.pointerType(ex.X)
+	case *ast.SelectorExpr:
+		t, err := c.pointerType(ex.X)
+		if err != nil {
+			return "", err
+		}
+		if isVecType(t) {
+			return "float", nil
+		}
+		_, f, err := c.field(t, ex.Sel.Name)
+		return f.typ, err
+	}
+	return "", fmt.Errorf("not addressable")
+}
+
+// compositeLit compiles Vec4{...} to a vector and a user struct literal
+// (keyed or positional) to a struct value.
+func (c *spvCompiler) compositeLit(ex *ast.CompositeLit) (spvVal, error) {
+	tname, ok := identType(ex.Type)
+	if !ok {
+		return spvVal{}, fmt.Errorf("unsupported composite literal")
+	}
+	if mt, ok := goToMSLType(tname); ok {
+		return c.construct(mt, ex.Elts)
+	}
+	fields, ok := c.m.structs[tname]
+	if !ok {
+		return spvVal{}, fmt.Errorf("unsupported composite type %q", tname)
+	}
+	vals := make([]uint32, len(fields))
+	set := make([]bool, len(fields))
+	for i, e := range ex.Elts {
+		fi := i
+		if kv, ok := e.(*ast.KeyValueExpr); ok {
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return spvVal{}, fmt.Errorf("unsupported composite key")
+			}
+			if fi, _, ok = c.fieldIndex(tname, key.Name); !ok {
+				return spvVal{}, fmt.Errorf("%s has no field %s", tname, key.Name)
+			}
+			e = kv.Value
+		}
+		if fi >= len(fields) {
+			return spvVal{}, fmt.Errorf("too many values in %s literal", tname)
+		}
+		v, err := c.expr(e, scalarOf(fields[fi].typ))
+		if err != nil {
+			return spvVal{}, err
+		}
+		if v, err = c.convert(v, fields[fi].typ); err != nil {
+			return spvVal{}, err
+		}
+		vals[fi], set[fi] = v.id, true
+	}
+	for i, f := range fields {
+		if !set[i] {
+			z, err := c.m.null(f.typ)
+			if err != nil {
+				return spvVal{}, err
+			}
+			vals[i] = z
+		}
+	}
+	st, err := c.m.typ(tname)
+	if err != nil {
+		return spvVal{}, err
+	}
+	return spvVal{c.op(spvOpCompositeConstruct, st, vals...), tname}, nil
+}
+
+func (c *spvCompiler) fieldIndex(typ, name string) (int, spvField, bool) {
+	i, f, err := c.field(typ, name)
+	return i, f, err == nil
+}
+
+// construct builds a float vector from scalars and smaller vectors (a single
+// scalar is broadcast), or a float4x4 from four float4 columns.
+func (c *spvCompiler) construct(t string, args []ast.Expr) (spvVal, error) {
+	if len(args) == 0 {
+		z, err := c.m.null(t)
+		return spvVal{z, t}, err
+	}
+	var parts []spvVal
+	n := 0
+	for _, a := range args {
+		v, err := c.expr(a, "float")
+		if err != nil {
+			return spvVal{}, err
+		}
+		if isScalar(v.typ) {
+			if v, err = c.convert(v, "float"); err != nil {
+				return spvVal{}, err
+			}
+		}
+		parts = append(parts, v)
+		n += vecLen(v.typ)
+	}
+	if t == "float4x4" {
+		if len(parts) != 4 {
+			return spvVal{}, fmt.Errorf("float4x4 needs four float4 columns")
+		}
+		for _, p := range parts {
+			if p.typ != "float4" {
+				return spvVal{}, fmt.Errorf("float4x4 column is %s, not float4", p.typ)
+			}
+		}
+	} else if len(parts) == 1 && isScalar(parts[0].typ) {
+		return c.convert(parts[0], t)
+	} else if n != vecLen(t) {
+		return spvVal{}, fmt.Errorf("%s needs %d components, got %d", t, vecLen(t), n)
+	}
+	ids := make([]uint32, len(parts))
+	for i, p := range parts {
+		ids[i] = p.id
+	}
+	return spvVal{c.op(spvOpCompositeConstruct, c.m.mustTyp(t), ids...), t}, nil
+}
+
+// spvFloatBuiltins are the GLSL.std.450 instructions of the float-only
+// builtins, whose integer arguments are converted to float.
+var spvFloatBuiltins = map[string]uint32{
+	"sqrt": glslSqrt, "floor": glslFloor, "ceil": glslCeil, "sin": glslSin, "cos": glslCos,
+	"tan": glslTan, "asin": glslAsin, "acos": glslAcos, "pow": glslPow, "exp": glslExp,
+	"log": glslLog, "round": glslRound, "fract": glslFract, "mix": glslFMix,
+	"normalize": glslNormalize, "cross": glslCross, "reflect": glslReflect,
+}
+
+// spvIntBuiltins are the builtins with float, int and uint variants.
+var spvIntBuiltins = map[string][3]uint32{
+	"abs":   {glslFAbs, glslSAbs, glslSAbs},
+	"min":   {glslFMin, glslSMin, glslUMin},
+	"max":   {glslFMax, glslSMax, glslUMax},
+	"clamp": {glslFClamp, glslSClamp, glslUClamp},
+}
+
+func (c *spvCompiler) call(ex *ast.CallExpr, hint string) (spvVal, error) {
+	if sel, ok := ex.Fun.(*ast.SelectorExpr); ok {
+		return c.methodCall(sel, ex.Args)
+	}
+	id, ok := ex.Fun.(*ast.Ident)
+	if !ok {
+		return spvVal{}, fmt.Errorf("unsupported call target")
+	}
+	if v, ok, err := c.workgroupCall(id.Name, ex.Args); ok {
+		return v, err
+	}
+	if f, ok := c.funcs[id.Name]; ok {
+		if f.sig.ret == "" {
+			return spvVal{}, fmt.Errorf("%s has no result", id.Name)
+		}
+		return c.callFunc(id.Name, f, ex.Args)
+	}
+	if mt, ok := vecCtor[id.Name]; ok {
+		return c.construct(mt, ex.Args)
+	}
+	name, ok := builtins[id.Name]
+	if !ok {
+		return spvVal{}, fmt.Errorf("call to %q is not in the builtin/conversion whitelist", id.Name)
+	}
+	switch name {
+	case "float", "int", "uint":
+		if len(ex.Args) != 1 {
+			return spvVal{}, fmt.Errorf("conversion to %s takes one argument", name)
+		}
+		v, err := c.expr(ex.Args[0], name)
+		if err != nil {
+			return spvVal{}, err
+		}
+		return c.convert(v, name)
+	}
+	args, err := c.args(ex.Args)
+	if err != nil {
+		return spvVal{}, err
+	}
+	return c.builtin(name, args)
+}
+
+// callFunc calls helper f, converting each argument to its parameter type.
+func (c *spvCompiler) callFunc(name string, f spvFunc, list []ast.Expr) (spvVal, error) {
+	if len(list) != len(f.sig.types) {
+		return spvVal{}, fmt.Errorf("%s takes %d arguments, got %d", name, len(f.sig.types), len(list))
+	}
+	ops := []uint32{f.id}
+	for i, a := range list {
+		t := f.sig.types[i]
+		v, err := c.expr(a, hintOf(t))
+		if err != nil {
+			return spvVal{}, err
+		}
+		if v, err = c.convert(v, t); err != nil {
+			return spvVal{}, err
+		}
+		ops = append(ops, v.id)
+	}
+	ret := c.m.mustTyp("void")
+	if f.sig.ret != "" {
+		ret = c.m.mustTyp(f.sig.ret)
+	}
+	return spvVal{c.op(spvOpFunctionCall, ret, ops...), f.sig.ret}, nil
+}
+
+// hintOf is the type untyped constants take where a value of type t is
+// expected: its component type, or none for a struct.
+func hintOf(t string) string {
+	if s := scalarOf(t); isScalar(s) {
+		return s
+	}
+	return ""
+}
+
+// args compiles call arguments, giving untyped constants the type of the
+// first typed argument's components.
+func (c *spvCompiler) args(list []ast.Expr) ([]spvVal, error) {
+	vals := make([]spvVal, len(list))
+	hint := ""
+	for i, a := range list {
+		if isUntyped(a) {
+			continue
+		}
+		v, err := c.expr(a, "")
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+		if hint == "" {
+			hint = scalarOf(v.typ)
+		}
+	}
+	if hint == "" {
+		hint = "float"
+	}
+	for i, a := range list {
+		if isUntyped(a) {
+			v, err := c.expr(a, hint)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+	}
+	return vals, nil
+}
+
+// unify converts args to one type: the widest vector among them, else their
+// promoted scalar type (float when float is set).
+func (c *spvCompiler) unify(args []spvVal, float bool) ([]spvVal, string, error) {
+	t := ""
+	for _, a := range args {
+		switch {
+		case isVecType(a.typ):
+			if t != "" && isVecType(t) && t != a.typ {
+				return nil, "", fmt.Errorf("mismatched vector arguments %s and %s", t, a.typ)
+			}
+			t = a.typ
+		case !isScalar(a.typ):
+			return nil, "", fmt.Errorf("unsupported argument type %s", a.typ)
+		case isVecType(t):
+		case t == "" || a.typ == "float" || (a.typ == "uint" && t == "int"):
+			t = a.typ
+		}
+	}
+	if float && !isVecType(t) {
+		t = "float"
+	}
+	out := make([]spvVal, len(args))
+	for i, a := range args {
+		v, err := c.convert(a, t)
+		if err != nil {
+			return nil, "", err
+		}
+		out[i] = v
+	}
+	return out, t, nil
+}
+
+func (c *spvCompiler) builtin(name string, args []spvVal) (spvVal, error) {
+	ids := func(vs []spvVal) []uint32 {
+		out := make([]uint32, len(vs))
+		for i, v := range vs {
+			out[i] = v.id
+		}
+		return out
+	}
+	switch name {
+	case "dot":
+		if len(args) != 2 {
+			return spvVal{}, fmt.Errorf("dot takes two arguments")
+		}
+		vs, t, err := c.unify(args, true)
+		if err != nil {
+			return spvVal{}, err
+		}
+		if !isVecType(t) {
+			return spvVal{c.op(spvOpFMul, c.m.mustTyp("float"), vs[0].id, vs[1].id), "float"}, nil
+		}
+		return spvVal{c.op(spvOpDot, c.m.mustTyp("float"), vs[0].id, vs[1].id), "float"}, nil
+	case "length":
+		if len(args) != 1 {
+			return spvVal{}, fmt.Errorf("length takes one argument")
+		}
+		vs, _, err := c.unify(args, true)
+		if err != nil {
+			return spvVal{}, err
+		}
+		return c.ext(glslLength, "float", vs[0].id), nil
+	case "atan":
+		vs, t, err := c.unify(args, true)
+		if err != nil {
+			return spvVal{}, err
+		}
+		switch len(vs) {
+		case 1:
+			return c.ext(glslAtan, t, vs[0].id), nil
+		case 2:
+			return c.ext(glslAtan2, t, vs[0].id, vs[1].id), nil
+		}
+		return spvVal{}, fmt.Errorf("atan takes one or two arguments")
+	case "dfdx", "dfdy":
+		if len(args) != 1 {
+			return spvVal{}, fmt.Errorf("%s takes one argument", name)
+		}
+		op := uint32(spvOpDPdx)
+		if name == "dfdy" {
+			op = spvOpDPdy
+		}
+		return spvVal{c.op(op, c.m.mustTyp(args[0].typ), args[0].id), args[0].typ}, nil
+	}
+	if insts, ok := spvIntBuiltins[name]; ok {
+		vs, t, err := c.unify(args, false)
+		if err != nil {
+			return spvVal{}, err
+		}
+		inst := insts[0]
+		switch t {
+		case "int":
+			inst = insts[1]
+		case "uint":
+			inst = insts[2]
+		}
+		return c.ext(inst, t, ids(vs)...), nil
+	}
+	inst, ok := spvFloatBuiltins[name]
+	if !ok {
+		return spvVal{}, fmt.Errorf("builtin %q is not supported by the SPIR-V backend", name)
+	}
+	vs, t, err := c.unify(args, true)
+	if err != nil {
+		return spvVal{}, err
+	}
+	return c.ext(inst, t, ids(vs)...), nil
+}
+
+// methodCall lowers the gpumath vector/matrix methods to operators and
+// builtins, as the text backends do.
+func (c *spvCompiler) methodCall(sel *ast.SelectorExpr, list []ast.Expr) (spvVal, error) {
+	recv, err := c.expr(sel.X, "")
+	if err != nil {
+		return spvVal{}, err
+	}
+	args, err := c.args(list)
+	if err != nil {
+		return spvVal{}, err
+	}
+	name := sel.Sel.Name
+	if op, ok := vecMethodOp[name]; ok {
+		if len(args) != 1 {
+			return spvVal{}, fmt.Errorf("method %q takes one argument", name)
+		}
+		tok := map[string]token.Token{"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO}[op]
+		return c.arith(tok, recv, args[0])
+	}
+	switch name {
+	case "Dot", "Length", "Normalize":
+		return c.builtin(strings.ToLower(name), append([]spvVal{recv}, args...))
+	case "Sample":
+		return spvVal{}, fmt.Errorf("SPIR-V backend does not support textures/samplers yet")
+	}
+	return spvVal{}, fmt.Errorf("unsupported method %q", name)
+}
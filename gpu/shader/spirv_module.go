@@ -0,0 +1,432 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SPIR-V opcodes, enumerants and GLSL.std.450 instructions used by the
+// emitter, numbered as in the SPIR-V 1.0 and GLSL.std.450 specifications.
+const (
+	spvOpName                 = 5
+	spvOpExtInstImport        = 11
+	spvOpExtInst              = 12
+	spvOpMemoryModel          = 14
+	spvOpEntryPoint           = 15
+	spvOpExecutionMode        = 16
+	spvOpCapability           = 17
+	spvOpTypeVoid             = 19
+	spvOpTypeBool             = 20
+	spvOpTypeInt              = 21
+	spvOpTypeFloat            = 22
+	spvOpTypeVector           = 23
+	spvOpTypeMatrix           = 24
+	spvOpTypeArray            = 28
+	spvOpTypeRuntimeArray     = 29
+	spvOpTypeStruct           = 30
+	spvOpTypePointer          = 32
+	spvOpTypeFunction         = 33
+	spvOpConstantTrue         = 41
+	spvOpConstantFalse        = 42
+	spvOpConstant             = 43
+	spvOpConstantNull         = 46
+	spvOpFunction             = 54
+	spvOpFunctionParameter    = 55
+	spvOpFunctionEnd          = 56
+	spvOpFunctionCall         = 57
+	spvOpVariable             = 59
+	spvOpLoad                 = 61
+	spvOpStore                = 62
+	spvOpAccessChain          = 65
+	spvOpDecorate             = 71
+	spvOpMemberDecorate       = 72
+	spvOpVectorShuffle        = 79
+	spvOpCompositeConstruct   = 80
+	spvOpCompositeExtract     = 81
+	spvOpConvertFToU          = 109
+	spvOpConvertFToS          = 110
+	spvOpConvertSToF          = 111
+	spvOpConvertUToF          = 112
+	spvOpBitcast              = 124
+	spvOpSNegate              = 126
+	spvOpFNegate              = 127
+	spvOpIAdd                 = 128
+	spvOpFAdd                 = 129
+	spvOpISub                 = 130
+	spvOpFSub                 = 131
+	spvOpIMul                 = 132
+	spvOpFMul                 = 133
+	spvOpUDiv                 = 134
+	spvOpSDiv                 = 135
+	spvOpFDiv                 = 136
+	spvOpUMod                 = 137
+	spvOpSRem                 = 138
+	spvOpFRem                 = 140
+	spvOpVectorTimesScalar    = 142
+	spvOpMatrixTimesScalar    = 143
+	spvOpVectorTimesMatrix    = 144
+	spvOpMatrixTimesVector    = 145
+	spvOpMatrixTimesMatrix    = 146
+	spvOpDot                  = 148
+	spvOpLogicalEqual         = 164
+	spvOpLogicalNotEqual      = 165
+	spvOpLogicalNot           = 168
+	spvOpIEqual               = 170
+	spvOpINotEqual            = 171
+	spvOpUGreaterThan         = 172
+	spvOpSGreaterThan         = 173
+	spvOpUGreaterThanEqual    = 174
+	spvOpSGreaterThanEqual    = 175
+	spvOpULessThan            = 176
+	spvOpSLessThan            = 177
+	spvOpULessThanEqual       = 178
+	spvOpSLessThanEqual       = 179
+	spvOpFOrdEqual            = 180
+	spvOpFUnordNotEqual       = 183
+	spvOpFOrdLessThan         = 184
+	spvOpFOrdGreaterThan      = 186
+	spvOpFOrdLessThanEqual    = 188
+	spvOpFOrdGreaterThanEqual = 190
+	spvOpShiftRightLogical    = 194
+	spvOpShiftRightArith      = 195
+	spvOpShiftLeftLogical     = 196
+	spvOpBitwiseOr            = 197
+	spvOpBitwiseXor           = 198
+	spvOpBitwiseAnd           = 199
+	spvOpNot                  = 200
+	spvOpDPdx                 = 207
+	spvOpDPdy                 = 208
+	spvOpControlBarrier       = 224
+	spvOpAtomicIAdd           = 234
+	spvOpAtomicUMin           = 237
+	spvOpAtomicUMax           = 239
+	spvOpPhi                  = 245
+	spvOpLoopMerge            = 246
+	spvOpSelectionMerge       = 247
+	spvOpLabel                = 248
+	spvOpBranch               = 249
+	spvOpBranchConditional    = 250
+	spvOpReturn               = 253
+	spvOpReturnValue          = 254
+	spvOpUnreachable          = 255
+
+	spvCapShader = 1
+
+	spvModelVertex   = 0
+	spvModelFragment = 4
+	spvModelCompute  = 5
+
+	spvModeOriginUpperLeft = 7
+	spvModeLocalSize       = 17
+
+	spvStorageInput     = 1
+	spvStorageUniform   = 2
+	spvStorageOutput    = 3
+	spvStorageWorkgroup = 4
+	spvStorageFunction  = 7
+
+	spvScopeDevice    = 1
+	spvScopeWorkgroup = 2
+
+	spvSemanticsAcquireRelease  = 0x8
+	spvSemanticsWorkgroupMemory = 0x100
+
+	spvDecBlock         = 2
+	spvDecBufferBlock   = 3
+	spvDecColMajor      = 5
+	spvDecArrayStride   = 6
+	spvDecMatrixStride  = 7
+	spvDecBuiltIn       = 11
+	spvDecFlat          = 14
+	spvDecNonWritable   = 24
+	spvDecLocation      = 30
+	spvDecBinding       = 33
+	spvDecDescriptorSet = 34
+	spvDecOffset        = 35
+
+	spvBuiltInPosition             = 0
+	spvBuiltInFragCoord            = 15
+	spvBuiltInWorkgroupID          = 26
+	spvBuiltInGlobalInvocationID   = 28
+	spvBuiltInLocalInvocationIndex = 29
+	spvBuiltInVertexIndex          = 42
+	spvBuiltInInstanceIndex        = 43
+
+	glslRound     = 1
+	glslFAbs      = 4
+	glslSAbs      = 5
+	glslFloor     = 8
+	glslCeil      = 9
+	glslFract     = 10
+	glslSin       = 13
+	glslCos       = 14
+	glslTan       = 15
+	glslAsin      = 16
+	glslAcos      = 17
+	glslAtan      = 18
+	glslAtan2     = 25
+	glslPow       = 26
+	glslExp       = 27
+	glslLog       = 28
+	glslSqrt      = 31
+	glslFMin      = 37
+	glslUMin      = 38
+	glslSMin      = 39
+	glslFMax      = 40
+	glslUMax      = 41
+	glslSMax      = 42
+	glslFClamp    = 43
+	glslUClamp    = 44
+	glslSClamp    = 45
+	glslFMix      = 46
+	glslLength    = 66
+	glslCross     = 68
+	glslNormalize = 69
+	glslReflect   = 71
+)
+
+// spvModule accumulates the sections of one SPIR-V module in their required
+// order. Types and constants are created on first use and cached by a key
+// built from their canonical (MSL-spelled) type, so every kernel compiler
+// shares one spelling of the type system with the text backends.
+type spvModule struct {
+	bound       uint32
+	entry       []uint32 // OpEntryPoint and OpExecutionMode
+	names       []uint32
+	annotations []uint32
+	globals     []uint32 // types, constants and global variables
+	funcs       []uint32
+
+	ids     map[string]uint32
+	structs map[string][]spvField
+	glslExt uint32
+}
+
+// spvField is a struct member: its name, canonical type and whether it is the
+// clip-space position (the `gpu:"position"` tag).
+type spvField struct {
+	name     string
+	typ      string
+	position bool
+}
+
+func newSPVModule() *spvModule {
+	m := &spvModule{bound: 1, ids: map[string]uint32{}, structs: map[string][]spvField{}}
+	m.glslExt = m.id()
+	return m
+}
+
+func (m *spvModule) id() uint32 {
+	id := m.bound
+	m.bound++
+	return id
+}
+
+// inst appends one instruction to sec.
+func spvInst(sec *[]uint32, op uint32, operands ...uint32) {
+	*sec = append(*sec, uint32(len(operands)+1)<<16|op)
+	*sec = append(*sec, operands...)
+}
+
+// spvString encodes s as a nul-terminated, word-padded literal string.
+func spvString(s string) []uint32 {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	w := make([]uint32, len(b)/4)
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return w
+}
+
+func (m *spvModule) decorate(target uint32, dec uint32, args ...uint32) {
+	spvInst(&m.annotations, spvOpDecorate, append([]uint32{target, dec}, args...)...)
+}
+
+func (m *spvModule) memberDecorate(target, member, dec uint32, args ...uint32) {
+	spvInst(&m.annotations, spvOpMemberDecorate, append([]uint32{target, member, dec}, args...)...)
+}
+
+// cached returns the id stored under key, or creates it with mk.
+func (m *spvModule) cached(key string, mk func(id uint32)) uint32 {
+	if id, ok := m.ids[key]; ok {
+		return id
+	}
+	id := m.id()
+	mk(id)
+	m.ids[key] = id
+	return id
+}
+
+// typ returns the id of a canonical type: void, bool, a scalar, a float
+// vector, float4x4 or a struct registered with m.structs (laid out for the
+// Function, Input and Output storage classes, without offsets).
+func (m *spvModule) typ(t string) (uint32, error) {
+	if id, ok := m.ids["t:"+t]; ok {
+		return id, nil
+	}
+	var ops []uint32
+	op := uint32(0)
+	switch t {
+	case "void":
+		op = spvOpTypeVoid
+	case "bool":
+		op = spvOpTypeBool
+	case "int":
+		op, ops = spvOpTypeInt, []uint32{32, 1}
+	case "uint":
+		op, ops = spvOpTypeInt, []uint32{32, 0}
+	case "float":
+		op, ops = spvOpTypeFloat, []uint32{32}
+	case "float2", "float3", "float4":
+		f, _ := m.typ("float")
+		op, ops = spvOpTypeVector, []uint32{f, uint32(vecLen(t))}
+	case "float4x4":
+		col, _ := m.typ("float4")
+		op, ops = spvOpTypeMatrix, []uint32{col, 4}
+	default:
+		fields, ok := m.structs[t]
+		if !ok {
+			return 0, fmt.Errorf("unsupported type %q", t)
+		}
+		op = spvOpTypeStruct
+		for _, f := range fields {
+			ft, err := m.typ(f.typ)
+			if err != nil {
+				return 0, err
+			}
+			ops = append(ops, ft)
+		}
+	}
+	id := m.id()
+	spvInst(&m.globals, op, append([]uint32{id}, ops...)...)
+	m.ids["t:"+t] = id
+	return id, nil
+}
+
+// mustTyp is typ for the built-in types, which always exist.
+func (m *spvModule) mustTyp(t string) uint32 {
+	id, err := m.typ(t)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func (m *spvModule) ptr(storage uint32, elem uint32) uint32 {
+	return m.cached(fmt.Sprintf("p:%d:%d", storage, elem), func(id uint32) {
+		spvInst(&m.globals, spvOpTypePointer, id, storage, elem)
+	})
+}
+
+func (m *spvModule) funcType(ret uint32, params ...uint32) uint32 {
+	return m.cached(fmt.Sprintf("f:%d:%v", ret, params), func(id uint32) {
+		spvInst(&m.globals, spvOpTypeFunction, append([]uint32{id, ret}, params...)...)
+	})
+}
+
+// constant returns a 32-bit scalar constant of type t (int, uint or float)
+// with the given bit pattern.
+func (m *spvModule) constant(t string, bits uint32) uint32 {
+	return m.cached(fmt.Sprintf("c:%s:%d", t, bits), func(id uint32) {
+		spvInst(&m.globals, spvOpConstant, m.mustTyp(t), id, bits)
+	})
+}
+
+func (m *spvModule) floatConst(f float32) uint32 { return m.constant("float", math.Float32bits(f)) }
+func (m *spvModule) intConst(i int32) uint32     { return m.constant("int", uint32(i)) }
+
+func (m *spvModule) boolConst(b bool) uint32 {
+	op := uint32(spvOpConstantFalse)
+	if b {
+		op = spvOpConstantTrue
+	}
+	return m.cached(fmt.Sprintf("c:bool:%v", b), func(id uint32) {
+		spvInst(&m.globals, op, m.mustTyp("bool"), id)
+	})
+}
+
+// null returns the zero value of type t.
+func (m *spvModule) null(t string) (uint32, error) {
+	tid, err := m.typ(t)
+	if err != nil {
+		return 0, err
+	}
+	return m.cached("n:"+t, func(id uint32) {
+		spvInst(&m.globals, spvOpConstantNull, tid, id)
+	}), nil
+}
+
+// std140 returns the alignment and size of a uniform-block member of type t.
+// float3 members are 16-byte aligned but 12 bytes long, so a scalar may
+// follow one in the same 16 bytes.
+func std140(t string) (align, size int, err error) {
+	switch t {
+	case "float", "int", "uint":
+		return 4, 4, nil
+	case "float2":
+		return 8, 8, nil
+	case "float3":
+		return 16, 12, nil
+	case "float4":
+		return 16, 16, nil
+	case "float4x4":
+		return 16, 64, nil
+	}
+	return 0, 0, fmt.Errorf("type %q is not supported in a uniform struct", t)
+}
+
+// bytes assembles the module: header, capability, extended instruction
+// import, memory model, then the accumulated sections.
+func (m *spvModule) bytes() []byte {
+	var w []uint32
+	w = append(w, 0x07230203, 0x00010000, 0, m.bound, 0)
+	spvInst(&w, spvOpCapability, spvCapShader)
+	spvInst(&w, spvOpExtInstImport, append([]uint32{m.glslExt}, spvString("GLSL.std.450")...)...)
+	spvInst(&w, spvOpMemoryModel, 0, 1) // Logical, GLSL450
+	w = append(w, m.entry...)
+	w = append(w, m.names...)
+	w = append(w, m.annotations...)
+	w = append(w, m.globals...)
+	w = append(w, m.funcs...)
+	out := make([]byte, len(w)*4)
+	for i, v := range w {
+		binary.LittleEndian.PutUint32(out[i*4:], v)
+	}
+	return out
+}
+
+func vecLen(t string) int {
+	switch t {
+	case "float2":
+		return 2
+	case "float3":
+		return 3
+	case "float4":
+		return 4
+	}
+	return 1
+}
+
+// scalarOf is the component type of t (t itself for a scalar).
+func scalarOf(t string) string {
+	if isVecType(t) || t == "float4x4" {
+		return "float"
+	}
+	return t
+}
+
+// vecOf is the float vector type with n components (float for n == 1).
+func vecOf(n int) string {
+	if n == 1 {
+		return "float"
+	}
+	return fmt.Sprintf("float%d", n)
+}
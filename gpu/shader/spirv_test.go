@@ -0,0 +1,325 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"encoding/binary"
+	"maps"
+	"strings"
+	"testing"
+
+	kernelpkg "poly.red/gpu/shader/gpumath/kernels"
+)
+
+// spvInstr is one decoded SPIR-V instruction.
+type spvInstr struct {
+	op       uint32
+	operands []uint32
+}
+
+// spvResultAt is where an emitted instruction keeps its result id: the first
+// operand for types, labels and imports, -1 for instructions without a
+// result, and otherwise (values) the second, after the result type.
+var spvResultAt = map[uint32]int{
+	spvOpExtInstImport: 0, spvOpLabel: 0,
+	spvOpTypeVoid: 0, spvOpTypeBool: 0, spvOpTypeInt: 0, spvOpTypeFloat: 0,
+	spvOpTypeVector: 0, spvOpTypeMatrix: 0, spvOpTypeRuntimeArray: 0, spvOpTypeArray: 0,
+	spvOpTypeStruct: 0, spvOpTypePointer: 0, spvOpTypeFunction: 0,
+
+	spvOpCapability: -1, spvOpMemoryModel: -1, spvOpEntryPoint: -1,
+	spvOpExecutionMode: -1, spvOpName: -1, spvOpDecorate: -1,
+	spvOpMemberDecorate: -1, spvOpStore: -1, spvOpFunctionEnd: -1,
+	spvOpReturn: -1, spvOpBranch: -1, spvOpBranchConditional: -1,
+	spvOpLoopMerge: -1, spvOpSelectionMerge: -1,
+	spvOpReturnValue: -1, spvOpUnreachable: -1, spvOpControlBarrier: -1,
+}
+
+// decodeSPIRV checks a module's header and instruction stream and that every
+// result id is below the bound and defined once, returning the instructions.
+func decodeSPIRV(t *testing.T, name string, b []byte) []spvInstr {
+	t.Helper()
+	if len(b)%4 != 0 || len(b) < 20 {
+		t.Fatalf("%s: %d bytes is not a SPIR-V module", name, len(b))
+	}
+	w := make([]uint32, len(b)/4)
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	if w[0] != 0x07230203 || w[1] != 0x00010000 {
+		t.Fatalf("%s: header magic %#x version %#x, want SPIR-V 1.0", name, w[0], w[1])
+	}
+	bound := w[3]
+	defined := map[uint32]bool{}
+	var out []spvInstr
+	for i := 5; i < len(w); {
+		n, op := int(w[i]>>16), w[i]&0xffff
+		if n == 0 || i+n > len(w) {
+			t.Fatalf("%s: bad instruction word count %d at word %d", name, n, i)
+		}
+		in := spvInstr{op: op, operands: w[i+1 : i+n]}
+		at, ok := spvResultAt[op]
+		if !ok {
+			at = 1
+		}
+		if at >= 0 {
+			id := in.operands[at]
+			if id == 0 || id >= bound {
+				t.Fatalf("%s: op %d result id %d outside the bound %d", name, op, id, bound)
+			}
+			if defined[id] {
+				t.Fatalf("%s: op %d redefines id %d", name, op, id)
+			}
+			defined[id] = true
+		}
+		out = append(out, in)
+		i += n
+	}
+	return out
+}
+
+// spvEntry returns the execution model and name of a module's single entry
+// point.
+func spvEntry(t *testing.T, insts []spvInstr) (uint32, string) {
+	t.Helper()
+	var entries []spvInstr
+	for _, in := range insts {
+		if in.op == spvOpEntryPoint {
+			entries = append(entries, in)
+		}
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d entry points, want 1", len(entries))
+	}
+	var name []byte
+	for _, w := range entries[0].operands[2:] {
+		for s := 0; s < 32; s += 8 {
+			if c := byte(w >> s); c != 0 {
+				name = append(name, c)
+			} else {
+				return entries[0].operands[0], string(name)
+			}
+		}
+	}
+	return entries[0].operands[0], string(name)
+}
+
+// spvDecorations collects the decoration dec of every id that has it.
+func spvDecorations(insts []spvInstr, dec uint32) map[uint32][]uint32 {
+	out := map[uint32][]uint32{}
+	for _, in := range insts {
+		if in.op == spvOpDecorate && in.operands[1] == dec {
+			out[in.operands[0]] = in.operands[2:]
+		}
+	}
+	return out
+}
+
+// TestCompileSPIRV checks the SPIR-V emitter's resource layout on a kernel
+// that mixes storage and uniform buffers: a GLCompute entry point named main
+// with a 1x1x1 workgroup, every buffer bound in descriptor set 0 at the
+// sequential index its Binding reports (one space, as on Metal), and only the
+// written buffer left writable. Executing the module is the Vulkan CI job's
+// part (TestShadingParityVulkan).
+func TestCompileSPIRV(t *testing.T) {
+	ks, err := CompileSPIRV(uniformSceneKernelSrc)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	k := ks["Shade"]
+	if k.MSL != "" || k.GLSL != "" {
+		t.Fatalf("CompileSPIRV set MSL/GLSL")
+	}
+	insts := decodeSPIRV(t, "Shade", k.SPIRV)
+
+	model, name := spvEntry(t, insts)
+	if model != spvModelCompute || name != "main" {
+		t.Fatalf("entry point = model %d %q, want GLCompute \"main\"", model, name)
+	}
+	var localSize []uint32
+	for _, in := range insts {
+		if in.op == spvOpExecutionMode && in.operands[1] == spvModeLocalSize {
+			localSize = in.operands[2:]
+		}
+	}
+	if len(localSize) != 3 || localSize[0] != 1 || localSize[1] != 1 || localSize[2] != 1 {
+		t.Fatalf("LocalSize = %v, want 1 1 1", localSize)
+	}
+
+	want := []string{"normals", "worldpos", "basecol", "lights", "matidx", "materials", "s", "out"}
+	if len(k.Bindings) != len(want) {
+		t.Fatalf("bindings = %+v, want %v", k.Bindings, want)
+	}
+	for i, b := range k.Bindings {
+		if b.Index != i || b.Name != want[i] {
+			t.Fatalf("binding %d = %+v, want %s at %d", i, b, want[i], i)
+		}
+		if kind := map[bool]BindingKind{true: UniformBuffer, false: StorageBuffer}[b.Name == "s"]; b.Kind != kind {
+			t.Fatalf("binding %s kind = %v, want %v", b.Name, b.Kind, kind)
+		}
+	}
+	bindings := spvDecorations(insts, spvDecBinding)
+	sets := spvDecorations(insts, spvDecDescriptorSet)
+	seen := map[uint32]bool{}
+	for id, b := range bindings {
+		if set, ok := sets[id]; !ok || set[0] != 0 {
+			t.Fatalf("binding %d is not in descriptor set 0", b[0])
+		}
+		seen[b[0]] = true
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("module binds %v, want %d sequential bindings", seen, len(want))
+	}
+
+	// The six read-only storage buffers are NonWritable, out is not.
+	nonWritable := 0
+	for _, in := range insts {
+		if in.op == spvOpMemberDecorate && in.operands[2] == spvDecNonWritable {
+			nonWritable++
+		}
+	}
+	if nonWritable != 6 {
+		t.Fatalf("%d NonWritable buffers, want 6", nonWritable)
+	}
+	if len(spvDecorations(insts, spvDecBufferBlock)) != 7 || len(spvDecorations(insts, spvDecBlock)) != 1 {
+		t.Fatalf("want 7 storage BufferBlocks and 1 uniform Block")
+	}
+}
+
+// TestCompileSPIRVStages compiles the engine kernels and a vertex/fragment
+// pair and checks each module's structure and execution model, and the
+// vertex/fragment interface: the position as a BuiltIn, varyings at matching
+// Locations.
+func TestCompileSPIRVStages(t *testing.T) {
+	corpus := map[string]string{
+		"deferred":  kernelpkg.ShadeSrc,
+		"shadow":    kernelpkg.ShadowSrc,
+		"ao":        kernelpkg.AOSrc,
+		"srgb":      kernelpkg.SRGBSrc,
+		"quantize":  kernelpkg.QuantizeSrc,
+		"histogram": kernelpkg.HistogramSrc,
+		"matrix":    kernels,
+		"vertfrag":  vertFragKernelSrc,
+		"forward":   kernelpkg.ForwardSrc,
+	}
+	models := map[Stage]uint32{StageCompute: spvModelCompute, StageVertex: spvModelVertex, StageFragment: spvModelFragment}
+	for name, src := range corpus {
+		t.Run(name, func(t *testing.T) {
+			ks, err := CompileSPIRV(src)
+			if err != nil {
+				t.Fatalf("compile %s: %v", name, err)
+			}
+			for kn, k := range ks {
+				insts := decodeSPIRV(t, kn, k.SPIRV)
+				if model, _ := spvEntry(t, insts); model != models[k.Stage] {
+					t.Fatalf("%s: execution model %d, want %d", kn, model, models[k.Stage])
+				}
+			}
+		})
+	}
+
+	ks, err := CompileSPIRV(vertFragKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// VMain writes Color at Location 0; FMain reads it there and writes its
+	// color at Location 0 too (inputs and outputs are separate spaces).
+	for _, tc := range []struct {
+		kernel  string
+		builtin uint32
+		locs    int
+	}{{"VMain", spvBuiltInPosition, 1}, {"FMain", spvBuiltInFragCoord, 2}} {
+		kn := tc.kernel
+		insts := decodeSPIRV(t, kn, ks[kn].SPIRV)
+		found := false
+		for _, b := range spvDecorations(insts, spvDecBuiltIn) {
+			found = found || b[0] == tc.builtin
+		}
+		locs := spvDecorations(insts, spvDecLocation)
+		if !found || len(locs) != tc.locs {
+			t.Fatalf("%s: want BuiltIn %d and %d Locations, got %v", kn, tc.builtin, tc.locs, locs)
+		}
+		for _, l := range locs {
+			if l[0] != 0 {
+				t.Fatalf("%s: varying at Location %d, want 0", kn, l[0])
+			}
+		}
+	}
+
+	// ForwardFragment reads four varyings, the integer one flat, takes the
+	// uv's derivatives and writes four colors at Locations 0 to 3.
+	ks, err = CompileSPIRV(kernelpkg.ForwardSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insts := decodeSPIRV(t, "ForwardFragment", ks["ForwardFragment"].SPIRV)
+	ops := map[uint32]int{}
+	for _, in := range insts {
+		ops[in.op]++
+	}
+	if ops[spvOpDPdx] != 1 || ops[spvOpDPdy] != 1 {
+		t.Errorf("ForwardFragment: %d OpDPdx and %d OpDPdy, want 1 each", ops[spvOpDPdx], ops[spvOpDPdy])
+	}
+	locs := map[uint32]int{}
+	for _, l := range spvDecorations(insts, spvDecLocation) {
+		locs[l[0]]++
+	}
+	if want := map[uint32]int{0: 2, 1: 2, 2: 2, 3: 2}; !maps.Equal(locs, want) {
+		t.Errorf("ForwardFragment: Locations %v, want %v (inputs and outputs)", locs, want)
+	}
+	if flat := spvDecorations(insts, spvDecFlat); len(flat) != 1 {
+		t.Errorf("ForwardFragment: %d Flat decorations, want 1", len(flat))
+	}
+}
+
+// TestCompileSPIRVRejectsUnsupported verifies the SPIR-V emitter reports what
+// it cannot compile instead of emitting an invalid module.
+func TestCompileSPIRVRejectsUnsupported(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{
+			name: "texture param",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+func K(gid uint, tex Texture2D, samp Sampler, out []float32) {
+	c := tex.Sample(samp, Vec2{0, 0})
+	out[gid] = c.X
+}`,
+			want: "textures",
+		},
+		{
+			name: "compute return",
+			src: `package k
+func K(gid uint, out []float32) float32 { return out[gid] }`,
+			want: "cannot return",
+		},
+		{
+			name: "vector compare",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+func K(gid uint, out []float32) {
+	a := Vec4{1, 2, 3, 4}
+	if a < a {
+		out[gid] = 1
+	}
+}`,
+			want: "cannot compare",
+		},
+		{
+			name: "undefined",
+			src: `package k
+func K(gid uint, out []float32) { out[gid] = missing }`,
+			want: "undefined identifier",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileSPIRV(tc.src)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Go→SPIR-V vertex/fragment on Vulkan: the varyings test of
+// varying_darwin_test.go, compiled with CompileSPIRV (no glslang) and
+// rendered through the Device API. Runs in the vk-probe CI job.
+package shader_test
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+const spirvVaryingKernels = `
+package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type VOut struct {
+	Pos   Vec4 ` + "`gpu:\"position\"`" + `
+	Color Vec4
+}
+
+//gpu:vertex
+func VCol(vid uint, pos []float32, col []float32) VOut {
+	return VOut{
+		Pos:   Vec4{pos[vid*2], pos[vid*2+1], 0, 1},
+		Color: Vec4{col[vid*3], col[vid*3+1], col[vid*3+2], 1},
+	}
+}
+
+//gpu:fragment
+func FCol(in VOut) Vec4 {
+	return in.Color
+}
+`
+
+func TestGoShaderVaryingVulkan(t *testing.T) {
+	if os.Getenv("POLYRED_VK_PROBE") != "1" {
+		t.Skip("set POLYRED_VK_PROBE=1 to run the Vulkan Go-shader render test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverVulkan))
+	if err != nil {
+		t.Skipf("no Vulkan device: %v", err)
+	}
+	defer dev.Close()
+
+	ks, err := shader.CompileSPIRV(spirvVaryingKernels)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	vmod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: ks["VCol"].SPIRV})
+	if err != nil {
+		t.Fatalf("vertex SPIR-V: %v", err)
+	}
+	fmod, err := dev.NewShaderModule(gpu.ShaderSource{SPIRV: ks["FCol"].SPIRV})
+	if err != nil {
+		t.Fatalf("fragment SPIR-V: %v", err)
+	}
+	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
+		VertexModule: vmod, VertexEntry: "VCol",
+		FragmentModule: fmod, FragmentEntry: "FCol",
+		ColorFormat: gpu.RGBA8Unorm,
+	})
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+
+	const W, H = 16, 16
+	target, _ := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: W, Height: H, RenderTarget: true})
+
+	// Full-clip triangle; vertices coloured red, green, blue.
+	pos := []float32{-1, -1, 3, -1, -1, 3}
+	col := []float32{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	posBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: len(pos) * 4, Usage: gpu.BufferStorage, Data: spirvBytes(pos)})
+	colBuf, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: len(col) * 4, Usage: gpu.BufferStorage, Data: spirvBytes(col)})
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: target, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1}})
+	rp.SetPipeline(pipe)
+	rp.SetVertexBuffer(0, posBuf)
+	rp.SetVertexBuffer(1, colBuf)
+	rp.Draw(gpu.TriangleList, 0, 3)
+	rp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	px := target.ReadPixels()
+	i := (H/2*W + W/2) * 4
+	r, g, b := int(px[i]), int(px[i+1]), int(px[i+2])
+
+	// As on Metal: the center's barycentric weights are (0.5, 0.25, 0.25).
+	near := func(got, want int) bool { return got >= want-30 && got <= want+30 }
+	if !near(r, 128) || !near(g, 64) || !near(b, 64) {
+		t.Fatalf("center colour = (%d,%d,%d), want ~(128,64,64) from interpolated varyings", r, g, b)
+	}
+}
+
+func spirvBytes(d []float32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(&d[0])), len(d)*4)
+}
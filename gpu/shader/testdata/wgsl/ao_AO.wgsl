@@ -0,0 +1,51 @@
+@group(0) @binding(0) var<storage, read> fragxyz: array<f32>;
+@group(0) @binding(1) var<storage, read> aoflag: array<f32>;
+@group(0) @binding(2) var<storage, read> depthbuf: array<f32>;
+@group(0) @binding(3) var<storage, read_write> color: array<f32>;
+@group(0) @binding(4) var<storage, read> au: array<f32>;
+
+@compute @workgroup_size(1)
+fn AO(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    if ((aoflag[gid] < 0.5)) {
+        return;
+    }
+    var px = fragxyz[(gid * 4)];
+    var py = fragxyz[((gid * 4) + 1)];
+    var traceDepth = fragxyz[((gid * 4) + 2)];
+    var width = i32(au[0]);
+    var height = i32(au[1]);
+    var total = f32(0);
+    for (var d = 0; (d < 8); d++) {
+        var ang = (f32(d) * 0.78539816339744830961);
+        var dirX = cos(ang);
+        var dirY = sin(ang);
+        var maxangle = f32(0);
+        for (var t = 0; (t < 100); t++) {
+            var ft = f32(t);
+            var dx = (dirX * ft);
+            var dy = (dirY * ft);
+            var distance = sqrt(((dx * dx) + (dy * dy)));
+            if ((distance >= 1.0)) {
+                var ix = i32((px + dx));
+                var iy = i32((py + dy));
+                if ((ix >= 0)) {
+                    if ((ix < width)) {
+                        if ((iy >= 0)) {
+                            if ((iy < height)) {
+                                var elevation = (depthbuf[((iy * width) + ix)] - traceDepth);
+                                maxangle = max(maxangle, atan((elevation / distance)));
+                            }
+                        }
+                    }
+                }
+            }
+        }
+        total = (total + ((1.57079632679489661923 - maxangle)));
+    }
+    total = (total / ((1.57079632679489661923 * 8.0)));
+    total = pow(total, 10000.0);
+    color[(gid * 4)] = floor((clamp(round(color[(gid * 4)]), 0.0, 255.0) * total));
+    color[((gid * 4) + 1)] = floor((clamp(round(color[((gid * 4) + 1)]), 0.0, 255.0) * total));
+    color[((gid * 4) + 2)] = floor((clamp(round(color[((gid * 4) + 2)]), 0.0, 255.0) * total));
+}
@@ -0,0 +1,44 @@
+struct Light {
+    Dir: vec4<f32>,
+    Power: f32,
+}
+
+@group(0) @binding(0) var<storage, read> nrm: array<f32>;
+@group(0) @binding(1) var<storage, read_write> out: array<f32>;
+
+fn fresnel(cosT: f32, f0: f32) -> f32 {
+    var m = clamp((1.0 - cosT), 0.0, 1.0);
+    return (f0 + (((((((1.0 - f0)) * m) * m) * m) * m) * m));
+}
+
+fn shade(n: vec4<f32>, l: Light) -> vec4<f32> {
+    var d = max(dot(n, l.Dir), 0.0);
+    if ((d > 0.5)) {
+        return (n * ((d * l.Power)));
+    }
+    return (n * fresnel(d, 0.04));
+}
+
+fn light(x: f32, y: f32, z: f32, p: f32) -> Light {
+    return Light(normalize(vec4<f32>(x, y, z, 0)), p);
+}
+
+fn bump(_v: f32, _k: i32) -> f32 {
+    var v = _v;
+    var k = _k;
+    for (; (k > 0); ) {
+        v = (v * 1.5);
+        k--;
+    }
+    return v;
+}
+
+@compute @workgroup_size(1)
+fn Lit(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    var n = vec4<f32>(nrm[(gid * 4)], nrm[((gid * 4) + 1)], nrm[((gid * 4) + 2)], 0);
+    var c = shade(n, light(0.3, 0.5, 0.8, 2));
+    out[(gid * 4)] = c.x;
+    out[((gid * 4) + 1)] = bump(c.y, i32(nrm[((gid * 4) + 3)]));
+    out[((gid * 4) + 2)] = fresnel(c.z, 0.5);
+}
@@ -0,0 +1,22 @@
+struct Params {
+    WidthA: u32,
+    HeightA: u32,
+    WidthB: u32,
+}
+
+@group(0) @binding(0) var<storage, read> a: array<f32>;
+@group(0) @binding(1) var<storage, read> b: array<f32>;
+@group(0) @binding(2) var<storage, read_write> out: array<f32>;
+@group(0) @binding(3) var<uniform> p: Params;
+
+@compute @workgroup_size(1)
+fn Mul(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = i32(_gid.x);
+    var row = (u32(gid) / p.WidthB);
+    var col = (u32(gid) % p.WidthB);
+    var sum: f32 = 0;
+    for (var i = u32(0); (i < p.WidthA); i++) {
+        sum += (a[((row * p.WidthA) + i)] * b[((i * p.WidthB) + col)]);
+    }
+    out[gid] = sum;
+}
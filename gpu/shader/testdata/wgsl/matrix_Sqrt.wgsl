@@ -0,0 +1,8 @@
+@group(0) @binding(0) var<storage, read> a: array<f32>;
+@group(0) @binding(1) var<storage, read_write> out: array<f32>;
+
+@compute @workgroup_size(1)
+fn Sqrt(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = i32(_gid.x);
+    out[gid] = sqrt(a[gid]);
+}
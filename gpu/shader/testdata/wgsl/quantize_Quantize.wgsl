@@ -0,0 +1,19 @@
+@group(0) @binding(0) var<storage, read> color: array<f32>;
+@group(0) @binding(1) var<storage, read> preset: array<f32>;
+@group(0) @binding(2) var<storage, read_write> out: array<f32>;
+
+@compute @workgroup_size(1)
+fn Quantize(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    var r = color[(gid * 4)];
+    var g = color[((gid * 4) + 1)];
+    var b = color[((gid * 4) + 2)];
+    if ((preset[((gid * 4) + 3)] >= 0.0)) {
+        r = preset[(gid * 4)];
+        g = preset[((gid * 4) + 1)];
+        b = preset[((gid * 4) + 2)];
+    }
+    out[(gid * 3)] = (clamp(round(r), 0.0, 255.0) / 255.0);
+    out[((gid * 3) + 1)] = (clamp(round(g), 0.0, 255.0) / 255.0);
+    out[((gid * 3) + 2)] = (clamp(round(b), 0.0, 255.0) / 255.0);
+}
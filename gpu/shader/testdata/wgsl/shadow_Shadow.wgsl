@@ -0,0 +1,40 @@
+@group(0) @binding(0) var<storage, read> fragxyz: array<f32>;
+@group(0) @binding(1) var<storage, read> recv: array<f32>;
+@group(0) @binding(2) var<storage, read> depths: array<f32>;
+@group(0) @binding(3) var<storage, read> mats: array<f32>;
+@group(0) @binding(4) var<storage, read_write> color: array<f32>;
+@group(0) @binding(5) var<storage, read> su: array<f32>;
+
+@compute @workgroup_size(1)
+fn Shadow(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    if ((recv[gid] < 0.5)) {
+        return;
+    }
+    var fx = fragxyz[(gid * 4)];
+    var fy = fragxyz[((gid * 4) + 1)];
+    var fz = fragxyz[((gid * 4) + 2)];
+    var occ = f32(0);
+    var width = i32(su[0]);
+    var dl = i32(su[1]);
+    var n = i32(su[2]);
+    for (var k = 0; (k < n); k++) {
+        var M = mat4x4<f32>(vec4<f32>(mats[(k * 16)], mats[((k * 16) + 1)], mats[((k * 16) + 2)], mats[((k * 16) + 3)]), vec4<f32>(mats[((k * 16) + 4)], mats[((k * 16) + 5)], mats[((k * 16) + 6)], mats[((k * 16) + 7)]), vec4<f32>(mats[((k * 16) + 8)], mats[((k * 16) + 9)], mats[((k * 16) + 10)], mats[((k * 16) + 11)]), vec4<f32>(mats[((k * 16) + 12)], mats[((k * 16) + 13)], mats[((k * 16) + 14)], mats[((k * 16) + 15)]));
+        var clip = (M * vec4<f32>(fx, fy, fz, 1));
+        var sx = (clip.x / clip.w);
+        var sy = (clip.y / clip.w);
+        var sz = (clip.z / clip.w);
+        var idx = (i32(sx) + (i32(sy) * width));
+        if ((idx > 0)) {
+            if ((idx < dl)) {
+                if ((sz < (depths[((k * dl) + idx)] - 0.03))) {
+                    occ = (occ + 1);
+                }
+            }
+        }
+    }
+    var wf = pow(0.5, occ);
+    color[(gid * 4)] = floor((clamp(round(color[(gid * 4)]), 0.0, 255.0) * wf));
+    color[((gid * 4) + 1)] = floor((clamp(round(color[((gid * 4) + 1)]), 0.0, 255.0) * wf));
+    color[((gid * 4) + 2)] = floor((clamp(round(color[((gid * 4) + 2)]), 0.0, 255.0) * wf));
+}
@@ -0,0 +1,13 @@
+@group(0) @binding(0) var<storage, read> in: array<f32>;
+@group(0) @binding(1) var<storage, read_write> out: array<f32>;
+
+@compute @workgroup_size(1)
+fn SRGB(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    var v = in[gid];
+    if ((v <= 0.0031308)) {
+        out[gid] = (v * 12.92);
+    } else {
+        out[gid] = ((1.055 * pow(v, 0.4166666666)) - 0.055);
+    }
+}
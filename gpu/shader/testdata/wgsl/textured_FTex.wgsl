@@ -0,0 +1,18 @@
+struct VOut {
+    @builtin(position) Pos: vec4<f32>,
+    @location(0) UV: vec2<f32>,
+    @location(1) Tint: vec4<f32>,
+    @location(2) @interpolate(flat) Mat: u32,
+}
+
+@group(0) @binding(0) var tex: texture_2d<f32>;
+@group(0) @binding(1) var samp: sampler;
+
+@fragment
+fn FTex(in: VOut) -> @location(0) vec4<f32> {
+    var c: vec4<f32> = textureSample(tex, samp, in.UV);
+    if (((in.Mat & 1) == 1)) {
+        c = (c * in.Tint);
+    }
+    return c;
+}
@@ -0,0 +1,23 @@
+struct Params {
+    Scale: f32,
+    Shift: u32,
+}
+
+struct VOut {
+    @builtin(position) Pos: vec4<f32>,
+    @location(0) UV: vec2<f32>,
+    @location(1) Tint: vec4<f32>,
+    @location(2) @interpolate(flat) Mat: u32,
+}
+
+@group(0) @binding(0) var<storage, read> pos: array<f32>;
+@group(0) @binding(1) var<uniform> p: Params;
+
+@vertex
+fn VTex(@builtin(vertex_index) _vid: u32, @builtin(instance_index) _iid: u32) -> VOut {
+    let vid = i32(_vid);
+    let iid = i32(_iid);
+    var x = (pos[(vid * 2)] * p.Scale);
+    var y = (pos[((vid * 2) + 1)] * p.Scale);
+    return VOut(vec4<f32>(x, y, 0, 1), vec2<f32>(x, y), vec4<f32>(), (u32(iid) << u32(p.Shift)));
+}
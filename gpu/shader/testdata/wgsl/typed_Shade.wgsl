@@ -0,0 +1,30 @@
+struct Light {
+    Pos: vec4<f32>,
+    Color: vec4<f32>,
+    Range: f32,
+    Kind: u32,
+}
+
+struct Frag {
+    Color: vec4<f32>,
+    Depth: f32,
+    ID: i32,
+}
+
+@group(0) @binding(0) var<storage, read> lights: array<Light>;
+@group(0) @binding(1) var<storage, read> ids: array<u32>;
+@group(0) @binding(2) var<storage, read> offs: array<i32>;
+@group(0) @binding(3) var<storage, read> dirs: array<vec4<f32>>;
+@group(0) @binding(4) var<storage, read_write> out: array<Frag>;
+
+@compute @workgroup_size(1)
+fn Shade(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    var l = lights[gid];
+    var c = (l.Color * ((l.Range / ((1.0 + dot(l.Pos, dirs[gid]))))));
+    if ((lights[gid].Kind > 2)) {
+        c = (c * 0.5);
+    }
+    out[gid] = Frag(c, (f32((ids[gid] % 7)) + lights[gid].Pos.x), (offs[gid] + 3));
+    out[gid].Color.w = 1.0;
+}
@@ -0,0 +1,55 @@
+struct Scene {
+    CamPos: vec4<f32>,
+    AmbientI: f32,
+    NumLights: f32,
+    Pad1: f32,
+    Pad2: f32,
+}
+
+@group(0) @binding(0) var<storage, read> normals: array<f32>;
+@group(0) @binding(1) var<storage, read> worldpos: array<f32>;
+@group(0) @binding(2) var<storage, read> basecol: array<f32>;
+@group(0) @binding(3) var<storage, read> lights: array<f32>;
+@group(0) @binding(4) var<storage, read> matidx: array<f32>;
+@group(0) @binding(5) var<storage, read> materials: array<f32>;
+@group(0) @binding(6) var<uniform> s: Scene;
+@group(0) @binding(7) var<storage, read_write> out: array<f32>;
+
+@compute @workgroup_size(1)
+fn Shade(@builtin(global_invocation_id) _gid: vec3<u32>) {
+    let gid = _gid.x;
+    var N = vec4<f32>(normals[(gid * 4)], normals[((gid * 4) + 1)], normals[((gid * 4) + 2)], normals[((gid * 4) + 3)]);
+    var wpos = vec4<f32>(worldpos[(gid * 4)], worldpos[((gid * 4) + 1)], worldpos[((gid * 4) + 2)], worldpos[((gid * 4) + 3)]);
+    var col = vec4<f32>(basecol[(gid * 4)], basecol[((gid * 4) + 1)], basecol[((gid * 4) + 2)], basecol[((gid * 4) + 3)]);
+    var mi = i32(matidx[gid]);
+    var diffuse = vec4<f32>(materials[(mi * 9)], materials[((mi * 9) + 1)], materials[((mi * 9) + 2)], materials[((mi * 9) + 3)]);
+    var specular = vec4<f32>(materials[((mi * 9) + 4)], materials[((mi * 9) + 5)], materials[((mi * 9) + 6)], materials[((mi * 9) + 7)]);
+    var shininess = materials[((mi * 9) + 8)];
+    var acc = (col * s.AmbientI);
+    var count = i32(s.NumLights);
+    for (var i = 0; (i < count); i++) {
+        var lt = lights[(i * 10)];
+        var lp = vec4<f32>(lights[((i * 10) + 1)], lights[((i * 10) + 2)], lights[((i * 10) + 3)], lights[((i * 10) + 4)]);
+        var lc = vec4<f32>(lights[((i * 10) + 5)], lights[((i * 10) + 6)], lights[((i * 10) + 7)], lights[((i * 10) + 8)]);
+        var li = lights[((i * 10) + 9)];
+        var L: vec4<f32>;
+        var I: f32;
+        if ((lt < 0.5)) {
+            var Ldir = (lp - wpos);
+            L = normalize(Ldir);
+            I = (li / length(Ldir));
+        } else {
+            L = vec4<f32>(-lp.x, -lp.y, -lp.z, 0);
+            I = li;
+        }
+        var V = normalize((s.CamPos - wpos));
+        var H = normalize((L + V));
+        var Ld = clamp(dot(N, L), 0.0, 1.0);
+        var Ls = pow(clamp(dot(N, H), 0.0, 1.0), shininess);
+        acc = ((acc + ((diffuse * ((col * ((Ld * I))))) / 255.0)) + ((specular * ((lc * ((Ls * I))))) / 255.0));
+    }
+    out[(gid * 4)] = acc.x;
+    out[((gid * 4) + 1)] = acc.y;
+    out[((gid * 4) + 2)] = acc.z;
+    out[((gid * 4) + 3)] = col.w;
+}
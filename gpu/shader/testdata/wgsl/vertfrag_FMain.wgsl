@@ -0,0 +1,9 @@
+struct VOut {
+    @builtin(position) Pos: vec4<f32>,
+    @location(0) Color: vec4<f32>,
+}
+
+@fragment
+fn FMain(in: VOut) -> @location(0) vec4<f32> {
+    return in.Color;
+}
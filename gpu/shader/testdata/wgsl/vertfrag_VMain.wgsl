@@ -0,0 +1,13 @@
+struct VOut {
+    @builtin(position) Pos: vec4<f32>,
+    @location(0) Color: vec4<f32>,
+}
+
+@group(0) @binding(0) var<storage, read> pos: array<f32>;
+@group(0) @binding(1) var<storage, read> col: array<f32>;
+
+@vertex
+fn VMain(@builtin(vertex_index) _vid: u32) -> VOut {
+    let vid = _vid;
+    return VOut(vec4<f32>(pos[(vid * 2)], pos[((vid * 2) + 1)], 0, 1), vec4<f32>(col[(vid * 3)], col[((vid * 3) + 1)], col[((vid * 3) + 2)], 1));
+}
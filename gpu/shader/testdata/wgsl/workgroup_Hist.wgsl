@@ -0,0 +1,20 @@
+@group(0) @binding(0) var<storage, read> in: array<f32>;
+@group(0) @binding(1) var<storage, read_write> hist: array<atomic<u32>>;
+var<workgroup> bins: array<atomic<u32>, 16>;
+
+@compute @workgroup_size(64)
+fn Hist(@builtin(global_invocation_id) _gid: vec3<u32>, @builtin(local_invocation_index) _lid: u32) {
+    let gid = _gid.x;
+    let lid = _lid;
+    if ((lid < 16)) {
+        atomicStore(&bins[lid], 0);
+    }
+    workgroupBarrier();
+    var b = u32(clamp((in[gid] * 16.0), 0.0, 15.0));
+    atomicAdd(&bins[b], 1);
+    atomicMax(&hist[16], b);
+    workgroupBarrier();
+    if ((lid < 16)) {
+        atomicAdd(&hist[lid], atomicLoad(&bins[lid]));
+    }
+}
@@ -0,0 +1,21 @@
+@group(0) @binding(0) var<storage, read> in: array<f32>;
+@group(0) @binding(1) var<storage, read_write> out: array<f32>;
+var<workgroup> tile: array<f32, 64>;
+
+@compute @workgroup_size(64)
+fn Sum(@builtin(global_invocation_id) _gid: vec3<u32>, @builtin(local_invocation_index) _lid: u32, @builtin(workgroup_id) _wid: vec3<u32>) {
+    let gid = _gid.x;
+    let lid = _lid;
+    let wid = _wid.x;
+    tile[lid] = in[gid];
+    workgroupBarrier();
+    for (var s = u32(32); (s > 0); s = (s / 2)) {
+        if ((lid < s)) {
+            tile[lid] = (tile[lid] + tile[(lid + s)]);
+        }
+        workgroupBarrier();
+    }
+    if ((lid == 0)) {
+        out[wid] = tile[0];
+    }
+}
@@ -19,8 +19,8 @@ import (
 // Note on scope: full go/types checking is not used because the kernel DSL
 // overloads operators on vector/matrix struct types (e.g. `m * v` where m is a
 // Mat4 and v a Vec4), which is not valid Go and which stock go/types rejects.
-// This AST-level check resolves bare identifiers against the compiler's own type
-// environment instead, catching the common typo/undefined-reference failure.
+// The DSL type checker (check.go) resolves identifiers against its own block
+// scopes instead, catching the common typo/undefined-reference failure.
 func TestCompileRejectsUndefinedIdent(t *testing.T) {
 	cases := []struct {
 		name string
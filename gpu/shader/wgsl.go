@@ -0,0 +1,382 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+)
+
+// CompileWGSL is like Compile but emits WGSL source (Kernel.WGSL) for a
+// WebGPU backend. It supports compute, vertex and fragment kernels in the
+// forms Compile accepts, textures and samplers included.
+//
+// Every resource parameter takes the next @binding in @group(0), in parameter
+// order, whatever its kind; Kernel.Bindings reports the same indices. Storage
+// buffers are runtime-sized arrays (read-only unless the kernel writes them)
+// and struct parameters are uniforms. The entry point keeps the kernel's name.
+// A compute kernel runs one invocation per workgroup, like the GLSL and SPIR-V
+// kernels, so Dispatch(n, 1, 1) runs it n times, unless it declares a
+// //gpu:workgroup size.
+func CompileWGSL(src string) (map[string]*Kernel, error) {
+	return compileAll(src, targetWGSL)
+}
+
+// wgslReserved are the WGSL keywords and reserved words that are valid Go
+// identifiers, plus the predeclared type names a kernel could shadow. Such
+// names are suffixed with "_" when emitting WGSL.
+var wgslReserved = map[string]bool{
+	// keywords
+	"alias": true, "const_assert": true, "continuing": true, "diagnostic": true,
+	"discard": true, "enable": true, "fn": true, "let": true, "loop": true,
+	"override": true, "requires": true, "while": true,
+	// predeclared types
+	"array": true, "atomic": true, "bool": true, "f16": true, "f32": true,
+	"i32": true, "u32": true, "mat2x2": true, "mat3x3": true, "mat4x4": true,
+	"ptr": true, "sampler": true, "texture_2d": true, "vec2": true, "vec3": true,
+	"vec4": true,
+	// reserved words
+	"NULL": true, "Self": true, "abstract": true, "active": true, "alignas": true,
+	"alignof": true, "as": true, "asm": true, "asm_fragment": true, "async": true,
+	"attribute": true, "auto": true, "await": true, "become": true,
+	"binding_array": true, "cast": true, "catch": true, "class": true,
+	"co_await": true, "co_return": true, "co_yield": true, "coherent": true,
+	"column_major": true, "common": true, "compile": true,
+	"compile_fragment": true, "concept": true, "const_cast": true,
+	"consteval": true, "constexpr": true, "constinit": true, "crate": true,
+	"debugger": true, "decltype": true, "delete": true, "demote": true,
+	"demote_to_helper": true, "do": true, "dynamic_cast": true, "enum": true,
+	"explicit": true, "export": true, "extends": true, "extern": true,
+	"external": true, "filter": true, "final": true, "finally": true,
+	"friend": true, "from": true, "fxgroup": true, "get": true,
+	"groupshared": true, "highp": true, "impl": true, "implements": true,
+	"inline": true, "instanceof": true, "layout": true, "lowp": true,
+	"macro": true, "macro_rules": true, "match": true, "mediump": true,
+	"meta": true, "mod": true, "module": true, "move": true, "mut": true,
+	"mutable": true, "namespace": true, "new": true, "nil": true,
+	"noexcept": true, "noinline": true, "nointerpolation": true,
+	"noperspective": true, "null": true, "nullptr": true, "of": true,
+	"operator": true, "packoffset": true, "partition": true, "pass": true,
+	"patch": true, "pixelfragment": true, "precise": true, "precision": true,
+	"premerge": true, "priv": true, "protected": true, "pub": true,
+	"public": true, "readonly": true, "ref": true, "regardless": true,
+	"register": true, "reinterpret_cast": true, "require": true,
+	"resource": true, "restrict": true, "self": true, "set": true,
+	"shared": true, "sizeof": true, "smooth": true, "snorm": true,
+	"static": true, "static_assert": true, "static_cast": true, "std": true,
+	"subroutine": true, "super": true, "target": true, "template": true,
+	"this": true, "thread_local": true, "throw": true, "trait": true,
+	"try": true, "typedef": true, "typeid": true, "typename": true,
+	"typeof": true, "union": true, "unless": true, "unorm": true,
+	"unsafe": true, "unsized": true, "use": true, "using": true,
+	"varying": true, "virtual": true, "volatile": true, "wgsl": true,
+	"where": true, "with": true, "writeonly": true, "yield": true,
+}
+
+// wgslType spells a canonical (MSL-spelled) type in WGSL.
+func wgslType(t string) string {
+	switch t {
+	case "float":
+		return "f32"
+	case "int", "int32":
+		return "i32"
+	case "uint", "uint32":
+		return "u32"
+	case "float2":
+		return "vec2<f32>"
+	case "float3":
+		return "vec3<f32>"
+	case "float4":
+		return "vec4<f32>"
+	case "float4x4":
+		return "mat4x4<f32>"
+	case "texture2d":
+		return "texture_2d<f32>"
+	case "texture2d_array":
+		return "texture_2d_array<f32>"
+	case "texturecube":
+		return "texture_cube<f32>"
+	case "texture3d":
+		return "texture_3d<f32>"
+	case "depth2d":
+		return "texture_depth_2d"
+	case "texture2d_ms":
+		return "texture_multisampled_2d<f32>"
+	default:
+		return t // bool, sampler and struct names are spelled the same
+	}
+}
+
+// compileKernelWGSL emits a WGSL module for fn. It reuses the shared body
+// translation (compiler with tgt=targetWGSL); the ids come from built-in
+// entry-point inputs bound to locals of the parameters' declared types, and a
+// vertex kernel's output struct (a fragment kernel's input) carries the
+// position built-in and the varyings' locations.
+func compileKernelWGSL(fn *ast.FuncDecl, structs map[string]*ast.StructType, funcs map[string]*ast.FuncDecl, shared map[string]sharedVar) (*Kernel, error) {
+	stage := stageOf(fn.Doc)
+	params := flattenParams(fn.Type.Params)
+	helpers, err := helpersOf(fn, funcs)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{structs: structs, env: map[string]string{}, written: writtenParams(fn.Body), tgt: targetWGSL, stage: stage, funcs: funcs, atomic: atomicTargets(fn.Body)}
+
+	var entry []string // the entry point's parameters
+	// id binds an id parameter to a built-in input, converted to the
+	// parameter's declared type.
+	id := func(p param, builtin, typ, sel string) {
+		gt, _ := identType(p.typ)
+		t, _ := goToMSLType(gt)
+		c.env[p.name] = t
+		in := "_" + p.name
+		entry = append(entry, fmt.Sprintf("@builtin(%s) %s: %s", builtin, in, typ))
+		v := in + sel
+		if t != "uint" {
+			v = c.typ(t) + "(" + v + ")"
+		}
+		c.indent(1)
+		fmt.Fprintf(&c.buf, "let %s = %s;\n", c.name(p.name), v)
+	}
+	if stage == StageCompute || stage == StageVertex {
+		if len(params) == 0 {
+			return nil, fmt.Errorf("kernel needs a leading id parameter")
+		}
+		if t, ok := identType(params[0].typ); !ok || !isIntType(t) {
+			return nil, fmt.Errorf("first parameter %q must be the int/uint id", params[0].name)
+		}
+		if stage == StageCompute {
+			id(params[0], "global_invocation_id", "vec3<u32>", ".x")
+		} else {
+			id(params[0], "vertex_index", "u32", "")
+		}
+		params = params[1:]
+	}
+	// A compute kernel may take its workgroup ids next.
+	if stage == StageCompute {
+		var wgIDs []param
+		wgIDs, params = workgroupIDs(params)
+		for i, p := range wgIDs {
+			if i == 0 {
+				id(p, "local_invocation_index", "u32", "")
+			} else {
+				id(p, "workgroup_id", "vec3<u32>", ".x")
+			}
+		}
+	}
+	// A vertex kernel may take a second integer parameter, the instance id.
+	if stage == StageVertex && len(params) > 0 {
+		if t, ok := identType(params[0].typ); ok && isIntType(t) {
+			id(params[0], "instance_index", "u32", "")
+			params = params[1:]
+		}
+	}
+
+	var bindings []Binding
+	var decls []string
+	bind := func(p param, kind BindingKind, decl string) {
+		decls = append(decls, fmt.Sprintf("@group(0) @binding(%d) %s", len(bindings), decl))
+		bindings = append(bindings, Binding{Index: len(bindings), Name: p.name, Kind: kind})
+	}
+	io := map[string]bool{} // the structs a kernel takes from or returns to the rasterizer
+	stageIn := false
+	for _, p := range params {
+		switch t := p.typ.(type) {
+		case *ast.ArrayType:
+			mt, err := bufferElem(p, t, structs)
+			if err != nil {
+				return nil, err
+			}
+			access, elem := "read", c.typ(mt)
+			if c.written[p.name] {
+				access = "read_write"
+			}
+			if c.atomic[p.name] {
+				access, elem = "read_write", "atomic<u32>"
+			}
+			bind(p, StorageBuffer, fmt.Sprintf("var<storage, %s> %s: array<%s>;", access, c.name(p.name), elem))
+			c.env[p.name] = mt + "*"
+		case *ast.Ident:
+			switch t.Name {
+			case "Texture2D", "Texture2DArray", "TextureCube", "Texture3D", "TextureDepth2D", "Texture2DMS":
+				tt := textureTypes[t.Name]
+				bind(p, SampledTexture, fmt.Sprintf("var %s: %s;", c.name(p.name), wgslType(tt)))
+				c.env[p.name] = tt
+				continue
+			case "Sampler", "SamplerComparison":
+				bind(p, SamplerBinding, fmt.Sprintf("var %s: %s;", c.name(p.name), samplerTypes[t.Name]))
+				c.env[p.name] = samplerTypes[t.Name]
+				continue
+			}
+			if _, ok := structs[t.Name]; !ok {
+				return nil, fmt.Errorf("parameter %q: unsupported type %q", p.name, t.Name)
+			}
+			c.env[p.name] = t.Name
+			if stage == StageFragment && !stageIn {
+				// The first struct parameter of a fragment kernel is the
+				// interpolated vertex output.
+				io[t.Name], stageIn = true, true
+				entry = append(entry, fmt.Sprintf("%s: %s", c.name(p.name), t.Name))
+				continue
+			}
+			bind(p, UniformBuffer, fmt.Sprintf("var<uniform> %s: %s;", c.name(p.name), t.Name))
+		default:
+			return nil, fmt.Errorf("parameter %q: unsupported parameter type", p.name)
+		}
+	}
+
+	ret := ""
+	if stage == StageCompute {
+		if fn.Type.Results != nil {
+			return nil, fmt.Errorf("compute kernels cannot return a value")
+		}
+	} else {
+		kw := map[Stage]string{StageVertex: "vertex", StageFragment: "fragment"}[stage]
+		if fn.Type.Results == nil || len(fn.Type.Results.List) != 1 {
+			return nil, fmt.Errorf("%s kernel must return exactly one value", kw)
+		}
+		rt, _ := identType(fn.Type.Results.List[0].Type)
+		if mt, ok := goToMSLType(rt); ok && mt == "float4" {
+			attr := "@location(0)"
+			if stage == StageVertex {
+				attr = "@builtin(position)"
+			}
+			ret = fmt.Sprintf(" -> %s %s", attr, c.typ(mt))
+		} else if _, ok := structs[rt]; ok {
+			// a vertex kernel's varyings, or a fragment kernel's colors
+			io[rt] = true
+			ret = " -> " + rt
+		} else {
+			return nil, fmt.Errorf("unsupported return type %q", rt)
+		}
+	}
+
+	for _, sv := range sharedOf(fn, shared) {
+		decls = append(decls, c.sharedDeclText(sv))
+		c.env[sv.name] = sv.elem + "*"
+	}
+	if err := c.stmts(fn.Body.List, 1); err != nil {
+		return nil, err
+	}
+
+	var src strings.Builder
+	for _, name := range usedStructs(structs, append([]ast.Node{fn}, funcNodes(helpers)...)...) {
+		if err := c.emitStructWGSL(&src, name, structs[name], io[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range decls {
+		src.WriteString(d + "\n")
+	}
+	if len(decls) > 0 {
+		src.WriteString("\n")
+	}
+	for _, h := range helpers {
+		if err := c.emitHelper(&src, h); err != nil {
+			return nil, fmt.Errorf("func %s: %w", h.Name.Name, err)
+		}
+	}
+	attr := map[Stage]string{StageVertex: "@vertex", StageFragment: "@fragment"}[stage]
+	if stage == StageCompute {
+		size, _, _ := workgroupSize(fn.Doc)
+		attr = fmt.Sprintf("@compute @workgroup_size(%d)", size[0])
+		if size[1] > 1 || size[2] > 1 {
+			attr = fmt.Sprintf("@compute @workgroup_size(%d, %d, %d)", size[0], size[1], size[2])
+		}
+	}
+	fmt.Fprintf(&src, "%s\nfn %s(%s)%s {\n%s}\n", attr, c.name(fn.Name.Name), strings.Join(entry, ", "), ret, c.buf.String())
+
+	return &Kernel{Name: fn.Name.Name, Stage: stage, Bindings: bindings, WGSL: src.String()}, nil
+}
+
+// varSpecWGSL emits one var declaration. WGSL zero-initializes `var x: T;`,
+// and infers the type of `var x = v;` from v, as Go does.
+func (c *compiler) varSpecWGSL(vs *ast.ValueSpec, depth int) error {
+	mt := ""
+	if vs.Type != nil {
+		gt, ok := identType(vs.Type)
+		if !ok {
+			return fmt.Errorf("unsupported var type")
+		}
+		if m, ok := goToMSLType(gt); ok {
+			mt = m
+		} else if _, ok := c.structs[gt]; ok {
+			mt = gt
+		} else {
+			return fmt.Errorf("unsupported var type %q", gt)
+		}
+	}
+	for i, name := range vs.Names {
+		v := ""
+		if i < len(vs.Values) {
+			var err error
+			if v, err = c.expr(vs.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.indent(depth)
+		switch {
+		case mt == "":
+			c.env[name.Name] = c.inferType(vs.Values[i])
+			fmt.Fprintf(&c.buf, "var %s = %s;\n", c.name(name.Name), v)
+		case v == "":
+			c.env[name.Name] = mt
+			fmt.Fprintf(&c.buf, "var %s: %s;\n", c.name(name.Name), c.typ(mt))
+		default:
+			c.env[name.Name] = mt
+			fmt.Fprintf(&c.buf, "var %s: %s = %s;\n", c.name(name.Name), c.typ(mt), v)
+		}
+	}
+	return nil
+}
+
+// emitStructWGSL declares struct name. An io struct, one carrying a vertex
+// kernel's outputs, a fragment kernel's inputs or its colors, gets the
+// position built-in on its `gpu:"position"` field and the next location on
+// each other field, numbered the same on both sides; integer varyings are
+// flat.
+func (c *compiler) emitStructWGSL(w *strings.Builder, name string, st *ast.StructType, io bool) error {
+	fmt.Fprintf(w, "struct %s {\n", name)
+	loc, hasPos := 0, false
+	for _, f := range st.Fields.List {
+		ft, ok := identType(f.Type)
+		if !ok {
+			return fmt.Errorf("struct %s: unsupported field type", name)
+		}
+		mt, ok := goToMSLType(ft)
+		if !ok {
+			if _, ok := c.structs[ft]; !ok {
+				return fmt.Errorf("struct %s: unsupported field type %q", name, ft)
+			}
+			mt = ft
+		}
+		if io && !isIntType(mt) && mt != "float" && !isVecType(mt) {
+			return fmt.Errorf("struct %s: varying of type %q", name, ft)
+		}
+		pos := f.Tag != nil && reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("gpu") == "position"
+		for _, n := range f.Names {
+			attr := ""
+			switch {
+			case !io:
+			case pos:
+				attr = "@builtin(position) "
+				hasPos = true
+			default:
+				attr = fmt.Sprintf("@location(%d) ", loc)
+				if isIntType(mt) {
+					attr += "@interpolate(flat) "
+				}
+				loc++
+			}
+			fmt.Fprintf(w, "    %s%s: %s,\n", attr, n.Name, c.typ(mt))
+		}
+	}
+	if io && c.stage == StageVertex && !hasPos {
+		return fmt.Errorf("struct %s: a vertex output needs a `gpu:\"position\"` field", name)
+	}
+	w.WriteString("}\n\n")
+	return nil
+}
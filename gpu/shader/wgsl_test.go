@@ -0,0 +1,206 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	kernelpkg "poly.red/gpu/shader/gpumath/kernels"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden WGSL files in testdata/wgsl")
+
+// texturedKernelSrc covers what the other fixtures do not: an instanced
+// vertex kernel with a flat integer varying and a keyed literal that leaves a
+// field zero, and a fragment kernel sampling a texture.
+const texturedKernelSrc = `
+package kernels
+
+type Vec2 struct{ X, Y float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type VOut struct {
+	Pos  Vec4 ` + "`gpu:\"position\"`" + `
+	UV   Vec2
+	Tint Vec4
+	Mat  uint
+}
+
+type Params struct {
+	Scale float32
+	Shift uint
+}
+
+//gpu:vertex
+func VTex(vid int, iid int, pos []float32, p Params) VOut {
+	x := pos[vid*2] * p.Scale
+	y := pos[vid*2+1] * p.Scale
+	return VOut{Pos: Vec4{x, y, 0, 1}, UV: Vec2{x, y}, Mat: uint(iid) << p.Shift}
+}
+
+//gpu:fragment
+func FTex(in VOut, tex Texture2D, samp Sampler) Vec4 {
+	var c Vec4 = tex.Sample(samp, in.UV)
+	if in.Mat&1 == 1 {
+		c = c * in.Tint
+	}
+	return c
+}
+`
+
+// wgslCorpus is the source of every kernel with a golden file.
+var wgslCorpus = map[string]string{
+	"deferred":  kernelpkg.ShadeSrc,
+	"shadow":    kernelpkg.ShadowSrc,
+	"ao":        kernelpkg.AOSrc,
+	"srgb":      kernelpkg.SRGBSrc,
+	"quantize":  kernelpkg.QuantizeSrc,
+	"matrix":    kernels,
+	"uniform":   uniformSceneKernelSrc,
+	"vertfrag":  vertFragKernelSrc,
+	"textured":  texturedKernelSrc,
+	"helpers":   helperKernelSrc,
+	"workgroup": workgroupKernelSrc,
+	"typed":     typedBufferKernelSrc,
+}
+
+// TestCompileWGSLGolden compares the WGSL emitted for the kernel corpus with
+// testdata/wgsl/<corpus>_<kernel>.wgsl, so changes to the output show up in
+// review. Run with -update to rewrite the files.
+func TestCompileWGSLGolden(t *testing.T) {
+	for name, src := range wgslCorpus {
+		ks, err := CompileWGSL(src)
+		if err != nil {
+			t.Fatalf("compile %s: %v", name, err)
+		}
+		for kn, k := range ks {
+			if k.MSL != "" || k.GLSL != "" || k.SPIRV != nil {
+				t.Fatalf("%s: CompileWGSL set another target", kn)
+			}
+			path := filepath.Join("testdata", "wgsl", name+"_"+kn+".wgsl")
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(k.WGSL), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if k.WGSL != string(want) {
+				t.Errorf("%s: WGSL differs from %s (run with -update to accept):\n%s", kn, path, k.WGSL)
+			}
+		}
+	}
+}
+
+// TestCompileWGSLBindings checks that every kernel's @group/@binding
+// declarations are the layout Kernel.Bindings reports: one sequential space
+// in group 0 covering buffers, textures and samplers alike.
+func TestCompileWGSLBindings(t *testing.T) {
+	decl := regexp.MustCompile(`(?m)^@group\((\d+)\) @binding\((\d+)\) var(<[a-z_, ]+>)? (\w+):`)
+	kinds := map[string]BindingKind{
+		"<storage, read>": StorageBuffer, "<storage, read_write>": StorageBuffer,
+		"<uniform>": UniformBuffer,
+	}
+	for name, src := range wgslCorpus {
+		ks, err := CompileWGSL(src)
+		if err != nil {
+			t.Fatalf("compile %s: %v", name, err)
+		}
+		for kn, k := range ks {
+			var got []Binding
+			for _, m := range decl.FindAllStringSubmatch(k.WGSL, -1) {
+				if m[1] != "0" {
+					t.Fatalf("%s: %s bound in group %s, want 0", kn, m[4], m[1])
+				}
+				idx, _ := strconv.Atoi(m[2])
+				kind, ok := kinds[m[3]]
+				if !ok {
+					kind = SampledTexture
+					if strings.Contains(k.WGSL, m[4]+": sampler;") {
+						kind = SamplerBinding
+					}
+				}
+				got = append(got, Binding{Index: idx, Name: strings.TrimSuffix(m[4], "_"), Kind: kind})
+			}
+			want := k.SortedBindings()
+			sort.Slice(got, func(i, j int) bool { return got[i].Index < got[j].Index })
+			if len(got) != len(want) {
+				t.Fatalf("%s: WGSL declares %+v, Bindings = %+v", kn, got, want)
+			}
+			for i := range want {
+				got[i].MinSize = want[i].MinSize // WGSL declarations are unsized
+				if got[i] != want[i] || want[i].Index != i {
+					t.Fatalf("%s: binding %d is %+v in WGSL, %+v in Bindings", kn, i, got[i], want[i])
+				}
+			}
+		}
+	}
+
+	ks, err := CompileWGSL(texturedKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"@builtin(vertex_index) _vid: u32, @builtin(instance_index) _iid: u32",
+		"@location(2) @interpolate(flat) Mat: u32,",
+		"vec4<f32>()", // the Tint the vertex kernel leaves out
+		"<< u32(p.Shift)",
+	} {
+		if !strings.Contains(ks["VTex"].WGSL, want) {
+			t.Fatalf("VTex WGSL lacks %q:\n%s", want, ks["VTex"].WGSL)
+		}
+	}
+	if !strings.Contains(ks["FTex"].WGSL, "textureSample(tex, samp, in.UV)") {
+		t.Fatalf("FTex WGSL does not sample with textureSample:\n%s", ks["FTex"].WGSL)
+	}
+}
+
+// TestCompileWGSLRejectsUnsupported verifies the WGSL emitter reports what it
+// cannot compile instead of emitting an invalid module.
+func TestCompileWGSLRejectsUnsupported(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{
+			name: "compute return",
+			src: `package k
+func K(gid uint, out []float32) float32 { return out[gid] }`,
+			want: "cannot return",
+		},
+		{
+			name: "vertex output without position",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct{ Color Vec4 }
+//gpu:vertex
+func V(vid uint) VOut { return VOut{Vec4{0, 0, 0, 1}} }`,
+			want: "position",
+		},
+		{
+			name: "undefined",
+			src: `package k
+func K(gid uint, out []float32) { out[gid] = missing }`,
+			want: "undefined identifier",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileWGSL(tc.src)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
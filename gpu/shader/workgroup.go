@@ -0,0 +1,367 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Workgroups: a compute kernel marked //gpu:workgroup x[,y[,z]] runs in
+// workgroups of x*y*z invocations that share the memory package-level
+// `var name = Shared[T](n)` declarations allocate and meet at
+// WorkgroupBarrier(). Such a kernel may take, after the id, the invocation's
+// index in its workgroup and the workgroup's index as integer parameters.
+// AtomicAddU32/AtomicMinU32/AtomicMaxU32 update an element of a []uint32
+// buffer or Shared array atomically; the compiler declares what they update
+// as atomic, so plain reads and writes of it become atomic loads and stores
+// where the target requires. See gpumath/workgroup.go for the CPU side.
+
+// maxWorkgroup bounds a workgroup to the limits every backend meets (those
+// of WebGPU): 256 invocations, at most 256x256x64.
+var maxWorkgroup = [3]int{256, 256, 64}
+
+const maxWorkgroupInvocations = 256
+
+// workgroupSize reads a //gpu:workgroup directive from a func's doc comment;
+// absent one the workgroup is a single invocation.
+func workgroupSize(doc *ast.CommentGroup) ([3]int, bool, error) {
+	size := [3]int{1, 1, 1}
+	if doc == nil {
+		return size, false, nil
+	}
+	for _, c := range doc.List {
+		arg, ok := strings.CutPrefix(strings.TrimSpace(c.Text), "//gpu:workgroup")
+		if !ok || arg != "" && arg[0] != ' ' {
+			continue
+		}
+		dims := strings.Split(strings.TrimSpace(arg), ",")
+		if len(dims) > 3 {
+			return size, false, fmt.Errorf("//gpu:workgroup takes at most 3 sizes")
+		}
+		total := 1
+		for i, d := range dims {
+			n, err := strconv.Atoi(strings.TrimSpace(d))
+			if err != nil || n < 1 || n > maxWorkgroup[i] {
+				return size, false, fmt.Errorf("//gpu:workgroup size %q is not in 1..%d", strings.TrimSpace(d), maxWorkgroup[i])
+			}
+			size[i] = n
+			total *= n
+		}
+		if total > maxWorkgroupInvocations {
+			return size, false, fmt.Errorf("//gpu:workgroup of %d invocations exceeds %d", total, maxWorkgroupInvocations)
+		}
+		return size, true, nil
+	}
+	return size, false, nil
+}
+
+// sharedVar is workgroup-shared memory: n elements of canonical type elem.
+type sharedVar struct {
+	name string
+	elem string
+	n    int
+}
+
+// sharedDecl parses a package-level var spec of the form
+// `name = Shared[T](n)`; ok is false for any other var.
+func sharedDecl(vs *ast.ValueSpec) (sv sharedVar, ok bool, err error) {
+	if len(vs.Names) != 1 || len(vs.Values) != 1 {
+		return sharedVar{}, false, nil
+	}
+	call, isCall := vs.Values[0].(*ast.CallExpr)
+	if !isCall {
+		return sharedVar{}, false, nil
+	}
+	ix, isIndex := call.Fun.(*ast.IndexExpr)
+	if !isIndex {
+		return sharedVar{}, false, nil
+	}
+	if fn, _ := ix.X.(*ast.Ident); fn == nil || fn.Name != "Shared" {
+		return sharedVar{}, false, nil
+	}
+	name := vs.Names[0].Name
+	gt, _ := identType(ix.Index)
+	elem, isValue := goToMSLType(gt)
+	if !isValue {
+		return sharedVar{}, true, fmt.Errorf("shared %s: element type %q is not a scalar or vector", name, gt)
+	}
+	var lit *ast.BasicLit
+	if len(call.Args) == 1 {
+		lit, _ = call.Args[0].(*ast.BasicLit)
+	}
+	if lit == nil || lit.Kind != token.INT {
+		return sharedVar{}, true, fmt.Errorf("shared %s: the length must be an integer literal", name)
+	}
+	n, err := strconv.Atoi(lit.Value)
+	if err != nil || n < 1 {
+		return sharedVar{}, true, fmt.Errorf("shared %s: invalid length %s", name, lit.Value)
+	}
+	return sharedVar{name: name, elem: elem, n: n}, true, nil
+}
+
+// sharedOf lists the shared variables fn refers to, by name.
+func sharedOf(fn *ast.FuncDecl, shared map[string]sharedVar) []sharedVar {
+	seen := map[string]bool{}
+	var out []sharedVar
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !seen[id.Name] {
+			if sv, ok := shared[id.Name]; ok {
+				seen[id.Name] = true
+				out = append(out, sv)
+			}
+		}
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// atomicOp is an atomic intrinsic's spelling in each target. The MSL and
+// WGSL forms take a pointer to the element, the GLSL form the element.
+type atomicOp struct {
+	msl, glsl, wgsl string
+	spv             uint32
+}
+
+var atomicOps = map[string]atomicOp{
+	"AtomicAddU32": {"atomic_fetch_add_explicit", "atomicAdd", "atomicAdd", spvOpAtomicIAdd},
+	"AtomicMinU32": {"atomic_fetch_min_explicit", "atomicMin", "atomicMin", spvOpAtomicUMin},
+	"AtomicMaxU32": {"atomic_fetch_max_explicit", "atomicMax", "atomicMax", spvOpAtomicUMax},
+}
+
+// atomicTargets reports the buffers and shared arrays the nodes update with
+// atomic intrinsics.
+func atomicTargets(nodes ...ast.Node) map[string]bool {
+	out := map[string]bool{}
+	for _, n := range nodes {
+		ast.Inspect(n, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			if fn, ok := call.Fun.(*ast.Ident); ok && atomicOps[fn.Name] != (atomicOp{}) {
+				if id, ok := call.Args[0].(*ast.Ident); ok {
+					out[id.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	return out
+}
+
+// checkWorkgroup rejects workgroup features outside compute kernels and
+// atomics on anything but the uint32 elements of a buffer or shared array.
+func checkWorkgroup(fn *ast.FuncDecl, stage Stage, shared map[string]sharedVar) error {
+	_, directive, err := workgroupSize(fn.Doc)
+	if err != nil {
+		return err
+	}
+	if stage != StageCompute {
+		if directive {
+			return fmt.Errorf("//gpu:workgroup applies to compute kernels only")
+		}
+		var found string
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.CallExpr:
+				if id, ok := x.Fun.(*ast.Ident); ok && (id.Name == "WorkgroupBarrier" || atomicOps[id.Name] != (atomicOp{})) {
+					found = id.Name
+				}
+			case *ast.Ident:
+				if _, ok := shared[x.Name]; ok {
+					found = "shared memory"
+				}
+			}
+			return found == ""
+		})
+		if found != "" {
+			return fmt.Errorf("%s is available in compute kernels only", found)
+		}
+	}
+	elem := map[string]string{}
+	for _, sv := range shared {
+		elem[sv.name] = sv.elem
+	}
+	for _, p := range flattenParams(fn.Type.Params) {
+		if at, ok := p.typ.(*ast.ArrayType); ok {
+			gt, _ := identType(at.Elt)
+			elem[p.name], _ = goToMSLType(gt)
+		}
+	}
+	for name := range atomicTargets(fn.Body) {
+		if elem[name] != "uint" {
+			return fmt.Errorf("atomics update []uint32 buffers and shared arrays, not %q", name)
+		}
+	}
+	return nil
+}
+
+// workgroupIDs splits the workgroup id parameters off the front of a compute
+// kernel's parameters (those after the global id): up to two integers, the
+// index in the workgroup and the workgroup's index.
+func workgroupIDs(params []param) (ids, rest []param) {
+	for len(ids) < 2 && len(params) > 0 {
+		t, ok := identType(params[0].typ)
+		if !ok || !isIntType(t) {
+			break
+		}
+		ids = append(ids, params[0])
+		params = params[1:]
+	}
+	return ids, params
+}
+
+// workgroupCall compiles the workgroup intrinsics; ok is false for any other
+// call.
+func (c *compiler) workgroupCall(name string, args []ast.Expr) (v string, ok bool, err error) {
+	if name == "WorkgroupBarrier" {
+		if len(args) != 0 {
+			return "", true, fmt.Errorf("WorkgroupBarrier takes no arguments")
+		}
+		switch c.tgt {
+		case targetGLSL:
+			return "barrier()", true, nil
+		case targetWGSL:
+			return "workgroupBarrier()", true, nil
+		}
+		return "threadgroup_barrier(mem_flags::mem_threadgroup)", true, nil
+	}
+	op, ok := atomicOps[name]
+	if !ok {
+		return "", false, nil
+	}
+	if len(args) != 3 {
+		return "", true, fmt.Errorf("%s takes 3 arguments, got %d", name, len(args))
+	}
+	buf, isIdent := args[0].(*ast.Ident)
+	if !isIdent {
+		return "", true, fmt.Errorf("%s updates a buffer or shared array", name)
+	}
+	if _, known := c.env[buf.Name]; !known {
+		return "", true, fmt.Errorf("undefined identifier %q", buf.Name)
+	}
+	i, err := c.expr(args[1])
+	if err != nil {
+		return "", true, err
+	}
+	x, err := c.expr(args[2])
+	if err != nil {
+		return "", true, err
+	}
+	elem := fmt.Sprintf("%s[%s]", c.name(buf.Name), i)
+	switch c.tgt {
+	case targetGLSL:
+		return fmt.Sprintf("%s(%s, %s)", op.glsl, elem, c.coerce(args[2], x, "uint")), true, nil
+	case targetWGSL:
+		return fmt.Sprintf("%s(&%s, %s)", op.wgsl, elem, x), true, nil
+	}
+	return fmt.Sprintf("%s(&%s, %s, memory_order_relaxed)", op.msl, elem, x), true, nil
+}
+
+// atomicLoad and atomicStore spell a plain read or write of an element of an
+// atomic buffer or shared array: MSL and WGSL only access atomics through
+// functions.
+func (c *compiler) atomicLoad(elem string) string {
+	switch c.tgt {
+	case targetMSL:
+		return fmt.Sprintf("atomic_load_explicit(&%s, memory_order_relaxed)", elem)
+	case targetWGSL:
+		return fmt.Sprintf("atomicLoad(&%s)", elem)
+	}
+	return elem
+}
+
+func (c *compiler) atomicStore(elem, v string) string {
+	switch c.tgt {
+	case targetMSL:
+		return fmt.Sprintf("atomic_store_explicit(&%s, %s, memory_order_relaxed)", elem, v)
+	case targetWGSL:
+		return fmt.Sprintf("atomicStore(&%s, %s)", elem, v)
+	}
+	return elem + " = " + v
+}
+
+// sharedDeclText declares shared array sv in the target language.
+func (c *compiler) sharedDeclText(sv sharedVar) string {
+	elem := c.typ(sv.elem)
+	atomic := c.atomic[sv.name]
+	switch c.tgt {
+	case targetGLSL:
+		return fmt.Sprintf("shared %s %s[%d];", elem, c.name(sv.name), sv.n)
+	case targetWGSL:
+		if atomic {
+			elem = "atomic<u32>"
+		}
+		return fmt.Sprintf("var<workgroup> %s: array<%s, %d>;", c.name(sv.name), elem, sv.n)
+	}
+	if atomic {
+		elem = "atomic_uint"
+	}
+	return fmt.Sprintf("threadgroup %s %s[%d];", elem, sv.name, sv.n)
+}
+
+// shared declares shared array sv as a Workgroup variable.
+func (c *spvCompiler) shared(sv sharedVar) error {
+	m := c.m
+	et, err := m.typ(sv.elem)
+	if err != nil {
+		return fmt.Errorf("shared %s: %w", sv.name, err)
+	}
+	arr := m.cached(fmt.Sprintf("arr:%s:%d", sv.elem, sv.n), func(id uint32) {
+		spvInst(&m.globals, spvOpTypeArray, id, et, m.intConst(int32(sv.n)))
+	})
+	id := c.global(spvStorageWorkgroup, arr)
+	spvInst(&m.names, spvOpName, append([]uint32{id}, spvString(sv.name)...)...)
+	c.define(sv.name, &spvVar{kind: spvShared, id: id, typ: sv.elem})
+	return nil
+}
+
+// workgroupCall compiles the workgroup intrinsics; ok is false for any other
+// call. Atomics are relaxed, at device scope on buffers and workgroup scope
+// on shared arrays; the barrier also orders workgroup memory.
+func (c *spvCompiler) workgroupCall(name string, args []ast.Expr) (v spvVal, ok bool, err error) {
+	m := c.m
+	if name == "WorkgroupBarrier" {
+		if len(args) != 0 {
+			return spvVal{}, true, fmt.Errorf("WorkgroupBarrier takes no arguments")
+		}
+		scope := m.intConst(spvScopeWorkgroup)
+		c.emit(spvOpControlBarrier, scope, scope, m.intConst(spvSemanticsAcquireRelease|spvSemanticsWorkgroupMemory))
+		return spvVal{}, true, nil
+	}
+	op, ok := atomicOps[name]
+	if !ok {
+		return spvVal{}, false, nil
+	}
+	if len(args) != 3 {
+		return spvVal{}, true, fmt.Errorf("%s takes 3 arguments, got %d", name, len(args))
+	}
+	buf, isIdent := args[0].(*ast.Ident)
+	if !isIdent {
+		return spvVal{}, true, fmt.Errorf("%s updates a buffer or shared array", name)
+	}
+	ptr, _, err := c.pointer(&ast.IndexExpr{X: buf, Index: args[1]}, true)
+	if err != nil {
+		return spvVal{}, true, err
+	}
+	x, err := c.expr(args[2], "uint")
+	if err != nil {
+		return spvVal{}, true, err
+	}
+	if x, err = c.convert(x, "uint"); err != nil {
+		return spvVal{}, true, err
+	}
+	scope := int32(spvScopeDevice)
+	if v, _ := c.lookup(buf.Name); v.kind == spvShared {
+		scope = spvScopeWorkgroup
+	}
+	return spvVal{c.op(op.spv, m.mustTyp("uint"), ptr, m.intConst(scope), m.intConst(0), x.id), "uint"}, true, nil
+}
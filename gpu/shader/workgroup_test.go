@@ -0,0 +1,225 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shader
+
+import (
+	"strings"
+	"testing"
+)
+
+// workgroupKernelSrc is a tree reduction over shared memory and a histogram
+// counting into shared atomic bins before merging them into a buffer.
+const workgroupKernelSrc = `
+package kernels
+
+var tile = Shared[float32](64)
+var bins = Shared[uint32](16)
+
+//gpu:workgroup 64
+func Sum(gid, lid, wid uint, in []float32, out []float32) {
+	tile[lid] = in[gid]
+	WorkgroupBarrier()
+	for s := uint(32); s > 0; s = s / 2 {
+		if lid < s {
+			tile[lid] = tile[lid] + tile[lid+s]
+		}
+		WorkgroupBarrier()
+	}
+	if lid == 0 {
+		out[wid] = tile[0]
+	}
+}
+
+//gpu:workgroup 64
+func Hist(gid, lid uint, in []float32, hist []uint32) {
+	if lid < 16 {
+		bins[lid] = 0
+	}
+	WorkgroupBarrier()
+	b := uint(clamp(in[gid]*16.0, 0.0, 15.0))
+	AtomicAddU32(bins, b, 1)
+	AtomicMaxU32(hist, 16, b)
+	WorkgroupBarrier()
+	if lid < 16 {
+		AtomicAddU32(hist, lid, bins[lid])
+	}
+}
+`
+
+// TestCompileWorkgroup checks the lowering of shared memory, barriers and
+// atomics in the text targets.
+func TestCompileWorkgroup(t *testing.T) {
+	want := map[string][]string{
+		"MSL": {
+			"uint lid [[thread_index_in_threadgroup]]",
+			"uint wid [[threadgroup_position_in_grid]]",
+			"threadgroup float tile[64];",
+			"threadgroup_barrier(mem_flags::mem_threadgroup);",
+			"device atomic_uint* hist [[buffer(1)]]",
+			"threadgroup atomic_uint bins[16];",
+			"atomic_store_explicit(&bins[lid], 0, memory_order_relaxed);",
+			"atomic_fetch_max_explicit(&hist[16], b, memory_order_relaxed);",
+			"atomic_load_explicit(&bins[lid], memory_order_relaxed)",
+		},
+		"GLSL": {
+			"layout(local_size_x = 64) in;",
+			"uint lid = gl_LocalInvocationIndex;",
+			"uint wid = gl_WorkGroupID.x;",
+			"shared float tile[64];",
+			"barrier();",
+			"shared uint bins[16];",
+			"atomicAdd(bins[b], uint(1));",
+			"atomicAdd(hist[lid], bins[lid]);",
+		},
+		"WGSL": {
+			"var<workgroup> tile: array<f32, 64>;",
+			"@compute @workgroup_size(64)",
+			"@builtin(local_invocation_index) _lid: u32, @builtin(workgroup_id) _wid: vec3<u32>",
+			"workgroupBarrier();",
+			"var<storage, read_write> hist: array<atomic<u32>>;",
+			"var<workgroup> bins: array<atomic<u32>, 16>;",
+			"atomicAdd(&hist[lid], atomicLoad(&bins[lid]));",
+		},
+	}
+	text := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "WGSL": CompileWGSL,
+	}
+	for lang, compile := range text {
+		ks, err := compile(workgroupKernelSrc)
+		if err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		var src string
+		for _, name := range []string{"Sum", "Hist"} {
+			if ks[name].Workgroup != [3]int{64, 1, 1} {
+				t.Fatalf("%s: %s.Workgroup = %v, want [64 1 1]", lang, name, ks[name].Workgroup)
+			}
+			src += ks[name].MSL + ks[name].GLSL + ks[name].WGSL
+		}
+		for _, w := range want[lang] {
+			if !strings.Contains(src, w) {
+				t.Errorf("%s: missing %q in:\n%s", lang, w, src)
+			}
+		}
+		if lang != "MSL" && strings.Contains(ks["Sum"].MSL+ks["Sum"].GLSL+ks["Sum"].WGSL, "bins") {
+			t.Errorf("%s: Sum declares shared memory it does not use", lang)
+		}
+	}
+
+	// Kernels without the directive keep one invocation per workgroup.
+	gl, err := CompileGLSL(helperKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := gl["Lit"]; k.Workgroup != [3]int{} || !strings.Contains(k.GLSL, "layout(local_size_x = 1) in;") {
+		t.Fatalf("Lit: Workgroup = %v, GLSL:\n%s", k.Workgroup, k.GLSL)
+	}
+}
+
+// TestCompileWorkgroupSPIRV checks the workgroup size, shared arrays, barriers
+// and atomics of the SPIR-V kernels.
+func TestCompileWorkgroupSPIRV(t *testing.T) {
+	ks, err := CompileSPIRV(workgroupKernelSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]struct{ barriers, atomics int }{
+		"Sum": {barriers: 2}, "Hist": {barriers: 2, atomics: 3},
+	} {
+		var localSize []uint32
+		var barriers, atomics, workgroupVars int
+		for _, in := range decodeSPIRV(t, name, ks[name].SPIRV) {
+			switch in.op {
+			case spvOpExecutionMode:
+				if in.operands[1] == spvModeLocalSize {
+					localSize = in.operands[2:]
+				}
+			case spvOpControlBarrier:
+				barriers++
+			case spvOpAtomicIAdd, spvOpAtomicUMax:
+				atomics++
+			case spvOpVariable:
+				if in.operands[2] == spvStorageWorkgroup {
+					workgroupVars++
+				}
+			}
+		}
+		if len(localSize) != 3 || localSize[0] != 64 || localSize[1] != 1 || localSize[2] != 1 {
+			t.Errorf("%s: LocalSize = %v, want 64 1 1", name, localSize)
+		}
+		if barriers != want.barriers || atomics != want.atomics || workgroupVars != 1 {
+			t.Errorf("%s: %d barriers, %d atomics, %d workgroup variables; want %d, %d, 1",
+				name, barriers, atomics, workgroupVars, want.barriers, want.atomics)
+		}
+	}
+}
+
+// TestCompileWorkgroupRejected checks the misuses every target reports.
+func TestCompileWorkgroupRejected(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{
+			name: "vertex directive",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct{ Pos Vec4 ` + "`gpu:\"position\"`" + ` }
+//gpu:vertex
+//gpu:workgroup 64
+func V(vid uint) VOut { return VOut{Vec4{0, 0, 0, 1}} }`,
+			want: "applies to compute kernels only",
+		},
+		{
+			name: "fragment shared memory",
+			src: `package k
+type Vec4 struct{ X, Y, Z, W float32 }
+var tile = Shared[float32](4)
+//gpu:fragment
+func F(pos Vec4) Vec4 { return Vec4{tile[0], 0, 0, 1} }`,
+			want: "shared memory is available in compute kernels only",
+		},
+		{
+			name: "float atomic",
+			src: `package k
+func K(gid uint, out []float32) { AtomicAddU32(out, gid, 1) }`,
+			want: `not "out"`,
+		},
+		{
+			name: "too many invocations",
+			src: `package k
+//gpu:workgroup 32, 16
+func K(gid uint, out []float32) { out[gid] = 1 }`,
+			want: "512 invocations exceeds 256",
+		},
+		{
+			name: "bad size",
+			src: `package k
+//gpu:workgroup 0
+func K(gid uint, out []float32) { out[gid] = 1 }`,
+			want: `size "0" is not in 1..256`,
+		},
+		{
+			name: "variable length",
+			src: `package k
+const n = 8
+var tile = Shared[float32](n)
+func K(gid uint, out []float32) { out[gid] = tile[0] }`,
+			want: "the length must be an integer literal",
+		},
+	}
+	compilers := map[string]func(string) (map[string]*Kernel, error){
+		"MSL": Compile, "GLSL": CompileGLSL, "SPIR-V": CompileSPIRV, "WGSL": CompileWGSL,
+	}
+	for _, tc := range cases {
+		for lang, compile := range compilers {
+			t.Run(tc.name+"/"+lang, func(t *testing.T) {
+				_, err := compile(tc.src)
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,669 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Conformance of the software driver, which needs no system library: the
+// render and texture tests the GL and Metal backends have, written with Go
+// kernels. Its storage is top-down and its depth range [0, 1], as on Metal.
+package gpu_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+	"unsafe"
+
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// softwareKernels are the kernels of the software render tests. V reads a
+// vertex's position and color, VI offsets instance iid by iid to the right
+// and colors it by the instance, and F returns the color it is passed.
+const softwareKernels = `package kernels
+type Vec4 struct{ X, Y, Z, W float32 }
+type VOut struct {
+	Pos   Vec4 ` + "`gpu:\"position\"`" + `
+	Color Vec4
+}
+
+//gpu:vertex
+func V(vid uint, pos []float32, col []float32) VOut {
+	return VOut{
+		Pos:   Vec4{pos[vid*3], pos[vid*3+1], pos[vid*3+2], 1},
+		Color: Vec4{col[vid*4], col[vid*4+1], col[vid*4+2], col[vid*4+3]},
+	}
+}
+
+//gpu:vertex
+func VI(vid uint, iid uint, pos []float32, col []float32) VOut {
+	return VOut{
+		Pos:   Vec4{pos[vid*3] + float32(iid), pos[vid*3+1], pos[vid*3+2], 1},
+		Color: Vec4{col[iid*4], col[iid*4+1], col[iid*4+2], col[iid*4+3]},
+	}
+}
+
+//gpu:fragment
+func F(in VOut) Vec4 { return in.Color }
+
+func Samples(gid uint, tex Texture2DMS, out []float32) {
+	x := int(gid % 16)
+	y := int(gid / 16)
+	out[gid*4] = tex.Load(x, y, 0).X
+	out[gid*4+1] = tex.Load(x, y, 1).X
+	out[gid*4+2] = tex.Load(x, y, 2).X
+	out[gid*4+3] = tex.Load(x, y, 3).X
+}
+`
+
+// softwareDevice opens the software driver, which every machine has.
+func softwareDevice(t *testing.T) *gpu.Device {
+	t.Helper()
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	t.Cleanup(func() { dev.Close() })
+	return dev
+}
+
+// softwareModule compiles entry of src for the CPU and returns its module.
+func softwareModule(t *testing.T, dev *gpu.Device, src, entry string) *gpu.ShaderModule {
+	t.Helper()
+	ks, err := shader.CompileCPU(src)
+	if err != nil {
+		t.Fatalf("CompileCPU: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks[entry])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel(%s): %v", entry, err)
+	}
+	return mod
+}
+
+// softwareBuffer returns a storage buffer holding d.
+func softwareBuffer(t *testing.T, dev *gpu.Device, d []float32) *gpu.Buffer {
+	t.Helper()
+	b, err := dev.NewBuffer(gpu.BufferDescriptor{Data: parityBytes(d), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	return b
+}
+
+// softwareTarget returns a render target of format f.
+func softwareTarget(t *testing.T, dev *gpu.Device, f gpu.TextureFormat, w, h, samples int) *gpu.Texture {
+	t.Helper()
+	tex, err := dev.NewTexture(gpu.TextureDescriptor{Format: f, Width: w, Height: h, RenderTarget: true, SampleCount: samples})
+	if err != nil {
+		t.Fatalf("NewTexture: %v", err)
+	}
+	return tex
+}
+
+// softwarePipeline returns a pipeline of the vertex kernel ventry and F.
+func softwarePipeline(t *testing.T, dev *gpu.Device, ventry string, desc gpu.RenderPipelineDescriptor) *gpu.RenderPipeline {
+	t.Helper()
+	desc.VertexModule, desc.VertexEntry = softwareModule(t, dev, softwareKernels, ventry), ventry
+	desc.FragmentModule, desc.FragmentEntry = softwareModule(t, dev, softwareKernels, "F"), "F"
+	if desc.ColorFormat == 0 {
+		desc.ColorFormat = gpu.RGBA8Unorm
+	}
+	pipe, err := dev.NewRenderPipeline(desc)
+	if err != nil {
+		t.Fatalf("NewRenderPipeline: %v", err)
+	}
+	return pipe
+}
+
+// submit finishes enc, submits it and waits for it.
+func submit(dev *gpu.Device, enc *gpu.CommandEncoder) {
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+}
+
+// rgbaAt returns pixel (x, y) of an RGBA8 image w pixels wide.
+func rgbaAt(pix []byte, w, x, y int) [4]uint8 {
+	i := (y*w + x) * 4
+	return [4]uint8{pix[i], pix[i+1], pix[i+2], pix[i+3]}
+}
+
+func TestSoftwareOpen(t *testing.T) {
+	dev := softwareDevice(t)
+	if d := dev.Driver(); d != gpu.DriverSoftware || d.String() != "software" {
+		t.Errorf("Driver() = %v, want software", d)
+	}
+	if _, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: "void main() {}"}); err == nil {
+		t.Errorf("a GLSL-only module compiled on the software driver")
+	}
+	ks, err := shader.Compile(softwareKernels)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if _, err := dev.NewShaderModuleFromKernel(ks["F"]); err == nil {
+		t.Errorf("a kernel without a CPU program made a software module")
+	}
+}
+
+// TestSoftwareRenderDepth draws a near red and a far green full-screen
+// triangle in both orders: the near one wins either way.
+func TestSoftwareRenderDepth(t *testing.T) {
+	dev := softwareDevice(t)
+	pipe := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{DepthFormat: gpu.Depth32Float})
+	tri := func(z float32) *gpu.Buffer { return softwareBuffer(t, dev, []float32{-1, -1, z, 3, -1, z, -1, 3, z}) }
+	near, far := tri(0.2), tri(0.8)
+	red := softwareBuffer(t, dev, []float32{1, 0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 1})
+	green := softwareBuffer(t, dev, []float32{0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1})
+
+	const W, H = 16, 16
+	for _, firstFar := range []bool{true, false} {
+		color := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 1)
+		depth := softwareTarget(t, dev, gpu.Depth32Float, W, H, 1)
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+			ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 1, 1},
+			DepthTexture: depth, ClearDepth: 1,
+		})
+		rp.SetPipeline(pipe)
+		draws := [][2]*gpu.Buffer{{near, red}, {far, green}}
+		if firstFar {
+			draws[0], draws[1] = draws[1], draws[0]
+		}
+		for _, d := range draws {
+			rp.SetVertexBuffer(0, d[0])
+			rp.SetVertexBuffer(1, d[1])
+			rp.Draw(gpu.TriangleList, 0, 3)
+		}
+		rp.End()
+		submit(dev, enc)
+		for _, p := range [][2]int{{0, 0}, {W / 2, H / 2}, {W - 1, H - 1}} {
+			if got := rgbaAt(color.ReadPixels(), W, p[0], p[1]); got != [4]uint8{255, 0, 0, 255} {
+				t.Errorf("firstFar=%v: pixel %v = %v, want red", firstFar, p, got)
+			}
+		}
+		d := parityFloats(depth.ReadPixels(), W*H)
+		if math.Abs(float64(d[H/2*W+W/2])-0.2) > 1e-6 {
+			t.Errorf("firstFar=%v: depth = %v, want 0.2", firstFar, d[H/2*W+W/2])
+		}
+	}
+}
+
+// TestSoftwareRenderState checks culling, blending, the color write mask,
+// indexed and instanced draws, and that two triangles sharing an edge cover
+// each pixel on it exactly once.
+func TestSoftwareRenderState(t *testing.T) {
+	dev := softwareDevice(t)
+	const W, H = 16, 16
+	color := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 1)
+	run := func(pipe *gpu.RenderPipeline, draw func(rp *gpu.RenderPass)) []byte {
+		enc := dev.NewCommandEncoder()
+		rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1}})
+		rp.SetPipeline(pipe)
+		draw(rp)
+		rp.End()
+		submit(dev, enc)
+		return color.ReadPixels()
+	}
+	// A full-screen quad of two triangles, counter-clockwise, and the same
+	// quad wound clockwise.
+	quad := softwareBuffer(t, dev, []float32{-1, -1, 0, 1, -1, 0, 1, 1, 0, -1, -1, 0, 1, 1, 0, -1, 1, 0})
+	cw := softwareBuffer(t, dev, []float32{-1, -1, 0, 1, 1, 0, 1, -1, 0, -1, -1, 0, -1, 1, 0, 1, 1, 0})
+	half := softwareBuffer(t, dev, repeatColor([4]float32{1, 1, 1, 0.5}, 6))
+
+	// Culling: the clockwise quad is a back face.
+	cull := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{CullMode: gpu.CullBack, FrontFace: gpu.FrontCCW})
+	for _, c := range []struct {
+		name string
+		vb   *gpu.Buffer
+		want uint8
+	}{{"front", quad, 255}, {"back", cw, 0}} {
+		pix := run(cull, func(rp *gpu.RenderPass) {
+			rp.SetVertexBuffer(0, c.vb)
+			rp.SetVertexBuffer(1, half)
+			rp.Draw(gpu.TriangleList, 0, 6)
+		})
+		if got := rgbaAt(pix, W, W/2, H/2)[0]; got != c.want {
+			t.Errorf("%s face: red = %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	// Additive blending counts the triangles covering each pixel: every
+	// pixel of the quad, its shared diagonal included, is covered once.
+	add := gpu.BlendState{
+		Color: gpu.BlendComponent{SrcFactor: gpu.BlendSrcAlpha, DstFactor: gpu.BlendOne},
+		Alpha: gpu.BlendComponent{SrcFactor: gpu.BlendZero, DstFactor: gpu.BlendOne},
+	}
+	blend := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{Blend: &add, ColorWriteMask: gpu.ColorWriteRed | gpu.ColorWriteGreen | gpu.ColorWriteAlpha})
+	pix := run(blend, func(rp *gpu.RenderPass) {
+		rp.SetVertexBuffer(0, quad)
+		rp.SetVertexBuffer(1, half)
+		rp.Draw(gpu.TriangleList, 0, 6)
+	})
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			if got := rgbaAt(pix, W, x, y); got != [4]uint8{128, 128, 0, 255} {
+				t.Fatalf("blended pixel (%d, %d) = %v, want [128 128 0 255]: covered once, blue masked", x, y, got)
+			}
+		}
+	}
+
+	// Indexed and instanced: instances 1 and 2 of a quad over the left
+	// half, from an index buffer with a base vertex, land one and two
+	// half-widths to the right: instance 0 is never drawn, instance 1 is
+	// green and instance 2 blue.
+	verts := softwareBuffer(t, dev, []float32{9, 9, 9, -2, -1, 0, -1, -1, 0, -1, 1, 0, -2, 1, 0})
+	cols := softwareBuffer(t, dev, []float32{1, 0, 0, 1, 0, 1, 0, 1, 0, 0, 1, 1})
+	indices := []uint16{0, 1, 2, 0, 2, 3}
+	ibuf, err := dev.NewBuffer(gpu.BufferDescriptor{Data: unsafe.Slice((*byte)(unsafe.Pointer(&indices[0])), 12), Usage: gpu.BufferIndex})
+	if err != nil {
+		t.Fatalf("index buffer: %v", err)
+	}
+	inst := softwarePipeline(t, dev, "VI", gpu.RenderPipelineDescriptor{})
+	pix = run(inst, func(rp *gpu.RenderPass) {
+		rp.SetVertexBuffer(0, verts)
+		rp.SetVertexBuffer(1, cols)
+		rp.SetIndexBuffer(ibuf, gpu.IndexUint16)
+		rp.DrawIndexedInstanced(gpu.TriangleList, 0, 6, 1, 1, 2)
+	})
+	if got := rgbaAt(pix, W, W/4, H/2); got != [4]uint8{0, 255, 0, 255} {
+		t.Errorf("left half = %v, want instance 1's green", got)
+	}
+	if got := rgbaAt(pix, W, 3*W/4, H/2); got != [4]uint8{0, 0, 255, 255} {
+		t.Errorf("right half = %v, want instance 2's blue", got)
+	}
+
+	// The same draw from slices of one pool block, none at its start.
+	pool, err := dev.NewBufferPool(gpu.BufferPoolDescriptor{Usage: gpu.BufferStorage | gpu.BufferIndex})
+	if err != nil {
+		t.Fatalf("NewBufferPool: %v", err)
+	}
+	defer pool.Release()
+	write := func(data []byte) gpu.BufferSlice {
+		s, err := pool.Write(data)
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		return s
+	}
+	write(make([]byte, 4))
+	vs, cs := write(verts.Bytes()), write(cols.Bytes())
+	is := write(ibuf.Bytes())
+	pix = run(inst, func(rp *gpu.RenderPass) {
+		rp.SetVertexSlice(0, vs)
+		rp.SetVertexSlice(1, cs)
+		rp.SetIndexSlice(is, gpu.IndexUint16)
+		rp.DrawIndexedInstanced(gpu.TriangleList, 0, 6, 1, 1, 2)
+	})
+	if got := rgbaAt(pix, W, W/4, H/2); got != [4]uint8{0, 255, 0, 255} {
+		t.Errorf("from pool slices, left half = %v, want instance 1's green", got)
+	}
+	if got := rgbaAt(pix, W, 3*W/4, H/2); got != [4]uint8{0, 0, 255, 255} {
+		t.Errorf("from pool slices, right half = %v, want instance 2's blue", got)
+	}
+}
+
+// repeatColor returns the color c for each of n vertices.
+func repeatColor(c [4]float32, n int) []float32 {
+	var out []float32
+	for i := 0; i < n; i++ {
+		out = append(out, c[:]...)
+	}
+	return out
+}
+
+// TestSoftwareMultisample resolves a 4x multisampled triangle and checks
+// each resolved pixel against the mean of the samples a kernel loads.
+func TestSoftwareMultisample(t *testing.T) {
+	dev := softwareDevice(t)
+	const W, H = 16, 16
+	ms := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 4)
+	resolved := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 1)
+	draw := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{SampleCount: 4})
+	load, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, softwareKernels, "Samples")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: W * H * 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(load.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: ms, ResolveTarget: resolved, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1}})
+	rp.SetPipeline(draw)
+	rp.SetVertexBuffer(0, softwareBuffer(t, dev, []float32{-1, -1, 0, 1, -1, 0, -1, 1, 0}))
+	rp.SetVertexBuffer(1, softwareBuffer(t, dev, []float32{1, 0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 1}))
+	rp.Draw(gpu.TriangleList, 0, 3)
+	rp.End()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(load)
+	cp.SetBindGroup(0, bg)
+	cp.SetTexture(0, ms)
+	cp.Dispatch(W*H, 1, 1)
+	cp.End()
+	submit(dev, enc)
+
+	pix := resolved.ReadPixels()
+	samples := parityFloats(out.Bytes(), W*H*4)
+	partial := 0
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			s := samples[(y*W+x)*4:][:4]
+			mean := (s[0] + s[1] + s[2] + s[3]) / 4
+			got := pix[(y*W+x)*4]
+			if want := math.Round(float64(mean) * 255); math.Abs(float64(got)-want) > 1 {
+				t.Fatalf("resolved red at (%d, %d) = %d, want %v, the mean of samples %v", x, y, got, want, s)
+			}
+			if mean > 0 && mean < 1 {
+				partial++
+			}
+		}
+	}
+	if partial == 0 {
+		t.Errorf("no partly covered pixels along the triangle's edge")
+	}
+}
+
+// TestSoftwareOcclusionQuery counts the samples of a triangle behind and one
+// in front of an occluder, drawn without color writes, and times the pass.
+func TestSoftwareOcclusionQuery(t *testing.T) {
+	dev := softwareDevice(t)
+	const W, H = 16, 16
+	desc := gpu.RenderPipelineDescriptor{DepthFormat: gpu.Depth32Float}
+	pipe := softwarePipeline(t, dev, "V", desc)
+	desc.DepthCompare, desc.ColorWriteMask = gpu.CompareLessEqual, gpu.ColorWriteNone
+	proxy := softwarePipeline(t, dev, "V", desc)
+	occ, err := dev.NewQuerySet(gpu.QuerySetDescriptor{Type: gpu.QueryOcclusion, Count: 3})
+	if err != nil {
+		t.Fatalf("NewQuerySet: %v", err)
+	}
+	ts, err := dev.NewQuerySet(gpu.QuerySetDescriptor{Type: gpu.QueryTimestamp, Count: 2})
+	if err != nil {
+		t.Fatalf("NewQuerySet: %v", err)
+	}
+	tri := func(z float32) *gpu.Buffer { return softwareBuffer(t, dev, []float32{-1, -1, z, 3, -1, z, -1, 3, z}) }
+	red := softwareBuffer(t, dev, []float32{1, 0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 1})
+	color := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 1)
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
+		ColorTexture: color, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 1},
+		DepthTexture: softwareTarget(t, dev, gpu.Depth32Float, W, H, 1), ClearDepth: 1,
+		OcclusionQuerySet: occ,
+		TimestampWrites:   &gpu.PassTimestampWrites{QuerySet: ts, BeginIndex: 0, EndIndex: 1},
+	})
+	rp.SetPipeline(pipe)
+	rp.SetVertexBuffer(0, tri(0.5))
+	rp.SetVertexBuffer(1, red)
+	rp.Draw(gpu.TriangleList, 0, 3)
+	rp.SetPipeline(proxy)
+	for i, z := range []float32{0.75, 0.25} {
+		rp.BeginOcclusionQuery(i)
+		rp.SetVertexBuffer(0, tri(z))
+		rp.Draw(gpu.TriangleList, 0, 3)
+		rp.EndOcclusionQuery()
+	}
+	rp.End()
+	submit(dev, enc)
+
+	res, err := occ.Results(0, 3)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if want := []uint64{0, W * H, 0}; res[0] != want[0] || res[1] != want[1] || res[2] != want[2] {
+		t.Errorf("occlusion results %v, want %v (behind, in front, unused)", res, want)
+	}
+	if got := rgbaAt(color.ReadPixels(), W, W/2, H/2); got != [4]uint8{255, 0, 0, 255} {
+		t.Errorf("center = %v, want the red occluder: a ColorWriteNone draw wrote color", got)
+	}
+	stamps, err := ts.Results(0, 2)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if stamps[1] < stamps[0] || time.Duration(stamps[1]-stamps[0]) > time.Minute {
+		t.Errorf("timestamps %v do not bound the pass", stamps)
+	}
+}
+
+// TestSoftwareIndirect has a kernel write the arguments of a dispatch and a
+// draw, and runs them indirectly.
+func TestSoftwareIndirect(t *testing.T) {
+	dev := softwareDevice(t)
+	const src = `package kernels
+func Args(gid uint, args []uint32) {
+	args[0] = 4
+	args[1] = 1
+	args[2] = 1
+	args[3] = 3
+	args[4] = 1
+	args[5] = 0
+	args[6] = 0
+}
+func Fill(gid uint, out []float32) {
+	out[gid] = float32(gid)
+}`
+	mk := func(entry string) *gpu.ComputePipeline {
+		p, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, src, entry)})
+		if err != nil {
+			t.Fatalf("NewComputePipeline: %v", err)
+		}
+		return p
+	}
+	argsPipe, fillPipe := mk("Args"), mk("Fill")
+	args, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 28, Usage: gpu.BufferStorage | gpu.BufferIndirect})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	drawArgs, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferIndirect | gpu.BufferCopyDst})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 64 * 4, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bind := func(p *gpu.ComputePipeline, b *gpu.Buffer) *gpu.BindGroup {
+		bg, err := dev.NewBindGroup(p.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: b})
+		if err != nil {
+			t.Fatalf("NewBindGroup: %v", err)
+		}
+		return bg
+	}
+	const W, H = 8, 8
+	color := softwareTarget(t, dev, gpu.RGBA8Unorm, W, H, 1)
+	pipe := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{})
+
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(argsPipe)
+	cp.SetBindGroup(0, bind(argsPipe, args))
+	cp.Dispatch(1, 1, 1)
+	cp.SetPipeline(fillPipe)
+	cp.SetBindGroup(0, bind(fillPipe, out))
+	cp.DispatchIndirect(args, 0)
+	cp.End()
+	enc.CopyBufferToBuffer(args, 12, drawArgs, 0, 16)
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear})
+	rp.SetPipeline(pipe)
+	rp.SetVertexBuffer(0, softwareBuffer(t, dev, []float32{-1, -1, 0, 3, -1, 0, -1, 3, 0}))
+	rp.SetVertexBuffer(1, softwareBuffer(t, dev, []float32{0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 1, 1}))
+	rp.DrawIndirect(gpu.TriangleList, drawArgs, 0)
+	rp.End()
+	submit(dev, enc)
+
+	// The Fill pipeline's workgroups are as wide as the software driver
+	// makes them; four of them cover at least four invocations.
+	got := parityFloats(out.Bytes(), 64)
+	for i := 0; i < 4; i++ {
+		if got[i] != float32(i) {
+			t.Errorf("out[%d] = %v, want %d", i, got[i], i)
+		}
+	}
+	if got := rgbaAt(color.ReadPixels(), W, W/2, H/2); got != [4]uint8{0, 0, 255, 255} {
+		t.Errorf("indirect draw center = %v, want blue", got)
+	}
+}
+
+// TestSoftwareTextures samples a 2D array at a layer and a mip level, a cube
+// map face, a 3D texture slice and a depth texture through a comparison
+// sampler, generates mipmaps, and copies between textures and buffers.
+func TestSoftwareTextures(t *testing.T) {
+	dev := softwareDevice(t)
+	const src = `package kernels
+type Vec2 struct{ X, Y float32 }
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+func Sample(gid uint, arr Texture2DArray, cube TextureCube, vol Texture3D, mip Texture2D, s0, s1, s2, s3 Sampler, out []float32) {
+	var c Vec4
+	if gid == 0 {
+		c = arr.Sample(s0, Vec2{0.75, 0.25}, 1)
+	} else if gid == 1 {
+		c = arr.SampleLevel(s0, Vec2{0.5, 0.5}, 1, 1.0)
+	} else if gid == 2 {
+		c = cube.Sample(s1, Vec3{0, 1, 0})
+	} else if gid == 3 {
+		c = vol.Sample(s2, Vec3{0.25, 0.25, 0.75})
+	} else {
+		c = mip.SampleLevel(s3, Vec2{0.5, 0.5}, 0.5)
+	}
+	out[gid*4] = c.X
+	out[gid*4+1] = c.Y
+	out[gid*4+2] = c.Z
+	out[gid*4+3] = c.W
+}
+func Compare(gid uint, depth TextureDepth2D, cmp SamplerComparison, refs []float32, out []float32) {
+	out[gid] = depth.SampleCompare(cmp, Vec2{0.5, 0.5}, refs[gid])
+}`
+	newTexture := func(desc gpu.TextureDescriptor) *gpu.Texture {
+		tex, err := dev.NewTexture(desc)
+		if err != nil {
+			t.Fatalf("NewTexture(%+v): %v", desc, err)
+		}
+		return tex
+	}
+	rgba := func(r, g, b, a byte, n int) []byte { return bytes.Repeat([]byte{r, g, b, a}, n) }
+	arr := newTexture(gpu.TextureDescriptor{Width: 2, Height: 2, Dimension: gpu.TextureDimension2DArray, DepthOrArrayLayers: 2, MipLevelCount: 2})
+	arr.WriteLevel(0, 0, make([]byte, 16))
+	arr.WriteLevel(0, 1, []byte{0, 0, 0, 255, 255, 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255})
+	arr.WriteLevel(1, 0, make([]byte, 4))
+	arr.WriteLevel(1, 1, rgba(0, 255, 0, 255, 1))
+	cube := newTexture(gpu.TextureDescriptor{Format: gpu.R32Float, Width: 1, Height: 1, Dimension: gpu.TextureDimensionCube})
+	for face := 0; face < 6; face++ {
+		cube.WriteLevel(0, face, parityBytes([]float32{float32(face) / 8}))
+	}
+	vol := newTexture(gpu.TextureDescriptor{Width: 2, Height: 2, Dimension: gpu.TextureDimension3D, DepthOrArrayLayers: 2})
+	vol.WriteLevel(0, 0, make([]byte, 16))
+	vol.WriteLevel(0, 1, rgba(0, 0, 255, 255, 4))
+	// Level 0 of mip is white and black halves; generated, level 1 is grey
+	// and a trilinear sample between them is too.
+	mip := newTexture(gpu.TextureDescriptor{Width: 4, Height: 4, MipLevelCount: 3})
+	mip.WriteLevel(0, 0, append(rgba(255, 255, 255, 255, 8), rgba(0, 0, 0, 255, 8)...))
+	mip.GenerateMipmaps()
+	if got := mip.ReadLevel(2, 0); got[0] < 126 || got[0] > 129 {
+		t.Errorf("1x1 level = %v, want grey", got)
+	}
+
+	sample, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, src, "Sample")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 5 * 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(sample.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	nearest := dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterNearest, MagFilter: gpu.FilterNearest})
+	linear := dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterLinear, MagFilter: gpu.FilterLinear, MipmapFilter: gpu.FilterLinear})
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(sample)
+	for i, tex := range []*gpu.Texture{arr, cube, vol, mip} {
+		cp.SetTexture(i, tex)
+		cp.SetSampler(i, nearest)
+	}
+	cp.SetSampler(3, linear)
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(5, 1, 1)
+	cp.End()
+	submit(dev, enc)
+	got := parityFloats(out.Bytes(), 20)
+	for i, want := range [][4]float32{
+		{1, 0, 0, 1},       // arr layer 1, level 0, texel (1, 0)
+		{0, 1, 0, 1},       // arr layer 1, level 1
+		{2.0 / 8, 0, 0, 1}, // the +Y face
+		{0, 0, 1, 1},       // vol slice 1
+		{0.5, 0.5, 0.5, 1}, // between mip's grey levels 0 (at a row boundary) and 1
+	} {
+		for c, w := range want {
+			if math.Abs(float64(got[i*4+c]-w)) > 0.01 {
+				t.Errorf("sample %d channel %d = %v, want %v", i, c, got[i*4+c], w)
+			}
+		}
+	}
+
+	// A depth target cleared to 0.5, compared with 0.25 and 0.75.
+	depth := softwareTarget(t, dev, gpu.Depth32Float, 8, 8, 1)
+	compare, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, src, "Compare")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	cmpOut, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 8, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err = dev.NewBindGroup(compare.BindGroupLayout(0),
+		gpu.BindGroupEntry{Binding: 0, Buffer: softwareBuffer(t, dev, []float32{0.25, 0.75})},
+		gpu.BindGroupEntry{Binding: 1, Buffer: cmpOut})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	enc = dev.NewCommandEncoder()
+	enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: softwareTarget(t, dev, gpu.RGBA8Unorm, 8, 8, 1), DepthTexture: depth, ClearDepth: 0.5}).End()
+	cp = enc.BeginComputePass()
+	cp.SetPipeline(compare)
+	cp.SetTexture(0, depth)
+	cp.SetSampler(0, dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterLinear, MagFilter: gpu.FilterLinear, Compare: gpu.CompareLess}))
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(2, 1, 1)
+	cp.End()
+	submit(dev, enc)
+	if got := parityFloats(cmpOut.Bytes(), 2); got[0] != 1 || got[1] != 0 {
+		t.Errorf("compares = %v, want [1 0]", got)
+	}
+
+	// Copies: buffer -> texture region -> texture -> buffer.
+	src4 := newTexture(gpu.TextureDescriptor{Width: 4, Height: 4})
+	dst4 := newTexture(gpu.TextureDescriptor{Width: 4, Height: 4})
+	staging, err := dev.NewBuffer(gpu.BufferDescriptor{Data: rgba(10, 20, 30, 40, 4), Usage: gpu.BufferCopySrc})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	readback, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferCopyDst | gpu.BufferMapRead})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	enc = dev.NewCommandEncoder()
+	enc.CopyBufferToTexture(gpu.ImageCopyBuffer{Buffer: staging, BytesPerRow: 8}, gpu.ImageCopyTexture{Texture: src4, X: 1, Y: 1}, 2, 2)
+	enc.CopyTextureToTexture(gpu.ImageCopyTexture{Texture: src4, X: 1, Y: 1}, gpu.ImageCopyTexture{Texture: dst4, X: 2, Y: 0}, 2, 2)
+	enc.CopyTextureToBuffer(gpu.ImageCopyTexture{Texture: dst4, X: 2, Y: 1}, gpu.ImageCopyBuffer{Buffer: readback, BytesPerRow: 8}, 2, 1)
+	submit(dev, enc)
+	if err := <-readback.MapAsync(gpu.MapRead, 0, 16); err != nil {
+		t.Fatalf("MapAsync: %v", err)
+	}
+	if got, want := readback.MappedRange()[:8], rgba(10, 20, 30, 40, 2); !bytes.Equal(got, want) {
+		t.Errorf("copied row = %v, want %v", got, want)
+	}
+	readback.Unmap()
+	if got := binary.LittleEndian.Uint32(dst4.ReadPixels()); got != 0 {
+		t.Errorf("texel (0, 0) of the copy destination = %#x, want untouched", got)
+	}
+}
@@ -85,6 +85,9 @@ func (d *Device) CreateWindowSurface(desc WindowSurfaceDescriptor) (*Surface, er
 }
 
 func (s *Surface) allocate(frames int) error {
+	for _, t := range s.textures {
+		t.Release()
+	}
 	s.textures = s.textures[:0]
 	for i := 0; i < frames; i++ {
 		t, err := s.d.NewTexture(TextureDescriptor{
@@ -103,7 +106,7 @@ func (s *Surface) allocate(frames int) error {
 func (s *Surface) AcquireNextTexture() *Texture {
 	if s.bs != nil {
 		s.acquired = true
-		return &Texture{b: s.bs.acquire(), w: s.w, h: s.h}
+		return &Texture{b: s.bs.acquire(), w: s.w, h: s.h, format: RGBA8Unorm, layers: 1, mips: 1}
 	}
 	t := s.textures[s.frame%len(s.textures)]
 	s.acquired = true
@@ -137,11 +140,17 @@ func (s *Surface) PresentImage(img *image.RGBA) error {
 	return s.Present()
 }
 
-// Release frees the on-screen surface's backend resources. No-op for headless.
+// Release frees the surface's textures and, on screen, its backend
+// resources.
 func (s *Surface) Release() {
 	if s.bs != nil {
 		s.bs.release()
+		return
+	}
+	for _, t := range s.textures {
+		t.Release()
 	}
+	s.textures = nil
 }
 
 // PresentedPixels reads back the pixels the on-screen surface presents to the
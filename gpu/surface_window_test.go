@@ -7,7 +7,8 @@
 // glWindowSurface.readDefault) needs a real display and window-system handle, so
 // it is gated to an environment with an X server; the surfaceless CI cannot run
 // it. These tests cover the display-independent parts: input validation and the
-// backends that do not yet support an on-screen surface (Metal/Vulkan stub it).
+// backends that do not support an on-screen surface (Metal/Vulkan stub it, and
+// the software driver has none).
 package gpu_test
 
 import (
@@ -37,9 +38,10 @@ func TestCreateWindowSurfaceValidation(t *testing.T) {
 		t.Errorf("CreateWindowSurface with Height<0 should error")
 	}
 
-	// Backends without an on-screen path (Metal, Vulkan) report ErrUnsupported.
+	// Backends without an on-screen path (Metal, Vulkan, software) report
+	// ErrUnsupported.
 	switch dev.Driver() {
-	case gpu.DriverMetal, gpu.DriverVulkan:
+	case gpu.DriverMetal, gpu.DriverVulkan, gpu.DriverSoftware:
 		_, err := dev.CreateWindowSurface(gpu.WindowSurfaceDescriptor{
 			Width: 16, Height: 16, Format: gpu.RGBA8Unorm,
 		})
@@ -0,0 +1,172 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Texel codecs convert the pixels of a color format, laid out as WriteLevel
+// takes them, to and from RGBA float32 values, four per texel. sRGB texels
+// decode to linear values, so that filtering averages light, not encoded
+// values.
+
+// decodeTexels returns the RGBA values of the texels of format f in pix.
+// Channels the format lacks read as 0, and alpha as 1.
+func decodeTexels(f TextureFormat, pix []byte) []float32 {
+	bpp := f.bytesPerPixel()
+	out := make([]float32, 0, len(pix)/bpp*4)
+	for i := 0; i+bpp <= len(pix); i += bpp {
+		v := decodeTexel(f, pix[i:i+bpp])
+		out = append(out, v[:]...)
+	}
+	return out
+}
+
+// decodeTexel returns the RGBA value of the texel of format f at the start
+// of p. A depth texel reads as its depth in the red channel.
+func decodeTexel(f TextureFormat, p []byte) [4]float32 {
+	var v [4]float32
+	switch f {
+	case R8Unorm:
+		v = [4]float32{float32(p[0]) / 255, 0, 0, 1}
+	case RG16Float:
+		v = [4]float32{halfFloat(binary.LittleEndian.Uint16(p)), halfFloat(binary.LittleEndian.Uint16(p[2:])), 0, 1}
+	case RGBA16Float:
+		for c := range v {
+			v[c] = halfFloat(binary.LittleEndian.Uint16(p[c*2:]))
+		}
+	case R32Float, Depth32Float, Depth24Stencil8:
+		v = [4]float32{math.Float32frombits(binary.LittleEndian.Uint32(p)), 0, 0, 1}
+	case RGBA32Float:
+		for c := range v {
+			v[c] = math.Float32frombits(binary.LittleEndian.Uint32(p[c*4:]))
+		}
+	case BGRA8UnormSRGB:
+		v = [4]float32{srgbToLinear(p[2]), srgbToLinear(p[1]), srgbToLinear(p[0]), float32(p[3]) / 255}
+	default:
+		for c := range v {
+			v[c] = float32(p[c]) / 255
+		}
+	}
+	return v
+}
+
+// encodeTexels is the inverse of decodeTexels: it returns the texels of
+// format f holding the RGBA values vs, clamping and rounding unorm channels.
+func encodeTexels(f TextureFormat, vs []float32) []byte {
+	out := make([]byte, 0, len(vs)/4*f.bytesPerPixel())
+	for i := 0; i+4 <= len(vs); i += 4 {
+		out = appendTexel(f, out, [4]float32(vs[i:i+4]))
+	}
+	return out
+}
+
+// appendTexel appends the texel of format f holding v to out, as
+// encodeTexels encodes it.
+func appendTexel(f TextureFormat, out []byte, v [4]float32) []byte {
+	switch f {
+	case R8Unorm:
+		return append(out, unorm8(v[0]))
+	case RG16Float:
+		out = binary.LittleEndian.AppendUint16(out, halfBits(v[0]))
+		return binary.LittleEndian.AppendUint16(out, halfBits(v[1]))
+	case RGBA16Float:
+		for _, c := range v {
+			out = binary.LittleEndian.AppendUint16(out, halfBits(c))
+		}
+		return out
+	case R32Float, Depth32Float, Depth24Stencil8:
+		return binary.LittleEndian.AppendUint32(out, math.Float32bits(v[0]))
+	case RGBA32Float:
+		for _, c := range v {
+			out = binary.LittleEndian.AppendUint32(out, math.Float32bits(c))
+		}
+		return out
+	case BGRA8UnormSRGB:
+		return append(out, linearToSRGB(v[2]), linearToSRGB(v[1]), linearToSRGB(v[0]), unorm8(v[3]))
+	}
+	return append(out, unorm8(v[0]), unorm8(v[1]), unorm8(v[2]), unorm8(v[3]))
+}
+
+// unorm8 returns the 8-bit unorm value nearest v.
+func unorm8(v float32) byte {
+	return byte(math.Round(float64(min(max(v, 0), 1)) * 255))
+}
+
+// srgbToLinear decodes an 8-bit sRGB channel.
+func srgbToLinear(c byte) float32 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return float32(v / 12.92)
+	}
+	return float32(math.Pow((v+0.055)/1.055, 2.4))
+}
+
+// linearToSRGB encodes a linear channel as 8-bit sRGB.
+func linearToSRGB(v float32) byte {
+	l := float64(min(max(v, 0), 1))
+	if l <= 0.0031308 {
+		l *= 12.92
+	} else {
+		l = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+	return byte(math.Round(l * 255))
+}
+
+// halfFloat returns the value of the IEEE binary16 h.
+func halfFloat(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch {
+	case exp == 0x1f: // Inf or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0: // zero or a subnormal half, a normal float
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// halfBits returns the IEEE binary16 value nearest f, ties to even.
+func halfBits(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b>>23&0xff == 0xff: // Inf or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0: // a subnormal half, or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h, rem, half := mant>>shift, mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > half || rem == half && h&1 == 1 {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	h, rem := uint32(exp)<<10|mant>>13, mant&0x1fff
+	if rem > 0x1000 || rem == 0x1000 && h&1 == 1 {
+		h++ // may carry into the exponent, up to Inf
+	}
+	return sign | uint16(h)
+}
@@ -0,0 +1,274 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// TextureDimension is the shape of a texture.
+type TextureDimension int
+
+const (
+	// TextureDimension2D is a single 2D image.
+	TextureDimension2D TextureDimension = iota
+	// TextureDimension2DArray is DepthOrArrayLayers 2D images of one size,
+	// sampled with a layer index.
+	TextureDimension2DArray
+	// TextureDimensionCube is six square faces, layers 0 to 5 in the order
+	// +X, -X, +Y, -Y, +Z, -Z, sampled with a direction.
+	TextureDimensionCube
+	// TextureDimension3D is a volume DepthOrArrayLayers texels deep. Its mip
+	// levels halve the depth as well as the width and height.
+	TextureDimension3D
+)
+
+func (d TextureDimension) String() string {
+	switch d {
+	case TextureDimension2D:
+		return "2D"
+	case TextureDimension2DArray:
+		return "2D array"
+	case TextureDimensionCube:
+		return "cube"
+	case TextureDimension3D:
+		return "3D"
+	default:
+		return fmt.Sprintf("TextureDimension(%d)", int(d))
+	}
+}
+
+// isDepth reports whether f is a depth format, written only by render passes.
+func (f TextureFormat) isDepth() bool { return f == Depth32Float || f == Depth24Stencil8 }
+
+// normalize checks desc and fills in its defaults: the RGBA8Unorm format, one
+// layer (six for a cube map) and one mip level. Width and height are checked
+// by the caller.
+func (desc TextureDescriptor) normalize() (TextureDescriptor, error) {
+	if desc.Format == FormatNone {
+		desc.Format = RGBA8Unorm
+	}
+	if desc.Format < FormatNone || desc.Format > BGRA8UnormSRGB {
+		return desc, fmt.Errorf("gpu: unknown texture format %d", int(desc.Format))
+	}
+	switch desc.Dimension {
+	case TextureDimension2D, TextureDimension2DArray, TextureDimension3D:
+		if desc.DepthOrArrayLayers == 0 {
+			desc.DepthOrArrayLayers = 1
+		}
+	case TextureDimensionCube:
+		if desc.DepthOrArrayLayers == 0 {
+			desc.DepthOrArrayLayers = 6
+		}
+		if desc.Width != desc.Height {
+			return desc, fmt.Errorf("gpu: cube map faces must be square, not %dx%d", desc.Width, desc.Height)
+		}
+		if desc.DepthOrArrayLayers != 6 {
+			return desc, fmt.Errorf("gpu: a cube map has 6 layers, not %d", desc.DepthOrArrayLayers)
+		}
+	default:
+		return desc, fmt.Errorf("gpu: unknown texture dimension %v", desc.Dimension)
+	}
+	if desc.DepthOrArrayLayers < 1 {
+		return desc, fmt.Errorf("gpu: texture depth or array layers must be > 0, not %d", desc.DepthOrArrayLayers)
+	}
+	if desc.Dimension == TextureDimension2D && desc.DepthOrArrayLayers != 1 {
+		return desc, fmt.Errorf("gpu: a 2D texture has one layer, not %d; use TextureDimension2DArray", desc.DepthOrArrayLayers)
+	}
+	if desc.MipLevelCount == 0 {
+		desc.MipLevelCount = 1
+	}
+	size := max(desc.Width, desc.Height)
+	if desc.Dimension == TextureDimension3D {
+		size = max(size, desc.DepthOrArrayLayers)
+	}
+	if n := bits.Len(uint(size)); desc.MipLevelCount < 1 || desc.MipLevelCount > n {
+		return desc, fmt.Errorf("gpu: mip level count %d out of range 1..%d for the texture's size", desc.MipLevelCount, n)
+	}
+	if desc.Format.isDepth() && desc.Dimension != TextureDimension2D {
+		return desc, fmt.Errorf("gpu: a depth texture must be 2D, not %v", desc.Dimension)
+	}
+	if desc.RenderTarget && desc.Dimension != TextureDimension2D {
+		return desc, fmt.Errorf("gpu: a %v texture cannot be a render target", desc.Dimension)
+	}
+	if desc.SampleCount == 0 {
+		desc.SampleCount = 1
+	}
+	switch {
+	case desc.SampleCount != 1 && desc.SampleCount != 4:
+		return desc, fmt.Errorf("gpu: texture sample count %d is not 1 or 4", desc.SampleCount)
+	case desc.SampleCount == 1:
+	case desc.Dimension != TextureDimension2D || desc.MipLevelCount != 1:
+		return desc, fmt.Errorf("gpu: a multisampled texture must be 2D with one mip level")
+	case !desc.RenderTarget && !desc.Format.isDepth():
+		return desc, fmt.Errorf("gpu: a multisampled texture must be a render target or depth texture")
+	}
+	return desc, nil
+}
+
+// mipSize is the size of mip level of an extent n texels long.
+func mipSize(n, level int) int { return max(1, n>>level) }
+
+// Format returns the texture's pixel format.
+func (t *Texture) Format() TextureFormat { return t.format }
+
+// Dimension returns the texture's shape.
+func (t *Texture) Dimension() TextureDimension { return t.dim }
+
+// DepthOrArrayLayers returns the depth of a 3D texture or the layer count of
+// any other (6 for a cube map, 1 for a 2D texture).
+func (t *Texture) DepthOrArrayLayers() int { return t.layers }
+
+// MipLevelCount returns the number of mip levels.
+func (t *Texture) MipLevelCount() int { return t.mips }
+
+// SampleCount returns the number of samples per texel: 1, or 4 for a
+// multisampled texture.
+func (t *Texture) SampleCount() int { return t.samples }
+
+// checkSingleSampled panics if t is multisampled: its samples only leave it
+// through a resolve or a kernel's Load.
+func (t *Texture) checkSingleSampled(op string) {
+	if t.samples != 1 {
+		panic(fmt.Sprintf("gpu: %s of a multisampled texture", op))
+	}
+}
+
+// LevelSize returns the width and height of mip level and its layer count:
+// the level's depth for a 3D texture, DepthOrArrayLayers for any other.
+func (t *Texture) LevelSize(level int) (width, height, layers int) {
+	layers = t.layers
+	if t.dim == TextureDimension3D {
+		layers = mipSize(t.layers, level)
+	}
+	return mipSize(t.w, level), mipSize(t.h, level), layers
+}
+
+// WriteLevel uploads one image of mip level: array layer or cube face layer,
+// or depth slice layer of a 3D texture. pixels holds its rows tightly packed
+// in storage order (see ImageCopyTexture), each pixel laid out as its format
+// names the channels: BGRA8UnormSRGB takes B, G, R, A bytes and the half
+// float formats IEEE binary16 values.
+//
+// It panics when level or layer is out of range, when pixels is not exactly
+// one image of the level, or for a depth format or multisampled texture,
+// which only render passes write.
+func (t *Texture) WriteLevel(level, layer int, pixels []byte) {
+	w, h := t.checkLevel("WriteLevel", level, layer)
+	if n := w * h * t.format.bytesPerPixel(); len(pixels) != n {
+		panic(fmt.Sprintf("gpu: WriteLevel of %d bytes into a %dx%d level of %d bytes", len(pixels), w, h, n))
+	}
+	t.b.writeLevel(level, layer, w, h, pixels)
+}
+
+// ReadLevel reads one image of mip level and layer back to CPU memory, laid
+// out as WriteLevel takes it. Unlike ReadPixels it never flips rows, so it
+// returns what WriteLevel wrote; a GL or Vulkan render target comes back
+// bottom-up. Call it once the work writing the texture has completed.
+//
+// It panics as WriteLevel does for an out-of-range level or layer, a depth
+// format or a multisampled texture.
+func (t *Texture) ReadLevel(level, layer int) []byte {
+	w, h := t.checkLevel("ReadLevel", level, layer)
+	return t.b.readLevel(level, layer, w, h)
+}
+
+// checkLevel panics unless level and layer name an image WriteLevel and
+// ReadLevel can move, and returns its size.
+func (t *Texture) checkLevel(op string, level, layer int) (w, h int) {
+	t.checkSingleSampled(op)
+	if t.format.isDepth() {
+		panic(fmt.Sprintf("gpu: %s of a depth texture", op))
+	}
+	if level < 0 || level >= t.mips {
+		panic(fmt.Sprintf("gpu: %s level %d out of range of %d", op, level, t.mips))
+	}
+	w, h, layers := t.LevelSize(level)
+	if layer < 0 || layer >= layers {
+		panic(fmt.Sprintf("gpu: %s layer %d out of range of %d at level %d", op, layer, layers, level))
+	}
+	return w, h
+}
+
+// filterable reports whether textures of format f can be sampled with linear
+// filtering and have their mipmaps generated by the GPU. The 32-bit float
+// formats are not: sample them with FilterNearest.
+func (f TextureFormat) filterable() bool {
+	return !f.isDepth() && f != R32Float && f != RGBA32Float
+}
+
+// GenerateMipmaps fills mip levels 1 and up of every layer from level 0, each
+// texel the average of a 2x2 block of the level above (2x2x2 for a 3D
+// texture; sRGB formats average linear values). The GPU filters the levels,
+// except for the 32-bit float formats, which GPUs cannot filter and are
+// averaged on the CPU. Like WriteLevel, it runs immediately: write level 0
+// first.
+//
+// It panics for a depth format or a multisampled texture.
+func (t *Texture) GenerateMipmaps() {
+	t.checkSingleSampled("GenerateMipmaps")
+	if t.format.isDepth() {
+		panic("gpu: GenerateMipmaps of a depth texture")
+	}
+	switch {
+	case t.mips == 1:
+	case t.format.filterable():
+		t.b.generateMipmaps()
+	default:
+		t.generateMipmapsCPU()
+	}
+}
+
+// generateMipmapsCPU is GenerateMipmaps through ReadLevel and WriteLevel.
+// Odd sizes repeat a level's last row, column or slice.
+func (t *Texture) generateMipmapsCPU() {
+	volume := t.dim == TextureDimension3D
+	for level := 1; level < t.mips; level++ {
+		sw, sh, sl := t.LevelSize(level - 1)
+		w, h, layers := t.LevelSize(level)
+		// src holds the decoded slices of a 3D source level.
+		var src [][]float32
+		read := func(layer int) []float32 { return decodeTexels(t.format, t.b.readLevel(level-1, layer, sw, sh)) }
+		if volume {
+			src = make([][]float32, sl)
+			for z := range src {
+				src[z] = read(z)
+			}
+		}
+		for layer := 0; layer < layers; layer++ {
+			// A 3D level's slice averages two source slices; any other
+			// layer its own source image.
+			var planes [][]float32
+			if volume {
+				planes = [][]float32{src[2*layer], src[min(2*layer+1, sl-1)]}
+			} else {
+				planes = [][]float32{read(layer)}
+			}
+			out := make([]float32, 0, w*h*4)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					var sum [4]float32
+					n := 0
+					for _, p := range planes {
+						for _, sy := range [2]int{2 * y, min(2*y+1, sh-1)} {
+							for _, sx := range [2]int{2 * x, min(2*x+1, sw-1)} {
+								i := (sy*sw + sx) * 4
+								for c := range sum {
+									sum[c] += p[i+c]
+								}
+								n++
+							}
+						}
+					}
+					for c := range sum {
+						out = append(out, sum[c]/float32(n))
+					}
+				}
+			}
+			t.b.writeLevel(level, layer, w, h, encodeTexels(t.format, out))
+		}
+	}
+}
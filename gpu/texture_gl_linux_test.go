@@ -0,0 +1,440 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"testing"
+
+	"poly.red/buffer"
+	"poly.red/gpu"
+	"poly.red/gpu/shader"
+)
+
+// halfBytes encodes vs as IEEE binary16 values. Each must be exactly
+// representable, as the test values are.
+func halfBytes(vs ...float32) []byte {
+	out := make([]byte, 0, 2*len(vs))
+	for _, v := range vs {
+		b := math.Float32bits(v)
+		h := uint16(b>>16&0x8000) | uint16((int(b>>23&0xff)-127+15)<<10) | uint16(b>>13&0x3ff)
+		if v == 0 {
+			h = 0
+		}
+		out = binary.LittleEndian.AppendUint16(out, h)
+	}
+	return out
+}
+
+// TestGLTextureLevels writes every image of a mipmapped 2D array in each
+// color format and reads it back, and does the same for the faces of a cube
+// map and the slices of a 3D texture's levels.
+func TestGLTextureLevels(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL texture test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	// image returns the pixels of an image of n texels in format f, distinct
+	// per seed and exactly representable in the format.
+	image := func(f gpu.TextureFormat, n, seed int) []byte {
+		var out []byte
+		for i := 0; i < n; i++ {
+			v := seed*16 + i
+			switch f {
+			case gpu.R8Unorm:
+				out = append(out, byte(v))
+			case gpu.RG16Float:
+				out = append(out, halfBytes(float32(v)/4, -float32(v))...)
+			case gpu.RGBA16Float:
+				out = append(out, halfBytes(float32(v), 0.5, -2, float32(v)/8)...)
+			case gpu.R32Float:
+				out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(v)/3))
+			case gpu.RGBA32Float:
+				for c := 0; c < 4; c++ {
+					out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(v*4+c)/7))
+				}
+			default:
+				out = append(out, byte(v), byte(v+1), byte(v+2), byte(255-v))
+			}
+		}
+		return out
+	}
+	check := func(tex *gpu.Texture, name string) {
+		t.Helper()
+		f := tex.Format()
+		for level := 0; level < tex.MipLevelCount(); level++ {
+			w, h, layers := tex.LevelSize(level)
+			for layer := 0; layer < layers; layer++ {
+				tex.WriteLevel(level, layer, image(f, w*h, level*8+layer))
+			}
+		}
+		for level := 0; level < tex.MipLevelCount(); level++ {
+			w, h, layers := tex.LevelSize(level)
+			for layer := 0; layer < layers; layer++ {
+				want := image(f, w*h, level*8+layer)
+				if got := tex.ReadLevel(level, layer); !bytes.Equal(got, want) {
+					t.Errorf("%s level %d layer %d = %v, want %v", name, level, layer, got, want)
+				}
+			}
+		}
+	}
+
+	for _, f := range []gpu.TextureFormat{
+		gpu.RGBA8Unorm, gpu.R8Unorm, gpu.RG16Float, gpu.RGBA16Float,
+		gpu.R32Float, gpu.RGBA32Float, gpu.BGRA8UnormSRGB,
+	} {
+		tex, err := dev.NewTexture(gpu.TextureDescriptor{
+			Format: f, Width: 4, Height: 2, MipLevelCount: 3,
+			Dimension: gpu.TextureDimension2DArray, DepthOrArrayLayers: 2,
+		})
+		if err != nil {
+			t.Fatalf("NewTexture(format %d): %v", f, err)
+		}
+		check(tex, "2D array")
+	}
+	cube, err := dev.NewTexture(gpu.TextureDescriptor{Width: 4, Height: 4, Dimension: gpu.TextureDimensionCube, MipLevelCount: 2})
+	if err != nil {
+		t.Fatalf("NewTexture(cube): %v", err)
+	}
+	check(cube, "cube")
+	vol, err := dev.NewTexture(gpu.TextureDescriptor{
+		Format: gpu.RGBA16Float, Width: 4, Height: 4,
+		Dimension: gpu.TextureDimension3D, DepthOrArrayLayers: 4, MipLevelCount: 3,
+	})
+	if err != nil {
+		t.Fatalf("NewTexture(3D): %v", err)
+	}
+	if w, h, d := vol.LevelSize(1); w != 2 || h != 2 || d != 2 {
+		t.Fatalf("3D LevelSize(1) = %d, %d, %d, want 2, 2, 2", w, h, d)
+	}
+	check(vol, "3D")
+}
+
+// TestGLTextureSampling has a Go kernel sample a 2D array at a layer and a
+// mip level, a cube map face, a 3D texture slice and an R32Float texture.
+func TestGLTextureSampling(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL texture test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const src = `package kernels
+type Vec2 struct{ X, Y float32 }
+type Vec3 struct{ X, Y, Z float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+func Sample(gid uint, arr Texture2DArray, cube TextureCube, vol Texture3D, r32 Texture2D, s0, s1, s2, s3 Sampler, out []float32) {
+	var c Vec4
+	if gid == 0 {
+		c = arr.Sample(s0, Vec2{0.75, 0.25}, 1)
+	} else if gid == 1 {
+		c = arr.SampleLevel(s0, Vec2{0.5, 0.5}, 1, 1.0)
+	} else if gid == 2 {
+		c = cube.Sample(s1, Vec3{0, 1, 0})
+	} else if gid == 3 {
+		c = vol.Sample(s2, Vec3{0.25, 0.25, 0.75})
+	} else {
+		c = r32.Sample(s3, Vec2{0.5, 0.5})
+	}
+	out[gid*4] = c.X
+	out[gid*4+1] = c.Y
+	out[gid*4+2] = c.Z
+	out[gid*4+3] = c.W
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Sample"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	newTexture := func(desc gpu.TextureDescriptor) *gpu.Texture {
+		tex, err := dev.NewTexture(desc)
+		if err != nil {
+			t.Fatalf("NewTexture(%+v): %v", desc, err)
+		}
+		return tex
+	}
+
+	// Layer 1 of arr holds four texels at level 0 and one at level 1.
+	arr := newTexture(gpu.TextureDescriptor{Width: 2, Height: 2, Dimension: gpu.TextureDimension2DArray, DepthOrArrayLayers: 2, MipLevelCount: 2})
+	arr.WriteLevel(0, 0, make([]byte, 16))
+	arr.WriteLevel(0, 1, []byte{0, 0, 0, 255, 255, 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255})
+	arr.WriteLevel(1, 0, make([]byte, 4))
+	arr.WriteLevel(1, 1, []byte{0, 255, 0, 255})
+	// Face i of cube has red i/8.
+	cube := newTexture(gpu.TextureDescriptor{Format: gpu.RGBA16Float, Width: 1, Height: 1, Dimension: gpu.TextureDimensionCube})
+	for face := 0; face < 6; face++ {
+		cube.WriteLevel(0, face, halfBytes(float32(face)/8, 0, 0, 1))
+	}
+	// Slice 1 of vol is blue, slice 0 black.
+	vol := newTexture(gpu.TextureDescriptor{Width: 2, Height: 2, Dimension: gpu.TextureDimension3D, DepthOrArrayLayers: 2})
+	vol.WriteLevel(0, 0, make([]byte, 16))
+	vol.WriteLevel(0, 1, bytes.Repeat([]byte{0, 0, 255, 255}, 4))
+	r32 := newTexture(gpu.TextureDescriptor{Format: gpu.R32Float, Width: 1, Height: 1})
+	r32.WriteLevel(0, 0, binary.LittleEndian.AppendUint32(nil, math.Float32bits(3.5)))
+
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 5 * 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(pipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	samp := dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterNearest, MagFilter: gpu.FilterNearest})
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(pipe)
+	for i, tex := range []*gpu.Texture{arr, cube, vol, r32} {
+		cp.SetTexture(i, tex)
+		cp.SetSampler(i, samp)
+	}
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(5, 1, 1)
+	cp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := out.Bytes()
+	for i, want := range [][4]float32{
+		{1, 0, 0, 1},       // arr layer 1, level 0, texel (1, 0)
+		{0, 1, 0, 1},       // arr layer 1, level 1
+		{2.0 / 8, 0, 0, 1}, // the +Y face
+		{0, 0, 1, 1},       // vol slice 1
+		{3.5, 0, 0, 1},     // r32
+	} {
+		for c, w := range want {
+			v := math.Float32frombits(binary.LittleEndian.Uint32(got[(i*4+c)*4:]))
+			if math.Abs(float64(v-w)) > 0.01 {
+				t.Errorf("sample %d channel %d = %v, want %v", i, c, v, w)
+			}
+		}
+	}
+}
+
+// TestGLGenerateMipmaps generates the mipmaps of a smooth image on the GPU
+// and checks trilinear samples of them against buffer.Texture's CPU
+// trilinear path, whose Query(lod+1) blends the levels SampleLevel(lod) does.
+// It also checks the CPU-averaged mipmaps of an R32Float texture.
+func TestGLGenerateMipmaps(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL texture test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const size = 64
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			fx, fy := 2*math.Pi*float64(x)/size, 2*math.Pi*float64(y)/size
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(128 + 60*math.Sin(fx+0.3)*math.Cos(fy+0.5)),
+				uint8(128 + 60*math.Cos(fx)),
+				uint8(128 + 60*math.Sin(fy)),
+				255,
+			})
+		}
+	}
+	tex, err := dev.NewTexture(gpu.TextureDescriptor{Width: size, Height: size, MipLevelCount: 7})
+	if err != nil {
+		t.Fatalf("NewTexture: %v", err)
+	}
+	tex.WriteLevel(0, 0, img.Pix)
+	tex.GenerateMipmaps()
+	if got := tex.ReadLevel(6, 0); math.Abs(float64(got[1])-128) > 4 {
+		t.Errorf("1x1 level = %v, want about the image's mean green 128", got)
+	}
+
+	const src = `package kernels
+type Vec2 struct{ X, Y float32 }
+type Vec4 struct{ X, Y, Z, W float32 }
+func Trilinear(gid uint, tex Texture2D, samp Sampler, q []float32, out []float32) {
+	c := tex.SampleLevel(samp, Vec2{q[gid*3], q[gid*3+1]}, q[gid*3+2])
+	out[gid*4] = c.X
+	out[gid*4+1] = c.Y
+	out[gid*4+2] = c.Z
+	out[gid*4+3] = c.W
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Trilinear"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	// The CPU path puts texel centres half a texel away from the GPU's
+	// except at the centre of the image, where they agree; off it the
+	// coarse levels' texels are too wide to compare.
+	var queries []float32
+	for _, lod := range []float32{0.5, 1.5, 2.25, 3.75} {
+		for _, uv := range [][2]float32{{0.5, 0.5}, {0.3, 0.6}, {0.7, 0.45}} {
+			if lod > 3 && uv != [2]float32{0.5, 0.5} {
+				continue
+			}
+			queries = append(queries, uv[0], uv[1], lod)
+		}
+	}
+	n := len(queries) / 3
+	q, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf(queries), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(pipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: q}, gpu.BindGroupEntry{Binding: 1, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	samp := dev.NewSampler(gpu.SamplerDescriptor{
+		MinFilter: gpu.FilterLinear, MagFilter: gpu.FilterLinear, MipmapFilter: gpu.FilterLinear,
+	})
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(pipe)
+	cp.SetTexture(0, tex)
+	cp.SetSampler(0, samp)
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(n, 1, 1)
+	cp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	cpu := buffer.NewTexture(buffer.TextureImage(img))
+	got := out.Bytes()
+	for i := 0; i < n; i++ {
+		u, v, lod := queries[i*3], queries[i*3+1], queries[i*3+2]
+		want := cpu.Query(lod+1, u, v)
+		for c, w := range []uint8{want.R, want.G, want.B} {
+			g := math.Float32frombits(binary.LittleEndian.Uint32(got[(i*4+c)*4:]))
+			if d := math.Abs(float64(g)*255 - float64(w)); d > 12 {
+				t.Errorf("lod %v at (%v, %v) channel %d = %.1f, CPU trilinear %d", lod, u, v, c, g*255, w)
+			}
+		}
+	}
+
+	// R32Float is not filterable: its levels are averaged on the CPU.
+	r32, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.R32Float, Width: 4, Height: 2, MipLevelCount: 3})
+	if err != nil {
+		t.Fatalf("NewTexture(R32Float): %v", err)
+	}
+	r32.WriteLevel(0, 0, glBytesOf([]float32{1, 2, 3, 4, 5, 6, 7, 8}))
+	r32.GenerateMipmaps()
+	for level, want := range [][]float32{1: {3.5, 5.5}, 2: {4.5}} {
+		if level == 0 {
+			continue
+		}
+		b := r32.ReadLevel(level, 0)
+		for i, w := range want {
+			if g := math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])); g != w {
+				t.Errorf("R32Float level %d texel %d = %v, want %v", level, i, g, w)
+			}
+		}
+	}
+}
+
+// TestGLSampleCompare compares references against a depth texture cleared to
+// 0.5 through a comparison sampler.
+func TestGLSampleCompare(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL texture test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const W, H = 8, 8
+	color, err := dev.NewTexture(gpu.TextureDescriptor{Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("NewTexture(color): %v", err)
+	}
+	depth, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: W, Height: H, RenderTarget: true})
+	if err != nil {
+		t.Fatalf("NewTexture(depth): %v", err)
+	}
+	const src = `package kernels
+type Vec2 struct{ X, Y float32 }
+func Compare(gid uint, depth TextureDepth2D, cmp SamplerComparison, refs []float32, out []float32) {
+	out[gid] = depth.SampleCompare(cmp, Vec2{0.5, 0.5}, refs[gid])
+}`
+	ks, err := shader.CompileGLSL(src)
+	if err != nil {
+		t.Fatalf("CompileGLSL: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["Compare"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	refs, err := dev.NewBuffer(gpu.BufferDescriptor{Data: glBytesOf([]float32{0.25, 0.75}), Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 8, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	bg, err := dev.NewBindGroup(pipe.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: refs}, gpu.BindGroupEntry{Binding: 1, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	cmp := dev.NewSampler(gpu.SamplerDescriptor{MinFilter: gpu.FilterLinear, MagFilter: gpu.FilterLinear, Compare: gpu.CompareLess})
+
+	enc := dev.NewCommandEncoder()
+	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear, DepthTexture: depth, ClearDepth: 0.5})
+	rp.End()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(pipe)
+	cp.SetTexture(0, depth)
+	cp.SetSampler(0, cmp)
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(2, 1, 1)
+	cp.End()
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	got := out.Bytes()
+	for i, want := range []float32{1, 0} {
+		if g := math.Float32frombits(binary.LittleEndian.Uint32(got[i*4:])); g != want {
+			t.Errorf("compare %d = %v, want %v", i, g, want)
+		}
+	}
+}
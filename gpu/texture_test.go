@@ -0,0 +1,60 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTextureDescriptorNormalize checks the defaults NewTexture fills in and
+// the shapes it rejects.
+func TestTextureDescriptorNormalize(t *testing.T) {
+	for _, c := range []struct {
+		desc           TextureDescriptor
+		format         TextureFormat
+		layers, levels int
+	}{
+		{TextureDescriptor{Width: 4, Height: 4}, RGBA8Unorm, 1, 1},
+		{TextureDescriptor{Width: 8, Height: 8, Dimension: TextureDimensionCube, MipLevelCount: 4}, RGBA8Unorm, 6, 4},
+		{TextureDescriptor{Width: 4, Height: 2, Dimension: TextureDimension2DArray, DepthOrArrayLayers: 3, Format: R8Unorm}, R8Unorm, 3, 1},
+		{TextureDescriptor{Width: 2, Height: 2, Dimension: TextureDimension3D, DepthOrArrayLayers: 8, MipLevelCount: 4, Format: RGBA16Float}, RGBA16Float, 8, 4},
+		{TextureDescriptor{Width: 4, Height: 4, RenderTarget: true, SampleCount: 4}, RGBA8Unorm, 1, 1},
+		{TextureDescriptor{Width: 4, Height: 4, Format: Depth32Float, SampleCount: 4}, Depth32Float, 1, 1},
+	} {
+		got, err := c.desc.normalize()
+		if err != nil {
+			t.Errorf("normalize(%+v): %v", c.desc, err)
+			continue
+		}
+		if got.Format != c.format || got.DepthOrArrayLayers != c.layers || got.MipLevelCount != c.levels ||
+			got.SampleCount != max(c.desc.SampleCount, 1) {
+			t.Errorf("normalize(%+v) = format %d, %d layers, %d levels, %d samples; want %d, %d, %d",
+				c.desc, got.Format, got.DepthOrArrayLayers, got.MipLevelCount, got.SampleCount, c.format, c.layers, c.levels)
+		}
+	}
+
+	for _, c := range []struct {
+		desc TextureDescriptor
+		err  string
+	}{
+		{TextureDescriptor{Width: 4, Height: 2, Dimension: TextureDimensionCube}, "square"},
+		{TextureDescriptor{Width: 4, Height: 4, Dimension: TextureDimensionCube, DepthOrArrayLayers: 4}, "6 layers"},
+		{TextureDescriptor{Width: 4, Height: 4, DepthOrArrayLayers: 2}, "one layer"},
+		{TextureDescriptor{Width: 4, Height: 4, MipLevelCount: 4}, "mip level count"},
+		{TextureDescriptor{Width: 4, Height: 4, Format: Depth24Stencil8, Dimension: TextureDimension2DArray}, "depth texture"},
+		{TextureDescriptor{Width: 4, Height: 4, Dimension: TextureDimension3D, RenderTarget: true}, "render target"},
+		{TextureDescriptor{Width: 4, Height: 4, Format: BGRA8UnormSRGB + 1}, "format"},
+		{TextureDescriptor{Width: 4, Height: 4, Dimension: TextureDimension3D + 1}, "dimension"},
+		{TextureDescriptor{Width: 4, Height: 4, RenderTarget: true, SampleCount: 2}, "sample count"},
+		{TextureDescriptor{Width: 4, Height: 4, SampleCount: 4}, "render target or depth"},
+		{TextureDescriptor{Width: 4, Height: 4, RenderTarget: true, SampleCount: 4, MipLevelCount: 2}, "one mip level"},
+		{TextureDescriptor{Width: 4, Height: 4, Dimension: TextureDimension2DArray, DepthOrArrayLayers: 2, SampleCount: 4, Format: Depth32Float}, "depth texture"},
+	} {
+		if _, err := c.desc.normalize(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("normalize(%+v) error = %v, want one mentioning %q", c.desc, err, c.err)
+		}
+	}
+}
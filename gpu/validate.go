@@ -0,0 +1,468 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// WithValidation turns on the validation layer: the device then checks how
+// its command encoders and buffers are used, and the driver's own validation
+// (Vulkan's VK_LAYER_KHRONOS_validation, GL's KHR_debug output) is enabled
+// where it is installed.
+//
+// The layer catches, besides what the Device API always rejects:
+//   - commands recorded outside a pass of their kind (a Draw after the
+//     RenderPass ended), or after the encoder finished, and an encoder
+//     finished with a pass still open;
+//   - a Dispatch or draw before SetPipeline, and an indexed draw before
+//     SetIndexBuffer;
+//   - a buffer used, or submitted, after Buffer.Release, and one released
+//     twice;
+//   - a buffer used without the usage its command needs: BufferStorage or
+//     BufferUniform for a binding, BufferStorage for a vertex buffer,
+//     BufferIndex, BufferCopySrc and BufferCopyDst for their commands;
+//   - a Dispatch or draw whose bind group has a buffer range smaller than
+//     the kernel's binding reads (shader.Binding.MinSize), where the bind
+//     group's layout declares no MinBindingSize;
+//   - a command buffer submitted twice.
+//
+// A command buffer with a misuse is invalid: Queue.Submit reports the first
+// misuse as a validation Error (see PushErrorScope) and does not run it. The
+// driver's error messages are reported with the errors of the next
+// Queue.Submit. Validation costs CPU time on every command, so leave it off
+// outside of development.
+func WithValidation(on bool) Option {
+	return func(c *config) { c.validation = on }
+}
+
+// validBackend is the validation layer: a backend wrapping another whose
+// buffers and command buffers check their use.
+type validBackend struct {
+	backend
+	errorHandler
+}
+
+func (v *validBackend) setErrorHandler(fn func(error)) {
+	v.errorHandler.setErrorHandler(fn)
+	v.backend.setErrorHandler(fn)
+}
+
+func (v *validBackend) newBuffer(size int, usage BufferUsage, data []byte) (backendBuffer, error) {
+	b, err := v.backend.newBuffer(size, usage, data)
+	if err != nil {
+		return nil, err
+	}
+	return &validBuffer{backendBuffer: b, v: v, usage: usage}, nil
+}
+
+func (v *validBackend) newCommandBuffer() backendCommandBuffer {
+	return &validCmd{cmd: v.backend.newCommandBuffer(), v: v}
+}
+
+// validationError returns a validation Error of the formatted message.
+func validationError(format string, args ...any) *Error {
+	return &Error{Filter: ErrorFilterValidation, Err: fmt.Errorf("gpu: "+format, args...)}
+}
+
+// validBuffer is a buffer of the validation layer, which knows its usage and
+// whether it was released.
+type validBuffer struct {
+	backendBuffer
+	v        *validBackend
+	usage    BufferUsage
+	released atomic.Bool
+}
+
+// alive reports whether b was not released, and reports the error of op
+// otherwise.
+func (b *validBuffer) alive(op string) bool {
+	if b.released.Load() {
+		b.v.report(validationError("%s of a released buffer", op))
+		return false
+	}
+	return true
+}
+
+func (b *validBuffer) bytes() []byte {
+	if !b.alive("Buffer.Bytes") {
+		return nil
+	}
+	return b.backendBuffer.bytes()
+}
+
+func (b *validBuffer) read(offset int, p []byte) {
+	if b.alive("a read") {
+		b.backendBuffer.read(offset, p)
+	}
+}
+
+func (b *validBuffer) write(offset int, p []byte) {
+	if b.alive("a write") {
+		b.backendBuffer.write(offset, p)
+	}
+}
+
+func (b *validBuffer) release() {
+	if !b.released.CompareAndSwap(false, true) {
+		b.v.report(validationError("Buffer.Release of a released buffer"))
+		return
+	}
+	b.backendBuffer.release()
+}
+
+// passKind is the kind of pass a command encoder has open.
+type passKind int
+
+const (
+	passNone passKind = iota
+	passCompute
+	passRender
+)
+
+func (k passKind) String() string {
+	switch k {
+	case passCompute:
+		return "compute"
+	case passRender:
+		return "render"
+	}
+	return "no"
+}
+
+// validCmd is a command buffer of the validation layer. It forwards the
+// commands to the backend's until the first misuse, which invalidates it.
+type validCmd struct {
+	cmd backendCommandBuffer
+	v   *validBackend
+
+	pass      passKind
+	pipeline  bool                // the open pass has a pipeline
+	index     bool                // the open render pass has an index buffer
+	kernel    *BindGroupLayout    // the kernel bindings of the pipeline, or nil
+	bound     map[bindingSlot]int // the range sizes bound in the open pass
+	finished  bool
+	committed bool
+	bufs      []*validBuffer // the buffers of the commands, checked at commit
+	err       *Error         // the first misuse
+}
+
+// fail records a misuse of the command buffer, unless it has one already.
+func (c *validCmd) fail(format string, args ...any) {
+	if c.err == nil {
+		c.err = validationError(format, args...)
+	}
+}
+
+// record reports whether command op can be recorded: the command buffer is
+// valid and not finished, and the open pass is of kind want (passNone for
+// the commands between passes).
+func (c *validCmd) record(op string, want passKind) bool {
+	switch {
+	case c.err != nil:
+	case c.finished:
+		c.fail("%s after the command encoder finished", op)
+	case c.pass != want && want == passNone:
+		c.fail("%s inside a %v pass", op, c.pass)
+	case c.pass != want:
+		c.fail("%s outside a %v pass", op, want)
+	}
+	return c.err == nil
+}
+
+// use checks that buffer b of command op is alive and has one of the usage
+// bits of usage, named name, and returns the buffer it wraps.
+func (c *validCmd) use(op string, b backendBuffer, usage BufferUsage, name string) backendBuffer {
+	vb := b.(*validBuffer)
+	switch {
+	case vb.released.Load():
+		c.fail("%s of a released buffer", op)
+	case vb.usage&usage == 0:
+		c.fail("%s of a buffer without %s usage", op, name)
+	}
+	c.bufs = append(c.bufs, vb)
+	return vb.backendBuffer
+}
+
+// drawable reports whether draw op can be recorded; indexed draws also need
+// an index buffer.
+func (c *validCmd) drawable(op string, indexed bool) bool {
+	if !c.record(op, passRender) {
+		return false
+	}
+	switch {
+	case !c.pipeline:
+		c.fail("%s without SetPipeline", op)
+	case indexed && !c.index:
+		c.fail("%s without SetIndexBuffer", op)
+	default:
+		c.sized(op)
+	}
+	return c.err == nil
+}
+
+// bind records the range size bound to the kind binding at index in the
+// open pass.
+func (c *validCmd) bind(index int, kind BindingKind, size int) {
+	if c.bound == nil {
+		c.bound = map[bindingSlot]int{}
+	}
+	c.bound[bindingSlot{index, kind}] = size
+}
+
+// sized reports whether the buffers bound for command op hold what the
+// pipeline's kernels read of them.
+func (c *validCmd) sized(op string) bool {
+	if c.kernel == nil {
+		return true
+	}
+	for _, le := range c.kernel.entries {
+		if size, ok := c.bound[bindingSlot{le.Binding, le.Kind}]; ok && size < le.MinBindingSize {
+			c.fail("%s with %d bytes bound to %v binding %d, fewer than the %d its kernel reads", op, size, le.Kind, le.Binding, le.MinBindingSize)
+			return false
+		}
+	}
+	return true
+}
+
+func (c *validCmd) beginCompute(ts *passTimestamps) {
+	if c.record("BeginComputePass", passNone) {
+		c.pass, c.pipeline, c.kernel, c.bound = passCompute, false, nil, nil
+		c.cmd.beginCompute(ts)
+	}
+}
+
+func (c *validCmd) setComputePipeline(p backendComputePipeline, kernel *BindGroupLayout) {
+	if c.record("ComputePass.SetPipeline", passCompute) {
+		c.pipeline, c.kernel = true, kernel
+		c.cmd.setComputePipeline(p, kernel)
+	}
+}
+
+func (c *validCmd) setBuffer(b backendBuffer, offset, size, index int, kind BindingKind) {
+	if !c.record("ComputePass.SetBindGroup", passCompute) {
+		return
+	}
+	bb := c.use("ComputePass.SetBindGroup", b, BufferStorage|BufferUniform, "BufferStorage or BufferUniform")
+	if c.err == nil {
+		c.bind(index, kind, size)
+		c.cmd.setBuffer(bb, offset, size, index, kind)
+	}
+}
+
+func (c *validCmd) setComputeTexture(index int, t backendTexture) {
+	if c.record("ComputePass.SetTexture", passCompute) {
+		c.cmd.setComputeTexture(index, t)
+	}
+}
+
+func (c *validCmd) setComputeSampler(index int, s backendSampler) {
+	if c.record("ComputePass.SetSampler", passCompute) {
+		c.cmd.setComputeSampler(index, s)
+	}
+}
+
+func (c *validCmd) dispatch(x, y, z int) {
+	if !c.record("Dispatch", passCompute) {
+		return
+	}
+	if !c.pipeline {
+		c.fail("Dispatch without SetPipeline")
+		return
+	}
+	if c.sized("Dispatch") {
+		c.cmd.dispatch(x, y, z)
+	}
+}
+
+func (c *validCmd) dispatchIndirect(b backendBuffer, offset int) {
+	if !c.record("DispatchIndirect", passCompute) {
+		return
+	}
+	if !c.pipeline {
+		c.fail("DispatchIndirect without SetPipeline")
+		return
+	}
+	if !c.sized("DispatchIndirect") {
+		return
+	}
+	bb := c.use("DispatchIndirect", b, BufferIndirect, "BufferIndirect")
+	if c.err == nil {
+		c.cmd.dispatchIndirect(bb, offset)
+	}
+}
+
+func (c *validCmd) endCompute() {
+	if c.record("ComputePass.End", passCompute) {
+		c.pass = passNone
+		c.cmd.endCompute()
+	}
+}
+
+func (c *validCmd) beginRender(info renderPassInfo) {
+	if c.record("BeginRenderPass", passNone) {
+		c.pass, c.pipeline, c.index, c.kernel, c.bound = passRender, false, false, nil, nil
+		c.cmd.beginRender(info)
+	}
+}
+
+func (c *validCmd) setRenderPipeline(p backendRenderPipeline, kernel *BindGroupLayout) {
+	if c.record("RenderPass.SetPipeline", passRender) {
+		c.pipeline, c.kernel = true, kernel
+		c.cmd.setRenderPipeline(p, kernel)
+	}
+}
+
+func (c *validCmd) setRenderBuffer(b backendBuffer, offset, size, index int, kind BindingKind) {
+	if !c.record("RenderPass.SetBindGroup", passRender) {
+		return
+	}
+	bb := c.use("RenderPass.SetBindGroup", b, BufferStorage|BufferUniform, "BufferStorage or BufferUniform")
+	if c.err == nil {
+		c.bind(index, kind, size)
+		c.cmd.setRenderBuffer(bb, offset, size, index, kind)
+	}
+}
+
+func (c *validCmd) setVertexBuffer(b backendBuffer, offset, size, index int) {
+	if !c.record("SetVertexBuffer", passRender) {
+		return
+	}
+	// Vertex kernels read their vertex buffers as storage.
+	bb := c.use("SetVertexBuffer", b, BufferStorage, "BufferStorage")
+	if c.err == nil {
+		c.cmd.setVertexBuffer(bb, offset, size, index)
+	}
+}
+
+func (c *validCmd) draw(prim Primitive, start, count, firstInstance, instanceCount int) {
+	if c.drawable("Draw", false) {
+		c.cmd.draw(prim, start, count, firstInstance, instanceCount)
+	}
+}
+
+func (c *validCmd) setIndexBuffer(b backendBuffer, offset int, format IndexFormat) {
+	if !c.record("SetIndexBuffer", passRender) {
+		return
+	}
+	bb := c.use("SetIndexBuffer", b, BufferIndex, "BufferIndex")
+	if c.err == nil {
+		c.index = true
+		c.cmd.setIndexBuffer(bb, offset, format)
+	}
+}
+
+func (c *validCmd) drawIndexed(prim Primitive, firstIndex, count, baseVertex, firstInstance, instanceCount int) {
+	if c.drawable("DrawIndexed", true) {
+		c.cmd.drawIndexed(prim, firstIndex, count, baseVertex, firstInstance, instanceCount)
+	}
+}
+
+func (c *validCmd) drawIndirect(prim Primitive, b backendBuffer, offset int) {
+	if !c.drawable("DrawIndirect", false) {
+		return
+	}
+	bb := c.use("DrawIndirect", b, BufferIndirect, "BufferIndirect")
+	if c.err == nil {
+		c.cmd.drawIndirect(prim, bb, offset)
+	}
+}
+
+func (c *validCmd) drawIndexedIndirect(prim Primitive, b backendBuffer, offset int) {
+	if !c.drawable("DrawIndexedIndirect", true) {
+		return
+	}
+	bb := c.use("DrawIndexedIndirect", b, BufferIndirect, "BufferIndirect")
+	if c.err == nil {
+		c.cmd.drawIndexedIndirect(prim, bb, offset)
+	}
+}
+
+func (c *validCmd) beginOcclusionQuery(index int) {
+	if c.record("BeginOcclusionQuery", passRender) {
+		c.cmd.beginOcclusionQuery(index)
+	}
+}
+
+func (c *validCmd) endOcclusionQuery() {
+	if c.record("EndOcclusionQuery", passRender) {
+		c.cmd.endOcclusionQuery()
+	}
+}
+
+func (c *validCmd) endRender() {
+	if c.record("RenderPass.End", passRender) {
+		c.pass = passNone
+		c.cmd.endRender()
+	}
+}
+
+func (c *validCmd) copyBufferToBuffer(src backendBuffer, srcOffset int, dst backendBuffer, dstOffset, size int) {
+	if !c.record("CopyBufferToBuffer", passNone) {
+		return
+	}
+	s := c.use("CopyBufferToBuffer", src, BufferCopySrc, "BufferCopySrc")
+	d := c.use("CopyBufferToBuffer", dst, BufferCopyDst, "BufferCopyDst")
+	if c.err == nil {
+		c.cmd.copyBufferToBuffer(s, srcOffset, d, dstOffset, size)
+	}
+}
+
+func (c *validCmd) copyBufferToTexture(src backendBuffer, offset, bytesPerRow int, dst backendTexture, x, y, w, h int) {
+	if !c.record("CopyBufferToTexture", passNone) {
+		return
+	}
+	s := c.use("CopyBufferToTexture", src, BufferCopySrc, "BufferCopySrc")
+	if c.err == nil {
+		c.cmd.copyBufferToTexture(s, offset, bytesPerRow, dst, x, y, w, h)
+	}
+}
+
+func (c *validCmd) copyTextureToBuffer(src backendTexture, x, y int, dst backendBuffer, offset, bytesPerRow, w, h int) {
+	if !c.record("CopyTextureToBuffer", passNone) {
+		return
+	}
+	d := c.use("CopyTextureToBuffer", dst, BufferCopyDst, "BufferCopyDst")
+	if c.err == nil {
+		c.cmd.copyTextureToBuffer(src, x, y, d, offset, bytesPerRow, w, h)
+	}
+}
+
+func (c *validCmd) copyTextureToTexture(src backendTexture, sx, sy int, dst backendTexture, dx, dy, w, h int) {
+	if c.record("CopyTextureToTexture", passNone) {
+		c.cmd.copyTextureToTexture(src, sx, sy, dst, dx, dy, w, h)
+	}
+}
+
+func (c *validCmd) finish() {
+	if c.record("Finish", passNone) {
+		c.finished = true
+		c.cmd.finish()
+	}
+}
+
+// commit reports the misuse of an invalid command buffer instead of
+// committing it.
+func (c *validCmd) commit() {
+	err := c.err
+	switch {
+	case c.committed:
+		err = validationError("Submit of a command buffer submitted before")
+	case err == nil:
+		for _, b := range c.bufs {
+			if b.released.Load() {
+				err = validationError("Submit of a command buffer using a buffer released after it was recorded")
+				break
+			}
+		}
+	}
+	c.committed = true
+	if err != nil {
+		c.v.report(err)
+		return
+	}
+	c.cmd.commit()
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package gpu_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestGLValidation runs a kernel on a GL device with validation, then binds a
+// texture to a unit GL does not have: the layer passes it to the driver, and
+// Submit reports the GL error with KHR_debug's message about it.
+func TestGLValidation(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL backend conformance test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL), gpu.WithValidation(true))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+	var uncaptured []*gpu.Error
+	dev.OnUncapturedError(func(err *gpu.Error) { uncaptured = append(uncaptured, err) })
+
+	const src = `package kernels
+func Add(gid uint, a []float32, b []float32, out []float32) { out[gid] = a[gid] + b[gid] }`
+	out := runGLKernel(t, dev, src, "Add", 4, [][]float32{{1, 2, 3, 4}, {4, 3, 2, 1}, make([]float32, 4)}, 2)
+	for i, v := range out {
+		if v != 5 {
+			t.Fatalf("out[%d] = %v, want 5", i, v)
+		}
+	}
+	if len(uncaptured) != 0 {
+		t.Fatalf("valid work reported %v", uncaptured)
+	}
+
+	tex, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA8Unorm, Width: 1, Height: 1})
+	if err != nil {
+		t.Fatalf("NewTexture: %v", err)
+	}
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetTexture(1<<12, tex)
+	cp.End()
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	dev.Queue().Submit(enc.Finish())
+	err = dev.PopErrorScope()
+	if err == nil || !strings.Contains(err.Error(), "GL_INVALID_ENUM") {
+		t.Fatalf("Submit reported %v, want GL_INVALID_ENUM", err)
+	}
+	t.Logf("reported: %v", err)
+}
@@ -0,0 +1,216 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpu_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// validKernels are the kernels of the validation tests: Fill writes the
+// thread index to out, Tint the red of its uniform.
+const validKernels = `package kernels
+
+type Vec4 struct{ X, Y, Z, W float32 }
+
+type Params struct{ Color Vec4 }
+
+func Fill(gid uint, out []float32) {
+	out[gid] = float32(gid + 1)
+}
+
+func Tint(gid uint, p Params, out []float32) {
+	out[gid] = p.Color.X
+}
+`
+
+// TestValidation records each misuse the validation layer catches on the
+// software driver and checks that Submit reports it, naming the call, and
+// does not run the command buffer.
+func TestValidation(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware), gpu.WithValidation(true))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer dev.Close()
+	fill, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, validKernels, "Fill")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	newBuffer := func(usage gpu.BufferUsage) *gpu.Buffer {
+		b, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: usage})
+		if err != nil {
+			t.Fatalf("NewBuffer: %v", err)
+		}
+		return b
+	}
+	out := newBuffer(gpu.BufferStorage | gpu.BufferCopySrc)
+	bg, err := dev.NewBindGroup(fill.BindGroupLayout(0), gpu.BindGroupEntry{Binding: 0, Buffer: out})
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	// dispatch records a Fill of out, optionally without its pipeline.
+	dispatch := func(enc *gpu.CommandEncoder, pipeline bool) {
+		cp := enc.BeginComputePass()
+		if pipeline {
+			cp.SetPipeline(fill)
+		}
+		cp.SetBindGroup(0, bg)
+		cp.Dispatch(4, 1, 1)
+		cp.End()
+	}
+	color := softwareTarget(t, dev, gpu.RGBA8Unorm, 4, 4, 1)
+	draw := softwarePipeline(t, dev, "V", gpu.RenderPipelineDescriptor{})
+
+	for _, tc := range []struct {
+		name, want string
+		record     func(enc *gpu.CommandEncoder)
+	}{
+		{"no pipeline", "Dispatch without SetPipeline", func(enc *gpu.CommandEncoder) {
+			dispatch(enc, false)
+		}},
+		{"draw after end", "Draw outside a render pass", func(enc *gpu.CommandEncoder) {
+			rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear})
+			rp.SetPipeline(draw)
+			rp.End()
+			rp.Draw(gpu.TriangleList, 0, 3)
+		}},
+		{"indexed draw without index buffer", "DrawIndexed without SetIndexBuffer", func(enc *gpu.CommandEncoder) {
+			rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear})
+			rp.SetPipeline(draw)
+			rp.DrawIndexed(gpu.TriangleList, 0, 3, 0)
+			rp.End()
+		}},
+		{"open pass", "Finish inside a compute pass", func(enc *gpu.CommandEncoder) {
+			dispatch(enc, true)
+			enc.BeginComputePass()
+		}},
+		{"released buffer", "SetVertexBuffer of a released buffer", func(enc *gpu.CommandEncoder) {
+			b := newBuffer(gpu.BufferStorage)
+			b.Release()
+			rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear})
+			rp.SetVertexBuffer(0, b)
+			rp.End()
+		}},
+		{"released after recording", "released after it was recorded", func(enc *gpu.CommandEncoder) {
+			b := newBuffer(gpu.BufferCopyDst)
+			enc.CopyBufferToBuffer(out, 0, b, 0, 16)
+			b.Release()
+		}},
+		{"usage", "CopyBufferToBuffer of a buffer without BufferCopyDst usage", func(enc *gpu.CommandEncoder) {
+			enc.CopyBufferToBuffer(out, 0, newBuffer(gpu.BufferStorage), 0, 16)
+		}},
+		{"index usage", "SetIndexBuffer of a buffer without BufferIndex usage", func(enc *gpu.CommandEncoder) {
+			rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{ColorTexture: color, Load: gpu.LoadClear})
+			rp.SetIndexBuffer(out, gpu.IndexUint16)
+			rp.End()
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			copy(out.Bytes(), make([]byte, 16))
+			enc := dev.NewCommandEncoder()
+			// A valid dispatch first, which must not run either.
+			dispatch(enc, true)
+			tc.record(enc)
+			dev.PushErrorScope(gpu.ErrorFilterValidation)
+			submit(dev, enc)
+			err := dev.PopErrorScope()
+			var e *gpu.Error
+			if !errors.As(err, &e) || e.Filter != gpu.ErrorFilterValidation || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Submit reported %v, want a validation error containing %q", err, tc.want)
+			}
+			if got := parityFloats(out.Bytes(), 4); got[0] != 0 {
+				t.Errorf("the invalid command buffer ran: out = %v", got)
+			}
+		})
+	}
+
+	// A valid command buffer runs, once.
+	enc := dev.NewCommandEncoder()
+	dispatch(enc, true)
+	cb := enc.Finish()
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	dev.Queue().Submit(cb)
+	dev.Queue().WaitIdle()
+	if err := dev.PopErrorScope(); err != nil {
+		t.Fatalf("valid Submit reported %v", err)
+	}
+	if got := parityFloats(out.Bytes(), 4); got[3] != 4 {
+		t.Errorf("out = %v, want 1 2 3 4", got)
+	}
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	dev.Queue().Submit(cb)
+	if err := dev.PopErrorScope(); err == nil || !strings.Contains(err.Error(), "submitted before") {
+		t.Errorf("second Submit reported %v", err)
+	}
+
+	// Buffer misuse outside command buffers.
+	b := newBuffer(gpu.BufferStorage)
+	b.Release()
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	if got := b.Bytes(); got != nil {
+		t.Errorf("Bytes of a released buffer = %v, want nil", got)
+	}
+	if err := dev.PopErrorScope(); err == nil {
+		t.Error("Bytes of a released buffer reported nothing")
+	}
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	b.Release()
+	if err := dev.PopErrorScope(); err == nil || !strings.Contains(err.Error(), "Release of a released buffer") {
+		t.Errorf("second Release reported %v", err)
+	}
+}
+
+// TestValidationBindingSize binds a 4-byte buffer to the Vec4 uniform of a
+// kernel: NewBindGroup rejects it for the kernel's own layout, and a
+// dispatch through a layout without MinBindingSize fails its submission.
+func TestValidationBindingSize(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware), gpu.WithValidation(true))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer dev.Close()
+	tint, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: softwareModule(t, dev, validKernels, "Tint")})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	small, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 4, Usage: gpu.BufferUniform})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: 16, Usage: gpu.BufferStorage})
+	if err != nil {
+		t.Fatalf("NewBuffer: %v", err)
+	}
+	entries := []gpu.BindGroupEntry{{Binding: 0, Buffer: small}, {Binding: 1, Buffer: out}}
+	if _, err := dev.NewBindGroup(tint.BindGroupLayout(0), entries...); err == nil || !strings.Contains(err.Error(), "fewer than the 16") {
+		t.Errorf("NewBindGroup of the kernel's layout = %v, want a minimum size error", err)
+	}
+
+	layout := dev.NewBindGroupLayout(
+		gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageCompute, Kind: gpu.UniformBuffer},
+		gpu.BindGroupLayoutEntry{Binding: 1, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
+	)
+	bg, err := dev.NewBindGroup(layout, entries...)
+	if err != nil {
+		t.Fatalf("NewBindGroup: %v", err)
+	}
+	enc := dev.NewCommandEncoder()
+	cp := enc.BeginComputePass()
+	cp.SetPipeline(tint)
+	cp.SetBindGroup(0, bg)
+	cp.Dispatch(4, 1, 1)
+	cp.End()
+	dev.PushErrorScope(gpu.ErrorFilterValidation)
+	submit(dev, enc)
+	err = dev.PopErrorScope()
+	var e *gpu.Error
+	if !errors.As(err, &e) || e.Filter != gpu.ErrorFilterValidation || !strings.Contains(err.Error(), "Dispatch with 4 bytes bound to uniform buffer binding 0, fewer than the 16") {
+		t.Fatalf("Submit reported %v, want a validation error for the 4-byte uniform", err)
+	}
+}
@@ -16,7 +16,7 @@ import (
 // (the darwin runtime, as opposed to GL which is the CI oracle): a full Render() with
 // a Metal device must run BOTH the forward and deferred passes on the GPU (not fall
 // back to the CPU) and match the all-CPU render within the measured parity tolerance.
-// It exercises the MSL forward shaders (fwdGBufMSL) and, in particular, pins the
+// It exercises the forward kernels compiled to MSL and, in particular, pins the
 // Metal front-facing / back-face-cull convention against the CPU: if it were
 // inverted the bunny would render inside-out and blow past the tolerance.
 func TestGPUForwardMetal(t *testing.T) {
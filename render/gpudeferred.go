@@ -81,7 +81,17 @@ func matAt(table []*material.BlinnPhong, id int64) *material.BlinnPhong {
 	return table[id]
 }
 
-func gpuDeferredShade(dev *gpu.Device, buf *buffer.FragmentBuffer, ls []light.Source, es []light.Environment, camPos math.Vec3[float32], bg color.RGBA, shadow *gpuShadowData, matTable []*material.BlinnPhong) error {
+// deferredStages is the most GPU passes gpuDeferredShade submits: Shade,
+// Shadow, AO, Quantize and SRGB.
+const deferredStages = 5
+
+// gpuDeferredShade shades buf on the GPU (see the comment above matAt). With
+// gamma set it also runs the renderer's gamma pass in the same submission, so
+// buf receives gamma-corrected colors and passAntialiasing skips its own.
+// Each kernel's compute pass is timed by timer, under the kernel's name.
+// The G-buffer and the other kernel inputs are uploaded to res's pool, and
+// the kernels' outputs are res's buffers.
+func gpuDeferredShade(res *gpuResources, timer *gpuTimer, buf *buffer.FragmentBuffer, ls []light.Source, es []light.Environment, camPos math.Vec3[float32], bg color.RGBA, shadow *gpuShadowData, matTable []*material.BlinnPhong, gamma bool) error {
 	var lightData []float32
 	for _, l := range ls {
 		switch lt := l.(type) {
@@ -191,29 +201,119 @@ func gpuDeferredShade(dev *gpu.Device, buf *buffer.FragmentBuffer, ls []light.So
 
 	scene := []float32{camPos.X, camPos.Y, camPos.Z, 1, ambientI, float32(len(ls)), 0, 0}
 
-	shaded, err := runDeferredKernel(dev, n, normals, worldpos, basecol, lightData, matidx, materials, scene)
+	// Shade, shadow and AO run back to back over one shaded float buffer, and
+	// with gamma the Quantize+SRGB hand-off follows, all in one command buffer:
+	// the only CPU transfer is the final readback copy.
+	dev := res.dev
+	// A failed upload leaves a zero slice, which encodeKernel's NewBindGroup
+	// rejects.
+	in := func(d []float32) gpu.BufferSlice {
+		s, _ := res.upload(d)
+		return s
+	}
+	if len(materials) == 0 {
+		materials = make([]float32, 9)
+	}
+	shadedBuf, err := res.buffer("deferred shaded", n*4*4, gpu.BufferStorage|gpu.BufferCopySrc)
+	if err != nil {
+		return err
+	}
+	shadedSlice := shadedBuf.Slice(0, 0)
+	readSize := n * 4 * 4
+	if gamma {
+		readSize += n * 3 * 4
+	}
+	readback, err := res.buffer("deferred readback", readSize, gpu.BufferCopyDst|gpu.BufferMapRead)
 	if err != nil {
 		return err
 	}
 
+	enc := dev.NewCommandEncoder()
+	if err := encodeKernel(res, enc, timer, kernels.ShadeSrc, "Shade", n,
+		in(normals), in(worldpos), in(basecol), in(lightData), in(matidx), in(materials), in(scene), shadedSlice); err != nil {
+		return err
+	}
+	var selfCheckBuf *gpu.Buffer
 	if debugDeferredSelfCheck {
-		deferredSelfCheck(n, okMask, passthrough, normals, worldpos, basecol, lightData, matidx, materials, scene, shaded)
+		// The self-check compares the Shade output alone, before shadow and AO.
+		if selfCheckBuf, err = res.buffer("deferred self-check", n*4*4, gpu.BufferCopyDst|gpu.BufferMapRead); err != nil {
+			return err
+		}
+		enc.CopyBufferToBuffer(shadedBuf, 0, selfCheckBuf, 0, n*4*4)
+	}
+	var fragBuf gpu.BufferSlice
+	if shadow != nil || anyAO {
+		fragBuf = in(fragxyz)
 	}
-
 	// Apply shadows as a second pass over the shaded float buffer.
 	if shadow != nil {
+		depths, mats := shadow.depths, shadow.mats
+		if len(depths) == 0 {
+			depths = []float32{0}
+		}
+		if len(mats) == 0 {
+			mats = []float32{0}
+		}
 		su := []float32{float32(shadow.width), float32(shadow.dlen), float32(shadow.n), 0}
-		if err := runShadowKernel(dev, n, fragxyz, recv, shadow.depths, shadow.mats, shaded, su); err != nil {
+		if err := encodeKernel(res, enc, timer, kernels.ShadowSrc, "Shadow", n,
+			fragBuf, in(recv), in(depths), in(mats), shadedSlice, in(su)); err != nil {
 			return err
 		}
 	}
-
 	// Apply SSAO as a final pass.
 	if anyAO {
 		au := []float32{float32(w), float32(h), 0, 0}
-		if err := runAOKernel(dev, n, fragxyz, aoflag, depthbuf, shaded, au); err != nil {
+		if err := encodeKernel(res, enc, timer, kernels.AOSrc, "AO", n,
+			fragBuf, in(aoflag), in(depthbuf), shadedSlice, in(au)); err != nil {
+			return err
+		}
+	}
+	enc.CopyBufferToBuffer(shadedBuf, 0, readback, 0, n*4*4)
+	if gamma {
+		// Background and unshaded fragments carry their final color into the
+		// gamma pass; preset[idx*4+3] < 0 marks a shaded fragment.
+		preset := make([]float32, n*4)
+		for idx := 0; idx < n; idx++ {
+			c := bg
+			switch {
+			case passthrough[idx]:
+				c = passCol[idx]
+			case okMask[idx]:
+				preset[idx*4+3] = -1
+				continue
+			}
+			preset[idx*4], preset[idx*4+1], preset[idx*4+2], preset[idx*4+3] = float32(c.R), float32(c.G), float32(c.B), float32(c.A)
+		}
+		quantized, err := res.buffer("deferred quantized", n*3*4, gpu.BufferStorage)
+		if err != nil {
+			return err
+		}
+		srgb, err := res.buffer("deferred srgb", n*3*4, gpu.BufferStorage|gpu.BufferCopySrc)
+		if err != nil {
+			return err
+		}
+		if err := encodeKernel(res, enc, timer, kernels.QuantizeSrc, "Quantize", n, shadedSlice, in(preset), quantized.Slice(0, 0)); err != nil {
+			return err
+		}
+		if err := encodeKernel(res, enc, timer, kernels.SRGBSrc, "SRGB", n*3, quantized.Slice(0, 0), srgb.Slice(0, 0)); err != nil {
 			return err
 		}
+		enc.CopyBufferToBuffer(srgb, 0, readback, n*4*4, n*3*4)
+	}
+	dev.Queue().Submit(enc.Finish())
+	dev.Queue().WaitIdle()
+
+	raw := readback.Bytes()
+	shaded := unsafe.Slice((*float32)(unsafe.Pointer(&raw[0])), n*4)
+	var corrected []float32
+	if gamma {
+		corrected = unsafe.Slice((*float32)(unsafe.Pointer(&raw[n*4*4])), n*3)
+	}
+
+	if debugDeferredSelfCheck {
+		sc := selfCheckBuf.Bytes()
+		deferredSelfCheck(n, okMask, passthrough, normals, worldpos, basecol, lightData, matidx, materials, scene,
+			unsafe.Slice((*float32)(unsafe.Pointer(&sc[0])), n*4))
 	}
 
 	for y := 0; y < h; y++ {
@@ -233,6 +333,11 @@ func gpuDeferredShade(dev *gpu.Device, buf *buffer.FragmentBuffer, ls []light.So
 			default:
 				info.Col = bg
 			}
+			if gamma {
+				info.Col.R = toU8(corrected[idx*3])
+				info.Col.G = toU8(corrected[idx*3+1])
+				info.Col.B = toU8(corrected[idx*3+2])
+			}
 			buf.UnsafeSet(x, y, info)
 		}
 	}
@@ -243,182 +348,30 @@ func toByte(v float32) uint8 {
 	return uint8(math.Clamp(float32(math.Round(v)), 0, 255))
 }
 
-func runDeferredKernel(dev *gpu.Device, n int, normals, worldpos, basecol, lights, matidx, materials, scene []float32) ([]float32, error) {
-	mod, err := kernelModule(dev, kernels.ShadeSrc, "Shade")
-	if err != nil {
-		return nil, err
-	}
-	sb := func(i int) gpu.BindGroupLayoutEntry {
-		return gpu.BindGroupLayoutEntry{Binding: i, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer}
-	}
-	layout := dev.NewBindGroupLayout(
-		sb(0), sb(1), sb(2), sb(3), sb(4), sb(5), sb(6), sb(7),
-	)
-	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "Shade"})
-	if err != nil {
-		return nil, err
-	}
-
-	if len(lights) == 0 {
-		lights = []float32{0}
-	}
-	if len(materials) == 0 {
-		materials = make([]float32, 9)
-	}
-	nb := storageBuf(dev, normals)
-	wb := storageBuf(dev, worldpos)
-	cb := storageBuf(dev, basecol)
-	lb := storageBuf(dev, lights)
-	mib := storageBuf(dev, matidx)
-	mtb := storageBuf(dev, materials)
-	scb := storageBuf(dev, scene)
-	out, err := dev.NewBuffer(gpu.BufferDescriptor{Size: n * 4 * 4, Usage: gpu.BufferStorage | gpu.BufferMapRead})
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		nb.Release()
-		wb.Release()
-		cb.Release()
-		lb.Release()
-		mib.Release()
-		mtb.Release()
-		scb.Release()
-		out.Release()
-	}()
-
-	bg := dev.NewBindGroup(layout,
-		gpu.BindGroupEntry{Binding: 0, Buffer: nb},
-		gpu.BindGroupEntry{Binding: 1, Buffer: wb},
-		gpu.BindGroupEntry{Binding: 2, Buffer: cb},
-		gpu.BindGroupEntry{Binding: 3, Buffer: lb},
-		gpu.BindGroupEntry{Binding: 4, Buffer: mib},
-		gpu.BindGroupEntry{Binding: 5, Buffer: mtb},
-		gpu.BindGroupEntry{Binding: 6, Buffer: scb},
-		gpu.BindGroupEntry{Binding: 7, Buffer: out},
-	)
-	enc := dev.NewCommandEncoder()
-	cp := enc.BeginComputePass()
-	cp.SetPipeline(pipe)
-	cp.SetBindGroup(0, bg)
-	cp.Dispatch(n, 1, 1)
-	cp.End()
-	dev.Queue().Submit(enc.Finish())
-	dev.Queue().WaitIdle()
-
-	res := make([]float32, n*4)
-	copy(res, unsafe.Slice((*float32)(unsafe.Pointer(&out.Bytes()[0])), n*4))
-	return res, nil
-}
-
-func runShadowKernel(dev *gpu.Device, n int, fragxyz, recv, depths, mats, color, su []float32) error {
-	mod, err := kernelModule(dev, kernels.ShadowSrc, "Shadow")
-	if err != nil {
-		return err
-	}
-	sb := func(i int) gpu.BindGroupLayoutEntry {
-		return gpu.BindGroupLayoutEntry{Binding: i, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer}
-	}
-	layout := dev.NewBindGroupLayout(
-		sb(0), sb(1), sb(2), sb(3), sb(4), sb(5),
-	)
-	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "Shadow"})
-	if err != nil {
-		return err
-	}
-	if len(depths) == 0 {
-		depths = []float32{0}
-	}
-	if len(mats) == 0 {
-		mats = []float32{0}
-	}
-	fb := storageBuf(dev, fragxyz)
-	rb := storageBuf(dev, recv)
-	db := storageBuf(dev, depths)
-	mb := storageBuf(dev, mats)
-	cb, err := dev.NewBuffer(gpu.BufferDescriptor{Size: len(color) * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst | gpu.BufferMapRead, Data: deferredBytes(color)})
-	if err != nil {
-		return err
-	}
-	ub := storageBuf(dev, su)
-	defer func() {
-		fb.Release()
-		rb.Release()
-		db.Release()
-		mb.Release()
-		cb.Release()
-		ub.Release()
-	}()
-
-	bg := dev.NewBindGroup(layout,
-		gpu.BindGroupEntry{Binding: 0, Buffer: fb},
-		gpu.BindGroupEntry{Binding: 1, Buffer: rb},
-		gpu.BindGroupEntry{Binding: 2, Buffer: db},
-		gpu.BindGroupEntry{Binding: 3, Buffer: mb},
-		gpu.BindGroupEntry{Binding: 4, Buffer: cb},
-		gpu.BindGroupEntry{Binding: 5, Buffer: ub},
-	)
-	enc := dev.NewCommandEncoder()
-	cp := enc.BeginComputePass()
-	cp.SetPipeline(pipe)
-	cp.SetBindGroup(0, bg)
-	cp.Dispatch(n, 1, 1)
-	cp.End()
-	dev.Queue().Submit(enc.Finish())
-	dev.Queue().WaitIdle()
-	copy(color, unsafe.Slice((*float32)(unsafe.Pointer(&cb.Bytes()[0])), len(color)))
-	return nil
-}
-
-func runAOKernel(dev *gpu.Device, n int, fragxyz, aoflag, depthbuf, color, au []float32) error {
-	mod, err := kernelModule(dev, kernels.AOSrc, "AO")
+// encodeKernel records a compute pass running the author-once kernel entry
+// of src over n threads with bufs bound in declaration order, timed by timer
+// under entry.
+func encodeKernel(res *gpuResources, enc *gpu.CommandEncoder, timer *gpuTimer, src, entry string, n int, bufs ...gpu.BufferSlice) error {
+	pipe, err := res.kernel(src, entry)
 	if err != nil {
 		return err
 	}
-	sb := func(i int) gpu.BindGroupLayoutEntry {
-		return gpu.BindGroupLayoutEntry{Binding: i, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer}
-	}
-	layout := dev.NewBindGroupLayout(
-		sb(0), sb(1), sb(2), sb(3), sb(4),
-	)
-	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "AO"})
-	if err != nil {
-		return err
+	binds := make([]gpu.BindGroupEntry, len(bufs))
+	for i, b := range bufs {
+		binds[i] = b.Entry(i)
 	}
-	fb := storageBuf(dev, fragxyz)
-	ab := storageBuf(dev, aoflag)
-	db := storageBuf(dev, depthbuf)
-	cb, err := dev.NewBuffer(gpu.BufferDescriptor{Size: len(color) * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst | gpu.BufferMapRead, Data: deferredBytes(color)})
+	bg, err := res.dev.NewBindGroup(pipe.BindGroupLayout(0), binds...)
 	if err != nil {
 		return err
 	}
-	ub := storageBuf(dev, au)
-	defer func() { fb.Release(); ab.Release(); db.Release(); cb.Release(); ub.Release() }()
-
-	bg := dev.NewBindGroup(layout,
-		gpu.BindGroupEntry{Binding: 0, Buffer: fb},
-		gpu.BindGroupEntry{Binding: 1, Buffer: ab},
-		gpu.BindGroupEntry{Binding: 2, Buffer: db},
-		gpu.BindGroupEntry{Binding: 3, Buffer: cb},
-		gpu.BindGroupEntry{Binding: 4, Buffer: ub},
-	)
-	enc := dev.NewCommandEncoder()
-	cp := enc.BeginComputePass()
+	cp := enc.BeginComputePass(gpu.ComputePassDescriptor{Label: entry, TimestampWrites: timer.writes(entry)})
 	cp.SetPipeline(pipe)
 	cp.SetBindGroup(0, bg)
 	cp.Dispatch(n, 1, 1)
 	cp.End()
-	dev.Queue().Submit(enc.Finish())
-	dev.Queue().WaitIdle()
-	copy(color, unsafe.Slice((*float32)(unsafe.Pointer(&cb.Bytes()[0])), len(color)))
 	return nil
 }
 
-func storageBuf(dev *gpu.Device, d []float32) *gpu.Buffer {
-	b, _ := dev.NewBuffer(gpu.BufferDescriptor{Size: len(d) * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst, Data: deferredBytes(d)})
-	return b
-}
-
 func deferredBytes(d []float32) []byte {
 	return unsafe.Slice((*byte)(unsafe.Pointer(&d[0])), len(d)*4)
 }
@@ -0,0 +1,63 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+//go:build linux
+
+package render
+
+import (
+	"image/color"
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestGLDeferredGammaChain renders with gamma correction on the GL GPU, where
+// the deferred pass chains shading into the gamma pass in one submission, and
+// gates it against the CPU with the deferred gate's tolerance. It asserts both
+// passes report the GPU. Skipped unless EGL_PLATFORM=surfaceless.
+func TestGLDeferredGammaChain(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL render test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	const w, h = 96, 96
+	s, c := newscene(w, h)
+	opts := []Option{
+		Scene(s), Camera(c), Size(w, h), Workers(1), BatchSize(1),
+		Background(color.RGBA{R: 0, G: 127, B: 255, A: 255}),
+		GammaCorrection(true),
+	}
+
+	cpu := NewRenderer(append(opts, CPU())...).Render()
+	gr := NewRenderer(append(opts, GPU(dev), forwardOnCPU())...)
+	gl := gr.Render()
+	if !gr.passOnGPU("deferred") || !gr.passOnGPU("gamma") {
+		t.Fatalf("deferred/gamma did not run on the GL GPU: deferred=%v gamma=%v", gr.passOnGPU("deferred"), gr.passOnGPU("gamma"))
+	}
+	if !gr.deferredGamma {
+		t.Fatal("gamma ran as its own pass instead of in the deferred chain")
+	}
+
+	nBig := 0
+	for i := range cpu.Pix {
+		d := int(cpu.Pix[i]) - int(gl.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > 8 {
+			nBig++
+		}
+	}
+	if frac := float64(nBig) / float64(len(cpu.Pix)); frac > 0.02 {
+		t.Fatalf("GL vs CPU deferred+gamma: %.2f%% of channels differ by >8 (want <2%%, %d/%d)", frac*100, nBig, len(cpu.Pix))
+	}
+	t.Logf("GL deferred+gamma render: %d/%d channels differ by >8", nBig, len(cpu.Pix))
+}
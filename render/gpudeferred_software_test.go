@@ -0,0 +1,57 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestSoftwareDeferredGammaChain renders with gamma correction on the
+// software driver, which runs the forward, deferred and gamma kernels on the
+// CPU through the GPU passes, and gates it against the CPU renderer with the
+// deferred gate's tolerance. It needs no system library, so it always runs.
+func TestSoftwareDeferredGammaChain(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	defer dev.Close()
+
+	const w, h = 96, 96
+	s, c := newscene(w, h)
+	opts := []Option{
+		Scene(s), Camera(c), Size(w, h), Workers(1), BatchSize(1),
+		Background(color.RGBA{R: 0, G: 127, B: 255, A: 255}),
+		GammaCorrection(true),
+	}
+
+	cpu := NewRenderer(append(opts, CPU())...).Render()
+	sr := NewRenderer(append(opts, GPU(dev))...)
+	sw := sr.Render()
+	if !sr.passOnGPU("forward") || !sr.passOnGPU("deferred") || !sr.passOnGPU("gamma") {
+		t.Fatalf("a pass did not run on the software driver: forward=%v deferred=%v gamma=%v", sr.passOnGPU("forward"), sr.passOnGPU("deferred"), sr.passOnGPU("gamma"))
+	}
+	if !sr.deferredGamma {
+		t.Fatal("gamma ran as its own pass instead of in the deferred chain")
+	}
+
+	nBig := 0
+	for i := range cpu.Pix {
+		d := int(cpu.Pix[i]) - int(sw.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > 8 {
+			nBig++
+		}
+	}
+	if frac := float64(nBig) / float64(len(cpu.Pix)); frac > 0.02 {
+		t.Fatalf("software vs CPU forward+deferred+gamma: %.2f%% of channels differ by >8 (want <2%%, %d/%d)", frac*100, nBig, len(cpu.Pix))
+	}
+	t.Logf("software forward+deferred+gamma render: %d/%d channels differ by >8", nBig, len(cpu.Pix))
+}
@@ -10,249 +10,213 @@ import (
 
 	"poly.red/buffer"
 	"poly.red/geometry"
+	"poly.red/geometry/mesh"
 	"poly.red/geometry/primitive"
 	"poly.red/gpu"
+	"poly.red/gpu/shader/gpumath/kernels"
 	"poly.red/material"
 	"poly.red/math"
 	"poly.red/scene"
 )
 
-// The GPU forward rasterizer. The vertex shader transforms model positions to clip
-// space (gl_Position = -(trans*pos); the negation matches the renderer's projection
-// whose w is negated, and lets glViewport reproduce ViewportMatrix). World position,
-// world normal, vertex color and uv are computed/passed CPU-side (exactly as draw())
-// and interpolated. The fragment writes a three-target G-buffer with depth testing
-// and back-face culling (gl_FrontFacing) to match the CPU forward pass:
+// The GPU forward rasterizer. Every scene object that shares a geometry.Geometry
+// is one instance of a single instanced draw: the mesh streams are uploaded once
+// and each instance reads its matrices (trans, world, normal; 48 floats) from a
+// per-instance buffer by instance id. The vertex stage (kernels.ForwardVertex)
+// transforms model positions to clip space (-(trans*pos); the negation matches
+// the renderer's projection whose w is negated, and lets the viewport reproduce
+// ViewportMatrix) and to world space, as draw() does CPU-side; world position,
+// world normal and uv are interpolated. The projection maps the near plane to
+// depth 1 and the far plane to -1 (the CPU pass keeps the greater depth), so the
+// vertex stage flips clip z into the kernels' [0,1] range for the GPU's "less"
+// depth test and the fragment stage (kernels.ForwardFragment) flips it back.
+// Both are author-once Go kernels, so the pass runs on every driver, the
+// software one included. The pipeline culls back faces (counter-clockwise front
+// faces, as the CPU forward pass keeps) and depth-tests; the fragment writes a
+// four-target G-buffer:
 //
 //	target 0 (RGBA32F): world position xyz, depth (remapped to the CPU's [-1,1])
 //	target 1 (RGBA32F): unit world normal xyz, material id
 //	target 2 (RGBA32F): u, v, du, dv (texture coords + squared screen-space uv
-//	                    gradients via dFdx/dFdy, for the mipmap LOD the CPU derives)
+//	                    gradients via Dfdx/Dfdy, for the mipmap LOD the CPU derives)
+//	target 3 (R32F):    coverage, 1 where a fragment was drawn
 //
 // vertex color is not stored: the deferred pass takes basecol from the material
 // (texture/diffuse), using the fragment color only for materialless passthrough,
 // which the textured scenes this drives do not use.
-const fwdGBufVert = `#version 310 es
-layout(std430, binding = 0) readonly buffer _pos { float pos[]; };
-layout(std430, binding = 1) readonly buffer _wp  { float wpos[]; };
-layout(std430, binding = 2) readonly buffer _wn  { float wnor[]; };
-layout(std430, binding = 3) readonly buffer _mid { float mid[]; };
-layout(std430, binding = 4) readonly buffer _uv  { float uv[]; };
-layout(std430, binding = 5) readonly buffer _m   { float m[]; };
-out vec3 vWorld;
-out vec3 vNormal;
-out vec2 vUV;
-flat out float vMat;
-void main() {
-	int i = gl_VertexID;
-	vec4 p = vec4(pos[i*4], pos[i*4+1], pos[i*4+2], pos[i*4+3]);
-	mat4 T = mat4(m[0],m[1],m[2],m[3], m[4],m[5],m[6],m[7],
-	              m[8],m[9],m[10],m[11], m[12],m[13],m[14],m[15]);
-	gl_Position = -(T * p);
-	vWorld  = vec3(wpos[i*4], wpos[i*4+1], wpos[i*4+2]);
-	vNormal = vec3(wnor[i*4], wnor[i*4+1], wnor[i*4+2]);
-	vUV     = vec2(uv[i*2], uv[i*2+1]);
-	vMat    = mid[i];
-}`
-
-const fwdGBufFrag = `#version 310 es
-precision highp float;
-in vec3 vWorld;
-in vec3 vNormal;
-in vec2 vUV;
-flat in float vMat;
-layout(location = 0) out vec4 outWP; // xyz world position, w depth (CPU [-1,1])
-layout(location = 1) out vec4 outN;  // xyz unit world normal, w material id
-layout(location = 2) out vec4 outUV; // u, v, du, dv
-void main() {
-	if (!gl_FrontFacing) discard;
-	outWP = vec4(vWorld, gl_FragCoord.z * 2.0 - 1.0);
-	outN  = vec4(normalize(vNormal), vMat);
-	vec2 dx = dFdx(vUV);
-	vec2 dy = dFdy(vUV);
-	outUV = vec4(vUV, dot(dx, dx), dot(dy, dy));
-}`
-
-// Metal (darwin runtime) equivalents of the GLSL forward shaders. The vertex reads
-// the same six storage buffers by [[vertex_id]]; the matrix is column-major (matching
-// the colMajorMat4 upload and MSL's float4x4(col0..col3)). [[position]].z is Metal's
-// [0,1] depth, remapped to the CPU's [-1,1] like the GL path. Back faces are dropped
-// via [[front_facing]] (Metal has no hardware cull configured here); the sense is
-// verified against the CPU on darwin. dfdx/dfdy give the squared uv gradients for LOD.
-const fwdGBufMSL = `
-#include <metal_stdlib>
-using namespace metal;
-struct VOut {
-	float4 pos [[position]];
-	float3 world;
-	float3 normal;
-	float2 uv;
-	float  matid [[flat]];
-};
-struct FOut {
-	float4 wp  [[color(0)]]; // xyz world position, w depth (CPU [-1,1])
-	float4 n   [[color(1)]]; // xyz unit world normal, w material id
-	float4 uvo [[color(2)]]; // u, v, du, dv
-};
-vertex VOut fwdVert(uint vid [[vertex_id]],
-	device const float* pos  [[buffer(0)]],
-	device const float* wpos [[buffer(1)]],
-	device const float* wnor [[buffer(2)]],
-	device const float* mid  [[buffer(3)]],
-	device const float* uv   [[buffer(4)]],
-	device const float* m    [[buffer(5)]]) {
-	float4 p = float4(pos[vid*4], pos[vid*4+1], pos[vid*4+2], pos[vid*4+3]);
-	float4x4 T = float4x4(float4(m[0], m[1], m[2], m[3]),
-	                      float4(m[4], m[5], m[6], m[7]),
-	                      float4(m[8], m[9], m[10], m[11]),
-	                      float4(m[12], m[13], m[14], m[15]));
-	VOut o;
-	o.pos    = -(T * p);
-	// The renderer's projection yields GL-style clip z in [-w, w] (ndc [-1,1]); Metal
-	// clips to [0, w] (ndc [0,1]) and would discard the near half. Remap z to Metal's
-	// convention: z' = (z + w)/2. The fragment then recovers the CPU's [-1,1] depth
-	// via position.z*2-1, exactly as the GL path does from gl_FragCoord.z.
-	o.pos.z  = (o.pos.z + o.pos.w) * 0.5;
-	o.world  = float3(wpos[vid*4], wpos[vid*4+1], wpos[vid*4+2]);
-	o.normal = float3(wnor[vid*4], wnor[vid*4+1], wnor[vid*4+2]);
-	o.uv     = float2(uv[vid*2], uv[vid*2+1]);
-	o.matid  = mid[vid];
-	return o;
-}
-fragment FOut fwdFrag(VOut in [[stage_in]], bool front [[front_facing]]) {
-	// Drop back faces to match the CPU. Metal's default front-facing winding is the
-	// OPPOSITE of GL's (clockwise vs counter-clockwise) for this same NDC geometry, so
-	// the GLSL keeps !gl_FrontFacing while the MSL keeps front -- both keep the CPU's
-	// front faces. Verified against the CPU on darwin (coverage 1811 == CPU exactly).
-	if (front) discard_fragment();
-	FOut o;
-	o.wp  = float4(in.world, in.pos.z * 2.0 - 1.0);
-	o.n   = float4(normalize(in.normal), in.matid);
-	float2 dx = dfdx(in.uv);
-	float2 dy = dfdy(in.uv);
-	o.uvo = float4(in.uv, dot(dx, dx), dot(dy, dy));
-	return o;
-}`
-
-const noFragment = -2.0
+//
+// With MSAA above 1 the targets are 4x multisampled, resolved at the end of
+// the pass into single-sampled ones of the buffer's size. A resolved texel
+// averages its samples, the cleared ones included, so the coverage target
+// holds the share of them drawn: the pass keeps a buffer pixel that at least
+// half its samples cover, and divides its other targets by the coverage to
+// average the drawn samples alone. Material ids average too, and round to
+// the nearest where an edge between two materials crosses the pixel.
 
-var errGPUForwardUnavailable = errors.New("render: no GPU device for the forward pass")
+var (
+	errGPUForwardUnavailable = errors.New("render: no GPU device for the forward pass")
+	errGPUForwardNoFloat     = errors.New("render: the GPU device has no float render targets for the forward G-buffer")
+)
 
 // gpuForwardPass rasterizes the scene's forward G-buffer on the GPU and fills the
 // renderer's FragmentBuffer, the same buffer the deferred pass consumes. It also
 // builds r.matTable (as the CPU pass does) since the deferred pass needs it.
 //
+// With MSAA above 1 it draws into 4x multisampled targets and reads their
+// resolved ones (see above). The pipelines and targets are the renderer's
+// gpuResources, reused while the size stays, and the vertex streams come
+// from their pool.
+//
 // It returns an error -- and runPass falls back to the CPU forward pass -- when no
-// device is present or the device cannot run the GLSL G-buffer pipeline (the Metal
-// backend errors on missing MSL), so darwin and the golden tests are unchanged.
+// device is present, the device cannot render to the RGBA32Float G-buffer (8-bit
+// targets cannot hold world positions; GLES needs EXT_color_buffer_float), or it
+// cannot run the G-buffer pipeline (a driver the kernels do not compile for), so
+// the golden tests are unchanged.
 func (r *Renderer) gpuForwardPass() error {
 	dev := r.cfg.GPUDevice
 	if dev == nil {
 		return errGPUForwardUnavailable
 	}
+	if !dev.Features().Has(gpu.FeatureFloat32Renderable) {
+		return errGPUForwardNoFloat
+	}
 	buf := r.CurrBuffer()
 	w, h := buf.Bounds().Dx(), buf.Bounds().Dy()
-	objs := r.buildForwardObjects()
-
-	// Provide both GLSL and MSL: the GL backend uses the GLSL (entry is always main,
-	// ventry/fentry ignored), the Metal backend compiles the MSL library and selects
-	// fwdVert/fwdFrag by entry. Both modules carry the same MSL library on darwin.
-	vmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: fwdGBufVert, MSL: fwdGBufMSL})
-	if err != nil {
-		return err
+	objs, proxies := r.buildForwardObjects()
+	samples := 1
+	if r.cfg.MSAA > 1 {
+		samples = 4
 	}
-	fmod, err := dev.NewShaderModule(gpu.ShaderSource{GLSL: fwdGBufFrag, MSL: fwdGBufMSL})
+	res, err := r.gpuResources(dev, w, h)
 	if err != nil {
 		return err
 	}
-	pipe, err := dev.NewRenderPipeline(gpu.RenderPipelineDescriptor{
-		VertexModule: vmod, VertexEntry: "fwdVert",
-		FragmentModule: fmod, FragmentEntry: "fwdFrag",
-		ColorFormat:       gpu.RGBA32Float,
-		ExtraColorFormats: []gpu.TextureFormat{gpu.RGBA32Float, gpu.RGBA32Float},
-		DepthFormat:       gpu.Depth32Float,
-	})
+
+	vmod, err := res.kernelModule(kernels.ForwardSrc, "ForwardVertex")
 	if err != nil {
 		return err
 	}
-	mkF32 := func() (*gpu.Texture, error) {
-		return dev.NewTexture(gpu.TextureDescriptor{Format: gpu.RGBA32Float, Width: w, Height: h, RenderTarget: true})
-	}
-	wt, err := mkF32()
+	fmod, err := res.kernelModule(kernels.ForwardSrc, "ForwardFragment")
 	if err != nil {
 		return err
 	}
-	nt, err := mkF32()
-	if err != nil {
-		return err
+	pipeDesc := gpu.RenderPipelineDescriptor{
+		Label:             "forward",
+		VertexModule:      vmod,
+		FragmentModule:    fmod,
+		ColorFormat:       gpu.RGBA32Float,
+		ExtraColorFormats: []gpu.TextureFormat{gpu.RGBA32Float, gpu.RGBA32Float, gpu.R32Float},
+		DepthFormat:       gpu.Depth32Float,
+		CullMode:          gpu.CullBack,
+		FrontFace:         gpu.FrontCCW,
+		SampleCount:       samples,
 	}
-	ut, err := mkF32()
+	pipe, err := res.renderPipeline(pipeDesc)
 	if err != nil {
 		return err
 	}
-	depth, err := dev.NewTexture(gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: w, Height: h, RenderTarget: true})
+	occ := newOcclusionTest(res, pipeDesc, proxies)
+	// targets holds the G-buffer's color targets and, when they are
+	// multisampled, resolved holds what they resolve into.
+	var targets, resolved [4]*gpu.Texture
+	for i, name := range []string{"world", "normal", "uv", "coverage"} {
+		desc := gpu.TextureDescriptor{Format: gpu.RGBA32Float, Width: w, Height: h, RenderTarget: true}
+		if i == 3 {
+			desc.Format = gpu.R32Float
+		}
+		t, err := res.texture("forward "+name, desc)
+		if err != nil {
+			return err
+		}
+		if samples > 1 {
+			resolved[i] = t
+			desc.SampleCount = samples
+			if t, err = res.texture("forward multisampled "+name, desc); err != nil {
+				return err
+			}
+		}
+		targets[i] = t
+	}
+	depth, err := res.texture("forward depth", gpu.TextureDescriptor{Format: gpu.Depth32Float, Width: w, Height: h, RenderTarget: true, SampleCount: samples})
 	if err != nil {
 		return err
 	}
 
+	timer := r.newGPUTimer(res, "forward", 1)
 	enc := dev.NewCommandEncoder()
 	rp := enc.BeginRenderPass(gpu.RenderPassDescriptor{
-		ColorTexture: wt, Load: gpu.LoadClear, ClearColor: [4]float64{0, 0, 0, 0},
+		ColorTexture: targets[0], ResolveTarget: resolved[0], Load: gpu.LoadClear,
 		ExtraColorTargets: []gpu.ColorTarget{
-			{Texture: nt, ClearColor: [4]float64{0, 0, 0, noFragment}},
-			{Texture: ut, ClearColor: [4]float64{0, 0, 0, 0}},
+			{Texture: targets[1], ResolveTarget: resolved[1]},
+			{Texture: targets[2], ResolveTarget: resolved[2]},
+			{Texture: targets[3], ResolveTarget: resolved[3]},
 		},
 		DepthTexture: depth, ClearDepth: 1,
+		TimestampWrites:   timer.writes("GBuffer"),
+		OcclusionQuerySet: occ.querySet(),
 	})
 	rp.SetPipeline(pipe)
+	// The vertex streams are the frame's own, in the pool.
 	for _, o := range objs {
-		b0, err := newF32Buffer(dev, o.pos)
+		// Nothing to draw when every occurrence is occluded, or the mesh
+		// has no valid triangle.
+		if len(o.inst) == 0 || len(o.idx) == 0 {
+			continue
+		}
+		for i, d := range [][]float32{o.pos, o.nor, o.mid, o.uv, o.inst} {
+			s, err := res.upload(d)
+			if err != nil {
+				return err
+			}
+			rp.SetVertexSlice(i, s)
+		}
+		ib, format, err := res.uploadIndices(o.idx, len(o.mid))
 		if err != nil {
 			return err
 		}
-		b1, _ := newF32Buffer(dev, o.wpos)
-		b2, _ := newF32Buffer(dev, o.wnor)
-		b3, _ := newF32Buffer(dev, o.mid)
-		b4, _ := newF32Buffer(dev, o.uv)
-		b5, _ := newF32Buffer(dev, o.trans[:])
-		rp.SetVertexBuffer(0, b0)
-		rp.SetVertexBuffer(1, b1)
-		rp.SetVertexBuffer(2, b2)
-		rp.SetVertexBuffer(3, b3)
-		rp.SetVertexBuffer(4, b4)
-		rp.SetVertexBuffer(5, b5)
-		rp.Draw(gpu.TriangleList, 0, len(o.pos)/4)
+		rp.SetIndexSlice(ib, format)
+		rp.DrawIndexedInstanced(gpu.TriangleList, 0, len(o.idx), 0, 0, len(o.inst)/forwardInstanceFloats)
 	}
+	occ.encode(rp)
 	rp.End()
+
 	dev.Queue().Submit(enc.Finish())
 	dev.Queue().WaitIdle()
+	r.occluded = occ.occluded()
 
-	wp := floats32(wt.ReadPixels())
-	nr := floats32(nt.ReadPixels())
-	uv := floats32(ut.ReadPixels())
+	var pix [4][]float32
+	for i, t := range targets {
+		if resolved[i] != nil {
+			t = resolved[i]
+		}
+		pix[i] = floats32(t.ReadPixels())
+	}
+	wp, nr, uv, cov := pix[0], pix[1], pix[2], pix[3]
 	// Render-target texture readback follows GL's bottom-left origin: source row r is
 	// screen row h-1-r. The FragmentBuffer (like the CPU pass) is top-down, so read
 	// the mirrored row when writing each (x, y). (The deferred pass reads a compute
 	// SSBO, which is not flipped, hence only the render path needs this.)
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
-			idx := ((h-1-y)*w + x) * 4
-			if nr[idx+3] < noFragment+0.5 { // no fragment written
+			c := cov[(h-1-y)*w+x]
+			if c < 0.5 { // under half the samples drawn
 				continue
 			}
+			idx := ((h-1-y)*w + x) * 4
+			at := func(p []float32, k int) float32 { return p[idx+k] / c }
 			buf.Set(x, y, buffer.Fragment{
 				Ok: true,
 				Fragment: primitive.Fragment{
 					X:          x,
 					Y:          y,
-					Depth:      wp[idx+3],
-					U:          uv[idx],
-					V:          uv[idx+1],
-					Du:         uv[idx+2],
-					Dv:         uv[idx+3],
-					Nor:        math.Vec4[float32]{X: nr[idx], Y: nr[idx+1], Z: nr[idx+2], W: 0},
-					WordPos:    math.Vec4[float32]{X: wp[idx], Y: wp[idx+1], Z: wp[idx+2], W: 1},
-					MaterialID: int64(stdmath.Round(float64(nr[idx+3]))),
+					Depth:      at(wp, 3),
+					U:          at(uv, 0),
+					V:          at(uv, 1),
+					Du:         at(uv, 2),
+					Dv:         at(uv, 3),
+					Nor:        math.Vec4[float32]{X: at(nr, 0), Y: at(nr, 1), Z: at(nr, 2), W: 0}.Unit(),
+					WordPos:    math.Vec4[float32]{X: at(wp, 0), Y: at(wp, 1), Z: at(wp, 2), W: 1},
+					MaterialID: int64(stdmath.Round(float64(at(nr, 3)))),
 				},
 			})
 		}
@@ -260,53 +224,180 @@ func (r *Renderer) gpuForwardPass() error {
 	return nil
 }
 
-// forwardObject is one scene object's GPU forward-raster input.
+// forwardObject is one geometry's GPU forward-raster input: unique model-space
+// vertex streams, the triangle list indexing them, and one instance per scene
+// object that draws the geometry.
 type forwardObject struct {
-	pos, wpos, wnor, mid, uv []float32 // model pos; world pos; world normal; flat matid; uv
-	trans                    [16]float32
+	pos, nor, mid, uv []float32 // model pos; model normal; flat matid; uv
+	idx               []uint32  // three indices per triangle into the streams
+	inst              []float32 // forwardInstanceFloats per instance
+}
+
+// forwardInstanceFloats is the size of one instance's data: the column-major
+// trans (model to clip), world and normal matrices.
+const forwardInstanceFloats = 48
+
+// addInstance appends an instance drawn with the given object transform.
+func (o *forwardObject) addInstance(trans, world, normalMat math.Mat4[float32]) {
+	for _, m := range []math.Mat4[float32]{trans, world, normalMat} {
+		cm := colMajorMat4(m)
+		o.inst = append(o.inst, cm[:]...)
+	}
+}
+
+// forwardVertexKey identifies a unique forward-raster vertex. The material id is
+// part of the key because it is a per-vertex flat varying: a corner shared by
+// triangles of different materials must stay separate vertices.
+type forwardVertexKey struct {
+	pos, nor math.Vec4[float32]
+	uv       math.Vec2[float32]
+	mat      int64
 }
 
 // buildForwardObjects tabulates materials into r.matTable (so the deferred pass can
-// read them) and produces the per-object vertex streams, mirroring cpuForwardPass.
-func (r *Renderer) buildForwardObjects() []forwardObject {
+// read them) and produces the per-geometry vertex streams, mirroring cpuForwardPass.
+// A geometry reached several times through the scene graph is built once (its
+// materials tabulated once) and gains an instance per occurrence. A
+// mesh.BufferedMesh uploads its own index buffer; other meshes are triangle soups
+// whose identical corners are merged into one indexed vertex.
+//
+// With OcclusionCulling it also returns every occurrence's proxy, in traversal
+// order, and leaves out the instances of occurrences r.occluded marks. An
+// object that still has no instance is then drawn by nothing but its proxy.
+func (r *Renderer) buildForwardObjects() ([]*forwardObject, []forwardProxy) {
 	cam := r.cfg.Camera
 	view, proj := cam.ViewMatrix(), cam.ProjMatrix()
 	r.matTable = r.matTable[:0]
-	var objs []forwardObject
+	occluded := r.forwardOccluded()
+	var (
+		objs    []*forwardObject
+		proxies []forwardProxy
+	)
+	batches := map[*geometry.Geometry]*forwardObject{}
 	scene.IterObjects(r.cfg.Scene, func(g *geometry.Geometry, model math.Mat4[float32]) bool {
 		world := model.MulM(g.ModelMatrix())
 		normalMat := world.Inv().T()
 		trans := proj.MulM(view).MulM(world)
+		id := len(proxies)
+		if r.cfg.OcclusionCull {
+			proxies = append(proxies, newForwardProxy(g.AABB(), trans))
+		}
 
-		base := int64(len(r.matTable))
-		for _, m := range g.Materials() {
-			bp, _ := m.(*material.BlinnPhong)
-			r.matTable = append(r.matTable, bp)
+		o, ok := batches[g]
+		if !ok {
+			base := int64(len(r.matTable))
+			for _, m := range g.Materials() {
+				bp, _ := m.(*material.BlinnPhong)
+				r.matTable = append(r.matTable, bp)
+			}
+			o = &forwardObject{}
+			if bm, ok := g.Mesh().(*mesh.BufferedMesh); ok && len(bm.IndexBuffer()) > 0 {
+				o.appendBuffered(bm, base)
+			} else {
+				o.appendTriangles(g.Triangles(), base)
+			}
+			batches[g] = o
+			objs = append(objs, o)
 		}
+		if id >= len(occluded) || !occluded[id] {
+			o.addInstance(trans, world, normalMat)
+		}
+		return true
+	})
+	return objs, proxies
+}
 
-		o := forwardObject{trans: colMajorMat4(trans)}
-		for _, tri := range g.Triangles() {
-			if !tri.IsValid() {
+// forwardOccluded returns r.occluded if it still describes the scene's
+// objects, or nil: results from a frame with another object count, or from
+// before culling was turned off, would misplace the culling.
+func (r *Renderer) forwardOccluded() []bool {
+	if !r.cfg.OcclusionCull || len(r.occluded) == 0 {
+		return nil
+	}
+	n := 0
+	scene.IterObjects(r.cfg.Scene, func(*geometry.Geometry, math.Mat4[float32]) bool {
+		n++
+		return true
+	})
+	if n != len(r.occluded) {
+		return nil
+	}
+	return r.occluded
+}
+
+// appendVertex appends one vertex to the streams and returns its index.
+func (o *forwardObject) appendVertex(pos, nor math.Vec4[float32], uv math.Vec2[float32], matID int64) uint32 {
+	o.pos = append(o.pos, pos.X, pos.Y, pos.Z, pos.W)
+	o.nor = append(o.nor, nor.X, nor.Y, nor.Z, 0)
+	o.uv = append(o.uv, uv.X, uv.Y)
+	o.mid = append(o.mid, float32(matID))
+	return uint32(len(o.mid) - 1)
+}
+
+// appendTriangles indexes a triangle soup, merging identical corners.
+func (o *forwardObject) appendTriangles(tris []*primitive.Triangle, base int64) {
+	seen := map[forwardVertexKey]uint32{}
+	for _, tri := range tris {
+		if !tri.IsValid() {
+			continue
+		}
+		flatMatID := tri.MaterialID
+		if flatMatID >= 0 {
+			flatMatID += base
+		}
+		for _, v := range []*primitive.Vertex{tri.V1, tri.V2, tri.V3} {
+			k := forwardVertexKey{pos: v.Pos, nor: v.Nor, uv: v.UV, mat: flatMatID}
+			i, ok := seen[k]
+			if !ok {
+				i = o.appendVertex(v.Pos, v.Nor, v.UV, flatMatID)
+				seen[k] = i
+			}
+			o.idx = append(o.idx, i)
+		}
+	}
+}
+
+// appendBuffered uploads a buffered mesh's attributes once per vertex and
+// material and indexes them through its index buffer. Like the CPU pass it
+// draws the mesh's triangles (see mesh.BufferedMesh.Triangles): invalid ones
+// are left out, and each takes its own material id offset by base.
+func (o *forwardObject) appendBuffered(bm *mesh.BufferedMesh, base int64) {
+	attrPos := bm.GetAttribute(mesh.AttribPosition)
+	attrNor := bm.GetAttribute(mesh.AttribNormal)
+	attrUV := bm.GetAttribute(mesh.AttriTexcoord)
+	ibo := bm.IndexBuffer()
+	seen := map[[2]int64]uint32{} // mesh vertex, flat material
+	for t, tri := range bm.Triangles() {
+		if !tri.IsValid() {
+			continue
+		}
+		flatMatID := tri.MaterialID
+		if flatMatID >= 0 {
+			flatMatID += base
+		}
+		for _, i := range ibo[3*t : 3*t+3] {
+			k := [2]int64{int64(i), flatMatID}
+			if j, ok := seen[k]; ok {
+				o.idx = append(o.idx, j)
 				continue
 			}
-			flatMatID := tri.MaterialID
-			if flatMatID >= 0 {
-				flatMatID += base
+			p := attrPos.Values[attrPos.Stride*i:]
+			pos := math.NewVec4(p[0], p[1], p[2], 1)
+			var nor math.Vec4[float32]
+			if attrNor != nil {
+				v := attrNor.Values[attrNor.Stride*i:]
+				nor = math.NewVec4(v[0], v[1], v[2], 0)
 			}
-			for _, v := range []*primitive.Vertex{tri.V1, tri.V2, tri.V3} {
-				wp := world.MulV(v.Pos)
-				wn := v.Nor.Apply(normalMat)
-				o.pos = append(o.pos, v.Pos.X, v.Pos.Y, v.Pos.Z, v.Pos.W)
-				o.wpos = append(o.wpos, wp.X, wp.Y, wp.Z, 1)
-				o.wnor = append(o.wnor, wn.X, wn.Y, wn.Z, 0)
-				o.uv = append(o.uv, v.UV.X, v.UV.Y)
-				o.mid = append(o.mid, float32(flatMatID))
+			var uv math.Vec2[float32]
+			if attrUV != nil {
+				v := attrUV.Values[attrUV.Stride*i:]
+				uv = math.NewVec2(v[0], v[1])
 			}
+			j := o.appendVertex(pos, nor, uv, flatMatID)
+			seen[k] = j
+			o.idx = append(o.idx, j)
 		}
-		objs = append(objs, o)
-		return true
-	})
-	return objs
+	}
 }
 
 func colMajorMat4(m math.Mat4[float32]) [16]float32 {
@@ -319,13 +410,21 @@ func colMajorMat4(m math.Mat4[float32]) [16]float32 {
 	return a
 }
 
-func newF32Buffer(dev *gpu.Device, d []float32) (*gpu.Buffer, error) {
-	b := make([]byte, len(d)*4)
-	for i, f := range d {
-		u := stdmath.Float32bits(f)
-		b[i*4], b[i*4+1], b[i*4+2], b[i*4+3] = byte(u), byte(u>>8), byte(u>>16), byte(u>>24)
+// indexBytes encodes a triangle list's indices, as 16-bit indices when every
+// vertex id fits (halving the upload) and 32-bit otherwise.
+func indexBytes(idx []uint32, nverts int) ([]byte, gpu.IndexFormat) {
+	if nverts <= 1<<16 {
+		b := make([]byte, len(idx)*2)
+		for i, v := range idx {
+			b[i*2], b[i*2+1] = byte(v), byte(v>>8)
+		}
+		return b, gpu.IndexUint16
+	}
+	b := make([]byte, len(idx)*4)
+	for i, v := range idx {
+		b[i*4], b[i*4+1], b[i*4+2], b[i*4+3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
 	}
-	return dev.NewBuffer(gpu.BufferDescriptor{Data: b, Usage: gpu.BufferStorage})
+	return b, gpu.IndexUint32
 }
 
 func floats32(b []byte) []float32 {
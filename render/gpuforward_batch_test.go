@@ -0,0 +1,106 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"fmt"
+	"testing"
+
+	"poly.red/buffer"
+	"poly.red/camera"
+	"poly.red/geometry"
+	"poly.red/geometry/mesh"
+	"poly.red/geometry/primitive"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/scene"
+)
+
+// TestBuildForwardObjectsBatches pins the instancing of the GPU forward pass: a
+// geometry reached through several groups is built once with one instance per
+// occurrence (its materials tabulated once), and the two corners shared by a
+// quad's triangles are merged into one indexed vertex each.
+func TestBuildForwardObjectsBatches(t *testing.T) {
+	v := func(x, y float32) *primitive.Vertex {
+		return primitive.NewVertex(
+			primitive.Pos(math.NewVec4(x, y, 0, 1)),
+			primitive.Nor(math.NewVec4[float32](0, 0, 1, 0)),
+		)
+	}
+	a, b, c, d := v(0, 0), v(1, 0), v(0, 1), v(1, 1)
+	quad := geometry.New(mesh.NewTriangleMesh([]*primitive.Triangle{
+		primitive.NewTriangle(a, b, c),
+		primitive.NewTriangle(c, b, d),
+	}), material.NewBlinnPhong())
+	other := geometry.New(mesh.NewTriangleMesh([]*primitive.Triangle{
+		primitive.NewTriangle(a, b, c),
+	}), material.NewBlinnPhong())
+
+	g1, g2 := scene.NewGroup(quad), scene.NewGroup(quad)
+	g2.Translate(2, 0, 0)
+	s := scene.NewScene(g1, g2, other)
+	r := NewRenderer(CPU(), Size(4, 4), Scene(s), Camera(camera.NewPerspective()))
+
+	objs, _ := r.buildForwardObjects()
+	if len(objs) != 2 {
+		t.Fatalf("got %d forward objects, want 2 (quad batched, other)", len(objs))
+	}
+	q := objs[0]
+	if n := len(q.inst) / forwardInstanceFloats; n != 2 {
+		t.Fatalf("quad has %d instances, want 2", n)
+	}
+	if len(q.mid) != 4 || len(q.idx) != 6 {
+		t.Fatalf("quad has %d vertices and %d indices, want 4 and 6", len(q.mid), len(q.idx))
+	}
+	// The second instance's world matrix (floats 16..31, column-major) carries the
+	// group translation in its last column.
+	if tx := q.inst[forwardInstanceFloats+16+12]; tx != 2 {
+		t.Fatalf("second instance world x translation = %v, want 2", tx)
+	}
+	if len(r.matTable) != 2 {
+		t.Fatalf("material table has %d entries, want 2 (one per geometry)", len(r.matTable))
+	}
+	if objs[1].mid[0] != 1 {
+		t.Fatalf("other geometry material id = %v, want 1", objs[1].mid[0])
+	}
+}
+
+// TestBuildForwardObjectsBuffered checks that a buffered mesh is drawn as the
+// CPU pass draws it: its invalid triangle is left out, each triangle takes its
+// own material, and a vertex is shared only between triangles of one material.
+// A mesh with no triangles builds an object with nothing to draw.
+func TestBuildForwardObjectsBuffered(t *testing.T) {
+	bm := mesh.NewBufferedMesh()
+	bm.SetAttribute(mesh.AttribPosition, mesh.NewBufferAttrib(3, []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0}))
+	bm.SetIndexBuffer(buffer.IndexBuffer{
+		0, 1, 2, // material 0
+		0, 0, 1, // degenerate
+		2, 1, 3, // material 0, sharing two corners
+		2, 1, 3, // material 1
+	})
+	bm.Triangles()[3].MaterialID = 1
+	empty := mesh.NewBufferedMesh()
+	empty.SetAttribute(mesh.AttribPosition, mesh.NewBufferAttrib(3, []float32{0, 0, 0}))
+	s := scene.NewScene(
+		geometry.New(bm, material.NewBlinnPhong(), material.NewBlinnPhong()),
+		geometry.New(empty),
+	)
+	r := NewRenderer(CPU(), Size(4, 4), Scene(s), Camera(camera.NewPerspective()))
+
+	objs, _ := r.buildForwardObjects()
+	if len(objs) != 2 {
+		t.Fatalf("got %d forward objects, want 2", len(objs))
+	}
+	o := objs[0]
+	if len(o.idx) != 9 {
+		t.Fatalf("buffered mesh has %d indices, want 9 (three valid triangles)", len(o.idx))
+	}
+	if want := []float32{0, 0, 0, 0, 1, 1, 1}; fmt.Sprint(o.mid) != fmt.Sprint(want) {
+		t.Fatalf("vertex materials = %v, want %v", o.mid, want)
+	}
+	if len(objs[1].idx) != 0 {
+		t.Fatalf("empty mesh has %d indices, want none", len(objs[1].idx))
+	}
+}
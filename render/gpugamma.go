@@ -16,19 +16,10 @@ import (
 // on the GPU, in place, leaving alpha unchanged. This is the renderer's gamma
 // pass (shader.GammaCorrection) offloaded to the poly.red/gpu abstraction, using
 // the author-once kernels.SRGB (kernels.SRGBSrc). It matches the CPU LUT path
-// within +/-1 on 8-bit output.
-func gpuGammaCorrect(dev *gpu.Device, img *image.RGBA) error {
-	mod, err := kernelModule(dev, kernels.SRGBSrc, "SRGB")
-	if err != nil {
-		return err
-	}
-	layout := dev.NewBindGroupLayout(
-		gpu.BindGroupLayoutEntry{Binding: 0, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
-		gpu.BindGroupLayoutEntry{Binding: 1, Visibility: gpu.StageCompute, Kind: gpu.StorageBuffer},
-	)
-	pipe, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{
-		Layout: dev.NewPipelineLayout(layout), Module: mod, Entry: "SRGB",
-	})
+// within +/-1 on 8-bit output. Its compute pass is timed by timer as "SRGB".
+func gpuGammaCorrect(res *gpuResources, timer *gpuTimer, img *image.RGBA) error {
+	dev := res.dev
+	pipe, err := res.kernel(kernels.SRGBSrc, "SRGB")
 	if err != nil {
 		return err
 	}
@@ -48,23 +39,22 @@ func gpuGammaCorrect(dev *gpu.Device, img *image.RGBA) error {
 	}
 	count := n * 3
 
-	inBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Size: count * 4, Usage: gpu.BufferStorage | gpu.BufferCopyDst, Data: f32bytes(in)})
+	inSlice, err := res.upload(in)
 	if err != nil {
 		return err
 	}
-	defer inBuf.Release()
-	outBuf, err := dev.NewBuffer(gpu.BufferDescriptor{Size: count * 4, Usage: gpu.BufferStorage | gpu.BufferMapRead})
+	outBuf, err := res.buffer("gamma", count*4, gpu.BufferStorage|gpu.BufferMapRead)
 	if err != nil {
 		return err
 	}
-	defer outBuf.Release()
 
-	bg := dev.NewBindGroup(layout,
-		gpu.BindGroupEntry{Binding: 0, Buffer: inBuf},
-		gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	bg, err := dev.NewBindGroup(pipe.BindGroupLayout(0), inSlice.Entry(0), gpu.BindGroupEntry{Binding: 1, Buffer: outBuf})
+	if err != nil {
+		return err
+	}
 
 	enc := dev.NewCommandEncoder()
-	cp := enc.BeginComputePass()
+	cp := enc.BeginComputePass(gpu.ComputePassDescriptor{Label: "SRGB", TimestampWrites: timer.writes("SRGB")})
 	cp.SetPipeline(pipe)
 	cp.SetBindGroup(0, bg)
 	cp.Dispatch(count, 1, 1)
@@ -92,7 +82,3 @@ func toU8(v float32) uint8 {
 	}
 	return uint8(x)
 }
-
-func f32bytes(d []float32) []byte {
-	return unsafe.Slice((*byte)(unsafe.Pointer(&d[0])), len(d)*4)
-}
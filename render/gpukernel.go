@@ -6,47 +6,56 @@ package render
 
 import (
 	"errors"
+	"fmt"
 
 	"poly.red/gpu"
 	"poly.red/gpu/shader"
 )
 
 // errKernelBackendUnsupported signals the device's driver has no render kernel
-// compilation path yet (Vulkan needs runtime SPIR-V via glslang, DX12 is
-// unimplemented), so the caller's runPass falls back to the CPU.
+// compilation path yet (DX12 is unimplemented), so the caller's runPass falls
+// back to the CPU.
 var errKernelBackendUnsupported = errors.New("render: GPU kernel not supported on this backend")
 
-// kernelSource compiles the Go-DSL kernel src for the given backend driver and
-// returns the shading-language ShaderSource for entry: MSL for Metal, GLSL for
-// GL. It is the single place render selects a shading language, and is
-// device-free (shader.Compile/CompileGLSL are pure Go) so it can be unit-tested
-// without a GPU.
-func kernelSource(driver gpu.Driver, src, entry string) (gpu.ShaderSource, error) {
+// kernelFor compiles the Go-DSL kernel src for the given backend driver and
+// returns the kernel entry: compiled to MSL for Metal, GLSL for GL, SPIR-V for
+// Vulkan and a CPU program for the software driver. It is the single place
+// render selects a shading language, and is device-free (the shader compilers
+// are pure Go) so it can be unit-tested without a GPU.
+func kernelFor(driver gpu.Driver, src, entry string) (*shader.Kernel, error) {
+	var compile func(string) (map[string]*shader.Kernel, error)
 	switch driver {
 	case gpu.DriverMetal:
-		ks, err := shader.Compile(src)
-		if err != nil {
-			return gpu.ShaderSource{}, err
-		}
-		return gpu.ShaderSource{MSL: ks[entry].MSL}, nil
+		compile = shader.Compile
 	case gpu.DriverGL:
-		ks, err := shader.CompileGLSL(src)
-		if err != nil {
-			return gpu.ShaderSource{}, err
-		}
-		return gpu.ShaderSource{GLSL: ks[entry].GLSL}, nil
+		compile = shader.CompileGLSL
+	case gpu.DriverVulkan:
+		compile = shader.CompileSPIRV
+	case gpu.DriverSoftware:
+		compile = shader.CompileCPU
 	default:
-		return gpu.ShaderSource{}, errKernelBackendUnsupported
+		return nil, errKernelBackendUnsupported
 	}
+	ks, err := compile(src)
+	if err != nil {
+		return nil, err
+	}
+	k, ok := ks[entry]
+	if !ok {
+		return nil, fmt.Errorf("render: no kernel %s", entry)
+	}
+	return k, nil
 }
 
 // kernelModule compiles src for dev's backend and returns a shader module for
-// entry. Every render GPU pass goes through here, so the passes are
-// backend-agnostic: the same author-once kernel runs on Metal and GL.
+// entry, carrying the kernel's bindings so its pipeline derives its layout.
+// Every render GPU pass goes through here, so the passes are backend-agnostic:
+// the same author-once kernel runs on Metal, GL, Vulkan and the software
+// driver.
 func kernelModule(dev *gpu.Device, src, entry string) (*gpu.ShaderModule, error) {
-	source, err := kernelSource(dev.Driver(), src, entry)
+	k, err := kernelFor(dev.Driver(), src, entry)
 	if err != nil {
 		return nil, err
 	}
-	return dev.NewShaderModule(source)
+	return dev.NewShaderModuleFromKernel(k)
 }
@@ -11,12 +11,13 @@ import (
 	"poly.red/gpu/shader/gpumath/kernels"
 )
 
-// TestKernelSourceBackend verifies render selects the right shading language per
-// device backend: MSL for Metal, GLSL for GL, unsupported elsewhere. Device-free
-// (shader.Compile/CompileGLSL are pure Go), so it runs in standard CI on every
-// platform without opening a GPU.
-func TestKernelSourceBackend(t *testing.T) {
-	metal, err := kernelSource(gpu.DriverMetal, kernels.ShadeSrc, "Shade")
+// TestKernelForBackend verifies render selects the right shading language per
+// device backend: MSL for Metal, GLSL for GL, SPIR-V for Vulkan, a CPU
+// program for the software driver, unsupported elsewhere. Device-free (the
+// shader compilers are pure Go), so it runs in standard CI on every platform
+// without opening a GPU.
+func TestKernelForBackend(t *testing.T) {
+	metal, err := kernelFor(gpu.DriverMetal, kernels.ShadeSrc, "Shade")
 	if err != nil {
 		t.Fatalf("Metal: %v", err)
 	}
@@ -24,7 +25,7 @@ func TestKernelSourceBackend(t *testing.T) {
 		t.Errorf("Metal: want MSL only, got MSL=%d GLSL=%d bytes", len(metal.MSL), len(metal.GLSL))
 	}
 
-	gl, err := kernelSource(gpu.DriverGL, kernels.ShadeSrc, "Shade")
+	gl, err := kernelFor(gpu.DriverGL, kernels.ShadeSrc, "Shade")
 	if err != nil {
 		t.Fatalf("GL: %v", err)
 	}
@@ -32,7 +33,26 @@ func TestKernelSourceBackend(t *testing.T) {
 		t.Errorf("GL: want GLSL only, got MSL=%d GLSL=%d bytes", len(gl.MSL), len(gl.GLSL))
 	}
 
-	if _, err := kernelSource(gpu.DriverVulkan, kernels.ShadeSrc, "Shade"); err != errKernelBackendUnsupported {
-		t.Errorf("Vulkan: want errKernelBackendUnsupported, got %v", err)
+	vk, err := kernelFor(gpu.DriverVulkan, kernels.ShadeSrc, "Shade")
+	if err != nil {
+		t.Fatalf("Vulkan: %v", err)
+	}
+	if len(vk.SPIRV) == 0 || vk.MSL != "" || vk.GLSL != "" {
+		t.Errorf("Vulkan: want SPIR-V only, got MSL=%d GLSL=%d SPIRV=%d bytes", len(vk.MSL), len(vk.GLSL), len(vk.SPIRV))
+	}
+
+	sw, err := kernelFor(gpu.DriverSoftware, kernels.ShadeSrc, "Shade")
+	if err != nil {
+		t.Fatalf("software: %v", err)
+	}
+	if sw.CPU == nil || sw.MSL != "" || sw.GLSL != "" || len(sw.SPIRV) != 0 {
+		t.Errorf("software: want a CPU program only, got MSL=%d GLSL=%d SPIRV=%d bytes", len(sw.MSL), len(sw.GLSL), len(sw.SPIRV))
+	}
+
+	if _, err := kernelFor(gpu.DriverD3D12, kernels.ShadeSrc, "Shade"); err != errKernelBackendUnsupported {
+		t.Errorf("D3D12: want errKernelBackendUnsupported, got %v", err)
+	}
+	if _, err := kernelFor(gpu.DriverGL, kernels.ShadeSrc, "Shadee"); err == nil {
+		t.Errorf("missing entry: want an error")
 	}
 }
@@ -0,0 +1,234 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render
+
+import "poly.red/gpu"
+
+// gpuResources are the GPU resources the renderer keeps from frame to frame
+// on one device: the passes' shader modules and pipelines, made once; named
+// render targets and kernel buffers, remade only when their size changes;
+// and a pool for the kernel inputs and vertex streams each pass uploads.
+// Every GPU pass waits for its submission before it returns, so the next
+// pass (see Renderer.gpuResources) starts with the pool empty. They are
+// released with the renderer, or when it moves to another device.
+type gpuResources struct {
+	dev       *gpu.Device
+	pool      *gpu.BufferPool
+	textures  map[string]cachedTexture
+	buffers   map[string]cachedBuffer
+	modules   map[[2]string]*gpu.ShaderModule    // by kernel source and entry
+	kernels   map[[2]string]*gpu.ComputePipeline // by kernel source and entry
+	pipelines map[pipelineKey]*gpu.RenderPipeline
+	queries   map[string]*gpu.QuerySet
+	// w and h are the buffer size of the last pass. The pool's blocks are
+	// dropped when it changes, so they do not pile up while a window
+	// resizes.
+	w, h int
+}
+
+type cachedTexture struct {
+	desc gpu.TextureDescriptor
+	tex  *gpu.Texture
+}
+
+type cachedBuffer struct {
+	size  int
+	usage gpu.BufferUsage
+	buf   *gpu.Buffer
+}
+
+// pipelineKey tells apart the render pipelines of gpuResources: a label
+// names the pipeline's shaders and state, which its formats complete.
+type pipelineKey struct {
+	label        string
+	color, depth gpu.TextureFormat
+	samples      int
+}
+
+// gpuResources returns the renderer's resources on dev for a pass over a
+// w x h buffer, with their pool reset. Resources of an earlier device are
+// released.
+func (r *Renderer) gpuResources(dev *gpu.Device, w, h int) (*gpuResources, error) {
+	res := r.gpures
+	if res == nil || res.dev != dev {
+		r.releaseGPUResources()
+		// Vertex streams are storage; index lists share the pool.
+		pool, err := dev.NewBufferPool(gpu.BufferPoolDescriptor{Label: "render", Usage: gpu.BufferStorage | gpu.BufferIndex})
+		if err != nil {
+			return nil, err
+		}
+		res = &gpuResources{
+			dev: dev, pool: pool,
+			textures: map[string]cachedTexture{}, buffers: map[string]cachedBuffer{},
+			modules: map[[2]string]*gpu.ShaderModule{}, kernels: map[[2]string]*gpu.ComputePipeline{},
+			pipelines: map[pipelineKey]*gpu.RenderPipeline{}, queries: map[string]*gpu.QuerySet{},
+		}
+		r.gpures = res
+	}
+	if res.w != w || res.h != h {
+		res.pool.Release()
+		res.w, res.h = w, h
+	}
+	res.pool.Reset()
+	return res, nil
+}
+
+// releaseGPUResources releases the renderer's GPU resources, if it has any.
+// Those of a lost device, closed by its owner say, are only dropped: the
+// device can free nothing more.
+func (r *Renderer) releaseGPUResources() {
+	if res := r.gpures; res != nil && !deviceLost(res.dev) {
+		res.release()
+	}
+	r.gpures = nil
+}
+
+// release frees every resource of res, pipelines before the modules they
+// were made from.
+func (res *gpuResources) release() {
+	res.pool.Release()
+	for _, c := range res.textures {
+		c.tex.Release()
+	}
+	for _, c := range res.buffers {
+		c.buf.Release()
+	}
+	for _, qs := range res.queries {
+		qs.Release()
+	}
+	for _, p := range res.pipelines {
+		p.Release()
+	}
+	for _, p := range res.kernels {
+		p.Release()
+	}
+	for _, m := range res.modules {
+		m.Release()
+	}
+}
+
+// texture returns the texture named name, created with desc unless the one
+// from an earlier frame was.
+func (res *gpuResources) texture(name string, desc gpu.TextureDescriptor) (*gpu.Texture, error) {
+	c, ok := res.textures[name]
+	if ok && c.desc == desc {
+		return c.tex, nil
+	}
+	t, err := res.dev.NewTexture(desc)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		c.tex.Release()
+	}
+	res.textures[name] = cachedTexture{desc: desc, tex: t}
+	return t, nil
+}
+
+// buffer returns the buffer named name, of size bytes and usage, keeping
+// the one from an earlier frame if it matches. Its contents are whatever
+// that frame left.
+func (res *gpuResources) buffer(name string, size int, usage gpu.BufferUsage) (*gpu.Buffer, error) {
+	c, ok := res.buffers[name]
+	if ok && c.size == size && c.usage == usage {
+		return c.buf, nil
+	}
+	b, err := res.dev.NewBuffer(gpu.BufferDescriptor{Label: name, Size: size, Usage: usage})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		c.buf.Release()
+	}
+	res.buffers[name] = cachedBuffer{size: size, usage: usage, buf: b}
+	return b, nil
+}
+
+// querySet returns the query set named name, of typ queries, holding at
+// least count of them. The set of an earlier frame is kept unless it is too
+// small, when one of count, or of twice its size if more, replaces it.
+func (res *gpuResources) querySet(name string, typ gpu.QueryType, count int) (*gpu.QuerySet, error) {
+	qs, ok := res.queries[name]
+	if ok && qs.Count() >= count {
+		return qs, nil
+	}
+	n := count
+	if ok {
+		n = max(count, 2*qs.Count())
+	}
+	q, err := res.dev.NewQuerySet(gpu.QuerySetDescriptor{Label: name, Type: typ, Count: n})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		qs.Release()
+	}
+	res.queries[name] = q
+	return q, nil
+}
+
+// upload writes d to the pool, for binding as a kernel's storage buffer or
+// a vertex stream.
+func (res *gpuResources) upload(d []float32) (gpu.BufferSlice, error) {
+	return res.pool.Write(deferredBytes(d))
+}
+
+// uploadIndices writes a triangle list's indices to the pool (see
+// indexBytes), for binding as an index buffer.
+func (res *gpuResources) uploadIndices(idx []uint32, nverts int) (gpu.BufferSlice, gpu.IndexFormat, error) {
+	b, format := indexBytes(idx, nverts)
+	s, err := res.pool.Write(b)
+	return s, format, err
+}
+
+// kernelModule returns the shader module of the author-once kernel entry
+// of src (see kernelModule).
+func (res *gpuResources) kernelModule(src, entry string) (*gpu.ShaderModule, error) {
+	key := [2]string{src, entry}
+	if m, ok := res.modules[key]; ok {
+		return m, nil
+	}
+	m, err := kernelModule(res.dev, src, entry)
+	if err != nil {
+		return nil, err
+	}
+	res.modules[key] = m
+	return m, nil
+}
+
+// kernel returns the compute pipeline of the author-once kernel entry of
+// src (see kernelModule).
+func (res *gpuResources) kernel(src, entry string) (*gpu.ComputePipeline, error) {
+	key := [2]string{src, entry}
+	if p, ok := res.kernels[key]; ok {
+		return p, nil
+	}
+	mod, err := res.kernelModule(src, entry)
+	if err != nil {
+		return nil, err
+	}
+	p, err := res.dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		return nil, err
+	}
+	res.kernels[key] = p
+	return p, nil
+}
+
+// renderPipeline returns the render pipeline of desc. desc.Label names its
+// shaders and state: two descriptors of one label differ at most in their
+// color and depth formats and sample count.
+func (res *gpuResources) renderPipeline(desc gpu.RenderPipelineDescriptor) (*gpu.RenderPipeline, error) {
+	key := pipelineKey{label: desc.Label, color: desc.ColorFormat, depth: desc.DepthFormat, samples: desc.SampleCount}
+	if p, ok := res.pipelines[key]; ok {
+		return p, nil
+	}
+	p, err := res.dev.NewRenderPipeline(desc)
+	if err != nil {
+		return nil, err
+	}
+	res.pipelines[key] = p
+	return p, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render
+
+import (
+	"bytes"
+	"maps"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestGPUResourcesReuse renders two frames through the GPU deferred pass on
+// the software driver and checks that the second reuses the first's kernel
+// buffers and pipelines and renders the same image from them.
+func TestGPUResourcesReuse(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	defer dev.Close()
+
+	const w, h = 64, 64
+	s, c := newscene(w, h)
+	r := NewRenderer(Scene(s), Camera(c), Size(w, h), Workers(1), BatchSize(1), GammaCorrection(true), GPU(dev), forwardOnCPU())
+	first := bytes.Clone(r.Render().Pix)
+	if !r.passOnGPU("deferred") {
+		t.Fatal("deferred did not run on the software driver")
+	}
+	bufs := map[string]*gpu.Buffer{}
+	for name, c := range r.gpures.buffers {
+		bufs[name] = c.buf
+	}
+	if len(bufs) == 0 {
+		t.Fatal("the deferred pass kept no buffers")
+	}
+	kernels := maps.Clone(r.gpures.kernels)
+	if len(kernels) == 0 {
+		t.Fatal("the deferred pass kept no pipelines")
+	}
+
+	second := r.Render().Pix
+	for name, c := range r.gpures.buffers {
+		if bufs[name] != c.buf {
+			t.Errorf("second frame made a new %q buffer", name)
+		}
+	}
+	for key, p := range r.gpures.kernels {
+		if kernels[key] != p {
+			t.Errorf("second frame made a new %s pipeline", key[1])
+		}
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("second frame, from reused buffers, differs from the first")
+	}
+}
+
+// TestGPUResourcesRelease checks that moving a renderer to another device
+// releases the resources it kept on the first, and that Close releases
+// those on the second.
+func TestGPUResourcesRelease(t *testing.T) {
+	var devs [2]*gpu.Device
+	for i := range devs {
+		dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+		if err != nil {
+			t.Fatalf("software device: %v", err)
+		}
+		defer dev.Close()
+		devs[i] = dev
+	}
+
+	const w, h = 32, 32
+	s, c := newscene(w, h)
+	r := NewRenderer(Scene(s), Camera(c), Size(w, h), Workers(1), BatchSize(1), GPU(devs[0]), forwardOnCPU())
+	kept := func() []*gpu.Buffer {
+		r.Render()
+		if !r.passOnGPU("deferred") {
+			t.Fatal("deferred did not run on the software driver")
+		}
+		var bufs []*gpu.Buffer
+		for _, c := range r.gpures.buffers {
+			bufs = append(bufs, c.buf)
+		}
+		if len(bufs) == 0 {
+			t.Fatal("the deferred pass kept no buffers")
+		}
+		return bufs
+	}
+	released := func(when string, bufs []*gpu.Buffer) {
+		for _, b := range bufs {
+			if b.Bytes() != nil {
+				t.Errorf("%s: a kept buffer was not released", when)
+				return
+			}
+		}
+	}
+
+	first := kept()
+	r.cfg.GPUDevice = devs[1]
+	second := kept()
+	released("after moving to another device", first)
+	r.Close()
+	released("after Close", second)
+}
@@ -0,0 +1,198 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render
+
+import (
+	"poly.red/geometry/primitive"
+	"poly.red/gpu"
+	"poly.red/math"
+)
+
+// Occlusion culling in the GPU forward pass (the OcclusionCulling option).
+// After the G-buffer draws, the bounding box of every scene object is drawn
+// into the same depth buffer inside its own occlusion query, with depth and
+// color writes off. An object whose box had no visible sample is marked
+// occluded, and the next frame's forward pass leaves its instance out. Its
+// box is still tested every frame, so an object that comes into view is drawn
+// again one frame later.
+//
+// Objects are identified by the order the scene traversal reaches them, so a
+// scene that gains or loses objects invalidates the previous frame's results
+// (occlusionResults then drops them).
+
+// forwardProxy is the bounding box of one scene object as an instance of
+// the unit cube: its inst maps the cube onto the object's model AABB.
+type forwardProxy struct {
+	inst []float32 // forwardInstanceFloats; only trans is read
+	// test is false for a box that cannot be tested: one crossing the near
+	// plane, which would be clipped and could read as occluded, or an empty
+	// one. Its object is always drawn.
+	test bool
+}
+
+// proxyPad is how much a proxy box grows on each side, relative to its
+// largest extent. It keeps a box facing the camera in front of the surface it
+// bounds despite depth rounding, and gives flat objects a thickness.
+const proxyPad = 1.0 / 256
+
+// newForwardProxy returns the proxy of an object with model-space bounds
+// aabb drawn with the model-to-clip transform trans.
+func newForwardProxy(aabb primitive.AABB, trans math.Mat4[float32]) forwardProxy {
+	size := aabb.Max.Sub(aabb.Min)
+	pad := max(size.X, size.Y, size.Z) * proxyPad
+	if !(pad > 0) {
+		return forwardProxy{}
+	}
+	lo := aabb.Min.Sub(math.NewVec3(pad, pad, pad))
+	size = size.Add(math.NewVec3(2*pad, 2*pad, 2*pad))
+	box := trans.MulM(math.NewMat4[float32](
+		size.X, 0, 0, lo.X,
+		0, size.Y, 0, lo.Y,
+		0, 0, size.Z, lo.Z,
+		0, 0, 0, 1,
+	))
+	p := forwardProxy{inst: make([]float32, forwardInstanceFloats), test: true}
+	cm := colMajorMat4(box)
+	copy(p.inst, cm[:])
+	for _, c := range unitCube {
+		// The forward vertex stage negates trans*pos and then flips z (see
+		// kernels.ForwardVertex); a corner beyond the near plane has clip z < -w.
+		v := box.MulV(math.NewVec4(c[0], c[1], c[2], 1))
+		if w, z := -v.W, v.Z; w <= 0 || z < -w {
+			p.test = false
+			break
+		}
+	}
+	return p
+}
+
+// unitCube holds the corners of the unit cube and unitCubeIndices its
+// twelve triangles. Proxies are drawn without culling, so winding is free.
+var (
+	unitCube = [8][3]float32{
+		{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0},
+		{0, 0, 1}, {1, 0, 1}, {0, 1, 1}, {1, 1, 1},
+	}
+	unitCubeIndices = []uint32{
+		0, 1, 2, 2, 1, 3, // z = 0
+		4, 6, 5, 5, 6, 7, // z = 1
+		0, 2, 4, 4, 2, 6, // x = 0
+		1, 5, 3, 3, 5, 7, // x = 1
+		0, 4, 1, 1, 4, 5, // y = 0
+		2, 3, 6, 6, 3, 7, // y = 1
+	}
+)
+
+// occlusionTest draws the proxies of one forward pass, each in its own
+// occlusion query. A nil *occlusionTest, for a frame without culling, tests
+// nothing.
+type occlusionTest struct {
+	proxies []forwardProxy
+	qs      *gpu.QuerySet // res's, of a query per proxy or more
+	pipe    *gpu.RenderPipeline
+	streams [4]gpu.BufferSlice // the cube's pos, nor, mid and uv streams
+	index   gpu.BufferSlice
+	format  gpu.IndexFormat
+	inst    gpu.BufferSlice // the tested proxies' instances, in order
+	first   []int           // per proxy, its instance in inst; -1 if not tested
+}
+
+// newOcclusionTest prepares the proxies' draws with the forward pass's
+// pipeline desc and res's pool, or returns nil when there is nothing to
+// test or the device cannot: the frame then draws everything and culls
+// nothing next frame.
+func newOcclusionTest(res *gpuResources, desc gpu.RenderPipelineDescriptor, proxies []forwardProxy) *occlusionTest {
+	t := &occlusionTest{proxies: proxies, first: make([]int, len(proxies))}
+	var inst []float32
+	for i, p := range proxies {
+		t.first[i] = -1
+		if p.test {
+			t.first[i] = len(inst) / forwardInstanceFloats
+			inst = append(inst, p.inst...)
+		}
+	}
+	if len(inst) == 0 {
+		return nil
+	}
+	var err error
+	if t.inst, err = res.upload(inst); err != nil {
+		return nil
+	}
+	pos := make([]float32, 0, 4*len(unitCube))
+	for _, c := range unitCube {
+		pos = append(pos, c[0], c[1], c[2], 1)
+	}
+	zeros := make([]float32, 4*len(unitCube))
+	for i, d := range [][]float32{pos, zeros, zeros[:len(unitCube)], zeros[:2*len(unitCube)]} {
+		if t.streams[i], err = res.upload(d); err != nil {
+			return nil
+		}
+	}
+	if t.index, t.format, err = res.uploadIndices(unitCubeIndices, len(unitCube)); err != nil {
+		return nil
+	}
+
+	// The proxies test against the G-buffer's depth without changing it or
+	// the G-buffer targets.
+	desc.Label = "occlusion"
+	desc.CullMode = gpu.CullNone
+	desc.DepthCompare = gpu.CompareLessEqual
+	desc.DepthWriteEnabled = false
+	desc.ColorWriteMask = gpu.ColorWriteNone
+	if t.pipe, err = res.renderPipeline(desc); err != nil {
+		return nil
+	}
+	if t.qs, err = res.querySet("occlusion", gpu.QueryOcclusion, len(proxies)); err != nil {
+		return nil
+	}
+	return t
+}
+
+// querySet returns the set the forward pass's descriptor needs, or nil.
+func (t *occlusionTest) querySet() *gpu.QuerySet {
+	if t == nil {
+		return nil
+	}
+	return t.qs
+}
+
+// encode draws the proxies into rp after the forward draws.
+func (t *occlusionTest) encode(rp *gpu.RenderPass) {
+	if t == nil {
+		return
+	}
+	rp.SetPipeline(t.pipe)
+	for i, s := range t.streams {
+		rp.SetVertexSlice(i, s)
+	}
+	rp.SetVertexSlice(4, t.inst)
+	rp.SetIndexSlice(t.index, t.format)
+	for i, first := range t.first {
+		if first < 0 {
+			continue
+		}
+		rp.BeginOcclusionQuery(i)
+		rp.DrawIndexedInstanced(gpu.TriangleList, 0, len(unitCubeIndices), 0, first, 1)
+		rp.EndOcclusionQuery()
+	}
+}
+
+// occluded reads which proxies were fully hidden, indexed like the proxies.
+// The pass must have completed. It returns nil when t is nil or the results
+// cannot be read, so that nothing is culled.
+func (t *occlusionTest) occluded() []bool {
+	if t == nil {
+		return nil
+	}
+	res, err := t.qs.Results(0, len(t.proxies))
+	if err != nil {
+		return nil
+	}
+	occluded := make([]bool, len(t.proxies))
+	for i, p := range t.proxies {
+		occluded[i] = p.test && res[i] == 0
+	}
+	return occluded
+}
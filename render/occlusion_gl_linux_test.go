@@ -0,0 +1,101 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+//go:build linux
+
+package render
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"slices"
+	"testing"
+
+	"poly.red/buffer"
+	"poly.red/camera"
+	"poly.red/geometry"
+	"poly.red/geometry/mesh"
+	"poly.red/geometry/primitive"
+	"poly.red/gpu"
+	"poly.red/light"
+	"poly.red/material"
+	"poly.red/math"
+	"poly.red/scene"
+)
+
+// TestGLOcclusionCulling renders a quad hidden behind another and checks the
+// forward pass marks it occluded, leaves it out of the next frame without
+// changing the image, reusing its query set, and draws it again once it
+// comes into view. Skipped unless EGL_PLATFORM=surfaceless.
+func TestGLOcclusionCulling(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL render test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	quad := func(x, y, size, z float32, col color.RGBA) *geometry.Geometry {
+		v := func(dx, dy float32) *primitive.Vertex {
+			return primitive.NewVertex(
+				primitive.Pos(math.NewVec4(x+dx*size, y+dy*size, z, 1)),
+				primitive.Nor(math.NewVec4[float32](0, 0, 1, 0)),
+			)
+		}
+		a, b, c, d := v(0, 0), v(1, 0), v(0, 1), v(1, 1)
+		return geometry.New(mesh.NewTriangleMesh([]*primitive.Triangle{
+			primitive.NewTriangle(a, b, c),
+			primitive.NewTriangle(c, b, d),
+		}), material.NewBlinnPhong(material.Texture(buffer.NewUniformTexture(col))))
+	}
+	occluder := quad(-0.5, -0.5, 1, 1, color.RGBA{255, 0, 0, 255})
+	hidden := quad(-0.25, -0.25, 0.5, -1, color.RGBA{0, 255, 0, 255})
+	side := quad(1.1, -0.2, 0.4, -1, color.RGBA{0, 0, 255, 255})
+	s := scene.NewScene(light.NewAmbient(light.Intensity(1)), occluder, hidden, side)
+	cam := camera.NewPerspective(
+		camera.Position(math.NewVec3[float32](0, 0, 3)),
+		camera.LookAt(math.NewVec3[float32](0, 0, 0), math.NewVec3[float32](0, 1, 0)),
+		camera.ViewFrustum(45, 1, 0.1, 10),
+	)
+	r := NewRenderer(Scene(s), Camera(cam), Size(64, 64), GPU(dev), OcclusionCulling(true))
+
+	// Render returns the frame's buffer, which a later frame reuses.
+	first := slices.Clone(r.Render().Pix)
+	if !r.passGPU["forward"] {
+		t.Fatalf("forward pass did not run on the GPU")
+	}
+	if want := []bool{false, true, false}; !slices.Equal(r.occluded, want) {
+		t.Fatalf("occluded after the first frame = %v, want %v", r.occluded, want)
+	}
+	objs, _ := r.buildForwardObjects()
+	if n := len(objs[1].inst) / forwardInstanceFloats; n != 0 {
+		t.Fatalf("hidden quad has %d instances, want 0", n)
+	}
+	qs := r.gpures.queries["occlusion"]
+	if second := r.Render().Pix; !bytes.Equal(first, second) {
+		t.Fatalf("culling the hidden quad changed the image")
+	}
+	if r.gpures.queries["occlusion"] != qs {
+		t.Errorf("the second frame made a new occlusion query set")
+	}
+	if want := []bool{false, true, false}; !slices.Equal(r.occluded, want) {
+		t.Fatalf("occluded after the second frame = %v, want %v", r.occluded, want)
+	}
+
+	// Move the occluder aside: the hidden quad's box is visible again, and
+	// the frame after draws it.
+	occluder.Translate(-1, 0, 0)
+	r.Render()
+	if want := []bool{false, false, false}; !slices.Equal(r.occluded, want) {
+		t.Fatalf("occluded after the occluder moved = %v, want %v", r.occluded, want)
+	}
+	culled := slices.Clone(r.Render().Pix)
+	ref := NewRenderer(Scene(s), Camera(cam), Size(64, 64), GPU(dev)).Render()
+	if !bytes.Equal(culled, ref.Pix) {
+		t.Fatalf("image with occlusion culling differs from the one without")
+	}
+}
@@ -28,6 +28,7 @@ type option struct {
 	Scene         *scene.Scene
 	BlendFunc     BlendFunc
 	GPUDevice     *gpu.Device
+	OcclusionCull bool
 	forceCPU      bool
 	forwardCPU    bool // force the forward raster on the CPU while other passes may use the GPU
 }
@@ -63,6 +64,9 @@ func Background(c color.RGBA) Option {
 	return func(o *option) { o.Background = c }
 }
 
+// MSAA is an option that antialiases by rendering n x n samples per pixel
+// and averaging them. With n above 1 the GPU forward pass also draws each of
+// those samples 4x multisampled and resolves it by hardware.
 func MSAA(n int) Option {
 	return func(o *option) { o.MSAA = n }
 }
@@ -79,6 +83,15 @@ func GPU(dev *gpu.Device) Option {
 	return func(o *option) { o.GPUDevice = dev }
 }
 
+// OcclusionCulling is an option that skips, in the GPU forward pass, scene
+// objects whose bounding box was hidden behind other objects in the previous
+// frame, or outside the view. It pays off for scenes of many objects
+// occluding each other. Boxes are tested every frame, so an object that comes
+// into view again is drawn one frame late. The CPU forward pass ignores it.
+func OcclusionCulling(enable bool) Option {
+	return func(o *option) { o.OcclusionCull = enable }
+}
+
 // CPU forces the CPU path: NewRenderer will not acquire a GPU device, so every
 // pass runs on the CPU. Use it for the parity reference and benchmarks. Without
 // it, NewRenderer acquires a device automatically (GPU by default) and falls
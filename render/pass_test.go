@@ -6,9 +6,11 @@ package render
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"poly.red/gpu"
+	"poly.red/gpu/shader"
 )
 
 // TestRunPassNoDevice: with no GPU device, runPass runs the CPU closure and
@@ -72,3 +74,99 @@ func TestGPUByDefault(t *testing.T) {
 		t.Errorf("CPU(): deferred should run on CPU")
 	}
 }
+
+// TestStatsCPU: a CPU frame reports each pass once, in run order, with a CPU
+// time and no GPU time.
+func TestStatsCPU(t *testing.T) {
+	s, c := newscene(32, 32)
+	r := NewRenderer(Scene(s), Camera(c), Size(32, 32), GammaCorrection(true), CPU())
+	for range 2 { // stats cover the last frame only
+		r.Render()
+	}
+	stats := r.Stats()
+	var names []string
+	for _, ps := range stats {
+		names = append(names, ps.Name)
+		if ps.GPU || ps.GPUTime != 0 || len(ps.Stages) != 0 {
+			t.Errorf("%s: CPU pass has GPU stats %+v", ps.Name, ps)
+		}
+		if ps.CPU <= 0 {
+			t.Errorf("%s: CPU time %v, want > 0", ps.Name, ps.CPU)
+		}
+	}
+	if got, want := strings.Join(names, ","), "forward,deferred,gamma"; got != want {
+		t.Fatalf("passes %s, want %s", got, want)
+	}
+}
+
+// TestRunPassDeviceError: a GPU closure that returns nil but whose work the
+// device rejected falls back to the CPU, through the error scopes runPass
+// opens. The software driver reports a dispatch of a kernel missing its buffer.
+func TestRunPassDeviceError(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	defer dev.Close()
+	ks, err := shader.CompileCPU("package kernels\n\nfunc K(gid uint, out []float32) { out[gid] = 1 }\n")
+	if err != nil {
+		t.Fatalf("CompileCPU: %v", err)
+	}
+	mod, err := dev.NewShaderModuleFromKernel(ks["K"])
+	if err != nil {
+		t.Fatalf("NewShaderModuleFromKernel: %v", err)
+	}
+	p, err := dev.NewComputePipeline(gpu.ComputePipelineDescriptor{Module: mod})
+	if err != nil {
+		t.Fatalf("NewComputePipeline: %v", err)
+	}
+	r := NewRenderer(GPU(dev))
+
+	ran := ""
+	r.runPass("unbound", func() error {
+		ran = "gpu"
+		enc := dev.NewCommandEncoder()
+		cp := enc.BeginComputePass()
+		cp.SetPipeline(p)
+		cp.Dispatch(1, 1, 1)
+		cp.End()
+		dev.Queue().Submit(enc.Finish())
+		return nil
+	}, func() { ran += "+cpu" })
+	if ran != "gpu+cpu" || r.passOnGPU("unbound") {
+		t.Errorf("device error should fall back to CPU (ran=%q, onGPU=%v)", ran, r.passOnGPU("unbound"))
+	}
+}
+
+// TestRunPassDeviceLost: once the renderer's device is lost, here closed
+// by its owner, the passes run on the CPU and the renderer no longer uses
+// the device.
+func TestRunPassDeviceLost(t *testing.T) {
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverSoftware))
+	if err != nil {
+		t.Fatalf("software device: %v", err)
+	}
+	const w, h = 32, 32
+	s, c := newscene(w, h)
+	r := NewRenderer(Scene(s), Camera(c), Size(w, h), Workers(1), BatchSize(1), GPU(dev))
+	r.Render()
+	if !r.passOnGPU("deferred") {
+		t.Fatal("deferred did not run on the software driver")
+	}
+	dev.Close()
+
+	ran := ""
+	r.runPass("lost", func() error { ran = "gpu"; return nil }, func() { ran = "cpu" })
+	if ran != "cpu" || r.passOnGPU("lost") {
+		t.Errorf("a pass on a lost device ran on the %s, want the CPU", ran)
+	}
+	if r.cfg.GPUDevice != nil || r.gpures != nil {
+		t.Error("the renderer kept the lost device")
+	}
+	r.Render()
+	for _, ps := range r.Stats() {
+		if ps.GPU {
+			t.Errorf("%s ran on the GPU after the device was lost", ps.Name)
+		}
+	}
+}
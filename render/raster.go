@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"image"
 	"runtime"
+	"time"
 
 	"poly.red/buffer"
 	"poly.red/color"
@@ -54,25 +55,113 @@ type Renderer struct {
 	// ran (true) or the CPU fallback (false). See runPass.
 	passGPU map[string]bool
 
+	// stats are the timings of the passes of the current frame (see Stats),
+	// and timers the GPU timers of the running pass (see newGPUTimer).
+	stats  []PassStats
+	timers []*gpuTimer
+
+	// occluded marks, by scene traversal order, the objects the last GPU
+	// forward pass found hidden (see OcclusionCulling and occlusionTest).
+	occluded []bool
+
+	// deferredGamma reports that the GPU deferred pass of this frame also ran
+	// the gamma pass in its submission, so passAntialiasing must not reapply it.
+	deferredGamma bool
+
+	// gpures are the GPU resources the passes reuse across frames.
+	gpures *gpuResources
+
 	// ownDevice is the GPU device NewRenderer acquired itself (GPU by default);
-	// it is closed by the finalizer. A caller-supplied device (render.GPU) is
-	// not stored here and not closed by the renderer.
+	// it is closed with the renderer (see Close). A caller-supplied device
+	// (render.GPU) is not stored here and not closed by the renderer.
 	ownDevice *gpu.Device
 }
 
 // runPass runs a pass on the GPU when a device is present and the GPU closure
-// succeeds, otherwise on the CPU; it records which path executed under name.
-// This is the single dispatch seam the unified renderer's passes share (see
-// specs/foundations/render-pass-runner.md).
+// succeeds, reporting no device error either (see captureGPUErrors), otherwise
+// on the CPU; it records which path executed under name,
+// and the pass's timings in the frame's Stats. This is the single dispatch
+// seam the unified renderer's passes share (see
+// specs/foundations/render-pass-runner.md). Once the device is lost, the
+// renderer drops it (see dropLostDevice) rather than fail on it every pass.
 func (r *Renderer) runPass(name string, gpu func() error, cpu func()) {
+	start := time.Now()
+	if dev := r.cfg.GPUDevice; dev != nil && deviceLost(dev) {
+		r.dropLostDevice()
+	}
 	if r.cfg.GPUDevice != nil && gpu != nil {
-		if err := gpu(); err == nil {
+		err := captureGPUErrors(r.cfg.GPUDevice, gpu)
+		stages := r.readTimers()
+		if err == nil {
 			r.passGPU[name] = true
+			r.recordPass(name, true, start, stages)
 			return
 		}
 	}
 	cpu()
 	r.passGPU[name] = false
+	r.recordPass(name, false, start, nil)
+}
+
+// captureGPUErrors runs fn inside error scopes of every filter and returns
+// its error, or else the first error dev reported while it ran: a GL error
+// raised as a command buffer replayed, say, leaves fn's own result intact.
+func captureGPUErrors(dev *gpu.Device, fn func() error) error {
+	filters := []gpu.ErrorFilter{gpu.ErrorFilterValidation, gpu.ErrorFilterOutOfMemory, gpu.ErrorFilterInternal}
+	for _, f := range filters {
+		dev.PushErrorScope(f)
+	}
+	err := fn()
+	for range filters {
+		if serr := dev.PopErrorScope(); err == nil && serr != nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// dropLostDevice makes the renderer CPU-only after its device was lost:
+// every later pass would fail on it. The resources it kept there are gone,
+// and a device the renderer opened itself is closed.
+func (r *Renderer) dropLostDevice() {
+	r.releaseGPUResources()
+	if r.ownDevice != nil {
+		r.ownDevice.Close()
+		r.ownDevice = nil
+	}
+	r.cfg.GPUDevice = nil
+}
+
+// deviceLost reports, without waiting, whether dev is lost. It may take the
+// LostInfo of dev's Lost channel; later receives find the channel closed.
+func deviceLost(dev *gpu.Device) bool {
+	select {
+	case <-dev.Lost():
+		return true
+	default:
+		return false
+	}
+}
+
+// readTimers returns the GPU stages the timers of the pass that just ran
+// measured, and drops the timers.
+func (r *Renderer) readTimers() []StageStats {
+	var stages []StageStats
+	for _, t := range r.timers {
+		stages = append(stages, t.stages()...)
+	}
+	r.timers = r.timers[:0]
+	return stages
+}
+
+// recordPass appends the timings of a pass that started at start to the
+// frame's stats.
+func (r *Renderer) recordPass(name string, onGPU bool, start time.Time, stages []StageStats) {
+	ps := PassStats{Name: name, GPU: onGPU, CPU: time.Since(start), Stages: stages}
+	for _, s := range stages {
+		ps.GPUTime += s.GPUTime
+	}
+	r.stats = append(r.stats, ps)
 }
 
 // passOnGPU reports whether the named pass ran on the GPU in the last frame.
@@ -105,8 +194,8 @@ func NewRenderer(opts ...Option) *Renderer {
 	// GPU by default: acquire a device automatically unless one was supplied
 	// (render.GPU) or the CPU path was forced (render.CPU). Acquisition failure
 	// (e.g. a headless machine with no driver) is non-fatal: the renderer runs
-	// all-CPU. A device the renderer opens itself is closed in the finalizer; a
-	// caller-supplied device is left untouched.
+	// all-CPU. A device the renderer opens itself is closed with the renderer;
+	// a caller-supplied device is left untouched.
 	if r.cfg.GPUDevice == nil && !r.cfg.forceCPU {
 		// The renderer's GPU offload (gpudeferred.go / gpugamma.go) emits MSL
 		// today, so only a Metal device is usable. Request Metal specifically:
@@ -125,12 +214,7 @@ func NewRenderer(opts ...Option) *Renderer {
 	r.resetBufs()
 
 	r.sched = sched.New(sched.Workers(r.cfg.Workers))
-	runtime.SetFinalizer(r, func(r *Renderer) {
-		r.sched.Release()
-		if r.ownDevice != nil {
-			r.ownDevice.Close()
-		}
-	})
+	runtime.SetFinalizer(r, (*Renderer).close)
 
 	// initialize shadow maps
 	if r.cfg.Scene != nil && r.cfg.ShadowMap {
@@ -142,6 +226,22 @@ func NewRenderer(opts ...Option) *Renderer {
 	return r
 }
 
+// Close releases the renderer's workers and GPU resources, and closes the
+// GPU device it opened itself. The renderer is not used afterwards. A
+// renderer that is not closed is released once it is garbage collected.
+func (r *Renderer) Close() {
+	runtime.SetFinalizer(r, nil)
+	r.close()
+}
+
+func (r *Renderer) close() {
+	r.sched.Release()
+	r.releaseGPUResources()
+	if r.ownDevice != nil {
+		r.ownDevice.Close()
+	}
+}
+
 // resetBuffers assign new buffers to the caches window buffers (w.bufs)
 // Note: with Metal, we always use RGBA pixel format.
 func (r *Renderer) resetBufs() {
@@ -165,6 +265,7 @@ func (r *Renderer) Render() *image.RGBA {
 	// record running
 	r.startRunning()
 	defer r.stopRunning()
+	r.stats = nil
 
 	// reset buffers
 	buf.ClearColor()
@@ -216,11 +317,20 @@ func (r *Renderer) passForward() {
 		// Deferred/gamma parity gates set this to shade a CPU-built G-buffer, so they
 		// isolate the pass under test (identical input to the CPU reference) rather
 		// than folding in the GPU forward rasterizer's boundary parity band.
+		start := time.Now()
 		r.cpuForwardPass()
 		r.passGPU["forward"] = false
+		r.recordPass("forward", false, start, nil)
 		return
 	}
-	r.runPass("forward", r.gpuForwardPass, r.cpuForwardPass)
+	r.runPass("forward", r.gpuForwardPass, func() {
+		// A GPU pass that failed once its work ran may have read back
+		// fragments already.
+		if r.cfg.GPUDevice != nil {
+			r.CurrBuffer().ClearFragment()
+		}
+		r.cpuForwardPass()
+	})
 }
 
 func (r *Renderer) cpuForwardPass() {
@@ -297,6 +407,7 @@ func (r *Renderer) passDeferred() {
 	// Offload deferred shading to the GPU when a device is provided and the
 	// scene is supported; otherwise shade on the CPU. Shadow mapping is not yet
 	// handled by the GPU path.
+	r.deferredGamma = false
 	r.runPass("deferred", func() error {
 		ls, es := r.cfg.Scene.Lights()
 		var sd *gpuShadowData
@@ -306,8 +417,18 @@ func (r *Renderer) passDeferred() {
 				return errGPUDeferredUnsupported
 			}
 		}
-		return gpuDeferredShade(r.cfg.GPUDevice, buf, ls, es, r.cfg.Camera.Position(), r.cfg.Background, sd, r.matTable)
+		res, err := r.gpuResources(r.cfg.GPUDevice, buf.Bounds().Dx(), buf.Bounds().Dy())
+		if err != nil {
+			return err
+		}
+		timer := r.newGPUTimer(res, "deferred", deferredStages)
+		if err := gpuDeferredShade(res, timer, buf, ls, es, r.cfg.Camera.Position(), r.cfg.Background, sd, r.matTable, r.cfg.GammaCorrect); err != nil {
+			return err
+		}
+		r.deferredGamma = r.cfg.GammaCorrect
+		return nil
 	}, func() {
+		r.deferredGamma = false
 		r.DrawFragments(buf, func(frag *primitive.Fragment) color.RGBA {
 			return r.shade(frag, uniforms)
 		})
@@ -368,8 +489,16 @@ func (r *Renderer) passAntialiasing() {
 	// provided (render.GPU(dev)), otherwise on the CPU.
 	if r.cfg.GammaCorrect {
 		r.runPass("gamma", func() error {
+			if r.deferredGamma {
+				return nil // already applied by the GPU deferred chain
+			}
+			img := r.CurrBuffer().Image()
+			res, err := r.gpuResources(r.cfg.GPUDevice, img.Bounds().Dx(), img.Bounds().Dy())
+			if err != nil {
+				return err
+			}
 			// Image() aliases the buffer's color storage, so this writes back.
-			return gpuGammaCorrect(r.cfg.GPUDevice, r.CurrBuffer().Image())
+			return gpuGammaCorrect(res, r.newGPUTimer(res, "gamma", 1), img)
 		}, func() {
 			r.DrawFragments(r.CurrBuffer(), shader.GammaCorrection)
 		})
@@ -0,0 +1,102 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+package render
+
+import (
+	"slices"
+	"time"
+
+	"poly.red/gpu"
+)
+
+// PassStats is how long one pass of the last frame took.
+type PassStats struct {
+	// Name is the pass: "forward", "deferred" or "gamma".
+	Name string
+	// GPU reports whether the pass ran on the GPU path (see runPass).
+	GPU bool
+	// CPU is the wall time of the pass, including the time spent waiting for
+	// the GPU and, after a GPU failure, the CPU fallback.
+	CPU time.Duration
+	// GPUTime is the time the pass's GPU work took, the sum of Stages. It is
+	// 0 for a pass run on the CPU or a device without timestamp queries.
+	GPUTime time.Duration
+	// Stages are the GPU passes the pass submitted, in order, such as the
+	// deferred pass's Shade, Shadow and AO kernels.
+	Stages []StageStats
+}
+
+// StageStats is the GPU time of one compute or render pass of a renderer
+// pass.
+type StageStats struct {
+	Name    string
+	GPUTime time.Duration
+}
+
+// Stats returns the timings of the passes of the last frame, in the order
+// they ran.
+func (r *Renderer) Stats() []PassStats {
+	stats := slices.Clone(r.stats)
+	for i := range stats {
+		stats[i].Stages = slices.Clone(stats[i].Stages)
+	}
+	return stats
+}
+
+// gpuTimer hands out timestamp writes for the GPU passes of one renderer
+// pass, one pair per stage. A nil *gpuTimer, for a device without timestamp
+// queries, writes nothing.
+type gpuTimer struct {
+	qs    *gpu.QuerySet
+	n     int // the queries of qs the timer may write
+	names []string
+}
+
+// newGPUTimer returns a timer for up to n stages of the running pass, which
+// runPass reads once the pass is done, or nil when the device cannot time GPU
+// work. Its queries are the pass's query set of res, kept from frame to
+// frame.
+func (r *Renderer) newGPUTimer(res *gpuResources, pass string, n int) *gpuTimer {
+	qs, err := res.querySet(pass+" timer", gpu.QueryTimestamp, 2*n)
+	if err != nil {
+		return nil
+	}
+	t := &gpuTimer{qs: qs, n: 2 * n}
+	r.timers = append(r.timers, t)
+	return t
+}
+
+// writes returns the timestamp writes of the stage name, or nil when t is nil
+// or out of queries.
+func (t *gpuTimer) writes(name string) *gpu.PassTimestampWrites {
+	if t == nil || 2*len(t.names) >= t.n {
+		return nil
+	}
+	i := 2 * len(t.names)
+	t.names = append(t.names, name)
+	return &gpu.PassTimestampWrites{QuerySet: t.qs, BeginIndex: i, EndIndex: i + 1}
+}
+
+// stages reads the stage timings. The work writing them must have
+// completed.
+func (t *gpuTimer) stages() []StageStats {
+	if len(t.names) == 0 {
+		return nil
+	}
+	ts, err := t.qs.Results(0, 2*len(t.names))
+	if err != nil {
+		return nil
+	}
+	stages := make([]StageStats, len(t.names))
+	for i, name := range t.names {
+		stages[i].Name = name
+		// A GL driver without a timestamp counter reads begin as 0 and end as
+		// the duration, so the difference is the duration either way.
+		if begin, end := ts[2*i], ts[2*i+1]; end > begin {
+			stages[i].GPUTime = time.Duration(end - begin)
+		}
+	}
+	return stages
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 The Polyred Authors. All rights reserved.
+// Use of this source code is governed by a GPLv3 license that
+// can be found in the LICENSE file.
+
+//go:build linux
+
+package render
+
+import (
+	"maps"
+	"os"
+	"testing"
+
+	"poly.red/gpu"
+)
+
+// TestGLStats renders a frame on the GL GPU and checks Stats reports the GPU
+// time of the forward G-buffer pass and of each deferred kernel, within the
+// pass's CPU time, and that the next frame times them with the same query
+// sets. Skipped unless EGL_PLATFORM=surfaceless.
+func TestGLStats(t *testing.T) {
+	if os.Getenv("EGL_PLATFORM") != "surfaceless" {
+		t.Skip("set EGL_PLATFORM=surfaceless to run the GL render test")
+	}
+	dev, err := gpu.Open(gpu.WithDriver(gpu.DriverGL))
+	if err != nil {
+		t.Skipf("no GL device: %v", err)
+	}
+	defer dev.Close()
+
+	s, c := newscene(64, 64)
+	r := NewRenderer(Scene(s), Camera(c), Size(64, 64), GammaCorrection(true), GPU(dev))
+	r.Render()
+
+	stages := map[string][]string{
+		"forward":  {"GBuffer"},
+		"deferred": {"Shade", "Quantize", "SRGB"},
+		"gamma":    nil, // chained into the deferred submission
+	}
+	stats := r.Stats()
+	if len(stats) != len(stages) {
+		t.Fatalf("got %d passes, want %d: %+v", len(stats), len(stages), stats)
+	}
+	for _, ps := range stats {
+		t.Logf("%s: cpu %v gpu %v %+v", ps.Name, ps.CPU, ps.GPUTime, ps.Stages)
+		want, ok := stages[ps.Name]
+		if !ok || !ps.GPU {
+			t.Fatalf("unexpected pass %+v", ps)
+		}
+		if len(ps.Stages) != len(want) {
+			t.Fatalf("%s: stages %+v, want %v", ps.Name, ps.Stages, want)
+		}
+		for i, st := range ps.Stages {
+			if st.Name != want[i] || st.GPUTime <= 0 {
+				t.Errorf("%s: stage %d is %+v, want %s with a GPU time", ps.Name, i, st, want[i])
+			}
+		}
+		if ps.GPUTime > ps.CPU {
+			t.Errorf("%s: GPU time %v exceeds the pass's wall time %v", ps.Name, ps.GPUTime, ps.CPU)
+		}
+	}
+	sets := maps.Clone(r.gpures.queries)
+	if len(sets) == 0 {
+		t.Fatal("the frame kept no query sets")
+	}
+	r.Render()
+	for name, qs := range sets {
+		if r.gpures.queries[name] != qs {
+			t.Errorf("the second frame made a new %q query set", name)
+		}
+	}
+}